@@ -0,0 +1,807 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// ErrForbidden is returned when the role of the caller on a todo list does
+// not allow what was asked.
+var ErrForbidden = errors.New("role on the todo list does not allow it")
+
+// accessControl is a repository as seen by the caller, the actor on the
+// context. Todo lists the caller has no role on, and everything on them, are
+// not found, while writes their role doesn't allow fail with ErrForbidden.
+// A caller with no name only has a role on todo lists with no owner.
+//
+// Creating users takes the admin scope, and so does reaching the tokens of
+// other users, which are otherwise not found. Labels are not on any todo
+// list, but count only the todos the caller can see, and renaming or
+// deleting one changes the todos having it, so it takes the editor role on
+// all of their todo lists or the admin scope.
+type accessControl struct {
+	repository.Repository
+}
+
+func caller(ctx context.Context) string {
+	return repository.ActorFromContext(ctx)
+}
+
+// checkRole returns notFound when the caller has no role on todoList, and
+// ErrForbidden when their role doesn't include min.
+func checkRole(ctx context.Context, todoList repository.TodoList, min repository.Role, notFound error) error {
+	role := todoList.RoleOf(caller(ctx))
+	if role == "" {
+		return notFound
+	}
+	if !role.Includes(min) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// checkTodoList returns an active todo list the caller has at least min on.
+func (ac accessControl) checkTodoList(ctx context.Context, id uint32, min repository.Role) (*repository.TodoList, error) {
+	todoList, err := ac.Repository.GetTodoListByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRole(ctx, *todoList, min, repository.ErrTodoListNotFound); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+// checkTodo returns an active todo whose todo list the caller has at least
+// min on. A todo the caller can't see fails with notFound.
+func (ac accessControl) checkTodo(ctx context.Context, id uint32, min repository.Role, notFound error) (*repository.Todo, error) {
+	todo, err := ac.Repository.GetTodoByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	todoList, err := ac.Repository.GetTodoListByID(ctx, todo.ListID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRole(ctx, *todoList, min, notFound); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// roleOn returns the role of the caller on a todo list, active or on the
+// trash. The trash is read when needed and kept on trash for the next call.
+func (ac accessControl) roleOn(ctx context.Context, id uint32, trash **repository.Trash) (repository.Role, error) {
+	todoList, err := ac.Repository.GetTodoListByID(ctx, id)
+	if err == nil {
+		return todoList.RoleOf(caller(ctx)), nil
+	}
+	if !errors.Is(err, repository.ErrTodoListNotFound) {
+		return "", err
+	}
+
+	if *trash == nil {
+		if *trash, err = ac.Repository.GetTrash(ctx); err != nil {
+			return "", err
+		}
+	}
+	for _, trashed := range (*trash).TodoLists {
+		if trashed.TodoList.ID == id {
+			return trashed.TodoList.RoleOf(caller(ctx)), nil
+		}
+	}
+	return "", nil
+}
+
+// trashedTodoRole returns the role of the caller on a todo on the trash, and
+// false when it is not there.
+func (ac accessControl) trashedTodoRole(ctx context.Context, id uint32) (repository.Role, bool, error) {
+	trash, err := ac.Repository.GetTrash(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	for _, trashed := range trash.Todos {
+		if trashed.Todo.ID == id {
+			role, err := ac.roleOn(ctx, trashed.Todo.ListID, &trash)
+			return role, true, err
+		}
+	}
+	return "", false, nil
+}
+
+// checkFound returns notFound when the caller has no role, and ErrForbidden
+// when their role doesn't include min.
+func checkFound(role, min repository.Role, notFound error) error {
+	if role == "" {
+		return notFound
+	}
+	if !role.Includes(min) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// TodoList
+
+func (ac accessControl) GetAllTodoLists(ctx context.Context) ([]repository.TodoList, error) {
+	todoLists, err := ac.Repository.GetAllTodoLists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []repository.TodoList{}
+	for _, todoList := range todoLists {
+		if todoList.RoleOf(caller(ctx)) != "" {
+			visible = append(visible, todoList)
+		}
+	}
+	return visible, nil
+}
+
+func (ac accessControl) GetTodoListByID(ctx context.Context, id uint32) (*repository.TodoList, error) {
+	return ac.checkTodoList(ctx, id, repository.RoleViewer)
+}
+
+func (ac accessControl) UpdateTodoList(ctx context.Context, todoList repository.TodoList) error {
+	if _, err := ac.checkTodoList(ctx, todoList.ID, repository.RoleEditor); err != nil {
+		return err
+	}
+	return ac.Repository.UpdateTodoList(ctx, todoList)
+}
+
+func (ac accessControl) DeleteTodoListByID(ctx context.Context, id uint32, opts repository.DeleteTodoListOptions) error {
+	if _, err := ac.checkTodoList(ctx, id, repository.RoleOwner); err != nil {
+		return err
+	}
+	if opts.Policy == repository.DeleteMove && opts.TargetListID != id {
+		_, err := ac.checkTodoList(ctx, opts.TargetListID, repository.RoleEditor)
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			return repository.ErrInvalidTarget
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ac.Repository.DeleteTodoListByID(ctx, id, opts)
+}
+
+// Todo
+
+func (ac accessControl) InsertTodo(ctx context.Context, todo repository.Todo) (*repository.Todo, error) {
+	if _, err := ac.checkTodoList(ctx, todo.ListID, repository.RoleEditor); err != nil {
+		return nil, err
+	}
+	return ac.Repository.InsertTodo(ctx, todo)
+}
+
+func (ac accessControl) GetTodoByID(ctx context.Context, id uint32) (*repository.Todo, error) {
+	return ac.checkTodo(ctx, id, repository.RoleViewer, repository.ErrTodoNotFound)
+}
+
+func (ac accessControl) GetTodosByListID(ctx context.Context, listID uint32) ([]repository.Todo, error) {
+	if _, err := ac.checkTodoList(ctx, listID, repository.RoleViewer); err != nil {
+		return nil, err
+	}
+	return ac.Repository.GetTodosByListID(ctx, listID)
+}
+
+// QueryTodos narrows the query down to the todo lists the caller can see.
+func (ac accessControl) QueryTodos(ctx context.Context, query repository.TodoQuery) (*repository.TodoPage, error) {
+	for _, listID := range query.ListIDs {
+		if _, err := ac.checkTodoList(ctx, listID, repository.RoleViewer); err != nil {
+			return nil, err
+		}
+	}
+	if len(query.ListIDs) > 0 {
+		return ac.Repository.QueryTodos(ctx, query)
+	}
+
+	todoLists, err := ac.Repository.GetAllTodoLists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	visible, err := ac.GetAllTodoLists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(visible) == len(todoLists) {
+		return ac.Repository.QueryTodos(ctx, query)
+	}
+	if len(visible) == 0 {
+		// No todo lists would mean all of them to the repository
+		if err := query.Validate(); err != nil {
+			return nil, err
+		}
+		return &repository.TodoPage{Todos: []repository.Todo{}}, nil
+	}
+
+	for _, todoList := range visible {
+		query.ListIDs = append(query.ListIDs, todoList.ID)
+	}
+	return ac.Repository.QueryTodos(ctx, query)
+}
+
+func (ac accessControl) UpdateTodo(ctx context.Context, todo repository.Todo) error {
+	stored, err := ac.checkTodo(ctx, todo.ID, repository.RoleEditor, repository.ErrTodoNotFound)
+	if err != nil {
+		return err
+	}
+	if todo.ListID != stored.ListID {
+		if _, err := ac.checkTodoList(ctx, todo.ListID, repository.RoleEditor); err != nil {
+			return err
+		}
+	}
+	return ac.Repository.UpdateTodo(ctx, todo)
+}
+
+func (ac accessControl) MoveTodo(ctx context.Context, id uint32, opts repository.MoveTodoOptions) (*repository.Todo, error) {
+	stored, err := ac.checkTodo(ctx, id, repository.RoleEditor, repository.ErrTodoNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ListID != stored.ListID {
+		if _, err := ac.checkTodoList(ctx, opts.ListID, repository.RoleEditor); err != nil {
+			return nil, err
+		}
+	}
+	return ac.Repository.MoveTodo(ctx, id, opts)
+}
+
+func (ac accessControl) DeleteTodo(ctx context.Context, todo repository.Todo) error {
+	if _, err := ac.checkTodo(ctx, todo.ID, repository.RoleEditor, repository.ErrTodoNotFound); err != nil {
+		return err
+	}
+	return ac.Repository.DeleteTodo(ctx, todo)
+}
+
+// Dependencies
+
+func (ac accessControl) AddDependency(ctx context.Context, id, blockerID uint32) error {
+	if _, err := ac.checkTodo(ctx, id, repository.RoleEditor, repository.ErrTodoNotFound); err != nil {
+		return err
+	}
+	if _, err := ac.checkTodo(ctx, blockerID, repository.RoleViewer, repository.ErrTodoNotFound); err != nil {
+		return err
+	}
+	return ac.Repository.AddDependency(ctx, id, blockerID)
+}
+
+// RemoveDependency only looks at the blocked todo, as the blocker may be
+// gone already.
+func (ac accessControl) RemoveDependency(ctx context.Context, id, blockerID uint32) error {
+	if _, err := ac.checkTodo(ctx, id, repository.RoleEditor, repository.ErrTodoNotFound); err != nil {
+		return err
+	}
+	return ac.Repository.RemoveDependency(ctx, id, blockerID)
+}
+
+// GetBlockers leaves out the blockers on todo lists the caller can't see.
+func (ac accessControl) GetBlockers(ctx context.Context, id uint32) ([]repository.Todo, error) {
+	if _, err := ac.checkTodo(ctx, id, repository.RoleViewer, repository.ErrTodoNotFound); err != nil {
+		return nil, err
+	}
+	blockers, err := ac.Repository.GetBlockers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var trash *repository.Trash
+	visible := []repository.Todo{}
+	for _, blocker := range blockers {
+		role, err := ac.roleOn(ctx, blocker.ListID, &trash)
+		if err != nil {
+			return nil, err
+		}
+		if role != "" {
+			visible = append(visible, blocker)
+		}
+	}
+	return visible, nil
+}
+
+// Trash
+
+// GetTrash leaves out the todo lists and todos the caller can't see.
+func (ac accessControl) GetTrash(ctx context.Context) (*repository.Trash, error) {
+	trash, err := ac.Repository.GetTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{},
+		Todos:     []repository.TrashedTodo{},
+	}
+	for _, trashed := range trash.TodoLists {
+		if trashed.TodoList.RoleOf(caller(ctx)) != "" {
+			visible.TodoLists = append(visible.TodoLists, trashed)
+		}
+	}
+	for _, trashed := range trash.Todos {
+		role, err := ac.roleOn(ctx, trashed.Todo.ListID, &trash)
+		if err != nil {
+			return nil, err
+		}
+		if role != "" {
+			visible.Todos = append(visible.Todos, trashed)
+		}
+	}
+	return visible, nil
+}
+
+func (ac accessControl) RestoreTodoList(ctx context.Context, id uint32) (*repository.TodoList, error) {
+	if err := ac.checkTrashedTodoList(ctx, id); err != nil {
+		return nil, err
+	}
+	return ac.Repository.RestoreTodoList(ctx, id)
+}
+
+func (ac accessControl) RestoreTodo(ctx context.Context, id uint32) (*repository.Todo, error) {
+	if err := ac.checkTrashedTodo(ctx, id, repository.RoleEditor); err != nil {
+		return nil, err
+	}
+	return ac.Repository.RestoreTodo(ctx, id)
+}
+
+func (ac accessControl) PurgeTodoList(ctx context.Context, id uint32) error {
+	if err := ac.checkTrashedTodoList(ctx, id); err != nil {
+		return err
+	}
+	return ac.Repository.PurgeTodoList(ctx, id)
+}
+
+func (ac accessControl) PurgeTodo(ctx context.Context, id uint32) error {
+	if err := ac.checkTrashedTodo(ctx, id, repository.RoleOwner); err != nil {
+		return err
+	}
+	return ac.Repository.PurgeTodo(ctx, id)
+}
+
+// PurgeTrash purges everything deleted before the given time, so the caller
+// must own every todo list it would purge from.
+func (ac accessControl) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	trash, err := ac.Repository.GetTrash(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, trashed := range trash.TodoLists {
+		if trashed.DeletedAt.Before(deletedBefore) && !trashed.TodoList.RoleOf(caller(ctx)).Includes(repository.RoleOwner) {
+			return 0, ErrForbidden
+		}
+	}
+	for _, trashed := range trash.Todos {
+		if !trashed.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		role, err := ac.roleOn(ctx, trashed.Todo.ListID, &trash)
+		if err != nil {
+			return 0, err
+		}
+		if !role.Includes(repository.RoleOwner) {
+			return 0, ErrForbidden
+		}
+	}
+	return ac.Repository.PurgeTrash(ctx, deletedBefore)
+}
+
+// checkTrashedTodoList lets only owners restore and purge a todo list. Todo
+// lists the caller can't see are not on the trash.
+func (ac accessControl) checkTrashedTodoList(ctx context.Context, id uint32) error {
+	trash, err := ac.Repository.GetTrash(ctx)
+	if err != nil {
+		return err
+	}
+	for _, trashed := range trash.TodoLists {
+		if trashed.TodoList.ID == id {
+			return checkFound(trashed.TodoList.RoleOf(caller(ctx)), repository.RoleOwner, repository.ErrNotInTrash)
+		}
+	}
+	// Left to the repository to tell it is not there
+	return nil
+}
+
+func (ac accessControl) checkTrashedTodo(ctx context.Context, id uint32, min repository.Role) error {
+	role, found, err := ac.trashedTodoRole(ctx, id)
+	if err != nil || !found {
+		return err
+	}
+	return checkFound(role, min, repository.ErrNotInTrash)
+}
+
+// History
+
+func (ac accessControl) GetTodoListHistory(ctx context.Context, id uint32) ([]repository.HistoryEntry, error) {
+	var trash *repository.Trash
+	role, err := ac.roleOn(ctx, id, &trash)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, repository.ErrTodoListNotFound
+	}
+	return ac.Repository.GetTodoListHistory(ctx, id)
+}
+
+func (ac accessControl) GetTodoHistory(ctx context.Context, id uint32) ([]repository.HistoryEntry, error) {
+	todo, err := ac.Repository.GetTodoByID(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrTodoNotFound) {
+		return nil, err
+	}
+
+	var role repository.Role
+	if err == nil {
+		var trash *repository.Trash
+		role, err = ac.roleOn(ctx, todo.ListID, &trash)
+	} else {
+		var found bool
+		role, found, err = ac.trashedTodoRole(ctx, id)
+		if err == nil && !found {
+			// Purged, or never there
+			return ac.Repository.GetTodoHistory(ctx, id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, repository.ErrTodoNotFound
+	}
+	return ac.Repository.GetTodoHistory(ctx, id)
+}
+
+// Comments
+
+func (ac accessControl) InsertComment(ctx context.Context, comment repository.Comment) (*repository.Comment, error) {
+	if _, err := ac.checkTodo(ctx, comment.TodoID, repository.RoleEditor, repository.ErrTodoNotFound); err != nil {
+		return nil, err
+	}
+	return ac.Repository.InsertComment(ctx, comment)
+}
+
+func (ac accessControl) GetComments(ctx context.Context, todoID uint32) ([]repository.Comment, error) {
+	if _, err := ac.checkTodo(ctx, todoID, repository.RoleViewer, repository.ErrTodoNotFound); err != nil {
+		return nil, err
+	}
+	return ac.Repository.GetComments(ctx, todoID)
+}
+
+func (ac accessControl) GetComment(ctx context.Context, id uint32) (*repository.Comment, error) {
+	return ac.checkComment(ctx, id, repository.RoleViewer)
+}
+
+func (ac accessControl) UpdateComment(ctx context.Context, comment repository.Comment) error {
+	if _, err := ac.checkComment(ctx, comment.ID, repository.RoleEditor); err != nil {
+		return err
+	}
+	return ac.Repository.UpdateComment(ctx, comment)
+}
+
+func (ac accessControl) DeleteComment(ctx context.Context, comment repository.Comment) error {
+	if _, err := ac.checkComment(ctx, comment.ID, repository.RoleEditor); err != nil {
+		return err
+	}
+	return ac.Repository.DeleteComment(ctx, comment)
+}
+
+func (ac accessControl) checkComment(ctx context.Context, id uint32, min repository.Role) (*repository.Comment, error) {
+	comment, err := ac.Repository.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ac.checkTodo(ctx, comment.TodoID, min, repository.ErrCommentNotFound); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Attachments
+
+func (ac accessControl) InsertAttachment(ctx context.Context, attachment repository.Attachment) (*repository.Attachment, error) {
+	if _, err := ac.checkTodo(ctx, attachment.TodoID, repository.RoleEditor, repository.ErrTodoNotFound); err != nil {
+		return nil, err
+	}
+	return ac.Repository.InsertAttachment(ctx, attachment)
+}
+
+// checkAttachable returns nil when the caller of repo may attach files to
+// the todo with the given ID, so uploads are refused before their content
+// is read. It fails as InsertAttachment would.
+func checkAttachable(ctx context.Context, repo repository.Repository, todoID uint32) error {
+	todo, err := repo.GetTodoByID(ctx, todoID)
+	if err != nil {
+		return err
+	}
+	todoList, err := repo.GetTodoListByID(ctx, todo.ListID)
+	if err != nil {
+		return err
+	}
+	return checkRole(ctx, *todoList, repository.RoleEditor, repository.ErrTodoNotFound)
+}
+
+func (ac accessControl) GetAttachments(ctx context.Context, todoID uint32) ([]repository.Attachment, error) {
+	if _, err := ac.checkTodo(ctx, todoID, repository.RoleViewer, repository.ErrTodoNotFound); err != nil {
+		return nil, err
+	}
+	return ac.Repository.GetAttachments(ctx, todoID)
+}
+
+func (ac accessControl) GetAttachment(ctx context.Context, id uint32) (*repository.Attachment, error) {
+	return ac.checkAttachment(ctx, id, repository.RoleViewer)
+}
+
+func (ac accessControl) DeleteAttachment(ctx context.Context, id uint32) error {
+	if _, err := ac.checkAttachment(ctx, id, repository.RoleEditor); err != nil {
+		return err
+	}
+	return ac.Repository.DeleteAttachment(ctx, id)
+}
+
+func (ac accessControl) checkAttachment(ctx context.Context, id uint32, min repository.Role) (*repository.Attachment, error) {
+	attachment, err := ac.Repository.GetAttachment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ac.checkTodo(ctx, attachment.TodoID, min, repository.ErrAttachmentNotFound); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// Sharing
+
+func (ac accessControl) ShareTodoList(ctx context.Context, id uint32, member repository.Member) (*repository.TodoList, error) {
+	if _, err := ac.checkTodoList(ctx, id, repository.RoleOwner); err != nil {
+		return nil, err
+	}
+	return ac.Repository.ShareTodoList(ctx, id, member)
+}
+
+// UnshareTodoList also lets members leave a todo list on their own.
+func (ac accessControl) UnshareTodoList(ctx context.Context, id uint32, user string) (*repository.TodoList, error) {
+	min := repository.RoleOwner
+	if user != "" && user == caller(ctx) {
+		min = repository.RoleViewer
+	}
+	if _, err := ac.checkTodoList(ctx, id, min); err != nil {
+		return nil, err
+	}
+	return ac.Repository.UnshareTodoList(ctx, id, user)
+}
+
+// Feeds
+
+// SetFeedToken takes the owner role, as the secret reads the todo list
+// without the credentials of anyone.
+func (ac accessControl) SetFeedToken(ctx context.Context, id uint32, hash string) (*repository.TodoList, error) {
+	if _, err := ac.checkTodoList(ctx, id, repository.RoleOwner); err != nil {
+		return nil, err
+	}
+	return ac.Repository.SetFeedToken(ctx, id, hash)
+}
+
+// Labels
+
+func (ac accessControl) InsertLabel(ctx context.Context, label repository.Label) (*repository.Label, error) {
+	inserted, err := ac.Repository.InsertLabel(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+	if err := ac.countLabels(ctx, inserted); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+func (ac accessControl) GetAllLabels(ctx context.Context) ([]repository.Label, error) {
+	labels, err := ac.Repository.GetAllLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pointers := make([]*repository.Label, 0, len(labels))
+	for i := range labels {
+		pointers = append(pointers, &labels[i])
+	}
+	if err := ac.countLabels(ctx, pointers...); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (ac accessControl) GetLabel(ctx context.Context, name string) (*repository.Label, error) {
+	label, err := ac.Repository.GetLabel(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ac.countLabels(ctx, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+func (ac accessControl) RenameLabel(ctx context.Context, name, newName string) (*repository.Label, error) {
+	if err := ac.checkLabel(ctx, name); err != nil {
+		return nil, err
+	}
+	label, err := ac.Repository.RenameLabel(ctx, name, newName)
+	if err != nil {
+		return nil, err
+	}
+	if err := ac.countLabels(ctx, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+func (ac accessControl) DeleteLabel(ctx context.Context, name string) error {
+	if err := ac.checkLabel(ctx, name); err != nil {
+		return err
+	}
+	return ac.Repository.DeleteLabel(ctx, name)
+}
+
+// checkLabel returns ErrForbidden unless the caller has the admin scope or
+// is an editor of every todo list, active or on the trash, with a todo
+// having the label.
+func (ac accessControl) checkLabel(ctx context.Context, name string) error {
+	if _, err := ac.Repository.GetLabel(ctx, name); err != nil {
+		return err
+	}
+	if granted(ctx, repository.ScopeAdmin) {
+		return nil
+	}
+
+	page, err := ac.Repository.QueryTodos(ctx, repository.TodoQuery{Labels: []string{name}})
+	if err != nil {
+		return err
+	}
+	trash, err := ac.Repository.GetTrash(ctx)
+	if err != nil {
+		return err
+	}
+	todos := page.Todos
+	for _, trashed := range trash.Todos {
+		todos = append(todos, trashed.Todo)
+	}
+
+	checked := map[uint32]bool{}
+	for _, todo := range todos {
+		if checked[todo.ListID] || !hasLabel(todo, name) {
+			continue
+		}
+		role, err := ac.roleOn(ctx, todo.ListID, &trash)
+		if err != nil {
+			return err
+		}
+		if !role.Includes(repository.RoleEditor) {
+			return ErrForbidden
+		}
+		checked[todo.ListID] = true
+	}
+	return nil
+}
+
+// countLabels sets the TodoCount of labels to how many todos the caller can
+// see have them.
+func (ac accessControl) countLabels(ctx context.Context, labels ...*repository.Label) error {
+	page, err := ac.QueryTodos(ctx, repository.TodoQuery{})
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, todo := range page.Todos {
+		for _, name := range todo.Labels {
+			counts[name]++
+		}
+	}
+	for _, label := range labels {
+		label.TodoCount = counts[label.Name]
+	}
+	return nil
+}
+
+func hasLabel(todo repository.Todo, name string) bool {
+	for _, label := range todo.Labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Users
+
+func (ac accessControl) InsertUser(ctx context.Context, user repository.User) (*repository.User, error) {
+	if !allowed(ctx, repository.ScopeAdmin) {
+		return nil, ErrInsufficientScope
+	}
+	return ac.Repository.InsertUser(ctx, user)
+}
+
+// Tokens
+
+// InsertToken refuses tokens with scopes the caller is not allowed, so no
+// token can grant more than the one creating it.
+func (ac accessControl) InsertToken(ctx context.Context, token repository.Token) (*repository.Token, error) {
+	if token.User != caller(ctx) && !allowed(ctx, repository.ScopeAdmin) {
+		return nil, ErrInsufficientScope
+	}
+	for _, scope := range token.Scopes {
+		if scope.Valid() && !allowed(ctx, scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+	return ac.Repository.InsertToken(ctx, token)
+}
+
+func (ac accessControl) GetTokens(ctx context.Context, user string) ([]repository.Token, error) {
+	if user != caller(ctx) && !allowed(ctx, repository.ScopeAdmin) {
+		return nil, ErrInsufficientScope
+	}
+	return ac.Repository.GetTokens(ctx, user)
+}
+
+func (ac accessControl) GetToken(ctx context.Context, id uint32) (*repository.Token, error) {
+	token, err := ac.Repository.GetToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if token.User != caller(ctx) && !allowed(ctx, repository.ScopeAdmin) {
+		return nil, repository.ErrTokenNotFound
+	}
+	return token, nil
+}
+
+func (ac accessControl) DeleteToken(ctx context.Context, id uint32) error {
+	if _, err := ac.GetToken(ctx, id); err != nil {
+		return err
+	}
+	return ac.Repository.DeleteToken(ctx, id)
+}
+
+// Search
+
+// Search leaves out the hits on todo lists the caller can't see, so it
+// searches without limit and applies it afterwards.
+func (ac accessControl) Search(ctx context.Context, query repository.SearchQuery) ([]repository.SearchHit, error) {
+	limit := query.Limit
+	if limit > 0 {
+		query.Limit = 0
+	}
+	hits, err := ac.Repository.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []repository.SearchHit{}
+	for _, hit := range hits {
+		if limit > 0 && len(visible) == limit {
+			break
+		}
+		if hit.TodoList.RoleOf(caller(ctx)) != "" {
+			visible = append(visible, hit)
+		}
+	}
+	return visible, nil
+}
+
+// Backups
+
+// Backup and Restore reach everything, whoever owns it, so they take a
+// token granting the admin scope.
+func (ac accessControl) Backup(ctx context.Context) (*repository.Backup, error) {
+	if !granted(ctx, repository.ScopeAdmin) {
+		return nil, ErrInsufficientScope
+	}
+	return ac.Repository.Backup(ctx)
+}
+
+func (ac accessControl) Restore(ctx context.Context, backup repository.Backup, mode repository.RestoreMode) error {
+	if !granted(ctx, repository.ScopeAdmin) {
+		return ErrInsufficientScope
+	}
+	return ac.Repository.Restore(ctx, backup, mode)
+}
@@ -1,12 +1,21 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -21,25 +30,235 @@ const (
 	TodoListIDPath = TodoListPath + "/{id}"
 	TodoPath       = TodoListPath + "/{list_id}/todo"
 	TodoIDPath     = TodoPath + "/{id}"
+
+	TodoListHistoryPath = TodoListIDPath + "/history"
+	TodoListMembersPath = TodoListIDPath + "/members"
+	TodoListMemberPath  = TodoListMembersPath + "/{user}"
+	TodoListTodoTxtPath = TodoListIDPath + "/todo.txt"
+	TodoHistoryPath     = TodoIDPath + "/history"
+	TodoMovePath        = TodoIDPath + "/move"
+	TodoBlockersPath    = TodoIDPath + "/blockers"
+	TodoBlockerIDPath   = TodoBlockersPath + "/{blocker_id}"
+	TodoCommentsPath    = TodoIDPath + "/comments"
+	TodoCommentIDPath   = TodoCommentsPath + "/{comment_id}"
+
+	TodoListCalendarPath      = TodoListIDPath + "/calendar.ics"
+	TodoListCalendarTokenPath = TodoListIDPath + "/calendar/token"
+
+	// FeedTokenParam is the query parameter holding the secret of a
+	// calendar feed, read instead of the credentials of a user.
+	FeedTokenParam = "token"
+
+	TodoAttachmentsPath       = TodoIDPath + "/attachments"
+	TodoAttachmentIDPath      = TodoAttachmentsPath + "/{attachment_id}"
+	TodoAttachmentContentPath = TodoAttachmentIDPath + "/content"
+
+	// AttachmentFormField is the multipart form field holding an uploaded
+	// file.
+	AttachmentFormField = "file"
+
+	UserPath     = "/user"
+	UserNamePath = UserPath + "/{name}"
+
+	// UserHeader names the user making a request. Requests without it are
+	// anonymous. It is only trusted with AuthOptions.TrustUserHeader, and
+	// ignored on requests with a token.
+	UserHeader = "X-User"
+
+	TokenPath   = "/token"
+	TokenIDPath = TokenPath + "/{id}"
+
+	LabelPath       = "/label"
+	LabelNamePath   = LabelPath + "/{name}"
+	LabelRenamePath = LabelNamePath + "/rename"
+
+	SearchPath = "/search"
+
+	TrashPath                = "/trash"
+	TrashTodoListIDPath      = TrashPath + "/todolist/{id}"
+	TrashTodoListRestorePath = TrashTodoListIDPath + "/restore"
+	TrashTodoIDPath          = TrashPath + "/todo/{id}"
+	TrashTodoRestorePath     = TrashTodoIDPath + "/restore"
+
+	AdminPath        = "/admin"
+	AdminBackupPath  = AdminPath + "/backup"
+	AdminRestorePath = AdminPath + "/restore"
+
+	// NextCursorHeader carries the cursor for the next page of todos.
+	NextCursorHeader = "X-Next-Cursor"
 )
 
 var (
 	ErrInvalidDueDate = errors.New("due_date is invalid")
+	ErrInvalidIfMatch = errors.New("If-Match does not hold a version")
+	ErrMissingFile    = errors.New("multipart form has no file field")
 )
 
+// Timestamps on transports are set by the server and ignored on requests.
+
+// TodoListTransport is a todo list. Its owner and members are set by the
+// server and ignored on requests, the members change by sharing it.
 type TodoListTransport struct {
-	ID    uint32 `json:"id"`
-	Title string `json:"title"`
+	ID        uint32            `json:"id"`
+	Title     string            `json:"title"`
+	Version   uint64            `json:"version"`
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+	Owner     string            `json:"owner"`
+	Members   []MemberTransport `json:"members"`
+}
+
+// MemberTransport is a user a todo list is shared with, and their role on
+// it. Only the role is read when sharing, the user comes from the path.
+type MemberTransport struct {
+	User string `json:"user"`
+	Role string `json:"role"`
 }
 
 type TodoTransport struct {
 	ID          uint32   `json:"id"`
 	ListID      uint32   `json:"list_id"`
 	Description string   `json:"description"`
-	Comments    string   `json:"comments"`
 	DueDate     string   `json:"due_date"`
 	Labels      []string `json:"labels"`
 	Done        bool     `json:"done"`
+	Version     uint64   `json:"version"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+	CompletedAt string   `json:"completed_at"`
+	Position    int      `json:"position"`
+	ParentID    *uint32  `json:"parent_id"`
+	Recurrence  string   `json:"recurrence"`
+}
+
+// TodoNodeTransport is a todo with its subtasks nested, on the tree view of
+// a todo list.
+type TodoNodeTransport struct {
+	TodoTransport
+	Subtasks []TodoNodeTransport `json:"subtasks"`
+}
+
+// MoveTodoTransport is where a todo is moved to. A missing list_id keeps
+// the todo list on the path and a missing before_id moves to the end.
+type MoveTodoTransport struct {
+	ListID   *uint32 `json:"list_id"`
+	BeforeID *uint32 `json:"before_id"`
+}
+
+type LabelTransport struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+	Version     uint64 `json:"version"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	// TodoCount is set by the server and ignored on requests.
+	TodoCount int `json:"todo_count"`
+}
+
+type UserTransport struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// TokenTransport is an API token. Its secret is only sent once, when it is
+// created, and is never kept.
+type TokenTransport struct {
+	ID        uint32   `json:"id"`
+	User      string   `json:"user"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+	Secret    string   `json:"secret,omitempty"`
+}
+
+// CalendarTokenTransport is the secret of the calendar feed of a todo list,
+// only sent when it is created, and the URL of the feed with it, relative
+// to the service.
+type CalendarTokenTransport struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// RenameLabelTransport is the new name of a label.
+type RenameLabelTransport struct {
+	Name string `json:"name"`
+}
+
+// CommentTransport is a comment on a todo. A null parent_id starts a
+// thread, otherwise it replies to another comment on the same todo.
+type CommentTransport struct {
+	ID        uint32  `json:"id"`
+	TodoID    uint32  `json:"todo_id"`
+	ParentID  *uint32 `json:"parent_id"`
+	Author    string  `json:"author"`
+	Body      string  `json:"body"`
+	Version   uint64  `json:"version"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// CommentNodeTransport is a comment with its replies nested, on the tree
+// view of the comments of a todo.
+type CommentNodeTransport struct {
+	CommentTransport
+	Replies []CommentNodeTransport `json:"replies"`
+}
+
+// AttachmentTransport describes a file on a todo. Its content is downloaded
+// on its own.
+type AttachmentTransport struct {
+	ID          uint32 `json:"id"`
+	TodoID      uint32 `json:"todo_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// SearchHitTransport is a todo list or todo matching a search. Todo is null
+// when the todo list itself matched.
+type SearchHitTransport struct {
+	TodoList TodoListTransport `json:"todo_list"`
+	Todo     *TodoTransport    `json:"todo"`
+	Fields   []string          `json:"fields"`
+	Score    float64           `json:"score"`
+}
+
+type TrashedTodoListTransport struct {
+	TodoList  TodoListTransport `json:"todo_list"`
+	DeletedAt string            `json:"deleted_at"`
+	TodoIDs   []uint32          `json:"todo_ids"`
+}
+
+type TrashedTodoTransport struct {
+	Todo       TodoTransport `json:"todo"`
+	DeletedAt  string        `json:"deleted_at"`
+	SubtaskIDs []uint32      `json:"subtask_ids"`
+}
+
+type TrashTransport struct {
+	TodoLists []TrashedTodoListTransport `json:"todo_lists"`
+	Todos     []TrashedTodoTransport     `json:"todos"`
+}
+
+type PurgeTrashTransport struct {
+	Purged int `json:"purged"`
+}
+
+type FieldChangeTransport struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type HistoryEntryTransport struct {
+	At      string                 `json:"at"`
+	Actor   string                 `json:"actor"`
+	Action  string                 `json:"action"`
+	Changes []FieldChangeTransport `json:"changes"`
 }
 
 type Error struct {
@@ -51,12 +270,21 @@ type ErrorResponse struct {
 }
 
 type Api struct {
-	repo repository.Repository
+	repo  repository.Repository
+	blobs *repository.BlobStore
+	// Auth decides how requests are authenticated.
+	Auth AuthOptions
+	// Limiter limits how many requests each client makes. Nil limits
+	// nothing.
+	Limiter *RateLimiter
 }
 
-func NewApi(repo repository.Repository) Api {
+// NewApi serves repo, keeping the content of attachments on blobs. Each
+// request only reaches the todo lists its user has a role on.
+func NewApi(repo repository.Repository, blobs *repository.BlobStore) Api {
 	return Api{
-		repo: repo,
+		repo:  accessControl{repo},
+		blobs: blobs,
 	}
 }
 
@@ -66,9 +294,217 @@ func (a *Api) RegisterRoutes() http.Handler {
 	handler.HandleFunc(TodoListIDPath, a.TodoListByID)
 	handler.HandleFunc(TodoPath, a.Todo)
 	handler.HandleFunc(TodoIDPath, a.TodoByID)
+	handler.HandleFunc(TodoListHistoryPath, a.TodoListHistory)
+	handler.HandleFunc(TodoListMemberPath, a.TodoListMember)
+	handler.HandleFunc(TodoListTodoTxtPath, a.TodoListTodoTxt)
+	handler.HandleFunc(TodoListCalendarPath, a.TodoListCalendar)
+	handler.HandleFunc(TodoListCalendarTokenPath, a.TodoListCalendarToken)
+	handler.HandleFunc(TodoHistoryPath, a.TodoHistory)
+	handler.HandleFunc(TodoMovePath, a.TodoMove)
+	handler.HandleFunc(TodoBlockersPath, a.TodoBlockers)
+	handler.HandleFunc(TodoBlockerIDPath, a.TodoBlockerByID)
+	handler.HandleFunc(TodoCommentsPath, a.TodoComments)
+	handler.HandleFunc(TodoCommentIDPath, a.TodoCommentByID)
+	handler.HandleFunc(TodoAttachmentsPath, a.TodoAttachments)
+	handler.HandleFunc(TodoAttachmentIDPath, a.TodoAttachmentByID)
+	handler.HandleFunc(TodoAttachmentContentPath, a.TodoAttachmentContent)
+	handler.HandleFunc(UserPath, a.User)
+	handler.HandleFunc(UserNamePath, a.UserByName)
+	handler.HandleFunc(TokenPath, a.Token)
+	handler.HandleFunc(TokenIDPath, a.TokenByID)
+	handler.HandleFunc(LabelPath, a.Label)
+	handler.HandleFunc(LabelNamePath, a.LabelByName)
+	handler.HandleFunc(LabelRenamePath, a.LabelRename)
+	handler.HandleFunc(SearchPath, a.Search)
+	handler.HandleFunc(TrashPath, a.Trash)
+	handler.HandleFunc(TrashTodoListIDPath, a.TrashTodoListByID)
+	handler.HandleFunc(TrashTodoListRestorePath, a.TrashTodoListRestore)
+	handler.HandleFunc(TrashTodoIDPath, a.TrashTodoByID)
+	handler.HandleFunc(TrashTodoRestorePath, a.TrashTodoRestore)
+	handler.HandleFunc(AdminBackupPath, a.AdminBackup)
+	handler.HandleFunc(AdminRestorePath, a.AdminRestore)
+	handler.Use(a.rateLimitUnverified, a.identify, a.rateLimit)
 	return handler
 }
 
+// identify authenticates requests, making their user the actor, and
+// refuses the ones whose token doesn't allow them: reads take the read
+// scope and anything else the write scope. Reads of a calendar feed may
+// give its secret instead, on FeedTokenParam.
+func (a *Api) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		logger := log.WithFields(log.Fields{"action": "Identify"})
+
+		var ctx context.Context
+		var err error
+		if feedSecret := feedSecret(req); feedSecret != "" {
+			ctx, err = authenticateFeed(req.Context(), a.repo, feedSecret, mux.Vars(req)["id"])
+		} else {
+			secret := bearerToken(req.Header.Get("Authorization"))
+			ctx, err = authenticate(req.Context(), a.repo, a.Auth, secret, req.Header.Get(UserHeader))
+		}
+		if err != nil {
+			if errors.Is(err, ErrUnauthenticated) {
+				res.Header().Set("WWW-Authenticate", "Bearer")
+				res.WriteHeader(http.StatusUnauthorized)
+				logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+				logger.WithError(err).Warning("unauthorized error")
+				return
+			}
+			res.WriteHeader(http.StatusInternalServerError)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+			logger.WithError(err).Error("internal server error")
+			return
+		}
+
+		scope := repository.ScopeWrite
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			scope = repository.ScopeRead
+		}
+		if !allowed(ctx, scope) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, ErrInsufficientScope.Error()))
+			logger.WithError(ErrInsufficientScope).Warning("forbidden error")
+			return
+		}
+
+		next.ServeHTTP(res, req.WithContext(ctx))
+	})
+}
+
+// feedSecret returns the secret of the calendar feed a request reads, or an
+// empty string when it is not such a read or has credentials of its own.
+func feedSecret(req *http.Request) string {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ""
+	}
+	if req.Header.Get("Authorization") != "" {
+		return ""
+	}
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return ""
+	}
+	if path, err := route.GetPathTemplate(); err != nil || path != TodoListCalendarPath {
+		return ""
+	}
+	return req.URL.Query().Get(FeedTokenParam)
+}
+
+// rateLimitUnverified refuses the requests of IP addresses that made more
+// than their limit allows before they are authenticated, and counts the
+// requests failing to authenticate against their IP address. It runs before
+// identify, so floods of bad credentials don't reach the repository.
+func (a *Api) rateLimitUnverified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if a.Limiter == nil {
+			next.ServeHTTP(res, req)
+			return
+		}
+		logger := log.WithFields(log.Fields{"action": "RateLimit"})
+
+		limit, budget := a.rateBudget(req)
+		client := rateClient("", "", a.requestIP(req))
+
+		decision, limited := a.Limiter.peek(client, budget, limit, time.Now())
+		if limited && !decision.allowed {
+			writeRateLimited(logger, res, decision, client, budget)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: res}
+		next.ServeHTTP(recorder, req)
+		if recorder.status == http.StatusUnauthorized {
+			a.Limiter.take(client, budget, limit, time.Now())
+		}
+	})
+}
+
+// rateLimit refuses the requests of clients that made more than their limit
+// allows, telling them when to retry. It runs after identify, so it only
+// counts authenticated requests.
+func (a *Api) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if a.Limiter == nil {
+			next.ServeHTTP(res, req)
+			return
+		}
+		logger := log.WithFields(log.Fields{"action": "RateLimit"})
+
+		limit, budget := a.rateBudget(req)
+		client := rateClient(
+			bearerToken(req.Header.Get("Authorization")),
+			repository.ActorFromContext(req.Context()),
+			a.requestIP(req),
+		)
+		// Feeds read as the owner of their todo list, whose budget is not
+		// for whoever holds the secret to spend
+		if secret := feedSecret(req); secret != "" {
+			client = "feed:" + repository.HashToken(secret)
+		}
+
+		decision, limited := a.Limiter.take(client, budget, limit, time.Now())
+		if !limited {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if !decision.allowed {
+			writeRateLimited(logger, res, decision, client, budget)
+			return
+		}
+		setRateLimitHeaders(res, decision)
+		next.ServeHTTP(res, req)
+	})
+}
+
+// rateBudget returns the limit of a request and the name of its budget.
+func (a *Api) rateBudget(req *http.Request) (Limit, string) {
+	route, err := mux.CurrentRoute(req).GetPathTemplate()
+	if err != nil {
+		route = req.URL.Path
+	}
+	write := req.Method != http.MethodGet && req.Method != http.MethodHead
+	return a.Limiter.limitFor(req.Method, route, write)
+}
+
+// requestIP returns the IP address of the client making a request.
+func (a *Api) requestIP(req *http.Request) string {
+	var forwarded string
+	if a.Limiter.limits.ClientIPHeader != "" {
+		forwarded = req.Header.Get(a.Limiter.limits.ClientIPHeader)
+	}
+	return clientIP(forwarded, a.Limiter.limits.TrustedHops, req.RemoteAddr)
+}
+
+func setRateLimitHeaders(res http.ResponseWriter, decision rateDecision) {
+	res.Header().Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+	res.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	res.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(decision.reset)))
+}
+
+// writeRateLimited refuses a request of client refused by decision, telling
+// it when to retry.
+func writeRateLimited(logger *log.Entry, res http.ResponseWriter, decision rateDecision, client, budget string) {
+	setRateLimitHeaders(res, decision)
+	res.Header().Set("Retry-After", strconv.Itoa(seconds(decision.retryAfter)))
+	res.WriteHeader(http.StatusTooManyRequests)
+	logResponseBodyWrite(logger, res, newErrorResponse(logger, ErrRateLimited.Error()))
+	logger.WithFields(log.Fields{"client": client, "budget": budget}).Warning("too many requests error")
+}
+
+// statusRecorder is a response writer remembering the status code written
+// to it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
 // Todo List
 
 func (a *Api) TodoList(res http.ResponseWriter, req *http.Request) {
@@ -104,7 +540,7 @@ func (a *Api) CreateTodoList(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	newTodoList, err := a.repo.InsertTodoList(fromTransportToTodoList(todoListReq))
+	newTodoList, err := a.repo.InsertTodoList(req.Context(), fromTransportToTodoList(todoListReq))
 	if err != nil {
 		if errors.Is(err, repository.ErrEmptyTitle) {
 			res.WriteHeader(http.StatusBadRequest)
@@ -119,6 +555,7 @@ func (a *Api) CreateTodoList(res http.ResponseWriter, req *http.Request) {
 	}
 
 	todoListRes := toTransportTodoList(*newTodoList)
+	res.Header().Set("ETag", formatETag(newTodoList.Version))
 	res.WriteHeader(http.StatusOK)
 	logResponseBodyWrite(logger, res, toJSON(logger, todoListRes))
 }
@@ -126,7 +563,7 @@ func (a *Api) CreateTodoList(res http.ResponseWriter, req *http.Request) {
 func (a *Api) GetAllTodoLists(res http.ResponseWriter, req *http.Request) {
 	logger := log.WithFields(log.Fields{"action": "GetAllTodoLists"})
 
-	todoLists, err := a.repo.GetAllTodoLists()
+	todoLists, err := a.repo.GetAllTodoLists(req.Context())
 	if err != nil {
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
@@ -173,7 +610,7 @@ func (a *Api) GetTodoList(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	todoList, err := a.repo.GetTodoListByID(uint32(id))
+	todoList, err := a.repo.GetTodoListByID(req.Context(), uint32(id))
 	if err != nil {
 		if errors.Is(err, repository.ErrTodoListNotFound) {
 			res.WriteHeader(http.StatusNotFound)
@@ -188,6 +625,7 @@ func (a *Api) GetTodoList(res http.ResponseWriter, req *http.Request) {
 	}
 
 	todoListRes := toTransportTodoList(*todoList)
+	res.Header().Set("ETag", formatETag(todoList.Version))
 	res.WriteHeader(http.StatusOK)
 	logResponseBodyWrite(logger, res, toJSON(logger, todoListRes))
 }
@@ -215,8 +653,25 @@ func (a *Api) UpdateTodoList(res http.ResponseWriter, req *http.Request) {
 	}
 	todoListReq.ID = uint32(id)
 
-	err = a.repo.UpdateTodoList(fromTransportToTodoList(todoListReq))
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+	if conditional {
+		todoListReq.Version = ifMatch
+	}
+
+	err = a.repo.UpdateTodoList(req.Context(), fromTransportToTodoList(todoListReq))
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
 		if errors.Is(err, repository.ErrEmptyTitle) {
 			res.WriteHeader(http.StatusBadRequest)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
@@ -229,12 +684,27 @@ func (a *Api) UpdateTodoList(res http.ResponseWriter, req *http.Request) {
 			logger.WithError(err).Warning("not found error")
 			return
 		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
 		logger.WithError(err).Error("internal server error")
 		return
 	}
 
+	if todoListReq.Version != 0 {
+		res.Header().Set("ETag", formatETag(todoListReq.Version+1))
+	} else if stored, err := a.repo.GetTodoListByID(req.Context(), todoListReq.ID); err == nil {
+		// Unconditional updates don't know the version they made, so it is
+		// read back
+		res.Header().Set("ETag", formatETag(stored.Version))
+	} else {
+		logger.WithError(err).Warning("reading back updated todo list")
+	}
 	res.WriteHeader(http.StatusOK)
 	logResponseBodyWrite(logger, res, []byte{})
 }
@@ -249,14 +719,57 @@ func (a *Api) DeleteTodoList(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = a.repo.DeleteTodoListByID(uint32(id))
+	opts, err := parseDeleteTodoListOptions(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	ifMatch, conditional, err := parseIfMatch(req)
 	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+	opts.Version = ifMatch
+
+	err = a.repo.DeleteTodoListByID(req.Context(), uint32(id), opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidPolicy) ||
+			errors.Is(err, repository.ErrInvalidTarget) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
 		if errors.Is(err, repository.ErrTodoListNotFound) {
 			res.WriteHeader(http.StatusNotFound)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
 			logger.WithError(err).Warning("not found error")
 			return
 		}
+		if errors.Is(err, repository.ErrTodoListNotEmpty) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
 		logger.WithError(err).Error("internal server error")
@@ -267,16 +780,12 @@ func (a *Api) DeleteTodoList(res http.ResponseWriter, req *http.Request) {
 	logResponseBodyWrite(logger, res, []byte{})
 }
 
-// Todo
-
-func (a *Api) Todo(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"path": TodoPath})
+func (a *Api) TodoListHistory(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoListHistoryPath})
 
 	switch req.Method {
-	case http.MethodPost:
-		a.CreateTodo(res, req)
 	case http.MethodGet:
-		a.GetTodosByList(res, req)
+		a.GetTodoListHistory(res, req)
 	default:
 		res.WriteHeader(http.StatusMethodNotAllowed)
 		msg := fmt.Sprintf("method %q is not allowed", req.Method)
@@ -287,13 +796,61 @@ func (a *Api) Todo(res http.ResponseWriter, req *http.Request) {
 
 }
 
-func (a *Api) CreateTodo(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"action": "CreateTodo"})
+func (a *Api) GetTodoListHistory(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTodoListHistory"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	history, err := a.repo.GetTodoListHistory(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportHistory(history)))
+}
+
+// Sharing
+
+func (a *Api) TodoListMember(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoListMemberPath})
+
+	switch req.Method {
+	case http.MethodPut:
+		a.ShareTodoList(res, req)
+	case http.MethodDelete:
+		a.UnshareTodoList(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) ShareTodoList(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "ShareTodoList"})
 
 	dec := json.NewDecoder(req.Body)
-	todoReq := TodoTransport{}
+	memberReq := MemberTransport{}
 
-	err := dec.Decode(&todoReq)
+	err := dec.Decode(&memberReq)
 	if err != nil {
 		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
 		res.WriteHeader(http.StatusBadRequest)
@@ -303,24 +860,19 @@ func (a *Api) CreateTodo(res http.ResponseWriter, req *http.Request) {
 	}
 
 	vars := mux.Vars(req)
-	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
-		handleFieldParsingError(logger, res, "list_id", err)
+		handleFieldParsingError(logger, res, "id", err)
 		return
 	}
-	todoReq.ListID = uint32(listID)
 
-	todoForInsert, err := fromTransportToTodo(todoReq)
+	member := repository.Member{User: vars["user"], Role: repository.Role(memberReq.Role)}
+	todoList, err := a.repo.ShareTodoList(req.Context(), uint32(id), member)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-		logger.WithError(err).Warning("bad request error")
-		return
-	}
+		if errors.Is(err, repository.ErrUserNotFound) ||
+			errors.Is(err, repository.ErrInvalidRole) ||
+			errors.Is(err, repository.ErrOwnerMember) {
 
-	newTodo, err := a.repo.InsertTodo(todoForInsert)
-	if err != nil {
-		if errors.Is(err, repository.ErrEmptyDescription) {
 			res.WriteHeader(http.StatusBadRequest)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
 			logger.WithError(err).Warning("bad request error")
@@ -332,54 +884,70 @@ func (a *Api) CreateTodo(res http.ResponseWriter, req *http.Request) {
 			logger.WithError(err).Warning("not found error")
 			return
 		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
 		logger.WithError(err).Error("internal server error")
 		return
 	}
 
-	todoRes := toTransportTodo(*newTodo)
+	res.Header().Set("ETag", formatETag(todoList.Version))
 	res.WriteHeader(http.StatusOK)
-	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportTodoList(*todoList)))
 }
 
-func (a *Api) GetTodosByList(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"action": "GetTodosByList"})
+func (a *Api) UnshareTodoList(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "UnshareTodoList"})
 
 	vars := mux.Vars(req)
-	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
-		handleFieldParsingError(logger, res, "list_id", err)
+		handleFieldParsingError(logger, res, "id", err)
 		return
 	}
 
-	todos, err := a.repo.GetTodosByListID(uint32(listID))
+	todoList, err := a.repo.UnshareTodoList(req.Context(), uint32(id), vars["user"])
 	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) ||
+			errors.Is(err, repository.ErrNotMember) {
+
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
 		logger.WithError(err).Error("internal server error")
 		return
 	}
 
-	todosRes := []TodoTransport{}
-	for _, t := range todos {
-		todosRes = append(todosRes, toTransportTodo(t))
-	}
-
+	res.Header().Set("ETag", formatETag(todoList.Version))
 	res.WriteHeader(http.StatusOK)
-	logResponseBodyWrite(logger, res, toJSON(logger, todosRes))
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportTodoList(*todoList)))
 }
 
-func (a *Api) TodoByID(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"path": TodoIDPath})
+// Todo
+
+func (a *Api) Todo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoPath})
 
 	switch req.Method {
+	case http.MethodPost:
+		a.CreateTodo(res, req)
 	case http.MethodGet:
-		a.GetTodo(res, req)
-	case http.MethodPut:
-		a.UpdateTodo(res, req)
-	case http.MethodDelete:
-		a.DeleteTodo(res, req)
+		a.GetTodosByList(res, req)
 	default:
 		res.WriteHeader(http.StatusMethodNotAllowed)
 		msg := fmt.Sprintf("method %q is not allowed", req.Method)
@@ -390,78 +958,2604 @@ func (a *Api) TodoByID(res http.ResponseWriter, req *http.Request) {
 
 }
 
-func (a *Api) GetTodo(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"action": "GetTodo"})
+func (a *Api) CreateTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateTodo"})
 
-	vars := mux.Vars(req)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
-	if err != nil {
+	dec := json.NewDecoder(req.Body)
+	todoReq := TodoTransport{}
+
+	err := dec.Decode(&todoReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	vars := mux.Vars(req)
+	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "list_id", err)
+		return
+	}
+	todoReq.ListID = uint32(listID)
+
+	todoForInsert, err := fromTransportToTodo(todoReq)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	newTodo, err := a.repo.InsertTodo(req.Context(), todoForInsert)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmptyDescription) ||
+			errors.Is(err, repository.ErrInvalidParent) ||
+			errors.Is(err, repository.ErrInvalidRecurrence) ||
+			errors.Is(err, repository.ErrUnknownLabel) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todoRes := toTransportTodo(*newTodo)
+	res.Header().Set("ETag", formatETag(newTodo.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
+}
+
+func (a *Api) GetTodosByList(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTodosByList"})
+
+	vars := mux.Vars(req)
+	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "list_id", err)
+		return
+	}
+
+	query, err := parseTodoQuery(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+	query.ListIDs = []uint32{uint32(listID)}
+
+	tree, err := parseView(req)
+	if err == nil && tree && (query.Limit != 0 || query.Cursor != "") {
+		err = fmt.Errorf("%w: the tree view can't be paginated", repository.ErrInvalidQuery)
+	}
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	page, err := a.repo.QueryTodos(req.Context(), query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidQuery) ||
+			errors.Is(err, repository.ErrInvalidCursor) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if tree {
+		res.WriteHeader(http.StatusOK)
+		logResponseBodyWrite(logger, res, toJSON(logger, toTransportTodoTree(repository.NewTodoTree(page.Todos))))
+		return
+	}
+
+	todosRes := []TodoTransport{}
+	for _, t := range page.Todos {
+		todosRes = append(todosRes, toTransportTodo(t))
+	}
+
+	if page.NextCursor != "" {
+		res.Header().Set(NextCursorHeader, page.NextCursor)
+	}
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todosRes))
+}
+
+func (a *Api) TodoByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoIDPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetTodo(res, req)
+	case http.MethodPut:
+		a.UpdateTodo(res, req)
+	case http.MethodDelete:
+		a.DeleteTodo(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTodo"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	todo, err := a.repo.GetTodoByID(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todoRes := toTransportTodo(*todo)
+	res.Header().Set("ETag", formatETag(todo.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
+}
+
+func (a *Api) UpdateTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "UpdateTodo"})
+
+	dec := json.NewDecoder(req.Body)
+	todoReq := TodoTransport{}
+
+	err := dec.Decode(&todoReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	todoReq.ID = uint32(id)
+
+	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "list_id", err)
+		return
+	}
+	todoReq.ListID = uint32(listID)
+
+	todoForUpdate, err := fromTransportToTodo(todoReq)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+	if conditional {
+		todoForUpdate.Version = ifMatch
+	}
+
+	ctx := req.Context()
+	if v := req.URL.Query().Get("force"); v != "" {
+		force, err := strconv.ParseBool(v)
+		if err != nil {
+			handleFieldParsingError(logger, res, "force", err)
+			return
+		}
+		if force {
+			ctx = repository.WithForce(ctx)
+		}
+	}
+
+	err = a.repo.UpdateTodo(ctx, todoForUpdate)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		// The todo still has open blockers and the update was not forced
+		if errors.Is(err, repository.ErrBlocked) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrEmptyDescription) ||
+			errors.Is(err, repository.ErrInvalidParent) ||
+			errors.Is(err, repository.ErrInvalidRecurrence) ||
+			errors.Is(err, repository.ErrUnknownLabel) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrTodoListNotFound) {
+
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if todoForUpdate.Version != 0 {
+		res.Header().Set("ETag", formatETag(todoForUpdate.Version+1))
+	} else if stored, err := a.repo.GetTodoByID(ctx, todoForUpdate.ID); err == nil {
+		// Unconditional updates don't know the version they made, so it is
+		// read back
+		res.Header().Set("ETag", formatETag(stored.Version))
+	} else {
+		logger.WithError(err).Warning("reading back updated todo")
+	}
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) DeleteTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteTodo"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "list_id", err)
+		return
+	}
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+
+	todoForDelete := repository.Todo{
+		ID:      uint32(id),
+		ListID:  uint32(listID),
+		Version: ifMatch,
+	}
+
+	err = a.repo.DeleteTodo(req.Context(), todoForDelete)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) TodoMove(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoMovePath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.MoveTodo(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) MoveTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "MoveTodo"})
+
+	dec := json.NewDecoder(req.Body)
+	moveReq := MoveTodoTransport{}
+
+	err := dec.Decode(&moveReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "list_id", err)
+		return
+	}
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+
+	opts := repository.MoveTodoOptions{
+		ListID:   uint32(listID),
+		BeforeID: moveReq.BeforeID,
+		Version:  ifMatch,
+	}
+	if moveReq.ListID != nil {
+		opts.ListID = *moveReq.ListID
+	}
+
+	todo, err := a.repo.MoveTodo(req.Context(), uint32(id), opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidPosition) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrTodoListNotFound) {
+
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todoRes := toTransportTodo(*todo)
+	res.Header().Set("ETag", formatETag(todo.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
+}
+
+func (a *Api) TodoHistory(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoHistoryPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetTodoHistory(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetTodoHistory(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTodoHistory"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	history, err := a.repo.GetTodoHistory(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportHistory(history)))
+}
+
+// Dependencies
+
+func (a *Api) TodoBlockers(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoBlockersPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetBlockers(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetBlockers(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetBlockers"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	blockers, err := a.repo.GetBlockers(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todosRes := []TodoTransport{}
+	for _, t := range blockers {
+		todosRes = append(todosRes, toTransportTodo(t))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todosRes))
+}
+
+func (a *Api) TodoBlockerByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoBlockerIDPath})
+
+	switch req.Method {
+	case http.MethodPut:
+		a.AddBlocker(res, req)
+	case http.MethodDelete:
+		a.RemoveBlocker(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) AddBlocker(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "AddBlocker"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	blockerID, err := strconv.ParseUint(vars["blocker_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "blocker_id", err)
+		return
+	}
+
+	err = a.repo.AddDependency(req.Context(), uint32(id), uint32(blockerID))
+	if err != nil {
+		if errors.Is(err, repository.ErrDependencyCycle) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) RemoveBlocker(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "RemoveBlocker"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	blockerID, err := strconv.ParseUint(vars["blocker_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "blocker_id", err)
+		return
+	}
+
+	err = a.repo.RemoveDependency(req.Context(), uint32(id), uint32(blockerID))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrNoDependency) {
+
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+// todo.txt
+
+func (a *Api) TodoListTodoTxt(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoListTodoTxtPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.ExportTodoTxt(res, req)
+	case http.MethodPost:
+		a.ImportTodoTxt(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) ExportTodoTxt(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "ExportTodoTxt"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	todos, err := a.repo.GetTodosByListID(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "todo.txt"}))
+	res.WriteHeader(http.StatusOK)
+	if err := formatTodoTxt(res, todos); err != nil {
+		logger.WithFields(log.Fields{"error": err}).Warning("writing response body")
+	}
+}
+
+func (a *Api) ImportTodoTxt(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "ImportTodoTxt"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	todos, err := parseTodoTxt(req.Body)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTodoTxt) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	imported, err := importTodoTxt(req.Context(), a.repo, uint32(id), todos)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownLabel) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todosRes := []TodoTransport{}
+	for _, t := range imported {
+		todosRes = append(todosRes, toTransportTodo(t))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todosRes))
+}
+
+// Calendar
+
+func (a *Api) TodoListCalendar(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoListCalendarPath})
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		a.ExportCalendar(res, req)
+	case http.MethodPost:
+		a.ImportCalendar(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) ExportCalendar(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "ExportCalendar"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	calendar := bytes.Buffer{}
+	if err := exportCalendar(req.Context(), a.repo, uint32(id), &calendar); err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	// The same todos always give the same calendar, so its hash tells
+	// clients polling the feed whether anything changed. There is no
+	// modification time, as deleting a todo leaves none behind.
+	hash := sha256.Sum256(calendar.Bytes())
+	res.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "calendar.ics"}))
+	res.Header().Set("ETag", `"`+hex.EncodeToString(hash[:])+`"`)
+	// Handles conditional requests on the ETag
+	http.ServeContent(res, req, "calendar.ics", time.Time{}, bytes.NewReader(calendar.Bytes()))
+}
+
+func (a *Api) ImportCalendar(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "ImportCalendar"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	todos, err := parseCalendar(req.Body)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCalendar) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	imported, err := importCalendar(req.Context(), a.repo, uint32(id), todos)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownLabel) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todosRes := []TodoTransport{}
+	for _, t := range imported {
+		todosRes = append(todosRes, toTransportTodo(t))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todosRes))
+}
+
+func (a *Api) TodoListCalendarToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoListCalendarTokenPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateCalendarToken(res, req)
+	case http.MethodDelete:
+		a.DeleteCalendarToken(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+// CreateCalendarToken gives the calendar feed of a todo list a new secret,
+// replacing the one it had.
+func (a *Api) CreateCalendarToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateCalendarToken"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	secret, err := repository.NewTokenSecret()
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if _, err := a.repo.SetFeedToken(req.Context(), uint32(id), repository.HashToken(secret)); err != nil {
+		handleFeedTokenError(logger, res, err)
+		return
+	}
+
+	tokenRes := CalendarTokenTransport{Token: secret, URL: calendarFeedURL(uint32(id), secret)}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, tokenRes))
+}
+
+// DeleteCalendarToken turns the calendar feed of a todo list off.
+func (a *Api) DeleteCalendarToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteCalendarToken"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	if _, err := a.repo.SetFeedToken(req.Context(), uint32(id), ""); err != nil {
+		handleFeedTokenError(logger, res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+func handleFeedTokenError(logger *log.Entry, res http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrTodoListNotFound) {
+		res.WriteHeader(http.StatusNotFound)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("not found error")
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		res.WriteHeader(http.StatusForbidden)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("forbidden error")
+		return
+	}
+	res.WriteHeader(http.StatusInternalServerError)
+	logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+	logger.WithError(err).Error("internal server error")
+}
+
+// calendarFeedURL returns the URL of the calendar feed of a todo list read
+// with secret, relative to the service.
+func calendarFeedURL(id uint32, secret string) string {
+	feedURL := url.URL{
+		Path:     fmt.Sprintf("%s/%d/calendar.ics", TodoListPath, id),
+		RawQuery: url.Values{FeedTokenParam: []string{secret}}.Encode(),
+	}
+	return feedURL.String()
+}
+
+// Users
+
+func (a *Api) User(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": UserPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateUser(res, req)
+	case http.MethodGet:
+		a.GetAllUsers(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) CreateUser(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateUser"})
+
+	dec := json.NewDecoder(req.Body)
+	userReq := UserTransport{}
+
+	err := dec.Decode(&userReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	newUser, err := a.repo.InsertUser(req.Context(), repository.User{Name: userReq.Name, DisplayName: userReq.DisplayName})
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidUser) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrUserExists) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportUser(*newUser)))
+}
+
+func (a *Api) GetAllUsers(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetAllUsers"})
+
+	users, err := a.repo.GetAllUsers(req.Context())
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	usersRes := []UserTransport{}
+	for _, u := range users {
+		usersRes = append(usersRes, toTransportUser(u))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, usersRes))
+}
+
+func (a *Api) UserByName(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": UserNamePath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetUser(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetUser(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetUser"})
+
+	name := mux.Vars(req)["name"]
+
+	user, err := a.repo.GetUser(req.Context(), name)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportUser(*user)))
+}
+
+// Tokens
+
+func (a *Api) Token(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TokenPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateToken(res, req)
+	case http.MethodGet:
+		a.GetTokens(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) CreateToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateToken"})
+
+	dec := json.NewDecoder(req.Body)
+	tokenReq := TokenTransport{}
+
+	err := dec.Decode(&tokenReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	secret, err := repository.NewTokenSecret()
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	token := fromTransportToken(tokenReq)
+	if token.User == "" {
+		token.User = repository.ActorFromContext(req.Context())
+	}
+	token.Hash = repository.HashToken(secret)
+
+	newToken, err := a.repo.InsertToken(req.Context(), token)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) ||
+			errors.Is(err, repository.ErrInvalidToken) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	tokenRes := toTransportToken(*newToken)
+	tokenRes.Secret = secret
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, tokenRes))
+}
+
+func (a *Api) GetTokens(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTokens"})
+
+	user := req.URL.Query().Get("user")
+	if user == "" {
+		user = repository.ActorFromContext(req.Context())
+	}
+
+	tokens, err := a.repo.GetTokens(req.Context(), user)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	tokensRes := []TokenTransport{}
+	for _, token := range tokens {
+		tokensRes = append(tokensRes, toTransportToken(token))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, tokensRes))
+}
+
+func (a *Api) TokenByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TokenIDPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetToken(res, req)
+	case http.MethodDelete:
+		a.DeleteToken(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetToken"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	token, err := a.repo.GetToken(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportToken(*token)))
+}
+
+func (a *Api) DeleteToken(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteToken"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	err = a.repo.DeleteToken(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// Labels
+
+func (a *Api) Label(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": LabelPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateLabel(res, req)
+	case http.MethodGet:
+		a.GetAllLabels(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) CreateLabel(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateLabel"})
+
+	dec := json.NewDecoder(req.Body)
+	labelReq := LabelTransport{}
+
+	err := dec.Decode(&labelReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	newLabel, err := a.repo.InsertLabel(req.Context(), fromTransportToLabel(labelReq))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrLabelExists) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	labelRes := toTransportLabel(*newLabel)
+	res.Header().Set("ETag", formatETag(newLabel.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, labelRes))
+}
+
+func (a *Api) GetAllLabels(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetAllLabels"})
+
+	labels, err := a.repo.GetAllLabels(req.Context())
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	labelsRes := []LabelTransport{}
+	for _, l := range labels {
+		labelsRes = append(labelsRes, toTransportLabel(l))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, labelsRes))
+}
+
+func (a *Api) LabelByName(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": LabelNamePath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetLabel(res, req)
+	case http.MethodPut:
+		a.UpdateLabel(res, req)
+	case http.MethodDelete:
+		a.DeleteLabel(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetLabel(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetLabel"})
+
+	name := mux.Vars(req)["name"]
+
+	label, err := a.repo.GetLabel(req.Context(), name)
+	if err != nil {
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	labelRes := toTransportLabel(*label)
+	res.Header().Set("ETag", formatETag(label.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, labelRes))
+}
+
+func (a *Api) UpdateLabel(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "UpdateLabel"})
+
+	dec := json.NewDecoder(req.Body)
+	labelReq := LabelTransport{}
+
+	err := dec.Decode(&labelReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+	labelReq.Name = mux.Vars(req)["name"]
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+	if conditional {
+		labelReq.Version = ifMatch
+	}
+
+	err = a.repo.UpdateLabel(req.Context(), fromTransportToLabel(labelReq))
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if labelReq.Version != 0 {
+		res.Header().Set("ETag", formatETag(labelReq.Version+1))
+	} else if stored, err := a.repo.GetLabel(req.Context(), labelReq.Name); err == nil {
+		// Unconditional updates don't know the version they made, so it is
+		// read back
+		res.Header().Set("ETag", formatETag(stored.Version))
+	} else {
+		logger.WithError(err).Warning("reading back updated label")
+	}
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) DeleteLabel(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteLabel"})
+
+	name := mux.Vars(req)["name"]
+
+	err := a.repo.DeleteLabel(req.Context(), name)
+	if err != nil {
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) LabelRename(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": LabelRenamePath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.RenameLabel(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) RenameLabel(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "RenameLabel"})
+
+	dec := json.NewDecoder(req.Body)
+	renameReq := RenameLabelTransport{}
+
+	err := dec.Decode(&renameReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	name := mux.Vars(req)["name"]
+
+	label, err := a.repo.RenameLabel(req.Context(), name, renameReq.Name)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, repository.ErrLabelExists) {
+			res.WriteHeader(http.StatusConflict)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	labelRes := toTransportLabel(*label)
+	res.Header().Set("ETag", formatETag(label.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, labelRes))
+}
+
+// Comments
+
+func (a *Api) TodoComments(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoCommentsPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateComment(res, req)
+	case http.MethodGet:
+		a.GetComments(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) CreateComment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateComment"})
+
+	dec := json.NewDecoder(req.Body)
+	commentReq := CommentTransport{}
+
+	err := dec.Decode(&commentReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	commentReq.TodoID = uint32(id)
+
+	newComment, err := a.repo.InsertComment(req.Context(), fromTransportToComment(commentReq))
+	if err != nil {
+		if errors.Is(err, repository.ErrEmptyComment) ||
+			errors.Is(err, repository.ErrInvalidReply) {
+
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	commentRes := toTransportComment(*newComment)
+	res.Header().Set("ETag", formatETag(newComment.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, commentRes))
+}
+
+func (a *Api) GetComments(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetComments"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	tree, err := parseView(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	comments, err := a.repo.GetComments(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if tree {
+		res.WriteHeader(http.StatusOK)
+		logResponseBodyWrite(logger, res, toJSON(logger, toTransportCommentTree(repository.NewCommentTree(comments))))
+		return
+	}
+
+	commentsRes := []CommentTransport{}
+	for _, c := range comments {
+		commentsRes = append(commentsRes, toTransportComment(c))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, commentsRes))
+}
+
+func (a *Api) TodoCommentByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoCommentIDPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetComment(res, req)
+	case http.MethodPut:
+		a.UpdateComment(res, req)
+	case http.MethodDelete:
+		a.DeleteComment(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetComment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetComment"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "comment_id", err)
+		return
+	}
+
+	comment, err := a.repo.GetComment(req.Context(), uint32(commentID))
+	if err == nil && comment.TodoID != uint32(id) {
+		err = repository.ErrCommentNotFound
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	commentRes := toTransportComment(*comment)
+	res.Header().Set("ETag", formatETag(comment.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, commentRes))
+}
+
+func (a *Api) UpdateComment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "UpdateComment"})
+
+	dec := json.NewDecoder(req.Body)
+	commentReq := CommentTransport{}
+
+	err := dec.Decode(&commentReq)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "comment_id", err)
+		return
+	}
+	commentReq.ID = uint32(commentID)
+	commentReq.TodoID = uint32(id)
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+	if conditional {
+		commentReq.Version = ifMatch
+	}
+
+	err = a.checkCommentOnTodo(req.Context(), commentReq.ID, commentReq.TodoID)
+	if err == nil {
+		err = a.repo.UpdateComment(req.Context(), fromTransportToComment(commentReq))
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrEmptyComment) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	if commentReq.Version != 0 {
+		res.Header().Set("ETag", formatETag(commentReq.Version+1))
+	} else if stored, err := a.repo.GetComment(req.Context(), commentReq.ID); err == nil {
+		// Unconditional updates don't know the version they made, so it is
+		// read back
+		res.Header().Set("ETag", formatETag(stored.Version))
+	} else {
+		logger.WithError(err).Warning("reading back updated comment")
+	}
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) DeleteComment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteComment"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	commentID, err := strconv.ParseUint(vars["comment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "comment_id", err)
+		return
+	}
+
+	ifMatch, conditional, err := parseIfMatch(req)
+	if err != nil {
+		res.WriteHeader(http.StatusPreconditionFailed)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("precondition failed")
+		return
+	}
+
+	commentForDelete := repository.Comment{
+		ID:      uint32(commentID),
+		TodoID:  uint32(id),
+		Version: ifMatch,
+	}
+
+	err = a.checkCommentOnTodo(req.Context(), commentForDelete.ID, commentForDelete.TodoID)
+	if err == nil {
+		err = a.repo.DeleteComment(req.Context(), commentForDelete)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			res.WriteHeader(conflictStatus(conditional))
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("conflict error")
+			return
+		}
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+// checkCommentOnTodo returns ErrCommentNotFound unless the comment is on the
+// todo of the path, so comments are only reachable under their own todo.
+func (a *Api) checkCommentOnTodo(ctx context.Context, id, todoID uint32) error {
+	comment, err := a.repo.GetComment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if comment.TodoID != todoID {
+		return repository.ErrCommentNotFound
+	}
+	return nil
+}
+
+// Attachments
+
+func (a *Api) TodoAttachments(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoAttachmentsPath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.CreateAttachment(res, req)
+	case http.MethodGet:
+		a.GetAttachments(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) CreateAttachment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "CreateAttachment"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	// Refused before the content is read and stored
+	if err := checkAttachable(req.Context(), a.repo, uint32(id)); err != nil {
+		handleInsertAttachmentError(logger, res, err)
+		return
+	}
+
+	part, err := attachmentPart(req)
+	if err != nil {
+		msg := fmt.Sprintf("cant parse request body as multipart form:%v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		return
+	}
+	defer part.Close()
+
+	blob, err := a.blobs.Put(part)
+	if err != nil {
+		if errors.Is(err, repository.ErrBlobTooLarge) {
+			msg := fmt.Sprintf("%v, the limit is %d bytes", err, a.blobs.MaxSize())
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+			logger.WithError(err).Warning("request entity too large")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	newAttachment, err := a.repo.InsertAttachment(req.Context(), repository.Attachment{
+		TodoID:      uint32(id),
+		Name:        attachmentName(part.FileName()),
+		ContentType: blob.ContentType,
+		Size:        blob.Size,
+		Hash:        blob.Hash,
+	})
+	if err != nil {
+		if discardErr := a.blobs.Discard(blob); discardErr != nil {
+			logger.WithError(discardErr).Warning("discarding attachment content")
+		}
+		handleInsertAttachmentError(logger, res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportAttachment(*newAttachment)))
+}
+
+func handleInsertAttachmentError(logger *log.Entry, res http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrInvalidAttachment) {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+	if errors.Is(err, repository.ErrTodoNotFound) {
+		res.WriteHeader(http.StatusNotFound)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("not found error")
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		res.WriteHeader(http.StatusForbidden)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("forbidden error")
+		return
+	}
+	res.WriteHeader(http.StatusInternalServerError)
+	logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+	logger.WithError(err).Error("internal server error")
+}
+
+func (a *Api) GetAttachments(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetAttachments"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	attachments, err := a.repo.GetAttachments(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	attachmentsRes := []AttachmentTransport{}
+	for _, at := range attachments {
+		attachmentsRes = append(attachmentsRes, toTransportAttachment(at))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, attachmentsRes))
+}
+
+func (a *Api) TodoAttachmentByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoAttachmentIDPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetAttachment(res, req)
+	case http.MethodDelete:
+		a.DeleteAttachment(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetAttachment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetAttachment"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(vars["attachment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "attachment_id", err)
+		return
+	}
+
+	attachment, err := a.getAttachmentOnTodo(req.Context(), uint32(attachmentID), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportAttachment(*attachment)))
+}
+
+func (a *Api) DeleteAttachment(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "DeleteAttachment"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(vars["attachment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "attachment_id", err)
+		return
+	}
+
+	_, err = a.getAttachmentOnTodo(req.Context(), uint32(attachmentID), uint32(id))
+	if err == nil {
+		err = a.repo.DeleteAttachment(req.Context(), uint32(attachmentID))
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) TodoAttachmentContent(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TodoAttachmentContentPath})
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		a.GetAttachmentContent(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetAttachmentContent(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetAttachmentContent"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(vars["attachment_id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "attachment_id", err)
+		return
+	}
+
+	var content *os.File
+	attachment, err := a.getAttachmentOnTodo(req.Context(), uint32(attachmentID), uint32(id))
+	if err == nil {
+		content, err = a.blobs.Open(attachment.Hash)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		// A missing content is also an internal error, as the attachment
+		// still has it
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+	defer content.Close()
+
+	res.Header().Set("Content-Type", attachment.ContentType)
+	res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	// The content type was sniffed once already, browsers must not redo it
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.Header().Set("ETag", `"`+attachment.Hash+`"`)
+	// Handles ranges and conditional requests on the ETag
+	http.ServeContent(res, req, attachment.Name, attachment.CreatedAt, content)
+}
+
+// getAttachmentOnTodo returns ErrAttachmentNotFound unless the attachment is
+// on the todo of the path, so attachments are only reachable under their own
+// todo.
+func (a *Api) getAttachmentOnTodo(ctx context.Context, id, todoID uint32) (*repository.Attachment, error) {
+	attachment, err := a.repo.GetAttachment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.TodoID != todoID {
+		return nil, repository.ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+// attachmentPart returns the file of a multipart upload, streaming it
+// instead of keeping the whole form in memory or on temporary files.
+func attachmentPart(req *http.Request) (*multipart.Part, error) {
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == AttachmentFormField {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// attachmentName drops any directory from an uploaded file name, as some
+// browsers send the whole path.
+func attachmentName(fileName string) string {
+	if i := strings.LastIndexAny(fileName, `/\`); i >= 0 {
+		return fileName[i+1:]
+	}
+	return fileName
+}
+
+// Search
+
+func (a *Api) Search(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": SearchPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetSearchHits(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetSearchHits(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetSearchHits"})
+
+	query, err := parseSearchQuery(req)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("bad request error")
+		return
+	}
+
+	hits, err := a.repo.Search(req.Context(), query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSearch) {
+			res.WriteHeader(http.StatusBadRequest)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("bad request error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	hitsRes := []SearchHitTransport{}
+	for _, hit := range hits {
+		hitsRes = append(hitsRes, toTransportSearchHit(hit))
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, hitsRes))
+}
+
+// Trash
+
+func (a *Api) Trash(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TrashPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.GetTrash(res, req)
+	case http.MethodDelete:
+		a.PurgeTrash(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) GetTrash(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "GetTrash"})
+
+	trash, err := a.repo.GetTrash(req.Context())
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, toTransportTrash(*trash)))
+}
+
+func (a *Api) PurgeTrash(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTrash"})
+
+	// Without a cutoff the whole trash is purged
+	deletedBefore := time.Now()
+	if v := req.URL.Query().Get("deleted_before"); v != "" {
+		var err error
+		deletedBefore, err = time.Parse(dateLayout, v)
+		if err != nil {
+			handleFieldParsingError(logger, res, "deleted_before", err)
+			return
+		}
+	}
+
+	purged, err := a.repo.PurgeTrash(req.Context(), deletedBefore)
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, PurgeTrashTransport{Purged: purged}))
+}
+
+func (a *Api) TrashTodoListByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TrashTodoListIDPath})
+
+	switch req.Method {
+	case http.MethodDelete:
+		a.PurgeTodoList(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) PurgeTodoList(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTodoList"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	err = a.repo.PurgeTodoList(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, []byte{})
+}
+
+func (a *Api) TrashTodoListRestore(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TrashTodoListRestorePath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.RestoreTodoList(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) RestoreTodoList(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "RestoreTodoList"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handleFieldParsingError(logger, res, "id", err)
+		return
+	}
+
+	todoList, err := a.repo.RestoreTodoList(req.Context(), uint32(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
+		return
+	}
+
+	todoListRes := toTransportTodoList(*todoList)
+	res.Header().Set("ETag", formatETag(todoList.Version))
+	res.WriteHeader(http.StatusOK)
+	logResponseBodyWrite(logger, res, toJSON(logger, todoListRes))
+}
+
+func (a *Api) TrashTodoByID(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TrashTodoIDPath})
+
+	switch req.Method {
+	case http.MethodDelete:
+		a.PurgeTodo(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) PurgeTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTodo"})
+
+	vars := mux.Vars(req)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
 		handleFieldParsingError(logger, res, "id", err)
 		return
 	}
 
-	todo, err := a.repo.GetTodoByID(uint32(id))
+	err = a.repo.PurgeTodo(req.Context(), uint32(id))
 	if err != nil {
-		if errors.Is(err, repository.ErrTodoNotFound) {
+		if errors.Is(err, repository.ErrNotInTrash) {
 			res.WriteHeader(http.StatusNotFound)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
 			logger.WithError(err).Warning("not found error")
 			return
 		}
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
 		res.WriteHeader(http.StatusInternalServerError)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
 		logger.WithError(err).Error("internal server error")
 		return
 	}
 
-	todoRes := toTransportTodo(*todo)
 	res.WriteHeader(http.StatusOK)
-	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
+	logResponseBodyWrite(logger, res, []byte{})
 }
 
-func (a *Api) UpdateTodo(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"action": "UpdateTodo"})
-
-	dec := json.NewDecoder(req.Body)
-	todoReq := TodoTransport{}
+func (a *Api) TrashTodoRestore(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": TrashTodoRestorePath})
 
-	err := dec.Decode(&todoReq)
-	if err != nil {
-		msg := fmt.Sprintf("cant parse request body as JSON:%v", err)
-		res.WriteHeader(http.StatusBadRequest)
+	switch req.Method {
+	case http.MethodPost:
+		a.RestoreTodo(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
 		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
-		logger.WithFields(log.Fields{"error": msg}).Warning("invalid request body")
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
 		return
 	}
 
+}
+
+func (a *Api) RestoreTodo(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "RestoreTodo"})
+
 	vars := mux.Vars(req)
 	id, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		handleFieldParsingError(logger, res, "id", err)
 		return
 	}
-	todoReq.ID = uint32(id)
 
-	todoForUpdate, err := fromTransportToTodo(todoReq)
+	todo, err := a.repo.RestoreTodo(req.Context(), uint32(id))
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-		logger.WithError(err).Warning("bad request error")
-		return
-	}
+		if errors.Is(err, repository.ErrNotInTrash) {
+			res.WriteHeader(http.StatusNotFound)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("not found error")
+			return
+		}
+		// The todo list or the parent of the todo is on the trash, so
+		// restore it first
+		if errors.Is(err, repository.ErrTodoListNotFound) ||
+			errors.Is(err, repository.ErrInvalidParent) {
 
-	err = a.repo.UpdateTodo(todoForUpdate)
-	if err != nil {
-		if errors.Is(err, repository.ErrEmptyDescription) {
-			res.WriteHeader(http.StatusBadRequest)
+			res.WriteHeader(http.StatusConflict)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-			logger.WithError(err).Warning("bad request error")
+			logger.WithError(err).Warning("conflict error")
 			return
 		}
-		if errors.Is(err, repository.ErrTodoNotFound) {
-			res.WriteHeader(http.StatusNotFound)
+		if errors.Is(err, ErrForbidden) {
+			res.WriteHeader(http.StatusForbidden)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-			logger.WithError(err).Warning("not found error")
+			logger.WithError(err).Warning("forbidden error")
 			return
 		}
 		res.WriteHeader(http.StatusInternalServerError)
@@ -470,43 +3564,112 @@ func (a *Api) UpdateTodo(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	todoRes := toTransportTodo(*todo)
+	res.Header().Set("ETag", formatETag(todo.Version))
 	res.WriteHeader(http.StatusOK)
-	logResponseBodyWrite(logger, res, []byte{})
+	logResponseBodyWrite(logger, res, toJSON(logger, todoRes))
 }
 
-func (a *Api) DeleteTodo(res http.ResponseWriter, req *http.Request) {
-	logger := log.WithFields(log.Fields{"action": "DeleteTodo"})
+// Backups
 
-	vars := mux.Vars(req)
-	id, err := strconv.ParseUint(vars["id"], 10, 32)
-	if err != nil {
-		handleFieldParsingError(logger, res, "id", err)
+func (a *Api) AdminBackup(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": AdminBackupPath})
+
+	switch req.Method {
+	case http.MethodGet:
+		a.Backup(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
 		return
 	}
 
-	listID, err := strconv.ParseUint(vars["list_id"], 10, 32)
+}
+
+func (a *Api) Backup(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "Backup"})
+
+	if err := allowBackups(req.Context(), a.Auth); err != nil {
+		res.WriteHeader(http.StatusForbidden)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("forbidden error")
+		return
+	}
+
+	backup, err := a.repo.Backup(req.Context())
 	if err != nil {
-		handleFieldParsingError(logger, res, "list_id", err)
+		if errors.Is(err, ErrInsufficientScope) {
+			res.WriteHeader(http.StatusForbidden)
+			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+			logger.WithError(err).Warning("forbidden error")
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, "internal server error"))
+		logger.WithError(err).Error("internal server error")
 		return
 	}
 
-	todoForDelete := repository.Todo{
-		ID:     uint32(id),
-		ListID: uint32(listID),
+	filename := "todoer-" + backup.CreatedAt.UTC().Format("20060102T150405Z") + ".json"
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	res.WriteHeader(http.StatusOK)
+	// The status is sent already, so a failure can only cut the body short
+	if err := repository.WriteBackup(res, backup); err != nil {
+		logger.WithFields(log.Fields{"error": err}).Warning("writing response body")
+	}
+}
+
+func (a *Api) AdminRestore(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"path": AdminRestorePath})
+
+	switch req.Method {
+	case http.MethodPost:
+		a.Restore(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		msg := fmt.Sprintf("method %q is not allowed", req.Method)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, msg))
+		logger.WithFields(log.Fields{"error": msg}).Warning("method not allowed")
+		return
+	}
+
+}
+
+func (a *Api) Restore(res http.ResponseWriter, req *http.Request) {
+	logger := log.WithFields(log.Fields{"action": "Restore"})
+
+	// Refused before the backup is read
+	if err := allowBackups(req.Context(), a.Auth); err != nil {
+		res.WriteHeader(http.StatusForbidden)
+		logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
+		logger.WithError(err).Warning("forbidden error")
+		return
 	}
 
-	err = a.repo.DeleteTodo(todoForDelete)
+	mode, err := parseRestoreMode(req.URL.Query().Get("mode"))
 	if err != nil {
-		if errors.Is(err, repository.ErrTodoListNotFound) {
-			res.WriteHeader(http.StatusNotFound)
+		handleFieldParsingError(logger, res, "mode", err)
+		return
+	}
+
+	backup, err := repository.ReadBackup(req.Body)
+	if err == nil {
+		err = a.repo.Restore(req.Context(), *backup, mode)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidBackup) {
+			res.WriteHeader(http.StatusBadRequest)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-			logger.WithError(err).Warning("not found error")
+			logger.WithError(err).Warning("bad request error")
 			return
 		}
-		if errors.Is(err, repository.ErrTodoNotFound) {
-			res.WriteHeader(http.StatusNotFound)
+		if errors.Is(err, ErrInsufficientScope) {
+			res.WriteHeader(http.StatusForbidden)
 			logResponseBodyWrite(logger, res, newErrorResponse(logger, err.Error()))
-			logger.WithError(err).Warning("not found error")
+			logger.WithError(err).Warning("forbidden error")
 			return
 		}
 		res.WriteHeader(http.StatusInternalServerError)
@@ -516,7 +3679,18 @@ func (a *Api) DeleteTodo(res http.ResponseWriter, req *http.Request) {
 	}
 
 	res.WriteHeader(http.StatusOK)
-	logResponseBodyWrite(logger, res, []byte{})
+}
+
+// parseRestoreMode parses how a backup is restored, "merge", the default,
+// or "replace".
+func parseRestoreMode(v string) (repository.RestoreMode, error) {
+	switch v {
+	case "", "merge":
+		return repository.RestoreMerge, nil
+	case "replace":
+		return repository.RestoreReplace, nil
+	}
+	return 0, fmt.Errorf("unknown restore mode %q, want merge or replace", v)
 }
 
 func logResponseBodyWrite(logger *log.Entry, w io.Writer, data []byte) {
@@ -547,17 +3721,256 @@ func handleFieldParsingError(logger *log.Entry, res http.ResponseWriter, fieldNa
 	logger.WithError(err).WithFields(log.Fields{"field": fieldName}).Warning("invalid field on request")
 }
 
+// formatETag returns the entity tag of a stored version.
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseIfMatch returns the version required by the If-Match header.
+// conditional is false when there is no header or it is "*", as any
+// version matches then. An entity tag that is not one of ours can never
+// match, so it is an error.
+func parseIfMatch(req *http.Request) (version uint64, conditional bool, err error) {
+	ifMatch := strings.TrimSpace(req.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, false, nil
+	}
+
+	if len(ifMatch) < 2 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, true, ErrInvalidIfMatch
+	}
+	version, err = strconv.ParseUint(ifMatch[1:len(ifMatch)-1], 10, 64)
+	if err != nil || version == 0 {
+		return 0, true, ErrInvalidIfMatch
+	}
+	return version, true, nil
+}
+
+// conflictStatus is the status for a stale version. A failed If-Match is a
+// failed precondition, while a stale version on the body is a conflict.
+func conflictStatus(conditional bool) int {
+	if conditional {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+// parseDeleteTodoListOptions reads the "policy" and "target_list_id" query
+// parameters. When no policy is given the todos are deleted with the list.
+func parseDeleteTodoListOptions(req *http.Request) (repository.DeleteTodoListOptions, error) {
+	opts := repository.DeleteTodoListOptions{}
+	query := req.URL.Query()
+
+	switch query.Get("policy") {
+	case "", "cascade":
+		opts.Policy = repository.DeleteCascade
+	case "restrict":
+		opts.Policy = repository.DeleteRestrict
+	case "move":
+		opts.Policy = repository.DeleteMove
+		targetListID, err := strconv.ParseUint(query.Get("target_list_id"), 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("%w: can't parse \"target_list_id\" from request:%v", repository.ErrInvalidTarget, err)
+		}
+		opts.TargetListID = uint32(targetListID)
+	default:
+		return opts, fmt.Errorf("%w: %q", repository.ErrInvalidPolicy, query.Get("policy"))
+	}
+
+	return opts, nil
+}
+
+// parseTodoQuery reads the filtering, sorting and pagination query
+// parameters of a todo listing. Every parameter is optional.
+func parseTodoQuery(req *http.Request) (repository.TodoQuery, error) {
+	query := repository.TodoQuery{}
+	params := req.URL.Query()
+
+	if v := params.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"done\" from request:%v", repository.ErrInvalidQuery, err)
+		}
+		query.Done = &done
+	}
+
+	query.Labels = params["label"]
+
+	if v := params.Get("due_after"); v != "" {
+		dueAfter, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"due_after\" from request:%v", repository.ErrInvalidQuery, err)
+		}
+		query.DueAfter = dueAfter
+	}
+
+	if v := params.Get("due_before"); v != "" {
+		dueBefore, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"due_before\" from request:%v", repository.ErrInvalidQuery, err)
+		}
+		query.DueBefore = dueBefore
+	}
+
+	query.Text = params.Get("q")
+
+	if v := params.Get("unblocked"); v != "" {
+		unblocked, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"unblocked\" from request:%v", repository.ErrInvalidQuery, err)
+		}
+		query.Unblocked = unblocked
+	}
+
+	switch params.Get("sort") {
+	case "", "position":
+		query.SortBy = repository.SortByPosition
+	case "id":
+		query.SortBy = repository.SortByID
+	case "due_date":
+		query.SortBy = repository.SortByDueDate
+	case "description":
+		query.SortBy = repository.SortByDescription
+	case "created_at":
+		query.SortBy = repository.SortByCreatedAt
+	case "updated_at":
+		query.SortBy = repository.SortByUpdatedAt
+	default:
+		return query, fmt.Errorf("%w: unknown sort %q", repository.ErrInvalidQuery, params.Get("sort"))
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("%w: unknown order %q", repository.ErrInvalidQuery, params.Get("order"))
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 31)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"limit\" from request:%v", repository.ErrInvalidQuery, err)
+		}
+		query.Limit = int(limit)
+	}
+
+	query.Cursor = params.Get("cursor")
+
+	return query, nil
+}
+
+// parseSearchQuery reads the "q" and "limit" query parameters of a search.
+func parseSearchQuery(req *http.Request) (repository.SearchQuery, error) {
+	query := repository.SearchQuery{}
+	params := req.URL.Query()
+
+	query.Text = params.Get("q")
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 31)
+		if err != nil {
+			return query, fmt.Errorf("%w: can't parse \"limit\" from request:%v", repository.ErrInvalidSearch, err)
+		}
+		query.Limit = int(limit)
+	}
+
+	return query, nil
+}
+
+// parseView reads the "view" query parameter of a listing of todos or
+// comments, returning whether they are nested under their parents.
+func parseView(req *http.Request) (bool, error) {
+	switch view := req.URL.Query().Get("view"); view {
+	case "", "flat":
+		return false, nil
+	case "tree":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: unknown view %q", repository.ErrInvalidQuery, view)
+	}
+}
+
 func fromTransportToTodoList(ttl TodoListTransport) repository.TodoList {
 	return repository.TodoList{
-		ID:    ttl.ID,
-		Title: ttl.Title,
+		ID:      ttl.ID,
+		Title:   ttl.Title,
+		Version: ttl.Version,
 	}
 }
 
 func toTransportTodoList(tl repository.TodoList) TodoListTransport {
-	return TodoListTransport{
-		ID:    tl.ID,
-		Title: tl.Title,
+	todoListTransport := TodoListTransport{
+		ID:        tl.ID,
+		Title:     tl.Title,
+		Version:   tl.Version,
+		CreatedAt: formatTimestamp(tl.CreatedAt),
+		UpdatedAt: formatTimestamp(tl.UpdatedAt),
+		Owner:     tl.Owner,
+	}
+
+	for _, member := range tl.Members {
+		todoListTransport.Members = append(todoListTransport.Members, MemberTransport{
+			User: member.User,
+			Role: string(member.Role),
+		})
+	}
+
+	return todoListTransport
+}
+
+func fromTransportToken(tt TokenTransport) repository.Token {
+	token := repository.Token{
+		User: tt.User,
+		Name: tt.Name,
+	}
+	for _, scope := range tt.Scopes {
+		token.Scopes = append(token.Scopes, repository.Scope(scope))
+	}
+	return token
+}
+
+func toTransportToken(token repository.Token) TokenTransport {
+	tokenTransport := TokenTransport{
+		ID:        token.ID,
+		User:      token.User,
+		Name:      token.Name,
+		Scopes:    []string{},
+		CreatedAt: formatTimestamp(token.CreatedAt),
+	}
+	for _, scope := range token.Scopes {
+		tokenTransport.Scopes = append(tokenTransport.Scopes, string(scope))
+	}
+	return tokenTransport
+}
+
+func toTransportUser(u repository.User) UserTransport {
+	return UserTransport{
+		Name:        u.Name,
+		DisplayName: u.DisplayName,
+		CreatedAt:   formatTimestamp(u.CreatedAt),
+	}
+}
+
+func fromTransportToLabel(lt LabelTransport) repository.Label {
+	return repository.Label{
+		Name:        lt.Name,
+		Color:       lt.Color,
+		Description: lt.Description,
+		Version:     lt.Version,
+	}
+}
+
+func toTransportLabel(l repository.Label) LabelTransport {
+	return LabelTransport{
+		Name:        l.Name,
+		Color:       l.Color,
+		Description: l.Description,
+		Version:     l.Version,
+		CreatedAt:   formatTimestamp(l.CreatedAt),
+		UpdatedAt:   formatTimestamp(l.UpdatedAt),
+		TodoCount:   l.TodoCount,
 	}
 }
 
@@ -566,9 +3979,10 @@ func fromTransportToTodo(tt TodoTransport) (repository.Todo, error) {
 		ID:          tt.ID,
 		ListID:      tt.ListID,
 		Description: tt.Description,
-		Comments:    tt.Comments,
 		Labels:      tt.Labels,
 		Done:        tt.Done,
+		Version:     tt.Version,
+		ParentID:    tt.ParentID,
 	}
 
 	if tt.DueDate != "" {
@@ -579,6 +3993,14 @@ func fromTransportToTodo(tt TodoTransport) (repository.Todo, error) {
 		todo.DueDate = dueDate
 	}
 
+	if tt.Recurrence != "" {
+		recurrence, err := repository.ParseRecurrence(tt.Recurrence)
+		if err != nil {
+			return repository.Todo{}, err
+		}
+		todo.Recurrence = recurrence
+	}
+
 	return todo, nil
 }
 
@@ -587,14 +4009,156 @@ func toTransportTodo(t repository.Todo) TodoTransport {
 		ID:          t.ID,
 		ListID:      t.ListID,
 		Description: t.Description,
-		Comments:    t.Comments,
 		Labels:      t.Labels,
 		Done:        t.Done,
+		Version:     t.Version,
+		CreatedAt:   formatTimestamp(t.CreatedAt),
+		UpdatedAt:   formatTimestamp(t.UpdatedAt),
+		CompletedAt: formatTimestamp(t.CompletedAt),
+		Position:    t.Position,
+		ParentID:    t.ParentID,
 	}
 
 	if !t.DueDate.IsZero() {
 		todoTransport.DueDate = t.DueDate.Format(dateLayout)
 	}
 
+	if t.Recurrence != nil {
+		todoTransport.Recurrence = t.Recurrence.String()
+	}
+
 	return todoTransport
 }
+
+func fromTransportToComment(ct CommentTransport) repository.Comment {
+	return repository.Comment{
+		ID:       ct.ID,
+		TodoID:   ct.TodoID,
+		ParentID: ct.ParentID,
+		Author:   ct.Author,
+		Body:     ct.Body,
+		Version:  ct.Version,
+	}
+}
+
+func toTransportComment(c repository.Comment) CommentTransport {
+	return CommentTransport{
+		ID:        c.ID,
+		TodoID:    c.TodoID,
+		ParentID:  c.ParentID,
+		Author:    c.Author,
+		Body:      c.Body,
+		Version:   c.Version,
+		CreatedAt: formatTimestamp(c.CreatedAt),
+		UpdatedAt: formatTimestamp(c.UpdatedAt),
+	}
+}
+
+func toTransportCommentTree(nodes []repository.CommentNode) []CommentNodeTransport {
+	nodesRes := []CommentNodeTransport{}
+	for _, node := range nodes {
+		nodesRes = append(nodesRes, CommentNodeTransport{
+			CommentTransport: toTransportComment(node.Comment),
+			Replies:          toTransportCommentTree(node.Replies),
+		})
+	}
+	return nodesRes
+}
+
+func toTransportAttachment(at repository.Attachment) AttachmentTransport {
+	return AttachmentTransport{
+		ID:          at.ID,
+		TodoID:      at.TodoID,
+		Name:        at.Name,
+		ContentType: at.ContentType,
+		Size:        at.Size,
+		SHA256:      at.Hash,
+		CreatedAt:   formatTimestamp(at.CreatedAt),
+	}
+}
+
+func toTransportSearchHit(hit repository.SearchHit) SearchHitTransport {
+	hitRes := SearchHitTransport{
+		TodoList: toTransportTodoList(hit.TodoList),
+		Fields:   hit.Fields,
+		Score:    hit.Score,
+	}
+	if hit.Todo != nil {
+		todoRes := toTransportTodo(*hit.Todo)
+		hitRes.Todo = &todoRes
+	}
+	return hitRes
+}
+
+func toTransportTodoTree(nodes []repository.TodoNode) []TodoNodeTransport {
+	nodesRes := []TodoNodeTransport{}
+	for _, node := range nodes {
+		nodesRes = append(nodesRes, TodoNodeTransport{
+			TodoTransport: toTransportTodo(node.Todo),
+			Subtasks:      toTransportTodoTree(node.Subtasks),
+		})
+	}
+	return nodesRes
+}
+
+// formatTimestamp formats a server-managed time, which is empty when unset.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+func toTransportTrash(trash repository.Trash) TrashTransport {
+	trashRes := TrashTransport{
+		TodoLists: []TrashedTodoListTransport{},
+		Todos:     []TrashedTodoTransport{},
+	}
+
+	for _, tl := range trash.TodoLists {
+		todoIDs := tl.TodoIDs
+		if todoIDs == nil {
+			todoIDs = []uint32{}
+		}
+		trashRes.TodoLists = append(trashRes.TodoLists, TrashedTodoListTransport{
+			TodoList:  toTransportTodoList(tl.TodoList),
+			DeletedAt: tl.DeletedAt.Format(dateLayout),
+			TodoIDs:   todoIDs,
+		})
+	}
+
+	for _, t := range trash.Todos {
+		subtaskIDs := t.SubtaskIDs
+		if subtaskIDs == nil {
+			subtaskIDs = []uint32{}
+		}
+		trashRes.Todos = append(trashRes.Todos, TrashedTodoTransport{
+			Todo:       toTransportTodo(t.Todo),
+			DeletedAt:  t.DeletedAt.Format(dateLayout),
+			SubtaskIDs: subtaskIDs,
+		})
+	}
+
+	return trashRes
+}
+
+func toTransportHistory(history []repository.HistoryEntry) []HistoryEntryTransport {
+	historyRes := []HistoryEntryTransport{}
+	for _, entry := range history {
+		changes := []FieldChangeTransport{}
+		for _, change := range entry.Changes {
+			changes = append(changes, FieldChangeTransport{
+				Field: change.Field,
+				Old:   change.Old,
+				New:   change.New,
+			})
+		}
+		historyRes = append(historyRes, HistoryEntryTransport{
+			At:      entry.At.Format(dateLayout),
+			Actor:   entry.Actor,
+			Action:  string(entry.Action),
+			Changes: changes,
+		})
+	}
+	return historyRes
+}
@@ -2,15 +2,26 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/vitorarins/todoer/repository"
 )
 
@@ -76,7 +87,7 @@ func TestTodoListCreation(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoList = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -167,7 +178,7 @@ func TestTodoListGetAll(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoListSlice = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -265,7 +276,7 @@ func TestTodoListGetByID(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoList = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -322,6 +333,7 @@ func TestTodoListUpdate(t *testing.T) {
 		requestBody    []byte
 		method         string
 		idPath         string
+		ifMatch        string
 		injectErr      error
 		wantStatusCode int
 	}
@@ -366,6 +378,31 @@ func TestTodoListUpdate(t *testing.T) {
 			requestBody:    []byte("{notvalidjson]"),
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:           "SuccessWithIfMatch",
+			requestBody:    validTodoListRequestBody(t),
+			ifMatch:        `"2"`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "PreconditionFailedIfMatchStale",
+			requestBody:    validTodoListRequestBody(t),
+			ifMatch:        `"1"`,
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "PreconditionFailedIfMatchNotAVersion",
+			requestBody:    validTodoListRequestBody(t),
+			ifMatch:        `W/"2"`,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "ConflictIfBodyVersionStale",
+			requestBody:    validTodoListRequestBody(t),
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusConflict,
+		},
 		{
 			name:           "InternalServerErrorUpdateTodoListError",
 			requestBody:    validTodoListRequestBody(t),
@@ -378,7 +415,7 @@ func TestTodoListUpdate(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -394,6 +431,9 @@ func TestTodoListUpdate(t *testing.T) {
 			}
 
 			request := newRequest(t, method, testURL, test.requestBody)
+			if test.ifMatch != "" {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
 			client := server.Client()
 
 			res, err := client.Do(request)
@@ -426,6 +466,8 @@ func TestTodoListDelete(t *testing.T) {
 		name           string
 		method         string
 		idPath         string
+		ifMatch        string
+		query          string
 		injectErr      error
 		wantStatusCode int
 	}
@@ -450,6 +492,54 @@ func TestTodoListDelete(t *testing.T) {
 			injectErr:      repository.ErrTodoListNotFound,
 			wantStatusCode: http.StatusNotFound,
 		},
+		{
+			name:           "SuccessDeletingTodoListWithRestrictPolicy",
+			query:          "?policy=restrict",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessDeletingTodoListWithMovePolicy",
+			query:          "?policy=move&target_list_id=2",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "BadRequestUnknownPolicy",
+			query:          "?policy=wrongpolicy",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestMovePolicyWithoutTarget",
+			query:          "?policy=move",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoDeleteReturnsErrInvalidTarget",
+			query:          "?policy=move&target_list_id=1",
+			injectErr:      repository.ErrInvalidTarget,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "ConflictIfRepoDeleteReturnsErrTodoListNotEmpty",
+			query:          "?policy=restrict",
+			injectErr:      repository.ErrTodoListNotEmpty,
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "SuccessWithIfMatch",
+			ifMatch:        `"2"`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "PreconditionFailedIfMatchStale",
+			ifMatch:        `"1"`,
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "PreconditionFailedIfMatchNotAVersion",
+			ifMatch:        `W/"2"`,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
 		{
 			name:           "InternalServerErrorDeleteTodoListError",
 			injectErr:      errors.New("injected generic error"),
@@ -461,7 +551,7 @@ func TestTodoListDelete(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -475,8 +565,12 @@ func TestTodoListDelete(t *testing.T) {
 			if test.idPath != "" {
 				testURL = server.URL + TodoListPath + test.idPath
 			}
+			testURL += test.query
 
 			request := newRequest(t, method, testURL, []byte{})
+			if test.ifMatch != "" {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
 			client := server.Client()
 
 			res, err := client.Do(request)
@@ -532,16 +626,53 @@ func TestTodoCreation(t *testing.T) {
 			},
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "SuccessCreatingRecurringTodo",
+			requestBody: helperToJSON(t, TodoTransport{
+				Description: "Send weekly report",
+				Recurrence:  "RRULE:FREQ=WEEKLY;BYDAY=MO",
+			}),
+			injectResponse: repository.Todo{
+				ID:          1,
+				Description: "Send weekly report",
+				Recurrence:  &repository.Recurrence{Frequency: repository.Weekly, Interval: 1, ByDay: []time.Weekday{time.Monday}},
+			},
+			want: TodoTransport{
+				ID:          1,
+				Description: "Send weekly report",
+				Recurrence:  "FREQ=WEEKLY;BYDAY=MO",
+			},
+			wantStatusCode: http.StatusOK,
+		},
 		{
 			name: "BadRequestWhenDueDateInvalid",
 			requestBody: helperToJSON(t, TodoTransport{
 				Description: "Make the bed",
-				Comments:    "really hard",
 				DueDate:     "11010101",
 				Done:        true,
 			}),
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name: "BadRequestWhenRecurrenceUnsupported",
+			requestBody: helperToJSON(t, TodoTransport{
+				Description: "Make the bed",
+				Recurrence:  "FREQ=YEARLY",
+			}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoReturnsErrInvalidRecurrence",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrInvalidRecurrence,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoReturnsErrUnknownLabel",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrUnknownLabel,
+			wantStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:           "MethodNotAllowedForDelete",
 			method:         "DELETE",
@@ -589,7 +720,7 @@ func TestTodoCreation(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodo = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -645,6 +776,7 @@ func TestTodosGetByListID(t *testing.T) {
 		name           string
 		method         string
 		listIDPath     string
+		query          string
 		injectResponse []repository.Todo
 		injectErr      error
 		wantStatusCode int
@@ -680,6 +812,41 @@ func TestTodosGetByListID(t *testing.T) {
 			method:         "DELETE",
 			wantStatusCode: http.StatusMethodNotAllowed,
 		},
+		{
+			name:           "BadRequestInvalidDone",
+			query:          "?done=maybe",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestInvalidDueDate",
+			query:          "?due_after=yesterday",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestUnknownSort",
+			query:          "?sort=title",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestUnknownOrder",
+			query:          "?order=random",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestInvalidLimit",
+			query:          "?limit=-1",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestInvalidCursor",
+			injectErr:      repository.ErrInvalidCursor,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "NotFoundTodoList",
+			injectErr:      repository.ErrTodoListNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
 		{
 			name:           "InternalServerErrorGetTodosError",
 			injectErr:      errors.New("injected generic error"),
@@ -692,7 +859,7 @@ func TestTodosGetByListID(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoSlice = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -706,6 +873,7 @@ func TestTodosGetByListID(t *testing.T) {
 			if test.listIDPath != "" {
 				testURL = server.URL + TodoListPath + test.listIDPath + "/todo"
 			}
+			testURL += test.query
 
 			request := newRequest(t, method, testURL, []byte{})
 			client := server.Client()
@@ -743,6 +911,137 @@ func TestTodosGetByListID(t *testing.T) {
 	}
 }
 
+func TestTodosQuery(t *testing.T) {
+	type Test struct {
+		name  string
+		query string
+		want  []string
+	}
+
+	tests := []Test{
+		{
+			name:  "NoParameters",
+			query: "",
+			want:  []string{"Make the bed", "Sweep the floor", "Call the bank"},
+		},
+		{
+			name:  "Done",
+			query: "?done=false",
+			want:  []string{"Sweep the floor", "Call the bank"},
+		},
+		{
+			name:  "Labels",
+			query: "?label=home&label=urgent",
+			want:  []string{"Sweep the floor"},
+		},
+		{
+			name:  "DueRange",
+			query: "?due_after=2021-02-01T00:00:00Z&due_before=2021-02-02T00:00:00Z",
+			want:  []string{"Sweep the floor"},
+		},
+		{
+			name:  "Text",
+			query: "?q=BANK",
+			want:  []string{"Call the bank"},
+		},
+		{
+			name:  "SortByDueDate",
+			query: "?sort=due_date",
+			want:  []string{"Sweep the floor", "Make the bed", "Call the bank"},
+		},
+		{
+			name:  "SortByDescriptionDescending",
+			query: "?sort=description&order=desc",
+			want:  []string{"Sweep the floor", "Make the bed", "Call the bank"},
+		},
+		{
+			name:  "SortByCreatedAtDescending",
+			query: "?sort=created_at&order=desc",
+			want:  []string{"Call the bank", "Sweep the floor", "Make the bed"},
+		},
+		{
+			name:  "SortByPositionDescending",
+			query: "?sort=position&order=desc",
+			want:  []string{"Call the bank", "Sweep the floor", "Make the bed"},
+		},
+	}
+
+	repo := repository.NewLocalStorage()
+	routine, err := repo.InsertTodoList(context.Background(), repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos := []repository.Todo{
+		{ListID: routine.ID, Description: "Make the bed", DueDate: parseTime(t, "2021-02-04T00:00:00Z"), Labels: []string{"home"}, Done: true},
+		{ListID: routine.ID, Description: "Sweep the floor", DueDate: parseTime(t, "2021-02-01T00:00:00Z"), Labels: []string{"home", "urgent"}},
+		{ListID: routine.ID, Description: "Call the bank"},
+	}
+	for _, todo := range todos {
+		if _, err := repo.InsertTodo(context.Background(), todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	getPage := func(t *testing.T, query string) ([]string, string) {
+		t.Helper()
+
+		request := newRequest(t, http.MethodGet, server.URL+TodoListPath+"/0/todo"+query, []byte{})
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("got response %d want %d", res.StatusCode, http.StatusOK)
+		}
+
+		got := []TodoTransport{}
+		helperFromJSON(t, res.Body, &got)
+
+		descriptions := []string{}
+		for _, todo := range got {
+			descriptions = append(descriptions, todo.Description)
+		}
+		return descriptions, res.Header.Get(NextCursorHeader)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, cursor := getPage(t, test.query)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("api: GET %s%s mismatch (-want +got):\n%s", TodoPath, test.query, diff)
+			}
+			if cursor != "" {
+				t.Errorf("got %s %q on a request with no limit", NextCursorHeader, cursor)
+			}
+		})
+	}
+
+	t.Run("Pagination", func(t *testing.T) {
+		got, cursor := getPage(t, "?sort=description&limit=2")
+		if diff := cmp.Diff([]string{"Call the bank", "Make the bed"}, got); diff != "" {
+			t.Errorf("first page mismatch (-want +got):\n%s", diff)
+		}
+		if cursor == "" {
+			t.Fatalf("expected %s on the first page", NextCursorHeader)
+		}
+
+		got, cursor = getPage(t, "?sort=description&limit=2&cursor="+url.QueryEscape(cursor))
+		if diff := cmp.Diff([]string{"Sweep the floor"}, got); diff != "" {
+			t.Errorf("last page mismatch (-want +got):\n%s", diff)
+		}
+		if cursor != "" {
+			t.Errorf("got %s %q on the last page", NextCursorHeader, cursor)
+		}
+	})
+}
+
 func TestTodoGetByID(t *testing.T) {
 	type Test struct {
 		name           string
@@ -771,6 +1070,26 @@ func TestTodoGetByID(t *testing.T) {
 			},
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "SuccessRetrievingTodoWithTimestamps",
+			injectResponse: repository.Todo{
+				ID:          1,
+				Description: "Make the bed",
+				Done:        true,
+				CreatedAt:   parseTime(t, "2021-02-01T10:00:00Z"),
+				UpdatedAt:   parseTime(t, "2021-02-03T10:00:00Z"),
+				CompletedAt: parseTime(t, "2021-02-02T10:00:00Z"),
+			},
+			want: TodoTransport{
+				ID:          1,
+				Description: "Make the bed",
+				Done:        true,
+				CreatedAt:   "2021-02-01T10:00:00Z",
+				UpdatedAt:   "2021-02-03T10:00:00Z",
+				CompletedAt: "2021-02-02T10:00:00Z",
+			},
+			wantStatusCode: http.StatusOK,
+		},
 		{
 			name:           "BadRequestWrongIDPath",
 			idPath:         "/wrongpath",
@@ -798,7 +1117,7 @@ func TestTodoGetByID(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodo = test.injectResponse
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -855,6 +1174,7 @@ func TestTodoUpdate(t *testing.T) {
 		method         string
 		listIDPath     string
 		idPath         string
+		ifMatch        string
 		requestBody    []byte
 		injectErr      error
 		wantStatusCode int
@@ -870,18 +1190,43 @@ func TestTodoUpdate(t *testing.T) {
 			name: "BadRequestWhenDueDateInvalid",
 			requestBody: helperToJSON(t, TodoTransport{
 				Description: "Make the bed",
-				Comments:    "really hard",
 				DueDate:     "11010101",
 				Done:        true,
 			}),
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name: "BadRequestWhenRecurrenceUnsupported",
+			requestBody: helperToJSON(t, TodoTransport{
+				Description: "Make the bed",
+				Recurrence:  "FREQ=YEARLY",
+			}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoReturnsErrInvalidRecurrence",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrInvalidRecurrence,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoReturnsErrUnknownLabel",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrUnknownLabel,
+			wantStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:           "BadRequestWrongIDPath",
 			requestBody:    validTodoRequestBody(t),
 			idPath:         "/wrongpath",
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:           "BadRequestWrongListIDPath",
+			requestBody:    validTodoRequestBody(t),
+			listIDPath:     "/wrongpath",
+			wantStatusCode: http.StatusBadRequest,
+		},
 		{
 			name:           "MethodNotAllowedForPost",
 			requestBody:    validTodoRequestBody(t),
@@ -900,6 +1245,12 @@ func TestTodoUpdate(t *testing.T) {
 			injectErr:      repository.ErrTodoNotFound,
 			wantStatusCode: http.StatusNotFound,
 		},
+		{
+			name:           "NotFoundIfRepoUpdateReturnsErrTodoListNotFound",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrTodoListNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
 		{
 			name:           "BadRequestIfRequestBodyIsEmpty",
 			requestBody:    []byte{},
@@ -910,6 +1261,31 @@ func TestTodoUpdate(t *testing.T) {
 			requestBody:    []byte("{notvalidjson]"),
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:           "SuccessWithIfMatch",
+			requestBody:    validTodoRequestBody(t),
+			ifMatch:        `"2"`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "PreconditionFailedIfMatchStale",
+			requestBody:    validTodoRequestBody(t),
+			ifMatch:        `"1"`,
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "PreconditionFailedIfMatchNotAVersion",
+			requestBody:    validTodoRequestBody(t),
+			ifMatch:        `W/"2"`,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "ConflictIfBodyVersionStale",
+			requestBody:    validTodoRequestBody(t),
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusConflict,
+		},
 		{
 			name:           "InternalServerErrorGetTodosError",
 			requestBody:    validTodoRequestBody(t),
@@ -922,7 +1298,7 @@ func TestTodoUpdate(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -943,6 +1319,9 @@ func TestTodoUpdate(t *testing.T) {
 			}
 
 			request := newRequest(t, method, testURL, test.requestBody)
+			if test.ifMatch != "" {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
 			client := server.Client()
 
 			res, err := client.Do(request)
@@ -976,6 +1355,7 @@ func TestTodoDelete(t *testing.T) {
 		method         string
 		listIDPath     string
 		idPath         string
+		ifMatch        string
 		injectErr      error
 		wantStatusCode int
 	}
@@ -1010,6 +1390,22 @@ func TestTodoDelete(t *testing.T) {
 			injectErr:      repository.ErrTodoNotFound,
 			wantStatusCode: http.StatusNotFound,
 		},
+		{
+			name:           "SuccessWithIfMatch",
+			ifMatch:        `"2"`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "PreconditionFailedIfMatchStale",
+			ifMatch:        `"1"`,
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "PreconditionFailedIfMatchNotAVersion",
+			ifMatch:        `W/"2"`,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
 		{
 			name:           "InternalServerErrorGetTodosError",
 			injectErr:      errors.New("injected generic error"),
@@ -1021,7 +1417,7 @@ func TestTodoDelete(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			api := NewApi(repo)
+			api := NewApi(repo, nil)
 			service := api.RegisterRoutes()
 			server := httptest.NewServer(service)
 			defer server.Close()
@@ -1042,6 +1438,9 @@ func TestTodoDelete(t *testing.T) {
 			}
 
 			request := newRequest(t, method, testURL, []byte{})
+			if test.ifMatch != "" {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
 			client := server.Client()
 
 			res, err := client.Do(request)
@@ -1069,53 +1468,3492 @@ func TestTodoDelete(t *testing.T) {
 	}
 }
 
-type FakeStorage struct {
-	FakeTodoList      repository.TodoList
-	FakeTodoListSlice []repository.TodoList
-	FakeTodo          repository.Todo
-	FakeTodoSlice     []repository.Todo
-	FakeError         error
-}
-
-func NewFakeStorage() *FakeStorage {
-	return &FakeStorage{
-		FakeTodoList:      repository.TodoList{},
-		FakeTodoListSlice: []repository.TodoList{},
-		FakeTodo:          repository.Todo{},
-		FakeTodoSlice:     []repository.Todo{},
-		FakeError:         nil,
+func TestTodoMove(t *testing.T) {
+	type Test struct {
+		name           string
+		method         string
+		path           string
+		ifMatch        string
+		requestBody    []byte
+		injectResponse repository.Todo
+		injectErr      error
+		wantStatusCode int
+		want           TodoTransport
 	}
-}
 
-func (fs *FakeStorage) InsertTodoList(todoList repository.TodoList) (*repository.TodoList, error) {
-	return &fs.FakeTodoList, fs.FakeError
-}
-func (fs *FakeStorage) GetAllTodoLists() ([]repository.TodoList, error) {
-	return fs.FakeTodoListSlice, fs.FakeError
-}
-func (fs *FakeStorage) GetTodoListByID(id uint32) (*repository.TodoList, error) {
-	return &fs.FakeTodoList, fs.FakeError
-}
-func (fs *FakeStorage) UpdateTodoList(todoList repository.TodoList) error {
-	return fs.FakeError
-}
-func (fs *FakeStorage) DeleteTodoListByID(id uint32) error {
-	return fs.FakeError
-}
+	tests := []Test{
+		{
+			name:        "SuccessMovingTodo",
+			requestBody: []byte(`{"list_id": 1, "before_id": 3}`),
+			injectResponse: repository.Todo{
+				ID:          2,
+				ListID:      1,
+				Description: "Make the bed",
+				Version:     3,
+				Position:    4,
+			},
+			wantStatusCode: http.StatusOK,
+			want: TodoTransport{
+				ID:          2,
+				ListID:      1,
+				Description: "Make the bed",
+				Version:     3,
+				Position:    4,
+			},
+		},
+		{
+			name:           "SuccessWithIfMatch",
+			requestBody:    []byte(`{}`),
+			ifMatch:        `"2"`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "MethodNotAllowedForPut",
+			method:         http.MethodPut,
+			requestBody:    []byte(`{}`),
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "BadRequestWrongIDPath",
+			path:           TodoListPath + "/0/todo/wrongpath/move",
+			requestBody:    []byte(`{}`),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRequestBodyIsNotValidJSON",
+			requestBody:    []byte("{notvalidjson]"),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoMoveReturnsErrInvalidPosition",
+			requestBody:    []byte(`{"before_id": 7}`),
+			injectErr:      repository.ErrInvalidPosition,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "NotFoundIfRepoMoveReturnsErrTodoNotFound",
+			requestBody:    []byte(`{}`),
+			injectErr:      repository.ErrTodoNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "NotFoundIfRepoMoveReturnsErrTodoListNotFound",
+			requestBody:    []byte(`{"list_id": 9}`),
+			injectErr:      repository.ErrTodoListNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "PreconditionFailedIfMatchStale",
+			requestBody:    []byte(`{}`),
+			ifMatch:        `"1"`,
+			injectErr:      repository.ErrConflict,
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "InternalServerErrorMoveTodoError",
+			requestBody:    []byte(`{}`),
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
 
-func (fs *FakeStorage) InsertTodo(todo repository.Todo) (*repository.Todo, error) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeTodo = test.injectResponse
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			method := http.MethodPost
+			if test.method != "" {
+				method = test.method
+			}
+
+			path := TodoListPath + "/0/todo/2/move"
+			if test.path != "" {
+				path = test.path
+			}
+
+			request := newRequest(t, method, server.URL+path, test.requestBody)
+			if test.ifMatch != "" {
+				request.Header.Set("If-Match", test.ifMatch)
+			}
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+				return
+			}
+
+			got := TodoTransport{}
+			helperFromJSON(t, res.Body, &got)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MoveTodo() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestManualOrder(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, title := range []string{"Routine", "Work"} {
+		res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: title}))
+		res.Body.Close()
+	}
+	for _, description := range []string{"Make the bed", "Sweep the floor", "Call the bank"} {
+		res := do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: description}))
+		res.Body.Close()
+	}
+
+	type Step struct {
+		path           string
+		body           string
+		wantStatusCode int
+		wantRoutine    []string
+		wantWork       []string
+	}
+
+	steps := []Step{
+		{
+			path:           TodoListPath + "/0/todo/2/move",
+			body:           `{"before_id": 0}`,
+			wantStatusCode: http.StatusOK,
+			wantRoutine:    []string{"Call the bank", "Make the bed", "Sweep the floor"},
+			wantWork:       []string{},
+		},
+		{
+			path:           TodoListPath + "/0/todo/2/move",
+			body:           `{}`,
+			wantStatusCode: http.StatusOK,
+			wantRoutine:    []string{"Make the bed", "Sweep the floor", "Call the bank"},
+			wantWork:       []string{},
+		},
+		{
+			path:           TodoListPath + "/0/todo/0/move",
+			body:           `{"list_id": 1}`,
+			wantStatusCode: http.StatusOK,
+			wantRoutine:    []string{"Sweep the floor", "Call the bank"},
+			wantWork:       []string{"Make the bed"},
+		},
+		{
+			path:           TodoListPath + "/0/todo/1/move",
+			body:           `{"list_id": 1, "before_id": 2}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantRoutine:    []string{"Sweep the floor", "Call the bank"},
+			wantWork:       []string{"Make the bed"},
+		},
+		{
+			path:           TodoListPath + "/0/todo/1/move",
+			body:           `{"list_id": 5}`,
+			wantStatusCode: http.StatusNotFound,
+			wantRoutine:    []string{"Sweep the floor", "Call the bank"},
+			wantWork:       []string{"Make the bed"},
+		},
+	}
+
+	listDescriptions := func(t *testing.T, listID string) []string {
+		t.Helper()
+
+		res := do(t, http.MethodGet, TodoListPath+"/"+listID+"/todo", []byte{})
+		defer res.Body.Close()
+
+		todos := []TodoTransport{}
+		helperFromJSON(t, res.Body, &todos)
+
+		got := []string{}
+		for i, todo := range todos {
+			if todo.Position != i {
+				t.Errorf("got position %d for %q at index %d", todo.Position, todo.Description, i)
+			}
+			got = append(got, todo.Description)
+		}
+		return got
+	}
+
+	for i, step := range steps {
+		res := do(t, http.MethodPost, step.path, []byte(step.body))
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: POST %s: got response %d want %d", i, step.path, res.StatusCode, step.wantStatusCode)
+		}
+
+		if diff := cmp.Diff(step.wantRoutine, listDescriptions(t, "0")); diff != "" {
+			t.Errorf("step %d: todos of list 0 mismatch (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(step.wantWork, listDescriptions(t, "1")); diff != "" {
+			t.Errorf("step %d: todos of list 1 mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	// Updating a todo through the path of another todo list moves it there
+	res := do(t, http.MethodPut, TodoListPath+"/1/todo/1", helperToJSON(t, TodoTransport{Description: "Sweep the floor"}))
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+	if diff := cmp.Diff([]string{"Call the bank"}, listDescriptions(t, "0")); diff != "" {
+		t.Errorf("todos of list 0 mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Make the bed", "Sweep the floor"}, listDescriptions(t, "1")); diff != "" {
+		t.Errorf("todos of list 1 mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, title := range []string{"Routine", "Work"} {
+		res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: title}))
+		res.Body.Close()
+	}
+
+	type Step struct {
+		method         string
+		path           string
+		body           string
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			body:           `{"description": "Clean the house"}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			body:           `{"description": "Sweep the floor", "parent_id": 0}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			body:           `{"description": "Mop the floor", "parent_id": 1}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			body:           `{"description": "Call the bank"}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			body:           `{"description": "Dust the shelves", "parent_id": 9}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TodoListPath + "/1/todo",
+			body:           `{"description": "Write report", "parent_id": 0}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0",
+			body:           `{"description": "Clean the house", "parent_id": 2}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			method:         http.MethodDelete,
+			path:           TodoListPath + "/0/todo/1",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/2/restore",
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/1/restore",
+			wantStatusCode: http.StatusOK,
+		},
+	}
+
+	for i, step := range steps {
+		res := do(t, step.method, step.path, []byte(step.body))
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	res := do(t, http.MethodGet, TodoListPath+"/0/todo?view=tree", []byte{})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET tree: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	got := []TodoNodeTransport{}
+	helperFromJSON(t, res.Body, &got)
+
+	// Restored todos go to the end, but stay under their parent
+	house := uint32(0)
+	floor := uint32(1)
+	want := []TodoNodeTransport{
+		{
+			TodoTransport: TodoTransport{ID: 0, Description: "Clean the house", Version: 1, Position: 0},
+			Subtasks: []TodoNodeTransport{
+				{
+					TodoTransport: TodoTransport{ID: 1, Description: "Sweep the floor", Version: 2, Position: 2, ParentID: &house},
+					Subtasks: []TodoNodeTransport{
+						{
+							TodoTransport: TodoTransport{ID: 2, Description: "Mop the floor", Version: 2, Position: 3, ParentID: &floor},
+							Subtasks:      []TodoNodeTransport{},
+						},
+					},
+				},
+			},
+		},
+		{
+			TodoTransport: TodoTransport{ID: 3, Description: "Call the bank", Version: 1, Position: 1},
+			Subtasks:      []TodoNodeTransport{},
+		},
+	}
+	ignoreTimestamps := cmpopts.IgnoreFields(TodoTransport{}, "CreatedAt", "UpdatedAt")
+	if diff := cmp.Diff(want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GET tree mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, query := range []string{"?view=tree&limit=1", "?view=nested"} {
+		res := do(t, http.MethodGet, TodoListPath+"/0/todo"+query, []byte{})
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s: got response %d want %d", query, res.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: "Work"}))
+	res.Body.Close()
+	for _, description := range []string{"Write report", "Review numbers", "Print report"} {
+		res := do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: description}))
+		res.Body.Close()
+	}
+
+	type Step struct {
+		method         string
+		path           string
+		body           string
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0/blockers/1",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/2/blockers/0",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/1/blockers/2",
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0/blockers/9",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			method:         http.MethodDelete,
+			path:           TodoListPath + "/0/todo/0/blockers/2",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0",
+			body:           `{"description": "Write report", "done": true}`,
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0?force=maybe",
+			body:           `{"description": "Write report", "done": true}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0?force=true",
+			body:           `{"description": "Write report", "done": true}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/2/blockers/1",
+			wantStatusCode: http.StatusOK,
+		},
+	}
+
+	for i, step := range steps {
+		res := do(t, step.method, step.path, []byte(step.body))
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	res = do(t, http.MethodGet, TodoListPath+"/0/todo/2/blockers", []byte{})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET blockers: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	// The forced todo is done and no longer blocks
+	got := []TodoTransport{}
+	helperFromJSON(t, res.Body, &got)
+	want := []TodoTransport{
+		{ID: 0, Description: "Write report", Done: true},
+		{ID: 1, Description: "Review numbers"},
+	}
+	ignoreFields := cmpopts.IgnoreFields(TodoTransport{}, "Version", "Position", "CreatedAt", "UpdatedAt", "CompletedAt")
+	if diff := cmp.Diff(want, got, ignoreFields); diff != "" {
+		t.Errorf("GET blockers mismatch (-want +got):\n%s", diff)
+	}
+
+	res = do(t, http.MethodGet, TodoListPath+"/0/todo?unblocked=true", []byte{})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET unblocked: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	// Forcing the todo done didn't unblock it
+	unblocked := []TodoTransport{}
+	helperFromJSON(t, res.Body, &unblocked)
+	want = []TodoTransport{
+		{ID: 1, Description: "Review numbers"},
+	}
+	if diff := cmp.Diff(want, unblocked, ignoreFields); diff != "" {
+		t.Errorf("GET unblocked mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecurringTodos(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: "Work"}))
+	res.Body.Close()
+
+	report := TodoTransport{
+		Description: "Send weekly report",
+		DueDate:     "2021-02-01T09:00:00Z",
+		Recurrence:  "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=2",
+	}
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, report))
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST todo: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	report.Done = true
+	res = do(t, http.MethodPut, TodoListPath+"/0/todo/0", helperToJSON(t, report))
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT todo: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+
+	res = do(t, http.MethodGet, TodoListPath+"/0/todo", []byte{})
+	defer res.Body.Close()
+
+	// The next occurrence takes the rule, with one occurrence less
+	got := []TodoTransport{}
+	helperFromJSON(t, res.Body, &got)
+	want := []TodoTransport{
+		{ID: 0, Description: "Send weekly report", DueDate: "2021-02-01T09:00:00Z", Done: true, Version: 2, Position: 0},
+		{ID: 1, Description: "Send weekly report", DueDate: "2021-02-04T09:00:00Z", Version: 1, Position: 1, Recurrence: "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=1"},
+	}
+	ignoreTimestamps := cmpopts.IgnoreFields(TodoTransport{}, "CreatedAt", "UpdatedAt", "CompletedAt")
+	if diff := cmp.Diff(want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GET todos mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	type Step struct {
+		name           string
+		method         string
+		path           string
+		requestBody    []byte
+		wantStatusCode int
+		// wantETag is checked when not empty
+		wantETag string
+	}
+
+	steps := []Step{
+		{
+			name:           "CreateList",
+			method:         http.MethodPost,
+			path:           TodoListPath,
+			requestBody:    helperToJSON(t, TodoListTransport{Title: "Home"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateLabel",
+			method:         http.MethodPost,
+			path:           LabelPath,
+			requestBody:    helperToJSON(t, LabelTransport{Name: "chores", Color: "#00ff00"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateDuplicateLabel",
+			method:         http.MethodPost,
+			path:           LabelPath,
+			requestBody:    helperToJSON(t, LabelTransport{Name: "chores"}),
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "CreateInvalidLabel",
+			method:         http.MethodPost,
+			path:           LabelPath,
+			requestBody:    helperToJSON(t, LabelTransport{Name: "errands", Color: "green"}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "CreateOtherLabel",
+			method:         http.MethodPost,
+			path:           LabelPath,
+			requestBody:    helperToJSON(t, LabelTransport{Name: "urgent"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateLabeledTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			requestBody:    helperToJSON(t, TodoTransport{Description: "Do the dishes", Labels: []string{"chores", "urgent"}}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "RenameToExistingLabel",
+			method:         http.MethodPost,
+			path:           LabelPath + "/chores/rename",
+			requestBody:    helperToJSON(t, RenameLabelTransport{Name: "urgent"}),
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "RenameMissingLabel",
+			method:         http.MethodPost,
+			path:           LabelPath + "/missing/rename",
+			requestBody:    helperToJSON(t, RenameLabelTransport{Name: "found"}),
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "RenameLabel",
+			method:         http.MethodPost,
+			path:           LabelPath + "/chores/rename",
+			requestBody:    helperToJSON(t, RenameLabelTransport{Name: "housework"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "UpdateLabel",
+			method:         http.MethodPut,
+			path:           LabelPath + "/housework",
+			requestBody:    helperToJSON(t, LabelTransport{Color: "#0000ff", Description: "Around the house"}),
+			wantStatusCode: http.StatusOK,
+			wantETag:       `"3"`,
+		},
+		{
+			name:           "DeleteLabel",
+			method:         http.MethodDelete,
+			path:           LabelPath + "/urgent",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "GetDeletedLabel",
+			method:         http.MethodGet,
+			path:           LabelPath + "/urgent",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, step := range steps {
+		res := do(t, step.method, step.path, step.requestBody)
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("%s: got response %d want %d", step.name, res.StatusCode, step.wantStatusCode)
+		}
+		if got := res.Header.Get("ETag"); step.wantETag != "" && got != step.wantETag {
+			t.Errorf("%s: got ETag %q want %q", step.name, got, step.wantETag)
+		}
+	}
+
+	res := do(t, http.MethodGet, LabelPath, []byte{})
+	defer res.Body.Close()
+
+	got := []LabelTransport{}
+	helperFromJSON(t, res.Body, &got)
+	want := []LabelTransport{
+		{Name: "housework", Color: "#0000ff", Description: "Around the house", Version: 3, TodoCount: 1},
+	}
+	ignoreTimestamps := cmpopts.IgnoreFields(LabelTransport{}, "CreatedAt", "UpdatedAt")
+	if diff := cmp.Diff(want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GET labels mismatch (-want +got):\n%s", diff)
+	}
+
+	// Renaming and deleting labels rewrote the todo
+	todoRes := do(t, http.MethodGet, TodoListPath+"/0/todo/0", []byte{})
+	defer todoRes.Body.Close()
+
+	todo := TodoTransport{}
+	helperFromJSON(t, todoRes.Body, &todo)
+	if diff := cmp.Diff([]string{"housework"}, todo.Labels); diff != "" {
+		t.Errorf("GET todo labels mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStrictLabels(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	repo.StrictLabels = true
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: "Home"}))
+	res.Body.Close()
+
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: "Do the dishes", Labels: []string{"chores"}}))
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST todo with unknown label: got response %d want %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	res = do(t, http.MethodPost, LabelPath, helperToJSON(t, LabelTransport{Name: "chores"}))
+	res.Body.Close()
+
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: "Do the dishes", Labels: []string{"chores"}}))
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST todo with registered label: got response %d want %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestComments(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	type Step struct {
+		name           string
+		method         string
+		path           string
+		requestBody    []byte
+		wantStatusCode int
+		// wantETag is checked when not empty
+		wantETag string
+	}
+
+	hard := uint32(0)
+	missing := uint32(9)
+	steps := []Step{
+		{
+			name:           "CreateList",
+			method:         http.MethodPost,
+			path:           TodoListPath,
+			requestBody:    helperToJSON(t, TodoListTransport{Title: "Routine"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			requestBody:    helperToJSON(t, TodoTransport{Description: "Make the bed"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateOtherTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			requestBody:    helperToJSON(t, TodoTransport{Description: "Sweep the floor"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateComment",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/comments",
+			requestBody:    helperToJSON(t, CommentTransport{Author: "bob", Body: "It was hard"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateReply",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/comments",
+			requestBody:    helperToJSON(t, CommentTransport{ParentID: &hard, Author: "alice", Body: "Try harder"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateOtherComment",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/comments",
+			requestBody:    helperToJSON(t, CommentTransport{Author: "bob", Body: "Change the sheets"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateEmptyComment",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/comments",
+			requestBody:    helperToJSON(t, CommentTransport{Body: " "}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "ReplyToMissingComment",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/comments",
+			requestBody:    helperToJSON(t, CommentTransport{ParentID: &missing, Body: "Lost"}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "ReplyFromOtherTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/1/comments",
+			requestBody:    helperToJSON(t, CommentTransport{ParentID: &hard, Body: "Lost"}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "CommentOnMissingTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/9/comments",
+			requestBody:    helperToJSON(t, CommentTransport{Body: "Lost"}),
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "UpdateComment",
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0/comments/0",
+			requestBody:    helperToJSON(t, CommentTransport{Body: "It was easy"}),
+			wantStatusCode: http.StatusOK,
+			wantETag:       `"2"`,
+		},
+		{
+			name:           "UpdateEmptyComment",
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0/comments/0",
+			requestBody:    helperToJSON(t, CommentTransport{}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "UpdateCommentOfOtherTodo",
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/1/comments/0",
+			requestBody:    helperToJSON(t, CommentTransport{Body: "Moved"}),
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetCommentOfOtherTodo",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/1/comments/0",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "DeleteOtherComment",
+			method:         http.MethodDelete,
+			path:           TodoListPath + "/0/todo/0/comments/2",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "GetDeletedComment",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/0/comments/2",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetCommentsOfMissingTodo",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/9/comments",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetCommentsWithUnknownView",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/0/comments?view=graph",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, step := range steps {
+		res := do(t, step.method, step.path, step.requestBody)
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("%s: got response %d want %d", step.name, res.StatusCode, step.wantStatusCode)
+		}
+		if got := res.Header.Get("ETag"); step.wantETag != "" && got != step.wantETag {
+			t.Errorf("%s: got ETag %q want %q", step.name, got, step.wantETag)
+		}
+	}
+
+	ignoreTimestamps := cmpopts.IgnoreFields(CommentTransport{}, "CreatedAt", "UpdatedAt")
+	easy := CommentTransport{ID: 0, TodoID: 0, Author: "bob", Body: "It was easy", Version: 2}
+	harder := CommentTransport{ID: 1, TodoID: 0, ParentID: &hard, Author: "alice", Body: "Try harder", Version: 1}
+
+	res := do(t, http.MethodGet, TodoListPath+"/0/todo/0/comments", []byte{})
+	defer res.Body.Close()
+
+	got := []CommentTransport{}
+	helperFromJSON(t, res.Body, &got)
+	if diff := cmp.Diff([]CommentTransport{easy, harder}, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GET comments mismatch (-want +got):\n%s", diff)
+	}
+
+	treeRes := do(t, http.MethodGet, TodoListPath+"/0/todo/0/comments?view=tree", []byte{})
+	defer treeRes.Body.Close()
+
+	gotTree := []CommentNodeTransport{}
+	helperFromJSON(t, treeRes.Body, &gotTree)
+	wantTree := []CommentNodeTransport{
+		{
+			CommentTransport: easy,
+			Replies:          []CommentNodeTransport{{CommentTransport: harder, Replies: []CommentNodeTransport{}}},
+		},
+	}
+	if diff := cmp.Diff(wantTree, gotTree, ignoreTimestamps); diff != "" {
+		t.Errorf("GET comments tree mismatch (-want +got):\n%s", diff)
+	}
+
+	// Deleting a comment deletes its replies, and If-Match guards it
+	request := newRequest(t, http.MethodDelete, server.URL+TodoListPath+"/0/todo/0/comments/0", []byte{})
+	request.Header.Set("If-Match", formatETag(1))
+	conflictRes, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflictRes.Body.Close()
+	if conflictRes.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("got response %d deleting a stale comment; want %d", conflictRes.StatusCode, http.StatusPreconditionFailed)
+	}
+
+	request = newRequest(t, http.MethodDelete, server.URL+TodoListPath+"/0/todo/0/comments/0", []byte{})
+	request.Header.Set("If-Match", formatETag(2))
+	deleteRes, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteRes.Body.Close()
+	if deleteRes.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d deleting a comment; want %d", deleteRes.StatusCode, http.StatusOK)
+	}
+
+	replyRes := do(t, http.MethodGet, TodoListPath+"/0/todo/0/comments/1", []byte{})
+	replyRes.Body.Close()
+	if replyRes.StatusCode != http.StatusNotFound {
+		t.Errorf("got response %d getting a reply of a deleted comment; want %d", replyRes.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestAttachmentsRefusedLeaveNoContent(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	dir := t.TempDir()
+	blobs, err := repository.NewBlobStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewApi(repo, blobs)
+	api.Auth = AuthOptions{TrustUserHeader: true}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(ctx, repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	routine, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ShareTodoList(ctx, routine.ID, repository.Member{User: "bob", Role: repository.RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertTodo(ctx, repository.Todo{ListID: routine.ID, Description: "Make the bed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		name           string
+		user           string
+		path           string
+		fileName       string
+		wantStatusCode int
+	}
+
+	tests := []Test{
+		{name: "MissingTodo", user: "alice", path: TodoListPath + "/0/todo/9/attachments", fileName: "notes.txt", wantStatusCode: http.StatusNotFound},
+		{name: "Viewer", user: "bob", path: TodoListPath + "/0/todo/0/attachments", fileName: "notes.txt", wantStatusCode: http.StatusForbidden},
+		{name: "InvalidName", user: "alice", path: TodoListPath + "/0/todo/0/attachments", fileName: " ", wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contentType, body := helperMultipart(t, AttachmentFormField, test.fileName, []byte("Buy new sheets"))
+			request := newRequest(t, http.MethodPost, server.URL+test.path, body)
+			request.Header.Set("Content-Type", contentType)
+			request.Header.Set(UserHeader, test.user)
+			res, err := server.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					t.Errorf("content of a refused upload was kept on %s", path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	blobs, err := repository.NewBlobStore(t.TempDir(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewApi(repo, blobs)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path, contentType string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	type Step struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		requestBody    []byte
+		wantStatusCode int
+	}
+
+	screenshot := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	screenshotType, screenshotBody := helperMultipart(t, AttachmentFormField, "screenshot.png", screenshot)
+	notesType, notesBody := helperMultipart(t, AttachmentFormField, `C:\Users\bob\notes.txt`, []byte("Buy new sheets"))
+	largeType, largeBody := helperMultipart(t, AttachmentFormField, "large.txt", bytes.Repeat([]byte("a"), 65))
+	otherFieldType, otherFieldBody := helperMultipart(t, "other", "notes.txt", []byte("Buy new sheets"))
+	steps := []Step{
+		{
+			name:           "CreateList",
+			method:         http.MethodPost,
+			path:           TodoListPath,
+			requestBody:    helperToJSON(t, TodoListTransport{Title: "Routine"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			requestBody:    helperToJSON(t, TodoTransport{Description: "Make the bed"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "CreateOtherTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo",
+			requestBody:    helperToJSON(t, TodoTransport{Description: "Sweep the floor"}),
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "UploadScreenshot",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    screenshotType,
+			requestBody:    screenshotBody,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "UploadWithPath",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    notesType,
+			requestBody:    notesBody,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "UploadOldNotes",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    notesType,
+			requestBody:    notesBody,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "UploadTooLarge",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    largeType,
+			requestBody:    largeBody,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "UploadWithoutFile",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    otherFieldType,
+			requestBody:    otherFieldBody,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "UploadJSON",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/0/attachments",
+			contentType:    "application/json",
+			requestBody:    helperToJSON(t, AttachmentTransport{Name: "notes.txt"}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "UploadToMissingTodo",
+			method:         http.MethodPost,
+			path:           TodoListPath + "/0/todo/9/attachments",
+			contentType:    notesType,
+			requestBody:    notesBody,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetAttachmentOfOtherTodo",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/1/attachments/0",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetContentOfOtherTodo",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/1/attachments/0/content",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "DeleteAttachmentOfOtherTodo",
+			method:         http.MethodDelete,
+			path:           TodoListPath + "/0/todo/1/attachments/0",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "UpdateAttachment",
+			method:         http.MethodPut,
+			path:           TodoListPath + "/0/todo/0/attachments/0",
+			requestBody:    helperToJSON(t, AttachmentTransport{Name: "bed.png"}),
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "DeleteOldNotes",
+			method:         http.MethodDelete,
+			path:           TodoListPath + "/0/todo/0/attachments/2",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "GetDeletedNotes",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/0/attachments/2",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "GetAttachmentsOfMissingTodo",
+			method:         http.MethodGet,
+			path:           TodoListPath + "/0/todo/9/attachments",
+			requestBody:    []byte{},
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, step := range steps {
+		res := do(t, step.method, step.path, step.contentType, step.requestBody)
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("%s: got response %d want %d", step.name, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	screenshotHash := sha256.Sum256(screenshot)
+	want := AttachmentTransport{
+		ID:          0,
+		TodoID:      0,
+		Name:        "screenshot.png",
+		ContentType: "image/png",
+		Size:        int64(len(screenshot)),
+		SHA256:      hex.EncodeToString(screenshotHash[:]),
+	}
+	notesHash := sha256.Sum256([]byte("Buy new sheets"))
+	notes := AttachmentTransport{
+		ID:          1,
+		TodoID:      0,
+		Name:        "notes.txt",
+		ContentType: "text/plain; charset=utf-8",
+		Size:        14,
+		SHA256:      hex.EncodeToString(notesHash[:]),
+	}
+
+	res := do(t, http.MethodGet, TodoListPath+"/0/todo/0/attachments", "", []byte{})
+	defer res.Body.Close()
+
+	got := []AttachmentTransport{}
+	helperFromJSON(t, res.Body, &got)
+	if diff := cmp.Diff([]AttachmentTransport{want, notes}, got, cmpopts.IgnoreFields(AttachmentTransport{}, "CreatedAt")); diff != "" {
+		t.Errorf("GET attachments mismatch (-want +got):\n%s", diff)
+	}
+
+	contentRes := do(t, http.MethodGet, TodoListPath+"/0/todo/0/attachments/0/content", "", []byte{})
+	defer contentRes.Body.Close()
+
+	gotHeaders := map[string]string{
+		"Content-Type":        contentRes.Header.Get("Content-Type"),
+		"Content-Disposition": contentRes.Header.Get("Content-Disposition"),
+		"ETag":                contentRes.Header.Get("ETag"),
+	}
+	wantHeaders := map[string]string{
+		"Content-Type":        "image/png",
+		"Content-Disposition": "attachment; filename=screenshot.png",
+		"ETag":                `"` + want.SHA256 + `"`,
+	}
+	if diff := cmp.Diff(wantHeaders, gotHeaders); diff != "" {
+		t.Errorf("GET content headers mismatch (-want +got):\n%s", diff)
+	}
+	gotContent, err := ioutil.ReadAll(contentRes.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(screenshot, gotContent) {
+		t.Errorf("got content %q; want %q", gotContent, screenshot)
+	}
+
+	// Downloads can be resumed
+	request := newRequest(t, http.MethodGet, server.URL+TodoListPath+"/0/todo/0/attachments/0/content", []byte{})
+	request.Header.Set("Range", "bytes=0-3")
+	rangeRes, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rangeRes.Body.Close()
+
+	gotRange, err := ioutil.ReadAll(rangeRes.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rangeRes.StatusCode != http.StatusPartialContent || string(gotRange) != "\x89PNG" {
+		t.Errorf("got response %d with %q for a range; want %d with %q", rangeRes.StatusCode, gotRange, http.StatusPartialContent, "\x89PNG")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	type Test struct {
+		name           string
+		method         string
+		rawQuery       string
+		injectResponse []repository.SearchHit
+		injectErr      error
+		wantStatusCode int
+		want           []SearchHitTransport
+	}
+
+	tests := []Test{
+		{
+			name:     "SuccessSearching",
+			rawQuery: "q=invoice&limit=2",
+			injectResponse: []repository.SearchHit{
+				{
+					TodoList: repository.TodoList{ID: 1, Title: "Work", Version: 1},
+					Todo:     &repository.Todo{ID: 2, ListID: 1, Description: "Send the invoice", Version: 1},
+					Fields:   []string{"description"},
+					Score:    2.5,
+				},
+				{
+					TodoList: repository.TodoList{ID: 3, Title: "Invoices", Version: 1},
+					Fields:   []string{"title"},
+					Score:    1.5,
+				},
+			},
+			want: []SearchHitTransport{
+				{
+					TodoList: TodoListTransport{ID: 1, Title: "Work", Version: 1},
+					Todo:     &TodoTransport{ID: 2, ListID: 1, Description: "Send the invoice", Version: 1},
+					Fields:   []string{"description"},
+					Score:    2.5,
+				},
+				{
+					TodoList: TodoListTransport{ID: 3, Title: "Invoices", Version: 1},
+					Fields:   []string{"title"},
+					Score:    1.5,
+				},
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessSearchingWithoutHits",
+			rawQuery:       "q=invoice",
+			want:           []SearchHitTransport{},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "BadRequestInvalidLimit",
+			rawQuery:       "q=invoice&limit=-1",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "BadRequestIfRepoReturnsErrInvalidSearch",
+			rawQuery:       "q=",
+			injectErr:      repository.ErrInvalidSearch,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "MethodNotAllowedForPost",
+			method:         "POST",
+			rawQuery:       "q=invoice",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "InternalServerErrorSearchError",
+			rawQuery:       "q=invoice",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeSearchHits = test.injectResponse
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			method := http.MethodGet
+			if test.method != "" {
+				method = test.method
+			}
+
+			request := newRequest(t, method, server.URL+SearchPath+"?"+test.rawQuery, []byte{})
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+				return
+			}
+
+			got := []SearchHitTransport{}
+			helperFromJSON(t, res.Body, &got)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("api: GET %s mismatch (-want +got):\n%s", SearchPath, diff)
+			}
+		})
+	}
+}
+
+func TestSearchFollowsWrites(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	search := func(t *testing.T, q string) []string {
+		t.Helper()
+
+		res := do(t, http.MethodGet, SearchPath+"?q="+q, []byte{})
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET search: got response %d want %d", res.StatusCode, http.StatusOK)
+		}
+
+		hits := []SearchHitTransport{}
+		helperFromJSON(t, res.Body, &hits)
+		got := []string{}
+		for _, hit := range hits {
+			if hit.Todo == nil {
+				got = append(got, hit.TodoList.Title)
+				continue
+			}
+			got = append(got, hit.TodoList.Title+"/"+hit.Todo.Description)
+		}
+		return got
+	}
+
+	res := do(t, http.MethodPost, TodoListPath, helperToJSON(t, TodoListTransport{Title: "Work"}))
+	res.Body.Close()
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: "Send the invoice"}))
+	res.Body.Close()
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo", helperToJSON(t, TodoTransport{Description: "Pay the rent"}))
+	res.Body.Close()
+	res = do(t, http.MethodPost, TodoListPath+"/0/todo/1/comments", helperToJSON(t, CommentTransport{Body: "Ask for an invoice"}))
+	res.Body.Close()
+
+	if diff := cmp.Diff([]string{"Work/Send the invoice", "Work/Pay the rent"}, search(t, "invoice")); diff != "" {
+		t.Errorf("search mismatch (-want +got):\n%s", diff)
+	}
+
+	res = do(t, http.MethodDelete, TodoListPath+"/0/todo/0", []byte{})
+	res.Body.Close()
+
+	if diff := cmp.Diff([]string{"Work/Pay the rent"}, search(t, "invoice")); diff != "" {
+		t.Errorf("search after delete mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	type Test struct {
+		name           string
+		method         string
+		path           string
+		injectResponse []repository.HistoryEntry
+		injectErr      error
+		wantStatusCode int
+		want           []HistoryEntryTransport
+	}
+
+	history := []repository.HistoryEntry{
+		{
+			At:     parseTime(t, "2021-02-04T10:00:00Z"),
+			Actor:  "alice",
+			Action: repository.ActionCreate,
+			Changes: []repository.FieldChange{
+				{Field: "description", New: "Make the bed"},
+			},
+		},
+		{
+			At:     parseTime(t, "2021-02-05T10:00:00Z"),
+			Action: repository.ActionDelete,
+		},
+	}
+	wantHistory := []HistoryEntryTransport{
+		{
+			At:     "2021-02-04T10:00:00Z",
+			Actor:  "alice",
+			Action: "create",
+			Changes: []FieldChangeTransport{
+				{Field: "description", New: "Make the bed"},
+			},
+		},
+		{
+			At:      "2021-02-05T10:00:00Z",
+			Action:  "delete",
+			Changes: []FieldChangeTransport{},
+		},
+	}
+
+	tests := []Test{
+		{
+			name:           "SuccessRetrievingTodoHistory",
+			path:           TodoListPath + "/0/todo/0/history",
+			injectResponse: history,
+			want:           wantHistory,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessRetrievingTodoListHistory",
+			path:           TodoListPath + "/0/history",
+			injectResponse: history,
+			want:           wantHistory,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "BadRequestWrongIDPath",
+			path:           TodoListPath + "/0/todo/wrongpath/history",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "MethodNotAllowedForPost",
+			method:         "POST",
+			path:           TodoListPath + "/0/todo/0/history",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "NotFoundIfRepoGetTodoHistoryReturnsTodoNotFound",
+			path:           TodoListPath + "/0/todo/0/history",
+			injectErr:      repository.ErrTodoNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "NotFoundIfRepoGetTodoListHistoryReturnsTodoListNotFound",
+			path:           TodoListPath + "/0/history",
+			injectErr:      repository.ErrTodoListNotFound,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "InternalServerErrorGetTodoHistoryError",
+			path:           TodoListPath + "/0/todo/0/history",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeHistory = test.injectResponse
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			method := http.MethodGet
+			if test.method != "" {
+				method = test.method
+			}
+
+			request := newRequest(t, method, server.URL+test.path, []byte{})
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+				return
+			}
+
+			got := []HistoryEntryTransport{}
+			helperFromJSON(t, res.Body, &got)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("api: GET %s mismatch (-want +got):\n%s", test.path, diff)
+			}
+		})
+	}
+}
+
+func TestTrashGet(t *testing.T) {
+	type Test struct {
+		name           string
+		method         string
+		injectResponse repository.Trash
+		injectErr      error
+		wantStatusCode int
+		want           TrashTransport
+	}
+
+	tests := []Test{
+		{
+			name: "SuccessRetrievingTrash",
+			injectResponse: repository.Trash{
+				TodoLists: []repository.TrashedTodoList{
+					{
+						TodoList:  repository.TodoList{ID: 1, Title: "Routine", Version: 1},
+						DeletedAt: parseTime(t, "2021-02-05T10:00:00Z"),
+						TodoIDs:   []uint32{2},
+					},
+				},
+				Todos: []repository.TrashedTodo{
+					{
+						Todo: repository.Todo{
+							ID:          2,
+							ListID:      1,
+							Description: "Make the bed",
+							DueDate:     parseTime(t, "2021-02-04T00:00:00Z"),
+							Version:     1,
+						},
+						DeletedAt:  parseTime(t, "2021-02-05T10:00:00Z"),
+						SubtaskIDs: []uint32{3},
+					},
+				},
+			},
+			want: TrashTransport{
+				TodoLists: []TrashedTodoListTransport{
+					{
+						TodoList:  TodoListTransport{ID: 1, Title: "Routine", Version: 1},
+						DeletedAt: "2021-02-05T10:00:00Z",
+						TodoIDs:   []uint32{2},
+					},
+				},
+				Todos: []TrashedTodoTransport{
+					{
+						Todo: TodoTransport{
+							ID:          2,
+							ListID:      1,
+							Description: "Make the bed",
+							DueDate:     "2021-02-04T00:00:00Z",
+							Version:     1,
+						},
+						DeletedAt:  "2021-02-05T10:00:00Z",
+						SubtaskIDs: []uint32{3},
+					},
+				},
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessRetrievingEmptyTrash",
+			want:           TrashTransport{TodoLists: []TrashedTodoListTransport{}, Todos: []TrashedTodoTransport{}},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "MethodNotAllowedForPost",
+			method:         "POST",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "InternalServerErrorGetTrashError",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeTrash = test.injectResponse
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			method := http.MethodGet
+			if test.method != "" {
+				method = test.method
+			}
+
+			request := newRequest(t, method, server.URL+TrashPath, []byte{})
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+				return
+			}
+
+			got := TrashTransport{}
+			helperFromJSON(t, res.Body, &got)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("api: GET %s mismatch (-want +got):\n%s", TrashPath, diff)
+			}
+		})
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	type Test struct {
+		name           string
+		query          string
+		injectPurged   int
+		injectErr      error
+		wantStatusCode int
+		want           PurgeTrashTransport
+	}
+
+	tests := []Test{
+		{
+			name:           "SuccessPurgingEverything",
+			injectPurged:   3,
+			want:           PurgeTrashTransport{Purged: 3},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessPurgingDeletedBefore",
+			query:          "?deleted_before=2021-02-05T00:00:00Z",
+			injectPurged:   1,
+			want:           PurgeTrashTransport{Purged: 1},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "BadRequestInvalidDeletedBefore",
+			query:          "?deleted_before=yesterday",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "InternalServerErrorPurgeTrashError",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakePurged = test.injectPurged
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			request := newRequest(t, http.MethodDelete, server.URL+TrashPath+test.query, []byte{})
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+				return
+			}
+
+			got := PurgeTrashTransport{}
+			helperFromJSON(t, res.Body, &got)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("api: DELETE %s mismatch (-want +got):\n%s", TrashPath, diff)
+			}
+		})
+	}
+}
+
+func TestTrashItems(t *testing.T) {
+	type Test struct {
+		name           string
+		method         string
+		path           string
+		injectErr      error
+		wantStatusCode int
+	}
+
+	tests := []Test{
+		{
+			name:           "SuccessRestoringTodoList",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todolist/1/restore",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessRestoringTodo",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/1/restore",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessPurgingTodoList",
+			method:         http.MethodDelete,
+			path:           TrashPath + "/todolist/1",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "SuccessPurgingTodo",
+			method:         http.MethodDelete,
+			path:           TrashPath + "/todo/1",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "BadRequestWrongIDPath",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/wrongpath/restore",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "MethodNotAllowedForGetOnRestore",
+			method:         http.MethodGet,
+			path:           TrashPath + "/todolist/1/restore",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "MethodNotAllowedForPostOnPurge",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/1",
+			wantStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "NotFoundIfRestoreTodoListReturnsNotInTrash",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todolist/1/restore",
+			injectErr:      repository.ErrNotInTrash,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "NotFoundIfRestoreTodoReturnsNotInTrash",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/1/restore",
+			injectErr:      repository.ErrNotInTrash,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "ConflictIfRestoreTodoReturnsTodoListNotFound",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todo/1/restore",
+			injectErr:      repository.ErrTodoListNotFound,
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "NotFoundIfPurgeTodoListReturnsNotInTrash",
+			method:         http.MethodDelete,
+			path:           TrashPath + "/todolist/1",
+			injectErr:      repository.ErrNotInTrash,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "NotFoundIfPurgeTodoReturnsNotInTrash",
+			method:         http.MethodDelete,
+			path:           TrashPath + "/todo/1",
+			injectErr:      repository.ErrNotInTrash,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "InternalServerErrorRestoreTodoListError",
+			method:         http.MethodPost,
+			path:           TrashPath + "/todolist/1/restore",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "InternalServerErrorPurgeTodoError",
+			method:         http.MethodDelete,
+			path:           TrashPath + "/todo/1",
+			injectErr:      errors.New("injected generic error"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeError = test.injectErr
+			api := NewApi(repo, nil)
+			service := api.RegisterRoutes()
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			request := newRequest(t, test.method, server.URL+test.path, []byte{})
+			client := server.Client()
+
+			res, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatusCode {
+				t.Fatalf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+
+			if test.wantStatusCode != http.StatusOK {
+				wantErr := ErrorResponse{}
+				helperFromJSON(t, res.Body, &wantErr)
+
+				// Validate that a message is sent, but not its contents
+				// since the message is for human inspection only
+				if wantErr.Error.Message == "" {
+					t.Fatalf("expected an error message on status code %d", test.wantStatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	type Step struct {
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{method: http.MethodPost, path: TodoListPath + "/0/todo", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK},
+		{method: http.MethodPost, path: TodoListPath + "/0/todo", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK},
+		{method: http.MethodDelete, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusOK},
+		{method: http.MethodGet, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodPost, path: TrashPath + "/todo/0/restore", wantStatusCode: http.StatusOK},
+		{method: http.MethodGet, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusOK},
+		{method: http.MethodPost, path: TrashPath + "/todo/0/restore", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodDelete, path: TodoListPath + "/0", wantStatusCode: http.StatusOK},
+		{method: http.MethodGet, path: TodoListPath + "/0/todo/1", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodPost, path: TrashPath + "/todo/1/restore", wantStatusCode: http.StatusConflict},
+		{method: http.MethodPost, path: TrashPath + "/todolist/0/restore", wantStatusCode: http.StatusOK},
+		{method: http.MethodGet, path: TodoListPath + "/0/todo/1", wantStatusCode: http.StatusOK},
+		{method: http.MethodDelete, path: TodoListPath + "/0", wantStatusCode: http.StatusOK},
+		{method: http.MethodDelete, path: TrashPath + "/todolist/0", wantStatusCode: http.StatusOK},
+		{method: http.MethodPost, path: TrashPath + "/todolist/0/restore", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodPost, path: TrashPath + "/todo/1/restore", wantStatusCode: http.StatusNotFound},
+	}
+
+	for i, step := range steps {
+		request := newRequest(t, step.method, server.URL+step.path, step.body)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	trash, err := repo.GetTrash(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.TodoLists) != 0 || len(trash.Todos) != 0 {
+		t.Errorf("got trash %+v; want it empty after purging", trash)
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, method, path, ifMatch string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if ifMatch != "" {
+			request.Header.Set("If-Match", ifMatch)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	type Step struct {
+		method         string
+		path           string
+		ifMatch        string
+		body           []byte
+		wantStatusCode int
+		wantETag       string
+	}
+
+	steps := []Step{
+		{method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"1"`},
+		{method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusOK, wantETag: `"1"`},
+		{method: http.MethodPut, path: TodoListPath + "/0", ifMatch: `"1"`, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"2"`},
+		{method: http.MethodPut, path: TodoListPath + "/0", ifMatch: `"1"`, body: validTodoListRequestBody(t), wantStatusCode: http.StatusPreconditionFailed},
+		{method: http.MethodPut, path: TodoListPath + "/0", body: []byte(`{"title": "Routine", "version": 1}`), wantStatusCode: http.StatusConflict},
+		{method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusOK, wantETag: `"2"`},
+		// Unconditional updates tell the version they made too
+		{method: http.MethodPut, path: TodoListPath + "/0", body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"3"`},
+		{method: http.MethodPut, path: TodoListPath + "/0", ifMatch: `"3"`, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"4"`},
+		{method: http.MethodPost, path: TodoListPath + "/0/todo", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"1"`},
+		{method: http.MethodPut, path: TodoListPath + "/0/todo/0", ifMatch: `"1"`, body: validTodoRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"2"`},
+		{method: http.MethodPut, path: TodoListPath + "/0/todo/0", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK, wantETag: `"3"`},
+		{method: http.MethodDelete, path: TodoListPath + "/0/todo/0", ifMatch: `"2"`, wantStatusCode: http.StatusPreconditionFailed},
+		{method: http.MethodGet, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusOK, wantETag: `"3"`},
+		{method: http.MethodDelete, path: TodoListPath + "/0/todo/0", ifMatch: `"3"`, wantStatusCode: http.StatusOK},
+		{method: http.MethodDelete, path: TodoListPath + "/0", ifMatch: `"1"`, wantStatusCode: http.StatusPreconditionFailed},
+		{method: http.MethodDelete, path: TodoListPath + "/0", ifMatch: "*", wantStatusCode: http.StatusOK},
+	}
+
+	for i, step := range steps {
+		res := do(t, step.method, step.path, step.ifMatch, step.body)
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+		if got := res.Header.Get("ETag"); got != step.wantETag {
+			t.Errorf("step %d: %s %s: got ETag %q want %q", i, step.method, step.path, got, step.wantETag)
+		}
+	}
+}
+
+func TestSharing(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true, AdminToken: adminToken}
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, secret, user, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		if user != "" {
+			request.Header.Set(UserHeader, user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	type Step struct {
+		secret         string
+		user           string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{method: http.MethodPost, path: UserPath, body: []byte(`{"name": "alice"}`), wantStatusCode: http.StatusForbidden},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "alice", "display_name": "Alice"}`), wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "bob"}`), wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "carol"}`), wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "alice"}`), wantStatusCode: http.StatusConflict},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "a b"}`), wantStatusCode: http.StatusBadRequest},
+		{user: "alice", method: http.MethodPost, path: UserPath, body: []byte(`{"name": "dave"}`), wantStatusCode: http.StatusForbidden},
+		{user: "alice", method: http.MethodPost, path: TokenPath, body: []byte(`{"user": "bob", "scopes": ["write"]}`), wantStatusCode: http.StatusForbidden},
+		{user: "alice", method: http.MethodPost, path: TokenPath, body: []byte(`{"scopes": ["admin"]}`), wantStatusCode: http.StatusForbidden},
+		{method: http.MethodGet, path: UserPath + "/alice", wantStatusCode: http.StatusOK},
+		{method: http.MethodGet, path: UserPath + "/dave", wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "dave", method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusUnauthorized},
+		{user: "bob", method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusNotFound},
+		{user: "bob", method: http.MethodPut, path: TodoListPath + "/0/members/carol", body: []byte(`{"role": "viewer"}`), wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/bob", body: []byte(`{"role": "editor"}`), wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/carol", body: []byte(`{"role": "viewer"}`), wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/dave", body: []byte(`{"role": "viewer"}`), wantStatusCode: http.StatusBadRequest},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/bob", body: []byte(`{"role": "admin"}`), wantStatusCode: http.StatusBadRequest},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/alice", body: []byte(`{"role": "viewer"}`), wantStatusCode: http.StatusBadRequest},
+		{user: "bob", method: http.MethodPost, path: TodoListPath + "/0/todo", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "carol", method: http.MethodGet, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusOK},
+		{user: "carol", method: http.MethodPut, path: TodoListPath + "/0/todo/0", body: validTodoRequestBody(t), wantStatusCode: http.StatusForbidden},
+		{user: "bob", method: http.MethodDelete, path: TodoListPath + "/0", wantStatusCode: http.StatusForbidden},
+		{user: "bob", method: http.MethodPut, path: TodoListPath + "/0/members/carol", body: []byte(`{"role": "editor"}`), wantStatusCode: http.StatusForbidden},
+		{user: "carol", method: http.MethodDelete, path: TodoListPath + "/0/members/carol", wantStatusCode: http.StatusOK},
+		{user: "carol", method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodDelete, path: TodoListPath + "/0/members/carol", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusNotFound},
+		{method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodGet, path: TodoListPath + "/1", wantStatusCode: http.StatusOK},
+	}
+
+	for i, step := range steps {
+		res := do(t, step.secret, step.user, step.method, step.path, step.body)
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s as %q: got response %d want %d", i, step.method, step.path, step.user, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	res := do(t, "", "bob", http.MethodGet, TodoListPath, nil)
+	defer res.Body.Close()
+
+	got := []TodoListTransport{}
+	helperFromJSON(t, res.Body, &got)
+
+	want := []TodoListTransport{
+		{ID: 0, Title: "Routine", Owner: "alice", Members: []MemberTransport{{User: "bob", Role: "editor"}}},
+		{ID: 1, Title: "Routine"},
+	}
+	ignore := cmpopts.IgnoreFields(TodoListTransport{}, "Version", "CreatedAt", "UpdatedAt")
+	byID := cmpopts.SortSlices(func(a, b TodoListTransport) bool { return a.ID < b.ID })
+	if diff := cmp.Diff(want, got, ignore, byID); diff != "" {
+		t.Errorf("todo lists visible to bob mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabelSharing(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true, AdminToken: adminToken}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	do := func(t *testing.T, secret, user, method, path string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		if user != "" {
+			request.Header.Set(UserHeader, user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	type Step struct {
+		secret         string
+		user           string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+		// wantTodoCount is checked on the label replied when not nil
+		wantTodoCount *int
+	}
+
+	none, one := 0, 1
+	steps := []Step{
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "alice"}`), wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "bob"}`), wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "carol"}`), wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPost, path: TodoListPath + "/0/todo", body: validTodoRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPut, path: TodoListPath + "/0/members/carol", body: []byte(`{"role": "viewer"}`), wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodPost, path: TodoListPath + "/1/todo", body: []byte(`{"description": "Paint the wall", "labels": ["bedroom"]}`), wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodPost, path: LabelPath, body: []byte(`{"name": "bed"}`), wantStatusCode: http.StatusOK, wantTodoCount: &none},
+		{user: "bob", method: http.MethodGet, path: LabelPath + "/bed", wantStatusCode: http.StatusOK, wantTodoCount: &none},
+		{user: "carol", method: http.MethodGet, path: LabelPath + "/bed", wantStatusCode: http.StatusOK, wantTodoCount: &one},
+		{user: "bob", method: http.MethodPost, path: LabelPath + "/bed/rename", body: []byte(`{"name": "sleep"}`), wantStatusCode: http.StatusForbidden},
+		{user: "carol", method: http.MethodPost, path: LabelPath + "/bed/rename", body: []byte(`{"name": "sleep"}`), wantStatusCode: http.StatusForbidden},
+		{user: "bob", method: http.MethodDelete, path: LabelPath + "/bed", wantStatusCode: http.StatusForbidden},
+		{user: "carol", method: http.MethodDelete, path: LabelPath + "/bed", wantStatusCode: http.StatusForbidden},
+		{user: "bob", method: http.MethodPost, path: LabelPath + "/missing/rename", body: []byte(`{"name": "sleep"}`), wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodPost, path: LabelPath + "/bed/rename", body: []byte(`{"name": "sleep"}`), wantStatusCode: http.StatusOK, wantTodoCount: &one},
+		{user: "carol", method: http.MethodGet, path: TodoListPath + "/0/todo/0", wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodPost, path: LabelPath, body: []byte(`{"name": "bedroom"}`), wantStatusCode: http.StatusOK, wantTodoCount: &one},
+		// Bob's todo has it too, and alice has no role on his todo list
+		{user: "alice", method: http.MethodDelete, path: LabelPath + "/bedroom", wantStatusCode: http.StatusForbidden},
+		// Even once it is on the trash
+		{user: "bob", method: http.MethodDelete, path: TodoListPath + "/1", wantStatusCode: http.StatusOK},
+		{user: "alice", method: http.MethodDelete, path: LabelPath + "/bedroom", wantStatusCode: http.StatusForbidden},
+		{secret: adminToken, method: http.MethodDelete, path: LabelPath + "/bedroom", wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodDelete, path: LabelPath + "/sleep", wantStatusCode: http.StatusForbidden},
+		{user: "alice", method: http.MethodDelete, path: LabelPath + "/sleep", wantStatusCode: http.StatusOK},
+	}
+
+	for i, step := range steps {
+		res, data := do(t, step.secret, step.user, step.method, step.path, step.body)
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s as %q: got response %d want %d: %s", i, step.method, step.path, step.user, res.StatusCode, step.wantStatusCode, data)
+		}
+		if step.wantTodoCount == nil {
+			continue
+		}
+		label := LabelTransport{}
+		if err := json.Unmarshal(data, &label); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if label.TodoCount != *step.wantTodoCount {
+			t.Errorf("step %d: %s %s as %q: got todo count %d want %d", i, step.method, step.path, step.user, label.TodoCount, *step.wantTodoCount)
+		}
+	}
+
+	// Every label is gone, and so it is from the todo of alice
+	res, data := do(t, "", "bob", http.MethodGet, LabelPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d listing labels: %s", res.StatusCode, data)
+	}
+	labels := []LabelTransport{}
+	if err := json.Unmarshal(data, &labels); err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 0 {
+		t.Errorf("got labels %v after deleting them; want none", labels)
+	}
+	todo, err := repo.GetTodoByID(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{}, todo.Labels, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("labels of alice's todo mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTodoTxt(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	do := func(t *testing.T, user, method, path string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if user != "" {
+			request.Header.Set(UserHeader, user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(context.Background(), repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	routine, err := repo.InsertTodoList(repository.WithActor(context.Background(), "alice"), repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertTodo(context.Background(), repository.Todo{ListID: routine.ID, Description: "Already there"}); err != nil {
+		t.Fatal(err)
+	}
+	path := strings.Replace(TodoListTodoTxtPath, "{id}", strconv.Itoa(int(routine.ID)), 1)
+
+	content := strings.Join([]string{
+		"(A) 2021-03-01 Call mom +family @phone due:2021-03-05",
+		"x 2021-03-02 2021-03-01 Make the bed +chores pri:B",
+		"x 2021-03-02 Water the plants",
+	}, "\n") + "\n"
+
+	res, data := do(t, "alice", http.MethodPost, path, []byte(content))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d on import; want %d: %s", res.StatusCode, http.StatusOK, data)
+	}
+	imported := []TodoTransport{}
+	helperFromJSON(t, bytes.NewReader(data), &imported)
+	want := []TodoTransport{
+		{ID: 1, ListID: routine.ID, Description: "Call mom", Labels: []string{"priority:A", "family", "@phone"}, DueDate: "2021-03-05T00:00:00Z", CreatedAt: "2021-03-01T00:00:00Z", Position: 1},
+		{ID: 2, ListID: routine.ID, Description: "Make the bed", Labels: []string{"priority:B", "chores"}, Done: true, CreatedAt: "2021-03-01T00:00:00Z", CompletedAt: "2021-03-02T00:00:00Z", Position: 2},
+		{ID: 3, ListID: routine.ID, Description: "Water the plants", Done: true, CreatedAt: "2021-03-02T00:00:00Z", CompletedAt: "2021-03-02T00:00:00Z", Position: 3},
+	}
+	ignore := cmpopts.IgnoreFields(TodoTransport{}, "Version", "UpdatedAt")
+	if diff := cmp.Diff(want, imported, ignore); diff != "" {
+		t.Errorf("imported todos mismatch (-want +got):\n%s", diff)
+	}
+
+	res, data = do(t, "bob", http.MethodGet, path, nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("got response %d exporting a todo list of another user; want %d", res.StatusCode, http.StatusNotFound)
+	}
+	res, data = do(t, "alice", http.MethodGet, path, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d on export; want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q; want text/plain", got)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if !strings.HasSuffix(lines[0], " Already there") {
+		t.Errorf("got first task %q; want the todo already there", lines[0])
+	}
+	wantRest := strings.Replace(content, "x 2021-03-02 Water", "x 2021-03-02 2021-03-02 Water", 1)
+	if diff := cmp.Diff(wantRest, lines[1]); diff != "" {
+		t.Errorf("exported todo.txt mismatch (-want +got):\n%s", diff)
+	}
+
+	type Step struct {
+		user           string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{user: "alice", method: http.MethodPost, path: path, body: []byte("+chores"), wantStatusCode: http.StatusBadRequest},
+		{user: "alice", method: http.MethodPut, path: path, body: []byte(content), wantStatusCode: http.StatusMethodNotAllowed},
+		{user: "bob", method: http.MethodPost, path: path, body: []byte(content), wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodPost, path: TodoListPath + "/9/todo.txt", body: []byte(content), wantStatusCode: http.StatusNotFound},
+	}
+
+	for i, step := range steps {
+		res, _ := do(t, step.user, step.method, step.path, step.body)
+		if res.StatusCode != step.wantStatusCode {
+			t.Errorf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	do := func(t *testing.T, user, method, path string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if user != "" {
+			request.Header.Set(UserHeader, user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(context.Background(), repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	home, err := repo.InsertTodoList(repository.WithActor(context.Background(), "alice"), repository.TodoList{Title: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := strings.Replace(TodoListCalendarPath, "{id}", strconv.Itoa(int(home.ID)), 1)
+
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//Reminders//EN",
+		"BEGIN:VTODO",
+		"UID:gift@example.com",
+		"CREATED:20210301T100000Z",
+		"SUMMARY:Buy a gift",
+		"DUE;VALUE=DATE:20210305",
+		"CATEGORIES:family",
+		"DESCRIPTION:Something to read",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:wrap@example.com",
+		"CREATED:20210301T100000Z",
+		"SUMMARY:Wrap it",
+		"STATUS:COMPLETED",
+		"COMPLETED:20210302T180000Z",
+		"RELATED-TO:gift@example.com",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	res, data := do(t, "alice", http.MethodPost, path, []byte(content))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d on import; want %d: %s", res.StatusCode, http.StatusOK, data)
+	}
+	imported := []TodoTransport{}
+	helperFromJSON(t, bytes.NewReader(data), &imported)
+	parentID := uint32(0)
+	want := []TodoTransport{
+		{ID: 0, ListID: home.ID, Description: "Buy a gift", Labels: []string{"family"}, DueDate: "2021-03-05T00:00:00Z", CreatedAt: "2021-03-01T10:00:00Z"},
+		{ID: 1, ListID: home.ID, Description: "Wrap it", Done: true, CreatedAt: "2021-03-01T10:00:00Z", CompletedAt: "2021-03-02T18:00:00Z", Position: 1, ParentID: &parentID},
+	}
+	ignore := cmpopts.IgnoreFields(TodoTransport{}, "Version", "UpdatedAt")
+	if diff := cmp.Diff(want, imported, ignore); diff != "" {
+		t.Errorf("imported todos mismatch (-want +got):\n%s", diff)
+	}
+	comments, err := repo.GetComments(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].Body != "Something to read" || comments[0].Author != "alice" {
+		t.Errorf("got comments %+v on the imported todo; want its description by alice", comments)
+	}
+
+	res, _ = do(t, "bob", http.MethodGet, path, nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("got response %d exporting a todo list of another user; want %d", res.StatusCode, http.StatusNotFound)
+	}
+	res, data = do(t, "alice", http.MethodGet, path, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d on export; want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != "text/calendar; charset=utf-8" {
+		t.Errorf("got Content-Type %q; want text/calendar", got)
+	}
+	for _, line := range []string{
+		"X-WR-CALNAME:Home\r\n",
+		"SUMMARY:Buy a gift\r\nDUE;VALUE=DATE:20210305\r\nSTATUS:NEEDS-ACTION\r\nCATEGORIES:family\r\nDESCRIPTION:alice: Something to read\r\n",
+		"STATUS:COMPLETED\r\nCOMPLETED:20210302T180000Z\r\nRELATED-TO;RELTYPE=PARENT:todo-0@todoer\r\n",
+	} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("exported calendar has no %q:\n%s", line, data)
+		}
+	}
+
+	type Step struct {
+		user           string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{user: "alice", method: http.MethodPost, path: path, body: []byte("SUMMARY:Buy a gift"), wantStatusCode: http.StatusBadRequest},
+		{user: "alice", method: http.MethodPut, path: path, body: []byte(content), wantStatusCode: http.StatusMethodNotAllowed},
+		{user: "bob", method: http.MethodPost, path: path, body: []byte(content), wantStatusCode: http.StatusNotFound},
+		{user: "alice", method: http.MethodPost, path: TodoListPath + "/9/calendar.ics", body: []byte(content), wantStatusCode: http.StatusNotFound},
+	}
+
+	for i, step := range steps {
+		res, _ := do(t, step.user, step.method, step.path, step.body)
+		if res.StatusCode != step.wantStatusCode {
+			t.Errorf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{Required: true}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	do := func(t *testing.T, secret, method, path string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, nil)
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(ctx, repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		token := repository.Token{User: name, Hash: repository.HashToken(name + "-secret"), Scopes: []repository.Scope{repository.ScopeWrite}}
+		if _, err := repo.InsertToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aliceCtx := repository.WithActor(ctx, "alice")
+	home, err := repo.InsertTodoList(aliceCtx, repository.TodoList{Title: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	work, err := repo.InsertTodoList(aliceCtx, repository.TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ShareTodoList(ctx, home.ID, repository.Member{User: "bob", Role: repository.RoleEditor}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertTodo(ctx, repository.Todo{ListID: home.ID, Description: "Pay the rent"}); err != nil {
+		t.Fatal(err)
+	}
+	homePath := strings.Replace(TodoListCalendarPath, "{id}", strconv.Itoa(int(home.ID)), 1)
+	workPath := strings.Replace(TodoListCalendarPath, "{id}", strconv.Itoa(int(work.ID)), 1)
+	tokenPath := strings.Replace(TodoListCalendarTokenPath, "{id}", strconv.Itoa(int(home.ID)), 1)
+
+	// Only the owner makes the feed secret
+	res, _ := do(t, "bob-secret", http.MethodPost, tokenPath, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("got response %d creating a feed token as an editor; want %d", res.StatusCode, http.StatusForbidden)
+	}
+	res, data := do(t, "alice-secret", http.MethodPost, tokenPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d creating a feed token; want %d: %s", res.StatusCode, http.StatusOK, data)
+	}
+	feedToken := CalendarTokenTransport{}
+	helperFromJSON(t, bytes.NewReader(data), &feedToken)
+	if want := homePath + "?" + FeedTokenParam + "=" + feedToken.Token; feedToken.URL != want {
+		t.Errorf("got feed URL %q; want %q", feedToken.URL, want)
+	}
+
+	// The feed is read with the secret alone, and only the feed
+	res, data = do(t, "", http.MethodGet, feedToken.URL, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d reading the feed; want %d: %s", res.StatusCode, http.StatusOK, data)
+	}
+	if !strings.Contains(string(data), "SUMMARY:Pay the rent\r\n") {
+		t.Errorf("feed has no todo:\n%s", data)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("feed has no ETag")
+	}
+	for _, path := range []string{
+		workPath + "?" + FeedTokenParam + "=" + feedToken.Token,
+		homePath + "?" + FeedTokenParam + "=wrong",
+		strings.Replace(TodoListIDPath, "{id}", strconv.Itoa(int(home.ID)), 1) + "?" + FeedTokenParam + "=" + feedToken.Token,
+	} {
+		res, _ := do(t, "", http.MethodGet, path, nil)
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("got response %d on GET %s; want %d", res.StatusCode, path, http.StatusUnauthorized)
+		}
+	}
+
+	// Unchanged feeds are not sent again
+	res, data = do(t, "", http.MethodGet, feedToken.URL, http.Header{"If-None-Match": {etag}})
+	if res.StatusCode != http.StatusNotModified || len(data) > 0 {
+		t.Errorf("got response %d with %d bytes reading an unchanged feed; want %d", res.StatusCode, len(data), http.StatusNotModified)
+	}
+	if _, err := repo.InsertComment(aliceCtx, repository.Comment{TodoID: 0, Body: "Before the 5th"}); err != nil {
+		t.Fatal(err)
+	}
+	res, data = do(t, "", http.MethodGet, feedToken.URL, http.Header{"If-None-Match": {etag}})
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(data), "DESCRIPTION:alice: Before the 5th\r\n") {
+		t.Errorf("got response %d reading a changed feed; want %d with the comment:\n%s", res.StatusCode, http.StatusOK, data)
+	}
+
+	// A new secret replaces the old one, and deleting it turns the feed off
+	res, data = do(t, "alice-secret", http.MethodPost, tokenPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d creating a feed token; want %d", res.StatusCode, http.StatusOK)
+	}
+	newFeedToken := CalendarTokenTransport{}
+	helperFromJSON(t, bytes.NewReader(data), &newFeedToken)
+	if res, _ := do(t, "", http.MethodGet, feedToken.URL, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got response %d reading the feed with a replaced secret; want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+	if res, _ := do(t, "", http.MethodGet, newFeedToken.URL, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("got response %d reading the feed with the new secret; want %d", res.StatusCode, http.StatusOK)
+	}
+	if res, _ := do(t, "alice-secret", http.MethodDelete, tokenPath, nil); res.StatusCode != http.StatusOK {
+		t.Errorf("got response %d deleting the feed token; want %d", res.StatusCode, http.StatusOK)
+	}
+	if res, _ := do(t, "", http.MethodGet, newFeedToken.URL, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got response %d reading a deleted feed; want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{Required: true, AdminToken: adminToken}
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	do := func(t *testing.T, secret, method, path string, body []byte) *http.Response {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	createToken := func(t *testing.T, secret string, body []byte) string {
+		t.Helper()
+
+		res := do(t, secret, http.MethodPost, TokenPath, body)
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("creating token %s: got response %d want %d", body, res.StatusCode, http.StatusOK)
+		}
+		token := TokenTransport{}
+		helperFromJSON(t, res.Body, &token)
+		return token.Secret
+	}
+
+	res := do(t, "", http.MethodGet, TodoListPath, nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Fatalf("got response %d with WWW-Authenticate %q without a token; want %d with Bearer", res.StatusCode, res.Header.Get("WWW-Authenticate"), http.StatusUnauthorized)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		res := do(t, adminToken, http.MethodPost, UserPath, []byte(`{"name": "`+name+`"}`))
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("creating user %s: got response %d want %d", name, res.StatusCode, http.StatusOK)
+		}
+	}
+	writer := createToken(t, adminToken, []byte(`{"user": "alice", "name": "laptop", "scopes": ["write"]}`))
+	reader := createToken(t, writer, []byte(`{"name": "dashboard", "scopes": ["read"]}`))
+
+	type Step struct {
+		secret         string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{secret: "wrong", method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+		{secret: reader, method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusForbidden},
+		{secret: writer, method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusNotFound},
+		{secret: writer, method: http.MethodPost, path: UserPath, body: []byte(`{"name": "carol"}`), wantStatusCode: http.StatusForbidden},
+		{secret: writer, method: http.MethodPost, path: TokenPath, body: []byte(`{"scopes": ["admin"]}`), wantStatusCode: http.StatusForbidden},
+		{secret: writer, method: http.MethodPost, path: TokenPath, body: []byte(`{"scopes": []}`), wantStatusCode: http.StatusBadRequest},
+		{secret: writer, method: http.MethodPost, path: TokenPath, body: []byte(`{"user": "bob", "scopes": ["read"]}`), wantStatusCode: http.StatusForbidden},
+		{secret: writer, method: http.MethodGet, path: TokenPath + "?user=bob", wantStatusCode: http.StatusForbidden},
+		{secret: reader, method: http.MethodGet, path: TokenPath, wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodDelete, path: TokenPath + "/1", wantStatusCode: http.StatusForbidden},
+		{secret: writer, method: http.MethodDelete, path: TokenPath + "/1", wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+		{secret: adminToken, method: http.MethodGet, path: TokenPath + "/0", wantStatusCode: http.StatusOK},
+		{secret: adminToken, method: http.MethodDelete, path: TokenPath + "/0", wantStatusCode: http.StatusOK},
+		{secret: writer, method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for i, step := range steps {
+		res := do(t, step.secret, step.method, step.path, step.body)
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+}
+
+func TestTokenListing(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{AdminToken: adminToken}
+	service := api.RegisterRoutes()
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	if _, err := repo.InsertUser(context.Background(), repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := newRequest(t, http.MethodPost, server.URL+TokenPath, []byte(`{"user": "alice", "name": "laptop", "scopes": ["read", "write"]}`))
+	request.Header.Set("Authorization", "Bearer "+adminToken)
+	res, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := TokenTransport{}
+	helperFromJSON(t, res.Body, &created)
+	res.Body.Close()
+
+	if !strings.HasPrefix(created.Secret, "todoer_") {
+		t.Errorf("got secret %q on the created token; want a new one", created.Secret)
+	}
+	stored, err := repo.GetTokenByHash(context.Background(), repository.HashToken(created.Secret))
+	if err != nil {
+		t.Fatalf("got error %v finding the created token by its secret", err)
+	}
+	if stored.ID != created.ID {
+		t.Errorf("got token %d by the secret; want %d", stored.ID, created.ID)
+	}
+
+	request = newRequest(t, http.MethodGet, server.URL+TokenPath, nil)
+	request.Header.Set("Authorization", "Bearer "+created.Secret)
+	res, err = server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	got := []TokenTransport{}
+	helperFromJSON(t, res.Body, &got)
+
+	want := []TokenTransport{{ID: 0, User: "alice", Name: "laptop", Scopes: []string{"read", "write"}}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(TokenTransport{}, "CreatedAt")); diff != "" {
+		t.Errorf("GetTokens mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	secret := []byte("shared-secret")
+	keys := NewKeySet()
+	if err := keys.Add("", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{
+		Required: true,
+		JWT:      &JWTVerifier{Keys: keys, Issuer: "https://sso.example.com", ClockSkew: time.Minute},
+	}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	sign := func(changes map[string]interface{}) string {
+		claims := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://sso.example.com",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			claims[k] = v
+		}
+		return signJWT(t, AlgHS256, "", secret, claims)
+	}
+	writer := sign(nil)
+	reader := sign(map[string]interface{}{"scope": "openid read"})
+
+	type Step struct {
+		secret         string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{secret: writer, method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusOK},
+		{secret: reader, method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusForbidden},
+		{secret: sign(map[string]interface{}{"sub": "bob"}), method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusNotFound},
+		{secret: sign(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+		{secret: sign(map[string]interface{}{"iss": "https://evil.example.com"}), method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+		{secret: signJWT(t, AlgHS256, "", []byte("other-secret"), map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}), method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for i, step := range steps {
+		request := newRequest(t, step.method, server.URL+step.path, step.body)
+		request.Header.Set("Authorization", "Bearer "+step.secret)
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	var gotSubject, gotActor string
+	handler := api.identify(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if claims, ok := ClaimsFromContext(req.Context()); ok {
+			gotSubject = claims.Subject
+		}
+		gotActor = repository.ActorFromContext(req.Context())
+	}))
+	request := httptest.NewRequest(http.MethodGet, TodoListPath, nil)
+	request.Header.Set("Authorization", "Bearer "+reader)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if gotSubject != "alice" || gotActor != "alice" {
+		t.Errorf("got subject %q and actor %q on the request context; want alice", gotSubject, gotActor)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true}
+	api.Limiter = NewRateLimiter(RateLimits{
+		Read:   Limit{Rate: 0.01, Burst: 3},
+		Write:  Limit{Rate: 0.01, Burst: 1},
+		Routes: map[string]Limit{SearchPath: {}},
+	})
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(context.Background(), repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type Step struct {
+		user           string
+		method         string
+		path           string
+		body           []byte
+		wantStatusCode int
+		wantRemaining  string
+	}
+
+	steps := []Step{
+		{user: "alice", method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantRemaining: "0"},
+		{user: "alice", method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusTooManyRequests, wantRemaining: "0"},
+		{user: "alice", method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusOK, wantRemaining: "2"},
+		{user: "alice", method: http.MethodGet, path: TodoListPath + "/0", wantStatusCode: http.StatusOK, wantRemaining: "1"},
+		{user: "alice", method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusOK, wantRemaining: "0"},
+		{user: "alice", method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusTooManyRequests, wantRemaining: "0"},
+		{user: "alice", method: http.MethodGet, path: SearchPath + "?q=todo", wantStatusCode: http.StatusOK},
+		{user: "bob", method: http.MethodGet, path: TodoListPath, wantStatusCode: http.StatusOK, wantRemaining: "2"},
+		{method: http.MethodPost, path: TodoListPath, body: validTodoListRequestBody(t), wantStatusCode: http.StatusOK, wantRemaining: "0"},
+	}
+
+	for i, step := range steps {
+		request := newRequest(t, step.method, server.URL+step.path, step.body)
+		if step.user != "" {
+			request.Header.Set(UserHeader, step.user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: %s %s: got response %d want %d", i, step.method, step.path, res.StatusCode, step.wantStatusCode)
+		}
+		if got := res.Header.Get("RateLimit-Remaining"); got != step.wantRemaining {
+			t.Errorf("step %d: got RateLimit-Remaining %q; want %q", i, got, step.wantRemaining)
+		}
+		if res.StatusCode == http.StatusTooManyRequests {
+			if got := res.Header.Get("Retry-After"); got != "100" {
+				t.Errorf("step %d: got Retry-After %q; want %q", i, got, "100")
+			}
+			if res.Header.Get("RateLimit-Limit") == "" || res.Header.Get("RateLimit-Reset") == "" {
+				t.Errorf("step %d: got no RateLimit-Limit or RateLimit-Reset", i)
+			}
+		}
+	}
+}
+
+func TestRateLimitFeed(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{TrustUserHeader: true}
+	api.Limiter = NewRateLimiter(RateLimits{Read: Limit{Rate: 0.01, Burst: 2}})
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	ctx := context.Background()
+	if _, err := repo.InsertUser(ctx, repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	home, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{Title: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetFeedToken(ctx, home.ID, repository.HashToken("feed-secret")); err != nil {
+		t.Fatal(err)
+	}
+	feedPath := strings.Replace(TodoListCalendarPath, "{id}", strconv.Itoa(int(home.ID)), 1) + "?" + FeedTokenParam + "=feed-secret"
+
+	type Step struct {
+		user           string
+		path           string
+		wantStatusCode int
+		wantRemaining  string
+	}
+
+	// Polling the feed spends a budget of its own, not the one of the
+	// owner it reads as
+	steps := []Step{
+		{path: feedPath, wantStatusCode: http.StatusOK, wantRemaining: "1"},
+		{path: feedPath, wantStatusCode: http.StatusOK, wantRemaining: "0"},
+		{path: feedPath, wantStatusCode: http.StatusTooManyRequests, wantRemaining: "0"},
+		{user: "alice", path: TodoListPath, wantStatusCode: http.StatusOK, wantRemaining: "1"},
+		{user: "alice", path: TodoListPath, wantStatusCode: http.StatusOK, wantRemaining: "0"},
+	}
+
+	for i, step := range steps {
+		request := newRequest(t, http.MethodGet, server.URL+step.path, nil)
+		if step.user != "" {
+			request.Header.Set(UserHeader, step.user)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: GET %s: got response %d want %d", i, step.path, res.StatusCode, step.wantStatusCode)
+		}
+		if got := res.Header.Get("RateLimit-Remaining"); got != step.wantRemaining {
+			t.Errorf("step %d: got RateLimit-Remaining %q; want %q", i, got, step.wantRemaining)
+		}
+	}
+}
+
+func TestRateLimitUnverified(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{Required: true}
+	api.Limiter = NewRateLimiter(RateLimits{Read: Limit{Rate: 0.01, Burst: 2}})
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	if _, err := repo.InsertUser(context.Background(), repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	token := repository.Token{User: "alice", Hash: repository.HashToken("alice-secret"), Scopes: []repository.Scope{repository.ScopeRead}}
+	if _, err := repo.InsertToken(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+
+	type Step struct {
+		secret         string
+		wantStatusCode int
+	}
+
+	// Authenticated requests only count against their token, and the
+	// failing ones against their IP address, until it is refused before
+	// authenticating
+	steps := []Step{
+		{secret: "alice-secret", wantStatusCode: http.StatusOK},
+		{secret: "alice-secret", wantStatusCode: http.StatusOK},
+		{secret: "wrong", wantStatusCode: http.StatusUnauthorized},
+		{wantStatusCode: http.StatusUnauthorized},
+		{secret: "wrong", wantStatusCode: http.StatusTooManyRequests},
+		{secret: "alice-secret", wantStatusCode: http.StatusTooManyRequests},
+	}
+
+	for i, step := range steps {
+		request := newRequest(t, http.MethodGet, server.URL+TodoListPath, nil)
+		if step.secret != "" {
+			request.Header.Set("Authorization", "Bearer "+step.secret)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: got response %d want %d", i, res.StatusCode, step.wantStatusCode)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	newServer := func(t *testing.T) (*repository.LocalStorage, *httptest.Server) {
+		t.Helper()
+
+		repo := repository.NewLocalStorage()
+		api := NewApi(repo, nil)
+		api.Auth = AuthOptions{AdminToken: adminToken}
+		server := httptest.NewServer(api.RegisterRoutes())
+		t.Cleanup(server.Close)
+		return repo, server
+	}
+	do := func(t *testing.T, server *httptest.Server, secret, method, path string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+
+		request := newRequest(t, method, server.URL+path, body)
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+		res, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	source, sourceServer := newServer(t)
+	routine, err := source.InsertTodoList(context.Background(), repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.InsertTodo(context.Background(), repository.Todo{ListID: routine.ID, Description: "Make the bed"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.InsertUser(context.Background(), repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, _ := do(t, sourceServer, "", http.MethodPost, AdminBackupPath, nil); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got response %d on POST %s; want %d", res.StatusCode, AdminBackupPath, http.StatusMethodNotAllowed)
+	}
+	res, backup := do(t, sourceServer, adminToken, http.MethodGet, AdminBackupPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got response %d on backup; want %d", res.StatusCode, http.StatusOK)
+	}
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+	if got := res.Header.Get("Content-Disposition"); !strings.HasPrefix(got, "attachment; filename=todoer-") {
+		t.Errorf("got Content-Disposition %q; want an attachment named todoer-*", got)
+	}
+
+	target, targetServer := newServer(t)
+	if _, err := target.InsertTodoList(context.Background(), repository.TodoList{Title: "Replaced"}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Step struct {
+		secret         string
+		path           string
+		body           []byte
+		wantStatusCode int
+	}
+
+	steps := []Step{
+		{path: AdminRestorePath + "?mode=replace", body: backup, wantStatusCode: http.StatusForbidden},
+		{secret: adminToken, path: AdminRestorePath, body: []byte(`{"version": 99}`), wantStatusCode: http.StatusBadRequest},
+		{secret: adminToken, path: AdminRestorePath, body: []byte(`not json`), wantStatusCode: http.StatusBadRequest},
+		{secret: adminToken, path: AdminRestorePath + "?mode=append", body: backup, wantStatusCode: http.StatusBadRequest},
+		{secret: adminToken, path: AdminRestorePath + "?mode=replace", body: backup, wantStatusCode: http.StatusOK},
+	}
+
+	for i, step := range steps {
+		res, _ := do(t, targetServer, step.secret, http.MethodPost, step.path, step.body)
+		if res.StatusCode != step.wantStatusCode {
+			t.Fatalf("step %d: POST %s: got response %d want %d", i, step.path, res.StatusCode, step.wantStatusCode)
+		}
+	}
+
+	want, err := source.GetAllTodoLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := target.GetAllTodoLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("restored todo lists mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := target.GetUser(context.Background(), "alice"); err != nil {
+		t.Errorf("restored user: %v", err)
+	}
+}
+
+func TestBackupTakesAdminScope(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	api.Auth = AuthOptions{Required: true}
+	server := httptest.NewServer(api.RegisterRoutes())
+	defer server.Close()
+
+	if _, err := repo.InsertUser(context.Background(), repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	secrets := map[repository.Scope]string{}
+	for _, scope := range []repository.Scope{repository.ScopeRead, repository.ScopeWrite, repository.ScopeAdmin} {
+		secret, err := repository.NewTokenSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertToken(context.Background(), repository.Token{User: "alice", Scopes: []repository.Scope{scope}, Hash: repository.HashToken(secret)}); err != nil {
+			t.Fatal(err)
+		}
+		secrets[scope] = secret
+	}
+
+	type Test struct {
+		scope          repository.Scope
+		method         string
+		path           string
+		wantStatusCode int
+	}
+
+	tests := []Test{
+		{scope: repository.ScopeRead, method: http.MethodGet, path: AdminBackupPath, wantStatusCode: http.StatusForbidden},
+		{scope: repository.ScopeWrite, method: http.MethodGet, path: AdminBackupPath, wantStatusCode: http.StatusForbidden},
+		{scope: repository.ScopeAdmin, method: http.MethodGet, path: AdminBackupPath, wantStatusCode: http.StatusOK},
+		{scope: repository.ScopeRead, method: http.MethodPost, path: AdminRestorePath, wantStatusCode: http.StatusForbidden},
+		{scope: repository.ScopeWrite, method: http.MethodPost, path: AdminRestorePath, wantStatusCode: http.StatusForbidden},
+		{method: http.MethodGet, path: AdminBackupPath, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.scope)+test.path, func(t *testing.T) {
+			request := newRequest(t, test.method, server.URL+test.path, []byte(`{"version": 1}`))
+			request.Header.Set("Authorization", "Bearer "+secrets[test.scope])
+			res, err := server.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != test.wantStatusCode {
+				t.Errorf("got response %d want %d", res.StatusCode, test.wantStatusCode)
+			}
+		})
+	}
+
+	// Without required authentication or an admin token there is no
+	// backing up at all
+	openApi := NewApi(repo, nil)
+	open := httptest.NewServer(openApi.RegisterRoutes())
+	defer open.Close()
+	for _, path := range []string{AdminBackupPath, AdminRestorePath} {
+		method := http.MethodGet
+		if path == AdminRestorePath {
+			method = http.MethodPost
+		}
+		res, err := open.Client().Do(newRequest(t, method, open.URL+path, []byte(`{"version": 1}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusForbidden || !strings.Contains(string(data), ErrBackupsDisabled.Error()) {
+			t.Errorf("got response %d on %s %s with backups disabled; want %d: %s", res.StatusCode, method, path, http.StatusForbidden, data)
+		}
+	}
+}
+
+func TestRequestContextReachesRepository(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	api := NewApi(repo, nil)
+	service := api.RegisterRoutes()
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	request := newRequest(t, http.MethodPost, TodoListPath, validTodoListRequestBody(t)).WithContext(reqCtx)
+	recorder := httptest.NewRecorder()
+	service.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("got response %d want %d", recorder.Code, http.StatusInternalServerError)
+	}
+
+	todoLists, err := repo.GetAllTodoLists(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todoLists) != 0 {
+		t.Errorf("got %d todo lists; want none created by a canceled request", len(todoLists))
+	}
+}
+
+type FakeStorage struct {
+	FakeTodoList        repository.TodoList
+	FakeTodoListSlice   []repository.TodoList
+	FakeTodo            repository.Todo
+	FakeTodoSlice       []repository.Todo
+	FakeTrash           repository.Trash
+	FakePurged          int
+	FakeHistory         []repository.HistoryEntry
+	FakeLabel           repository.Label
+	FakeLabelSlice      []repository.Label
+	FakeSearchHits      []repository.SearchHit
+	FakeComment         repository.Comment
+	FakeCommentSlice    []repository.Comment
+	FakeAttachment      repository.Attachment
+	FakeAttachmentSlice []repository.Attachment
+	FakeUser            repository.User
+	FakeUserSlice       []repository.User
+	FakeToken           repository.Token
+	FakeTokenSlice      []repository.Token
+	FakeBackup          repository.Backup
+	FakeError           error
+}
+
+func NewFakeStorage() *FakeStorage {
+	return &FakeStorage{
+		FakeTodoList:        repository.TodoList{},
+		FakeTodoListSlice:   []repository.TodoList{},
+		FakeTodo:            repository.Todo{},
+		FakeTodoSlice:       []repository.Todo{},
+		FakeTrash:           repository.Trash{},
+		FakePurged:          0,
+		FakeHistory:         []repository.HistoryEntry{},
+		FakeLabel:           repository.Label{},
+		FakeLabelSlice:      []repository.Label{},
+		FakeSearchHits:      []repository.SearchHit{},
+		FakeComment:         repository.Comment{},
+		FakeCommentSlice:    []repository.Comment{},
+		FakeAttachment:      repository.Attachment{},
+		FakeAttachmentSlice: []repository.Attachment{},
+		FakeUser:            repository.User{},
+		FakeUserSlice:       []repository.User{},
+		FakeToken:           repository.Token{},
+		FakeTokenSlice:      []repository.Token{},
+		FakeBackup:          repository.Backup{},
+		FakeError:           nil,
+	}
+}
+
+func (fs *FakeStorage) InsertTodoList(ctx context.Context, todoList repository.TodoList) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) GetAllTodoLists(ctx context.Context) ([]repository.TodoList, error) {
+	return fs.FakeTodoListSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetTodoListByID(ctx context.Context, id uint32) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) UpdateTodoList(ctx context.Context, todoList repository.TodoList) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) DeleteTodoListByID(ctx context.Context, id uint32, opts repository.DeleteTodoListOptions) error {
+	return fs.FakeError
+}
+
+func (fs *FakeStorage) InsertTodo(ctx context.Context, todo repository.Todo) (*repository.Todo, error) {
+	return &fs.FakeTodo, fs.FakeError
+}
+func (fs *FakeStorage) GetTodoByID(ctx context.Context, id uint32) (*repository.Todo, error) {
 	return &fs.FakeTodo, fs.FakeError
 }
-func (fs *FakeStorage) GetTodoByID(id uint32) (*repository.Todo, error) {
+func (fs *FakeStorage) GetTodosByListID(ctx context.Context, listID uint32) ([]repository.Todo, error) {
+	return fs.FakeTodoSlice, fs.FakeError
+}
+func (fs *FakeStorage) QueryTodos(ctx context.Context, query repository.TodoQuery) (*repository.TodoPage, error) {
+	return &repository.TodoPage{Todos: fs.FakeTodoSlice}, fs.FakeError
+}
+func (fs *FakeStorage) UpdateTodo(ctx context.Context, todo repository.Todo) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) MoveTodo(ctx context.Context, id uint32, opts repository.MoveTodoOptions) (*repository.Todo, error) {
 	return &fs.FakeTodo, fs.FakeError
 }
-func (fs *FakeStorage) GetTodosByListID(listID uint32) ([]repository.Todo, error) {
+func (fs *FakeStorage) DeleteTodo(ctx context.Context, todo repository.Todo) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) AddDependency(ctx context.Context, id, blockerID uint32) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) RemoveDependency(ctx context.Context, id, blockerID uint32) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) GetBlockers(ctx context.Context, id uint32) ([]repository.Todo, error) {
 	return fs.FakeTodoSlice, fs.FakeError
 }
-func (fs *FakeStorage) UpdateTodo(todo repository.Todo) error {
+func (fs *FakeStorage) InsertLabel(ctx context.Context, label repository.Label) (*repository.Label, error) {
+	return &fs.FakeLabel, fs.FakeError
+}
+func (fs *FakeStorage) GetAllLabels(ctx context.Context) ([]repository.Label, error) {
+	return fs.FakeLabelSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetLabel(ctx context.Context, name string) (*repository.Label, error) {
+	return &fs.FakeLabel, fs.FakeError
+}
+func (fs *FakeStorage) UpdateLabel(ctx context.Context, label repository.Label) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) RenameLabel(ctx context.Context, name, newName string) (*repository.Label, error) {
+	return &fs.FakeLabel, fs.FakeError
+}
+func (fs *FakeStorage) DeleteLabel(ctx context.Context, name string) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) InsertComment(ctx context.Context, comment repository.Comment) (*repository.Comment, error) {
+	return &fs.FakeComment, fs.FakeError
+}
+func (fs *FakeStorage) GetComments(ctx context.Context, todoID uint32) ([]repository.Comment, error) {
+	return fs.FakeCommentSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetComment(ctx context.Context, id uint32) (*repository.Comment, error) {
+	return &fs.FakeComment, fs.FakeError
+}
+func (fs *FakeStorage) UpdateComment(ctx context.Context, comment repository.Comment) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) DeleteComment(ctx context.Context, comment repository.Comment) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) InsertAttachment(ctx context.Context, attachment repository.Attachment) (*repository.Attachment, error) {
+	return &fs.FakeAttachment, fs.FakeError
+}
+func (fs *FakeStorage) GetAttachments(ctx context.Context, todoID uint32) ([]repository.Attachment, error) {
+	return fs.FakeAttachmentSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetAttachment(ctx context.Context, id uint32) (*repository.Attachment, error) {
+	return &fs.FakeAttachment, fs.FakeError
+}
+func (fs *FakeStorage) DeleteAttachment(ctx context.Context, id uint32) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) GetAttachmentHashes(ctx context.Context) ([]string, error) {
+	return []string{}, fs.FakeError
+}
+func (fs *FakeStorage) Search(ctx context.Context, query repository.SearchQuery) ([]repository.SearchHit, error) {
+	return fs.FakeSearchHits, fs.FakeError
+}
+func (fs *FakeStorage) GetTrash(ctx context.Context) (*repository.Trash, error) {
+	return &fs.FakeTrash, fs.FakeError
+}
+func (fs *FakeStorage) RestoreTodoList(ctx context.Context, id uint32) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) RestoreTodo(ctx context.Context, id uint32) (*repository.Todo, error) {
+	return &fs.FakeTodo, fs.FakeError
+}
+func (fs *FakeStorage) PurgeTodoList(ctx context.Context, id uint32) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) PurgeTodo(ctx context.Context, id uint32) error {
 	return fs.FakeError
 }
-func (fs *FakeStorage) DeleteTodo(todo repository.Todo) error {
+func (fs *FakeStorage) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return fs.FakePurged, fs.FakeError
+}
+func (fs *FakeStorage) GetTodoListHistory(ctx context.Context, id uint32) ([]repository.HistoryEntry, error) {
+	return fs.FakeHistory, fs.FakeError
+}
+func (fs *FakeStorage) GetTodoHistory(ctx context.Context, id uint32) ([]repository.HistoryEntry, error) {
+	return fs.FakeHistory, fs.FakeError
+}
+func (fs *FakeStorage) InsertUser(ctx context.Context, user repository.User) (*repository.User, error) {
+	return &fs.FakeUser, fs.FakeError
+}
+func (fs *FakeStorage) GetAllUsers(ctx context.Context) ([]repository.User, error) {
+	return fs.FakeUserSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetUser(ctx context.Context, name string) (*repository.User, error) {
+	return &fs.FakeUser, fs.FakeError
+}
+func (fs *FakeStorage) ShareTodoList(ctx context.Context, id uint32, member repository.Member) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) UnshareTodoList(ctx context.Context, id uint32, user string) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) SetFeedToken(ctx context.Context, id uint32, hash string) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) GetTodoListByFeedToken(ctx context.Context, hash string) (*repository.TodoList, error) {
+	return &fs.FakeTodoList, fs.FakeError
+}
+func (fs *FakeStorage) InsertToken(ctx context.Context, token repository.Token) (*repository.Token, error) {
+	return &fs.FakeToken, fs.FakeError
+}
+func (fs *FakeStorage) GetTokens(ctx context.Context, user string) ([]repository.Token, error) {
+	return fs.FakeTokenSlice, fs.FakeError
+}
+func (fs *FakeStorage) GetToken(ctx context.Context, id uint32) (*repository.Token, error) {
+	return &fs.FakeToken, fs.FakeError
+}
+func (fs *FakeStorage) GetTokenByHash(ctx context.Context, hash string) (*repository.Token, error) {
+	return &fs.FakeToken, fs.FakeError
+}
+func (fs *FakeStorage) DeleteToken(ctx context.Context, id uint32) error {
+	return fs.FakeError
+}
+func (fs *FakeStorage) Backup(ctx context.Context) (*repository.Backup, error) {
+	return &fs.FakeBackup, fs.FakeError
+}
+func (fs *FakeStorage) Restore(ctx context.Context, backup repository.Backup, mode repository.RestoreMode) error {
 	return fs.FakeError
 }
 
@@ -1139,6 +4977,26 @@ func helperToJSON(t *testing.T, v interface{}) []byte {
 	return j
 }
 
+// helperMultipart returns the content type and body of a form uploading
+// content as fileName on field.
+func helperMultipart(t *testing.T, field, fileName string, content []byte) (string, []byte) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(field, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writer.FormDataContentType(), body.Bytes()
+}
+
 func newRequest(t *testing.T, method string, url string, body []byte) *http.Request {
 	t.Helper()
 
@@ -1158,7 +5016,6 @@ func validTodoListRequestBody(t *testing.T) []byte {
 func validTodoRequestBody(t *testing.T) []byte {
 	return helperToJSON(t, TodoTransport{
 		Description: "Make the bed",
-		Comments:    "really hard",
 		DueDate:     "2021-02-04T00:00:00Z",
 		Labels:      []string{"bed", "bedroom"},
 		Done:        true,
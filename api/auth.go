@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request has no valid token, or
+	// names a user that doesn't exist.
+	ErrUnauthenticated = errors.New("request is not authenticated")
+	// ErrInsufficientScope is returned when the scopes of the token of a
+	// request don't allow what was asked.
+	ErrInsufficientScope = errors.New("token scope does not allow it")
+	// ErrBackupsDisabled is returned on backups and restores when neither
+	// tokens are required nor an admin token is accepted.
+	ErrBackupsDisabled = errors.New("backups are disabled without required authentication or an admin token")
+)
+
+// AuthOptions decides how requests are authenticated. The zero value lets
+// anonymous requests in, allowed to read and write but never the admin
+// scope.
+type AuthOptions struct {
+	// Required refuses requests without a token.
+	Required bool
+	// TrustUserHeader lets requests without a token name their user on
+	// UserHeader, or the UserMetadata over gRPC, which is only safe behind
+	// a proxy authenticating users and setting it. Otherwise requests
+	// naming their user without a token are refused.
+	TrustUserHeader bool
+	// AdminToken is a secret accepted as the token of anonymous requests
+	// with the admin scope, to create the first users and their tokens.
+	// Empty accepts no such secret.
+	AdminToken string
+	// JWT verifies bearer tokens shaped like JWTs, whose subject makes the
+	// request. Nil accepts no JWTs.
+	JWT *JWTVerifier
+}
+
+type scopesKey struct{}
+
+// withScopes returns a copy of ctx limited to the given scopes.
+func withScopes(ctx context.Context, scopes []repository.Scope) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// allowed tells if the token behind ctx allows scope. Requests without a
+// token are allowed to read and write, but the admin scope must always be
+// granted by a token.
+func allowed(ctx context.Context, scope repository.Scope) bool {
+	scopes, ok := ctx.Value(scopesKey{}).([]repository.Scope)
+	if !ok {
+		return repository.ScopeWrite.Includes(scope)
+	}
+	return repository.Token{Scopes: scopes}.Allows(scope)
+}
+
+// granted tells if the token behind ctx grants scope. Unlike allowed, it is
+// always false for requests without a token.
+func granted(ctx context.Context, scope repository.Scope) bool {
+	scopes, ok := ctx.Value(scopesKey{}).([]repository.Scope)
+	return ok && repository.Token{Scopes: scopes}.Allows(scope)
+}
+
+// allowBackups tells, by returning nil, if ctx may back up and restore
+// everything: only when opts always authenticates requests, or accepts an
+// admin token, and the token of ctx has the admin scope.
+func allowBackups(ctx context.Context, opts AuthOptions) error {
+	if !opts.Required && opts.AdminToken == "" {
+		return ErrBackupsDisabled
+	}
+	if !granted(ctx, repository.ScopeAdmin) {
+		return ErrInsufficientScope
+	}
+	return nil
+}
+
+// authenticate returns ctx carrying the user making a request and the
+// scopes it is limited to, given the secret of its bearer token and the
+// user it names, each empty when missing. A token takes precedence over the
+// named user, which is ignored. The token is either an API token or, when
+// opts accepts them, a JWT.
+func authenticate(ctx context.Context, repo repository.Repository, opts AuthOptions, secret, user string) (context.Context, error) {
+	if secret != "" {
+		if opts.AdminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(opts.AdminToken)) == 1 {
+			return withScopes(ctx, []repository.Scope{repository.ScopeAdmin}), nil
+		}
+
+		if opts.JWT != nil && isJWT(secret) {
+			claims, err := opts.JWT.Verify(secret)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+			}
+			ctx = withClaims(ctx, claims)
+			return withScopes(repository.WithActor(ctx, claims.Subject), claims.Scopes()), nil
+		}
+
+		token, err := repo.GetTokenByHash(ctx, repository.HashToken(secret))
+		if err != nil {
+			if errors.Is(err, repository.ErrTokenNotFound) {
+				return nil, fmt.Errorf("%w: token is invalid", ErrUnauthenticated)
+			}
+			return nil, err
+		}
+		return withScopes(repository.WithActor(ctx, token.User), token.Scopes), nil
+	}
+
+	if opts.Required {
+		return nil, fmt.Errorf("%w: a bearer token is required", ErrUnauthenticated)
+	}
+	if user == "" {
+		return ctx, nil
+	}
+	if !opts.TrustUserHeader {
+		return nil, fmt.Errorf("%w: a bearer token is required to name a user", ErrUnauthenticated)
+	}
+
+	if _, err := repo.GetUser(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		return nil, err
+	}
+	return repository.WithActor(ctx, user), nil
+}
+
+// authenticateFeed returns ctx reading the calendar feed of the todo list
+// with the given ID, given the secret of the feed. The feed is read as the
+// owner of the todo list, limited to the read scope.
+func authenticateFeed(ctx context.Context, repo repository.Repository, secret, id string) (context.Context, error) {
+	todoList, err := repo.GetTodoListByFeedToken(ctx, repository.HashToken(secret))
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			return nil, fmt.Errorf("%w: feed token is invalid", ErrUnauthenticated)
+		}
+		return nil, err
+	}
+	// A secret only reads the feed it was made for
+	if strconv.FormatUint(uint64(todoList.ID), 10) != id {
+		return nil, fmt.Errorf("%w: feed token is invalid", ErrUnauthenticated)
+	}
+	return withScopes(repository.WithActor(ctx, todoList.Owner), []repository.Scope{repository.ScopeRead}), nil
+}
+
+// bearerToken returns the secret on an Authorization header value, or an
+// empty string when it holds none.
+func bearerToken(authorization string) string {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(prefix):])
+}
@@ -1,24 +1,84 @@
 package api
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 
 	"github.com/vitorarins/todoer/pb"
 	"github.com/vitorarins/todoer/repository"
 )
 
+// attachmentChunkSize is the most content sent on each message of a
+// download or a backup.
+const attachmentChunkSize = 64 << 10
+
+// UserMetadata is the metadata key naming the user making a call, the gRPC
+// counterpart of UserHeader.
+const UserMetadata = "x-user"
+
+// AuthorizationMetadata is the metadata key carrying the bearer token of a
+// call.
+const AuthorizationMetadata = "authorization"
+
+// readMethods are the RPCs taking the read scope. Any other takes the write
+// scope.
+var readMethods = map[string]bool{
+	"GetAllTodoLists":    true,
+	"GetTodoList":        true,
+	"GetTodoListHistory": true,
+	"GetTodosByList":     true,
+	"QueryTodos":         true,
+	"GetTodo":            true,
+	"GetTodoHistory":     true,
+	"GetBlockers":        true,
+	"ExportTodoTxt":      true,
+	"ExportCalendar":     true,
+	"GetAllUsers":        true,
+	"GetUser":            true,
+	"GetTokens":          true,
+	"GetToken":           true,
+	"GetAllLabels":       true,
+	"GetLabel":           true,
+	"GetComments":        true,
+	"GetComment":         true,
+	"GetAttachments":     true,
+	"GetAttachment":      true,
+	"DownloadAttachment": true,
+	"Search":             true,
+	"GetTrash":           true,
+	"Backup":             true,
+}
+
 type GrpcApi struct {
-	repo repository.Repository
+	repo  repository.Repository
+	blobs *repository.BlobStore
+	// Auth decides how calls are authenticated by IdentifyUnary and
+	// IdentifyStream.
+	Auth AuthOptions
+	// Limiter limits how many calls each client makes, by RateLimitUnary
+	// and RateLimitStream. Nil limits nothing.
+	Limiter *RateLimiter
 	pb.UnimplementedTodoerServer
 }
 
-func NewGrpcApi(repo repository.Repository) *GrpcApi {
+// NewGrpcApi serves repo, keeping the content of attachments on blobs.
+func NewGrpcApi(repo repository.Repository, blobs *repository.BlobStore) *GrpcApi {
 	return &GrpcApi{
-		repo: repo,
+		repo:  accessControl{repo},
+		blobs: blobs,
 	}
 }
 
@@ -29,14 +89,13 @@ func (ga *GrpcApi) CreateTodoList(ctx context.Context, req *pb.CreateTodoListReq
 		Title: req.Title,
 	}
 
-	newTodoList, err := ga.repo.InsertTodoList(todoListReq)
+	newTodoList, err := ga.repo.InsertTodoList(ctx, todoListReq)
 	if err != nil {
 		if errors.Is(err, repository.ErrEmptyTitle) {
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		return nil, internalError(logger, err)
 	}
 
 	reply := &pb.CreateTodoListReply{
@@ -48,10 +107,9 @@ func (ga *GrpcApi) CreateTodoList(ctx context.Context, req *pb.CreateTodoListReq
 func (ga *GrpcApi) GetAllTodoLists(ctx context.Context, req *pb.Empty) (*pb.GetAllTodoListsReply, error) {
 	logger := log.WithFields(log.Fields{"action": "GetAllTodoLists"})
 
-	todoLists, err := ga.repo.GetAllTodoLists()
+	todoLists, err := ga.repo.GetAllTodoLists(ctx)
 	if err != nil {
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		return nil, internalError(logger, err)
 	}
 
 	todoListsReply := []*pb.TodoList{}
@@ -69,14 +127,13 @@ func (ga *GrpcApi) GetAllTodoLists(ctx context.Context, req *pb.Empty) (*pb.GetA
 func (ga *GrpcApi) GetTodoList(ctx context.Context, req *pb.GetTodoListRequest) (*pb.GetTodoListReply, error) {
 	logger := log.WithFields(log.Fields{"action": "GetTodoList"})
 
-	todoList, err := ga.repo.GetTodoListByID(req.Id)
+	todoList, err := ga.repo.GetTodoListByID(ctx, req.Id)
 	if err != nil {
 		if errors.Is(err, repository.ErrTodoListNotFound) {
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		return nil, internalError(logger, err)
 	}
 
 	todoListReply := toProtoTodoList(*todoList)
@@ -92,16 +149,23 @@ func (ga *GrpcApi) UpdateTodoList(ctx context.Context, req *pb.UpdateTodoListReq
 
 	todoListReq := fromProtoTodoList(req.TodoList)
 
-	err := ga.repo.UpdateTodoList(todoListReq)
+	err := ga.repo.UpdateTodoList(ctx, todoListReq)
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
 		if errors.Is(err, repository.ErrEmptyTitle) ||
 			errors.Is(err, repository.ErrTodoListNotFound) {
 
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
 	return &pb.Empty{}, nil
@@ -110,31 +174,142 @@ func (ga *GrpcApi) UpdateTodoList(ctx context.Context, req *pb.UpdateTodoListReq
 func (ga *GrpcApi) DeleteTodoList(ctx context.Context, req *pb.DeleteTodoListRequest) (*pb.Empty, error) {
 	logger := log.WithFields(log.Fields{"action": "DeleteTodoList"})
 
-	err := ga.repo.DeleteTodoListByID(req.Id)
+	opts := repository.DeleteTodoListOptions{
+		TargetListID: req.TargetListId,
+		Version:      req.Version,
+	}
+	switch req.Policy {
+	case pb.DeletePolicy_DELETE_POLICY_CASCADE:
+		opts.Policy = repository.DeleteCascade
+	case pb.DeletePolicy_DELETE_POLICY_RESTRICT:
+		opts.Policy = repository.DeleteRestrict
+	case pb.DeletePolicy_DELETE_POLICY_MOVE:
+		opts.Policy = repository.DeleteMove
+	default:
+		err := fmt.Errorf("%w: %v", repository.ErrInvalidPolicy, req.Policy)
+		logger.WithError(err).Warning("bad request error")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err := ga.repo.DeleteTodoListByID(ctx, req.Id, opts)
 	if err != nil {
-		if errors.Is(err, repository.ErrTodoListNotFound) {
+		if errors.Is(err, repository.ErrInvalidPolicy) ||
+			errors.Is(err, repository.ErrInvalidTarget) {
+
 			logger.WithError(err).Warning("bad request error")
-			return nil, err
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoListNotEmpty) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
 	return &pb.Empty{}, nil
 }
 
+// Sharing
+
+func (ga *GrpcApi) ShareTodoList(ctx context.Context, req *pb.ShareTodoListRequest) (*pb.ShareTodoListReply, error) {
+	logger := log.WithFields(log.Fields{"action": "ShareTodoList"})
+
+	member := repository.Member{
+		User: req.GetMember().GetUser(),
+		Role: repository.Role(req.GetMember().GetRole()),
+	}
+
+	todoList, err := ga.repo.ShareTodoList(ctx, req.Id, member)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) ||
+			errors.Is(err, repository.ErrInvalidRole) ||
+			errors.Is(err, repository.ErrOwnerMember) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.ShareTodoListReply{
+		TodoList: toProtoTodoList(*todoList),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) UnshareTodoList(ctx context.Context, req *pb.UnshareTodoListRequest) (*pb.UnshareTodoListReply, error) {
+	logger := log.WithFields(log.Fields{"action": "UnshareTodoList"})
+
+	todoList, err := ga.repo.UnshareTodoList(ctx, req.Id, req.User)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) ||
+			errors.Is(err, repository.ErrNotMember) {
+
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.UnshareTodoListReply{
+		TodoList: toProtoTodoList(*todoList),
+	}
+	return reply, nil
+}
+
 // Todo
 
+func (ga *GrpcApi) GetTodoListHistory(ctx context.Context, req *pb.GetTodoListHistoryRequest) (*pb.GetHistoryReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetTodoListHistory"})
+
+	history, err := ga.repo.GetTodoListHistory(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return toProtoHistory(history), nil
+}
+
 func (ga *GrpcApi) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*pb.CreateTodoReply, error) {
 	logger := log.WithFields(log.Fields{"action": "CreateTodo"})
 
 	todoReq := repository.Todo{
 		ListID:      req.ListId,
 		Description: req.Description,
-		Comments:    req.Comments,
 		Labels:      req.Labels,
 		Done:        req.Done,
 	}
+	if req.HasParent {
+		todoReq.ParentID = &req.ParentId
+	}
 
 	if req.DueDate != "" {
 		dueDate, err := time.Parse(time.RFC3339, req.DueDate)
@@ -144,16 +319,35 @@ func (ga *GrpcApi) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*
 		todoReq.DueDate = dueDate
 	}
 
-	newTodo, err := ga.repo.InsertTodo(todoReq)
+	if req.Recurrence != "" {
+		recurrence, err := repository.ParseRecurrence(req.Recurrence)
+		if err != nil {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		todoReq.Recurrence = recurrence
+	}
+
+	newTodo, err := ga.repo.InsertTodo(ctx, todoReq)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidParent) ||
+			errors.Is(err, repository.ErrInvalidRecurrence) ||
+			errors.Is(err, repository.ErrUnknownLabel) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		if errors.Is(err, repository.ErrEmptyDescription) ||
 			errors.Is(err, repository.ErrTodoListNotFound) {
 
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
 	reply := &pb.CreateTodoReply{
@@ -165,14 +359,20 @@ func (ga *GrpcApi) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*
 func (ga *GrpcApi) GetTodosByList(ctx context.Context, req *pb.GetTodosByListRequest) (*pb.GetTodosByListReply, error) {
 	logger := log.WithFields(log.Fields{"action": "GetTodosByList"})
 
-	todos, err := ga.repo.GetTodosByListID(req.ListId)
+	todos, err := ga.repo.GetTodosByListID(ctx, req.ListId)
 	if err != nil {
 		if errors.Is(err, repository.ErrTodoListNotFound) {
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		return nil, internalError(logger, err)
+	}
+
+	if req.Tree {
+		reply := &pb.GetTodosByListReply{
+			Tree: toProtoTodoTree(repository.NewTodoTree(todos)),
+		}
+		return reply, nil
 	}
 
 	todosReply := []*pb.Todo{}
@@ -187,13 +387,52 @@ func (ga *GrpcApi) GetTodosByList(ctx context.Context, req *pb.GetTodosByListReq
 	return reply, nil
 }
 
+func (ga *GrpcApi) QueryTodos(ctx context.Context, req *pb.QueryTodosRequest) (*pb.QueryTodosReply, error) {
+	logger := log.WithFields(log.Fields{"action": "QueryTodos"})
+
+	query, err := fromProtoTodoQuery(req)
+	if err != nil {
+		logger.WithError(err).Warning("bad request error")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	page, err := ga.repo.QueryTodos(ctx, query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidQuery) ||
+			errors.Is(err, repository.ErrInvalidCursor) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	todosReply := []*pb.Todo{}
+	for _, t := range page.Todos {
+		todosReply = append(todosReply, toProtoTodo(t))
+	}
+
+	reply := &pb.QueryTodosReply{
+		Todos:      todosReply,
+		NextCursor: page.NextCursor,
+	}
+	return reply, nil
+}
+
 func (ga *GrpcApi) GetTodo(ctx context.Context, req *pb.GetTodoRequest) (*pb.GetTodoReply, error) {
 	logger := log.WithFields(log.Fields{"action": "GetTodo"})
 
-	todo, err := ga.repo.GetTodoByID(req.Id)
+	todo, err := ga.repo.GetTodoByID(ctx, req.Id)
 	if err != nil {
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, err
+		}
+		return nil, internalError(logger, err)
 	}
 
 	todoReply := toProtoTodo(*todo)
@@ -209,93 +448,1761 @@ func (ga *GrpcApi) UpdateTodo(ctx context.Context, req *pb.UpdateTodoRequest) (*
 
 	todoReq, err := fromProtoTodo(req.Todo)
 	if err != nil {
+		if errors.Is(err, repository.ErrInvalidRecurrence) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, err
 	}
 
-	err = ga.repo.UpdateTodo(todoReq)
+	if req.Force {
+		ctx = repository.WithForce(ctx)
+	}
+
+	err = ga.repo.UpdateTodo(ctx, todoReq)
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, repository.ErrBlocked) {
+			logger.WithError(err).Warning("failed precondition error")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, repository.ErrInvalidParent) ||
+			errors.Is(err, repository.ErrInvalidRecurrence) ||
+			errors.Is(err, repository.ErrUnknownLabel) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		if errors.Is(err, repository.ErrEmptyDescription) ||
-			errors.Is(err, repository.ErrTodoNotFound) {
+			errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrTodoListNotFound) {
 
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
 	return &pb.Empty{}, nil
 }
 
+func (ga *GrpcApi) MoveTodo(ctx context.Context, req *pb.MoveTodoRequest) (*pb.MoveTodoReply, error) {
+	logger := log.WithFields(log.Fields{"action": "MoveTodo"})
+
+	opts := repository.MoveTodoOptions{
+		ListID:  req.ListId,
+		Version: req.Version,
+	}
+	if req.Before {
+		opts.BeforeID = &req.BeforeId
+	}
+
+	todo, err := ga.repo.MoveTodo(ctx, req.Id, opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, repository.ErrInvalidPosition) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrTodoListNotFound) {
+
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.MoveTodoReply{
+		Todo: toProtoTodo(*todo),
+	}
+	return reply, nil
+}
+
 func (ga *GrpcApi) DeleteTodo(ctx context.Context, req *pb.DeleteTodoRequest) (*pb.Empty, error) {
 	logger := log.WithFields(log.Fields{"action": "DeleteTodo"})
 
 	todoReq := repository.Todo{
-		ID:     req.Id,
-		ListID: req.ListId,
+		ID:      req.Id,
+		ListID:  req.ListId,
+		Version: req.Version,
 	}
-	err := ga.repo.DeleteTodo(todoReq)
+	err := ga.repo.DeleteTodo(ctx, todoReq)
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
 		if errors.Is(err, repository.ErrTodoNotFound) {
 			logger.WithError(err).Warning("bad request error")
 			return nil, err
 		}
-		logger.WithError(err).Error("internal server error")
-		return nil, err
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
 	return &pb.Empty{}, nil
 }
 
-func fromProtoTodoList(ptl *pb.TodoList) repository.TodoList {
-	return repository.TodoList{
-		ID:    ptl.Id,
-		Title: ptl.Title,
+func (ga *GrpcApi) GetTodoHistory(ctx context.Context, req *pb.GetTodoHistoryRequest) (*pb.GetHistoryReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetTodoHistory"})
+
+	history, err := ga.repo.GetTodoHistory(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
+
+	return toProtoHistory(history), nil
 }
 
-func toProtoTodoList(tl repository.TodoList) *pb.TodoList {
-	return &pb.TodoList{
-		Id:    tl.ID,
-		Title: tl.Title,
+// Dependencies
+
+func (ga *GrpcApi) AddDependency(ctx context.Context, req *pb.DependencyRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "AddDependency"})
+
+	err := ga.repo.AddDependency(ctx, req.Id, req.BlockerId)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, repository.ErrDependencyCycle) {
+			logger.WithError(err).Warning("failed precondition error")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
+
+	return &pb.Empty{}, nil
 }
 
-func fromProtoTodo(pt *pb.Todo) (repository.Todo, error) {
+func (ga *GrpcApi) RemoveDependency(ctx context.Context, req *pb.DependencyRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "RemoveDependency"})
 
-	todo := repository.Todo{
-		ID:          pt.Id,
-		ListID:      pt.ListId,
-		Description: pt.Description,
-		Comments:    pt.Comments,
-		Labels:      pt.Labels,
-		Done:        pt.Done,
+	err := ga.repo.RemoveDependency(ctx, req.Id, req.BlockerId)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) ||
+			errors.Is(err, repository.ErrNoDependency) {
+
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
-	if pt.DueDate != "" {
-		dueDate, err := time.Parse(dateLayout, pt.DueDate)
-		if err != nil {
-			return repository.Todo{}, ErrInvalidDueDate
+	return &pb.Empty{}, nil
+}
+
+func (ga *GrpcApi) GetBlockers(ctx context.Context, req *pb.GetBlockersRequest) (*pb.GetBlockersReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetBlockers"})
+
+	blockers, err := ga.repo.GetBlockers(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
 		}
-		todo.DueDate = dueDate
+		return nil, internalError(logger, err)
 	}
 
-	return todo, nil
+	reply := &pb.GetBlockersReply{
+		Todos: []*pb.Todo{},
+	}
+	for _, t := range blockers {
+		reply.Todos = append(reply.Todos, toProtoTodo(t))
+	}
+	return reply, nil
 }
 
-func toProtoTodo(todo repository.Todo) *pb.Todo {
-	protoTodo := &pb.Todo{
-		Id:          todo.ID,
-		ListId:      todo.ListID,
-		Description: todo.Description,
-		Comments:    todo.Comments,
-		Labels:      todo.Labels,
-		Done:        todo.Done,
+// todo.txt
+
+func (ga *GrpcApi) ExportTodoTxt(ctx context.Context, req *pb.ExportTodoTxtRequest) (*pb.ExportTodoTxtReply, error) {
+	logger := log.WithFields(log.Fields{"action": "ExportTodoTxt"})
+
+	todos, err := ga.repo.GetTodosByListID(ctx, req.ListId)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
 	}
 
-	if !todo.DueDate.IsZero() {
-		protoTodo.DueDate = todo.DueDate.Format(dateLayout)
+	content := &strings.Builder{}
+	if err := formatTodoTxt(content, todos); err != nil {
+		return nil, internalError(logger, err)
 	}
 
-	return protoTodo
+	reply := &pb.ExportTodoTxtReply{
+		Content: content.String(),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) ImportTodoTxt(ctx context.Context, req *pb.ImportTodoTxtRequest) (*pb.ImportTodoTxtReply, error) {
+	logger := log.WithFields(log.Fields{"action": "ImportTodoTxt"})
+
+	todos, err := parseTodoTxt(strings.NewReader(req.Content))
+	if err != nil {
+		if errors.Is(err, ErrInvalidTodoTxt) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	imported, err := importTodoTxt(ctx, ga.repo, req.ListId, todos)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownLabel) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.ImportTodoTxtReply{
+		Todos: []*pb.Todo{},
+	}
+	for _, t := range imported {
+		reply.Todos = append(reply.Todos, toProtoTodo(t))
+	}
+	return reply, nil
+}
+
+// Calendar
+
+func (ga *GrpcApi) ExportCalendar(ctx context.Context, req *pb.ExportCalendarRequest) (*pb.ExportCalendarReply, error) {
+	logger := log.WithFields(log.Fields{"action": "ExportCalendar"})
+
+	content := &strings.Builder{}
+	if err := exportCalendar(ctx, ga.repo, req.ListId, content); err != nil {
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.ExportCalendarReply{
+		Content: content.String(),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) ImportCalendar(ctx context.Context, req *pb.ImportCalendarRequest) (*pb.ImportCalendarReply, error) {
+	logger := log.WithFields(log.Fields{"action": "ImportCalendar"})
+
+	todos, err := parseCalendar(strings.NewReader(req.Content))
+	if err != nil {
+		if errors.Is(err, ErrInvalidCalendar) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	imported, err := importCalendar(ctx, ga.repo, req.ListId, todos)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownLabel) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoListNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.ImportCalendarReply{
+		Todos: []*pb.Todo{},
+	}
+	for _, t := range imported {
+		reply.Todos = append(reply.Todos, toProtoTodo(t))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) CreateCalendarToken(ctx context.Context, req *pb.CalendarTokenRequest) (*pb.CreateCalendarTokenReply, error) {
+	logger := log.WithFields(log.Fields{"action": "CreateCalendarToken"})
+
+	secret, err := repository.NewTokenSecret()
+	if err != nil {
+		return nil, internalError(logger, err)
+	}
+
+	if _, err := ga.repo.SetFeedToken(ctx, req.ListId, repository.HashToken(secret)); err != nil {
+		return nil, feedTokenError(logger, err)
+	}
+
+	reply := &pb.CreateCalendarTokenReply{
+		Token: secret,
+		Url:   calendarFeedURL(req.ListId, secret),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) DeleteCalendarToken(ctx context.Context, req *pb.CalendarTokenRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "DeleteCalendarToken"})
+
+	if _, err := ga.repo.SetFeedToken(ctx, req.ListId, ""); err != nil {
+		return nil, feedTokenError(logger, err)
+	}
+	return &pb.Empty{}, nil
+}
+
+func feedTokenError(logger *log.Entry, err error) error {
+	if errors.Is(err, repository.ErrTodoListNotFound) {
+		logger.WithError(err).Warning("not found error")
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, ErrForbidden) {
+		logger.WithError(err).Warning("forbidden error")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return internalError(logger, err)
+}
+
+// Users
+
+func (ga *GrpcApi) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserReply, error) {
+	logger := log.WithFields(log.Fields{"action": "CreateUser"})
+
+	userReq := repository.User{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+	}
+
+	newUser, err := ga.repo.InsertUser(ctx, userReq)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidUser) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrUserExists) {
+			logger.WithError(err).Warning("already exists error")
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.CreateUserReply{
+		User: toProtoUser(*newUser),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetAllUsers(ctx context.Context, req *pb.Empty) (*pb.GetAllUsersReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetAllUsers"})
+
+	users, err := ga.repo.GetAllUsers(ctx)
+	if err != nil {
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetAllUsersReply{
+		Users: []*pb.User{},
+	}
+	for _, user := range users {
+		reply.Users = append(reply.Users, toProtoUser(user))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetUser"})
+
+	user, err := ga.repo.GetUser(ctx, req.Name)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetUserReply{
+		User: toProtoUser(*user),
+	}
+	return reply, nil
+}
+
+// Tokens
+
+func (ga *GrpcApi) CreateToken(ctx context.Context, req *pb.CreateTokenRequest) (*pb.CreateTokenReply, error) {
+	logger := log.WithFields(log.Fields{"action": "CreateToken"})
+
+	secret, err := repository.NewTokenSecret()
+	if err != nil {
+		return nil, internalError(logger, err)
+	}
+
+	tokenReq := repository.Token{
+		User: req.User,
+		Name: req.Name,
+		Hash: repository.HashToken(secret),
+	}
+	if tokenReq.User == "" {
+		tokenReq.User = repository.ActorFromContext(ctx)
+	}
+	for _, scope := range req.Scopes {
+		tokenReq.Scopes = append(tokenReq.Scopes, repository.Scope(scope))
+	}
+
+	newToken, err := ga.repo.InsertToken(ctx, tokenReq)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) ||
+			errors.Is(err, repository.ErrInvalidToken) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.CreateTokenReply{
+		Token:  toProtoToken(*newToken),
+		Secret: secret,
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetTokens(ctx context.Context, req *pb.GetTokensRequest) (*pb.GetTokensReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetTokens"})
+
+	user := req.User
+	if user == "" {
+		user = repository.ActorFromContext(ctx)
+	}
+
+	tokens, err := ga.repo.GetTokens(ctx, user)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetTokensReply{
+		Tokens: []*pb.Token{},
+	}
+	for _, token := range tokens {
+		reply.Tokens = append(reply.Tokens, toProtoToken(token))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetToken(ctx context.Context, req *pb.GetTokenRequest) (*pb.GetTokenReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetToken"})
+
+	token, err := ga.repo.GetToken(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetTokenReply{
+		Token: toProtoToken(*token),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) DeleteToken(ctx context.Context, req *pb.DeleteTokenRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "DeleteToken"})
+
+	err := ga.repo.DeleteToken(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// Authentication
+
+// IdentifyUnary is a unary interceptor that authenticates calls, making
+// their user the actor, and refuses the ones whose token doesn't allow them.
+func (ga *GrpcApi) IdentifyUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := ga.identify(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// IdentifyStream is the stream interceptor doing what IdentifyUnary does.
+func (ga *GrpcApi) IdentifyStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := ga.identify(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, identifiedStream{ServerStream: stream, ctx: ctx})
+}
+
+func (ga *GrpcApi) identify(ctx context.Context, fullMethod string) (context.Context, error) {
+	logger := log.WithFields(log.Fields{"action": "Identify", "method": fullMethod})
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, err := authenticate(ctx, ga.repo, ga.Auth, bearerToken(firstMetadata(md, AuthorizationMetadata)), firstMetadata(md, UserMetadata))
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			logger.WithError(err).Warning("unauthenticated error")
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	scope := repository.ScopeWrite
+	if readMethods[path.Base(fullMethod)] {
+		scope = repository.ScopeRead
+	}
+	if !allowed(ctx, scope) {
+		logger.WithError(ErrInsufficientScope).Warning("forbidden error")
+		return nil, status.Error(codes.PermissionDenied, ErrInsufficientScope.Error())
+	}
+
+	return ctx, nil
+}
+
+// firstMetadata returns the first value of key on md, or an empty string.
+func firstMetadata(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// identifiedStream is a server stream carrying the context of its actor.
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (is identifiedStream) Context() context.Context {
+	return is.ctx
+}
+
+// Rate limiting
+
+// RateLimitUnverifiedUnary is a unary interceptor that refuses the calls of
+// IP addresses that made more than their limit allows before they are
+// authenticated, and counts the calls failing to authenticate against their
+// IP address. It must be chained before IdentifyUnary, so floods of bad
+// credentials don't reach the repository.
+func (ga *GrpcApi) RateLimitUnverifiedUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	taken, err := ga.rateLimitUnverified(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := handler(ctx, req)
+	taken(err)
+	return reply, err
+}
+
+// RateLimitUnverifiedStream is the stream interceptor doing what
+// RateLimitUnverifiedUnary does.
+func (ga *GrpcApi) RateLimitUnverifiedStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	taken, err := ga.rateLimitUnverified(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(srv, stream)
+	taken(err)
+	return err
+}
+
+// rateLimitUnverified refuses a call when the IP address making it has no
+// budget left, and otherwise returns a function to call with the outcome of
+// the call, counting it against the IP address when it failed to
+// authenticate.
+func (ga *GrpcApi) rateLimitUnverified(ctx context.Context, fullMethod string) (func(error), error) {
+	if ga.Limiter == nil {
+		return func(error) {}, nil
+	}
+	logger := log.WithFields(log.Fields{"action": "RateLimit", "method": fullMethod})
+
+	limit, budget := ga.rateBudget(fullMethod)
+	client := rateClient("", "", ga.callIP(ctx))
+
+	decision, limited := ga.Limiter.peek(client, budget, limit, time.Now())
+	if limited && !decision.allowed {
+		logger.WithFields(log.Fields{"client": client, "budget": budget}).Warning("resource exhausted error")
+		return nil, status.Errorf(codes.ResourceExhausted, "%v, retry in %ds", ErrRateLimited, seconds(decision.retryAfter))
+	}
+	return func(err error) {
+		if status.Code(err) == codes.Unauthenticated {
+			ga.Limiter.take(client, budget, limit, time.Now())
+		}
+	}, nil
+}
+
+// RateLimitUnary is a unary interceptor that refuses the calls of clients
+// that made more than their limit allows. It must be chained after
+// IdentifyUnary, so it only counts authenticated calls.
+func (ga *GrpcApi) RateLimitUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := ga.rateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// RateLimitStream is the stream interceptor doing what RateLimitUnary does.
+func (ga *GrpcApi) RateLimitStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := ga.rateLimit(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (ga *GrpcApi) rateLimit(ctx context.Context, fullMethod string) error {
+	if ga.Limiter == nil {
+		return nil
+	}
+	logger := log.WithFields(log.Fields{"action": "RateLimit", "method": fullMethod})
+
+	limit, budget := ga.rateBudget(fullMethod)
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := rateClient(
+		bearerToken(firstMetadata(md, AuthorizationMetadata)),
+		repository.ActorFromContext(ctx),
+		ga.callIP(ctx),
+	)
+
+	decision, limited := ga.Limiter.take(client, budget, limit, time.Now())
+	if limited && !decision.allowed {
+		logger.WithFields(log.Fields{"client": client, "budget": budget}).Warning("resource exhausted error")
+		return status.Errorf(codes.ResourceExhausted, "%v, retry in %ds", ErrRateLimited, seconds(decision.retryAfter))
+	}
+	return nil
+}
+
+// rateBudget returns the limit of a call to fullMethod and the name of its
+// budget.
+func (ga *GrpcApi) rateBudget(fullMethod string) (Limit, string) {
+	method := path.Base(fullMethod)
+	return ga.Limiter.limitFor("", method, !readMethods[method])
+}
+
+// callIP returns the IP address of the client making a call.
+func (ga *GrpcApi) callIP(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var forwarded, remoteAddr string
+	if ga.Limiter.limits.ClientIPHeader != "" {
+		forwarded = firstMetadata(md, strings.ToLower(ga.Limiter.limits.ClientIPHeader))
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return clientIP(forwarded, ga.Limiter.limits.TrustedHops, remoteAddr)
+}
+
+// Labels
+
+func (ga *GrpcApi) CreateLabel(ctx context.Context, req *pb.CreateLabelRequest) (*pb.CreateLabelReply, error) {
+	logger := log.WithFields(log.Fields{"action": "CreateLabel"})
+
+	labelReq := repository.Label{
+		Name:        req.Name,
+		Color:       req.Color,
+		Description: req.Description,
+	}
+
+	newLabel, err := ga.repo.InsertLabel(ctx, labelReq)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrLabelExists) {
+			logger.WithError(err).Warning("already exists error")
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.CreateLabelReply{
+		Label: toProtoLabel(*newLabel),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetAllLabels(ctx context.Context, req *pb.Empty) (*pb.GetAllLabelsReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetAllLabels"})
+
+	labels, err := ga.repo.GetAllLabels(ctx)
+	if err != nil {
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetAllLabelsReply{
+		Labels: []*pb.Label{},
+	}
+	for _, label := range labels {
+		reply.Labels = append(reply.Labels, toProtoLabel(label))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetLabel(ctx context.Context, req *pb.GetLabelRequest) (*pb.GetLabelReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetLabel"})
+
+	label, err := ga.repo.GetLabel(ctx, req.Name)
+	if err != nil {
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetLabelReply{
+		Label: toProtoLabel(*label),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) UpdateLabel(ctx context.Context, req *pb.UpdateLabelRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "UpdateLabel"})
+
+	err := ga.repo.UpdateLabel(ctx, fromProtoLabel(req.Label))
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (ga *GrpcApi) RenameLabel(ctx context.Context, req *pb.RenameLabelRequest) (*pb.RenameLabelReply, error) {
+	logger := log.WithFields(log.Fields{"action": "RenameLabel"})
+
+	label, err := ga.repo.RenameLabel(ctx, req.Name, req.NewName)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidLabel) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, repository.ErrLabelExists) {
+			logger.WithError(err).Warning("already exists error")
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.RenameLabelReply{
+		Label: toProtoLabel(*label),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) DeleteLabel(ctx context.Context, req *pb.DeleteLabelRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "DeleteLabel"})
+
+	err := ga.repo.DeleteLabel(ctx, req.Name)
+	if err != nil {
+		if errors.Is(err, repository.ErrLabelNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// Comments
+
+func (ga *GrpcApi) CreateComment(ctx context.Context, req *pb.CreateCommentRequest) (*pb.CreateCommentReply, error) {
+	logger := log.WithFields(log.Fields{"action": "CreateComment"})
+
+	commentReq := repository.Comment{
+		TodoID: req.TodoId,
+		Author: req.Author,
+		Body:   req.Body,
+	}
+	if req.HasParent {
+		commentReq.ParentID = &req.ParentId
+	}
+
+	newComment, err := ga.repo.InsertComment(ctx, commentReq)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmptyComment) ||
+			errors.Is(err, repository.ErrInvalidReply) {
+
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.CreateCommentReply{
+		Comment: toProtoComment(*newComment),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetComments(ctx context.Context, req *pb.GetCommentsRequest) (*pb.GetCommentsReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetComments"})
+
+	comments, err := ga.repo.GetComments(ctx, req.TodoId)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	if req.Tree {
+		reply := &pb.GetCommentsReply{
+			Tree: toProtoCommentTree(repository.NewCommentTree(comments)),
+		}
+		return reply, nil
+	}
+
+	reply := &pb.GetCommentsReply{
+		Comments: []*pb.Comment{},
+	}
+	for _, comment := range comments {
+		reply.Comments = append(reply.Comments, toProtoComment(comment))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetComment(ctx context.Context, req *pb.GetCommentRequest) (*pb.GetCommentReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetComment"})
+
+	comment, err := ga.repo.GetComment(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetCommentReply{
+		Comment: toProtoComment(*comment),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) UpdateComment(ctx context.Context, req *pb.UpdateCommentRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "UpdateComment"})
+
+	err := ga.repo.UpdateComment(ctx, fromProtoComment(req.Comment))
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, repository.ErrEmptyComment) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (ga *GrpcApi) DeleteComment(ctx context.Context, req *pb.DeleteCommentRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "DeleteComment"})
+
+	err := ga.repo.DeleteComment(ctx, repository.Comment{ID: req.Id, Version: req.Version})
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			logger.WithError(err).Warning("conflict error")
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, repository.ErrCommentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// Attachments
+
+func (ga *GrpcApi) UploadAttachment(stream pb.Todoer_UploadAttachmentServer) error {
+	logger := log.WithFields(log.Fields{"action": "UploadAttachment"})
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		logger.Warning("upload without messages")
+		return status.Error(codes.InvalidArgument, "upload has no messages")
+	}
+	if err != nil {
+		return internalError(logger, err)
+	}
+
+	// Refused before the content is read and stored
+	if err := checkAttachable(stream.Context(), ga.repo, first.TodoId); err != nil {
+		return insertAttachmentError(logger, err)
+	}
+
+	upload := &chunkReader{chunk: first.Chunk, recv: func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetChunk(), err
+	}}
+	blob, err := ga.blobs.Put(upload)
+	if err != nil {
+		if errors.Is(err, repository.ErrBlobTooLarge) {
+			logger.WithError(err).Warning("upload too large")
+			msg := fmt.Sprintf("%v, the limit is %d bytes", err, ga.blobs.MaxSize())
+			return status.Error(codes.ResourceExhausted, msg)
+		}
+		return internalError(logger, err)
+	}
+
+	newAttachment, err := ga.repo.InsertAttachment(stream.Context(), repository.Attachment{
+		TodoID:      first.TodoId,
+		Name:        first.Name,
+		ContentType: blob.ContentType,
+		Size:        blob.Size,
+		Hash:        blob.Hash,
+	})
+	if err != nil {
+		if discardErr := ga.blobs.Discard(blob); discardErr != nil {
+			logger.WithError(discardErr).Warning("discarding attachment content")
+		}
+		return insertAttachmentError(logger, err)
+	}
+
+	reply := &pb.UploadAttachmentReply{
+		Attachment: toProtoAttachment(*newAttachment),
+	}
+	return stream.SendAndClose(reply)
+}
+
+func insertAttachmentError(logger *log.Entry, err error) error {
+	if errors.Is(err, repository.ErrInvalidAttachment) {
+		logger.WithError(err).Warning("bad request error")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, repository.ErrTodoNotFound) {
+		logger.WithError(err).Warning("not found error")
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, ErrForbidden) {
+		logger.WithError(err).Warning("forbidden error")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return internalError(logger, err)
+}
+
+func (ga *GrpcApi) GetAttachments(ctx context.Context, req *pb.GetAttachmentsRequest) (*pb.GetAttachmentsReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetAttachments"})
+
+	attachments, err := ga.repo.GetAttachments(ctx, req.TodoId)
+	if err != nil {
+		if errors.Is(err, repository.ErrTodoNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetAttachmentsReply{
+		Attachments: []*pb.Attachment{},
+	}
+	for _, attachment := range attachments {
+		reply.Attachments = append(reply.Attachments, toProtoAttachment(attachment))
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) GetAttachment(ctx context.Context, req *pb.GetAttachmentRequest) (*pb.GetAttachmentReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetAttachment"})
+
+	attachment, err := ga.repo.GetAttachment(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.GetAttachmentReply{
+		Attachment: toProtoAttachment(*attachment),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) DownloadAttachment(req *pb.DownloadAttachmentRequest, stream pb.Todoer_DownloadAttachmentServer) error {
+	logger := log.WithFields(log.Fields{"action": "DownloadAttachment"})
+
+	attachment, err := ga.repo.GetAttachment(stream.Context(), req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return status.Error(codes.NotFound, err.Error())
+		}
+		return internalError(logger, err)
+	}
+
+	// A missing content is an internal error, as the attachment still has it
+	content, err := ga.blobs.Open(attachment.Hash)
+	if err != nil {
+		return internalError(logger, err)
+	}
+	defer content.Close()
+
+	reply := &pb.DownloadAttachmentReply{
+		Attachment: toProtoAttachment(*attachment),
+	}
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		n, err := content.Read(buf)
+		if n > 0 || reply.Attachment != nil {
+			reply.Chunk = buf[:n]
+			if err := stream.Send(reply); err != nil {
+				return internalError(logger, err)
+			}
+			reply = &pb.DownloadAttachmentReply{}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return internalError(logger, err)
+		}
+	}
+}
+
+func (ga *GrpcApi) DeleteAttachment(ctx context.Context, req *pb.DeleteAttachmentRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "DeleteAttachment"})
+
+	err := ga.repo.DeleteAttachment(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAttachmentNotFound) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+// chunkReader reads what a client stream sends from the chunks on its
+// messages, starting with the chunk of the first one.
+type chunkReader struct {
+	chunk []byte
+	recv  func() ([]byte, error)
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.chunk) == 0 {
+		chunk, err := cr.recv()
+		if err != nil {
+			return 0, err
+		}
+		cr.chunk = chunk
+	}
+
+	n := copy(p, cr.chunk)
+	cr.chunk = cr.chunk[n:]
+	return n, nil
+}
+
+// Search
+
+func (ga *GrpcApi) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchReply, error) {
+	logger := log.WithFields(log.Fields{"action": "Search"})
+
+	query := repository.SearchQuery{
+		Text:  req.Query,
+		Limit: int(req.Limit),
+	}
+
+	hits, err := ga.repo.Search(ctx, query)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSearch) {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.SearchReply{
+		Hits: []*pb.SearchHit{},
+	}
+	for _, hit := range hits {
+		reply.Hits = append(reply.Hits, toProtoSearchHit(hit))
+	}
+	return reply, nil
+}
+
+// Trash
+
+func (ga *GrpcApi) GetTrash(ctx context.Context, req *pb.Empty) (*pb.GetTrashReply, error) {
+	logger := log.WithFields(log.Fields{"action": "GetTrash"})
+
+	trash, err := ga.repo.GetTrash(ctx)
+	if err != nil {
+		return nil, internalError(logger, err)
+	}
+
+	return toProtoTrash(*trash), nil
+}
+
+func (ga *GrpcApi) RestoreTodoList(ctx context.Context, req *pb.RestoreTodoListRequest) (*pb.RestoreTodoListReply, error) {
+	logger := log.WithFields(log.Fields{"action": "RestoreTodoList"})
+
+	todoList, err := ga.repo.RestoreTodoList(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.RestoreTodoListReply{
+		TodoList: toProtoTodoList(*todoList),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) RestoreTodo(ctx context.Context, req *pb.RestoreTodoRequest) (*pb.RestoreTodoReply, error) {
+	logger := log.WithFields(log.Fields{"action": "RestoreTodo"})
+
+	todo, err := ga.repo.RestoreTodo(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		// The todo list or the parent of the todo is on the trash, so
+		// restore it first
+		if errors.Is(err, repository.ErrTodoListNotFound) ||
+			errors.Is(err, repository.ErrInvalidParent) {
+
+			logger.WithError(err).Warning("failed precondition error")
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	reply := &pb.RestoreTodoReply{
+		Todo: toProtoTodo(*todo),
+	}
+	return reply, nil
+}
+
+func (ga *GrpcApi) PurgeTodoList(ctx context.Context, req *pb.PurgeTodoListRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTodoList"})
+
+	err := ga.repo.PurgeTodoList(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (ga *GrpcApi) PurgeTodo(ctx context.Context, req *pb.PurgeTodoRequest) (*pb.Empty, error) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTodo"})
+
+	err := ga.repo.PurgeTodo(ctx, req.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotInTrash) {
+			logger.WithError(err).Warning("not found error")
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (ga *GrpcApi) PurgeTrash(ctx context.Context, req *pb.PurgeTrashRequest) (*pb.PurgeTrashReply, error) {
+	logger := log.WithFields(log.Fields{"action": "PurgeTrash"})
+
+	// Without a cutoff the whole trash is purged
+	deletedBefore := time.Now()
+	if req.DeletedBefore != "" {
+		var err error
+		deletedBefore, err = time.Parse(dateLayout, req.DeletedBefore)
+		if err != nil {
+			logger.WithError(err).Warning("bad request error")
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("deleted_before is invalid: %v", err))
+		}
+	}
+
+	purged, err := ga.repo.PurgeTrash(ctx, deletedBefore)
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			logger.WithError(err).Warning("forbidden error")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, internalError(logger, err)
+	}
+
+	return &pb.PurgeTrashReply{Purged: uint32(purged)}, nil
+}
+
+// Backups
+
+func (ga *GrpcApi) Backup(req *pb.Empty, stream pb.Todoer_BackupServer) error {
+	logger := log.WithFields(log.Fields{"action": "Backup"})
+
+	if err := allowBackups(stream.Context(), ga.Auth); err != nil {
+		logger.WithError(err).Warning("forbidden error")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	backup, err := ga.repo.Backup(stream.Context())
+	if err != nil {
+		if errors.Is(err, ErrInsufficientScope) {
+			logger.WithError(err).Warning("forbidden error")
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return internalError(logger, err)
+	}
+
+	w := bufio.NewWriterSize(chunkWriter(func(chunk []byte) error {
+		return stream.Send(&pb.BackupReply{Chunk: chunk})
+	}), attachmentChunkSize)
+	err = repository.WriteBackup(w, backup)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return internalError(logger, err)
+	}
+	return nil
+}
+
+func (ga *GrpcApi) Restore(stream pb.Todoer_RestoreServer) error {
+	logger := log.WithFields(log.Fields{"action": "Restore"})
+
+	// Refused before the backup is read
+	if err := allowBackups(stream.Context(), ga.Auth); err != nil {
+		logger.WithError(err).Warning("forbidden error")
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		logger.Warning("restore without messages")
+		return status.Error(codes.InvalidArgument, "restore has no messages")
+	}
+	if err != nil {
+		return internalError(logger, err)
+	}
+
+	mode, err := parseRestoreMode(first.Mode)
+	if err != nil {
+		logger.WithError(err).Warning("bad request error")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	backup, err := repository.ReadBackup(&chunkReader{chunk: first.Chunk, recv: func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetChunk(), err
+	}})
+	if err == nil {
+		err = ga.repo.Restore(stream.Context(), *backup, mode)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidBackup) {
+			logger.WithError(err).Warning("bad request error")
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, ErrInsufficientScope) {
+			logger.WithError(err).Warning("forbidden error")
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return internalError(logger, err)
+	}
+
+	return stream.SendAndClose(&pb.Empty{})
+}
+
+// chunkWriter sends what is written as chunks of a server stream, splitting
+// writes longer than attachmentChunkSize.
+type chunkWriter func(chunk []byte) error
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > attachmentChunkSize {
+			n = attachmentChunkSize
+		}
+		if err := cw(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// internalError hides unexpected errors from clients, except for the ones
+// caused by the caller cancelling the call or running out of time.
+func internalError(logger *log.Entry, err error) error {
+	if errors.Is(err, context.Canceled) {
+		logger.WithError(err).Warning("request canceled")
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.WithError(err).Warning("request deadline exceeded")
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	logger.WithError(err).Error("internal server error")
+	return status.Error(codes.Internal, "internal server error")
+}
+
+func fromProtoTodoQuery(req *pb.QueryTodosRequest) (repository.TodoQuery, error) {
+	query := repository.TodoQuery{
+		ListIDs:    req.ListIds,
+		Labels:     req.Labels,
+		Text:       req.Text,
+		Descending: req.Descending,
+		Unblocked:  req.Unblocked,
+		Limit:      int(req.Limit),
+		Cursor:     req.Cursor,
+	}
+
+	switch req.Done {
+	case pb.DoneFilter_DONE_FILTER_ANY:
+	case pb.DoneFilter_DONE_FILTER_DONE, pb.DoneFilter_DONE_FILTER_NOT_DONE:
+		done := req.Done == pb.DoneFilter_DONE_FILTER_DONE
+		query.Done = &done
+	default:
+		return query, fmt.Errorf("%w: unknown done filter %v", repository.ErrInvalidQuery, req.Done)
+	}
+
+	switch req.SortBy {
+	case pb.TodoSort_TODO_SORT_ID:
+		query.SortBy = repository.SortByID
+	case pb.TodoSort_TODO_SORT_DUE_DATE:
+		query.SortBy = repository.SortByDueDate
+	case pb.TodoSort_TODO_SORT_DESCRIPTION:
+		query.SortBy = repository.SortByDescription
+	case pb.TodoSort_TODO_SORT_CREATED_AT:
+		query.SortBy = repository.SortByCreatedAt
+	case pb.TodoSort_TODO_SORT_UPDATED_AT:
+		query.SortBy = repository.SortByUpdatedAt
+	case pb.TodoSort_TODO_SORT_POSITION:
+		query.SortBy = repository.SortByPosition
+	default:
+		return query, fmt.Errorf("%w: unknown sort %v", repository.ErrInvalidQuery, req.SortBy)
+	}
+
+	if req.DueAfter != "" {
+		dueAfter, err := time.Parse(dateLayout, req.DueAfter)
+		if err != nil {
+			return query, fmt.Errorf("%w: due_after is invalid", repository.ErrInvalidQuery)
+		}
+		query.DueAfter = dueAfter
+	}
+
+	if req.DueBefore != "" {
+		dueBefore, err := time.Parse(dateLayout, req.DueBefore)
+		if err != nil {
+			return query, fmt.Errorf("%w: due_before is invalid", repository.ErrInvalidQuery)
+		}
+		query.DueBefore = dueBefore
+	}
+
+	return query, nil
+}
+
+func fromProtoTodoList(ptl *pb.TodoList) repository.TodoList {
+	return repository.TodoList{
+		ID:      ptl.Id,
+		Title:   ptl.Title,
+		Version: ptl.Version,
+	}
+}
+
+func toProtoTodoList(tl repository.TodoList) *pb.TodoList {
+	return &pb.TodoList{
+		Id:        tl.ID,
+		Title:     tl.Title,
+		Version:   tl.Version,
+		CreatedAt: formatTimestamp(tl.CreatedAt),
+		UpdatedAt: formatTimestamp(tl.UpdatedAt),
+		Owner:     tl.Owner,
+		Members:   toProtoMembers(tl.Members),
+	}
+}
+
+func toProtoMembers(members []repository.Member) []*pb.Member {
+	var result []*pb.Member
+	for _, member := range members {
+		result = append(result, &pb.Member{User: member.User, Role: string(member.Role)})
+	}
+	return result
+}
+
+func toProtoToken(token repository.Token) *pb.Token {
+	protoToken := &pb.Token{
+		Id:        token.ID,
+		User:      token.User,
+		Name:      token.Name,
+		CreatedAt: formatTimestamp(token.CreatedAt),
+	}
+	for _, scope := range token.Scopes {
+		protoToken.Scopes = append(protoToken.Scopes, string(scope))
+	}
+	return protoToken
+}
+
+func toProtoUser(user repository.User) *pb.User {
+	return &pb.User{
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		CreatedAt:   formatTimestamp(user.CreatedAt),
+	}
+}
+
+func fromProtoTodo(pt *pb.Todo) (repository.Todo, error) {
+
+	todo := repository.Todo{
+		ID:          pt.Id,
+		ListID:      pt.ListId,
+		Description: pt.Description,
+		Labels:      pt.Labels,
+		Done:        pt.Done,
+		Version:     pt.Version,
+	}
+	if pt.HasParent {
+		parentID := pt.ParentId
+		todo.ParentID = &parentID
+	}
+
+	if pt.DueDate != "" {
+		dueDate, err := time.Parse(dateLayout, pt.DueDate)
+		if err != nil {
+			return repository.Todo{}, ErrInvalidDueDate
+		}
+		todo.DueDate = dueDate
+	}
+
+	if pt.Recurrence != "" {
+		recurrence, err := repository.ParseRecurrence(pt.Recurrence)
+		if err != nil {
+			return repository.Todo{}, err
+		}
+		todo.Recurrence = recurrence
+	}
+
+	return todo, nil
+}
+
+func toProtoTodo(todo repository.Todo) *pb.Todo {
+	protoTodo := &pb.Todo{
+		Id:          todo.ID,
+		ListId:      todo.ListID,
+		Description: todo.Description,
+		Labels:      todo.Labels,
+		Done:        todo.Done,
+		Version:     todo.Version,
+		CreatedAt:   formatTimestamp(todo.CreatedAt),
+		UpdatedAt:   formatTimestamp(todo.UpdatedAt),
+		CompletedAt: formatTimestamp(todo.CompletedAt),
+		Position:    uint32(todo.Position),
+	}
+
+	if todo.ParentID != nil {
+		protoTodo.HasParent = true
+		protoTodo.ParentId = *todo.ParentID
+	}
+
+	if todo.Recurrence != nil {
+		protoTodo.Recurrence = todo.Recurrence.String()
+	}
+
+	if !todo.DueDate.IsZero() {
+		protoTodo.DueDate = todo.DueDate.Format(dateLayout)
+	}
+
+	return protoTodo
+}
+
+func fromProtoLabel(pl *pb.Label) repository.Label {
+	return repository.Label{
+		Name:        pl.Name,
+		Color:       pl.Color,
+		Description: pl.Description,
+		Version:     pl.Version,
+	}
+}
+
+func toProtoLabel(label repository.Label) *pb.Label {
+	return &pb.Label{
+		Name:        label.Name,
+		Color:       label.Color,
+		Description: label.Description,
+		Version:     label.Version,
+		CreatedAt:   formatTimestamp(label.CreatedAt),
+		UpdatedAt:   formatTimestamp(label.UpdatedAt),
+		TodoCount:   uint32(label.TodoCount),
+	}
+}
+
+func fromProtoComment(pc *pb.Comment) repository.Comment {
+	comment := repository.Comment{
+		ID:      pc.Id,
+		TodoID:  pc.TodoId,
+		Author:  pc.Author,
+		Body:    pc.Body,
+		Version: pc.Version,
+	}
+	if pc.HasParent {
+		parentID := pc.ParentId
+		comment.ParentID = &parentID
+	}
+	return comment
+}
+
+func toProtoComment(comment repository.Comment) *pb.Comment {
+	protoComment := &pb.Comment{
+		Id:        comment.ID,
+		TodoId:    comment.TodoID,
+		Author:    comment.Author,
+		Body:      comment.Body,
+		Version:   comment.Version,
+		CreatedAt: formatTimestamp(comment.CreatedAt),
+		UpdatedAt: formatTimestamp(comment.UpdatedAt),
+	}
+	if comment.ParentID != nil {
+		protoComment.HasParent = true
+		protoComment.ParentId = *comment.ParentID
+	}
+	return protoComment
+}
+
+func toProtoCommentTree(nodes []repository.CommentNode) []*pb.CommentNode {
+	nodesReply := []*pb.CommentNode{}
+	for _, node := range nodes {
+		nodesReply = append(nodesReply, &pb.CommentNode{
+			Comment: toProtoComment(node.Comment),
+			Replies: toProtoCommentTree(node.Replies),
+		})
+	}
+	return nodesReply
+}
+
+func toProtoAttachment(attachment repository.Attachment) *pb.Attachment {
+	return &pb.Attachment{
+		Id:          attachment.ID,
+		TodoId:      attachment.TodoID,
+		Name:        attachment.Name,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Sha256:      attachment.Hash,
+		CreatedAt:   formatTimestamp(attachment.CreatedAt),
+	}
+}
+
+func toProtoSearchHit(hit repository.SearchHit) *pb.SearchHit {
+	protoHit := &pb.SearchHit{
+		TodoList: toProtoTodoList(hit.TodoList),
+		Fields:   hit.Fields,
+		Score:    hit.Score,
+	}
+	if hit.Todo != nil {
+		protoHit.Todo = toProtoTodo(*hit.Todo)
+	}
+	return protoHit
+}
+
+func toProtoTodoTree(nodes []repository.TodoNode) []*pb.TodoNode {
+	nodesReply := []*pb.TodoNode{}
+	for _, node := range nodes {
+		nodesReply = append(nodesReply, &pb.TodoNode{
+			Todo:     toProtoTodo(node.Todo),
+			Subtasks: toProtoTodoTree(node.Subtasks),
+		})
+	}
+	return nodesReply
+}
+
+func toProtoTrash(trash repository.Trash) *pb.GetTrashReply {
+	reply := &pb.GetTrashReply{
+		TodoLists: []*pb.TrashedTodoList{},
+		Todos:     []*pb.TrashedTodo{},
+	}
+
+	for _, tl := range trash.TodoLists {
+		reply.TodoLists = append(reply.TodoLists, &pb.TrashedTodoList{
+			TodoList:  toProtoTodoList(tl.TodoList),
+			DeletedAt: tl.DeletedAt.Format(dateLayout),
+			TodoIds:   tl.TodoIDs,
+		})
+	}
+
+	for _, t := range trash.Todos {
+		reply.Todos = append(reply.Todos, &pb.TrashedTodo{
+			Todo:       toProtoTodo(t.Todo),
+			DeletedAt:  t.DeletedAt.Format(dateLayout),
+			SubtaskIds: t.SubtaskIDs,
+		})
+	}
+
+	return reply
+}
+
+func toProtoHistory(history []repository.HistoryEntry) *pb.GetHistoryReply {
+	reply := &pb.GetHistoryReply{
+		Entries: []*pb.HistoryEntry{},
+	}
+
+	for _, entry := range history {
+		changes := []*pb.FieldChange{}
+		for _, change := range entry.Changes {
+			changes = append(changes, &pb.FieldChange{
+				Field: change.Field,
+				Old:   change.Old,
+				New:   change.New,
+			})
+		}
+		reply.Entries = append(reply.Entries, &pb.HistoryEntry{
+			At:      entry.At.Format(dateLayout),
+			Actor:   entry.Actor,
+			Action:  string(entry.Action),
+			Changes: changes,
+		})
+	}
+
+	return reply
 }
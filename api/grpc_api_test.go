@@ -2,11 +2,24 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
 	"github.com/vitorarins/todoer/pb"
 	"github.com/vitorarins/todoer/repository"
 )
@@ -56,7 +69,7 @@ func TestTodoListGrpcApiCreation(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoList = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.CreateTodoList(ctx, test.createTodoListReq)
 			if err != nil && test.injectErr == nil {
@@ -111,7 +124,7 @@ func TestTodoListGrpcApiGetAll(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoListSlice = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.GetAllTodoLists(ctx, &pb.Empty{})
 			if err != nil && test.injectErr == nil {
@@ -170,7 +183,7 @@ func TestTodoListGrpcApiGetByID(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoList = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.GetTodoList(ctx, test.getTodoListReq)
 			if err != nil && test.injectErr == nil {
@@ -227,7 +240,7 @@ func TestTodoListGrpcApiUpdate(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoList = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			_, err := grpcApi.UpdateTodoList(ctx, test.updateTodoListReq)
 			if err != nil && test.injectErr == nil {
@@ -242,6 +255,7 @@ func TestTodoListGrpcApiDelete(t *testing.T) {
 		name              string
 		deleteTodoListReq *pb.DeleteTodoListRequest
 		injectErr         error
+		wantCode          codes.Code
 	}
 
 	tests := []Test{
@@ -249,15 +263,51 @@ func TestTodoListGrpcApiDelete(t *testing.T) {
 			name:              "SuccessDeletingTodoList",
 			deleteTodoListReq: validDeleteTodoListRequest(t),
 		},
+		{
+			name: "SuccessDeletingTodoListWithMovePolicy",
+			deleteTodoListReq: &pb.DeleteTodoListRequest{
+				Id:           0,
+				Policy:       pb.DeletePolicy_DELETE_POLICY_MOVE,
+				TargetListId: 1,
+			},
+		},
+		{
+			name: "ErrIfPolicyUnknown",
+			deleteTodoListReq: &pb.DeleteTodoListRequest{
+				Id:     0,
+				Policy: pb.DeletePolicy(42),
+			},
+			wantCode: codes.InvalidArgument,
+		},
 		{
 			name:              "ErrIfTodoListNotFound",
 			deleteTodoListReq: validDeleteTodoListRequest(t),
 			injectErr:         repository.ErrTodoListNotFound,
+			wantCode:          codes.NotFound,
+		},
+		{
+			name:              "ErrIfTodoListNotEmpty",
+			deleteTodoListReq: validDeleteTodoListRequest(t),
+			injectErr:         repository.ErrTodoListNotEmpty,
+			wantCode:          codes.FailedPrecondition,
+		},
+		{
+			name:              "ErrIfVersionConflict",
+			deleteTodoListReq: &pb.DeleteTodoListRequest{Id: 0, Version: 1},
+			injectErr:         repository.ErrConflict,
+			wantCode:          codes.Aborted,
+		},
+		{
+			name:              "ErrIfTargetInvalid",
+			deleteTodoListReq: validDeleteTodoListRequest(t),
+			injectErr:         repository.ErrInvalidTarget,
+			wantCode:          codes.InvalidArgument,
 		},
 		{
 			name:              "InternalServerErrorInsertTodoListError",
 			deleteTodoListReq: validDeleteTodoListRequest(t),
 			injectErr:         errors.New("injected generic error"),
+			wantCode:          codes.Internal,
 		},
 	}
 
@@ -265,11 +315,11 @@ func TestTodoListGrpcApiDelete(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			_, err := grpcApi.DeleteTodoList(ctx, test.deleteTodoListReq)
-			if err != nil && test.injectErr == nil {
-				t.Fatal(err)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", got, test.wantCode, err)
 			}
 		})
 	}
@@ -343,6 +393,14 @@ func TestTodoGrpcApiCreation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "ErrCreatingTodoUnsupportedRecurrence",
+			createTodoReq: &pb.CreateTodoRequest{
+				Description: "Routine",
+				Recurrence:  "FREQ=WEEKLY;BYDAY=1MO",
+			},
+			wantErr: true,
+		},
 		{
 			name:          "BadRequestIfRepoInsertReturnsErrEmptyDescription",
 			createTodoReq: validCreateTodoRequest(t),
@@ -362,7 +420,7 @@ func TestTodoGrpcApiCreation(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodo = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.CreateTodo(ctx, test.createTodoReq)
 			if err != nil && !test.wantErr {
@@ -425,7 +483,7 @@ func TestTodoGrpcApiGetTodosByList(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodoSlice = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.GetTodosByList(ctx, test.getTodosByListReq)
 			if err != nil && test.injectErr == nil {
@@ -443,6 +501,142 @@ func TestTodoGrpcApiGetTodosByList(t *testing.T) {
 	}
 }
 
+func TestTodoGrpcApiQueryTodos(t *testing.T) {
+	type Test struct {
+		name           string
+		queryTodosReq  *pb.QueryTodosRequest
+		injectResponse []repository.Todo
+		injectErr      error
+		want           *pb.QueryTodosReply
+		wantCode       codes.Code
+	}
+
+	tests := []Test{
+		{
+			name:          "SuccessQueryTodos",
+			queryTodosReq: &pb.QueryTodosRequest{ListIds: []uint32{0}},
+			injectResponse: []repository.Todo{
+				repository.Todo{
+					ID:          1,
+					Description: "Make the bed",
+				},
+			},
+			want: &pb.QueryTodosReply{
+				Todos: []*pb.Todo{
+					&pb.Todo{
+						Id:          1,
+						Description: "Make the bed",
+					},
+				},
+			},
+		},
+		{
+			name:          "ErrIfDoneFilterUnknown",
+			queryTodosReq: &pb.QueryTodosRequest{Done: pb.DoneFilter(42)},
+			wantCode:      codes.InvalidArgument,
+		},
+		{
+			name:          "ErrIfSortUnknown",
+			queryTodosReq: &pb.QueryTodosRequest{SortBy: pb.TodoSort(42)},
+			wantCode:      codes.InvalidArgument,
+		},
+		{
+			name:          "ErrIfDueDateInvalid",
+			queryTodosReq: &pb.QueryTodosRequest{DueBefore: "tomorrow"},
+			wantCode:      codes.InvalidArgument,
+		},
+		{
+			name:          "ErrIfCursorInvalid",
+			queryTodosReq: &pb.QueryTodosRequest{Cursor: "bad"},
+			injectErr:     repository.ErrInvalidCursor,
+			wantCode:      codes.InvalidArgument,
+		},
+		{
+			name:          "ErrIfTodoListNotFound",
+			queryTodosReq: &pb.QueryTodosRequest{ListIds: []uint32{0}},
+			injectErr:     repository.ErrTodoListNotFound,
+			wantCode:      codes.NotFound,
+		},
+		{
+			name:          "InternalServerErrorQueryTodosError",
+			queryTodosReq: &pb.QueryTodosRequest{},
+			injectErr:     errors.New("injected generic error"),
+			wantCode:      codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := NewFakeStorage()
+			repo.FakeTodoSlice = test.injectResponse
+			repo.FakeError = test.injectErr
+			grpcApi := NewGrpcApi(repo, nil)
+
+			got, err := grpcApi.QueryTodos(ctx, test.queryTodosReq)
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", code, test.wantCode, err)
+			}
+
+			if diff := cmp.Diff(test.want, got,
+				cmpopts.IgnoreUnexported(pb.QueryTodosReply{}),
+				cmpopts.IgnoreUnexported(pb.Todo{})); diff != "" {
+
+				t.Errorf("grpc_api: QueryTodos mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTodoGrpcApiQueryTodosPagination(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	routine, err := repo.InsertTodoList(ctx, repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, description := range []string{"Sweep the floor", "Make the bed", "Call the bank", "Water the plants"} {
+		todo := repository.Todo{ListID: routine.ID, Description: description, Labels: []string{"home"}}
+		if _, err := repo.InsertTodo(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grpcApi := NewGrpcApi(repo, nil)
+
+	req := &pb.QueryTodosRequest{
+		ListIds:    []uint32{routine.ID},
+		Done:       pb.DoneFilter_DONE_FILTER_NOT_DONE,
+		Labels:     []string{"home"},
+		Text:       "THE",
+		SortBy:     pb.TodoSort_TODO_SORT_DESCRIPTION,
+		Descending: true,
+		Limit:      3,
+	}
+
+	got := []string{}
+	pages := 0
+	for {
+		reply, err := grpcApi.QueryTodos(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, todo := range reply.Todos {
+			got = append(got, todo.Description)
+		}
+		if reply.NextCursor == "" {
+			break
+		}
+		req.Cursor = reply.NextCursor
+	}
+
+	want := []string{"Water the plants", "Sweep the floor", "Make the bed", "Call the bank"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("grpc_api: QueryTodos mismatch (-want +got):\n%s", diff)
+	}
+	if pages != 2 {
+		t.Errorf("got %d pages; want 2", pages)
+	}
+}
+
 func TestTodoGrpcApiGetByID(t *testing.T) {
 	type Test struct {
 		name           string
@@ -479,7 +673,7 @@ func TestTodoGrpcApiGetByID(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeTodo = test.injectResponse
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			got, err := grpcApi.GetTodo(ctx, test.getTodoReq)
 			if err != nil && test.injectErr == nil {
@@ -520,6 +714,16 @@ func TestTodoGrpcApiUpdate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "ErrUpdatingTodoUnsupportedRecurrence",
+			updateTodoReq: &pb.UpdateTodoRequest{
+				Todo: &pb.Todo{
+					Description: "Routine",
+					Recurrence:  "FREQ=HOURLY",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name:          "BadRequestIfRepoUpdateReturnsErrEmptyDescription",
 			updateTodoReq: validUpdateTodoRequest(t),
@@ -538,7 +742,7 @@ func TestTodoGrpcApiUpdate(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			_, err := grpcApi.UpdateTodo(ctx, test.updateTodoReq)
 			if err != nil && !test.wantErr {
@@ -576,7 +780,7 @@ func TestTodoGrpcApiDelete(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			repo := NewFakeStorage()
 			repo.FakeError = test.injectErr
-			grpcApi := NewGrpcApi(repo)
+			grpcApi := NewGrpcApi(repo, nil)
 
 			_, err := grpcApi.DeleteTodo(ctx, test.deleteTodoReq)
 			if err != nil && test.injectErr == nil {
@@ -620,3 +824,1741 @@ func validDeleteTodoRequest(t *testing.T) *pb.DeleteTodoRequest {
 		Id: 0,
 	}
 }
+
+func TestGrpcApiVersionConflict(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	createdList, err := grpcApi.CreateTodoList(ctx, validCreateTodoListRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList := createdList.TodoList
+	if todoList.Version != 1 {
+		t.Fatalf("got todo list version %d; want 1", todoList.Version)
+	}
+
+	createdTodo, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := createdTodo.Todo
+
+	// Both updates carry version 1, so only the first one may succeed
+	todoList.Title = "Daily"
+	if _, err := grpcApi.UpdateTodoList(ctx, &pb.UpdateTodoListRequest{TodoList: todoList}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.UpdateTodoList(ctx, &pb.UpdateTodoListRequest{TodoList: todoList})
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("UpdateTodoList: got code %v; want %v (error: %v)", got, codes.Aborted, err)
+	}
+
+	todo.Done = true
+	if _, err := grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: todo}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: todo})
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("UpdateTodo: got code %v; want %v (error: %v)", got, codes.Aborted, err)
+	}
+
+	_, err = grpcApi.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.Id, ListId: todo.ListId, Version: 1})
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("DeleteTodo: got code %v; want %v (error: %v)", got, codes.Aborted, err)
+	}
+
+	got, err := grpcApi.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Todo.Version != 2 {
+		t.Errorf("got todo version %d; want 2", got.Todo.Version)
+	}
+
+	if _, err := grpcApi.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.Id, ListId: todo.ListId, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrpcApiTrash(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	createdList, err := grpcApi.CreateTodoList(ctx, validCreateTodoListRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList := createdList.TodoList
+
+	createdTodo, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := createdTodo.Todo
+
+	if _, err := grpcApi.DeleteTodoList(ctx, &pb.DeleteTodoListRequest{Id: todoList.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := grpcApi.GetTrash(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.TodoLists) != 1 || len(trash.Todos) != 1 {
+		t.Fatalf("got %d todo lists and %d todos on the trash; want 1 and 1", len(trash.TodoLists), len(trash.Todos))
+	}
+	if diff := cmp.Diff([]uint32{todo.Id}, trash.TodoLists[0].TodoIds); diff != "" {
+		t.Errorf("trashed todo list todo_ids mismatch (-want +got):\n%s", diff)
+	}
+	if trash.Todos[0].DeletedAt == "" {
+		t.Error("got no deleted_at on the trashed todo")
+	}
+
+	// The todo list is still on the trash
+	_, err = grpcApi.RestoreTodo(ctx, &pb.RestoreTodoRequest{Id: todo.Id})
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Errorf("RestoreTodo: got code %v; want %v (error: %v)", got, codes.FailedPrecondition, err)
+	}
+
+	restored, err := grpcApi.RestoreTodoList(ctx, &pb.RestoreTodoListRequest{Id: todoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.TodoList.Version != 2 {
+		t.Errorf("got restored todo list version %d; want 2", restored.TodoList.Version)
+	}
+	if _, err := grpcApi.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.Id}); err != nil {
+		t.Errorf("GetTodo after restoring its todo list: %v", err)
+	}
+
+	if _, err := grpcApi.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.Id, ListId: todo.ListId}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grpcApi.PurgeTodo(ctx, &pb.PurgeTodoRequest{Id: todo.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.RestoreTodo(ctx, &pb.RestoreTodoRequest{Id: todo.Id})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("RestoreTodo after purge: got code %v; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	if _, err := grpcApi.DeleteTodoList(ctx, &pb.DeleteTodoListRequest{Id: todoList.Id}); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := grpcApi.PurgeTrash(ctx, &pb.PurgeTrashRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged.Purged != 1 {
+		t.Errorf("got %d purged; want 1", purged.Purged)
+	}
+	_, err = grpcApi.PurgeTodoList(ctx, &pb.PurgeTodoListRequest{Id: todoList.Id})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("PurgeTodoList after PurgeTrash: got code %v; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	_, err = grpcApi.PurgeTrash(ctx, &pb.PurgeTrashRequest{DeletedBefore: "yesterday"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("PurgeTrash: got code %v; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+}
+
+func TestGrpcApiTimestamps(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	createdList, err := grpcApi.CreateTodoList(ctx, validCreateTodoListRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if createdList.TodoList.CreatedAt == "" || createdList.TodoList.UpdatedAt == "" {
+		t.Errorf("got todo list %v; want created_at and updated_at set", createdList.TodoList)
+	}
+
+	createdTodo, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: createdList.TodoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := createdTodo.Todo
+	if todo.CreatedAt == "" || todo.UpdatedAt == "" || todo.CompletedAt != "" {
+		t.Errorf("got created todo %v; want created_at and updated_at set, and no completed_at", todo)
+	}
+
+	for _, done := range []bool{true, false} {
+		todo.Done = done
+		todo.Version = 0
+		if _, err := grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: todo}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := grpcApi.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasCompletedAt := got.Todo.CompletedAt != ""; hasCompletedAt != done {
+			t.Errorf("got completed_at %q with done %v", got.Todo.CompletedAt, done)
+		}
+	}
+}
+
+func TestGrpcApiHistory(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	actorCtx := repository.WithActor(ctx, "alice")
+
+	createdList, err := grpcApi.CreateTodoList(actorCtx, validCreateTodoListRequest(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdTodo, err := grpcApi.CreateTodo(actorCtx, &pb.CreateTodoRequest{ListId: createdList.TodoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := createdTodo.Todo
+
+	todo.Done = true
+	if _, err := grpcApi.UpdateTodo(actorCtx, &pb.UpdateTodoRequest{Todo: todo}); err != nil {
+		t.Fatal(err)
+	}
+
+	todoHistory, err := grpcApi.GetTodoHistory(actorCtx, &pb.GetTodoHistoryRequest{Id: todo.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todoHistory.Entries) != 2 {
+		t.Fatalf("got %d todo history entries; want 2", len(todoHistory.Entries))
+	}
+	update := todoHistory.Entries[1]
+	if update.Action != "update" || update.Actor != "alice" || update.At == "" {
+		t.Errorf("got update entry %v; want an update by alice", update)
+	}
+	wantChanges := []*pb.FieldChange{{Field: "done", Old: "false", New: "true"}}
+	if diff := cmp.Diff(wantChanges, update.Changes, cmpopts.IgnoreUnexported(pb.FieldChange{})); diff != "" {
+		t.Errorf("update changes mismatch (-want +got):\n%s", diff)
+	}
+
+	listHistory, err := grpcApi.GetTodoListHistory(actorCtx, &pb.GetTodoListHistoryRequest{Id: createdList.TodoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listHistory.Entries) != 1 || listHistory.Entries[0].Actor != "alice" {
+		t.Errorf("got todo list history %v; want a single entry by alice", listHistory.Entries)
+	}
+
+	_, err = grpcApi.GetTodoHistory(ctx, &pb.GetTodoHistoryRequest{Id: 999})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("GetTodoHistory: got code %v; want %v (error: %v)", got, codes.NotFound, err)
+	}
+	_, err = grpcApi.GetTodoListHistory(ctx, &pb.GetTodoListHistoryRequest{Id: 999})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("GetTodoListHistory: got code %v; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiMoveTodo(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoListIDs := []uint32{}
+	for _, title := range []string{"Routine", "Work"} {
+		created, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		todoListIDs = append(todoListIDs, created.TodoList.Id)
+	}
+	routineID, workID := todoListIDs[0], todoListIDs[1]
+
+	todos := []*pb.Todo{}
+	for _, description := range []string{"Make the bed", "Sweep the floor", "Call the bank"} {
+		created, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: routineID, Description: description})
+		if err != nil {
+			t.Fatal(err)
+		}
+		todos = append(todos, created.Todo)
+	}
+	bed, bank := todos[0], todos[2]
+
+	listDescriptions := func(t *testing.T, listID uint32) []string {
+		t.Helper()
+
+		reply, err := grpcApi.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: listID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for i, todo := range reply.Todos {
+			if todo.Position != uint32(i) {
+				t.Errorf("got position %d for %q at index %d", todo.Position, todo.Description, i)
+			}
+			got = append(got, todo.Description)
+		}
+		return got
+	}
+
+	moved, err := grpcApi.MoveTodo(ctx, &pb.MoveTodoRequest{Id: bank.Id, ListId: routineID, Before: true, BeforeId: bed.Id, Version: bank.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Todo.Position != 0 || moved.Todo.Version != bank.Version+1 {
+		t.Errorf("got moved todo %v; want position 0 and version %d", moved.Todo, bank.Version+1)
+	}
+	if diff := cmp.Diff([]string{"Call the bank", "Make the bed", "Sweep the floor"}, listDescriptions(t, routineID)); diff != "" {
+		t.Errorf("todos of Routine mismatch (-want +got):\n%s", diff)
+	}
+
+	// Before is false, so before_id is ignored and the todo goes to the end
+	if _, err := grpcApi.MoveTodo(ctx, &pb.MoveTodoRequest{Id: bed.Id, ListId: workID, BeforeId: bank.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Call the bank", "Sweep the floor"}, listDescriptions(t, routineID)); diff != "" {
+		t.Errorf("todos of Routine mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Make the bed"}, listDescriptions(t, workID)); diff != "" {
+		t.Errorf("todos of Work mismatch (-want +got):\n%s", diff)
+	}
+
+	type Test struct {
+		name     string
+		req      *pb.MoveTodoRequest
+		wantCode codes.Code
+	}
+
+	tests := []Test{
+		{
+			name:     "BeforeTodoOnOtherList",
+			req:      &pb.MoveTodoRequest{Id: bank.Id, ListId: routineID, Before: true, BeforeId: bed.Id},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "TodoNotFound",
+			req:      &pb.MoveTodoRequest{Id: 999, ListId: routineID},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "TodoListNotFound",
+			req:      &pb.MoveTodoRequest{Id: bank.Id, ListId: 999},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "StaleVersion",
+			req:      &pb.MoveTodoRequest{Id: bank.Id, ListId: routineID, Version: bank.Version},
+			wantCode: codes.Aborted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := grpcApi.MoveTodo(ctx, test.req)
+			if got := status.Code(err); got != test.wantCode {
+				t.Errorf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestGrpcApiSubtasks(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routineID := todoList.TodoList.Id
+
+	house, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: routineID, Description: "Clean the house"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	floor, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: routineID, Description: "Sweep the floor", HasParent: true, ParentId: house.Todo.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !floor.Todo.HasParent || floor.Todo.ParentId != house.Todo.Id {
+		t.Errorf("got todo %v; want parent %d", floor.Todo, house.Todo.Id)
+	}
+
+	// A todo can't become a subtask of its own subtask
+	cycle := &pb.Todo{
+		Id:          house.Todo.Id,
+		ListId:      routineID,
+		Description: house.Todo.Description,
+		HasParent:   true,
+		ParentId:    floor.Todo.Id,
+	}
+	_, err = grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: cycle})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on UpdateTodo; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+	_, err = grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: routineID, Description: "Dust the shelves", HasParent: true, ParentId: 999})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on CreateTodo; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+
+	reply, err := grpcApi.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: routineID, Tree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Todos) != 0 {
+		t.Errorf("got %d flat todos on the tree view; want none", len(reply.Todos))
+	}
+	want := []*pb.TodoNode{
+		{Todo: house.Todo, Subtasks: []*pb.TodoNode{
+			{Todo: floor.Todo, Subtasks: []*pb.TodoNode{}},
+		}},
+	}
+	if diff := cmp.Diff(want, reply.Tree,
+		cmpopts.IgnoreUnexported(pb.TodoNode{}),
+		cmpopts.IgnoreUnexported(pb.Todo{})); diff != "" {
+		t.Errorf("GetTodosByList() tree mismatch (-want +got):\n%s", diff)
+	}
+
+	// The subtask is trashed with its parent and can't be restored alone
+	if _, err := grpcApi.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: house.Todo.Id, ListId: routineID}); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := grpcApi.GetTrash(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]uint32{floor.Todo.Id}, trash.Todos[0].SubtaskIds); diff != "" {
+		t.Errorf("GetTrash() subtask IDs mismatch (-want +got):\n%s", diff)
+	}
+	_, err = grpcApi.RestoreTodo(ctx, &pb.RestoreTodoRequest{Id: floor.Todo.Id})
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Errorf("got code %v on RestoreTodo; want %v (error: %v)", got, codes.FailedPrecondition, err)
+	}
+}
+
+func TestGrpcApiDependencies(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workID := todoList.TodoList.Id
+
+	report, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: workID, Description: "Write report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: workID, Description: "Review numbers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := grpcApi.AddDependency(ctx, &pb.DependencyRequest{Id: report.Todo.Id, BlockerId: review.Todo.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.AddDependency(ctx, &pb.DependencyRequest{Id: review.Todo.Id, BlockerId: report.Todo.Id})
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Errorf("got code %v on AddDependency; want %v (error: %v)", got, codes.FailedPrecondition, err)
+	}
+	_, err = grpcApi.AddDependency(ctx, &pb.DependencyRequest{Id: report.Todo.Id, BlockerId: 999})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on AddDependency; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	blockers, err := grpcApi.GetBlockers(ctx, &pb.GetBlockersRequest{Id: report.Todo.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockers.Todos) != 1 || blockers.Todos[0].Id != review.Todo.Id {
+		t.Errorf("got blockers %v; want only todo %d", blockers.Todos, review.Todo.Id)
+	}
+
+	done := &pb.Todo{
+		Id:          report.Todo.Id,
+		ListId:      workID,
+		Description: report.Todo.Description,
+		Done:        true,
+	}
+	_, err = grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: done})
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Errorf("got code %v on UpdateTodo; want %v (error: %v)", got, codes.FailedPrecondition, err)
+	}
+
+	query, err := grpcApi.QueryTodos(ctx, &pb.QueryTodosRequest{ListIds: []uint32{workID}, Unblocked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Todos) != 1 || query.Todos[0].Id != review.Todo.Id {
+		t.Errorf("got unblocked todos %v; want only todo %d", query.Todos, review.Todo.Id)
+	}
+
+	if _, err := grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: done, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := grpcApi.RemoveDependency(ctx, &pb.DependencyRequest{Id: report.Todo.Id, BlockerId: review.Todo.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.RemoveDependency(ctx, &pb.DependencyRequest{Id: report.Todo.Id, BlockerId: review.Todo.Id})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on RemoveDependency; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiRecurrence(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workID := todoList.TodoList.Id
+
+	_, err = grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: workID, Description: "Send the invoice", Recurrence: "FREQ=YEARLY"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on CreateTodo; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+
+	invoice, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{
+		ListId:      workID,
+		Description: "Send the invoice",
+		DueDate:     "2021-01-31T00:00:00Z",
+		Recurrence:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := invoice.Todo
+	done.Done = true
+	if _, err := grpcApi.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: done}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := grpcApi.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: workID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Todos) != 2 {
+		t.Fatalf("got %d todos; want the invoice and its next occurrence", len(reply.Todos))
+	}
+	next := reply.Todos[1]
+	if next.DueDate != "2021-02-28T00:00:00Z" || next.Recurrence != "FREQ=MONTHLY;BYMONTHDAY=-1" || next.Done {
+		t.Errorf("got next occurrence %v; want the invoice due 2021-02-28 with the same rule", next)
+	}
+	if reply.Todos[0].Recurrence != "" {
+		t.Errorf("got recurrence %q on the completed invoice; want none", reply.Todos[0].Recurrence)
+	}
+}
+
+func TestGrpcApiLabels(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := grpcApi.CreateLabel(ctx, &pb.CreateLabelRequest{Name: "chores", Color: "#00ff00"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.CreateLabel(ctx, &pb.CreateLabelRequest{Name: "chores"})
+	if got := status.Code(err); got != codes.AlreadyExists {
+		t.Errorf("got code %v on duplicate CreateLabel; want %v (error: %v)", got, codes.AlreadyExists, err)
+	}
+	_, err = grpcApi.CreateLabel(ctx, &pb.CreateLabelRequest{Name: "a/b"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on invalid CreateLabel; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+
+	_, err = grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.TodoList.Id, Description: "Do the dishes", Labels: []string{"chores"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := grpcApi.RenameLabel(ctx, &pb.RenameLabelRequest{Name: "chores", NewName: "housework"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Label.Name != "housework" || renamed.Label.TodoCount != 1 {
+		t.Errorf("got renamed label %v; want housework on one todo", renamed.Label)
+	}
+
+	update := renamed.Label
+	update.Description = "Around the house"
+	if _, err := grpcApi.UpdateLabel(ctx, &pb.UpdateLabelRequest{Label: update}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.UpdateLabel(ctx, &pb.UpdateLabelRequest{Label: update})
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("got code %v on stale UpdateLabel; want %v (error: %v)", got, codes.Aborted, err)
+	}
+
+	got, err := grpcApi.GetAllLabels(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.Label{
+		{Name: "housework", Color: "#00ff00", Description: "Around the house", Version: 3, TodoCount: 1},
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.Label{}),
+		cmpopts.IgnoreFields(pb.Label{}, "CreatedAt", "UpdatedAt"),
+	}
+	if diff := cmp.Diff(want, got.Labels, ignore...); diff != "" {
+		t.Errorf("GetAllLabels mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := grpcApi.DeleteLabel(ctx, &pb.DeleteLabelRequest{Name: "housework"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.GetLabel(ctx, &pb.GetLabelRequest{Name: "housework"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on GetLabel after delete; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	todos, err := grpcApi.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: todoList.TodoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos.Todos[0].Labels) != 0 {
+		t.Errorf("got labels %v on the todo; want the deleted label removed", todos.Todos[0].Labels)
+	}
+}
+
+func TestGrpcApiComments(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.TodoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hard, err := grpcApi.CreateComment(ctx, &pb.CreateCommentRequest{TodoId: todo.Todo.Id, Author: "bob", Body: "It was hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	harder, err := grpcApi.CreateComment(ctx, &pb.CreateCommentRequest{
+		TodoId:    todo.Todo.Id,
+		HasParent: true,
+		ParentId:  hard.Comment.Id,
+		Author:    "alice",
+		Body:      "Try harder",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = grpcApi.CreateComment(ctx, &pb.CreateCommentRequest{TodoId: todo.Todo.Id})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on empty CreateComment; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+	_, err = grpcApi.CreateComment(ctx, &pb.CreateCommentRequest{TodoId: todo.Todo.Id + 1, Body: "Lost"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on CreateComment for a missing todo; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	update := hard.Comment
+	update.Body = "It was easy"
+	if _, err := grpcApi.UpdateComment(ctx, &pb.UpdateCommentRequest{Comment: update}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.UpdateComment(ctx, &pb.UpdateCommentRequest{Comment: update})
+	if got := status.Code(err); got != codes.Aborted {
+		t.Errorf("got code %v on stale UpdateComment; want %v (error: %v)", got, codes.Aborted, err)
+	}
+
+	got, err := grpcApi.GetComments(ctx, &pb.GetCommentsRequest{TodoId: todo.Todo.Id, Tree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	easy := &pb.Comment{Id: hard.Comment.Id, TodoId: todo.Todo.Id, Author: "bob", Body: "It was easy", Version: 2}
+	want := []*pb.CommentNode{
+		{Comment: easy, Replies: []*pb.CommentNode{{Comment: harder.Comment, Replies: []*pb.CommentNode{}}}},
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.CommentNode{}, pb.Comment{}),
+		cmpopts.IgnoreFields(pb.Comment{}, "CreatedAt", "UpdatedAt"),
+	}
+	if diff := cmp.Diff(want, got.Tree, ignore...); diff != "" {
+		t.Errorf("GetComments mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := grpcApi.DeleteComment(ctx, &pb.DeleteCommentRequest{Id: hard.Comment.Id, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.GetComment(ctx, &pb.GetCommentRequest{Id: harder.Comment.Id})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on GetComment for a deleted reply; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiAttachments(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	dir := t.TempDir()
+	blobs, err := repository.NewBlobStore(dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcApi := NewGrpcApi(repo, blobs)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.TodoList.Id, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The content is split over the messages as the client likes
+	upload := &fakeUploadStream{requests: []*pb.UploadAttachmentRequest{
+		{TodoId: todo.Todo.Id, Name: "notes.txt", Chunk: []byte("Buy ")},
+		{Chunk: []byte{}},
+		{TodoId: todo.Todo.Id + 1, Name: "ignored.txt", Chunk: []byte("new sheets")},
+	}}
+	if err := grpcApi.UploadAttachment(upload); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("Buy new sheets"))
+	notes := &pb.Attachment{
+		Id:          0,
+		TodoId:      todo.Todo.Id,
+		Name:        "notes.txt",
+		ContentType: "text/plain; charset=utf-8",
+		Size:        14,
+		Sha256:      hex.EncodeToString(hash[:]),
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.Attachment{}),
+		cmpopts.IgnoreFields(pb.Attachment{}, "CreatedAt"),
+	}
+	if diff := cmp.Diff(notes, upload.reply.Attachment, ignore...); diff != "" {
+		t.Errorf("UploadAttachment mismatch (-want +got):\n%s", diff)
+	}
+
+	type Test struct {
+		name     string
+		requests []*pb.UploadAttachmentRequest
+		wantCode codes.Code
+	}
+
+	tests := []Test{
+		{
+			name:     "NoMessages",
+			requests: []*pb.UploadAttachmentRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "EmptyName",
+			requests: []*pb.UploadAttachmentRequest{{TodoId: todo.Todo.Id, Chunk: []byte("Buy new sheets")}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "EmptyNameNewContent",
+			requests: []*pb.UploadAttachmentRequest{{TodoId: todo.Todo.Id, Chunk: []byte("Water the plants")}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "TodoNotFound",
+			requests: []*pb.UploadAttachmentRequest{{TodoId: todo.Todo.Id + 1, Name: "notes.txt", Chunk: []byte("Sweep the floor")}},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "TooLarge",
+			requests: []*pb.UploadAttachmentRequest{
+				{TodoId: todo.Todo.Id, Name: "large.txt", Chunk: make([]byte, 60)},
+				{Chunk: make([]byte, 5)},
+			},
+			wantCode: codes.ResourceExhausted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := grpcApi.UploadAttachment(&fakeUploadStream{requests: test.requests})
+			if got := status.Code(err); got != test.wantCode {
+				t.Errorf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+		})
+	}
+
+	// Refused uploads leave no content behind
+	stored := []string{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			stored = append(stored, info.Name())
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{notes.Sha256}, stored); diff != "" {
+		t.Errorf("stored content mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := grpcApi.GetAttachments(ctx, &pb.GetAttachmentsRequest{TodoId: todo.Todo.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*pb.Attachment{notes}, got.Attachments, ignore...); diff != "" {
+		t.Errorf("GetAttachments mismatch (-want +got):\n%s", diff)
+	}
+
+	download := &fakeDownloadStream{}
+	if err := grpcApi.DownloadAttachment(&pb.DownloadAttachmentRequest{Id: notes.Id}, download); err != nil {
+		t.Fatal(err)
+	}
+	if len(download.replies) == 0 {
+		t.Fatal("got no messages on DownloadAttachment")
+	}
+	if diff := cmp.Diff(notes, download.replies[0].Attachment, ignore...); diff != "" {
+		t.Errorf("DownloadAttachment mismatch (-want +got):\n%s", diff)
+	}
+	content := []byte{}
+	for _, reply := range download.replies {
+		content = append(content, reply.Chunk...)
+	}
+	if string(content) != "Buy new sheets" {
+		t.Errorf("got content %q; want %q", content, "Buy new sheets")
+	}
+
+	if _, err := grpcApi.DeleteAttachment(ctx, &pb.DeleteAttachmentRequest{Id: notes.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.GetAttachment(ctx, &pb.GetAttachmentRequest{Id: notes.Id})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on GetAttachment after delete; want %v (error: %v)", got, codes.NotFound, err)
+	}
+	err = grpcApi.DownloadAttachment(&pb.DownloadAttachmentRequest{Id: notes.Id}, &fakeDownloadStream{})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on DownloadAttachment after delete; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiSearch(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Invoices"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice, err := grpcApi.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.TodoList.Id, Description: "Send the invoice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = grpcApi.Search(ctx, &pb.SearchRequest{Query: "?"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on Search; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+
+	reply, err := grpcApi.Search(ctx, &pb.SearchRequest{Query: "invoice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.SearchHit{
+		{TodoList: todoList.TodoList, Todo: invoice.Todo, Fields: []string{"description"}},
+		{TodoList: todoList.TodoList, Fields: []string{"title"}},
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.SearchHit{}, pb.TodoList{}, pb.Todo{}),
+		cmpopts.IgnoreFields(pb.SearchHit{}, "Score"),
+	}
+	if diff := cmp.Diff(want, reply.Hits, ignore...); diff != "" {
+		t.Errorf("Search mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGrpcApiSharing(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	adminCtx := withScopes(ctx, []repository.Scope{repository.ScopeAdmin})
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := grpcApi.CreateUser(adminCtx, &pb.CreateUserRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := grpcApi.CreateUser(adminCtx, &pb.CreateUserRequest{Name: "bob"})
+	if got := status.Code(err); got != codes.AlreadyExists {
+		t.Errorf("got code %v on duplicate CreateUser; want %v (error: %v)", got, codes.AlreadyExists, err)
+	}
+	_, err = grpcApi.CreateUser(ctx, &pb.CreateUserRequest{Name: "carol"})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on anonymous CreateUser; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	_, err = grpcApi.CreateToken(repository.WithActor(ctx, "alice"), &pb.CreateTokenRequest{User: "bob", Scopes: []string{"write"}})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on CreateToken for another user without a token; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	_, err = grpcApi.GetUser(ctx, &pb.GetUserRequest{Name: "carol"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on GetUser; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	aliceCtx := repository.WithActor(ctx, "alice")
+	bobCtx := repository.WithActor(ctx, "bob")
+
+	created, err := grpcApi.CreateTodoList(aliceCtx, &pb.CreateTodoListRequest{Title: "Groceries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.TodoList.Id
+
+	_, err = grpcApi.GetTodoList(bobCtx, &pb.GetTodoListRequest{Id: id})
+	if !errors.Is(err, repository.ErrTodoListNotFound) {
+		t.Errorf("got error %v on GetTodoList before sharing; want %v", err, repository.ErrTodoListNotFound)
+	}
+
+	shared, err := grpcApi.ShareTodoList(aliceCtx, &pb.ShareTodoListRequest{Id: id, Member: &pb.Member{User: "bob", Role: "viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.TodoList{Id: id, Title: "Groceries", Owner: "alice", Members: []*pb.Member{{User: "bob", Role: "viewer"}}}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.TodoList{}, pb.Member{}),
+		cmpopts.IgnoreFields(pb.TodoList{}, "Version", "CreatedAt", "UpdatedAt"),
+	}
+	if diff := cmp.Diff(want, shared.TodoList, ignore...); diff != "" {
+		t.Errorf("ShareTodoList mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = grpcApi.ShareTodoList(aliceCtx, &pb.ShareTodoListRequest{Id: id, Member: &pb.Member{User: "bob", Role: "admin"}})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v on ShareTodoList with an invalid role; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+	if _, err := grpcApi.GetTodoList(bobCtx, &pb.GetTodoListRequest{Id: id}); err != nil {
+		t.Errorf("got error %v on GetTodoList as a viewer; want none", err)
+	}
+	_, err = grpcApi.CreateTodo(bobCtx, &pb.CreateTodoRequest{ListId: id, Description: "Buy milk"})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on CreateTodo as a viewer; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+
+	if _, err := grpcApi.UnshareTodoList(aliceCtx, &pb.UnshareTodoListRequest{Id: id, User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = grpcApi.UnshareTodoList(aliceCtx, &pb.UnshareTodoListRequest{Id: id, User: "bob"})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v on UnshareTodoList of a non member; want %v (error: %v)", got, codes.NotFound, err)
+	}
+
+	users, err := grpcApi.GetAllUsers(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 2 || users.Users[0].Name != "alice" || users.Users[1].Name != "bob" {
+		t.Errorf("got users %v; want alice and bob", users.Users)
+	}
+}
+
+func TestGrpcApiLabelSharing(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	adminCtx := withScopes(ctx, []repository.Scope{repository.ScopeAdmin})
+	aliceCtx := repository.WithActor(ctx, "alice")
+	bobCtx := repository.WithActor(ctx, "bob")
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := grpcApi.CreateUser(adminCtx, &pb.CreateUserRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	created, err := grpcApi.CreateTodoList(aliceCtx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grpcApi.CreateTodo(aliceCtx, &pb.CreateTodoRequest{ListId: created.TodoList.Id, Description: "Make the bed", Labels: []string{"home"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grpcApi.CreateLabel(bobCtx, &pb.CreateLabelRequest{Name: "home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		ctx  context.Context
+		want uint32
+	}{{aliceCtx, 1}, {bobCtx, 0}} {
+		got, err := grpcApi.GetLabel(test.ctx, &pb.GetLabelRequest{Name: "home"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Label.TodoCount != test.want {
+			t.Errorf("got todo count %d as %q; want %d", got.Label.TodoCount, repository.ActorFromContext(test.ctx), test.want)
+		}
+	}
+
+	_, err = grpcApi.RenameLabel(bobCtx, &pb.RenameLabelRequest{Name: "home", NewName: "house"})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on RenameLabel without a role; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	_, err = grpcApi.DeleteLabel(bobCtx, &pb.DeleteLabelRequest{Name: "home"})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on DeleteLabel without a role; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	renamed, err := grpcApi.RenameLabel(aliceCtx, &pb.RenameLabelRequest{Name: "home", NewName: "house"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Label.TodoCount != 1 {
+		t.Errorf("got todo count %d renaming as the owner; want 1", renamed.Label.TodoCount)
+	}
+	if _, err := grpcApi.DeleteLabel(adminCtx, &pb.DeleteLabelRequest{Name: "house"}); err != nil {
+		t.Errorf("got error %v on DeleteLabel with the admin scope; want none", err)
+	}
+}
+
+func TestGrpcApiIdentify(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	if _, err := repo.InsertUser(ctx, repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		name      string
+		auth      AuthOptions
+		md        metadata.MD
+		wantCode  codes.Code
+		wantActor string
+	}
+
+	tests := []Test{
+		{
+			name:     "Anonymous",
+			md:       metadata.MD{},
+			wantCode: codes.OK,
+		},
+		{
+			name:      "KnownUser",
+			auth:      AuthOptions{TrustUserHeader: true},
+			md:        metadata.Pairs(UserMetadata, "alice"),
+			wantCode:  codes.OK,
+			wantActor: "alice",
+		},
+		{
+			name:     "UnknownUser",
+			auth:     AuthOptions{TrustUserHeader: true},
+			md:       metadata.Pairs(UserMetadata, "mallory"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "UntrustedUser",
+			md:       metadata.Pairs(UserMetadata, "alice"),
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grpcApi.Auth = test.auth
+			actor := ""
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				actor = repository.ActorFromContext(ctx)
+				return nil, nil
+			}
+
+			callCtx := metadata.NewIncomingContext(ctx, test.md)
+			_, err := grpcApi.IdentifyUnary(callCtx, nil, &grpc.UnaryServerInfo{}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+			if actor != test.wantActor {
+				t.Errorf("got actor %q; want %q", actor, test.wantActor)
+			}
+		})
+	}
+}
+
+func TestGrpcApiTokens(t *testing.T) {
+	const adminToken = "admin-secret"
+
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	grpcApi.Auth = AuthOptions{Required: true, AdminToken: adminToken}
+
+	adminCtx := withScopes(ctx, []repository.Scope{repository.ScopeAdmin})
+	if _, err := grpcApi.CreateUser(adminCtx, &pb.CreateUserRequest{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := grpcApi.CreateToken(adminCtx, &pb.CreateTokenRequest{User: "alice", Name: "dashboard", Scopes: []string{"read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := created.Secret
+
+	readerCtx := withScopes(repository.WithActor(ctx, "alice"), []repository.Scope{repository.ScopeRead})
+	_, err = grpcApi.CreateToken(readerCtx, &pb.CreateTokenRequest{Scopes: []string{"write"}})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on CreateToken with a wider scope; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	_, err = grpcApi.CreateUser(readerCtx, &pb.CreateUserRequest{Name: "bob"})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on CreateUser without the admin scope; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	tokens, err := grpcApi.GetTokens(readerCtx, &pb.GetTokensRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.Token{{Id: 0, User: "alice", Name: "dashboard", Scopes: []string{"read"}}}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.Token{}),
+		cmpopts.IgnoreFields(pb.Token{}, "CreatedAt"),
+	}
+	if diff := cmp.Diff(want, tokens.Tokens, ignore...); diff != "" {
+		t.Errorf("GetTokens mismatch (-want +got):\n%s", diff)
+	}
+
+	type Test struct {
+		name      string
+		md        metadata.MD
+		method    string
+		wantCode  codes.Code
+		wantActor string
+	}
+
+	tests := []Test{
+		{
+			name:     "NoToken",
+			md:       metadata.MD{},
+			method:   "/todoer.Todoer/GetTodoList",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "UserWithoutToken",
+			md:       metadata.Pairs(UserMetadata, "alice"),
+			method:   "/todoer.Todoer/GetTodoList",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "WrongToken",
+			md:       metadata.Pairs(AuthorizationMetadata, "Bearer wrong"),
+			method:   "/todoer.Todoer/GetTodoList",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:      "Read",
+			md:        metadata.Pairs(AuthorizationMetadata, "Bearer "+reader),
+			method:    "/todoer.Todoer/GetTodoList",
+			wantCode:  codes.OK,
+			wantActor: "alice",
+		},
+		{
+			name:     "WriteWithReadScope",
+			md:       metadata.Pairs(AuthorizationMetadata, "Bearer "+reader),
+			method:   "/todoer.Todoer/CreateTodoList",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "AdminToken",
+			md:       metadata.Pairs(AuthorizationMetadata, "bearer "+adminToken),
+			method:   "/todoer.Todoer/CreateTodoList",
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor := ""
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				actor = repository.ActorFromContext(ctx)
+				return nil, nil
+			}
+
+			callCtx := metadata.NewIncomingContext(ctx, test.md)
+			_, err := grpcApi.IdentifyUnary(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+			if actor != test.wantActor {
+				t.Errorf("got actor %q; want %q", actor, test.wantActor)
+			}
+		})
+	}
+
+	if _, err := grpcApi.DeleteToken(adminCtx, &pb.DeleteTokenRequest{Id: 0}); err != nil {
+		t.Fatal(err)
+	}
+	callCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(AuthorizationMetadata, "Bearer "+reader))
+	_, err = grpcApi.IdentifyUnary(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: "/todoer.Todoer/GetTodoList"}, nil)
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("got code %v with a deleted token; want %v (error: %v)", got, codes.Unauthenticated, err)
+	}
+}
+
+func TestGrpcApiJWT(t *testing.T) {
+	rsaKey, _ := newTestKeys(t)
+	keys := NewKeySet()
+	if err := keys.Add("sso", &rsaKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	grpcApi := NewGrpcApi(repository.NewLocalStorage(), nil)
+	grpcApi.Auth = AuthOptions{
+		Required: true,
+		JWT:      &JWTVerifier{Keys: keys, Audience: "todoer"},
+	}
+
+	sign := func(changes map[string]interface{}) string {
+		claims := map[string]interface{}{
+			"sub":   "alice",
+			"aud":   "todoer",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"email": "alice@example.com",
+		}
+		for k, v := range changes {
+			claims[k] = v
+		}
+		return signJWT(t, AlgRS256, "sso", rsaKey, claims)
+	}
+
+	type Test struct {
+		name      string
+		token     string
+		method    string
+		wantCode  codes.Code
+		wantActor string
+		wantEmail string
+	}
+
+	tests := []Test{
+		{
+			name:      "Valid",
+			token:     sign(nil),
+			method:    "/todoer.Todoer/CreateTodoList",
+			wantCode:  codes.OK,
+			wantActor: "alice",
+			wantEmail: "alice@example.com",
+		},
+		{
+			name:     "ReadScope",
+			token:    sign(map[string]interface{}{"scope": "read"}),
+			method:   "/todoer.Todoer/CreateTodoList",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "WrongAudience",
+			token:    sign(map[string]interface{}{"aud": "other"}),
+			method:   "/todoer.Todoer/GetTodoList",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "Expired",
+			token:    sign(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+			method:   "/todoer.Todoer/GetTodoList",
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, email := "", ""
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				actor = repository.ActorFromContext(ctx)
+				if claims, ok := ClaimsFromContext(ctx); ok {
+					email, _ = claims.Raw["email"].(string)
+				}
+				return nil, nil
+			}
+
+			callCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(AuthorizationMetadata, "Bearer "+test.token))
+			_, err := grpcApi.IdentifyUnary(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+			if actor != test.wantActor || email != test.wantEmail {
+				t.Errorf("got actor %q and email %q; want %q and %q", actor, email, test.wantActor, test.wantEmail)
+			}
+		})
+	}
+}
+
+func TestGrpcApiRateLimit(t *testing.T) {
+	grpcApi := NewGrpcApi(repository.NewLocalStorage(), nil)
+	grpcApi.Limiter = NewRateLimiter(RateLimits{
+		Read:           Limit{Rate: 0.01, Burst: 2},
+		Write:          Limit{Rate: 0.01, Burst: 1},
+		Routes:         map[string]Limit{"Search": {Rate: 0.01, Burst: 1}},
+		ClientIPHeader: "X-Forwarded-For",
+	})
+
+	type Step struct {
+		md       metadata.MD
+		method   string
+		wantCode codes.Code
+	}
+
+	steps := []Step{
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.OK},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.ResourceExhausted},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/GetTodoList", wantCode: codes.OK},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/Search", wantCode: codes.OK},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/Search", wantCode: codes.ResourceExhausted},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/GetAllTodoLists", wantCode: codes.OK},
+		{md: metadata.Pairs(UserMetadata, "alice"), method: "/todoer.Todoer/GetAllTodoLists", wantCode: codes.ResourceExhausted},
+		{md: metadata.Pairs(AuthorizationMetadata, "Bearer some-token"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.OK},
+		{md: metadata.Pairs("x-forwarded-for", "203.0.113.7"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.OK},
+		{md: metadata.Pairs("x-forwarded-for", "203.0.113.7"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.ResourceExhausted},
+		{md: metadata.Pairs("x-forwarded-for", "203.0.113.8"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.OK},
+		{md: metadata.Pairs("x-forwarded-for", "198.51.100.1, 203.0.113.8"), method: "/todoer.Todoer/CreateTodoList", wantCode: codes.ResourceExhausted},
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for i, step := range steps {
+		callCtx := metadata.NewIncomingContext(ctx, step.md)
+		if users := step.md.Get(UserMetadata); len(users) > 0 {
+			callCtx = repository.WithActor(callCtx, users[0])
+		}
+		_, err := grpcApi.RateLimitUnary(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: step.method}, handler)
+		if got := status.Code(err); got != step.wantCode {
+			t.Fatalf("step %d: %s: got code %v; want %v (error: %v)", i, step.method, got, step.wantCode, err)
+		}
+	}
+}
+
+func TestGrpcApiRateLimitUnverified(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+	grpcApi.Auth = AuthOptions{Required: true}
+	grpcApi.Limiter = NewRateLimiter(RateLimits{Write: Limit{Rate: 0.01, Burst: 2}})
+
+	if _, err := repo.InsertUser(ctx, repository.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	token := repository.Token{User: "alice", Hash: repository.HashToken("alice-secret"), Scopes: []repository.Scope{repository.ScopeWrite}}
+	if _, err := repo.InsertToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	type Step struct {
+		secret   string
+		wantCode codes.Code
+	}
+
+	steps := []Step{
+		{secret: "alice-secret", wantCode: codes.OK},
+		{secret: "alice-secret", wantCode: codes.OK},
+		{secret: "wrong", wantCode: codes.Unauthenticated},
+		{wantCode: codes.Unauthenticated},
+		{secret: "wrong", wantCode: codes.ResourceExhausted},
+		{secret: "alice-secret", wantCode: codes.ResourceExhausted},
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/todoer.Todoer/CreateTodoList"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	identified := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return grpcApi.IdentifyUnary(ctx, req, info, handler)
+	}
+	for i, step := range steps {
+		md := metadata.MD{}
+		if step.secret != "" {
+			md = metadata.Pairs(AuthorizationMetadata, "Bearer "+step.secret)
+		}
+		callCtx := metadata.NewIncomingContext(ctx, md)
+		_, err := grpcApi.RateLimitUnverifiedUnary(callCtx, nil, info, identified)
+		if got := status.Code(err); got != step.wantCode {
+			t.Fatalf("step %d: got code %v; want %v (error: %v)", i, got, step.wantCode, err)
+		}
+	}
+}
+
+func TestGrpcApiTodoTxt(t *testing.T) {
+	grpcApi := NewGrpcApi(repository.NewLocalStorage(), nil)
+
+	todoList, err := grpcApi.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "(A) 2021-03-01 Call mom +family @phone due:2021-03-05\nx 2021-03-02 2021-03-01 Make the bed pri:B\n"
+
+	imported, err := grpcApi.ImportTodoTxt(ctx, &pb.ImportTodoTxtRequest{ListId: todoList.TodoList.Id, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.Todo{
+		{Id: 0, ListId: todoList.TodoList.Id, Description: "Call mom", Labels: []string{"priority:A", "family", "@phone"}, DueDate: "2021-03-05T00:00:00Z", CreatedAt: "2021-03-01T00:00:00Z", Position: 0},
+		{Id: 1, ListId: todoList.TodoList.Id, Description: "Make the bed", Labels: []string{"priority:B"}, Done: true, CreatedAt: "2021-03-01T00:00:00Z", CompletedAt: "2021-03-02T00:00:00Z", Position: 1},
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.Todo{}),
+		cmpopts.IgnoreFields(pb.Todo{}, "Version", "UpdatedAt"),
+	}
+	if diff := cmp.Diff(want, imported.Todos, ignore...); diff != "" {
+		t.Errorf("ImportTodoTxt mismatch (-want +got):\n%s", diff)
+	}
+
+	exported, err := grpcApi.ExportTodoTxt(ctx, &pb.ExportTodoTxtRequest{ListId: todoList.TodoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(content, exported.Content); diff != "" {
+		t.Errorf("ExportTodoTxt mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = grpcApi.ImportTodoTxt(ctx, &pb.ImportTodoTxtRequest{ListId: todoList.TodoList.Id, Content: "Pay the rent due:tomorrow"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v importing an invalid task; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+	_, err = grpcApi.ImportTodoTxt(ctx, &pb.ImportTodoTxtRequest{ListId: todoList.TodoList.Id + 1, Content: content})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v importing on an unknown todo list; want %v (error: %v)", got, codes.NotFound, err)
+	}
+	_, err = grpcApi.ExportTodoTxt(ctx, &pb.ExportTodoTxtRequest{ListId: todoList.TodoList.Id + 1})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v exporting an unknown todo list; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiCalendar(t *testing.T) {
+	repo := repository.NewLocalStorage()
+	grpcApi := NewGrpcApi(repo, nil)
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := repo.InsertUser(ctx, repository.User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aliceCtx := repository.WithActor(ctx, "alice")
+	bobCtx := repository.WithActor(ctx, "bob")
+	todoList, err := grpcApi.CreateTodoList(aliceCtx, &pb.CreateTodoListRequest{Title: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listID := todoList.TodoList.Id
+	content := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTODO",
+		"UID:rent",
+		"CREATED:20210301T000000Z",
+		"SUMMARY:Pay the rent",
+		"DUE;VALUE=DATE:20210305",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	imported, err := grpcApi.ImportCalendar(aliceCtx, &pb.ImportCalendarRequest{ListId: listID, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pb.Todo{
+		{Id: 0, ListId: listID, Description: "Pay the rent", DueDate: "2021-03-05T00:00:00Z", CreatedAt: "2021-03-01T00:00:00Z"},
+	}
+	ignore := []cmp.Option{
+		cmpopts.IgnoreUnexported(pb.Todo{}),
+		cmpopts.IgnoreFields(pb.Todo{}, "Version", "UpdatedAt"),
+	}
+	if diff := cmp.Diff(want, imported.Todos, ignore...); diff != "" {
+		t.Errorf("ImportCalendar mismatch (-want +got):\n%s", diff)
+	}
+
+	exported, err := grpcApi.ExportCalendar(aliceCtx, &pb.ExportCalendarRequest{ListId: listID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(exported.Content, "UID:todo-0@todoer\r\n") || !strings.Contains(exported.Content, "SUMMARY:Pay the rent\r\nDUE;VALUE=DATE:20210305\r\n") {
+		t.Errorf("ExportCalendar has no todo:\n%s", exported.Content)
+	}
+
+	created, err := grpcApi.CreateCalendarToken(aliceCtx, &pb.CalendarTokenRequest{ListId: listID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("/todolist/%d/calendar.ics?token=%s", listID, created.Token); created.Url != want {
+		t.Errorf("CreateCalendarToken got URL %q; want %q", created.Url, want)
+	}
+	found, err := repo.GetTodoListByFeedToken(ctx, repository.HashToken(created.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != listID {
+		t.Errorf("feed token reads todo list %d; want %d", found.ID, listID)
+	}
+	_, err = grpcApi.DeleteCalendarToken(bobCtx, &pb.CalendarTokenRequest{ListId: listID})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v deleting the feed token of another user; want %v (error: %v)", got, codes.NotFound, err)
+	}
+	if _, err := grpcApi.DeleteCalendarToken(aliceCtx, &pb.CalendarTokenRequest{ListId: listID}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken(created.Token))
+	if !errors.Is(err, repository.ErrTodoListNotFound) {
+		t.Errorf("got error %v finding a deleted feed token; want %v", err, repository.ErrTodoListNotFound)
+	}
+
+	_, err = grpcApi.ImportCalendar(aliceCtx, &pb.ImportCalendarRequest{ListId: listID, Content: "SUMMARY:Pay the rent"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got code %v importing an invalid calendar; want %v (error: %v)", got, codes.InvalidArgument, err)
+	}
+	_, err = grpcApi.ImportCalendar(bobCtx, &pb.ImportCalendarRequest{ListId: listID, Content: content})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v importing on a todo list of another user; want %v (error: %v)", got, codes.NotFound, err)
+	}
+	_, err = grpcApi.ExportCalendar(aliceCtx, &pb.ExportCalendarRequest{ListId: listID + 1})
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("got code %v exporting an unknown todo list; want %v (error: %v)", got, codes.NotFound, err)
+	}
+}
+
+func TestGrpcApiBackup(t *testing.T) {
+	source := NewGrpcApi(repository.NewLocalStorage(), nil)
+	source.Auth = AuthOptions{Required: true}
+	todoList, err := source.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.CreateTodo(ctx, &pb.CreateTodoRequest{ListId: todoList.TodoList.Id, Description: "Make the bed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	adminCtx := withScopes(ctx, []repository.Scope{repository.ScopeAdmin})
+	writerCtx := withScopes(ctx, []repository.Scope{repository.ScopeWrite})
+
+	err = source.Backup(&pb.Empty{}, &fakeBackupStream{ctx: writerCtx})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on Backup without the admin scope; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	backup := &fakeBackupStream{ctx: adminCtx}
+	if err := source.Backup(&pb.Empty{}, backup); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for _, reply := range backup.replies {
+		data = append(data, reply.Chunk...)
+	}
+
+	// The backup is split over the messages as the client likes
+	half := len(data) / 2
+	requests := []*pb.RestoreRequest{
+		{Mode: "replace", Chunk: data[:half]},
+		{Chunk: []byte{}},
+		{Mode: "merge", Chunk: data[half:]},
+	}
+	target := NewGrpcApi(repository.NewLocalStorage(), nil)
+	target.Auth = AuthOptions{Required: true}
+	if _, err := target.CreateTodoList(ctx, &pb.CreateTodoListRequest{Title: "Replaced"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Restore(&fakeRestoreStream{ctx: adminCtx, requests: requests}); err != nil {
+		t.Fatal(err)
+	}
+	want, err := source.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: todoList.TodoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := target.GetTodosByList(ctx, &pb.GetTodosByListRequest{ListId: todoList.TodoList.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(pb.GetTodosByListReply{}, pb.Todo{})); diff != "" {
+		t.Errorf("restored todos mismatch (-want +got):\n%s", diff)
+	}
+	todoLists, err := target.GetAllTodoLists(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todoLists.TodoLists) != 1 || todoLists.TodoLists[0].Title != "Routine" {
+		t.Errorf("got todo lists %v after replacing; want only Routine", todoLists.TodoLists)
+	}
+
+	type Test struct {
+		name     string
+		ctx      context.Context
+		requests []*pb.RestoreRequest
+		wantCode codes.Code
+	}
+
+	tests := []Test{
+		{
+			name:     "NoMessages",
+			ctx:      adminCtx,
+			requests: []*pb.RestoreRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "UnknownMode",
+			ctx:      adminCtx,
+			requests: []*pb.RestoreRequest{{Mode: "append", Chunk: data}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "InvalidBackup",
+			ctx:      adminCtx,
+			requests: []*pb.RestoreRequest{{Chunk: []byte(`{"version": 99}`)}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "NoAdminScope",
+			ctx:      writerCtx,
+			requests: []*pb.RestoreRequest{{Chunk: data}},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "NoToken",
+			ctx:      ctx,
+			requests: []*pb.RestoreRequest{{Chunk: data}},
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := target.Restore(&fakeRestoreStream{ctx: test.ctx, requests: test.requests})
+			if got := status.Code(err); got != test.wantCode {
+				t.Errorf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+		})
+	}
+
+	// Without required authentication or an admin token, even the admin
+	// scope of a JWT is not enough
+	open := NewGrpcApi(repository.NewLocalStorage(), nil)
+	err = open.Backup(&pb.Empty{}, &fakeBackupStream{ctx: adminCtx})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on Backup with backups disabled; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+	err = open.Restore(&fakeRestoreStream{ctx: adminCtx, requests: requests})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Errorf("got code %v on Restore with backups disabled; want %v (error: %v)", got, codes.PermissionDenied, err)
+	}
+}
+
+func TestGrpcApiHonorsContext(t *testing.T) {
+	type Test struct {
+		name     string
+		ctx      func() (context.Context, context.CancelFunc)
+		wantCode codes.Code
+	}
+
+	tests := []Test{
+		{
+			name: "CanceledCall",
+			ctx: func() (context.Context, context.CancelFunc) {
+				c, cancel := context.WithCancel(ctx)
+				cancel()
+				return c, cancel
+			},
+			wantCode: codes.Canceled,
+		},
+		{
+			name: "DeadlineExceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(ctx, -time.Second)
+			},
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := repository.NewLocalStorage()
+			grpcApi := NewGrpcApi(repo, nil)
+
+			callCtx, cancel := test.ctx()
+			defer cancel()
+
+			_, err := grpcApi.CreateTodoList(callCtx, validCreateTodoListRequest(t))
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("got code %v; want %v (error: %v)", got, test.wantCode, err)
+			}
+
+			todoLists, err := repo.GetAllTodoLists(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(todoLists) != 0 {
+				t.Errorf("got %d todo lists; want none created after %v", len(todoLists), test.wantCode)
+			}
+		})
+	}
+}
+
+// fakeUploadStream is the server side of an upload sending requests.
+type fakeUploadStream struct {
+	grpc.ServerStream
+	requests []*pb.UploadAttachmentRequest
+	reply    *pb.UploadAttachmentReply
+}
+
+func (s *fakeUploadStream) Context() context.Context {
+	return ctx
+}
+
+func (s *fakeUploadStream) Recv() (*pb.UploadAttachmentRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakeUploadStream) SendAndClose(reply *pb.UploadAttachmentReply) error {
+	s.reply = reply
+	return nil
+}
+
+// fakeDownloadStream is the server side of a download, keeping every reply.
+type fakeDownloadStream struct {
+	grpc.ServerStream
+	replies []*pb.DownloadAttachmentReply
+}
+
+func (s *fakeDownloadStream) Context() context.Context {
+	return ctx
+}
+
+func (s *fakeDownloadStream) Send(reply *pb.DownloadAttachmentReply) error {
+	s.replies = append(s.replies, reply)
+	return nil
+}
+
+// fakeBackupStream is the server side of a backup, keeping every reply.
+type fakeBackupStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	replies []*pb.BackupReply
+}
+
+func (s *fakeBackupStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeBackupStream) Send(reply *pb.BackupReply) error {
+	s.replies = append(s.replies, reply)
+	return nil
+}
+
+type fakeRestoreStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	requests []*pb.RestoreRequest
+}
+
+func (s *fakeRestoreStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeRestoreStream) Recv() (*pb.RestoreRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakeRestoreStream) SendAndClose(reply *pb.Empty) error {
+	return nil
+}
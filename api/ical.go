@@ -0,0 +1,571 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// ErrInvalidCalendar is returned when an iCalendar file can't be read, or
+// has a VTODO that can't be imported.
+var ErrInvalidCalendar = errors.New("calendar is invalid")
+
+const (
+	// icalProductID names todoer as the writer of calendars.
+	icalProductID = "-//todoer//todoer//EN"
+	// icalDateTimeLayout is how iCalendar writes times in UTC.
+	icalDateTimeLayout = "20060102T150405Z"
+	// icalLocalTimeLayout is how iCalendar writes times on a time zone, or
+	// floating ones.
+	icalLocalTimeLayout = "20060102T150405"
+	// icalDateLayout is how iCalendar writes dates.
+	icalDateLayout = "20060102"
+	// icalLineOctets is the longest content line written before folding.
+	icalLineOctets = 75
+	// icalMaxLine is the longest line read from an iCalendar file.
+	icalMaxLine = 1 << 20
+)
+
+// calendarTodo is a todo as a VTODO. Todos are told apart by their UID,
+// which subtasks use to name their parent. The description holds the
+// comments of the todo.
+type calendarTodo struct {
+	UID         string
+	ParentUID   string
+	Todo        repository.Todo
+	Description string
+}
+
+// todoUID returns the UID of the VTODO of a todo.
+func todoUID(id uint32) string {
+	return fmt.Sprintf("todo-%d@todoer", id)
+}
+
+// newCalendarTodo returns a todo as a VTODO, describing it with its
+// comments, oldest first.
+func newCalendarTodo(todo repository.Todo, comments []repository.Comment) calendarTodo {
+	calendarTodo := calendarTodo{UID: todoUID(todo.ID), Todo: todo}
+	if todo.ParentID != nil {
+		calendarTodo.ParentUID = todoUID(*todo.ParentID)
+	}
+
+	parts := []string{}
+	for _, comment := range comments {
+		if comment.Author != "" {
+			parts = append(parts, comment.Author+": "+comment.Body)
+		} else {
+			parts = append(parts, comment.Body)
+		}
+	}
+	calendarTodo.Description = strings.Join(parts, "\n\n")
+	return calendarTodo
+}
+
+// formatCalendar writes todos to w as an RFC 5545 calendar named after a
+// todo list, with a VTODO for each todo. Every VTODO is stamped with the
+// last change of its todo, so the same todos always give the same calendar.
+func formatCalendar(w io.Writer, title string, todos []calendarTodo) error {
+	bw := bufio.NewWriter(w)
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icalProductID,
+		"X-WR-CALNAME:" + escapeICalText(title),
+	}
+	for _, todo := range todos {
+		lines = append(lines, formatVTodo(todo)...)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := bw.WriteString(foldICalLine(line)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func formatVTodo(calendarTodo calendarTodo) []string {
+	todo := calendarTodo.Todo
+	modifiedAt := todo.UpdatedAt
+	if modifiedAt.IsZero() {
+		modifiedAt = todo.CreatedAt
+	}
+
+	lines := []string{
+		"BEGIN:VTODO",
+		"UID:" + escapeICalText(calendarTodo.UID),
+		"DTSTAMP:" + formatICalDateTime(modifiedAt),
+	}
+	if !todo.CreatedAt.IsZero() {
+		lines = append(lines, "CREATED:"+formatICalDateTime(todo.CreatedAt))
+	}
+	if !todo.UpdatedAt.IsZero() {
+		lines = append(lines, "LAST-MODIFIED:"+formatICalDateTime(todo.UpdatedAt))
+	}
+	lines = append(lines, "SUMMARY:"+escapeICalText(todo.Description))
+	if !todo.DueDate.IsZero() {
+		lines = append(lines, formatICalDue(todo.DueDate))
+	}
+	if todo.Done {
+		lines = append(lines, "STATUS:COMPLETED")
+		if !todo.CompletedAt.IsZero() {
+			lines = append(lines, "COMPLETED:"+formatICalDateTime(todo.CompletedAt))
+		}
+	} else {
+		lines = append(lines, "STATUS:NEEDS-ACTION")
+	}
+	if len(todo.Labels) > 0 {
+		categories := []string{}
+		for _, label := range todo.Labels {
+			categories = append(categories, escapeICalText(label))
+		}
+		lines = append(lines, "CATEGORIES:"+strings.Join(categories, ","))
+	}
+	if calendarTodo.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeICalText(calendarTodo.Description))
+	}
+	if calendarTodo.ParentUID != "" {
+		lines = append(lines, "RELATED-TO;RELTYPE=PARENT:"+escapeICalText(calendarTodo.ParentUID))
+	}
+	if todo.Recurrence != nil {
+		lines = append(lines, "RRULE:"+todo.Recurrence.String())
+	}
+	return append(lines, "END:VTODO")
+}
+
+// formatICalDue writes due dates at midnight UTC as a date, and any other
+// as a time in UTC, so none is rounded.
+func formatICalDue(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return "DUE;VALUE=DATE:" + t.Format(icalDateLayout)
+	}
+	return "DUE:" + formatICalDateTime(t)
+}
+
+func formatICalDateTime(t time.Time) string {
+	return t.UTC().Format(icalDateTimeLayout)
+}
+
+// escapeICalText escapes the characters iCalendar text can't have as is.
+// Carriage returns are dropped, as line breaks are written as \n.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// unescapeICalText undoes escapeICalText.
+func unescapeICalText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitICalList splits a list of text values on the commas that are not
+// escaped, unescaping each value.
+func splitICalList(s string) []string {
+	values := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescapeICalText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescapeICalText(s[start:]))
+}
+
+// foldICalLine ends a content line with CRLF, breaking it into lines of at
+// most icalLineOctets octets, the ones after the first starting with a
+// space. Characters are never broken apart.
+func foldICalLine(line string) string {
+	b := strings.Builder{}
+	limit := icalLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icalLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// icalLine is a content line of an iCalendar file, with its name and the
+// names of its parameters in upper case.
+type icalLine struct {
+	number int
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseCalendar reads the VTODOs of an iCalendar file, in order. Other
+// components, like events or the alarms of a VTODO, are skipped. Times on a
+// time zone or floating ones are taken at the time zone named by their
+// TZID, or else in UTC.
+func parseCalendar(r io.Reader) ([]calendarTodo, error) {
+	lines, err := readICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0].name != "BEGIN" || !strings.EqualFold(lines[0].value, "VCALENDAR") {
+		return nil, fmt.Errorf("%w: it does not start with BEGIN:VCALENDAR", ErrInvalidCalendar)
+	}
+
+	todos := []calendarTodo{}
+	components := []string{}
+	var todo *calendarTodo
+	hasStatus := false
+	for _, line := range lines {
+		switch line.name {
+		case "BEGIN":
+			component := strings.ToUpper(line.value)
+			if component == "VTODO" && len(components) == 1 {
+				todo = &calendarTodo{}
+				hasStatus = false
+			}
+			components = append(components, component)
+			continue
+		case "END":
+			component := strings.ToUpper(line.value)
+			if len(components) == 0 || components[len(components)-1] != component {
+				return nil, fmt.Errorf("%w: line %d: END:%s does not close a component", ErrInvalidCalendar, line.number, line.value)
+			}
+			components = components[:len(components)-1]
+			if todo != nil && len(components) == 1 {
+				if todo.Todo.Description == "" {
+					return nil, fmt.Errorf("%w: line %d: VTODO has no SUMMARY", ErrInvalidCalendar, line.number)
+				}
+				// A completion time without a status also marks the todo
+				// done, and the rule of a done todo was moved over to its
+				// next occurrence
+				if !hasStatus && !todo.Todo.CompletedAt.IsZero() {
+					todo.Todo.Done = true
+				}
+				if todo.Todo.Done {
+					todo.Todo.Recurrence = nil
+				} else {
+					todo.Todo.CompletedAt = time.Time{}
+				}
+				todos = append(todos, *todo)
+				todo = nil
+			}
+			continue
+		}
+
+		if todo == nil || len(components) != 2 {
+			continue
+		}
+		if line.name == "STATUS" {
+			hasStatus = true
+		}
+		if err := parseVTodoProperty(todo, line); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCalendar, line.number, err)
+		}
+	}
+	if len(components) > 0 {
+		return nil, fmt.Errorf("%w: BEGIN:%s is never closed", ErrInvalidCalendar, components[len(components)-1])
+	}
+	return todos, nil
+}
+
+func parseVTodoProperty(todo *calendarTodo, line icalLine) error {
+	var err error
+	switch line.name {
+	case "UID":
+		todo.UID = unescapeICalText(line.value)
+	case "SUMMARY":
+		todo.Todo.Description = strings.TrimSpace(unescapeICalText(line.value))
+	case "DESCRIPTION":
+		todo.Description = strings.TrimSpace(unescapeICalText(line.value))
+	case "DUE":
+		todo.Todo.DueDate, err = parseICalTime(line)
+	case "CREATED":
+		todo.Todo.CreatedAt, err = parseICalTime(line)
+	case "COMPLETED":
+		todo.Todo.CompletedAt, err = parseICalTime(line)
+	case "STATUS":
+		todo.Todo.Done = strings.EqualFold(line.value, "COMPLETED")
+	case "CATEGORIES":
+		for _, category := range splitICalList(line.value) {
+			if category = strings.TrimSpace(category); category != "" {
+				todo.Todo.Labels = append(todo.Todo.Labels, category)
+			}
+		}
+	case "RELATED-TO":
+		if relType := line.params["RELTYPE"]; relType == "" || strings.EqualFold(relType, "PARENT") {
+			todo.ParentUID = unescapeICalText(line.value)
+		}
+	case "RRULE":
+		todo.Todo.Recurrence, err = repository.ParseRecurrence(line.value)
+	}
+	return err
+}
+
+// parseICalTime reads the date or time on a property. Dates are taken at
+// midnight UTC.
+func parseICalTime(line icalLine) (time.Time, error) {
+	value := line.value
+	if strings.EqualFold(line.params["VALUE"], "DATE") || len(value) == len(icalDateLayout) {
+		t, err := time.Parse(icalDateLayout, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s %q is not a date", line.name, value)
+		}
+		return t, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icalDateTimeLayout, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s %q is not a time", line.name, value)
+		}
+		return t, nil
+	}
+
+	location := time.UTC
+	if tzid := line.params["TZID"]; tzid != "" {
+		var err error
+		location, err = time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s time zone %q is unknown", line.name, tzid)
+		}
+	}
+	t, err := time.ParseInLocation(icalLocalTimeLayout, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s %q is not a time", line.name, value)
+	}
+	return t.UTC(), nil
+}
+
+// readICalLines reads the content lines of an iCalendar file, unfolding
+// them and skipping blank ones.
+func readICalLines(r io.Reader) ([]icalLine, error) {
+	lines := []icalLine{}
+	folded := []string{}
+	start := 0
+	flush := func() error {
+		if len(folded) == 0 {
+			return nil
+		}
+		line, err := parseICalLine(strings.Join(folded, ""))
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrInvalidCalendar, start, err)
+		}
+		line.number = start
+		lines = append(lines, line)
+		folded = folded[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, icalMaxLine)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := scanner.Text()
+		if len(folded) > 0 && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) {
+			folded = append(folded, text[1:])
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		folded = append(folded, text)
+		start = number
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidCalendar, number+1, icalMaxLine)
+		}
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseICalLine splits a content line like NAME;PARAM=VALUE:VALUE. Parameter
+// values may be quoted, to have colons and semicolons.
+func parseICalLine(text string) (icalLine, error) {
+	line := icalLine{params: map[string]string{}}
+
+	quoted := false
+	colon := -1
+	for i := 0; i < len(text) && colon < 0; i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return line, fmt.Errorf("%.40q has no value", text)
+	}
+	line.value = text[colon+1:]
+
+	parts := []string{}
+	start := 0
+	quoted = false
+	for i := 0; i < colon; i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, text[start:colon])
+
+	line.name = strings.ToUpper(parts[0])
+	if line.name == "" {
+		return line, fmt.Errorf("%.40q has no name", text)
+	}
+	for _, param := range parts[1:] {
+		i := strings.Index(param, "=")
+		if i <= 0 {
+			return line, fmt.Errorf("parameter %q of %s has no value", param, line.name)
+		}
+		value := param[i+1:]
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		line.params[strings.ToUpper(param[:i])] = value
+	}
+	return line, nil
+}
+
+// exportCalendar writes the calendar of a todo list to w, with its todos
+// described by their comments.
+func exportCalendar(ctx context.Context, repo repository.Repository, listID uint32, w io.Writer) error {
+	todoList, err := repo.GetTodoListByID(ctx, listID)
+	if err != nil {
+		return err
+	}
+	todos, err := repo.GetTodosByListID(ctx, listID)
+	if err != nil {
+		return err
+	}
+
+	calendarTodos := []calendarTodo{}
+	for _, todo := range todos {
+		comments, err := repo.GetComments(ctx, todo.ID)
+		if err != nil {
+			return err
+		}
+		calendarTodos = append(calendarTodos, newCalendarTodo(todo, comments))
+	}
+	return formatCalendar(w, todoList.Title, calendarTodos)
+}
+
+// importCalendar inserts todos read from a calendar at the end of a todo
+// list, returning them as inserted. Subtasks are inserted after their
+// parent, under it, while the ones whose parent is not on the calendar
+// become top-level todos. The description of each VTODO becomes a comment.
+// An error stops the import, keeping the todos inserted before it.
+func importCalendar(ctx context.Context, repo repository.Repository, listID uint32, todos []calendarTodo) ([]repository.Todo, error) {
+	// An unknown todo list is not found even with nothing to import
+	if _, err := repo.GetTodoListByID(ctx, listID); err != nil {
+		return nil, err
+	}
+
+	onCalendar := map[string]bool{}
+	for _, todo := range todos {
+		if todo.UID != "" {
+			onCalendar[todo.UID] = true
+		}
+	}
+
+	// Each pass inserts the todos whose parent was inserted, until only
+	// the ones on a cycle are left, which become top-level todos
+	ids := map[string]uint32{}
+	imported := []repository.Todo{}
+	inserted := make([]bool, len(todos))
+	for left, cycle := len(todos), false; left > 0; {
+		progress := false
+		for i, todo := range todos {
+			if inserted[i] {
+				continue
+			}
+			parentID, ok := ids[todo.ParentUID]
+			hasParent := todo.ParentUID != "" && todo.ParentUID != todo.UID && onCalendar[todo.ParentUID]
+			if hasParent && !ok && !cycle {
+				continue
+			}
+
+			todo.Todo.ListID = listID
+			todo.Todo.ParentID = nil
+			if hasParent && ok {
+				todo.Todo.ParentID = &parentID
+			}
+			newTodo, err := insertImportedTodo(ctx, repo, todo.Todo)
+			if err != nil {
+				return imported, err
+			}
+			if todo.Description != "" {
+				if _, err := repo.InsertComment(ctx, repository.Comment{TodoID: newTodo.ID, Body: todo.Description}); err != nil {
+					return imported, err
+				}
+			}
+			if todo.UID != "" {
+				ids[todo.UID] = newTodo.ID
+			}
+			imported = append(imported, *newTodo)
+			inserted[i] = true
+			left--
+			progress = true
+			cycle = false
+		}
+		if !progress {
+			cycle = true
+		}
+	}
+	return imported, nil
+}
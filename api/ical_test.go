@@ -0,0 +1,277 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+func TestFormatCalendar(t *testing.T) {
+	march1 := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	march2 := time.Date(2021, time.March, 2, 18, 30, 0, 0, time.UTC)
+	parentID := uint32(1)
+
+	todos := []calendarTodo{
+		newCalendarTodo(repository.Todo{
+			ID:          1,
+			Description: "Pay the rent",
+			DueDate:     time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC),
+			Labels:      []string{"home", "bills, monthly"},
+			CreatedAt:   march1,
+			Recurrence:  &repository.Recurrence{Frequency: repository.Monthly, Interval: 1},
+		}, []repository.Comment{
+			{Author: "alice", Body: "Ask for the receipt"},
+			{Body: "Bank is closed on Friday;\nuse the app"},
+		}),
+		newCalendarTodo(repository.Todo{
+			ID:          2,
+			Description: "Transfer the money",
+			DueDate:     march2,
+			Done:        true,
+			CreatedAt:   march1,
+			UpdatedAt:   march2,
+			CompletedAt: march2,
+			ParentID:    &parentID,
+		}, nil),
+		newCalendarTodo(repository.Todo{
+			ID:          3,
+			Description: strings.Repeat("Ünïcödé ", 10),
+			CreatedAt:   march1,
+		}, nil),
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//todoer//todoer//EN",
+		"X-WR-CALNAME:Home\\, sweet home",
+		"BEGIN:VTODO",
+		"UID:todo-1@todoer",
+		"DTSTAMP:20210301T100000Z",
+		"CREATED:20210301T100000Z",
+		"SUMMARY:Pay the rent",
+		"DUE;VALUE=DATE:20210305",
+		"STATUS:NEEDS-ACTION",
+		"CATEGORIES:home,bills\\, monthly",
+		"DESCRIPTION:alice: Ask for the receipt\\n\\nBank is closed on Friday\\;\\nuse t",
+		" he app",
+		"RRULE:FREQ=MONTHLY",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-2@todoer",
+		"DTSTAMP:20210302T183000Z",
+		"CREATED:20210301T100000Z",
+		"LAST-MODIFIED:20210302T183000Z",
+		"SUMMARY:Transfer the money",
+		"DUE:20210302T183000Z",
+		"STATUS:COMPLETED",
+		"COMPLETED:20210302T183000Z",
+		"RELATED-TO;RELTYPE=PARENT:todo-1@todoer",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-3@todoer",
+		"DTSTAMP:20210301T100000Z",
+		"CREATED:20210301T100000Z",
+		"SUMMARY:Ünïcödé Ünïcödé Ünïcödé Ünïcödé Ünïcödé Ünïc",
+		" ödé Ünïcödé Ünïcödé Ünïcödé Ünïcödé ",
+		"STATUS:NEEDS-ACTION",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	got := &strings.Builder{}
+	if err := formatCalendar(got, "Home, sweet home", todos); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("formatCalendar() mismatch (-want +got):\n%s", diff)
+	}
+	for _, line := range strings.Split(got.String(), "\r\n") {
+		if len(line) > icalLineOctets {
+			t.Errorf("formatCalendar() wrote a line of %d octets: %q", len(line), line)
+		}
+	}
+
+	// Parsing it back gives the same todos, but for what a VTODO has no
+	// room for
+	parsed, err := parseCalendar(strings.NewReader(got.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range todos {
+		todos[i].Todo.ID = 0
+		todos[i].Todo.UpdatedAt = time.Time{}
+		todos[i].Todo.ParentID = nil
+	}
+	todos[2].Todo.Description = strings.TrimSpace(todos[2].Todo.Description)
+	if diff := cmp.Diff(todos, parsed); diff != "" {
+		t.Errorf("parseCalendar() of formatCalendar() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	type Test struct {
+		name    string
+		content string
+		want    []calendarTodo
+	}
+
+	calendar := func(lines ...string) string {
+		return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n")
+	}
+	march1 := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []Test{
+		{
+			name:    "Summary",
+			content: calendar("BEGIN:VTODO", "UID:bed", "SUMMARY:Make the bed", "END:VTODO"),
+			want:    []calendarTodo{{UID: "bed", Todo: repository.Todo{Description: "Make the bed"}}},
+		},
+		{
+			name:    "NoTodos",
+			content: calendar(),
+			want:    []calendarTodo{},
+		},
+		{
+			name: "Folded",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Make",
+				"  the bed",
+				"DESCRIPTION:Fresh",
+				"\t sheets",
+				"END:VTODO",
+			),
+			want: []calendarTodo{{Todo: repository.Todo{Description: "Make the bed"}, Description: "Fresh sheets"}},
+		},
+		{
+			name: "Dates",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Pay the rent",
+				"CREATED:20210301T153000Z",
+				"DUE;VALUE=DATE:20210301",
+				"END:VTODO",
+				"BEGIN:VTODO",
+				"SUMMARY:Catch the train",
+				`DUE;TZID="America/Sao_Paulo":20210301T120000`,
+				"END:VTODO",
+				"BEGIN:VTODO",
+				"SUMMARY:Call mom",
+				"DUE:20210301T120000",
+				"END:VTODO",
+			),
+			want: []calendarTodo{
+				{Todo: repository.Todo{Description: "Pay the rent", DueDate: march1, CreatedAt: march1.Add(15*time.Hour + 30*time.Minute)}},
+				{Todo: repository.Todo{Description: "Catch the train", DueDate: march1.Add(15 * time.Hour)}},
+				{Todo: repository.Todo{Description: "Call mom", DueDate: march1.Add(12 * time.Hour)}},
+			},
+		},
+		{
+			name: "Completed",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Make the bed",
+				"STATUS:COMPLETED",
+				"END:VTODO",
+				"BEGIN:VTODO",
+				"SUMMARY:Water the plants",
+				"COMPLETED:20210301T000000Z",
+				"RRULE:FREQ=DAILY",
+				"END:VTODO",
+				"BEGIN:VTODO",
+				"SUMMARY:Call mom",
+				"COMPLETED:20210301T000000Z",
+				"STATUS:IN-PROCESS",
+				"END:VTODO",
+			),
+			want: []calendarTodo{
+				{Todo: repository.Todo{Description: "Make the bed", Done: true}},
+				{Todo: repository.Todo{Description: "Water the plants", Done: true, CompletedAt: march1}},
+				{Todo: repository.Todo{Description: "Call mom"}},
+			},
+		},
+		{
+			name: "Categories",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Pay the rent",
+				`CATEGORIES:home,bills\, monthly`,
+				"CATEGORIES:urgent,",
+				"END:VTODO",
+			),
+			want: []calendarTodo{{Todo: repository.Todo{Description: "Pay the rent", Labels: []string{"home", "bills, monthly", "urgent"}}}},
+		},
+		{
+			name: "Related",
+			content: calendar(
+				"BEGIN:VTODO",
+				"SUMMARY:Transfer the money",
+				"RELATED-TO:rent",
+				"END:VTODO",
+				"BEGIN:VTODO",
+				"SUMMARY:Ask for the receipt",
+				"RELATED-TO;RELTYPE=SIBLING:rent",
+				"END:VTODO",
+			),
+			want: []calendarTodo{
+				{ParentUID: "rent", Todo: repository.Todo{Description: "Transfer the money"}},
+				{Todo: repository.Todo{Description: "Ask for the receipt"}},
+			},
+		},
+		{
+			name: "OtherComponents",
+			content: calendar(
+				"BEGIN:VTIMEZONE",
+				"TZID:Europe/Lisbon",
+				"END:VTIMEZONE",
+				"BEGIN:VEVENT",
+				"SUMMARY:Party",
+				"END:VEVENT",
+				"BEGIN:VTODO",
+				"SUMMARY:Buy a gift",
+				"BEGIN:VALARM",
+				"DESCRIPTION:Reminder",
+				"END:VALARM",
+				"X-UNKNOWN;X-PARAM=1:anything",
+				"END:VTODO",
+			),
+			want: []calendarTodo{{Todo: repository.Todo{Description: "Buy a gift"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCalendar(strings.NewReader(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseCalendar() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCalendarInvalid(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"SUMMARY:Make the bed",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Make the bed\r\nEND:VTODO",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Make the bed\r\nEND:VEVENT\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nDUE:20210301\r\nEND:VTODO\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Pay the rent\r\nDUE:tomorrow\r\nEND:VTODO\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Pay the rent\r\nDUE;TZID=Nowhere/Else:20210301T120000\r\nEND:VTODO\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Pay the rent\r\nRRULE:FREQ=YEARLY\r\nEND:VTODO\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY Make the bed\r\nEND:VTODO\r\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\r\n" + strings.Repeat("a", icalMaxLine+1),
+	} {
+		if _, err := parseCalendar(strings.NewReader(content)); !errors.Is(err, ErrInvalidCalendar) {
+			t.Errorf("parseCalendar(%.40q) got error %v; want %v", content, err, ErrInvalidCalendar)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// ErrInvalidKey is returned when a key can't verify JWTs.
+var ErrInvalidKey = errors.New("key is invalid")
+
+// KeySet holds the keys JWTs are verified with: RSA and P-256 ECDSA public
+// keys, and HMAC secrets.
+type KeySet struct {
+	keys []verificationKey
+}
+
+type verificationKey struct {
+	id  string
+	alg string
+	key interface{}
+}
+
+// NewKeySet returns an empty key set.
+func NewKeySet() *KeySet {
+	return &KeySet{}
+}
+
+// Add adds key to the set, for tokens with the key id id, or any token
+// when it is empty. The key is either a *rsa.PublicKey, an
+// *ecdsa.PublicKey on the P-256 curve, or a []byte HMAC secret.
+func (ks *KeySet) Add(id string, key interface{}) error {
+	return ks.add(id, "", key)
+}
+
+// Len returns how many keys are in the set.
+func (ks *KeySet) Len() int {
+	if ks == nil {
+		return 0
+	}
+	return len(ks.keys)
+}
+
+func (ks *KeySet) add(id, alg string, key interface{}) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "" && alg != AlgRS256 {
+			return fmt.Errorf("%w: algorithm %q can't be used with an RSA key", ErrInvalidKey, alg)
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: only the P-256 curve is supported", ErrInvalidKey)
+		}
+		if alg != "" && alg != AlgES256 {
+			return fmt.Errorf("%w: algorithm %q can't be used with an EC key", ErrInvalidKey, alg)
+		}
+	case []byte:
+		if len(k) == 0 {
+			return fmt.Errorf("%w: HMAC secret is empty", ErrInvalidKey)
+		}
+		if alg != "" && alg != AlgHS256 {
+			return fmt.Errorf("%w: algorithm %q can't be used with an HMAC secret", ErrInvalidKey, alg)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+
+	ks.keys = append(ks.keys, verificationKey{id: id, alg: alg, key: key})
+	return nil
+}
+
+// candidates returns the keys that may have signed a token with the given
+// algorithm and key id.
+func (ks *KeySet) candidates(alg, id string) []verificationKey {
+	if ks == nil {
+		return nil
+	}
+
+	keys := []verificationKey{}
+	for _, key := range ks.keys {
+		if key.alg != "" && key.alg != alg {
+			continue
+		}
+		if key.id != "" && id != "" && key.id != id {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS returns the keys of the JSON Web Key Set on the file at path.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS returns the keys of a JSON Web Key Set. Keys that are not for
+// signatures are skipped, and so are key types other than RSA, EC and oct.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	set := jsonWebKeySet{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%w: malformed key set: %v", ErrInvalidKey, err)
+	}
+
+	ks := NewKeySet()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaKey()
+		case "EC":
+			key, err = jwk.ecdsaKey()
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(jwk.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidKey, jwk.Kid, err)
+		}
+		if err := ks.add(jwk.Kid, jwk.Alg, key); err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+	}
+
+	if ks.Len() == 0 {
+		return nil, fmt.Errorf("%w: key set has no signature keys", ErrInvalidKey)
+	}
+	return ks, nil
+}
+
+func (jwk jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("modulus or exponent is invalid")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (jwk jsonWebKey) ecdsaKey() (*ecdsa.PublicKey, error) {
+	if jwk.Crv != "P-256" {
+		return nil, fmt.Errorf("curve %q is not supported", jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
+
+// LoadPublicKey returns the RSA or ECDSA public key on the PEM file at
+// path, holding either a public key or a certificate.
+func LoadPublicKey(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey returns the RSA or ECDSA public key of a PEM block holding
+// either a public key or a certificate.
+func ParsePublicKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block %q", ErrInvalidKey, block.Type)
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// ErrInvalidJWT is returned when a JWT is malformed, its signature doesn't
+// verify or its claims are not accepted.
+var ErrInvalidJWT = errors.New("JWT is invalid")
+
+// Algorithms a JWT may be signed with.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgHS256 = "HS256"
+)
+
+// JWTVerifier verifies JWTs issued by an identity provider, so they can
+// be used as bearer tokens.
+type JWTVerifier struct {
+	// Keys verify the signature of tokens.
+	Keys *KeySet
+	// Issuer, when not empty, must be the iss claim of tokens.
+	Issuer string
+	// Audience, when not empty, must be one of the aud claim of tokens.
+	Audience string
+	// ClockSkew is how long tokens are still accepted after they expire,
+	// and before they are valid, for clocks that are apart.
+	ClockSkew time.Duration
+}
+
+// Claims are the claims of a verified JWT.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	// Scope is the space separated scopes the token was granted.
+	Scope string
+	// Raw holds every claim of the token, as decoded from JSON.
+	Raw map[string]interface{}
+}
+
+type claimsKey struct{}
+
+// withClaims returns a copy of ctx carrying the claims of its JWT.
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the JWT a request was
+// authenticated with, and false when it had none.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Scopes returns the known scopes among the ones the token was granted.
+// Tokens granted none of them have the write scope, as the identity
+// provider already decided who may use the service.
+func (c *Claims) Scopes() []repository.Scope {
+	scopes := []repository.Scope{}
+	for _, s := range strings.Fields(c.Scope) {
+		if scope := repository.Scope(s); scope.Valid() {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return []repository.Scope{repository.ScopeWrite}
+	}
+	return scopes
+}
+
+// isJWT tells if a bearer token secret has the shape of a JWT, whose three
+// parts are separated by dots. The secrets of API tokens have no dots.
+func isJWT(secret string) bool {
+	return strings.Count(secret, ".") == 2
+}
+
+// Verify returns the claims of the JWT raw, once its signature and claims
+// are verified.
+func (v *JWTVerifier) Verify(raw string) (*Claims, error) {
+	return v.verify(raw, time.Now())
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtPayload struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	IssuedAt  *float64    `json:"iat"`
+	Scope     string      `json:"scope"`
+}
+
+// jwtAudience is the aud claim, which is either a string or an array.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (v *JWTVerifier) verify(raw string, now time.Time) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidJWT)
+	}
+
+	header := jwtHeader{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidJWT, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %v", ErrInvalidJWT, err)
+	}
+
+	keys := v.Keys.candidates(header.Alg, header.Kid)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no key for algorithm %q and key id %q", ErrInvalidJWT, header.Alg, header.Kid)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if verifySignature(header.Alg, key.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: signature does not verify", ErrInvalidJWT)
+	}
+
+	payload := jwtPayload{}
+	if err := decodeJWTPart(parts[1], &payload); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidJWT, err)
+	}
+	raws := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &raws); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidJWT, err)
+	}
+
+	claims := &Claims{
+		Subject:   payload.Subject,
+		Issuer:    payload.Issuer,
+		Audience:  payload.Audience,
+		ExpiresAt: numericDate(payload.ExpiresAt),
+		NotBefore: numericDate(payload.NotBefore),
+		IssuedAt:  numericDate(payload.IssuedAt),
+		Scope:     payload.Scope,
+		Raw:       raws,
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidJWT)
+	}
+	if claims.ExpiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidJWT)
+	}
+	if now.After(claims.ExpiresAt.Add(v.ClockSkew)) {
+		return nil, fmt.Errorf("%w: expired at %v", ErrInvalidJWT, claims.ExpiresAt)
+	}
+	if !claims.NotBefore.IsZero() && now.Add(v.ClockSkew).Before(claims.NotBefore) {
+		return nil, fmt.Errorf("%w: not valid before %v", ErrInvalidJWT, claims.NotBefore)
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q is not accepted", ErrInvalidJWT, claims.Issuer)
+	}
+	if v.Audience != "" && !hasAudience(claims.Audience, v.Audience) {
+		return nil, fmt.Errorf("%w: audience %q is not accepted", ErrInvalidJWT, claims.Audience)
+	}
+
+	return claims, nil
+}
+
+// decodeJWTPart decodes the base64url encoded JSON of a JWT part into v.
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate returns the time of a JWT NumericDate, in seconds since the
+// epoch, or the zero time when it is missing.
+func numericDate(seconds *float64) time.Time {
+	if seconds == nil {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(*seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
+
+func hasAudience(audience []string, want string) bool {
+	for _, aud := range audience {
+		if aud == want {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature tells if signature is the one of signed by key, with the
+// algorithm alg. Keys of a type other than the one alg takes never verify,
+// so a public key can't be used as an HMAC secret.
+func verifySignature(alg string, key interface{}, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	default:
+		return false
+	}
+}
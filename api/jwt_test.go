@@ -0,0 +1,408 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// signJWT returns a JWT with the given claims, signed by key with alg.
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	default:
+		t.Fatalf("unsupported key type %T", key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey
+}
+
+func TestJWTVerify(t *testing.T) {
+	type Test struct {
+		name       string
+		token      func(t *testing.T) string
+		wantClaims *Claims
+		wantErr    bool
+	}
+
+	rsaKey, ecKey := newTestKeys(t)
+	otherRSAKey, _ := newTestKeys(t)
+	secret := []byte("shared-secret")
+
+	keys := NewKeySet()
+	for id, key := range map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "hmac": secret} {
+		if err := keys.Add(id, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verifier := &JWTVerifier{
+		Keys:      keys,
+		Issuer:    "https://sso.example.com",
+		Audience:  "todoer",
+		ClockSkew: time.Minute,
+	}
+
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://sso.example.com",
+			"aud": "todoer",
+			"exp": now.Add(time.Hour).Unix(),
+			"iat": now.Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	wantAlice := &Claims{
+		Subject:   "alice",
+		Issuer:    "https://sso.example.com",
+		Audience:  []string{"todoer"},
+		ExpiresAt: now.Add(time.Hour),
+		IssuedAt:  now,
+	}
+
+	tests := []Test{
+		{
+			name: "RS256",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(nil))
+			},
+			wantClaims: wantAlice,
+		},
+		{
+			name: "ES256",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgES256, "ec", ecKey, claims(nil))
+			},
+			wantClaims: wantAlice,
+		},
+		{
+			name: "HS256",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgHS256, "hmac", secret, claims(nil))
+			},
+			wantClaims: wantAlice,
+		},
+		{
+			name: "NoKeyID",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgES256, "", ecKey, claims(nil))
+			},
+			wantClaims: wantAlice,
+		},
+		{
+			name: "AudienceArrayAndScope",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{
+					"aud":   []string{"other", "todoer"},
+					"scope": "openid read",
+				}))
+			},
+			wantClaims: &Claims{
+				Subject:   "alice",
+				Issuer:    "https://sso.example.com",
+				Audience:  []string{"other", "todoer"},
+				ExpiresAt: now.Add(time.Hour),
+				IssuedAt:  now,
+				Scope:     "openid read",
+			},
+		},
+		{
+			name: "ExpiredWithinSkew",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))
+			},
+			wantClaims: &Claims{
+				Subject:   "alice",
+				Issuer:    "https://sso.example.com",
+				Audience:  []string{"todoer"},
+				ExpiresAt: now.Add(-30 * time.Second),
+				IssuedAt:  now,
+			},
+		},
+		{
+			name: "Expired",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "NoExpiry",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"exp": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "NotYetValid",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "NoSubject",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"sub": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "WrongIssuer",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "WrongAudience",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "UnknownKey",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rsa", otherRSAKey, claims(nil))
+			},
+			wantErr: true,
+		},
+		{
+			name: "UnknownKeyID",
+			token: func(t *testing.T) string {
+				return signJWT(t, AlgRS256, "rotated", rsaKey, claims(nil))
+			},
+			wantErr: true,
+		},
+		{
+			name: "TamperedClaims",
+			token: func(t *testing.T) string {
+				token := signJWT(t, AlgRS256, "rsa", rsaKey, claims(nil))
+				parts := strings.Split(token, ".")
+				other := strings.Split(signJWT(t, AlgRS256, "rsa", rsaKey, claims(map[string]interface{}{"sub": "mallory"})), ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			},
+			wantErr: true,
+		},
+		{
+			name: "PublicKeyAsHMACSecret",
+			token: func(t *testing.T) string {
+				der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+				return signJWT(t, AlgHS256, "rsa", pemKey, claims(nil))
+			},
+			wantErr: true,
+		},
+		{
+			name: "AlgNone",
+			token: func(t *testing.T) string {
+				token := signJWT(t, AlgHS256, "hmac", secret, claims(nil))
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"hmac"}`))
+				return header + "." + strings.Split(token, ".")[1] + "."
+			},
+			wantErr: true,
+		},
+		{
+			name: "Malformed",
+			token: func(t *testing.T) string {
+				return "not.a.jwt"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := verifier.verify(test.token(t), now)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidJWT) {
+					t.Fatalf("got error %v; want %v", err, ErrInvalidJWT)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(test.wantClaims, got, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "Raw"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("Claims mismatch (-want +got):\n%s", diff)
+			}
+			if got.Raw["sub"] != test.wantClaims.Subject {
+				t.Errorf("got raw sub %v; want %q", got.Raw["sub"], test.wantClaims.Subject)
+			}
+		})
+	}
+}
+
+func TestClaimsScopes(t *testing.T) {
+	type Test struct {
+		scope string
+		want  []repository.Scope
+	}
+
+	tests := []Test{
+		{scope: "", want: []repository.Scope{repository.ScopeWrite}},
+		{scope: "openid profile", want: []repository.Scope{repository.ScopeWrite}},
+		{scope: "openid read", want: []repository.Scope{repository.ScopeRead}},
+		{scope: "admin", want: []repository.Scope{repository.ScopeAdmin}},
+	}
+
+	for _, test := range tests {
+		claims := &Claims{Scope: test.scope}
+		if diff := cmp.Diff(test.want, claims.Scopes()); diff != "" {
+			t.Errorf("Scopes() of %q mismatch (-want +got):\n%s", test.scope, diff)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, ecKey := newTestKeys(t)
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   encode(ecKey.X.Bytes()),
+				"y":   encode(ecKey.Y.Bytes()),
+			},
+			{
+				"kty": "oct",
+				"kid": "hmac",
+				"k":   encode([]byte("shared-secret")),
+			},
+			{
+				"kty": "RSA",
+				"kid": "encryption",
+				"use": "enc",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "OKP",
+				"kid": "ed25519",
+				"crv": "Ed25519",
+				"x":   encode([]byte("unsupported")),
+			},
+		},
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys.Len() != 3 {
+		t.Fatalf("got %d keys; want 3", keys.Len())
+	}
+
+	now := time.Now()
+	verifier := &JWTVerifier{Keys: keys}
+	claims := map[string]interface{}{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	for _, token := range []string{
+		signJWT(t, AlgRS256, "rsa", rsaKey, claims),
+		signJWT(t, AlgES256, "ec", ecKey, claims),
+		signJWT(t, AlgHS256, "hmac", []byte("shared-secret"), claims),
+	} {
+		if _, err := verifier.verify(token, now); err != nil {
+			t.Errorf("unexpected error verifying %q: %v", token, err)
+		}
+	}
+
+	if _, err := ParseJWKS([]byte(`{"keys": [{"kty": "EC", "kid": "bad", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got error %v for a point off the curve; want %v", err, ErrInvalidKey)
+	}
+	if _, err := ParseJWKS([]byte(`{"keys": []}`)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got error %v for an empty key set; want %v", err, ErrInvalidKey)
+	}
+}
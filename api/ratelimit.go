@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// ErrRateLimited is returned when a client made more requests than its
+// limit allows.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Limit is a token bucket: clients make Burst requests at once, and then
+// Rate requests per second.
+type Limit struct {
+	// Rate is how many requests are allowed per second. Zero is unlimited.
+	Rate float64
+	// Burst is how many requests are allowed at once. Zero is the rate,
+	// rounded up, or one.
+	Burst int
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	if burst := int(math.Ceil(l.Rate)); burst > 1 {
+		return burst
+	}
+	return 1
+}
+
+// RateLimits decides how many requests each client makes. Clients are
+// told apart by their bearer token, or else their user, or else their IP
+// address. Requests failing to authenticate are counted against their IP
+// address, whose budget is checked before authenticating them.
+type RateLimits struct {
+	// Read limits requests that only read, and Write any other.
+	Read  Limit
+	Write Limit
+	// Routes limits requests to some REST routes or gRPC methods instead
+	// of Read and Write, with a budget of their own. Routes are keyed by
+	// their path, like SearchPath, optionally after their HTTP method and a
+	// space, like "POST /todolist". Methods are keyed by their name, like
+	// "Search".
+	Routes map[string]Limit
+	// ClientIPHeader is the header, or gRPC metadata, where a trusted proxy
+	// puts the IP address of clients, like X-Forwarded-For. Empty uses the
+	// address of the connection.
+	ClientIPHeader string
+	// TrustedHops is how many trusted proxies append the address they
+	// were reached from to ClientIPHeader, so the client is that many
+	// entries from its end. Anything before is set by the client and not
+	// trusted. Zero is one.
+	TrustedHops int
+}
+
+// RateLimiter limits how many requests each client makes, by RateLimits.
+// A nil RateLimiter limits nothing.
+type RateLimiter struct {
+	limits RateLimits
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket is full again.
+	full time.Time
+}
+
+// rateDecision is the outcome of taking a request from a bucket.
+type rateDecision struct {
+	allowed bool
+	// limit is the burst of the bucket and remaining how many requests
+	// are still allowed at once.
+	limit     int
+	remaining int
+	// reset is when the bucket is full again, and retryAfter when the
+	// next request is allowed.
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// bucketIdle is how long buckets are kept after they are full again.
+const bucketIdle = time.Minute
+
+// NewRateLimiter returns a rate limiter enforcing limits.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// limitFor returns the limit of a request to route, made with method, and
+// the name of its budget. The method is empty for gRPC.
+func (rl *RateLimiter) limitFor(method, route string, write bool) (Limit, string) {
+	if method != "" {
+		if limit, ok := rl.limits.Routes[method+" "+route]; ok {
+			return limit, method + " " + route
+		}
+	}
+	if limit, ok := rl.limits.Routes[route]; ok {
+		return limit, route
+	}
+	if write {
+		return rl.limits.Write, "write"
+	}
+	return rl.limits.Read, "read"
+}
+
+// take takes a request of client from the bucket of its budget, telling
+// if it is allowed. Requests without a limit are always allowed.
+func (rl *RateLimiter) take(client, budget string, limit Limit, now time.Time) (rateDecision, bool) {
+	return rl.decide(client, budget, limit, now, true)
+}
+
+// peek tells if a request of client would be allowed by the bucket of its
+// budget, without taking it.
+func (rl *RateLimiter) peek(client, budget string, limit Limit, now time.Time) (rateDecision, bool) {
+	return rl.decide(client, budget, limit, now, false)
+}
+
+func (rl *RateLimiter) decide(client, budget string, limit Limit, now time.Time, take bool) (rateDecision, bool) {
+	if limit.Rate <= 0 {
+		return rateDecision{}, false
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	burst := float64(limit.burst())
+	key := budget + "\x00" + client
+	b, ok := rl.buckets[key]
+	if !ok {
+		if !take {
+			return rateDecision{allowed: true, limit: int(burst), remaining: int(burst)}, true
+		}
+		b = &bucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+
+	decision := rateDecision{limit: int(burst)}
+	if b.tokens >= 1 {
+		if take {
+			b.tokens--
+		}
+		decision.allowed = true
+	} else {
+		decision.retryAfter = rateDuration(1-b.tokens, limit.Rate)
+	}
+	decision.remaining = int(b.tokens)
+	decision.reset = rateDuration(burst-b.tokens, limit.Rate)
+	b.full = now.Add(decision.reset)
+	return decision, true
+}
+
+// sweep forgets the buckets that have been full for a while, at most
+// once every bucketIdle. It must be called with mu held.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < bucketIdle {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.full) >= bucketIdle {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// rateDuration returns how long it takes to refill tokens at rate.
+func rateDuration(tokens, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+// seconds returns d in whole seconds, rounded up.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateClient returns who a request is made by, for rate limiting: the hash
+// of its bearer token, or else its user, or else its IP address.
+func rateClient(secret, actor, ip string) string {
+	if secret != "" {
+		return "token:" + repository.HashToken(secret)
+	}
+	if actor != "" {
+		return "user:" + actor
+	}
+	return "ip:" + ip
+}
+
+// clientIP returns the IP address of a client, from the entry the first of
+// hops trusted proxies appended to the header of RateLimits.ClientIPHeader,
+// or else the address of its connection.
+func clientIP(forwarded string, hops int, remoteAddr string) string {
+	if hops < 1 {
+		hops = 1
+	}
+	if forwarded != "" {
+		entries := strings.Split(forwarded, ",")
+		if len(entries) >= hops {
+			if ip := strings.TrimSpace(entries[len(entries)-hops]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	type Step struct {
+		after time.Duration
+		want  rateDecision
+	}
+
+	limiter := NewRateLimiter(RateLimits{})
+	limit := Limit{Rate: 2, Burst: 3}
+	start := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []Step{
+		{after: 0, want: rateDecision{allowed: true, limit: 3, remaining: 2, reset: 500 * time.Millisecond}},
+		{after: 0, want: rateDecision{allowed: true, limit: 3, remaining: 1, reset: time.Second}},
+		{after: 0, want: rateDecision{allowed: true, limit: 3, remaining: 0, reset: 1500 * time.Millisecond}},
+		{after: 0, want: rateDecision{allowed: false, limit: 3, remaining: 0, reset: 1500 * time.Millisecond, retryAfter: 500 * time.Millisecond}},
+		{after: 250 * time.Millisecond, want: rateDecision{allowed: false, limit: 3, remaining: 0, reset: 1250 * time.Millisecond, retryAfter: 250 * time.Millisecond}},
+		{after: 500 * time.Millisecond, want: rateDecision{allowed: true, limit: 3, remaining: 0, reset: 1250 * time.Millisecond}},
+		{after: 10 * time.Second, want: rateDecision{allowed: true, limit: 3, remaining: 2, reset: 500 * time.Millisecond}},
+	}
+
+	now := start
+	for i, step := range steps {
+		now = now.Add(step.after)
+		got, limited := limiter.take("alice", "read", limit, now)
+		if !limited {
+			t.Fatalf("step %d: request was not limited", i)
+		}
+		if diff := cmp.Diff(step.want, got, cmp.AllowUnexported(rateDecision{})); diff != "" {
+			t.Errorf("step %d: decision mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	if got, _ := limiter.take("bob", "read", limit, now); !got.allowed {
+		t.Errorf("request of another client was not allowed")
+	}
+	if got, _ := limiter.take("alice", "write", limit, now); !got.allowed {
+		t.Errorf("request on another budget was not allowed")
+	}
+	if _, limited := limiter.take("alice", "read", Limit{}, now); limited {
+		t.Errorf("request without a limit was limited")
+	}
+	for i := 0; i < 2; i++ {
+		if got, _ := limiter.peek("dave", "read", limit, now); !got.allowed || got.remaining != 3 {
+			t.Errorf("peek %d: got decision %+v; want allowed with 3 remaining", i, got)
+		}
+	}
+	if got, _ := limiter.take("dave", "read", limit, now); got.remaining != 2 {
+		t.Errorf("got %d remaining after peeking and taking; want 2", got.remaining)
+	}
+
+	limiter.take("carol", "read", limit, now.Add(bucketIdle+time.Second))
+	if _, ok := limiter.buckets["read\x00alice"]; ok {
+		t.Errorf("bucket full for over %v was not forgotten", bucketIdle)
+	}
+	if _, ok := limiter.buckets["read\x00carol"]; !ok {
+		t.Errorf("bucket in use was forgotten")
+	}
+}
+
+func TestRateLimiterLimitFor(t *testing.T) {
+	type Test struct {
+		name       string
+		method     string
+		route      string
+		write      bool
+		wantLimit  Limit
+		wantBudget string
+	}
+
+	limiter := NewRateLimiter(RateLimits{
+		Read:  Limit{Rate: 10},
+		Write: Limit{Rate: 2},
+		Routes: map[string]Limit{
+			SearchPath:               {Rate: 1},
+			"POST " + TodoListPath:   {Rate: 0.5, Burst: 2},
+			"Search":                 {Rate: 3},
+			TrashTodoListRestorePath: {},
+		},
+	})
+
+	tests := []Test{
+		{name: "Read", method: "GET", route: TodoListPath, wantLimit: Limit{Rate: 10}, wantBudget: "read"},
+		{name: "Write", method: "PUT", route: TodoListIDPath, write: true, wantLimit: Limit{Rate: 2}, wantBudget: "write"},
+		{name: "Route", method: "GET", route: SearchPath, wantLimit: Limit{Rate: 1}, wantBudget: SearchPath},
+		{name: "RouteAndMethod", method: "POST", route: TodoListPath, write: true, wantLimit: Limit{Rate: 0.5, Burst: 2}, wantBudget: "POST " + TodoListPath},
+		{name: "Unlimited", method: "POST", route: TrashTodoListRestorePath, write: true, wantLimit: Limit{}, wantBudget: TrashTodoListRestorePath},
+		{name: "GrpcMethod", route: "Search", wantLimit: Limit{Rate: 3}, wantBudget: "Search"},
+		{name: "GrpcWrite", route: "CreateTodo", write: true, wantLimit: Limit{Rate: 2}, wantBudget: "write"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limit, budget := limiter.limitFor(test.method, test.route, test.write)
+			if limit != test.wantLimit || budget != test.wantBudget {
+				t.Errorf("got limit %+v on budget %q; want %+v on %q", limit, budget, test.wantLimit, test.wantBudget)
+			}
+		})
+	}
+}
+
+func TestRateClient(t *testing.T) {
+	type Test struct {
+		name       string
+		secret     string
+		actor      string
+		forwarded  string
+		hops       int
+		remoteAddr string
+		want       string
+	}
+
+	tests := []Test{
+		{name: "Token", secret: "todoer_secret", actor: "alice", remoteAddr: "10.0.0.1:1234", want: "token:" + repository.HashToken("todoer_secret")},
+		{name: "User", actor: "alice", remoteAddr: "10.0.0.1:1234", want: "user:alice"},
+		{name: "RemoteAddr", remoteAddr: "10.0.0.1:1234", want: "ip:10.0.0.1"},
+		{name: "IPv6", remoteAddr: "[::1]:1234", want: "ip:::1"},
+		{name: "Forwarded", forwarded: "203.0.113.7", remoteAddr: "10.0.0.1:1234", want: "ip:203.0.113.7"},
+		{name: "ForwardedSpoofed", forwarded: "198.51.100.1, 203.0.113.7", remoteAddr: "10.0.0.1:1234", want: "ip:203.0.113.7"},
+		{name: "ForwardedHops", forwarded: "198.51.100.1, 203.0.113.7, 10.0.0.2", hops: 2, remoteAddr: "10.0.0.1:1234", want: "ip:203.0.113.7"},
+		{name: "ForwardedTooFewHops", forwarded: "203.0.113.7", hops: 2, remoteAddr: "10.0.0.1:1234", want: "ip:10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := rateClient(test.secret, test.actor, clientIP(test.forwarded, test.hops, test.remoteAddr)); got != test.want {
+				t.Errorf("got client %q; want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// ErrInvalidTodoTxt is returned when a todo.txt file has a task that can't
+// be imported.
+var ErrInvalidTodoTxt = errors.New("todo.txt is invalid")
+
+// PriorityLabelPrefix starts the label holding the priority of a todo.txt
+// task, like priority:A.
+const PriorityLabelPrefix = "priority:"
+
+const (
+	// todoTxtDateLayout is how todo.txt writes dates.
+	todoTxtDateLayout = "2006-01-02"
+	// todoTxtMaxLine is the longest task read from a todo.txt file.
+	todoTxtMaxLine = 1 << 20
+)
+
+// formatTodoTxt writes todos to w as todo.txt, one task per line, in their
+// order. Labels become +projects, except for the ones starting with @,
+// which are contexts, and the first priority label, which is the priority.
+// Done todos keep it as a pri: tag, as their line starts with the x marker.
+func formatTodoTxt(w io.Writer, todos []repository.Todo) error {
+	bw := bufio.NewWriter(w)
+	for _, todo := range todos {
+		if _, err := bw.WriteString(formatTodoTxtTask(todo) + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func formatTodoTxtTask(todo repository.Todo) string {
+	priority, labels := splitPriority(todo.Labels)
+
+	words := []string{}
+	if todo.Done {
+		words = append(words, "x")
+		// The creation date can only follow the completion date
+		if !todo.CompletedAt.IsZero() {
+			words = append(words, formatTodoTxtDate(todo.CompletedAt))
+			if !todo.CreatedAt.IsZero() {
+				words = append(words, formatTodoTxtDate(todo.CreatedAt))
+			}
+		}
+	} else {
+		if priority != "" {
+			words = append(words, "("+priority+")")
+		}
+		if !todo.CreatedAt.IsZero() {
+			words = append(words, formatTodoTxtDate(todo.CreatedAt))
+		}
+	}
+
+	words = append(words, strings.Fields(todo.Description)...)
+
+	for _, label := range labels {
+		label = strings.Join(strings.Fields(label), "_")
+		if strings.HasPrefix(label, "@") {
+			words = append(words, label)
+		} else {
+			words = append(words, "+"+label)
+		}
+	}
+	if !todo.DueDate.IsZero() {
+		words = append(words, "due:"+formatTodoTxtDue(todo.DueDate))
+	}
+	if todo.Done && priority != "" {
+		words = append(words, "pri:"+priority)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// splitPriority returns the priority on the first priority label, and the
+// other labels.
+func splitPriority(labels []string) (string, []string) {
+	priority := ""
+	others := []string{}
+	for _, label := range labels {
+		if p := strings.TrimPrefix(label, PriorityLabelPrefix); priority == "" && p != label && isPriority(p) {
+			priority = p
+			continue
+		}
+		others = append(others, label)
+	}
+	return priority, others
+}
+
+// parseTodoTxt reads the tasks of a todo.txt file, skipping blank lines.
+// Their dates set CreatedAt and CompletedAt, at midnight UTC.
+func parseTodoTxt(r io.Reader) ([]repository.Todo, error) {
+	todos := []repository.Todo{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, todoTxtMaxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		todo, err := parseTodoTxtTask(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidTodoTxt, line, err)
+		}
+		todos = append(todos, todo)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidTodoTxt, line+1, todoTxtMaxLine)
+		}
+		return nil, err
+	}
+	return todos, nil
+}
+
+func parseTodoTxtTask(line string) (repository.Todo, error) {
+	todo := repository.Todo{}
+	words := strings.Fields(line)
+
+	// Done tasks start with x and their completion date, others with their
+	// priority. Either may be followed by the creation date.
+	priority := ""
+	if words[0] == "x" {
+		todo.Done = true
+		words = words[1:]
+		if len(words) > 0 {
+			if date, ok := parseTodoTxtDate(words[0]); ok {
+				todo.CompletedAt = date
+				words = words[1:]
+			}
+		}
+	} else if len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' && isPriority(words[0][1:2]) {
+		priority = words[0][1:2]
+		words = words[1:]
+	}
+	if len(words) > 0 {
+		if date, ok := parseTodoTxtDate(words[0]); ok {
+			todo.CreatedAt = date
+			words = words[1:]
+		}
+	}
+
+	description := []string{}
+	labels := []string{}
+	for _, word := range words {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			labels = append(labels, word[1:])
+		case len(word) > 1 && word[0] == '@':
+			labels = append(labels, word)
+		case strings.HasPrefix(word, "due:"):
+			due, err := parseTodoTxtDue(strings.TrimPrefix(word, "due:"))
+			if err != nil {
+				return todo, err
+			}
+			todo.DueDate = due
+		case strings.HasPrefix(word, "pri:") && isPriority(strings.TrimPrefix(word, "pri:")) && priority == "":
+			priority = strings.TrimPrefix(word, "pri:")
+		default:
+			description = append(description, word)
+		}
+	}
+	if priority != "" {
+		labels = append([]string{PriorityLabelPrefix + priority}, labels...)
+	}
+	if len(labels) > 0 {
+		todo.Labels = labels
+	}
+
+	todo.Description = strings.Join(description, " ")
+	if todo.Description == "" {
+		return todo, errors.New("task has no description")
+	}
+	return todo, nil
+}
+
+// isPriority tells if p is a todo.txt priority, an uppercase letter.
+func isPriority(p string) bool {
+	return len(p) == 1 && p[0] >= 'A' && p[0] <= 'Z'
+}
+
+func formatTodoTxtDate(t time.Time) string {
+	return t.UTC().Format(todoTxtDateLayout)
+}
+
+func parseTodoTxtDate(s string) (time.Time, bool) {
+	if len(s) != len(todoTxtDateLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(todoTxtDateLayout, s)
+	return t, err == nil
+}
+
+// formatTodoTxtDue writes due dates at midnight UTC as a date, and any
+// other as a full timestamp, so none is rounded.
+func formatTodoTxtDue(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return formatTodoTxtDate(t)
+	}
+	return t.Format(dateLayout)
+}
+
+func parseTodoTxtDue(s string) (time.Time, error) {
+	if date, ok := parseTodoTxtDate(s); ok {
+		return date, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("due date %q is neither YYYY-MM-DD nor %s", s, dateLayout)
+	}
+	return t.UTC(), nil
+}
+
+// importTodoTxt inserts todos parsed from todo.txt at the end of a todo
+// list, in order, returning them as inserted. An error stops the import,
+// keeping the todos inserted before it.
+func importTodoTxt(ctx context.Context, repo repository.Repository, listID uint32, todos []repository.Todo) ([]repository.Todo, error) {
+	// An unknown todo list is not found even with nothing to import
+	if _, err := repo.GetTodoListByID(ctx, listID); err != nil {
+		return nil, err
+	}
+
+	imported := []repository.Todo{}
+	for _, todo := range todos {
+		todo.ListID = listID
+		inserted, err := insertImportedTodo(ctx, repo, todo)
+		if err != nil {
+			return imported, err
+		}
+		imported = append(imported, *inserted)
+	}
+	return imported, nil
+}
+
+// insertImportedTodo inserts a todo read from a file, keeping the dates it
+// was created and completed when it has them. Done todos without a creation
+// date were created when completed.
+func insertImportedTodo(ctx context.Context, repo repository.Repository, todo repository.Todo) (*repository.Todo, error) {
+	createdAt, completedAt := todo.CreatedAt, todo.CompletedAt
+
+	// A completion date is set by marking the todo done once inserted,
+	// which can't be before it was created
+	done := todo.Done && !completedAt.IsZero()
+	if done {
+		todo.Done = false
+		if createdAt.IsZero() || createdAt.After(completedAt) {
+			createdAt = completedAt
+		}
+	}
+
+	insertCtx := ctx
+	if !createdAt.IsZero() {
+		insertCtx = repository.WithClock(ctx, func() time.Time { return createdAt })
+	}
+	inserted, err := repo.InsertTodo(insertCtx, todo)
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		return inserted, nil
+	}
+
+	inserted.Done = true
+	completeCtx := repository.WithClock(ctx, func() time.Time { return completedAt })
+	if err := repo.UpdateTodo(completeCtx, *inserted); err != nil {
+		return nil, err
+	}
+	return repo.GetTodoByID(ctx, inserted.ID)
+}
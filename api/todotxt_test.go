@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+func TestParseTodoTxt(t *testing.T) {
+	type Test struct {
+		name    string
+		content string
+		want    []repository.Todo
+	}
+
+	march1 := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	march2 := time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []Test{
+		{
+			name:    "Description",
+			content: "Make the bed\n",
+			want:    []repository.Todo{{Description: "Make the bed"}},
+		},
+		{
+			name:    "PriorityAndCreationDate",
+			content: "(A) 2021-03-01 Call mom",
+			want:    []repository.Todo{{Description: "Call mom", Labels: []string{"priority:A"}, CreatedAt: march1}},
+		},
+		{
+			name:    "ProjectsAndContexts",
+			content: "Water the plants +garden @home +chores",
+			want:    []repository.Todo{{Description: "Water the plants", Labels: []string{"garden", "@home", "chores"}}},
+		},
+		{
+			name:    "DueDate",
+			content: "Pay the rent due:2021-03-01",
+			want:    []repository.Todo{{Description: "Pay the rent", DueDate: march1}},
+		},
+		{
+			name:    "DueTimestamp",
+			content: "Pay the rent due:2021-03-01T15:30:00Z",
+			want:    []repository.Todo{{Description: "Pay the rent", DueDate: march1.Add(15*time.Hour + 30*time.Minute)}},
+		},
+		{
+			name:    "Done",
+			content: "x 2021-03-02 2021-03-01 Make the bed pri:B",
+			want:    []repository.Todo{{Description: "Make the bed", Done: true, CompletedAt: march2, CreatedAt: march1, Labels: []string{"priority:B"}}},
+		},
+		{
+			name:    "DoneWithoutDates",
+			content: "x Make the bed",
+			want:    []repository.Todo{{Description: "Make the bed", Done: true}},
+		},
+		{
+			name:    "NotMarkers",
+			content: "xylophone lessons (a) + @ key:value\n\n  \nA 2021-03-01 date",
+			want: []repository.Todo{
+				{Description: "xylophone lessons (a) + @ key:value"},
+				{Description: "A 2021-03-01 date"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTodoTxt(strings.NewReader(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parseTodoTxt() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseTodoTxtInvalid(t *testing.T) {
+	for _, content := range []string{
+		"Pay the rent due:tomorrow",
+		"Make the bed\n(A) 2021-03-01 +chores",
+		"x",
+		strings.Repeat("a", todoTxtMaxLine+1),
+	} {
+		if _, err := parseTodoTxt(strings.NewReader(content)); !errors.Is(err, ErrInvalidTodoTxt) {
+			t.Errorf("parseTodoTxt(%.40q) got error %v; want %v", content, err, ErrInvalidTodoTxt)
+		}
+	}
+}
+
+func TestFormatTodoTxt(t *testing.T) {
+	march1 := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	march2 := time.Date(2021, time.March, 2, 18, 0, 0, 0, time.UTC)
+
+	todos := []repository.Todo{
+		{Description: "Call mom", Labels: []string{"family", "priority:A", "@phone"}, CreatedAt: march1},
+		{Description: "Make the bed", Done: true, Labels: []string{"priority:B"}, CreatedAt: march1, CompletedAt: march2},
+		{Description: "Pay the rent", DueDate: time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC), CreatedAt: march1},
+		{Description: "Catch the train", DueDate: march2, Labels: []string{"priority:C", "priority:D", "long trip"}, CreatedAt: march1},
+		{Description: "Water\nthe   plants", CreatedAt: march1},
+	}
+	want := strings.Join([]string{
+		"(A) 2021-03-01 Call mom +family @phone",
+		"x 2021-03-02 2021-03-01 Make the bed pri:B",
+		"2021-03-01 Pay the rent due:2021-03-05",
+		"(C) 2021-03-01 Catch the train +priority:D +long_trip due:2021-03-02T18:00:00Z",
+		"2021-03-01 Water the plants",
+	}, "\n") + "\n"
+
+	got := &strings.Builder{}
+	if err := formatTodoTxt(got, todos); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("formatTodoTxt() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Parsing it back loses nothing todo.txt has room for
+	parsed, err := parseTodoTxt(strings.NewReader(got.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(t time.Time) time.Time { return t.Truncate(24 * time.Hour) }
+	for i, todo := range todos {
+		todo.Description = strings.Join(strings.Fields(todo.Description), " ")
+		todo.CreatedAt = day(todo.CreatedAt)
+		todo.CompletedAt = day(todo.CompletedAt)
+		if todo.Labels != nil {
+			priority, others := splitPriority(todo.Labels)
+			if priority != "" {
+				others = append([]string{PriorityLabelPrefix + priority}, others...)
+			}
+			for j, label := range others {
+				others[j] = strings.ReplaceAll(label, " ", "_")
+			}
+			todo.Labels = others
+		}
+		if diff := cmp.Diff(todo, parsed[i]); diff != "" {
+			t.Errorf("task %d mismatch after parsing it back (-want +got):\n%s", i, diff)
+		}
+	}
+}
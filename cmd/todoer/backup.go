@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// runBackup writes a backup of the file storage at a data directory, which
+// the service must not be running on.
+func runBackup(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s backup [flags]\n\nWrites a backup of the data directory as JSON.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	var dataDir string
+	var output string
+	flags.StringVar(&dataDir, "data-dir", "data", "directory where the file storage keeps its data")
+	flags.StringVar(&output, "o", "-", "file the backup is written to, - is the standard output")
+	flags.Parse(args)
+
+	backup, err := backupDataDir(dataDir, output)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("backed up %d todo lists and %d todos of %q", len(backup.TodoLists), len(backup.Todos), dataDir)
+}
+
+// backupDataDir writes a backup of the file storage at dataDir to output,
+// reading the data directory without writing anything to it.
+func backupDataDir(dataDir, output string) (*repository.Backup, error) {
+	localStorage, err := repository.LoadFileStorage(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file storage at %q: %w", dataDir, err)
+	}
+
+	backup, err := localStorage.Backup(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %q: %w", dataDir, err)
+	}
+
+	if output == "-" {
+		err = writeBackup(os.Stdout, backup)
+	} else {
+		err = writeBackupFile(output, backup)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return backup, nil
+}
+
+func writeBackup(w io.Writer, backup *repository.Backup) error {
+	buffered := bufio.NewWriter(w)
+	if err := repository.WriteBackup(buffered, backup); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// writeBackupFile writes backup to a new file at path, which is synced to
+// disk before returning.
+func writeBackupFile(path string, backup *repository.Backup) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeBackup(f, backup); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runRestore restores a backup on the file storage at a data directory,
+// which the service must not be running on.
+func runRestore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s restore [flags] [FILE]\n\nRestores a backup on the data directory, read from FILE or the standard input.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	var dataDir string
+	var replace bool
+	flags.StringVar(&dataDir, "data-dir", "data", "directory where the file storage keeps its data")
+	flags.BoolVar(&replace, "replace", false, "drop the data already there instead of merging the backup with it")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	backup, err := restoreDataDir(dataDir, flags.Arg(0), replace)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("restored %d todo lists and %d todos on %q", len(backup.TodoLists), len(backup.Todos), dataDir)
+}
+
+// restoreDataDir restores the backup read from input, or the standard input
+// when empty or -, on the file storage at dataDir. The file storage is closed
+// before returning, snapshotting what was restored.
+func restoreDataDir(dataDir, input string, replace bool) (backup *repository.Backup, err error) {
+	var r io.Reader = os.Stdin
+	if input != "" && input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %q: %w", input, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	backup, err = repository.ReadBackup(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	fileStorage, err := repository.NewFileStorage(dataDir, repository.FileStorageOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file storage at %q: %w", dataDir, err)
+	}
+	defer func() {
+		if closeErr := fileStorage.Close(); closeErr != nil && err == nil {
+			backup, err = nil, fmt.Errorf("failed to close file storage at %q: %w", dataDir, closeErr)
+		}
+	}()
+
+	mode := repository.RestoreMerge
+	if replace {
+		mode = repository.RestoreReplace
+	}
+	if err := fileStorage.Restore(context.Background(), *backup, mode); err != nil {
+		return nil, fmt.Errorf("failed to restore backup on %q: %w", dataDir, err)
+	}
+	return backup, nil
+}
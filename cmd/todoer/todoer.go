@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,29 +22,143 @@ import (
 func main() {
 	const timeout = 10 * time.Second
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		}
+	}
+
 	var port int
 	var grpcServer bool
+	var storage string
+	var dataDir string
+	var trashRetention time.Duration
+	var strictLabels bool
+	var attachmentsDir string
+	var maxAttachmentSize int64
+	var requireAuth bool
+	var trustUserHeader bool
+	var adminToken string
+	var jwtJWKS string
+	var jwtKey string
+	var jwtSecret string
+	var jwtIssuer string
+	var jwtAudience string
+	var jwtClockSkew time.Duration
+	var readLimit api.Limit
+	var writeLimit api.Limit
+	routeLimits := routeLimitsFlag{}
+	var clientIPHeader string
+	var clientIPHops int
 
 	flag.IntVar(&port, "port", 8080, "port where the service will be listening to")
 	flag.BoolVar(&grpcServer, "grpc", false, "run todoer service with grpc server")
+	flag.StringVar(&storage, "storage", "memory", "storage backend to use: memory or file")
+	flag.StringVar(&dataDir, "data-dir", "data", "directory where the file storage keeps its data")
+	flag.DurationVar(&trashRetention, "trash-retention", 30*24*time.Hour, "how long deleted items stay on the trash before being purged, 0 keeps them forever")
+	flag.BoolVar(&strictLabels, "strict-labels", false, "refuse todos having labels that are not registered")
+	flag.StringVar(&attachmentsDir, "attachments-dir", "attachments", "directory where the content of attachments is kept")
+	flag.Int64Var(&maxAttachmentSize, "max-attachment-size", repository.DefaultMaxBlobSize, "biggest attachment accepted, in bytes")
+	flag.BoolVar(&requireAuth, "require-auth", false, "refuse requests without a valid API token")
+	flag.BoolVar(&trustUserHeader, "trust-user-header", false, "let requests without a token name their user on X-User, only safe behind a proxy authenticating users")
+	flag.StringVar(&adminToken, "admin-token", "", "secret accepted as a token with the admin scope, to create the first users and tokens")
+	flag.StringVar(&jwtJWKS, "jwt-jwks", "", "JSON Web Key Set file whose keys verify JWT bearer tokens")
+	flag.StringVar(&jwtKey, "jwt-key", "", "PEM file with an RSA or ECDSA public key, or a certificate, verifying JWT bearer tokens")
+	flag.StringVar(&jwtSecret, "jwt-secret", "", "HMAC secret verifying HS256 JWT bearer tokens")
+	flag.StringVar(&jwtIssuer, "jwt-issuer", "", "issuer JWT bearer tokens must have, empty accepts any")
+	flag.StringVar(&jwtAudience, "jwt-audience", "", "audience JWT bearer tokens must have, empty accepts any")
+	flag.DurationVar(&jwtClockSkew, "jwt-clock-skew", time.Minute, "how far the clock of the JWT issuer may be apart")
+	flag.Float64Var(&readLimit.Rate, "read-rate", 0, "requests per second each client may make that only read, 0 is unlimited")
+	flag.IntVar(&readLimit.Burst, "read-burst", 0, "requests each client may make at once that only read, 0 is the read rate")
+	flag.Float64Var(&writeLimit.Rate, "write-rate", 0, "requests per second each client may make that write, 0 is unlimited")
+	flag.IntVar(&writeLimit.Burst, "write-burst", 0, "requests each client may make at once that write, 0 is the write rate")
+	flag.Var(routeLimits, "rate-limit", "limit of a route or gRPC method instead of the read or write one, as ROUTE=RATE[,BURST], may be repeated")
+	flag.StringVar(&clientIPHeader, "client-ip-header", "", "header where a trusted proxy puts the IP address of clients, like X-Forwarded-For")
+	flag.IntVar(&clientIPHops, "client-ip-hops", 1, "how many trusted proxies append to the client IP header, the client being that many entries from its end")
 	flag.Parse()
 
-	repo := repository.NewLocalStorage()
+	var repo repository.Repository
+	switch storage {
+	case "memory":
+		localStorage := repository.NewLocalStorage()
+		localStorage.StrictLabels = strictLabels
+		repo = localStorage
+	case "file":
+		fileStorage, err := repository.NewFileStorage(dataDir, repository.FileStorageOptions{StrictLabels: strictLabels})
+		if err != nil {
+			log.Fatalf("failed to open file storage at %q: %v", dataDir, err)
+		}
+		log.Infof("using file storage at %q", dataDir)
+		repo = fileStorage
+	default:
+		log.Fatalf("unknown storage %q, must be memory or file", storage)
+	}
+
+	blobs, err := repository.NewBlobStore(attachmentsDir, maxAttachmentSize)
+	if err != nil {
+		log.Fatalf("failed to open attachments at %q: %v", attachmentsDir, err)
+	}
+
+	if trashRetention > 0 {
+		go purgeTrash(repo, trashRetention)
+	}
+	go sweepAttachments(repo, blobs)
+
+	auth := api.AuthOptions{Required: requireAuth, TrustUserHeader: trustUserHeader, AdminToken: adminToken}
+	if jwtJWKS != "" || jwtKey != "" || jwtSecret != "" {
+		keys, err := loadJWTKeys(jwtJWKS, jwtKey, jwtSecret)
+		if err != nil {
+			log.Fatalf("failed to load JWT keys: %v", err)
+		}
+		auth.JWT = &api.JWTVerifier{
+			Keys:      keys,
+			Issuer:    jwtIssuer,
+			Audience:  jwtAudience,
+			ClockSkew: jwtClockSkew,
+		}
+		log.Infof("accepting JWT bearer tokens verified by %d keys", keys.Len())
+	}
+	if requireAuth && adminToken == "" && auth.JWT == nil && storage == "memory" {
+		log.Warning("authentication is required but no token can exist: set -admin-token to create the first ones")
+	}
+
+	var limiter *api.RateLimiter
+	if readLimit.Rate > 0 || writeLimit.Rate > 0 || len(routeLimits) > 0 {
+		limiter = api.NewRateLimiter(api.RateLimits{
+			Read:           readLimit,
+			Write:          writeLimit,
+			Routes:         routeLimits,
+			ClientIPHeader: clientIPHeader,
+			TrustedHops:    clientIPHops,
+		})
+	}
 
 	if grpcServer {
-		grpcApi := api.NewGrpcApi(repo)
+		grpcApi := api.NewGrpcApi(repo, blobs)
+		grpcApi.Auth = auth
+		grpcApi.Limiter = limiter
 
 		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 		if err != nil {
 			log.Fatalf("failed to listen: %v", err)
 		}
-		server := grpc.NewServer()
+		server := grpc.NewServer(
+			grpc.ChainUnaryInterceptor(grpcApi.RateLimitUnverifiedUnary, grpcApi.IdentifyUnary, grpcApi.RateLimitUnary),
+			grpc.ChainStreamInterceptor(grpcApi.RateLimitUnverifiedStream, grpcApi.IdentifyStream, grpcApi.RateLimitStream),
+		)
 		pb.RegisterTodoerServer(server, grpcApi)
 
 		log.Infof("running todoer service over gRPC, listening on port %d", port)
 		log.Fatal(server.Serve(lis))
 	} else {
-		restApi := api.NewApi(repo)
+		restApi := api.NewApi(repo, blobs)
+		restApi.Auth = auth
+		restApi.Limiter = limiter
 		service := restApi.RegisterRoutes()
 
 		server := &http.Server{
@@ -54,3 +172,116 @@ func main() {
 		log.Fatal(server.ListenAndServe())
 	}
 }
+
+// routeLimitsFlag is a flag setting the limit of routes and gRPC methods,
+// each given as ROUTE=RATE[,BURST].
+type routeLimitsFlag map[string]api.Limit
+
+func (f routeLimitsFlag) String() string {
+	limits := []string{}
+	for route, limit := range f {
+		limits = append(limits, fmt.Sprintf("%s=%v,%d", route, limit.Rate, limit.Burst))
+	}
+	return strings.Join(limits, " ")
+}
+
+func (f routeLimitsFlag) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("limit %q is not ROUTE=RATE[,BURST]", value)
+	}
+	route, rest := value[:i], value[i+1:]
+
+	limit := api.Limit{}
+	parts := strings.SplitN(rest, ",", 2)
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate < 0 {
+		return fmt.Errorf("rate of %q is not a valid number of requests per second", value)
+	}
+	limit.Rate = rate
+	if len(parts) == 2 {
+		burst, err := strconv.Atoi(parts[1])
+		if err != nil || burst < 0 {
+			return fmt.Errorf("burst of %q is not a valid number of requests", value)
+		}
+		limit.Burst = burst
+	}
+
+	f[route] = limit
+	return nil
+}
+
+// loadJWTKeys returns the keys verifying JWTs, from a JWKS file, a PEM
+// public key file and an HMAC secret, each skipped when empty.
+func loadJWTKeys(jwksPath, keyPath, secret string) (*api.KeySet, error) {
+	keys := api.NewKeySet()
+	if jwksPath != "" {
+		var err error
+		keys, err = api.LoadJWKS(jwksPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", jwksPath, err)
+		}
+	}
+	if keyPath != "" {
+		key, err := api.LoadPublicKey(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", keyPath, err)
+		}
+		if err := keys.Add("", key); err != nil {
+			return nil, fmt.Errorf("reading %q: %w", keyPath, err)
+		}
+	}
+	if secret != "" {
+		if err := keys.Add("", []byte(secret)); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// purgeTrash periodically purges every item deleted more than retention ago.
+func purgeTrash(repo repository.Repository, retention time.Duration) {
+	interval := time.Hour
+	if retention < interval {
+		interval = retention
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := repo.PurgeTrash(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.WithError(err).Error("failed to purge trash")
+		} else if purged > 0 {
+			log.Infof("purged %d items deleted more than %v ago", purged, retention)
+		}
+		<-ticker.C
+	}
+}
+
+// sweepAttachments periodically removes the content no attachment has
+// anymore. Content written during the last interval is kept, as it may be
+// an upload not yet on any attachment.
+func sweepAttachments(repo repository.Repository, blobs *repository.BlobStore) {
+	const interval = time.Hour
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		modifiedBefore := time.Now().Add(-interval)
+		hashes, err := repo.GetAttachmentHashes(context.Background())
+		if err != nil {
+			log.WithError(err).Error("failed to sweep attachments")
+			continue
+		}
+		removed, err := blobs.Sweep(hashes, modifiedBefore)
+		if err != nil {
+			log.WithError(err).Error("failed to sweep attachments")
+		} else if removed > 0 {
+			log.Infof("removed the content of %d deleted attachments", removed)
+		}
+	}
+}
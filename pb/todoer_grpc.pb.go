@@ -24,12 +24,70 @@ type TodoerClient interface {
 	GetTodoList(ctx context.Context, in *GetTodoListRequest, opts ...grpc.CallOption) (*GetTodoListReply, error)
 	UpdateTodoList(ctx context.Context, in *UpdateTodoListRequest, opts ...grpc.CallOption) (*Empty, error)
 	DeleteTodoList(ctx context.Context, in *DeleteTodoListRequest, opts ...grpc.CallOption) (*Empty, error)
+	GetTodoListHistory(ctx context.Context, in *GetTodoListHistoryRequest, opts ...grpc.CallOption) (*GetHistoryReply, error)
+	ShareTodoList(ctx context.Context, in *ShareTodoListRequest, opts ...grpc.CallOption) (*ShareTodoListReply, error)
+	UnshareTodoList(ctx context.Context, in *UnshareTodoListRequest, opts ...grpc.CallOption) (*UnshareTodoListReply, error)
 	// Todo
 	CreateTodo(ctx context.Context, in *CreateTodoRequest, opts ...grpc.CallOption) (*CreateTodoReply, error)
 	GetTodosByList(ctx context.Context, in *GetTodosByListRequest, opts ...grpc.CallOption) (*GetTodosByListReply, error)
+	QueryTodos(ctx context.Context, in *QueryTodosRequest, opts ...grpc.CallOption) (*QueryTodosReply, error)
 	GetTodo(ctx context.Context, in *GetTodoRequest, opts ...grpc.CallOption) (*GetTodoReply, error)
 	UpdateTodo(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*Empty, error)
+	MoveTodo(ctx context.Context, in *MoveTodoRequest, opts ...grpc.CallOption) (*MoveTodoReply, error)
 	DeleteTodo(ctx context.Context, in *DeleteTodoRequest, opts ...grpc.CallOption) (*Empty, error)
+	GetTodoHistory(ctx context.Context, in *GetTodoHistoryRequest, opts ...grpc.CallOption) (*GetHistoryReply, error)
+	// Dependencies
+	AddDependency(ctx context.Context, in *DependencyRequest, opts ...grpc.CallOption) (*Empty, error)
+	RemoveDependency(ctx context.Context, in *DependencyRequest, opts ...grpc.CallOption) (*Empty, error)
+	GetBlockers(ctx context.Context, in *GetBlockersRequest, opts ...grpc.CallOption) (*GetBlockersReply, error)
+	// todo.txt
+	ExportTodoTxt(ctx context.Context, in *ExportTodoTxtRequest, opts ...grpc.CallOption) (*ExportTodoTxtReply, error)
+	ImportTodoTxt(ctx context.Context, in *ImportTodoTxtRequest, opts ...grpc.CallOption) (*ImportTodoTxtReply, error)
+	// Calendar
+	ExportCalendar(ctx context.Context, in *ExportCalendarRequest, opts ...grpc.CallOption) (*ExportCalendarReply, error)
+	ImportCalendar(ctx context.Context, in *ImportCalendarRequest, opts ...grpc.CallOption) (*ImportCalendarReply, error)
+	CreateCalendarToken(ctx context.Context, in *CalendarTokenRequest, opts ...grpc.CallOption) (*CreateCalendarTokenReply, error)
+	DeleteCalendarToken(ctx context.Context, in *CalendarTokenRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Users
+	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserReply, error)
+	GetAllUsers(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetAllUsersReply, error)
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserReply, error)
+	// Tokens
+	CreateToken(ctx context.Context, in *CreateTokenRequest, opts ...grpc.CallOption) (*CreateTokenReply, error)
+	GetTokens(ctx context.Context, in *GetTokensRequest, opts ...grpc.CallOption) (*GetTokensReply, error)
+	GetToken(ctx context.Context, in *GetTokenRequest, opts ...grpc.CallOption) (*GetTokenReply, error)
+	DeleteToken(ctx context.Context, in *DeleteTokenRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Labels
+	CreateLabel(ctx context.Context, in *CreateLabelRequest, opts ...grpc.CallOption) (*CreateLabelReply, error)
+	GetAllLabels(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetAllLabelsReply, error)
+	GetLabel(ctx context.Context, in *GetLabelRequest, opts ...grpc.CallOption) (*GetLabelReply, error)
+	UpdateLabel(ctx context.Context, in *UpdateLabelRequest, opts ...grpc.CallOption) (*Empty, error)
+	RenameLabel(ctx context.Context, in *RenameLabelRequest, opts ...grpc.CallOption) (*RenameLabelReply, error)
+	DeleteLabel(ctx context.Context, in *DeleteLabelRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Comments
+	CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentReply, error)
+	GetComments(ctx context.Context, in *GetCommentsRequest, opts ...grpc.CallOption) (*GetCommentsReply, error)
+	GetComment(ctx context.Context, in *GetCommentRequest, opts ...grpc.CallOption) (*GetCommentReply, error)
+	UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*Empty, error)
+	DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Attachments
+	UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (Todoer_UploadAttachmentClient, error)
+	GetAttachments(ctx context.Context, in *GetAttachmentsRequest, opts ...grpc.CallOption) (*GetAttachmentsReply, error)
+	GetAttachment(ctx context.Context, in *GetAttachmentRequest, opts ...grpc.CallOption) (*GetAttachmentReply, error)
+	DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (Todoer_DownloadAttachmentClient, error)
+	DeleteAttachment(ctx context.Context, in *DeleteAttachmentRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Search
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchReply, error)
+	// Trash
+	GetTrash(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetTrashReply, error)
+	RestoreTodoList(ctx context.Context, in *RestoreTodoListRequest, opts ...grpc.CallOption) (*RestoreTodoListReply, error)
+	RestoreTodo(ctx context.Context, in *RestoreTodoRequest, opts ...grpc.CallOption) (*RestoreTodoReply, error)
+	PurgeTodoList(ctx context.Context, in *PurgeTodoListRequest, opts ...grpc.CallOption) (*Empty, error)
+	PurgeTodo(ctx context.Context, in *PurgeTodoRequest, opts ...grpc.CallOption) (*Empty, error)
+	PurgeTrash(ctx context.Context, in *PurgeTrashRequest, opts ...grpc.CallOption) (*PurgeTrashReply, error)
+	// Backups
+	Backup(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Todoer_BackupClient, error)
+	Restore(ctx context.Context, opts ...grpc.CallOption) (Todoer_RestoreClient, error)
 }
 
 type todoerClient struct {
@@ -85,6 +143,33 @@ func (c *todoerClient) DeleteTodoList(ctx context.Context, in *DeleteTodoListReq
 	return out, nil
 }
 
+func (c *todoerClient) GetTodoListHistory(ctx context.Context, in *GetTodoListHistoryRequest, opts ...grpc.CallOption) (*GetHistoryReply, error) {
+	out := new(GetHistoryReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetTodoListHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) ShareTodoList(ctx context.Context, in *ShareTodoListRequest, opts ...grpc.CallOption) (*ShareTodoListReply, error) {
+	out := new(ShareTodoListReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/ShareTodoList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) UnshareTodoList(ctx context.Context, in *UnshareTodoListRequest, opts ...grpc.CallOption) (*UnshareTodoListReply, error) {
+	out := new(UnshareTodoListReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/UnshareTodoList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *todoerClient) CreateTodo(ctx context.Context, in *CreateTodoRequest, opts ...grpc.CallOption) (*CreateTodoReply, error) {
 	out := new(CreateTodoReply)
 	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateTodo", in, out, opts...)
@@ -103,6 +188,15 @@ func (c *todoerClient) GetTodosByList(ctx context.Context, in *GetTodosByListReq
 	return out, nil
 }
 
+func (c *todoerClient) QueryTodos(ctx context.Context, in *QueryTodosRequest, opts ...grpc.CallOption) (*QueryTodosReply, error) {
+	out := new(QueryTodosReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/QueryTodos", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *todoerClient) GetTodo(ctx context.Context, in *GetTodoRequest, opts ...grpc.CallOption) (*GetTodoReply, error) {
 	out := new(GetTodoReply)
 	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetTodo", in, out, opts...)
@@ -118,264 +212,1814 @@ func (c *todoerClient) UpdateTodo(ctx context.Context, in *UpdateTodoRequest, op
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return out, nil
+}
+
+func (c *todoerClient) MoveTodo(ctx context.Context, in *MoveTodoRequest, opts ...grpc.CallOption) (*MoveTodoReply, error) {
+	out := new(MoveTodoReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/MoveTodo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DeleteTodo(ctx context.Context, in *DeleteTodoRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteTodo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetTodoHistory(ctx context.Context, in *GetTodoHistoryRequest, opts ...grpc.CallOption) (*GetHistoryReply, error) {
+	out := new(GetHistoryReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetTodoHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) AddDependency(ctx context.Context, in *DependencyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/AddDependency", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) RemoveDependency(ctx context.Context, in *DependencyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/RemoveDependency", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetBlockers(ctx context.Context, in *GetBlockersRequest, opts ...grpc.CallOption) (*GetBlockersReply, error) {
+	out := new(GetBlockersReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetBlockers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) ExportTodoTxt(ctx context.Context, in *ExportTodoTxtRequest, opts ...grpc.CallOption) (*ExportTodoTxtReply, error) {
+	out := new(ExportTodoTxtReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/ExportTodoTxt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) ImportTodoTxt(ctx context.Context, in *ImportTodoTxtRequest, opts ...grpc.CallOption) (*ImportTodoTxtReply, error) {
+	out := new(ImportTodoTxtReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/ImportTodoTxt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) ExportCalendar(ctx context.Context, in *ExportCalendarRequest, opts ...grpc.CallOption) (*ExportCalendarReply, error) {
+	out := new(ExportCalendarReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/ExportCalendar", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) ImportCalendar(ctx context.Context, in *ImportCalendarRequest, opts ...grpc.CallOption) (*ImportCalendarReply, error) {
+	out := new(ImportCalendarReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/ImportCalendar", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) CreateCalendarToken(ctx context.Context, in *CalendarTokenRequest, opts ...grpc.CallOption) (*CreateCalendarTokenReply, error) {
+	out := new(CreateCalendarTokenReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateCalendarToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DeleteCalendarToken(ctx context.Context, in *CalendarTokenRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteCalendarToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*CreateUserReply, error) {
+	out := new(CreateUserReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetAllUsers(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetAllUsersReply, error) {
+	out := new(GetAllUsersReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetAllUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserReply, error) {
+	out := new(GetUserReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) CreateToken(ctx context.Context, in *CreateTokenRequest, opts ...grpc.CallOption) (*CreateTokenReply, error) {
+	out := new(CreateTokenReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetTokens(ctx context.Context, in *GetTokensRequest, opts ...grpc.CallOption) (*GetTokensReply, error) {
+	out := new(GetTokensReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetTokens", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetToken(ctx context.Context, in *GetTokenRequest, opts ...grpc.CallOption) (*GetTokenReply, error) {
+	out := new(GetTokenReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DeleteToken(ctx context.Context, in *DeleteTokenRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) CreateLabel(ctx context.Context, in *CreateLabelRequest, opts ...grpc.CallOption) (*CreateLabelReply, error) {
+	out := new(CreateLabelReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetAllLabels(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetAllLabelsReply, error) {
+	out := new(GetAllLabelsReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetAllLabels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetLabel(ctx context.Context, in *GetLabelRequest, opts ...grpc.CallOption) (*GetLabelReply, error) {
+	out := new(GetLabelReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) UpdateLabel(ctx context.Context, in *UpdateLabelRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/UpdateLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) RenameLabel(ctx context.Context, in *RenameLabelRequest, opts ...grpc.CallOption) (*RenameLabelReply, error) {
+	out := new(RenameLabelReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/RenameLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DeleteLabel(ctx context.Context, in *DeleteLabelRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteLabel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentReply, error) {
+	out := new(CreateCommentReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/CreateComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetComments(ctx context.Context, in *GetCommentsRequest, opts ...grpc.CallOption) (*GetCommentsReply, error) {
+	out := new(GetCommentsReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetComments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetComment(ctx context.Context, in *GetCommentRequest, opts ...grpc.CallOption) (*GetCommentReply, error) {
+	out := new(GetCommentReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/UpdateComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) UploadAttachment(ctx context.Context, opts ...grpc.CallOption) (Todoer_UploadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todoer_ServiceDesc.Streams[0], "/todoer.Todoer/UploadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoerUploadAttachmentClient{stream}
+	return x, nil
+}
+
+type Todoer_UploadAttachmentClient interface {
+	Send(*UploadAttachmentRequest) error
+	CloseAndRecv() (*UploadAttachmentReply, error)
+	grpc.ClientStream
+}
+
+type todoerUploadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoerUploadAttachmentClient) Send(m *UploadAttachmentRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *todoerUploadAttachmentClient) CloseAndRecv() (*UploadAttachmentReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadAttachmentReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoerClient) GetAttachments(ctx context.Context, in *GetAttachmentsRequest, opts ...grpc.CallOption) (*GetAttachmentsReply, error) {
+	out := new(GetAttachmentsReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetAttachments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetAttachment(ctx context.Context, in *GetAttachmentRequest, opts ...grpc.CallOption) (*GetAttachmentReply, error) {
+	out := new(GetAttachmentReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetAttachment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) DownloadAttachment(ctx context.Context, in *DownloadAttachmentRequest, opts ...grpc.CallOption) (Todoer_DownloadAttachmentClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todoer_ServiceDesc.Streams[1], "/todoer.Todoer/DownloadAttachment", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoerDownloadAttachmentClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Todoer_DownloadAttachmentClient interface {
+	Recv() (*DownloadAttachmentReply, error)
+	grpc.ClientStream
+}
+
+type todoerDownloadAttachmentClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoerDownloadAttachmentClient) Recv() (*DownloadAttachmentReply, error) {
+	m := new(DownloadAttachmentReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoerClient) DeleteAttachment(ctx context.Context, in *DeleteAttachmentRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteAttachment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchReply, error) {
+	out := new(SearchReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) GetTrash(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*GetTrashReply, error) {
+	out := new(GetTrashReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/GetTrash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) RestoreTodoList(ctx context.Context, in *RestoreTodoListRequest, opts ...grpc.CallOption) (*RestoreTodoListReply, error) {
+	out := new(RestoreTodoListReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/RestoreTodoList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) RestoreTodo(ctx context.Context, in *RestoreTodoRequest, opts ...grpc.CallOption) (*RestoreTodoReply, error) {
+	out := new(RestoreTodoReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/RestoreTodo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) PurgeTodoList(ctx context.Context, in *PurgeTodoListRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/PurgeTodoList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) PurgeTodo(ctx context.Context, in *PurgeTodoRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/PurgeTodo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) PurgeTrash(ctx context.Context, in *PurgeTrashRequest, opts ...grpc.CallOption) (*PurgeTrashReply, error) {
+	out := new(PurgeTrashReply)
+	err := c.cc.Invoke(ctx, "/todoer.Todoer/PurgeTrash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoerClient) Backup(ctx context.Context, in *Empty, opts ...grpc.CallOption) (Todoer_BackupClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todoer_ServiceDesc.Streams[2], "/todoer.Todoer/Backup", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoerBackupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Todoer_BackupClient interface {
+	Recv() (*BackupReply, error)
+	grpc.ClientStream
+}
+
+type todoerBackupClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoerBackupClient) Recv() (*BackupReply, error) {
+	m := new(BackupReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoerClient) Restore(ctx context.Context, opts ...grpc.CallOption) (Todoer_RestoreClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Todoer_ServiceDesc.Streams[3], "/todoer.Todoer/Restore", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoerRestoreClient{stream}
+	return x, nil
+}
+
+type Todoer_RestoreClient interface {
+	Send(*RestoreRequest) error
+	CloseAndRecv() (*Empty, error)
+	grpc.ClientStream
+}
+
+type todoerRestoreClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoerRestoreClient) Send(m *RestoreRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *todoerRestoreClient) CloseAndRecv() (*Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TodoerServer is the server API for Todoer service.
+// All implementations must embed UnimplementedTodoerServer
+// for forward compatibility
+type TodoerServer interface {
+	// TodoList
+	CreateTodoList(context.Context, *CreateTodoListRequest) (*CreateTodoListReply, error)
+	GetAllTodoLists(context.Context, *Empty) (*GetAllTodoListsReply, error)
+	GetTodoList(context.Context, *GetTodoListRequest) (*GetTodoListReply, error)
+	UpdateTodoList(context.Context, *UpdateTodoListRequest) (*Empty, error)
+	DeleteTodoList(context.Context, *DeleteTodoListRequest) (*Empty, error)
+	GetTodoListHistory(context.Context, *GetTodoListHistoryRequest) (*GetHistoryReply, error)
+	ShareTodoList(context.Context, *ShareTodoListRequest) (*ShareTodoListReply, error)
+	UnshareTodoList(context.Context, *UnshareTodoListRequest) (*UnshareTodoListReply, error)
+	// Todo
+	CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoReply, error)
+	GetTodosByList(context.Context, *GetTodosByListRequest) (*GetTodosByListReply, error)
+	QueryTodos(context.Context, *QueryTodosRequest) (*QueryTodosReply, error)
+	GetTodo(context.Context, *GetTodoRequest) (*GetTodoReply, error)
+	UpdateTodo(context.Context, *UpdateTodoRequest) (*Empty, error)
+	MoveTodo(context.Context, *MoveTodoRequest) (*MoveTodoReply, error)
+	DeleteTodo(context.Context, *DeleteTodoRequest) (*Empty, error)
+	GetTodoHistory(context.Context, *GetTodoHistoryRequest) (*GetHistoryReply, error)
+	// Dependencies
+	AddDependency(context.Context, *DependencyRequest) (*Empty, error)
+	RemoveDependency(context.Context, *DependencyRequest) (*Empty, error)
+	GetBlockers(context.Context, *GetBlockersRequest) (*GetBlockersReply, error)
+	// todo.txt
+	ExportTodoTxt(context.Context, *ExportTodoTxtRequest) (*ExportTodoTxtReply, error)
+	ImportTodoTxt(context.Context, *ImportTodoTxtRequest) (*ImportTodoTxtReply, error)
+	// Calendar
+	ExportCalendar(context.Context, *ExportCalendarRequest) (*ExportCalendarReply, error)
+	ImportCalendar(context.Context, *ImportCalendarRequest) (*ImportCalendarReply, error)
+	CreateCalendarToken(context.Context, *CalendarTokenRequest) (*CreateCalendarTokenReply, error)
+	DeleteCalendarToken(context.Context, *CalendarTokenRequest) (*Empty, error)
+	// Users
+	CreateUser(context.Context, *CreateUserRequest) (*CreateUserReply, error)
+	GetAllUsers(context.Context, *Empty) (*GetAllUsersReply, error)
+	GetUser(context.Context, *GetUserRequest) (*GetUserReply, error)
+	// Tokens
+	CreateToken(context.Context, *CreateTokenRequest) (*CreateTokenReply, error)
+	GetTokens(context.Context, *GetTokensRequest) (*GetTokensReply, error)
+	GetToken(context.Context, *GetTokenRequest) (*GetTokenReply, error)
+	DeleteToken(context.Context, *DeleteTokenRequest) (*Empty, error)
+	// Labels
+	CreateLabel(context.Context, *CreateLabelRequest) (*CreateLabelReply, error)
+	GetAllLabels(context.Context, *Empty) (*GetAllLabelsReply, error)
+	GetLabel(context.Context, *GetLabelRequest) (*GetLabelReply, error)
+	UpdateLabel(context.Context, *UpdateLabelRequest) (*Empty, error)
+	RenameLabel(context.Context, *RenameLabelRequest) (*RenameLabelReply, error)
+	DeleteLabel(context.Context, *DeleteLabelRequest) (*Empty, error)
+	// Comments
+	CreateComment(context.Context, *CreateCommentRequest) (*CreateCommentReply, error)
+	GetComments(context.Context, *GetCommentsRequest) (*GetCommentsReply, error)
+	GetComment(context.Context, *GetCommentRequest) (*GetCommentReply, error)
+	UpdateComment(context.Context, *UpdateCommentRequest) (*Empty, error)
+	DeleteComment(context.Context, *DeleteCommentRequest) (*Empty, error)
+	// Attachments
+	UploadAttachment(Todoer_UploadAttachmentServer) error
+	GetAttachments(context.Context, *GetAttachmentsRequest) (*GetAttachmentsReply, error)
+	GetAttachment(context.Context, *GetAttachmentRequest) (*GetAttachmentReply, error)
+	DownloadAttachment(*DownloadAttachmentRequest, Todoer_DownloadAttachmentServer) error
+	DeleteAttachment(context.Context, *DeleteAttachmentRequest) (*Empty, error)
+	// Search
+	Search(context.Context, *SearchRequest) (*SearchReply, error)
+	// Trash
+	GetTrash(context.Context, *Empty) (*GetTrashReply, error)
+	RestoreTodoList(context.Context, *RestoreTodoListRequest) (*RestoreTodoListReply, error)
+	RestoreTodo(context.Context, *RestoreTodoRequest) (*RestoreTodoReply, error)
+	PurgeTodoList(context.Context, *PurgeTodoListRequest) (*Empty, error)
+	PurgeTodo(context.Context, *PurgeTodoRequest) (*Empty, error)
+	PurgeTrash(context.Context, *PurgeTrashRequest) (*PurgeTrashReply, error)
+	// Backups
+	Backup(*Empty, Todoer_BackupServer) error
+	Restore(Todoer_RestoreServer) error
+	mustEmbedUnimplementedTodoerServer()
+}
+
+// UnimplementedTodoerServer must be embedded to have forward compatible implementations.
+type UnimplementedTodoerServer struct {
+}
+
+func (UnimplementedTodoerServer) CreateTodoList(context.Context, *CreateTodoListRequest) (*CreateTodoListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTodoList not implemented")
+}
+func (UnimplementedTodoerServer) GetAllTodoLists(context.Context, *Empty) (*GetAllTodoListsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllTodoLists not implemented")
+}
+func (UnimplementedTodoerServer) GetTodoList(context.Context, *GetTodoListRequest) (*GetTodoListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodoList not implemented")
+}
+func (UnimplementedTodoerServer) UpdateTodoList(context.Context, *UpdateTodoListRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTodoList not implemented")
+}
+func (UnimplementedTodoerServer) DeleteTodoList(context.Context, *DeleteTodoListRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodoList not implemented")
+}
+func (UnimplementedTodoerServer) GetTodoListHistory(context.Context, *GetTodoListHistoryRequest) (*GetHistoryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodoListHistory not implemented")
+}
+func (UnimplementedTodoerServer) ShareTodoList(context.Context, *ShareTodoListRequest) (*ShareTodoListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShareTodoList not implemented")
+}
+func (UnimplementedTodoerServer) UnshareTodoList(context.Context, *UnshareTodoListRequest) (*UnshareTodoListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnshareTodoList not implemented")
+}
+func (UnimplementedTodoerServer) CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTodo not implemented")
+}
+func (UnimplementedTodoerServer) GetTodosByList(context.Context, *GetTodosByListRequest) (*GetTodosByListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodosByList not implemented")
+}
+func (UnimplementedTodoerServer) QueryTodos(context.Context, *QueryTodosRequest) (*QueryTodosReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryTodos not implemented")
+}
+func (UnimplementedTodoerServer) GetTodo(context.Context, *GetTodoRequest) (*GetTodoReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodo not implemented")
+}
+func (UnimplementedTodoerServer) UpdateTodo(context.Context, *UpdateTodoRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTodo not implemented")
+}
+func (UnimplementedTodoerServer) MoveTodo(context.Context, *MoveTodoRequest) (*MoveTodoReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveTodo not implemented")
+}
+func (UnimplementedTodoerServer) DeleteTodo(context.Context, *DeleteTodoRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodo not implemented")
+}
+func (UnimplementedTodoerServer) GetTodoHistory(context.Context, *GetTodoHistoryRequest) (*GetHistoryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodoHistory not implemented")
+}
+func (UnimplementedTodoerServer) AddDependency(context.Context, *DependencyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddDependency not implemented")
+}
+func (UnimplementedTodoerServer) RemoveDependency(context.Context, *DependencyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveDependency not implemented")
+}
+func (UnimplementedTodoerServer) GetBlockers(context.Context, *GetBlockersRequest) (*GetBlockersReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockers not implemented")
+}
+func (UnimplementedTodoerServer) ExportTodoTxt(context.Context, *ExportTodoTxtRequest) (*ExportTodoTxtReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportTodoTxt not implemented")
+}
+func (UnimplementedTodoerServer) ImportTodoTxt(context.Context, *ImportTodoTxtRequest) (*ImportTodoTxtReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportTodoTxt not implemented")
+}
+func (UnimplementedTodoerServer) ExportCalendar(context.Context, *ExportCalendarRequest) (*ExportCalendarReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportCalendar not implemented")
+}
+func (UnimplementedTodoerServer) ImportCalendar(context.Context, *ImportCalendarRequest) (*ImportCalendarReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportCalendar not implemented")
+}
+func (UnimplementedTodoerServer) CreateCalendarToken(context.Context, *CalendarTokenRequest) (*CreateCalendarTokenReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCalendarToken not implemented")
+}
+func (UnimplementedTodoerServer) DeleteCalendarToken(context.Context, *CalendarTokenRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCalendarToken not implemented")
+}
+func (UnimplementedTodoerServer) CreateUser(context.Context, *CreateUserRequest) (*CreateUserReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedTodoerServer) GetAllUsers(context.Context, *Empty) (*GetAllUsersReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllUsers not implemented")
+}
+func (UnimplementedTodoerServer) GetUser(context.Context, *GetUserRequest) (*GetUserReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedTodoerServer) CreateToken(context.Context, *CreateTokenRequest) (*CreateTokenReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateToken not implemented")
+}
+func (UnimplementedTodoerServer) GetTokens(context.Context, *GetTokensRequest) (*GetTokensReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTokens not implemented")
+}
+func (UnimplementedTodoerServer) GetToken(context.Context, *GetTokenRequest) (*GetTokenReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetToken not implemented")
+}
+func (UnimplementedTodoerServer) DeleteToken(context.Context, *DeleteTokenRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteToken not implemented")
+}
+func (UnimplementedTodoerServer) CreateLabel(context.Context, *CreateLabelRequest) (*CreateLabelReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateLabel not implemented")
+}
+func (UnimplementedTodoerServer) GetAllLabels(context.Context, *Empty) (*GetAllLabelsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllLabels not implemented")
+}
+func (UnimplementedTodoerServer) GetLabel(context.Context, *GetLabelRequest) (*GetLabelReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLabel not implemented")
+}
+func (UnimplementedTodoerServer) UpdateLabel(context.Context, *UpdateLabelRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLabel not implemented")
+}
+func (UnimplementedTodoerServer) RenameLabel(context.Context, *RenameLabelRequest) (*RenameLabelReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameLabel not implemented")
+}
+func (UnimplementedTodoerServer) DeleteLabel(context.Context, *DeleteLabelRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLabel not implemented")
+}
+func (UnimplementedTodoerServer) CreateComment(context.Context, *CreateCommentRequest) (*CreateCommentReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateComment not implemented")
+}
+func (UnimplementedTodoerServer) GetComments(context.Context, *GetCommentsRequest) (*GetCommentsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetComments not implemented")
+}
+func (UnimplementedTodoerServer) GetComment(context.Context, *GetCommentRequest) (*GetCommentReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetComment not implemented")
+}
+func (UnimplementedTodoerServer) UpdateComment(context.Context, *UpdateCommentRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateComment not implemented")
+}
+func (UnimplementedTodoerServer) DeleteComment(context.Context, *DeleteCommentRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteComment not implemented")
+}
+func (UnimplementedTodoerServer) UploadAttachment(Todoer_UploadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadAttachment not implemented")
+}
+func (UnimplementedTodoerServer) GetAttachments(context.Context, *GetAttachmentsRequest) (*GetAttachmentsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAttachments not implemented")
+}
+func (UnimplementedTodoerServer) GetAttachment(context.Context, *GetAttachmentRequest) (*GetAttachmentReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAttachment not implemented")
+}
+func (UnimplementedTodoerServer) DownloadAttachment(*DownloadAttachmentRequest, Todoer_DownloadAttachmentServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadAttachment not implemented")
+}
+func (UnimplementedTodoerServer) DeleteAttachment(context.Context, *DeleteAttachmentRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAttachment not implemented")
+}
+func (UnimplementedTodoerServer) Search(context.Context, *SearchRequest) (*SearchReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedTodoerServer) GetTrash(context.Context, *Empty) (*GetTrashReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrash not implemented")
+}
+func (UnimplementedTodoerServer) RestoreTodoList(context.Context, *RestoreTodoListRequest) (*RestoreTodoListReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreTodoList not implemented")
+}
+func (UnimplementedTodoerServer) RestoreTodo(context.Context, *RestoreTodoRequest) (*RestoreTodoReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreTodo not implemented")
+}
+func (UnimplementedTodoerServer) PurgeTodoList(context.Context, *PurgeTodoListRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeTodoList not implemented")
+}
+func (UnimplementedTodoerServer) PurgeTodo(context.Context, *PurgeTodoRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeTodo not implemented")
+}
+func (UnimplementedTodoerServer) PurgeTrash(context.Context, *PurgeTrashRequest) (*PurgeTrashReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeTrash not implemented")
+}
+func (UnimplementedTodoerServer) Backup(*Empty, Todoer_BackupServer) error {
+	return status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedTodoerServer) Restore(Todoer_RestoreServer) error {
+	return status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedTodoerServer) mustEmbedUnimplementedTodoerServer() {}
+
+// UnsafeTodoerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TodoerServer will
+// result in compilation errors.
+type UnsafeTodoerServer interface {
+	mustEmbedUnimplementedTodoerServer()
+}
+
+func RegisterTodoerServer(s grpc.ServiceRegistrar, srv TodoerServer) {
+	s.RegisterService(&Todoer_ServiceDesc, srv)
+}
+
+func _Todoer_CreateTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateTodoList(ctx, req.(*CreateTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetAllTodoLists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetAllTodoLists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetAllTodoLists",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetAllTodoLists(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTodoList(ctx, req.(*GetTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_UpdateTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).UpdateTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/UpdateTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).UpdateTodoList(ctx, req.(*UpdateTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_DeleteTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteTodoList(ctx, req.(*DeleteTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTodoListHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodoListHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTodoListHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTodoListHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTodoListHistory(ctx, req.(*GetTodoListHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_ShareTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).ShareTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/ShareTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).ShareTodoList(ctx, req.(*ShareTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_UnshareTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnshareTodoListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).UnshareTodoList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/UnshareTodoList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).UnshareTodoList(ctx, req.(*UnshareTodoListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateTodo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateTodo(ctx, req.(*CreateTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTodosByList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodosByListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTodosByList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTodosByList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTodosByList(ctx, req.(*GetTodosByListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_QueryTodos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryTodosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).QueryTodos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/QueryTodos",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).QueryTodos(ctx, req.(*QueryTodosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTodo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTodo(ctx, req.(*GetTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_UpdateTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).UpdateTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/UpdateTodo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).UpdateTodo(ctx, req.(*UpdateTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_MoveTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).MoveTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/MoveTodo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).MoveTodo(ctx, req.(*MoveTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_DeleteTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteTodo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteTodo(ctx, req.(*DeleteTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTodoHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodoHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTodoHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTodoHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTodoHistory(ctx, req.(*GetTodoHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_AddDependency_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DependencyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).AddDependency(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/AddDependency",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).AddDependency(ctx, req.(*DependencyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_RemoveDependency_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DependencyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).RemoveDependency(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/RemoveDependency",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).RemoveDependency(ctx, req.(*DependencyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetBlockers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetBlockers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetBlockers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetBlockers(ctx, req.(*GetBlockersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_ExportTodoTxt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportTodoTxtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).ExportTodoTxt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/ExportTodoTxt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).ExportTodoTxt(ctx, req.(*ExportTodoTxtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_ImportTodoTxt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportTodoTxtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).ImportTodoTxt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/ImportTodoTxt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).ImportTodoTxt(ctx, req.(*ImportTodoTxtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_ExportCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).ExportCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/ExportCalendar",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).ExportCalendar(ctx, req.(*ExportCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_ImportCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).ImportCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/ImportCalendar",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).ImportCalendar(ctx, req.(*ImportCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateCalendarToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateCalendarToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateCalendarToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateCalendarToken(ctx, req.(*CalendarTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_DeleteCalendarToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalendarTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteCalendarToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteCalendarToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteCalendarToken(ctx, req.(*CalendarTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateUser(ctx, req.(*CreateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetAllUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetAllUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetAllUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetAllUsers(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateToken(ctx, req.(*CreateTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTokensRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetTokens",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetTokens(ctx, req.(*GetTokensRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetToken(ctx, req.(*GetTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_DeleteToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteToken(ctx, req.(*DeleteTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateLabel(ctx, req.(*CreateLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetAllLabels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetAllLabels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetAllLabels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetAllLabels(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetLabel(ctx, req.(*GetLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_UpdateLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).UpdateLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/UpdateLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).UpdateLabel(ctx, req.(*UpdateLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_RenameLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).RenameLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/RenameLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).RenameLabel(ctx, req.(*RenameLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_DeleteLabel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteLabel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteLabel(ctx, req.(*DeleteLabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_CreateComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).CreateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/CreateComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).CreateComment(ctx, req.(*CreateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetComments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCommentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetComments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetComments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetComments(ctx, req.(*GetCommentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_GetComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).GetComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/GetComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).GetComment(ctx, req.(*GetCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Todoer_UpdateComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoerServer).UpdateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/UpdateComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).UpdateComment(ctx, req.(*UpdateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *todoerClient) DeleteTodo(ctx context.Context, in *DeleteTodoRequest, opts ...grpc.CallOption) (*Empty, error) {
-	out := new(Empty)
-	err := c.cc.Invoke(ctx, "/todoer.Todoer/DeleteTodo", in, out, opts...)
-	if err != nil {
+func _Todoer_DeleteComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCommentRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(TodoerServer).DeleteComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/todoer.Todoer/DeleteComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoerServer).DeleteComment(ctx, req.(*DeleteCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-// TodoerServer is the server API for Todoer service.
-// All implementations must embed UnimplementedTodoerServer
-// for forward compatibility
-type TodoerServer interface {
-	// TodoList
-	CreateTodoList(context.Context, *CreateTodoListRequest) (*CreateTodoListReply, error)
-	GetAllTodoLists(context.Context, *Empty) (*GetAllTodoListsReply, error)
-	GetTodoList(context.Context, *GetTodoListRequest) (*GetTodoListReply, error)
-	UpdateTodoList(context.Context, *UpdateTodoListRequest) (*Empty, error)
-	DeleteTodoList(context.Context, *DeleteTodoListRequest) (*Empty, error)
-	// Todo
-	CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoReply, error)
-	GetTodosByList(context.Context, *GetTodosByListRequest) (*GetTodosByListReply, error)
-	GetTodo(context.Context, *GetTodoRequest) (*GetTodoReply, error)
-	UpdateTodo(context.Context, *UpdateTodoRequest) (*Empty, error)
-	DeleteTodo(context.Context, *DeleteTodoRequest) (*Empty, error)
-	mustEmbedUnimplementedTodoerServer()
+func _Todoer_UploadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TodoerServer).UploadAttachment(&todoerUploadAttachmentServer{stream})
 }
 
-// UnimplementedTodoerServer must be embedded to have forward compatible implementations.
-type UnimplementedTodoerServer struct {
+type Todoer_UploadAttachmentServer interface {
+	SendAndClose(*UploadAttachmentReply) error
+	Recv() (*UploadAttachmentRequest, error)
+	grpc.ServerStream
 }
 
-func (UnimplementedTodoerServer) CreateTodoList(context.Context, *CreateTodoListRequest) (*CreateTodoListReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method CreateTodoList not implemented")
-}
-func (UnimplementedTodoerServer) GetAllTodoLists(context.Context, *Empty) (*GetAllTodoListsReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetAllTodoLists not implemented")
-}
-func (UnimplementedTodoerServer) GetTodoList(context.Context, *GetTodoListRequest) (*GetTodoListReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetTodoList not implemented")
-}
-func (UnimplementedTodoerServer) UpdateTodoList(context.Context, *UpdateTodoListRequest) (*Empty, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method UpdateTodoList not implemented")
-}
-func (UnimplementedTodoerServer) DeleteTodoList(context.Context, *DeleteTodoListRequest) (*Empty, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodoList not implemented")
-}
-func (UnimplementedTodoerServer) CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method CreateTodo not implemented")
-}
-func (UnimplementedTodoerServer) GetTodosByList(context.Context, *GetTodosByListRequest) (*GetTodosByListReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetTodosByList not implemented")
-}
-func (UnimplementedTodoerServer) GetTodo(context.Context, *GetTodoRequest) (*GetTodoReply, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetTodo not implemented")
+type todoerUploadAttachmentServer struct {
+	grpc.ServerStream
 }
-func (UnimplementedTodoerServer) UpdateTodo(context.Context, *UpdateTodoRequest) (*Empty, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method UpdateTodo not implemented")
-}
-func (UnimplementedTodoerServer) DeleteTodo(context.Context, *DeleteTodoRequest) (*Empty, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodo not implemented")
-}
-func (UnimplementedTodoerServer) mustEmbedUnimplementedTodoerServer() {}
 
-// UnsafeTodoerServer may be embedded to opt out of forward compatibility for this service.
-// Use of this interface is not recommended, as added methods to TodoerServer will
-// result in compilation errors.
-type UnsafeTodoerServer interface {
-	mustEmbedUnimplementedTodoerServer()
+func (x *todoerUploadAttachmentServer) SendAndClose(m *UploadAttachmentReply) error {
+	return x.ServerStream.SendMsg(m)
 }
 
-func RegisterTodoerServer(s grpc.ServiceRegistrar, srv TodoerServer) {
-	s.RegisterService(&Todoer_ServiceDesc, srv)
+func (x *todoerUploadAttachmentServer) Recv() (*UploadAttachmentRequest, error) {
+	m := new(UploadAttachmentRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func _Todoer_CreateTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateTodoListRequest)
+func _Todoer_GetAttachments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAttachmentsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).CreateTodoList(ctx, in)
+		return srv.(TodoerServer).GetAttachments(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/CreateTodoList",
+		FullMethod: "/todoer.Todoer/GetAttachments",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).CreateTodoList(ctx, req.(*CreateTodoListRequest))
+		return srv.(TodoerServer).GetAttachments(ctx, req.(*GetAttachmentsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_GetAllTodoLists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+func _Todoer_GetAttachment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAttachmentRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).GetAllTodoLists(ctx, in)
+		return srv.(TodoerServer).GetAttachment(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/GetAllTodoLists",
+		FullMethod: "/todoer.Todoer/GetAttachment",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).GetAllTodoLists(ctx, req.(*Empty))
+		return srv.(TodoerServer).GetAttachment(ctx, req.(*GetAttachmentRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_GetTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetTodoListRequest)
+func _Todoer_DownloadAttachment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadAttachmentRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoerServer).DownloadAttachment(m, &todoerDownloadAttachmentServer{stream})
+}
+
+type Todoer_DownloadAttachmentServer interface {
+	Send(*DownloadAttachmentReply) error
+	grpc.ServerStream
+}
+
+type todoerDownloadAttachmentServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoerDownloadAttachmentServer) Send(m *DownloadAttachmentReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Todoer_DeleteAttachment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAttachmentRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).GetTodoList(ctx, in)
+		return srv.(TodoerServer).DeleteAttachment(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/GetTodoList",
+		FullMethod: "/todoer.Todoer/DeleteAttachment",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).GetTodoList(ctx, req.(*GetTodoListRequest))
+		return srv.(TodoerServer).DeleteAttachment(ctx, req.(*DeleteAttachmentRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_UpdateTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(UpdateTodoListRequest)
+func _Todoer_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).UpdateTodoList(ctx, in)
+		return srv.(TodoerServer).Search(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/UpdateTodoList",
+		FullMethod: "/todoer.Todoer/Search",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).UpdateTodoList(ctx, req.(*UpdateTodoListRequest))
+		return srv.(TodoerServer).Search(ctx, req.(*SearchRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_DeleteTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(DeleteTodoListRequest)
+func _Todoer_GetTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).DeleteTodoList(ctx, in)
+		return srv.(TodoerServer).GetTrash(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/DeleteTodoList",
+		FullMethod: "/todoer.Todoer/GetTrash",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).DeleteTodoList(ctx, req.(*DeleteTodoListRequest))
+		return srv.(TodoerServer).GetTrash(ctx, req.(*Empty))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_CreateTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(CreateTodoRequest)
+func _Todoer_RestoreTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreTodoListRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).CreateTodo(ctx, in)
+		return srv.(TodoerServer).RestoreTodoList(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/CreateTodo",
+		FullMethod: "/todoer.Todoer/RestoreTodoList",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).CreateTodo(ctx, req.(*CreateTodoRequest))
+		return srv.(TodoerServer).RestoreTodoList(ctx, req.(*RestoreTodoListRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_GetTodosByList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetTodosByListRequest)
+func _Todoer_RestoreTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreTodoRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).GetTodosByList(ctx, in)
+		return srv.(TodoerServer).RestoreTodo(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/GetTodosByList",
+		FullMethod: "/todoer.Todoer/RestoreTodo",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).GetTodosByList(ctx, req.(*GetTodosByListRequest))
+		return srv.(TodoerServer).RestoreTodo(ctx, req.(*RestoreTodoRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_GetTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetTodoRequest)
+func _Todoer_PurgeTodoList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeTodoListRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).GetTodo(ctx, in)
+		return srv.(TodoerServer).PurgeTodoList(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/GetTodo",
+		FullMethod: "/todoer.Todoer/PurgeTodoList",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).GetTodo(ctx, req.(*GetTodoRequest))
+		return srv.(TodoerServer).PurgeTodoList(ctx, req.(*PurgeTodoListRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_UpdateTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(UpdateTodoRequest)
+func _Todoer_PurgeTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeTodoRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).UpdateTodo(ctx, in)
+		return srv.(TodoerServer).PurgeTodo(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/UpdateTodo",
+		FullMethod: "/todoer.Todoer/PurgeTodo",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).UpdateTodo(ctx, req.(*UpdateTodoRequest))
+		return srv.(TodoerServer).PurgeTodo(ctx, req.(*PurgeTodoRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Todoer_DeleteTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(DeleteTodoRequest)
+func _Todoer_PurgeTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeTrashRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TodoerServer).DeleteTodo(ctx, in)
+		return srv.(TodoerServer).PurgeTrash(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/todoer.Todoer/DeleteTodo",
+		FullMethod: "/todoer.Todoer/PurgeTrash",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoerServer).DeleteTodo(ctx, req.(*DeleteTodoRequest))
+		return srv.(TodoerServer).PurgeTrash(ctx, req.(*PurgeTrashRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Todoer_Backup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoerServer).Backup(m, &todoerBackupServer{stream})
+}
+
+type Todoer_BackupServer interface {
+	Send(*BackupReply) error
+	grpc.ServerStream
+}
+
+type todoerBackupServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoerBackupServer) Send(m *BackupReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Todoer_Restore_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TodoerServer).Restore(&todoerRestoreServer{stream})
+}
+
+type Todoer_RestoreServer interface {
+	SendAndClose(*Empty) error
+	Recv() (*RestoreRequest, error)
+	grpc.ServerStream
+}
+
+type todoerRestoreServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoerRestoreServer) SendAndClose(m *Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *todoerRestoreServer) Recv() (*RestoreRequest, error) {
+	m := new(RestoreRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Todoer_ServiceDesc is the grpc.ServiceDesc for Todoer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -403,6 +2047,18 @@ var Todoer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteTodoList",
 			Handler:    _Todoer_DeleteTodoList_Handler,
 		},
+		{
+			MethodName: "GetTodoListHistory",
+			Handler:    _Todoer_GetTodoListHistory_Handler,
+		},
+		{
+			MethodName: "ShareTodoList",
+			Handler:    _Todoer_ShareTodoList_Handler,
+		},
+		{
+			MethodName: "UnshareTodoList",
+			Handler:    _Todoer_UnshareTodoList_Handler,
+		},
 		{
 			MethodName: "CreateTodo",
 			Handler:    _Todoer_CreateTodo_Handler,
@@ -411,6 +2067,10 @@ var Todoer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetTodosByList",
 			Handler:    _Todoer_GetTodosByList_Handler,
 		},
+		{
+			MethodName: "QueryTodos",
+			Handler:    _Todoer_QueryTodos_Handler,
+		},
 		{
 			MethodName: "GetTodo",
 			Handler:    _Todoer_GetTodo_Handler,
@@ -419,11 +2079,188 @@ var Todoer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateTodo",
 			Handler:    _Todoer_UpdateTodo_Handler,
 		},
+		{
+			MethodName: "MoveTodo",
+			Handler:    _Todoer_MoveTodo_Handler,
+		},
 		{
 			MethodName: "DeleteTodo",
 			Handler:    _Todoer_DeleteTodo_Handler,
 		},
+		{
+			MethodName: "GetTodoHistory",
+			Handler:    _Todoer_GetTodoHistory_Handler,
+		},
+		{
+			MethodName: "AddDependency",
+			Handler:    _Todoer_AddDependency_Handler,
+		},
+		{
+			MethodName: "RemoveDependency",
+			Handler:    _Todoer_RemoveDependency_Handler,
+		},
+		{
+			MethodName: "GetBlockers",
+			Handler:    _Todoer_GetBlockers_Handler,
+		},
+		{
+			MethodName: "ExportTodoTxt",
+			Handler:    _Todoer_ExportTodoTxt_Handler,
+		},
+		{
+			MethodName: "ImportTodoTxt",
+			Handler:    _Todoer_ImportTodoTxt_Handler,
+		},
+		{
+			MethodName: "ExportCalendar",
+			Handler:    _Todoer_ExportCalendar_Handler,
+		},
+		{
+			MethodName: "ImportCalendar",
+			Handler:    _Todoer_ImportCalendar_Handler,
+		},
+		{
+			MethodName: "CreateCalendarToken",
+			Handler:    _Todoer_CreateCalendarToken_Handler,
+		},
+		{
+			MethodName: "DeleteCalendarToken",
+			Handler:    _Todoer_DeleteCalendarToken_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _Todoer_CreateUser_Handler,
+		},
+		{
+			MethodName: "GetAllUsers",
+			Handler:    _Todoer_GetAllUsers_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Todoer_GetUser_Handler,
+		},
+		{
+			MethodName: "CreateToken",
+			Handler:    _Todoer_CreateToken_Handler,
+		},
+		{
+			MethodName: "GetTokens",
+			Handler:    _Todoer_GetTokens_Handler,
+		},
+		{
+			MethodName: "GetToken",
+			Handler:    _Todoer_GetToken_Handler,
+		},
+		{
+			MethodName: "DeleteToken",
+			Handler:    _Todoer_DeleteToken_Handler,
+		},
+		{
+			MethodName: "CreateLabel",
+			Handler:    _Todoer_CreateLabel_Handler,
+		},
+		{
+			MethodName: "GetAllLabels",
+			Handler:    _Todoer_GetAllLabels_Handler,
+		},
+		{
+			MethodName: "GetLabel",
+			Handler:    _Todoer_GetLabel_Handler,
+		},
+		{
+			MethodName: "UpdateLabel",
+			Handler:    _Todoer_UpdateLabel_Handler,
+		},
+		{
+			MethodName: "RenameLabel",
+			Handler:    _Todoer_RenameLabel_Handler,
+		},
+		{
+			MethodName: "DeleteLabel",
+			Handler:    _Todoer_DeleteLabel_Handler,
+		},
+		{
+			MethodName: "CreateComment",
+			Handler:    _Todoer_CreateComment_Handler,
+		},
+		{
+			MethodName: "GetComments",
+			Handler:    _Todoer_GetComments_Handler,
+		},
+		{
+			MethodName: "GetComment",
+			Handler:    _Todoer_GetComment_Handler,
+		},
+		{
+			MethodName: "UpdateComment",
+			Handler:    _Todoer_UpdateComment_Handler,
+		},
+		{
+			MethodName: "DeleteComment",
+			Handler:    _Todoer_DeleteComment_Handler,
+		},
+		{
+			MethodName: "GetAttachments",
+			Handler:    _Todoer_GetAttachments_Handler,
+		},
+		{
+			MethodName: "GetAttachment",
+			Handler:    _Todoer_GetAttachment_Handler,
+		},
+		{
+			MethodName: "DeleteAttachment",
+			Handler:    _Todoer_DeleteAttachment_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Todoer_Search_Handler,
+		},
+		{
+			MethodName: "GetTrash",
+			Handler:    _Todoer_GetTrash_Handler,
+		},
+		{
+			MethodName: "RestoreTodoList",
+			Handler:    _Todoer_RestoreTodoList_Handler,
+		},
+		{
+			MethodName: "RestoreTodo",
+			Handler:    _Todoer_RestoreTodo_Handler,
+		},
+		{
+			MethodName: "PurgeTodoList",
+			Handler:    _Todoer_PurgeTodoList_Handler,
+		},
+		{
+			MethodName: "PurgeTodo",
+			Handler:    _Todoer_PurgeTodo_Handler,
+		},
+		{
+			MethodName: "PurgeTrash",
+			Handler:    _Todoer_PurgeTrash_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadAttachment",
+			Handler:       _Todoer_UploadAttachment_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadAttachment",
+			Handler:       _Todoer_DownloadAttachment_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Backup",
+			Handler:       _Todoer_Backup_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Restore",
+			Handler:       _Todoer_Restore_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
-	Metadata: "pb/todoer.proto",
+	Metadata: "todoer.proto",
 }
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hashPattern is a hex encoded SHA-256, as given by BlobStore.Put.
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func (ls *LocalStorage) InsertAttachment(ctx context.Context, attachment Attachment) (*Attachment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoTable[attachment.TodoID]; !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	if !validAttachmentName(attachment.Name) || !hashPattern.MatchString(attachment.Hash) || attachment.Size < 0 {
+		return nil, ErrInvalidAttachment
+	}
+
+	attachment.ID = ls.AttachmentAutoincrement
+	attachment.CreatedAt = now(ctx)
+	ls.Attachments[attachment.ID] = attachment
+	ls.TodoAttachments[attachment.TodoID] = append(ls.TodoAttachments[attachment.TodoID], attachment.ID)
+	ls.AttachmentAutoincrement++
+	return &attachment, nil
+}
+
+func (ls *LocalStorage) GetAttachments(ctx context.Context, todoID uint32) ([]Attachment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if _, ok := ls.TodoTable[todoID]; !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	attachments := []Attachment{}
+	for _, id := range ls.TodoAttachments[todoID] {
+		attachments = append(attachments, ls.Attachments[id])
+	}
+	return attachments, nil
+}
+
+func (ls *LocalStorage) GetAttachment(ctx context.Context, id uint32) (*Attachment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	attachment, ok := ls.activeAttachment(id)
+	if !ok {
+		return nil, ErrAttachmentNotFound
+	}
+	return &attachment, nil
+}
+
+func (ls *LocalStorage) DeleteAttachment(ctx context.Context, id uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	attachment, ok := ls.activeAttachment(id)
+	if !ok {
+		return ErrAttachmentNotFound
+	}
+
+	remaining := []uint32{}
+	for _, attachmentID := range ls.TodoAttachments[attachment.TodoID] {
+		if attachmentID != id {
+			remaining = append(remaining, attachmentID)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(ls.TodoAttachments, attachment.TodoID)
+	} else {
+		ls.TodoAttachments[attachment.TodoID] = remaining
+	}
+	delete(ls.Attachments, id)
+	return nil
+}
+
+func (ls *LocalStorage) GetAttachmentHashes(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	seen := map[string]bool{}
+	hashes := []string{}
+	for _, attachment := range ls.Attachments {
+		if !seen[attachment.Hash] {
+			seen[attachment.Hash] = true
+			hashes = append(hashes, attachment.Hash)
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// activeAttachment returns an attachment unless its todo is on the trash.
+// Must be called with ls.mu held.
+func (ls *LocalStorage) activeAttachment(id uint32) (Attachment, bool) {
+	attachment, ok := ls.Attachments[id]
+	if !ok {
+		return Attachment{}, false
+	}
+	if _, ok := ls.TodoTable[attachment.TodoID]; !ok {
+		return Attachment{}, false
+	}
+	return attachment, true
+}
+
+// forgetAttachments removes every attachment of a purged todo. Must be
+// called with ls.mu held.
+func (ls *LocalStorage) forgetAttachments(todoID uint32) {
+	for _, id := range ls.TodoAttachments[todoID] {
+		delete(ls.Attachments, id)
+	}
+	delete(ls.TodoAttachments, todoID)
+}
+
+func validAttachmentName(name string) bool {
+	return strings.TrimSpace(name) != "" && !strings.ContainsAny(name, `/\`)
+}
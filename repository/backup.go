@@ -0,0 +1,678 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BackupVersion is the version of the backups written, the only one that
+// can be restored.
+const BackupVersion = 1
+
+// RestoreMode decides what happens to the data a repository already has
+// when a backup is restored.
+type RestoreMode int
+
+const (
+	// RestoreMerge keeps the data, replacing the items with the same ID,
+	// or name for labels and users, as one on the backup.
+	RestoreMerge RestoreMode = iota
+	// RestoreReplace drops all the data before restoring.
+	RestoreReplace
+)
+
+// Backup is a copy of everything a repository keeps, with the IDs and
+// autoincrement counters it had.
+type Backup struct {
+	Version        int            `json:"version"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Autoincrements Autoincrements `json:"autoincrements"`
+	// TodoLists are ordered by ID, and Todos by todo list and then by
+	// their position on it, which is the order they are restored in.
+	TodoLists []TodoList `json:"todo_lists"`
+	Todos     []Todo     `json:"todos"`
+	// Dependencies are ordered by blocked todo and then by blocker.
+	Dependencies []Dependency `json:"dependencies"`
+	// Trash holds the deleted todo lists and todos, ordered by ID.
+	Trash           Trash                     `json:"trash"`
+	TodoListHistory map[uint32][]HistoryEntry `json:"todo_list_history"`
+	TodoHistory     map[uint32][]HistoryEntry `json:"todo_history"`
+	// Labels and Users are ordered by name, and the rest by ID.
+	Labels      []Label      `json:"labels"`
+	Comments    []Comment    `json:"comments"`
+	Attachments []Attachment `json:"attachments"`
+	Users       []User       `json:"users"`
+	Tokens      []Token      `json:"tokens"`
+}
+
+// Autoincrements are the IDs the next items inserted get.
+type Autoincrements struct {
+	TodoList   uint32
+	Todo       uint32
+	Comment    uint32
+	Attachment uint32
+	Token      uint32
+}
+
+// Dependency is a todo blocked by another one.
+type Dependency struct {
+	TodoID    uint32
+	BlockerID uint32
+}
+
+// WriteBackup writes backup as JSON to w, one item at a time, so it can be
+// sent while it is written.
+func WriteBackup(w io.Writer, backup *Backup) error {
+	bw := &backupWriter{w: w}
+
+	bw.open()
+	bw.field("version", backup.Version)
+	bw.field("created_at", backup.CreatedAt)
+	bw.field("autoincrements", backup.Autoincrements)
+	bw.array("todo_lists", len(backup.TodoLists), func(i int) interface{} { return backup.TodoLists[i] })
+	bw.array("todos", len(backup.Todos), func(i int) interface{} { return backup.Todos[i] })
+	bw.array("dependencies", len(backup.Dependencies), func(i int) interface{} { return backup.Dependencies[i] })
+	bw.key("trash")
+	bw.open()
+	bw.array("TodoLists", len(backup.Trash.TodoLists), func(i int) interface{} { return backup.Trash.TodoLists[i] })
+	bw.array("Todos", len(backup.Trash.Todos), func(i int) interface{} { return backup.Trash.Todos[i] })
+	bw.close()
+	bw.history("todo_list_history", backup.TodoListHistory)
+	bw.history("todo_history", backup.TodoHistory)
+	bw.array("labels", len(backup.Labels), func(i int) interface{} { return backup.Labels[i] })
+	bw.array("comments", len(backup.Comments), func(i int) interface{} { return backup.Comments[i] })
+	bw.array("attachments", len(backup.Attachments), func(i int) interface{} { return backup.Attachments[i] })
+	bw.array("users", len(backup.Users), func(i int) interface{} { return backup.Users[i] })
+	bw.array("tokens", len(backup.Tokens), func(i int) interface{} { return backup.Tokens[i] })
+	bw.close()
+	bw.write("\n")
+
+	return bw.err
+}
+
+// ReadBackup reads a backup written by WriteBackup. Failing to read r is
+// not an invalid backup, only what is read can be.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	backup := &Backup{}
+	er := &errReader{r: r}
+	if err := json.NewDecoder(er).Decode(backup); err != nil {
+		if er.err != nil {
+			return nil, er.err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if backup.Version != BackupVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, backup.Version)
+	}
+	return backup, nil
+}
+
+// errReader keeps the first error reading r, other than the end of it.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err != nil && err != io.EOF && er.err == nil {
+		er.err = err
+	}
+	return n, err
+}
+
+// backupWriter writes the fields of JSON objects, keeping the first error.
+type backupWriter struct {
+	w   io.Writer
+	err error
+	// first is whether the next field is the first of its object.
+	first bool
+}
+
+func (bw *backupWriter) write(s string) {
+	if bw.err == nil {
+		_, bw.err = io.WriteString(bw.w, s)
+	}
+}
+
+func (bw *backupWriter) value(v interface{}) {
+	if bw.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		bw.err = err
+		return
+	}
+	_, bw.err = bw.w.Write(data)
+}
+
+func (bw *backupWriter) open() {
+	bw.write("{")
+	bw.first = true
+}
+
+func (bw *backupWriter) close() {
+	bw.write("}")
+	bw.first = false
+}
+
+// key starts a field of the object, after the fields before it.
+func (bw *backupWriter) key(name string) {
+	if !bw.first {
+		bw.write(",")
+	}
+	bw.first = false
+	bw.value(name)
+	bw.write(":")
+}
+
+func (bw *backupWriter) field(name string, v interface{}) {
+	bw.key(name)
+	bw.value(v)
+}
+
+func (bw *backupWriter) array(name string, n int, item func(i int) interface{}) {
+	bw.key(name)
+	bw.write("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			bw.write(",")
+		}
+		bw.value(item(i))
+	}
+	bw.write("]")
+}
+
+func (bw *backupWriter) history(name string, history map[uint32][]HistoryEntry) {
+	ids := make([]uint32, 0, len(history))
+	for id := range history {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	bw.key(name)
+	bw.write("{")
+	for i, id := range ids {
+		if i > 0 {
+			bw.write(",")
+		}
+		bw.value(strconv.FormatUint(uint64(id), 10))
+		bw.write(":")
+		bw.value(history[id])
+	}
+	bw.write("}")
+}
+
+func (ls *LocalStorage) Backup(ctx context.Context) (*Backup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	backup := ls.backup()
+	backup.CreatedAt = now(ctx)
+	return backup, nil
+}
+
+// backup copies every table. Must be called with ls.mu held.
+func (ls *LocalStorage) backup() *Backup {
+	backup := &Backup{
+		Version: BackupVersion,
+		Autoincrements: Autoincrements{
+			TodoList:   ls.TodoListAutoincrement,
+			Todo:       ls.TodoAutoincrement,
+			Comment:    ls.CommentAutoincrement,
+			Attachment: ls.AttachmentAutoincrement,
+			Token:      ls.TokenAutoincrement,
+		},
+		TodoLists:       []TodoList{},
+		Todos:           []Todo{},
+		Dependencies:    []Dependency{},
+		Trash:           Trash{TodoLists: []TrashedTodoList{}, Todos: []TrashedTodo{}},
+		TodoListHistory: map[uint32][]HistoryEntry{},
+		TodoHistory:     map[uint32][]HistoryEntry{},
+		Labels:          []Label{},
+		Comments:        []Comment{},
+		Attachments:     []Attachment{},
+		Users:           []User{},
+		Tokens:          []Token{},
+	}
+
+	for _, todoList := range ls.TodoListTable {
+		backup.TodoLists = append(backup.TodoLists, cloneTodoList(todoList))
+	}
+	sort.Slice(backup.TodoLists, func(i, j int) bool { return backup.TodoLists[i].ID < backup.TodoLists[j].ID })
+	for _, todoList := range backup.TodoLists {
+		for _, id := range ls.TodoListRelationship[todoList.ID] {
+			backup.Todos = append(backup.Todos, cloneTodo(ls.TodoTable[id]))
+		}
+	}
+
+	for id, blockerIDs := range ls.TodoDependencies {
+		for _, blockerID := range blockerIDs {
+			backup.Dependencies = append(backup.Dependencies, Dependency{TodoID: id, BlockerID: blockerID})
+		}
+	}
+	sort.Slice(backup.Dependencies, func(i, j int) bool {
+		a, b := backup.Dependencies[i], backup.Dependencies[j]
+		if a.TodoID != b.TodoID {
+			return a.TodoID < b.TodoID
+		}
+		return a.BlockerID < b.BlockerID
+	})
+
+	for _, trashed := range ls.TodoListTrash {
+		trashed.TodoList = cloneTodoList(trashed.TodoList)
+		trashed.TodoIDs = append([]uint32(nil), trashed.TodoIDs...)
+		backup.Trash.TodoLists = append(backup.Trash.TodoLists, trashed)
+	}
+	sort.Slice(backup.Trash.TodoLists, func(i, j int) bool {
+		return backup.Trash.TodoLists[i].TodoList.ID < backup.Trash.TodoLists[j].TodoList.ID
+	})
+	for _, trashed := range ls.TodoTrash {
+		trashed.Todo = cloneTodo(trashed.Todo)
+		trashed.SubtaskIDs = append([]uint32(nil), trashed.SubtaskIDs...)
+		backup.Trash.Todos = append(backup.Trash.Todos, trashed)
+	}
+	sort.Slice(backup.Trash.Todos, func(i, j int) bool { return backup.Trash.Todos[i].Todo.ID < backup.Trash.Todos[j].Todo.ID })
+
+	for id, history := range ls.TodoListHistory {
+		backup.TodoListHistory[id] = cloneHistory(history)
+	}
+	for id, history := range ls.TodoHistory {
+		backup.TodoHistory[id] = cloneHistory(history)
+	}
+
+	for _, label := range ls.Labels {
+		backup.Labels = append(backup.Labels, label)
+	}
+	sort.Slice(backup.Labels, func(i, j int) bool { return backup.Labels[i].Name < backup.Labels[j].Name })
+	for _, comment := range ls.Comments {
+		backup.Comments = append(backup.Comments, cloneComment(comment))
+	}
+	sort.Slice(backup.Comments, func(i, j int) bool { return backup.Comments[i].ID < backup.Comments[j].ID })
+	for _, attachment := range ls.Attachments {
+		backup.Attachments = append(backup.Attachments, attachment)
+	}
+	sort.Slice(backup.Attachments, func(i, j int) bool { return backup.Attachments[i].ID < backup.Attachments[j].ID })
+	for _, user := range ls.Users {
+		backup.Users = append(backup.Users, user)
+	}
+	sort.Slice(backup.Users, func(i, j int) bool { return backup.Users[i].Name < backup.Users[j].Name })
+	for _, token := range ls.Tokens {
+		backup.Tokens = append(backup.Tokens, *cloneToken(token))
+	}
+	sort.Slice(backup.Tokens, func(i, j int) bool { return backup.Tokens[i].ID < backup.Tokens[j].ID })
+
+	return backup
+}
+
+func (ls *LocalStorage) Restore(ctx context.Context, backup Backup, mode RestoreMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if backup.Version != BackupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, backup.Version)
+	}
+	if mode != RestoreMerge && mode != RestoreReplace {
+		return fmt.Errorf("%w: unknown restore mode %d", ErrInvalidBackup, mode)
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if mode == RestoreMerge {
+		backup = mergeBackups(*ls.backup(), backup)
+	}
+	restored, err := loadBackup(backup)
+	if err != nil {
+		return err
+	}
+
+	ls.TodoListAutoincrement = restored.TodoListAutoincrement
+	ls.TodoAutoincrement = restored.TodoAutoincrement
+	ls.TodoListTable = restored.TodoListTable
+	ls.TodoTable = restored.TodoTable
+	ls.TodoListRelationship = restored.TodoListRelationship
+	ls.TodoListTrash = restored.TodoListTrash
+	ls.TodoTrash = restored.TodoTrash
+	ls.TodoListHistory = restored.TodoListHistory
+	ls.TodoHistory = restored.TodoHistory
+	ls.TodoDependencies = restored.TodoDependencies
+	ls.Labels = restored.Labels
+	ls.CommentAutoincrement = restored.CommentAutoincrement
+	ls.Comments = restored.Comments
+	ls.TodoComments = restored.TodoComments
+	ls.AttachmentAutoincrement = restored.AttachmentAutoincrement
+	ls.Attachments = restored.Attachments
+	ls.TodoAttachments = restored.TodoAttachments
+	ls.Users = restored.Users
+	ls.TokenAutoincrement = restored.TokenAutoincrement
+	ls.Tokens = restored.Tokens
+	ls.index = restored.index
+	return nil
+}
+
+// mergeBackups returns current with the items of incoming, which replace
+// the ones with the same ID or name. Todos on incoming go first on their
+// todo list, followed by the ones only current has there.
+func mergeBackups(current, incoming Backup) Backup {
+	merged := incoming
+	merged.Autoincrements = Autoincrements{
+		TodoList:   maxID(current.Autoincrements.TodoList, incoming.Autoincrements.TodoList),
+		Todo:       maxID(current.Autoincrements.Todo, incoming.Autoincrements.Todo),
+		Comment:    maxID(current.Autoincrements.Comment, incoming.Autoincrements.Comment),
+		Attachment: maxID(current.Autoincrements.Attachment, incoming.Autoincrements.Attachment),
+		Token:      maxID(current.Autoincrements.Token, incoming.Autoincrements.Token),
+	}
+
+	// Items on incoming replace the ones of current whether they are active
+	// or on the trash, so the same ID is never on both.
+	todoLists := map[uint32]bool{}
+	for _, todoList := range incoming.TodoLists {
+		todoLists[todoList.ID] = true
+	}
+	for _, trashed := range incoming.Trash.TodoLists {
+		todoLists[trashed.TodoList.ID] = true
+	}
+	todos := map[uint32]bool{}
+	for _, todo := range incoming.Todos {
+		todos[todo.ID] = true
+	}
+	for _, trashed := range incoming.Trash.Todos {
+		todos[trashed.Todo.ID] = true
+	}
+
+	// Todos of current on a todo list that is on the trash of incoming are
+	// dropped with their dependencies, comments and attachments, as the
+	// trashed todo list says which todos went with it.
+	trashedTodoLists := map[uint32]bool{}
+	for _, trashed := range incoming.Trash.TodoLists {
+		trashedTodoLists[trashed.TodoList.ID] = true
+	}
+	dropped := map[uint32]bool{}
+	for _, todo := range current.Todos {
+		if !todos[todo.ID] && trashedTodoLists[todo.ListID] {
+			dropped[todo.ID] = true
+		}
+	}
+
+	merged.TodoLists = append([]TodoList(nil), incoming.TodoLists...)
+	for _, todoList := range current.TodoLists {
+		if !todoLists[todoList.ID] {
+			merged.TodoLists = append(merged.TodoLists, todoList)
+		}
+	}
+	sort.Slice(merged.TodoLists, func(i, j int) bool { return merged.TodoLists[i].ID < merged.TodoLists[j].ID })
+
+	merged.Todos = append([]Todo(nil), incoming.Todos...)
+	for _, todo := range current.Todos {
+		if !todos[todo.ID] && !dropped[todo.ID] {
+			merged.Todos = append(merged.Todos, todo)
+		}
+	}
+	sort.SliceStable(merged.Todos, func(i, j int) bool { return merged.Todos[i].ListID < merged.Todos[j].ListID })
+
+	merged.Dependencies = append([]Dependency(nil), incoming.Dependencies...)
+	for _, dependency := range current.Dependencies {
+		if !todos[dependency.TodoID] && !dropped[dependency.TodoID] && !dropped[dependency.BlockerID] {
+			merged.Dependencies = append(merged.Dependencies, dependency)
+		}
+	}
+
+	merged.Trash = Trash{
+		TodoLists: append([]TrashedTodoList(nil), incoming.Trash.TodoLists...),
+		Todos:     append([]TrashedTodo(nil), incoming.Trash.Todos...),
+	}
+	for _, trashed := range current.Trash.TodoLists {
+		if !todoLists[trashed.TodoList.ID] {
+			merged.Trash.TodoLists = append(merged.Trash.TodoLists, trashed)
+		}
+	}
+	for _, trashed := range current.Trash.Todos {
+		if !todos[trashed.Todo.ID] {
+			merged.Trash.Todos = append(merged.Trash.Todos, trashed)
+		}
+	}
+
+	merged.TodoListHistory = mergeHistory(current.TodoListHistory, incoming.TodoListHistory)
+	merged.TodoHistory = mergeHistory(current.TodoHistory, incoming.TodoHistory)
+	for id := range dropped {
+		delete(merged.TodoHistory, id)
+	}
+
+	labels := map[string]bool{}
+	for _, label := range incoming.Labels {
+		labels[label.Name] = true
+	}
+	merged.Labels = append([]Label(nil), incoming.Labels...)
+	for _, label := range current.Labels {
+		if !labels[label.Name] {
+			merged.Labels = append(merged.Labels, label)
+		}
+	}
+
+	users := map[string]bool{}
+	for _, user := range incoming.Users {
+		users[user.Name] = true
+	}
+	merged.Users = append([]User(nil), incoming.Users...)
+	for _, user := range current.Users {
+		if !users[user.Name] {
+			merged.Users = append(merged.Users, user)
+		}
+	}
+
+	comments := map[uint32]bool{}
+	for _, comment := range incoming.Comments {
+		comments[comment.ID] = true
+	}
+	merged.Comments = append([]Comment(nil), incoming.Comments...)
+	for _, comment := range current.Comments {
+		if !comments[comment.ID] && !dropped[comment.TodoID] {
+			merged.Comments = append(merged.Comments, comment)
+		}
+	}
+
+	attachments := map[uint32]bool{}
+	for _, attachment := range incoming.Attachments {
+		attachments[attachment.ID] = true
+	}
+	merged.Attachments = append([]Attachment(nil), incoming.Attachments...)
+	for _, attachment := range current.Attachments {
+		if !attachments[attachment.ID] && !dropped[attachment.TodoID] {
+			merged.Attachments = append(merged.Attachments, attachment)
+		}
+	}
+
+	tokens := map[uint32]bool{}
+	for _, token := range incoming.Tokens {
+		tokens[token.ID] = true
+	}
+	merged.Tokens = append([]Token(nil), incoming.Tokens...)
+	for _, token := range current.Tokens {
+		if !tokens[token.ID] {
+			merged.Tokens = append(merged.Tokens, token)
+		}
+	}
+
+	return merged
+}
+
+func mergeHistory(current, incoming map[uint32][]HistoryEntry) map[uint32][]HistoryEntry {
+	merged := map[uint32][]HistoryEntry{}
+	for id, history := range current {
+		merged[id] = history
+	}
+	for id, history := range incoming {
+		merged[id] = history
+	}
+	return merged
+}
+
+// loadBackup returns a LocalStorage holding what is on backup, once it is
+// checked to be consistent. Autoincrement counters are raised past the
+// biggest ID when needed.
+func loadBackup(backup Backup) (*LocalStorage, error) {
+	ls := NewLocalStorage()
+	ls.TodoListAutoincrement = backup.Autoincrements.TodoList
+	ls.TodoAutoincrement = backup.Autoincrements.Todo
+	ls.CommentAutoincrement = backup.Autoincrements.Comment
+	ls.AttachmentAutoincrement = backup.Autoincrements.Attachment
+	ls.TokenAutoincrement = backup.Autoincrements.Token
+
+	for _, todoList := range backup.TodoLists {
+		if _, ok := ls.TodoListTable[todoList.ID]; ok {
+			return nil, fmt.Errorf("%w: todo list %d is repeated", ErrInvalidBackup, todoList.ID)
+		}
+		ls.TodoListTable[todoList.ID] = cloneTodoList(todoList)
+		ls.TodoListAutoincrement = maxID(ls.TodoListAutoincrement, todoList.ID+1)
+	}
+	for _, trashed := range backup.Trash.TodoLists {
+		id := trashed.TodoList.ID
+		if _, ok := ls.TodoListTable[id]; ok {
+			return nil, fmt.Errorf("%w: todo list %d is repeated", ErrInvalidBackup, id)
+		}
+		trashed.TodoList = cloneTodoList(trashed.TodoList)
+		trashed.TodoIDs = append([]uint32(nil), trashed.TodoIDs...)
+		ls.TodoListTrash[id] = trashed
+		ls.TodoListAutoincrement = maxID(ls.TodoListAutoincrement, id+1)
+	}
+
+	for _, todo := range backup.Todos {
+		if _, ok := ls.TodoTable[todo.ID]; ok {
+			return nil, fmt.Errorf("%w: todo %d is repeated", ErrInvalidBackup, todo.ID)
+		}
+		if _, ok := ls.TodoListTable[todo.ListID]; !ok {
+			return nil, fmt.Errorf("%w: todo %d is on todo list %d, which is not active", ErrInvalidBackup, todo.ID, todo.ListID)
+		}
+		ls.TodoTable[todo.ID] = cloneTodo(todo)
+		ls.TodoListRelationship[todo.ListID] = append(ls.TodoListRelationship[todo.ListID], todo.ID)
+		ls.TodoAutoincrement = maxID(ls.TodoAutoincrement, todo.ID+1)
+	}
+	for listID, todoIDs := range ls.TodoListRelationship {
+		ls.setTodoIDs(listID, todoIDs)
+	}
+	for _, trashed := range backup.Trash.Todos {
+		id := trashed.Todo.ID
+		if _, ok := ls.TodoTable[id]; ok {
+			return nil, fmt.Errorf("%w: todo %d is repeated", ErrInvalidBackup, id)
+		}
+		if _, ok := ls.TodoTrash[id]; ok {
+			return nil, fmt.Errorf("%w: todo %d is repeated", ErrInvalidBackup, id)
+		}
+		trashed.Todo = cloneTodo(trashed.Todo)
+		trashed.SubtaskIDs = append([]uint32(nil), trashed.SubtaskIDs...)
+		ls.TodoTrash[id] = trashed
+		ls.TodoAutoincrement = maxID(ls.TodoAutoincrement, id+1)
+	}
+
+	knownTodo := func(id uint32) bool {
+		if _, ok := ls.TodoTable[id]; ok {
+			return true
+		}
+		_, ok := ls.TodoTrash[id]
+		return ok
+	}
+
+	for _, dependency := range backup.Dependencies {
+		if !knownTodo(dependency.TodoID) || !knownTodo(dependency.BlockerID) {
+			return nil, fmt.Errorf("%w: dependency of todo %d on %d has unknown todos", ErrInvalidBackup, dependency.TodoID, dependency.BlockerID)
+		}
+		blockerIDs := ls.TodoDependencies[dependency.TodoID]
+		if indexOfID(blockerIDs, dependency.BlockerID) < 0 {
+			blockerIDs = append(blockerIDs, dependency.BlockerID)
+			sortIDs(blockerIDs)
+			ls.TodoDependencies[dependency.TodoID] = blockerIDs
+		}
+	}
+
+	for id, history := range backup.TodoListHistory {
+		ls.TodoListHistory[id] = cloneHistory(history)
+	}
+	for id, history := range backup.TodoHistory {
+		ls.TodoHistory[id] = cloneHistory(history)
+	}
+
+	for _, label := range backup.Labels {
+		label.TodoCount = 0
+		ls.Labels[label.Name] = label
+	}
+	for _, user := range backup.Users {
+		ls.Users[user.Name] = user
+	}
+
+	for _, comment := range backup.Comments {
+		if !knownTodo(comment.TodoID) {
+			return nil, fmt.Errorf("%w: comment %d is on unknown todo %d", ErrInvalidBackup, comment.ID, comment.TodoID)
+		}
+		ls.Comments[comment.ID] = cloneComment(comment)
+		ls.CommentAutoincrement = maxID(ls.CommentAutoincrement, comment.ID+1)
+	}
+	for _, id := range sortedCommentIDs(ls.Comments) {
+		todoID := ls.Comments[id].TodoID
+		ls.TodoComments[todoID] = append(ls.TodoComments[todoID], id)
+	}
+
+	for _, attachment := range backup.Attachments {
+		if !knownTodo(attachment.TodoID) {
+			return nil, fmt.Errorf("%w: attachment %d is on unknown todo %d", ErrInvalidBackup, attachment.ID, attachment.TodoID)
+		}
+		ls.Attachments[attachment.ID] = attachment
+		ls.AttachmentAutoincrement = maxID(ls.AttachmentAutoincrement, attachment.ID+1)
+	}
+	for _, id := range sortedAttachmentIDs(ls.Attachments) {
+		todoID := ls.Attachments[id].TodoID
+		ls.TodoAttachments[todoID] = append(ls.TodoAttachments[todoID], id)
+	}
+
+	for _, token := range backup.Tokens {
+		if _, ok := ls.Users[token.User]; !ok {
+			return nil, fmt.Errorf("%w: token %d is of unknown user %q", ErrInvalidBackup, token.ID, token.User)
+		}
+		ls.Tokens[token.ID] = *cloneToken(token)
+		ls.TokenAutoincrement = maxID(ls.TokenAutoincrement, token.ID+1)
+	}
+
+	ls.rebuildIndex()
+	return ls, nil
+}
+
+func maxID(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// sortedCommentIDs returns the IDs of comments, sorted.
+func sortedCommentIDs(comments map[uint32]Comment) []uint32 {
+	ids := make([]uint32, 0, len(comments))
+	for id := range comments {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids
+}
+
+// sortedAttachmentIDs returns the IDs of attachments, sorted.
+func sortedAttachmentIDs(attachments map[uint32]Attachment) []uint32 {
+	ids := make([]uint32, 0, len(attachments))
+	for id := range attachments {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids
+}
+
+func sortIDs(ids []uint32) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteBackup(t *testing.T) {
+	ls := NewLocalStorage()
+	routine, err := ls.InsertTodoList(ctx, TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bed, err := ls.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.InsertComment(ctx, Comment{TodoID: bed.ID, Body: "Every morning"}); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ls.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteBackup(buf, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// It is the same JSON as the backup marshaled at once
+	var streamed, marshaled interface{}
+	if err := json.Unmarshal(buf.Bytes(), &streamed); err != nil {
+		t.Fatalf("written backup is not valid JSON: %v\n%s", err, buf)
+	}
+	data, err := json.Marshal(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &marshaled); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(marshaled, streamed); diff != "" {
+		t.Errorf("written backup mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := ReadBackup(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(backup, got); diff != "" {
+		t.Errorf("ReadBackup() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadBackupInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"version": 2}`,
+		`{"version": 1, "todo_lists": {}}`,
+		`not json`,
+	} {
+		if _, err := ReadBackup(strings.NewReader(data)); !errors.Is(err, ErrInvalidBackup) {
+			t.Errorf("ReadBackup(%q) got error %v; want %v", data, err, ErrInvalidBackup)
+		}
+	}
+}
+
+func TestReadBackupFailing(t *testing.T) {
+	broken := errors.New("broken")
+	_, err := ReadBackup(io.MultiReader(strings.NewReader(`{"version": 1,`), failingReader{broken}))
+	if !errors.Is(err, broken) || errors.Is(err, ErrInvalidBackup) {
+		t.Errorf("got error %v; want %v", err, broken)
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (fr failingReader) Read(p []byte) (int, error) {
+	return 0, fr.err
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxBlobSize is the biggest content a BlobStore takes, when no
+	// other value is given.
+	DefaultMaxBlobSize = 10 << 20
+
+	// http.DetectContentType never reads further than this
+	sniffSize    = 512
+	uploadPrefix = "upload-"
+)
+
+var (
+	ErrBlobNotFound = errors.New("attachment content not found")
+	ErrBlobTooLarge = errors.New("attachment content is too large")
+)
+
+// BlobStore keeps the content of attachments as files on local disk. Each
+// file is named by the SHA-256 of its content, so the same content is kept
+// only once no matter how many attachments have it.
+type BlobStore struct {
+	dir     string
+	maxSize int64
+}
+
+// Blob describes content written to a BlobStore.
+type Blob struct {
+	Hash string
+	Size int64
+	// ContentType is sniffed from the start of the content, as done by
+	// http.DetectContentType.
+	ContentType string
+
+	// modTime is when the content was stored by the Put returning it, and
+	// zero when it was stored already.
+	modTime time.Time
+}
+
+// NewBlobStore opens a BlobStore on dir, creating it when missing. Content
+// bigger than maxSize bytes is refused, and zero means DefaultMaxBlobSize.
+func NewBlobStore(dir string, maxSize int64) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating attachments directory: %w", err)
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBlobSize
+	}
+	return &BlobStore{dir: dir, maxSize: maxSize}, nil
+}
+
+// MaxSize is the biggest content the BlobStore takes, in bytes.
+func (bs *BlobStore) MaxSize() int64 {
+	return bs.maxSize
+}
+
+// Put reads r to the end and stores its content. It fails with
+// ErrBlobTooLarge as soon as more than MaxSize bytes are read.
+func (bs *BlobStore) Put(r io.Reader) (*Blob, error) {
+	tmp, err := ioutil.TempFile(bs.dir, uploadPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("creating attachment file: %w", err)
+	}
+	// Once renamed in place the remove fails, which is fine
+	defer os.Remove(tmp.Name())
+
+	blob, err := bs.write(tmp, r)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("writing attachment file: %w", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	path := bs.path(blob.Hash)
+	if _, err := os.Stat(path); err == nil {
+		// Already stored. Touching it keeps Sweep away until an attachment
+		// has it again.
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			return nil, fmt.Errorf("touching attachment file: %w", err)
+		}
+		return blob, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating attachments directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("renaming attachment file: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("syncing attachments directory: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading attachment file: %w", err)
+	}
+	blob.modTime = info.ModTime()
+	return blob, nil
+}
+
+// Discard removes the content of blob, just put but not wanted after all.
+// Content that was stored already, or was put again since, is left alone,
+// as other attachments may have it, for Sweep to remove if they don't.
+func (bs *BlobStore) Discard(blob *Blob) error {
+	if blob.modTime.IsZero() {
+		return nil
+	}
+	path := bs.path(blob.Hash)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading attachment file: %w", err)
+	}
+	if info.ModTime().After(blob.modTime) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing attachment file: %w", err)
+	}
+	return nil
+}
+
+// Open returns the content stored under hash, which the caller must close.
+func (bs *BlobStore) Open(hash string) (*os.File, error) {
+	if !hashPattern.MatchString(hash) {
+		return nil, ErrBlobNotFound
+	}
+
+	f, err := os.Open(bs.path(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening attachment file: %w", err)
+	}
+	return f, nil
+}
+
+// Sweep removes the content whose hash is not on keep, and returns how much
+// was removed. Only files last written before modifiedBefore are removed,
+// so content put while keep was being read is left alone.
+func (bs *BlobStore) Sweep(keep []string, modifiedBefore time.Time) (int, error) {
+	kept := map[string]bool{}
+	for _, hash := range keep {
+		kept[hash] = true
+	}
+
+	removed := 0
+	err := filepath.Walk(bs.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !info.ModTime().Before(modifiedBefore) {
+			return nil
+		}
+
+		name := info.Name()
+		// Leftovers from a Put interrupted by a crash are removed as well
+		if kept[name] || (!hashPattern.MatchString(name) && !strings.HasPrefix(name, uploadPrefix)) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("sweeping attachments: %w", err)
+	}
+	return removed, nil
+}
+
+// write copies r to f while hashing and sniffing it.
+func (bs *BlobStore) write(f *os.File, r io.Reader) (*Blob, error) {
+	// One byte past the limit tells a too large content apart
+	r = io.LimitReader(r, bs.maxSize+1)
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("reading attachment: %w", err)
+	}
+	head = head[:n]
+
+	hash := sha256.New()
+	w := io.MultiWriter(f, hash)
+	if _, err := w.Write(head); err != nil {
+		return nil, fmt.Errorf("writing attachment file: %w", err)
+	}
+	rest, err := io.Copy(w, r)
+	if err != nil {
+		return nil, fmt.Errorf("writing attachment file: %w", err)
+	}
+
+	size := int64(n) + rest
+	if size > bs.maxSize {
+		return nil, ErrBlobTooLarge
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("writing attachment file: %w", err)
+	}
+
+	return &Blob{
+		Hash:        hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		ContentType: http.DetectContentType(head),
+	}, nil
+}
+
+// path spreads the files over subdirectories named by the start of their
+// hash, so no directory gets too big.
+func (bs *BlobStore) path(hash string) string {
+	return filepath.Join(bs.dir, hash[:2], hash)
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// pngHeader is enough of a PNG for it to be sniffed as one.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+func TestBlobStorePut(t *testing.T) {
+	type Test struct {
+		name    string
+		content []byte
+		want    *Blob
+	}
+
+	tests := []Test{
+		{
+			name:    "Text",
+			content: []byte("Make the bed"),
+			want: &Blob{
+				Hash:        "79ca951a4c9f5883e7bf176c3711642973ef549050bb6a9675a4b4aa1fc03c8e",
+				Size:        12,
+				ContentType: "text/plain; charset=utf-8",
+			},
+		},
+		{
+			name:    "Image",
+			content: pngHeader,
+			want: &Blob{
+				Hash:        "02a3e298f1533f62558c58e4c70edcab9af5a50d62d925fd5390942020fb0fb8",
+				Size:        int64(len(pngHeader)),
+				ContentType: "image/png",
+			},
+		},
+		{
+			name:    "Empty",
+			content: []byte{},
+			want: &Blob{
+				Hash:        "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+				Size:        0,
+				ContentType: "text/plain; charset=utf-8",
+			},
+		},
+		{
+			name:    "Limit",
+			content: bytes.Repeat([]byte("a"), 1024),
+			want: &Blob{
+				Hash:        "2edc986847e209b4016e141a6dc8716d3207350f416969382d431539bf292e4a",
+				Size:        1024,
+				ContentType: "text/plain; charset=utf-8",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blobs := newTestBlobStore(t, 1024)
+
+			got, err := blobs.Put(bytes.NewReader(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreUnexported(Blob{})); diff != "" {
+				t.Errorf("Put() mismatch (-want +got):\n%s", diff)
+			}
+
+			assertBlob(t, blobs, got.Hash, test.content)
+		})
+	}
+}
+
+func TestBlobStoreTooLarge(t *testing.T) {
+	blobs := newTestBlobStore(t, 1024)
+
+	_, err := blobs.Put(bytes.NewReader(bytes.Repeat([]byte("a"), 1025)))
+	if !errors.Is(err, ErrBlobTooLarge) {
+		t.Fatalf("got error %v; want %v", err, ErrBlobTooLarge)
+	}
+
+	// Nothing is left behind
+	assertBlobFiles(t, blobs, []string{})
+}
+
+func TestBlobStoreDeduplicates(t *testing.T) {
+	blobs := newTestBlobStore(t, 0)
+
+	first, err := blobs.Put(strings.NewReader("Make the bed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := blobs.Put(strings.NewReader("Make the bed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(first, second, cmpopts.IgnoreUnexported(Blob{})); diff != "" {
+		t.Errorf("Put() of the same content mismatch (-want +got):\n%s", diff)
+	}
+	assertBlobFiles(t, blobs, []string{first.Hash})
+}
+
+func TestBlobStoreDiscard(t *testing.T) {
+	blobs := newTestBlobStore(t, 0)
+
+	discarded, err := blobs.Put(strings.NewReader("Make the bed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Discard(discarded); err != nil {
+		t.Fatal(err)
+	}
+	assertBlobFiles(t, blobs, []string{})
+
+	// Content stored already is left alone
+	kept, err := blobs.Put(strings.NewReader("Water the plants"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := blobs.Put(strings.NewReader("Water the plants"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Discard(again); err != nil {
+		t.Fatal(err)
+	}
+	assertBlobFiles(t, blobs, []string{kept.Hash})
+
+	// And so is content put again since it was stored
+	path := blobs.path(kept.Hash)
+	stored := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, stored, stored); err != nil {
+		t.Fatal(err)
+	}
+	kept.modTime = stored
+	if _, err := blobs.Put(strings.NewReader("Water the plants")); err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Discard(kept); err != nil {
+		t.Fatal(err)
+	}
+	assertBlobFiles(t, blobs, []string{kept.Hash})
+}
+
+func TestBlobStoreOpenNotFound(t *testing.T) {
+	blobs := newTestBlobStore(t, 0)
+
+	for _, hash := range []string{strings.Repeat("a", 64), "../snapshot.json", ""} {
+		_, err := blobs.Open(hash)
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Open(%q) got error %v; want %v", hash, err, ErrBlobNotFound)
+		}
+	}
+}
+
+func TestBlobStoreSweep(t *testing.T) {
+	blobs := newTestBlobStore(t, 0)
+
+	kept, err := blobs.Put(strings.NewReader("Make the bed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused, err := blobs.Put(strings.NewReader("Sweep the floor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftover, err := ioutil.TempFile(blobs.dir, uploadPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leftover.Close()
+
+	// Recent files are left alone, as they may not be on any attachment yet
+	removed, err := blobs.Sweep([]string{kept.Hash}, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("Sweep() removed %d recent files; want none", removed)
+	}
+
+	removed, err = blobs.Sweep([]string{kept.Hash}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("Sweep() removed %d files; want 2", removed)
+	}
+	assertBlobFiles(t, blobs, []string{kept.Hash})
+
+	_, err = blobs.Open(unused.Hash)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Open() of swept content got error %v; want %v", err, ErrBlobNotFound)
+	}
+	assertBlob(t, blobs, kept.Hash, []byte("Make the bed"))
+}
+
+func newTestBlobStore(t *testing.T, maxSize int64) *BlobStore {
+	t.Helper()
+
+	blobs, err := NewBlobStore(filepath.Join(t.TempDir(), "attachments"), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+func assertBlob(t *testing.T, blobs *BlobStore, hash string, want []byte) {
+	t.Helper()
+
+	f, err := blobs.Open(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("got content %q; want %q", got, want)
+	}
+}
+
+// assertBlobFiles checks the names of every file on the store.
+func assertBlobFiles(t *testing.T, blobs *BlobStore, want []string) {
+	t.Helper()
+
+	got := []string{}
+	err := filepath.Walk(blobs.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			got = append(got, info.Name())
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+}
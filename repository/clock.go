@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx making the repository read the current
+// time from now, instead of the system clock. Repositories that replay past
+// mutations use it so timestamps come out the same as the first time.
+func WithClock(ctx context.Context, now func() time.Time) context.Context {
+	return context.WithValue(ctx, clockKey{}, now)
+}
+
+// fixedClock returns a context where the time is always t.
+func fixedClock(ctx context.Context, t time.Time) context.Context {
+	return WithClock(ctx, func() time.Time { return t })
+}
+
+// now returns the current time for ctx, in UTC.
+func now(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockKey{}).(func() time.Time); ok {
+		return clock().UTC()
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+func (ls *LocalStorage) InsertComment(ctx context.Context, comment Comment) (*Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoTable[comment.TodoID]; !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	if strings.TrimSpace(comment.Body) == "" {
+		return nil, ErrEmptyComment
+	}
+
+	if comment.ParentID != nil {
+		parent, ok := ls.Comments[*comment.ParentID]
+		if !ok || parent.TodoID != comment.TodoID {
+			return nil, ErrInvalidReply
+		}
+	}
+
+	if actor := ActorFromContext(ctx); actor != "" {
+		comment.Author = actor
+	}
+
+	comment = ls.insertComment(ctx, comment)
+	return &comment, nil
+}
+
+func (ls *LocalStorage) GetComments(ctx context.Context, todoID uint32) ([]Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if _, ok := ls.TodoTable[todoID]; !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	comments := []Comment{}
+	for _, id := range ls.TodoComments[todoID] {
+		comments = append(comments, cloneComment(ls.Comments[id]))
+	}
+	return comments, nil
+}
+
+func (ls *LocalStorage) GetComment(ctx context.Context, id uint32) (*Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	comment, ok := ls.activeComment(id)
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+
+	comment = cloneComment(comment)
+	return &comment, nil
+}
+
+func (ls *LocalStorage) UpdateComment(ctx context.Context, comment Comment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.activeComment(comment.ID)
+	if !ok {
+		return ErrCommentNotFound
+	}
+
+	if comment.Version != 0 && comment.Version != stored.Version {
+		return ErrConflict
+	}
+
+	if strings.TrimSpace(comment.Body) == "" {
+		return ErrEmptyComment
+	}
+
+	updated := cloneComment(stored)
+	updated.Body = comment.Body
+	updated.Version++
+	updated.UpdatedAt = now(ctx)
+	ls.Comments[updated.ID] = updated
+	ls.reindexTodo(updated.TodoID)
+	return nil
+}
+
+// DeleteComment removes a comment together with its replies, at any depth.
+func (ls *LocalStorage) DeleteComment(ctx context.Context, comment Comment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.activeComment(comment.ID)
+	if !ok {
+		return ErrCommentNotFound
+	}
+
+	if comment.Version != 0 && comment.Version != stored.Version {
+		return ErrConflict
+	}
+
+	deleted := map[uint32]bool{stored.ID: true}
+	remaining := []uint32{}
+	// Replies always come after what they reply to, so one pass finds them
+	for _, id := range ls.TodoComments[stored.TodoID] {
+		c := ls.Comments[id]
+		if deleted[id] || (c.ParentID != nil && deleted[*c.ParentID]) {
+			deleted[id] = true
+			delete(ls.Comments, id)
+			continue
+		}
+		remaining = append(remaining, id)
+	}
+	ls.setCommentIDs(stored.TodoID, remaining)
+	ls.reindexTodo(stored.TodoID)
+	return nil
+}
+
+// insertComment stores a validated comment under the next ID and returns it
+// as stored. Must be called with ls.mu held.
+func (ls *LocalStorage) insertComment(ctx context.Context, comment Comment) Comment {
+	comment.ID = ls.CommentAutoincrement
+	comment.Version = 1
+	comment.CreatedAt = now(ctx)
+	comment.UpdatedAt = comment.CreatedAt
+	ls.Comments[comment.ID] = cloneComment(comment)
+	ls.TodoComments[comment.TodoID] = append(ls.TodoComments[comment.TodoID], comment.ID)
+	ls.CommentAutoincrement++
+	ls.reindexTodo(comment.TodoID)
+	return comment
+}
+
+// activeComment returns a comment unless its todo is on the trash. Must be
+// called with ls.mu held.
+func (ls *LocalStorage) activeComment(id uint32) (Comment, bool) {
+	comment, ok := ls.Comments[id]
+	if !ok {
+		return Comment{}, false
+	}
+	if _, ok := ls.TodoTable[comment.TodoID]; !ok {
+		return Comment{}, false
+	}
+	return comment, true
+}
+
+// commentBodies returns the bodies of the comments on a todo, oldest first.
+// Must be called with ls.mu held.
+func (ls *LocalStorage) commentBodies(todoID uint32) []string {
+	bodies := []string{}
+	for _, id := range ls.TodoComments[todoID] {
+		bodies = append(bodies, ls.Comments[id].Body)
+	}
+	return bodies
+}
+
+// forgetComments removes every comment of a purged todo. Must be called
+// with ls.mu held.
+func (ls *LocalStorage) forgetComments(todoID uint32) {
+	for _, id := range ls.TodoComments[todoID] {
+		delete(ls.Comments, id)
+	}
+	delete(ls.TodoComments, todoID)
+}
+
+// setCommentIDs replaces the comments of a todo, in order. Must be called
+// with ls.mu held.
+func (ls *LocalStorage) setCommentIDs(todoID uint32, commentIDs []uint32) {
+	if len(commentIDs) == 0 {
+		delete(ls.TodoComments, todoID)
+		return
+	}
+	ls.TodoComments[todoID] = commentIDs
+}
+
+// migrateComments turns the text todos had as comments, before comments
+// were records of their own, into the first comment of each todo, including
+// the ones on the trash. Todos that already have comments are left alone.
+// The comments are dated as the last change of their todo, and it returns
+// how many were created.
+func (ls *LocalStorage) migrateComments(ctx context.Context, legacy map[uint32]string) int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	todoIDs := []uint32{}
+	for id, body := range legacy {
+		if strings.TrimSpace(body) != "" && len(ls.TodoComments[id]) == 0 {
+			todoIDs = append(todoIDs, id)
+		}
+	}
+	sort.Slice(todoIDs, func(i, j int) bool { return todoIDs[i] < todoIDs[j] })
+
+	migrated := 0
+	for _, id := range todoIDs {
+		todo, ok := ls.TodoTable[id]
+		if !ok {
+			trashed, ok := ls.TodoTrash[id]
+			if !ok {
+				continue
+			}
+			todo = trashed.Todo
+		}
+		ls.insertComment(fixedClock(ctx, todo.UpdatedAt), Comment{TodoID: id, Body: legacy[id]})
+		migrated++
+	}
+	return migrated
+}
+
+// cloneComment copies the parent of a comment so callers never share memory
+// with the stored record.
+func cloneComment(comment Comment) Comment {
+	if comment.ParentID != nil {
+		parentID := *comment.ParentID
+		comment.ParentID = &parentID
+	}
+	return comment
+}
@@ -0,0 +1,29 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/vitorarins/todoer/repository"
+	"github.com/vitorarins/todoer/repository/repositorytest"
+)
+
+func TestLocalStorageConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewLocalStorage()
+	})
+}
+
+func TestFileStorageConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		fileStorage, err := repository.NewFileStorage(t.TempDir(), repository.FileStorageOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := fileStorage.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+		return fileStorage
+	})
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type forceKey struct{}
+
+// WithForce returns a copy of ctx where a todo can become done while it
+// still has open blockers.
+func WithForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+// forced reports whether ctx was returned by WithForce.
+func forced(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey{}).(bool)
+	return force
+}
+
+func (ls *LocalStorage) AddDependency(ctx context.Context, id, blockerID uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoTable[id]; !ok {
+		return ErrTodoNotFound
+	}
+	if _, ok := ls.TodoTable[blockerID]; !ok {
+		return ErrTodoNotFound
+	}
+
+	blockerIDs := ls.TodoDependencies[id]
+	if indexOfID(blockerIDs, blockerID) >= 0 {
+		return nil
+	}
+
+	// The new dependency closes a cycle when the blocker already depends on
+	// the todo, directly or not
+	if blockerID == id || ls.dependsOn(blockerID, id) {
+		return ErrDependencyCycle
+	}
+
+	newBlockerIDs := append([]uint32{blockerID}, blockerIDs...)
+	sort.Slice(newBlockerIDs, func(i, j int) bool { return newBlockerIDs[i] < newBlockerIDs[j] })
+	ls.setDependencies(ctx, id, newBlockerIDs)
+	return nil
+}
+
+func (ls *LocalStorage) RemoveDependency(ctx context.Context, id, blockerID uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoTable[id]; !ok {
+		return ErrTodoNotFound
+	}
+
+	blockerIDs := ls.TodoDependencies[id]
+	if indexOfID(blockerIDs, blockerID) < 0 {
+		return ErrNoDependency
+	}
+
+	ls.setDependencies(ctx, id, removeIDs(blockerIDs, blockerID))
+	return nil
+}
+
+func (ls *LocalStorage) GetBlockers(ctx context.Context, id uint32) ([]Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if _, ok := ls.TodoTable[id]; !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	blockers := []Todo{}
+	for _, blockerID := range ls.TodoDependencies[id] {
+		if blocker, ok := ls.TodoTable[blockerID]; ok {
+			blockers = append(blockers, cloneTodo(blocker))
+		}
+	}
+	return blockers, nil
+}
+
+// setDependencies replaces the blockers of a todo, which counts as a change
+// of it. Must be called with ls.mu held.
+func (ls *LocalStorage) setDependencies(ctx context.Context, id uint32, blockerIDs []uint32) {
+	oldBlockerIDs := ls.TodoDependencies[id]
+	if len(blockerIDs) == 0 {
+		delete(ls.TodoDependencies, id)
+	} else {
+		ls.TodoDependencies[id] = blockerIDs
+	}
+
+	todo := ls.TodoTable[id]
+	todo.Version++
+	todo.UpdatedAt = now(ctx)
+	ls.TodoTable[id] = todo
+
+	changes := []FieldChange{{Field: "blocked_by", Old: formatIDs(oldBlockerIDs), New: formatIDs(blockerIDs)}}
+	ls.recordTodo(ctx, id, ActionUpdate, changes)
+}
+
+// blocked reports whether a todo has open blockers. Must be called with
+// ls.mu held.
+func (ls *LocalStorage) blocked(id uint32) bool {
+	for _, blockerID := range ls.TodoDependencies[id] {
+		if blocker, ok := ls.TodoTable[blockerID]; ok && !blocker.Done {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOn reports whether a todo is blocked by another one, directly or
+// through other todos. Dependencies of deleted todos count too, as they come
+// back when restored. Must be called with ls.mu held.
+func (ls *LocalStorage) dependsOn(id, blockerID uint32) bool {
+	visited := map[uint32]bool{}
+	pending := []uint32{id}
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, nextBlockerID := range ls.TodoDependencies[next] {
+			if nextBlockerID == blockerID {
+				return true
+			}
+			if !visited[nextBlockerID] {
+				visited[nextBlockerID] = true
+				pending = append(pending, nextBlockerID)
+			}
+		}
+	}
+	return false
+}
+
+// forgetDependencies removes a purged todo from the dependency graph, as a
+// blocker and as a blocked todo. Must be called with ls.mu held.
+func (ls *LocalStorage) forgetDependencies(id uint32) {
+	delete(ls.TodoDependencies, id)
+	for blockedID, blockerIDs := range ls.TodoDependencies {
+		if indexOfID(blockerIDs, id) < 0 {
+			continue
+		}
+		if newBlockerIDs := removeIDs(blockerIDs, id); len(newBlockerIDs) > 0 {
+			ls.TodoDependencies[blockedID] = newBlockerIDs
+		} else {
+			delete(ls.TodoDependencies, blockedID)
+		}
+	}
+}
+
+// formatIDs formats IDs as a history value, comma separated.
+func formatIDs(ids []uint32) string {
+	formatted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		formatted = append(formatted, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,46 @@
+package repository
+
+import "context"
+
+// SetFeedToken replaces the hash of the secret reading the calendar feed of
+// a todo list, where an empty hash turns the feed off. The todo list is not
+// changed otherwise, so neither its version nor its history move.
+func (ls *LocalStorage) SetFeedToken(ctx context.Context, id uint32, hash string) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoListTable[id]
+	if !ok {
+		return nil, ErrTodoListNotFound
+	}
+
+	stored.FeedTokenHash = hash
+	ls.TodoListTable[id] = stored
+	todoList := cloneTodoList(stored)
+	return &todoList, nil
+}
+
+func (ls *LocalStorage) GetTodoListByFeedToken(ctx context.Context, hash string) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if hash == "" {
+		return nil, ErrTodoListNotFound
+	}
+	for _, todoList := range ls.TodoListTable {
+		if todoList.FeedTokenHash == hash {
+			todoList = cloneTodoList(todoList)
+			return &todoList, nil
+		}
+	}
+
+	return nil, ErrTodoListNotFound
+}
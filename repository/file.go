@@ -0,0 +1,1526 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSnapshotEvery is how many log records are written before the
+	// log is compacted into a new snapshot, when no other value is given.
+	DefaultSnapshotEvery = 1000
+
+	snapshotFileName = "snapshot.json"
+	walFileName      = "wal.log"
+	snapshotVersion  = 2
+
+	// Each log record is framed by its payload length and a CRC32 checksum.
+	walHeaderSize = 8
+	// Bigger payloads can only come from a corrupted length header.
+	walMaxRecordSize = 64 << 20
+)
+
+var (
+	ErrCorruptedStorage = errors.New("storage data is corrupted")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Operations recorded on the write-ahead log
+const (
+	opInsertTodoList   = "insert_todo_list"
+	opUpdateTodoList   = "update_todo_list"
+	opDeleteTodoList   = "delete_todo_list"
+	opInsertTodo       = "insert_todo"
+	opUpdateTodo       = "update_todo"
+	opMoveTodo         = "move_todo"
+	opDeleteTodo       = "delete_todo"
+	opRestoreTodoList  = "restore_todo_list"
+	opRestoreTodo      = "restore_todo"
+	opPurgeTodoList    = "purge_todo_list"
+	opPurgeTodo        = "purge_todo"
+	opPurgeTrash       = "purge_trash"
+	opAddDependency    = "add_dependency"
+	opRemoveDependency = "remove_dependency"
+	opInsertLabel      = "insert_label"
+	opUpdateLabel      = "update_label"
+	opRenameLabel      = "rename_label"
+	opDeleteLabel      = "delete_label"
+	opInsertComment    = "insert_comment"
+	opUpdateComment    = "update_comment"
+	opDeleteComment    = "delete_comment"
+	opInsertAttachment = "insert_attachment"
+	opDeleteAttachment = "delete_attachment"
+	opInsertUser       = "insert_user"
+	opShareTodoList    = "share_todo_list"
+	opUnshareTodoList  = "unshare_todo_list"
+	opSetFeedToken     = "set_feed_token"
+	opInsertToken      = "insert_token"
+	opDeleteToken      = "delete_token"
+)
+
+type FileStorageOptions struct {
+	// SnapshotEvery is the number of log records after which a snapshot is
+	// taken and the log compacted. Zero means DefaultSnapshotEvery.
+	SnapshotEvery int
+	// StrictLabels refuses todos with labels that are not registered. The
+	// log is always replayed without it.
+	StrictLabels bool
+}
+
+// FileStorage is a Repository that keeps its data on local disk.
+//
+// All the data lives in memory on a LocalStorage. Every mutation is also
+// appended and synced to a write-ahead log before returning, and from time
+// to time the whole state is written as a snapshot and the log is truncated.
+// When opened, the last snapshot is loaded and the log replayed on top of it,
+// discarding any torn record left by a crash in the middle of a write.
+type FileStorage struct {
+	// mu serializes mutations so the log has the same order as the
+	// changes applied in memory. Reads only go through the LocalStorage lock.
+	mu            sync.Mutex
+	local         *LocalStorage
+	dir           string
+	wal           *os.File
+	seq           uint64
+	walRecords    int
+	snapshotEvery int
+	// err is set when a record could not be written to the log. From then on
+	// memory and disk have diverged, so all mutations are refused.
+	err error
+	// legacyComments are the comments todos had as text, before comments
+	// were records of their own, found while loading. They are migrated
+	// once everything is loaded.
+	legacyComments map[uint32]string
+	// readOnly loads the data without writing anything to disk, neither
+	// cleaning up after a crash nor taking snapshots.
+	readOnly bool
+}
+
+type walRecord struct {
+	Seq uint64 `json:"seq"`
+	Op  string `json:"op"`
+	// At is the time the mutation happened. It is the clock seen by the
+	// LocalStorage when replaying, so timestamps are set the same way.
+	At time.Time `json:"at"`
+	// Actor is who made the mutation, recorded on the history when replaying.
+	Actor string `json:"actor,omitempty"`
+	// Force is whether the mutation was made WithForce.
+	Force bool            `json:"force,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type deleteTodoListRecord struct {
+	ID      uint32                `json:"id"`
+	Options DeleteTodoListOptions `json:"options"`
+}
+
+type moveTodoRecord struct {
+	ID      uint32          `json:"id"`
+	Options MoveTodoOptions `json:"options"`
+}
+
+type idRecord struct {
+	ID uint32 `json:"id"`
+}
+
+type dependencyRecord struct {
+	ID        uint32 `json:"id"`
+	BlockerID uint32 `json:"blocker_id"`
+}
+
+type renameLabelRecord struct {
+	Name    string `json:"name"`
+	NewName string `json:"new_name"`
+}
+
+type nameRecord struct {
+	Name string `json:"name"`
+}
+
+type shareRecord struct {
+	ID     uint32 `json:"id"`
+	Member Member `json:"member"`
+}
+
+type unshareRecord struct {
+	ID   uint32 `json:"id"`
+	User string `json:"user"`
+}
+
+type feedTokenRecord struct {
+	ID   uint32 `json:"id"`
+	Hash string `json:"hash"`
+}
+
+type purgeTrashRecord struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+type fileSnapshot struct {
+	Version int           `json:"version"`
+	Seq     uint64        `json:"seq"`
+	State   *LocalStorage `json:"state"`
+}
+
+// legacyTodo is the part of a todo written by version 1, when comments were
+// a text field of the todo. Comments is nil when the field is missing.
+type legacyTodo struct {
+	Comments *string
+}
+
+// legacySnapshot is the part of a version 1 snapshot holding the comments
+// of the todos.
+type legacySnapshot struct {
+	State struct {
+		TodoTable map[uint32]legacyTodo
+		TodoTrash map[uint32]struct {
+			Todo legacyTodo
+		}
+	} `json:"state"`
+}
+
+func NewFileStorage(dir string, opts FileStorageOptions) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	fs := &FileStorage{
+		local:          NewLocalStorage(),
+		dir:            dir,
+		snapshotEvery:  opts.SnapshotEvery,
+		legacyComments: map[uint32]string{},
+	}
+	if fs.snapshotEvery <= 0 {
+		fs.snapshotEvery = DefaultSnapshotEvery
+	}
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if err := fs.replayWAL(); err != nil {
+		return nil, err
+	}
+
+	if err := fs.migrateComments(); err != nil {
+		fs.wal.Close()
+		return nil, err
+	}
+	fs.local.StrictLabels = opts.StrictLabels
+
+	return fs, nil
+}
+
+// LoadFileStorage reads the data a FileStorage keeps at dir on a
+// LocalStorage, without writing anything to dir: the log is replayed up to
+// any torn record, which is left in place, and nothing is snapshotted. It
+// reads the data of a service that is not running, like to back it up.
+func LoadFileStorage(dir string) (*LocalStorage, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("opening data directory: %w", err)
+	}
+
+	fs := &FileStorage{
+		local:          NewLocalStorage(),
+		dir:            dir,
+		legacyComments: map[uint32]string{},
+		readOnly:       true,
+	}
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.replayWAL(); err != nil {
+		return nil, err
+	}
+	if err := fs.migrateComments(); err != nil {
+		return nil, err
+	}
+	return fs.local, nil
+}
+
+// Snapshot writes the current state to disk and compacts the log.
+func (fs *FileStorage) Snapshot() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+	return fs.snapshot()
+}
+
+// Close takes a last snapshot and releases the log file.
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var err error
+	if fs.err == nil {
+		err = fs.snapshot()
+	}
+
+	if closeErr := fs.wal.Close(); err == nil {
+		err = closeErr
+	}
+	fs.err = errors.New("file storage is closed")
+	return err
+}
+
+// TodoList
+
+func (fs *FileStorage) InsertTodoList(ctx context.Context, todoList TodoList) (*TodoList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newTodoList, err := fs.local.InsertTodoList(ctx, todoList)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertTodoList, newTodoList); err != nil {
+		return nil, err
+	}
+	return newTodoList, nil
+}
+
+func (fs *FileStorage) GetAllTodoLists(ctx context.Context) ([]TodoList, error) {
+	return fs.local.GetAllTodoLists(ctx)
+}
+
+func (fs *FileStorage) GetTodoListByID(ctx context.Context, id uint32) (*TodoList, error) {
+	return fs.local.GetTodoListByID(ctx, id)
+}
+
+func (fs *FileStorage) UpdateTodoList(ctx context.Context, todoList TodoList) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.UpdateTodoList(ctx, todoList); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opUpdateTodoList, todoList)
+}
+
+func (fs *FileStorage) DeleteTodoListByID(ctx context.Context, id uint32, opts DeleteTodoListOptions) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteTodoListByID(ctx, id, opts); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteTodoList, deleteTodoListRecord{ID: id, Options: opts})
+}
+
+// Todo
+
+func (fs *FileStorage) InsertTodo(ctx context.Context, todo Todo) (*Todo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newTodo, err := fs.local.InsertTodo(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertTodo, newTodo); err != nil {
+		return nil, err
+	}
+	return newTodo, nil
+}
+
+func (fs *FileStorage) GetTodoByID(ctx context.Context, id uint32) (*Todo, error) {
+	return fs.local.GetTodoByID(ctx, id)
+}
+
+func (fs *FileStorage) GetTodosByListID(ctx context.Context, listID uint32) ([]Todo, error) {
+	return fs.local.GetTodosByListID(ctx, listID)
+}
+
+func (fs *FileStorage) QueryTodos(ctx context.Context, query TodoQuery) (*TodoPage, error) {
+	return fs.local.QueryTodos(ctx, query)
+}
+
+func (fs *FileStorage) UpdateTodo(ctx context.Context, todo Todo) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.UpdateTodo(ctx, todo); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opUpdateTodo, todo)
+}
+
+func (fs *FileStorage) MoveTodo(ctx context.Context, id uint32, opts MoveTodoOptions) (*Todo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	todo, err := fs.local.MoveTodo(ctx, id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opMoveTodo, moveTodoRecord{ID: id, Options: opts}); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (fs *FileStorage) DeleteTodo(ctx context.Context, todo Todo) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteTodo(ctx, todo); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteTodo, todo)
+}
+
+// Dependencies
+
+func (fs *FileStorage) AddDependency(ctx context.Context, id, blockerID uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.AddDependency(ctx, id, blockerID); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opAddDependency, dependencyRecord{ID: id, BlockerID: blockerID})
+}
+
+func (fs *FileStorage) RemoveDependency(ctx context.Context, id, blockerID uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.RemoveDependency(ctx, id, blockerID); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opRemoveDependency, dependencyRecord{ID: id, BlockerID: blockerID})
+}
+
+func (fs *FileStorage) GetBlockers(ctx context.Context, id uint32) ([]Todo, error) {
+	return fs.local.GetBlockers(ctx, id)
+}
+
+// Trash
+
+func (fs *FileStorage) GetTrash(ctx context.Context) (*Trash, error) {
+	return fs.local.GetTrash(ctx)
+}
+
+func (fs *FileStorage) RestoreTodoList(ctx context.Context, id uint32) (*TodoList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	todoList, err := fs.local.RestoreTodoList(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opRestoreTodoList, idRecord{ID: id}); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (fs *FileStorage) RestoreTodo(ctx context.Context, id uint32) (*Todo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	todo, err := fs.local.RestoreTodo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opRestoreTodo, idRecord{ID: id}); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (fs *FileStorage) PurgeTodoList(ctx context.Context, id uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	if err := fs.local.PurgeTodoList(ctx, id); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opPurgeTodoList, idRecord{ID: id})
+}
+
+func (fs *FileStorage) PurgeTodo(ctx context.Context, id uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	if err := fs.local.PurgeTodo(ctx, id); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opPurgeTodo, idRecord{ID: id})
+}
+
+func (fs *FileStorage) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return 0, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+	purged, err := fs.local.PurgeTrash(ctx, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nothing changed, so there is no need to log it
+	if purged == 0 {
+		return 0, nil
+	}
+
+	if err := fs.append(ctx, opPurgeTrash, purgeTrashRecord{DeletedBefore: deletedBefore}); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// History
+
+func (fs *FileStorage) GetTodoListHistory(ctx context.Context, id uint32) ([]HistoryEntry, error) {
+	return fs.local.GetTodoListHistory(ctx, id)
+}
+
+func (fs *FileStorage) GetTodoHistory(ctx context.Context, id uint32) ([]HistoryEntry, error) {
+	return fs.local.GetTodoHistory(ctx, id)
+}
+
+// Labels
+
+func (fs *FileStorage) InsertLabel(ctx context.Context, label Label) (*Label, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newLabel, err := fs.local.InsertLabel(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertLabel, label); err != nil {
+		return nil, err
+	}
+	return newLabel, nil
+}
+
+func (fs *FileStorage) GetAllLabels(ctx context.Context) ([]Label, error) {
+	return fs.local.GetAllLabels(ctx)
+}
+
+func (fs *FileStorage) GetLabel(ctx context.Context, name string) (*Label, error) {
+	return fs.local.GetLabel(ctx, name)
+}
+
+func (fs *FileStorage) UpdateLabel(ctx context.Context, label Label) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.UpdateLabel(ctx, label); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opUpdateLabel, label)
+}
+
+func (fs *FileStorage) RenameLabel(ctx context.Context, name, newName string) (*Label, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	label, err := fs.local.RenameLabel(ctx, name, newName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opRenameLabel, renameLabelRecord{Name: name, NewName: newName}); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+func (fs *FileStorage) DeleteLabel(ctx context.Context, name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteLabel(ctx, name); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteLabel, nameRecord{Name: name})
+}
+
+// Comments
+
+func (fs *FileStorage) InsertComment(ctx context.Context, comment Comment) (*Comment, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newComment, err := fs.local.InsertComment(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertComment, newComment); err != nil {
+		return nil, err
+	}
+	return newComment, nil
+}
+
+func (fs *FileStorage) GetComments(ctx context.Context, todoID uint32) ([]Comment, error) {
+	return fs.local.GetComments(ctx, todoID)
+}
+
+func (fs *FileStorage) GetComment(ctx context.Context, id uint32) (*Comment, error) {
+	return fs.local.GetComment(ctx, id)
+}
+
+func (fs *FileStorage) UpdateComment(ctx context.Context, comment Comment) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.UpdateComment(ctx, comment); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opUpdateComment, comment)
+}
+
+func (fs *FileStorage) DeleteComment(ctx context.Context, comment Comment) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteComment(ctx, comment); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteComment, comment)
+}
+
+// migrateComments turns the legacy comments found while loading into
+// comments, and takes a snapshot right away so they are written only once.
+// Must be called before any mutation.
+func (fs *FileStorage) migrateComments() error {
+	migrated := fs.local.migrateComments(context.Background(), fs.legacyComments)
+	fs.legacyComments = nil
+	if migrated == 0 || fs.readOnly {
+		return nil
+	}
+
+	if err := fs.snapshot(); err != nil {
+		return fmt.Errorf("migrating comments: %w", err)
+	}
+	return nil
+}
+
+// Attachments
+
+func (fs *FileStorage) InsertAttachment(ctx context.Context, attachment Attachment) (*Attachment, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newAttachment, err := fs.local.InsertAttachment(ctx, attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertAttachment, newAttachment); err != nil {
+		return nil, err
+	}
+	return newAttachment, nil
+}
+
+func (fs *FileStorage) GetAttachments(ctx context.Context, todoID uint32) ([]Attachment, error) {
+	return fs.local.GetAttachments(ctx, todoID)
+}
+
+func (fs *FileStorage) GetAttachment(ctx context.Context, id uint32) (*Attachment, error) {
+	return fs.local.GetAttachment(ctx, id)
+}
+
+func (fs *FileStorage) DeleteAttachment(ctx context.Context, id uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteAttachment(ctx, id); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteAttachment, idRecord{ID: id})
+}
+
+func (fs *FileStorage) GetAttachmentHashes(ctx context.Context) ([]string, error) {
+	return fs.local.GetAttachmentHashes(ctx)
+}
+
+// Users
+
+func (fs *FileStorage) InsertUser(ctx context.Context, user User) (*User, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newUser, err := fs.local.InsertUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertUser, newUser); err != nil {
+		return nil, err
+	}
+	return newUser, nil
+}
+
+func (fs *FileStorage) GetAllUsers(ctx context.Context) ([]User, error) {
+	return fs.local.GetAllUsers(ctx)
+}
+
+func (fs *FileStorage) GetUser(ctx context.Context, name string) (*User, error) {
+	return fs.local.GetUser(ctx, name)
+}
+
+func (fs *FileStorage) ShareTodoList(ctx context.Context, id uint32, member Member) (*TodoList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	todoList, err := fs.local.ShareTodoList(ctx, id, member)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opShareTodoList, shareRecord{ID: id, Member: member}); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (fs *FileStorage) UnshareTodoList(ctx context.Context, id uint32, user string) (*TodoList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	todoList, err := fs.local.UnshareTodoList(ctx, id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opUnshareTodoList, unshareRecord{ID: id, User: user}); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (fs *FileStorage) SetFeedToken(ctx context.Context, id uint32, hash string) (*TodoList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	todoList, err := fs.local.SetFeedToken(ctx, id, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opSetFeedToken, feedTokenRecord{ID: id, Hash: hash}); err != nil {
+		return nil, err
+	}
+	return todoList, nil
+}
+
+func (fs *FileStorage) GetTodoListByFeedToken(ctx context.Context, hash string) (*TodoList, error) {
+	return fs.local.GetTodoListByFeedToken(ctx, hash)
+}
+
+// Tokens
+
+func (fs *FileStorage) InsertToken(ctx context.Context, token Token) (*Token, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return nil, fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	newToken, err := fs.local.InsertToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.append(ctx, opInsertToken, newToken); err != nil {
+		return nil, err
+	}
+	return newToken, nil
+}
+
+func (fs *FileStorage) GetTokens(ctx context.Context, user string) ([]Token, error) {
+	return fs.local.GetTokens(ctx, user)
+}
+
+func (fs *FileStorage) GetToken(ctx context.Context, id uint32) (*Token, error) {
+	return fs.local.GetToken(ctx, id)
+}
+
+func (fs *FileStorage) GetTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	return fs.local.GetTokenByHash(ctx, hash)
+}
+
+func (fs *FileStorage) DeleteToken(ctx context.Context, id uint32) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	ctx = fixedClock(ctx, now(ctx))
+
+	if err := fs.local.DeleteToken(ctx, id); err != nil {
+		return err
+	}
+
+	return fs.append(ctx, opDeleteToken, idRecord{ID: id})
+}
+
+// Search
+
+func (fs *FileStorage) Search(ctx context.Context, query SearchQuery) ([]SearchHit, error) {
+	return fs.local.Search(ctx, query)
+}
+
+// Backups
+
+func (fs *FileStorage) Backup(ctx context.Context) (*Backup, error) {
+	return fs.local.Backup(ctx)
+}
+
+// Restore is not on the log, as a backup may be bigger than a record can
+// be. A snapshot is taken instead, before returning.
+func (fs *FileStorage) Restore(ctx context.Context, backup Backup, mode RestoreMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.err != nil {
+		return fs.err
+	}
+
+	if err := fs.local.Restore(ctx, backup, mode); err != nil {
+		return err
+	}
+
+	if err := fs.snapshot(); err != nil {
+		fs.err = fmt.Errorf("writing restored snapshot: %w", err)
+		return fs.err
+	}
+	return nil
+}
+
+// Write-ahead log
+
+// append writes a record for a mutation already applied in memory and syncs
+// it to disk, together with the time and actor seen on ctx. Must be called
+// with fs.mu held.
+func (fs *FileStorage) append(ctx context.Context, op string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s record: %w", op, err)
+	}
+
+	payload, err := json.Marshal(walRecord{
+		Seq:   fs.seq + 1,
+		Op:    op,
+		At:    now(ctx),
+		Actor: ActorFromContext(ctx),
+		Force: forced(ctx),
+		Data:  data,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding %s record: %w", op, err)
+	}
+
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[walHeaderSize:], payload)
+
+	if _, err := fs.wal.Write(record); err != nil {
+		fs.err = fmt.Errorf("writing to write-ahead log: %w", err)
+		return fs.err
+	}
+	if err := fs.wal.Sync(); err != nil {
+		fs.err = fmt.Errorf("syncing write-ahead log: %w", err)
+		return fs.err
+	}
+
+	fs.seq++
+	fs.walRecords++
+	if fs.walRecords >= fs.snapshotEvery {
+		// The record is already durable on the log, so a failed snapshot
+		// is not an error for this mutation. It will be retried on the next one.
+		_ = fs.snapshot()
+	}
+	return nil
+}
+
+// replayWAL applies every record newer than the loaded snapshot and leaves
+// the log open for appending. A record torn by an interrupted write, which
+// can only be the last one, is cut from the log. When read only, it is
+// skipped instead and the log is closed. Any other bad record fails with
+// ErrCorruptedStorage, as the records after it may have been acknowledged.
+func (fs *FileStorage) replayWAL() error {
+	path := filepath.Join(fs.dir, walFileName)
+	if fs.readOnly {
+		wal, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("opening write-ahead log: %w", err)
+		}
+		defer wal.Close()
+		if _, err := fs.replayRecords(wal); err != nil && !errors.Is(err, errTornRecord) {
+			return err
+		}
+		return nil
+	}
+
+	wal, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("opening write-ahead log: %w", err)
+	}
+
+	offset, err := fs.replayRecords(wal)
+	if errors.Is(err, errTornRecord) {
+		// Everything before offset was fully written, anything from there
+		// on is the remains of an interrupted write.
+		if err := wal.Truncate(offset); err != nil {
+			wal.Close()
+			return fmt.Errorf("truncating write-ahead log: %w", err)
+		}
+	} else if err != nil {
+		wal.Close()
+		return err
+	}
+
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		wal.Close()
+		return fmt.Errorf("seeking write-ahead log: %w", err)
+	}
+	if err := wal.Sync(); err != nil {
+		wal.Close()
+		return fmt.Errorf("syncing write-ahead log: %w", err)
+	}
+
+	fs.wal = wal
+	return nil
+}
+
+// errTornRecord is returned by replayRecords when the log ends on a record
+// that was not fully written, being shorter than its header says.
+var errTornRecord = errors.New("torn log record")
+
+// replayRecords applies the records on wal newer than the loaded snapshot,
+// and returns the offset where the fully written records end.
+func (fs *FileStorage) replayRecords(wal io.Reader) (int64, error) {
+	reader := bufio.NewReader(wal)
+	var offset int64
+	for {
+		record, size, err := readWALRecord(reader)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, errTornRecord
+		}
+		if err != nil {
+			return offset, fmt.Errorf("%w: log record at offset %d: %v", ErrCorruptedStorage, offset, err)
+		}
+		offset += size
+
+		if record.Seq <= fs.seq {
+			// Already part of the snapshot
+			continue
+		}
+		if record.Seq != fs.seq+1 {
+			return offset, fmt.Errorf("%w: expected log record %d, got %d", ErrCorruptedStorage, fs.seq+1, record.Seq)
+		}
+		if err := fs.apply(record); err != nil {
+			return offset, fmt.Errorf("%w: replaying log record %d: %v", ErrCorruptedStorage, record.Seq, err)
+		}
+		fs.seq = record.Seq
+		fs.walRecords++
+	}
+}
+
+// readWALRecord reads the next record and its size on disk. It returns io.EOF
+// only when the log ends exactly on a record boundary.
+func readWALRecord(r io.Reader) (walRecord, int64, error) {
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return walRecord{}, 0, io.EOF
+		}
+		return walRecord{}, 0, fmt.Errorf("reading record header: %w", err)
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if length > walMaxRecordSize {
+		return walRecord{}, 0, fmt.Errorf("record length %d is too big", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return walRecord{}, 0, fmt.Errorf("reading record payload: %w", err)
+	}
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return walRecord{}, 0, errors.New("record checksum mismatch")
+	}
+
+	record := walRecord{}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return walRecord{}, 0, fmt.Errorf("decoding record: %w", err)
+	}
+
+	return record, int64(walHeaderSize) + int64(length), nil
+}
+
+// apply redoes a logged mutation on the in-memory state.
+func (fs *FileStorage) apply(record walRecord) error {
+	ctx := fixedClock(context.Background(), record.At)
+	ctx = WithActor(ctx, record.Actor)
+	if record.Force {
+		ctx = WithForce(ctx)
+	}
+
+	switch record.Op {
+	case opInsertTodoList:
+		todoList := TodoList{}
+		if err := json.Unmarshal(record.Data, &todoList); err != nil {
+			return err
+		}
+		newTodoList, err := fs.local.InsertTodoList(ctx, todoList)
+		if err != nil {
+			return err
+		}
+		if newTodoList.ID != todoList.ID {
+			return fmt.Errorf("todo list inserted with ID %d, logged as %d", newTodoList.ID, todoList.ID)
+		}
+		return nil
+	case opUpdateTodoList:
+		todoList := TodoList{}
+		if err := json.Unmarshal(record.Data, &todoList); err != nil {
+			return err
+		}
+		return fs.local.UpdateTodoList(ctx, todoList)
+	case opDeleteTodoList:
+		deleteRecord := deleteTodoListRecord{}
+		if err := json.Unmarshal(record.Data, &deleteRecord); err != nil {
+			return err
+		}
+		return fs.local.DeleteTodoListByID(ctx, deleteRecord.ID, deleteRecord.Options)
+	case opInsertTodo:
+		todo := Todo{}
+		if err := json.Unmarshal(record.Data, &todo); err != nil {
+			return err
+		}
+		newTodo, err := fs.local.InsertTodo(ctx, todo)
+		if err != nil {
+			return err
+		}
+		if newTodo.ID != todo.ID {
+			return fmt.Errorf("todo inserted with ID %d, logged as %d", newTodo.ID, todo.ID)
+		}
+		return fs.keepLegacyComments(todo.ID, record.Data)
+	case opUpdateTodo:
+		todo := Todo{}
+		if err := json.Unmarshal(record.Data, &todo); err != nil {
+			return err
+		}
+		if err := fs.local.UpdateTodo(ctx, todo); err != nil {
+			return err
+		}
+		return fs.keepLegacyComments(todo.ID, record.Data)
+	case opMoveTodo:
+		moveRecord := moveTodoRecord{}
+		if err := json.Unmarshal(record.Data, &moveRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.MoveTodo(ctx, moveRecord.ID, moveRecord.Options)
+		return err
+	case opDeleteTodo:
+		todo := Todo{}
+		if err := json.Unmarshal(record.Data, &todo); err != nil {
+			return err
+		}
+		return fs.local.DeleteTodo(ctx, todo)
+	case opRestoreTodoList:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.RestoreTodoList(ctx, idRecord.ID)
+		return err
+	case opRestoreTodo:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.RestoreTodo(ctx, idRecord.ID)
+		return err
+	case opPurgeTodoList:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		return fs.local.PurgeTodoList(ctx, idRecord.ID)
+	case opPurgeTodo:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		return fs.local.PurgeTodo(ctx, idRecord.ID)
+	case opPurgeTrash:
+		purgeRecord := purgeTrashRecord{}
+		if err := json.Unmarshal(record.Data, &purgeRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.PurgeTrash(ctx, purgeRecord.DeletedBefore)
+		return err
+	case opAddDependency:
+		dependencyRecord := dependencyRecord{}
+		if err := json.Unmarshal(record.Data, &dependencyRecord); err != nil {
+			return err
+		}
+		return fs.local.AddDependency(ctx, dependencyRecord.ID, dependencyRecord.BlockerID)
+	case opRemoveDependency:
+		dependencyRecord := dependencyRecord{}
+		if err := json.Unmarshal(record.Data, &dependencyRecord); err != nil {
+			return err
+		}
+		return fs.local.RemoveDependency(ctx, dependencyRecord.ID, dependencyRecord.BlockerID)
+	case opInsertLabel:
+		label := Label{}
+		if err := json.Unmarshal(record.Data, &label); err != nil {
+			return err
+		}
+		_, err := fs.local.InsertLabel(ctx, label)
+		return err
+	case opUpdateLabel:
+		label := Label{}
+		if err := json.Unmarshal(record.Data, &label); err != nil {
+			return err
+		}
+		return fs.local.UpdateLabel(ctx, label)
+	case opRenameLabel:
+		renameRecord := renameLabelRecord{}
+		if err := json.Unmarshal(record.Data, &renameRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.RenameLabel(ctx, renameRecord.Name, renameRecord.NewName)
+		return err
+	case opDeleteLabel:
+		nameRecord := nameRecord{}
+		if err := json.Unmarshal(record.Data, &nameRecord); err != nil {
+			return err
+		}
+		return fs.local.DeleteLabel(ctx, nameRecord.Name)
+	case opInsertComment:
+		comment := Comment{}
+		if err := json.Unmarshal(record.Data, &comment); err != nil {
+			return err
+		}
+		newComment, err := fs.local.InsertComment(ctx, comment)
+		if err != nil {
+			return err
+		}
+		if newComment.ID != comment.ID {
+			return fmt.Errorf("comment inserted with ID %d, logged as %d", newComment.ID, comment.ID)
+		}
+		return nil
+	case opUpdateComment:
+		comment := Comment{}
+		if err := json.Unmarshal(record.Data, &comment); err != nil {
+			return err
+		}
+		return fs.local.UpdateComment(ctx, comment)
+	case opDeleteComment:
+		comment := Comment{}
+		if err := json.Unmarshal(record.Data, &comment); err != nil {
+			return err
+		}
+		return fs.local.DeleteComment(ctx, comment)
+	case opInsertAttachment:
+		attachment := Attachment{}
+		if err := json.Unmarshal(record.Data, &attachment); err != nil {
+			return err
+		}
+		newAttachment, err := fs.local.InsertAttachment(ctx, attachment)
+		if err != nil {
+			return err
+		}
+		if newAttachment.ID != attachment.ID {
+			return fmt.Errorf("attachment inserted with ID %d, logged as %d", newAttachment.ID, attachment.ID)
+		}
+		return nil
+	case opDeleteAttachment:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		return fs.local.DeleteAttachment(ctx, idRecord.ID)
+	case opInsertUser:
+		user := User{}
+		if err := json.Unmarshal(record.Data, &user); err != nil {
+			return err
+		}
+		_, err := fs.local.InsertUser(ctx, user)
+		return err
+	case opShareTodoList:
+		shareRecord := shareRecord{}
+		if err := json.Unmarshal(record.Data, &shareRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.ShareTodoList(ctx, shareRecord.ID, shareRecord.Member)
+		return err
+	case opUnshareTodoList:
+		unshareRecord := unshareRecord{}
+		if err := json.Unmarshal(record.Data, &unshareRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.UnshareTodoList(ctx, unshareRecord.ID, unshareRecord.User)
+		return err
+	case opSetFeedToken:
+		feedTokenRecord := feedTokenRecord{}
+		if err := json.Unmarshal(record.Data, &feedTokenRecord); err != nil {
+			return err
+		}
+		_, err := fs.local.SetFeedToken(ctx, feedTokenRecord.ID, feedTokenRecord.Hash)
+		return err
+	case opInsertToken:
+		token := Token{}
+		if err := json.Unmarshal(record.Data, &token); err != nil {
+			return err
+		}
+		newToken, err := fs.local.InsertToken(ctx, token)
+		if err != nil {
+			return err
+		}
+		if newToken.ID != token.ID {
+			return fmt.Errorf("token inserted with ID %d, logged as %d", newToken.ID, token.ID)
+		}
+		return nil
+	case opDeleteToken:
+		idRecord := idRecord{}
+		if err := json.Unmarshal(record.Data, &idRecord); err != nil {
+			return err
+		}
+		return fs.local.DeleteToken(ctx, idRecord.ID)
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+}
+
+// keepLegacyComments remembers the comments of a todo written to the log by
+// version 1, replacing any found before.
+func (fs *FileStorage) keepLegacyComments(id uint32, data json.RawMessage) error {
+	todo := legacyTodo{}
+	if err := json.Unmarshal(data, &todo); err != nil {
+		return err
+	}
+	if todo.Comments != nil {
+		fs.legacyComments[id] = *todo.Comments
+	}
+	return nil
+}
+
+// Snapshots
+
+func (fs *FileStorage) loadSnapshot() error {
+	path := filepath.Join(fs.dir, snapshotFileName)
+
+	// Leftover from a snapshot interrupted before being renamed in place
+	if !fs.readOnly {
+		if err := os.Remove(path + ".tmp"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing incomplete snapshot: %w", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	snap := fileSnapshot{State: NewLocalStorage()}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("%w: decoding snapshot: %v", ErrCorruptedStorage, err)
+	}
+	switch snap.Version {
+	case snapshotVersion:
+	case 1:
+		legacy := legacySnapshot{}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("%w: decoding snapshot: %v", ErrCorruptedStorage, err)
+		}
+		for id, todo := range legacy.State.TodoTable {
+			if todo.Comments != nil {
+				fs.legacyComments[id] = *todo.Comments
+			}
+		}
+		for id, trashed := range legacy.State.TodoTrash {
+			if trashed.Todo.Comments != nil {
+				fs.legacyComments[id] = *trashed.Todo.Comments
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported snapshot version %d", ErrCorruptedStorage, snap.Version)
+	}
+
+	// The search index is not on the snapshot, it is built from the tables
+	snap.State.rebuildIndex()
+	fs.local = snap.State
+	fs.seq = snap.Seq
+	return nil
+}
+
+// snapshot atomically replaces the snapshot file with the current state and
+// then empties the log. Must be called with fs.mu held.
+func (fs *FileStorage) snapshot() error {
+	fs.local.mu.RLock()
+	data, err := json.Marshal(fileSnapshot{
+		Version: snapshotVersion,
+		Seq:     fs.seq,
+		State:   fs.local,
+	})
+	fs.local.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	path := filepath.Join(fs.dir, snapshotFileName)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+	if err := syncDir(fs.dir); err != nil {
+		return fmt.Errorf("syncing data directory: %w", err)
+	}
+
+	// Records up to fs.seq are now on the snapshot. If we crash before the
+	// truncate they are skipped on replay, so the log can be emptied safely.
+	if err := fs.wal.Truncate(0); err != nil {
+		return fmt.Errorf("compacting write-ahead log: %w", err)
+	}
+	if _, err := fs.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("compacting write-ahead log: %w", err)
+	}
+	if err := fs.wal.Sync(); err != nil {
+		return fmt.Errorf("compacting write-ahead log: %w", err)
+	}
+
+	fs.walRecords = 0
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
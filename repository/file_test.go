@@ -0,0 +1,903 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFileStorageRecoversAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+	routine, work := fillFileStorage(t, fileStorage)
+	want := dumpFileStorage(t, fileStorage, routine.ID, work.ID)
+
+	// No Close, so the state only survives through the write-ahead log
+	fileStorage.wal.Close()
+
+	reopened := newTestFileStorage(t, dir, FileStorageOptions{})
+	defer reopened.Close()
+
+	got := dumpFileStorage(t, reopened, routine.ID, work.ID)
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess)); diff != "" {
+		t.Errorf("reopened FileStorage mismatch (-want +got):\n%s", diff)
+	}
+
+	newTodoList, err := reopened.InsertTodoList(ctx, TodoList{Title: "Groceries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The deleted "Temporary" list took ID 2, so the counter must be past it
+	if newTodoList.ID != 3 {
+		t.Errorf("got todo list ID %d after reopening; want 3", newTodoList.ID)
+	}
+}
+
+func TestLoadFileStorageLeavesDataUntouched(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{SnapshotEvery: 5})
+	fillFileStorage(t, fileStorage)
+	want, err := fileStorage.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As left by a crash: a torn record at the end of the log and an
+	// interrupted snapshot
+	fileStorage.wal.Close()
+	walPath := filepath.Join(dir, walFileName)
+	appendBytes(t, walPath, []byte{0x10, 0, 0, 0, 1, 2})
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotFileName+".tmp"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := readDir(t, dir)
+
+	local, err := LoadFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := local.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Backup{}, "CreatedAt")); diff != "" {
+		t.Errorf("loaded data mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(before, readDir(t, dir)); diff != "" {
+		t.Errorf("data directory changed by loading (-before +after):\n%s", diff)
+	}
+
+	if _, err := LoadFileStorage(filepath.Join(dir, "missing")); err == nil {
+		t.Error("got no error loading a missing directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("got %v checking the missing directory; want it still missing", err)
+	}
+}
+
+func TestFileStorageSnapshotCompactsLog(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{SnapshotEvery: 3})
+	routine, work := fillFileStorage(t, fileStorage)
+	want := dumpFileStorage(t, fileStorage, routine.ID, work.ID)
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("expected a snapshot to be written: %v", err)
+	}
+
+	if fileStorage.walRecords >= 3 {
+		t.Errorf("got %d records on the log; want less than 3 after compaction", fileStorage.walRecords)
+	}
+
+	if err := fileStorage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("got log with %d bytes after Close; want it empty", info.Size())
+	}
+
+	reopened := newTestFileStorage(t, dir, FileStorageOptions{SnapshotEvery: 3})
+	defer reopened.Close()
+
+	got := dumpFileStorage(t, reopened, routine.ID, work.ID)
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess)); diff != "" {
+		t.Errorf("reopened FileStorage mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileStorageDiscardsTornWrite(t *testing.T) {
+	type Test struct {
+		name    string
+		corrupt func(t *testing.T, walPath string)
+	}
+
+	tests := []Test{
+		{
+			name: "PartialHeader",
+			corrupt: func(t *testing.T, walPath string) {
+				appendBytes(t, walPath, []byte{0x10, 0x00})
+			},
+		},
+		{
+			name: "PartialPayload",
+			corrupt: func(t *testing.T, walPath string) {
+				appendBytes(t, walPath, []byte{0x40, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, '{', '"'})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+			todoList, err := fileStorage.InsertTodoList(ctx, TodoList{Title: "Routine"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := dumpFileStorage(t, fileStorage, todoList.ID)
+
+			lastTodo, err := fileStorage.InsertTodo(ctx, Todo{ListID: todoList.ID, Description: "Torn"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileStorage.wal.Close()
+
+			walPath := filepath.Join(dir, walFileName)
+			// Lose the last record completely and leave garbage in its place
+			truncateLastRecord(t, walPath)
+			test.corrupt(t, walPath)
+
+			reopened := newTestFileStorage(t, dir, FileStorageOptions{})
+			defer reopened.Close()
+
+			got := dumpFileStorage(t, reopened, todoList.ID)
+			if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess)); diff != "" {
+				t.Errorf("recovered FileStorage mismatch (-want +got):\n%s", diff)
+			}
+
+			// The log must accept new records right after the last valid one
+			newTodo, err := reopened.InsertTodo(ctx, Todo{ListID: todoList.ID, Description: "After crash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if newTodo.ID != lastTodo.ID {
+				t.Errorf("got todo ID %d; want %d reused after torn write", newTodo.ID, lastTodo.ID)
+			}
+			reopened.wal.Close()
+
+			final := newTestFileStorage(t, dir, FileStorageOptions{})
+			defer final.Close()
+
+			if _, err := final.GetTodoByID(ctx, newTodo.ID); err != nil {
+				t.Errorf("todo written after recovery is lost: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStorageRefusesCorruptedLog(t *testing.T) {
+	type Test struct {
+		name string
+		// corrupt changes the record of data at offset, which is followed
+		// by other records unless it is the last one
+		corrupt func(data []byte, offset int64)
+		last    bool
+	}
+
+	tests := []Test{
+		{
+			name: "ChecksumMismatch",
+			corrupt: func(data []byte, offset int64) {
+				data[offset+walHeaderSize+1] ^= 0xff
+			},
+		},
+		{
+			name: "ChecksumMismatchOnLastRecord",
+			corrupt: func(data []byte, offset int64) {
+				data[len(data)-2] ^= 0xff
+			},
+			last: true,
+		},
+		{
+			name: "LengthTooBig",
+			corrupt: func(data []byte, offset int64) {
+				binary.LittleEndian.PutUint32(data[offset:], walMaxRecordSize+1)
+			},
+		},
+		{
+			name: "InvalidPayload",
+			corrupt: func(data []byte, offset int64) {
+				length := binary.LittleEndian.Uint32(data[offset:])
+				payload := data[offset+walHeaderSize : offset+walHeaderSize+int64(length)]
+				payload[0] = '['
+				binary.LittleEndian.PutUint32(data[offset+4:], crc32.Checksum(payload, crcTable))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			walPath := filepath.Join(dir, walFileName)
+
+			fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+			for _, title := range []string{"Routine", "Work", "Groceries"} {
+				if _, err := fileStorage.InsertTodoList(ctx, TodoList{Title: title}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fileStorage.wal.Close()
+
+			offsets := walRecordOffsets(t, walPath)
+			offset := offsets[1]
+			if test.last {
+				offset = offsets[len(offsets)-1]
+			}
+			data, err := ioutil.ReadFile(walPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.corrupt(data, offset)
+			if err := ioutil.WriteFile(walPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = NewFileStorage(dir, FileStorageOptions{})
+			if !errors.Is(err, ErrCorruptedStorage) {
+				t.Errorf("got error %v opening; want %v", err, ErrCorruptedStorage)
+			}
+			_, err = LoadFileStorage(dir)
+			if !errors.Is(err, ErrCorruptedStorage) {
+				t.Errorf("got error %v loading; want %v", err, ErrCorruptedStorage)
+			}
+
+			// Nothing is cut from the log, so it can still be repaired
+			got, err := ioutil.ReadFile(walPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, got) {
+				t.Errorf("got log of %d bytes after refusing it; want it left as the %d bytes it was", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestFileStorageSkipsRecordsAlreadyOnSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, walFileName)
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+	routine, work := fillFileStorage(t, fileStorage)
+	want := dumpFileStorage(t, fileStorage, routine.ID, work.ID)
+
+	walData, err := ioutil.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash after the snapshot was renamed but before the log was truncated
+	if err := fileStorage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(walPath, walData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotFileName+".tmp"), []byte("{incomplete"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newTestFileStorage(t, dir, FileStorageOptions{})
+	defer reopened.Close()
+
+	got := dumpFileStorage(t, reopened, routine.ID, work.ID)
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess)); diff != "" {
+		t.Errorf("reopened FileStorage mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("expected incomplete snapshot to be removed, got %v", err)
+	}
+}
+
+func TestFileStorageCorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotFileName), []byte("{notvalidjson]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewFileStorage(dir, FileStorageOptions{})
+	if !errors.Is(err, ErrCorruptedStorage) {
+		t.Errorf("got error %v; want %v", err, ErrCorruptedStorage)
+	}
+}
+
+func TestFileStorageStrictLabels(t *testing.T) {
+	dir := t.TempDir()
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+	routine, err := fileStorage.InsertTodoList(ctx, TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fileStorage.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"home"}}); err != nil {
+		t.Fatal(err)
+	}
+	fileStorage.wal.Close()
+
+	// Records written before strict labels were on still replay
+	strict := newTestFileStorage(t, dir, FileStorageOptions{StrictLabels: true})
+	defer strict.Close()
+
+	_, err = strict.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Call the bank", Labels: []string{"home"}})
+	if !errors.Is(err, ErrUnknownLabel) {
+		t.Errorf("got error %v; want %v", err, ErrUnknownLabel)
+	}
+}
+
+func TestFileStorageMigratesLegacyComments(t *testing.T) {
+	dir := t.TempDir()
+	day := func(n int) time.Time { return time.Date(2021, 2, n, 0, 0, 0, 0, time.UTC) }
+
+	// Version 1 kept comments as a text field of each todo
+	snapshot, err := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"seq":     1,
+		"state": map[string]interface{}{
+			"TodoListAutoincrement": 1,
+			"TodoAutoincrement":     2,
+			"TodoListTable":         map[string]interface{}{"0": TodoList{ID: 0, Title: "Routine", Version: 1}},
+			"TodoTable": map[string]interface{}{
+				"0": map[string]interface{}{"ID": 0, "Description": "Make the bed", "Comments": "It was hard", "Version": 1},
+			},
+			"TodoListRelationship": map[string][]uint32{"0": {0}},
+			"TodoTrash": map[string]interface{}{
+				"1": map[string]interface{}{
+					"Todo":      map[string]interface{}{"ID": 1, "Description": "Sweep the floor", "Comments": "Dusty", "Version": 1, "UpdatedAt": day(1)},
+					"DeletedAt": day(1),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotFileName), snapshot, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	walPath := filepath.Join(dir, walFileName)
+	if err := ioutil.WriteFile(walPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	appendLegacyRecord(t, walPath, 2, opInsertTodo, day(2), `{"ID": 2, "Description": "Call the bank", "Comments": "Ask for Bob"}`)
+	appendLegacyRecord(t, walPath, 3, opUpdateTodo, day(3), `{"ID": 0, "Description": "Make the bed", "Comments": "It was easy"}`)
+
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+	if _, err := fileStorage.RestoreTodo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each todo gets its last comments as its first comment, dated as the
+	// todo was last changed
+	want := map[uint32][]Comment{
+		0: {{ID: 0, TodoID: 0, Body: "It was easy", Version: 1, CreatedAt: day(3), UpdatedAt: day(3)}},
+		1: {{ID: 1, TodoID: 1, Body: "Dusty", Version: 1, CreatedAt: day(1), UpdatedAt: day(1)}},
+		2: {{ID: 2, TodoID: 2, Body: "Ask for Bob", Version: 1, CreatedAt: day(2), UpdatedAt: day(2)}},
+	}
+	assertAllComments(t, fileStorage, want)
+
+	hits, err := fileStorage.Search(ctx, SearchQuery{Text: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Todo == nil || hits[0].Todo.ID != 2 {
+		t.Errorf("got hits %+v searching migrated comments; want todo 2", hits)
+	}
+
+	// The migration is written right away, so it never runs twice
+	fileStorage.wal.Close()
+	reopened := newTestFileStorage(t, dir, FileStorageOptions{})
+	defer reopened.Close()
+	assertAllComments(t, reopened, want)
+}
+
+func TestFileStorageRefusesWritesAfterClose(t *testing.T) {
+	fileStorage := newTestFileStorage(t, t.TempDir(), FileStorageOptions{})
+	if err := fileStorage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fileStorage.InsertTodoList(ctx, TodoList{Title: "Routine"}); err == nil {
+		t.Error("expected an error inserting on a closed FileStorage")
+	}
+}
+
+type fileStorageDump struct {
+	TodoLists []TodoList
+	Todos     map[uint32][]Todo
+	Trash     *Trash
+	// History of every todo list and todo above
+	TodoListHistory map[uint32][]HistoryEntry
+	TodoHistory     map[uint32][]HistoryEntry
+	// Blockers of every todo above
+	Blockers map[uint32][]Todo
+	Labels   []Label
+	// Comments of every todo above
+	Comments map[uint32][]Comment
+	// Attachments of every todo above, and the hashes of all of them
+	Attachments      map[uint32][]Attachment
+	AttachmentHashes []string
+	Users            []User
+	// Tokens of every user above
+	Tokens map[string][]Token
+	// Hits of a search matching most todo lists and todos
+	Hits []SearchHit
+}
+
+func TestFileStorageKeepsRestore(t *testing.T) {
+	source := newTestFileStorage(t, t.TempDir(), FileStorageOptions{})
+	defer source.Close()
+	routine, work := fillFileStorage(t, source)
+	backup, err := source.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dumpFileStorage(t, source, routine.ID, work.ID)
+
+	dir := t.TempDir()
+	fileStorage := newTestFileStorage(t, dir, FileStorageOptions{})
+	if _, err := fileStorage.InsertTodoList(ctx, TodoList{Title: "Replaced"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileStorage.Restore(ctx, *backup, RestoreReplace); err != nil {
+		t.Fatal(err)
+	}
+
+	// No Close, so the restore only survives if it was written right away
+	fileStorage.wal.Close()
+
+	reopened := newTestFileStorage(t, dir, FileStorageOptions{})
+	defer reopened.Close()
+
+	got := dumpFileStorage(t, reopened, routine.ID, work.ID)
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess)); diff != "" {
+		t.Errorf("reopened FileStorage mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func newTestFileStorage(t *testing.T, dir string, opts FileStorageOptions) *FileStorage {
+	t.Helper()
+
+	fileStorage, err := NewFileStorage(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileStorage
+}
+
+// fillFileStorage runs every kind of mutation against the storage.
+func fillFileStorage(t *testing.T, fs *FileStorage) (*TodoList, *TodoList) {
+	t.Helper()
+
+	routine, err := fs.InsertTodoList(ctx, TodoList{Title: "Rot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routine.Title = "Routine"
+	if err := fs.UpdateTodoList(WithActor(ctx, "alice"), *routine); err != nil {
+		t.Fatal(err)
+	}
+
+	work, err := fs.InsertTodoList(WithActor(ctx, "alice"), TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bed, err := fs.InsertTodo(ctx, Todo{
+		ListID:      routine.ID,
+		Description: "Make the bed",
+		DueDate:     time.Date(2021, 2, 4, 0, 0, 0, 0, time.UTC),
+		Labels:      []string{"bed", "bedroom"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bed.Done = true
+	if err := fs.UpdateTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+
+	floor, err := fs.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Sweep the floor", ParentID: &bed.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Mop the floor", ParentID: &floor.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteTodo(ctx, *floor); err != nil {
+		t.Fatal(err)
+	}
+	floor, err = fs.RestoreTodo(ctx, floor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteTodo(ctx, *floor); err != nil {
+		t.Fatal(err)
+	}
+
+	plants, err := fs.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Water the plants"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteTodo(ctx, *plants); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PurgeTodo(ctx, plants.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	dishes, err := fs.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Wash the dishes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	longAgo := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := fs.DeleteTodo(fixedClock(ctx, longAgo), *dishes); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.PurgeTrash(ctx, longAgo.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := fs.InsertTodo(ctx, Todo{ListID: work.ID, Description: "Write report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := fs.InsertTodo(ctx, Todo{ListID: routine.ID, Description: "Review code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.MoveTodo(ctx, review.ID, MoveTodoOptions{ListID: work.ID, BeforeID: &report.ID}); err != nil {
+		t.Fatal(err)
+	}
+	for _, blockerID := range []uint32{review.ID, bed.ID} {
+		if err := fs.AddDependency(ctx, report.ID, blockerID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.RemoveDependency(ctx, report.ID, bed.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Replaying must not refuse what was forced
+	report.Done = true
+	report.Version = 0
+	if err := fs.UpdateTodo(WithForce(ctx), *report); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completing a recurring todo inserts its next occurrence
+	invoice, err := fs.InsertTodo(ctx, Todo{
+		ListID:      work.ID,
+		Description: "Send the invoice",
+		DueDate:     time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC),
+		Recurrence:  &Recurrence{Frequency: Monthly, Interval: 1, ByMonthDay: []int{-1}, Count: 6},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice.Done = true
+	if err := fs.UpdateTodo(ctx, *invoice); err != nil {
+		t.Fatal(err)
+	}
+
+	temporary, err := fs.InsertTodoList(ctx, TodoList{Title: "Temporary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.InsertTodo(ctx, Todo{ListID: temporary.ID, Description: "Move me"}); err != nil {
+		t.Fatal(err)
+	}
+	opts := DeleteTodoListOptions{Policy: DeleteMove, TargetListID: work.ID}
+	if err := fs.DeleteTodoListByID(ctx, temporary.ID, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.RestoreTodoList(ctx, temporary.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteTodoListByID(ctx, temporary.ID, DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PurgeTodoList(ctx, temporary.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"bed", "office", "urgent"} {
+		if _, err := fs.InsertLabel(ctx, Label{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.UpdateLabel(ctx, Label{Name: "bed", Color: "#0000ff", Description: "Bedroom chores"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.RenameLabel(ctx, "bed", "bedding"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteLabel(ctx, "urgent"); err != nil {
+		t.Fatal(err)
+	}
+
+	hard, err := fs.InsertComment(WithActor(ctx, "alice"), Comment{TodoID: bed.ID, Body: "It was hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	harder, err := fs.InsertComment(ctx, Comment{TodoID: bed.ID, ParentID: &hard.ID, Author: "bob", Body: "Try harder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.InsertComment(ctx, Comment{TodoID: bed.ID, Body: "Change the sheets"}); err != nil {
+		t.Fatal(err)
+	}
+	harder.Body = "Try harder next time"
+	if err := fs.UpdateComment(ctx, *harder); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteComment(ctx, *hard); err != nil {
+		t.Fatal(err)
+	}
+
+	screenshot, err := fs.InsertAttachment(ctx, Attachment{TodoID: bed.ID, Name: "bed.png", ContentType: "image/png", Size: 2048, Hash: strings.Repeat("a", 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.InsertAttachment(ctx, Attachment{TodoID: bed.ID, Name: "sheets.pdf", ContentType: "application/pdf", Size: 4096, Hash: strings.Repeat("b", 64)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteAttachment(ctx, screenshot.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []User{{Name: "alice", DisplayName: "Alice"}, {Name: "bob"}, {Name: "carol"}} {
+		if _, err := fs.InsertUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, member := range []Member{{User: "bob", Role: RoleEditor}, {User: "carol", Role: RoleViewer}} {
+		if _, err := fs.ShareTodoList(WithActor(ctx, "alice"), work.ID, member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fs.UnshareTodoList(ctx, work.ID, "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.SetFeedToken(ctx, work.ID, HashToken("feed")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"laptop", "phone"} {
+		token := Token{User: "alice", Name: secret, Hash: HashToken(secret), Scopes: []Scope{ScopeRead}}
+		if _, err := fs.InsertToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.DeleteToken(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return routine, work
+}
+
+func dumpFileStorage(t *testing.T, fs *FileStorage, listIDs ...uint32) fileStorageDump {
+	t.Helper()
+
+	todoLists, err := fs.GetAllTodoLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := fs.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := fs.GetAllLabels(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := fs.Search(ctx, SearchQuery{Text: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := fs.GetAttachmentHashes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := fs.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := fileStorageDump{
+		Labels:           labels,
+		Hits:             hits,
+		TodoLists:        todoLists,
+		Todos:            map[uint32][]Todo{},
+		Trash:            trash,
+		TodoListHistory:  map[uint32][]HistoryEntry{},
+		TodoHistory:      map[uint32][]HistoryEntry{},
+		Blockers:         map[uint32][]Todo{},
+		Comments:         map[uint32][]Comment{},
+		Attachments:      map[uint32][]Attachment{},
+		AttachmentHashes: hashes,
+		Users:            users,
+		Tokens:           map[string][]Token{},
+	}
+	for _, user := range users {
+		if dump.Tokens[user.Name], err = fs.GetTokens(ctx, user.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, listID := range listIDs {
+		todos, err := fs.GetTodosByListID(ctx, listID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump.Todos[listID] = todos
+
+		if dump.TodoListHistory[listID], err = fs.GetTodoListHistory(ctx, listID); err != nil {
+			t.Fatal(err)
+		}
+		for _, todo := range todos {
+			if dump.TodoHistory[todo.ID], err = fs.GetTodoHistory(ctx, todo.ID); err != nil {
+				t.Fatal(err)
+			}
+			if dump.Blockers[todo.ID], err = fs.GetBlockers(ctx, todo.ID); err != nil {
+				t.Fatal(err)
+			}
+			if dump.Comments[todo.ID], err = fs.GetComments(ctx, todo.ID); err != nil {
+				t.Fatal(err)
+			}
+			if dump.Attachments[todo.ID], err = fs.GetAttachments(ctx, todo.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dump
+}
+
+func assertAllComments(t *testing.T, fs *FileStorage, want map[uint32][]Comment) {
+	t.Helper()
+
+	got := map[uint32][]Comment{}
+	for todoID := range want {
+		comments, err := fs.GetComments(ctx, todoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[todoID] = comments
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("comments mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// appendLegacyRecord writes a log record as an older version would, with
+// data given as JSON.
+func appendLegacyRecord(t *testing.T, walPath string, seq uint64, op string, at time.Time, data string) {
+	t.Helper()
+
+	payload, err := json.Marshal(walRecord{Seq: seq, Op: op, At: at, Data: json.RawMessage(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, walHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+	appendBytes(t, walPath, append(header, payload...))
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readDir returns the content of every file on dir by name.
+func readDir(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, info := range infos {
+		if files[info.Name()], err = ioutil.ReadFile(filepath.Join(dir, info.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// walRecordOffsets returns where each record on the log starts.
+func walRecordOffsets(t *testing.T, walPath string) []int64 {
+	t.Helper()
+
+	f, err := os.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var offsets []int64
+	var offset int64
+	for {
+		_, size, err := readWALRecord(f)
+		if err == io.EOF {
+			return offsets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, offset)
+		offset += size
+	}
+}
+
+func truncateLastRecord(t *testing.T, walPath string) {
+	t.Helper()
+
+	f, err := os.Open(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offset, last int64
+	for {
+		_, size, err := readWALRecord(f)
+		if err != nil {
+			break
+		}
+		last = offset
+		offset += size
+	}
+	f.Close()
+
+	if err := os.Truncate(walPath, last); err != nil {
+		t.Fatal(err)
+	}
+}
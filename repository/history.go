@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryAction is the kind of mutation recorded on a HistoryEntry.
+type HistoryAction string
+
+const (
+	ActionCreate  HistoryAction = "create"
+	ActionUpdate  HistoryAction = "update"
+	ActionDelete  HistoryAction = "delete"
+	ActionRestore HistoryAction = "restore"
+)
+
+// FieldChange is the value of a field before and after a mutation, both
+// formatted as text. Old is empty on creation.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// HistoryEntry records a single mutation of a todo list or todo.
+type HistoryEntry struct {
+	At time.Time
+	// Actor is who made the change, empty when unknown.
+	Actor   string
+	Action  HistoryAction
+	Changes []FieldChange
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx where mutations are recorded on the
+// history as made by actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+func newHistoryEntry(ctx context.Context, action HistoryAction, changes []FieldChange) HistoryEntry {
+	return HistoryEntry{
+		At:      now(ctx),
+		Actor:   ActorFromContext(ctx),
+		Action:  action,
+		Changes: changes,
+	}
+}
+
+// fieldValue is a field of a todo list or todo formatted as text, named as
+// on the API.
+type fieldValue struct {
+	field string
+	value string
+}
+
+func todoListFieldValues(todoList TodoList) []fieldValue {
+	return []fieldValue{
+		{"title", todoList.Title},
+		{"owner", todoList.Owner},
+		{"members", formatMembers(todoList.Members)},
+	}
+}
+
+func todoFieldValues(todo Todo) []fieldValue {
+	dueDate := ""
+	if !todo.DueDate.IsZero() {
+		dueDate = todo.DueDate.UTC().Format(time.RFC3339)
+	}
+
+	parentID := ""
+	if todo.ParentID != nil {
+		parentID = strconv.FormatUint(uint64(*todo.ParentID), 10)
+	}
+
+	recurrence := ""
+	if todo.Recurrence != nil {
+		recurrence = todo.Recurrence.String()
+	}
+
+	return []fieldValue{
+		{"list_id", strconv.FormatUint(uint64(todo.ListID), 10)},
+		{"parent_id", parentID},
+		{"description", todo.Description},
+		{"due_date", dueDate},
+		{"labels", strings.Join(todo.Labels, ",")},
+		{"done", strconv.FormatBool(todo.Done)},
+		{"recurrence", recurrence},
+	}
+}
+
+// diffFields returns the fields whose value changed from old to new. A nil
+// old stands for a record being created, so every field set on new is
+// returned.
+func diffFields(old, new []fieldValue) []FieldChange {
+	changes := []FieldChange{}
+	for i, n := range new {
+		o := ""
+		if old != nil {
+			o = old[i].value
+		}
+		if o != n.value {
+			changes = append(changes, FieldChange{Field: n.field, Old: o, New: n.value})
+		}
+	}
+	return changes
+}
+
+func cloneHistory(history []HistoryEntry) []HistoryEntry {
+	cloned := make([]HistoryEntry, 0, len(history))
+	for _, entry := range history {
+		entry.Changes = append([]FieldChange{}, entry.Changes...)
+		cloned = append(cloned, entry)
+	}
+	return cloned
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (ls *LocalStorage) InsertLabel(ctx context.Context, label Label) (*Label, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if err := validateLabel(label); err != nil {
+		return nil, err
+	}
+	if _, ok := ls.Labels[label.Name]; ok {
+		return nil, ErrLabelExists
+	}
+
+	label.Version = 1
+	label.CreatedAt = now(ctx)
+	label.UpdatedAt = label.CreatedAt
+	label.TodoCount = 0
+	ls.Labels[label.Name] = label
+	label.TodoCount = ls.countTodos(label.Name)
+	return &label, nil
+}
+
+func (ls *LocalStorage) GetAllLabels(ctx context.Context) ([]Label, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	result := []Label{}
+	for _, label := range ls.Labels {
+		label.TodoCount = ls.countTodos(label.Name)
+		result = append(result, label)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (ls *LocalStorage) GetLabel(ctx context.Context, name string) (*Label, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	label, ok := ls.Labels[name]
+	if !ok {
+		return nil, ErrLabelNotFound
+	}
+
+	label.TodoCount = ls.countTodos(label.Name)
+	return &label, nil
+}
+
+func (ls *LocalStorage) UpdateLabel(ctx context.Context, label Label) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.Labels[label.Name]
+	if !ok {
+		return ErrLabelNotFound
+	}
+
+	if label.Version != 0 && label.Version != stored.Version {
+		return ErrConflict
+	}
+
+	if err := validateLabel(label); err != nil {
+		return err
+	}
+
+	label.Version = stored.Version + 1
+	label.CreatedAt = stored.CreatedAt
+	label.UpdatedAt = now(ctx)
+	label.TodoCount = 0
+	ls.Labels[label.Name] = label
+	return nil
+}
+
+// RenameLabel changes the name of a label on the registry and on every todo
+// having it, including the ones on the trash.
+func (ls *LocalStorage) RenameLabel(ctx context.Context, name, newName string) (*Label, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	label, ok := ls.Labels[name]
+	if !ok {
+		return nil, ErrLabelNotFound
+	}
+
+	if err := validateLabel(Label{Name: newName, Color: label.Color}); err != nil {
+		return nil, err
+	}
+	if newName == name {
+		label.TodoCount = ls.countTodos(label.Name)
+		return &label, nil
+	}
+	if _, ok := ls.Labels[newName]; ok {
+		return nil, ErrLabelExists
+	}
+
+	delete(ls.Labels, name)
+	label.Name = newName
+	label.Version++
+	label.UpdatedAt = now(ctx)
+	ls.Labels[newName] = label
+	ls.replaceLabel(ctx, name, newName)
+
+	label.TodoCount = ls.countTodos(label.Name)
+	return &label, nil
+}
+
+// DeleteLabel removes a label from the registry and from every todo having
+// it, including the ones on the trash.
+func (ls *LocalStorage) DeleteLabel(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.Labels[name]; !ok {
+		return ErrLabelNotFound
+	}
+
+	delete(ls.Labels, name)
+	ls.replaceLabel(ctx, name, "")
+	return nil
+}
+
+func validateLabel(label Label) error {
+	if label.Name == "" || strings.ContainsAny(label.Name, ",/") {
+		return ErrInvalidLabel
+	}
+	if label.Color != "" && !colorPattern.MatchString(label.Color) {
+		return ErrInvalidLabel
+	}
+	return nil
+}
+
+// checkLabels returns ErrUnknownLabel when strict labels are on and a todo
+// has a label missing from the registry. Must be called with ls.mu held.
+func (ls *LocalStorage) checkLabels(todo Todo) error {
+	if !ls.StrictLabels {
+		return nil
+	}
+	for _, name := range todo.Labels {
+		if _, ok := ls.Labels[name]; !ok {
+			return ErrUnknownLabel
+		}
+	}
+	return nil
+}
+
+// countTodos returns how many active todos have a label. Must be called
+// with ls.mu held.
+func (ls *LocalStorage) countTodos(name string) int {
+	count := 0
+	for _, todo := range ls.TodoTable {
+		if hasLabel(todo, name) {
+			count++
+		}
+	}
+	return count
+}
+
+// replaceLabel swaps a label for newName on every todo having it, or drops
+// it when newName is empty. Each changed todo gets a new version and a
+// history entry. Must be called with ls.mu held.
+func (ls *LocalStorage) replaceLabel(ctx context.Context, name, newName string) {
+	relabel := func(todo Todo) (Todo, bool) {
+		if !hasLabel(todo, name) {
+			return todo, false
+		}
+
+		labels := []string{}
+		seen := map[string]bool{}
+		for _, label := range todo.Labels {
+			if label == name {
+				label = newName
+			}
+			if label == "" || seen[label] {
+				continue
+			}
+			seen[label] = true
+			labels = append(labels, label)
+		}
+
+		relabeled := cloneTodo(todo)
+		relabeled.Labels = labels
+		relabeled.Version++
+		relabeled.UpdatedAt = now(ctx)
+		return relabeled, true
+	}
+
+	for id, todo := range ls.TodoTable {
+		if relabeled, ok := relabel(todo); ok {
+			ls.TodoTable[id] = relabeled
+			ls.recordTodo(ctx, id, ActionUpdate, diffFields(todoFieldValues(todo), todoFieldValues(relabeled)))
+		}
+	}
+	for id, trashed := range ls.TodoTrash {
+		if relabeled, ok := relabel(trashed.Todo); ok {
+			stored := trashed.Todo
+			trashed.Todo = relabeled
+			ls.TodoTrash[id] = trashed
+			ls.recordTodo(ctx, id, ActionUpdate, diffFields(todoFieldValues(stored), todoFieldValues(relabeled)))
+		}
+	}
+}
@@ -1,12 +1,55 @@
 package repository
 
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LocalStorage is an in-memory Repository. It is safe for concurrent use:
+// reads share a read lock and can run in parallel, while every mutation
+// holds the write lock for its whole duration so it is applied atomically.
 type LocalStorage struct {
+	mu sync.RWMutex
+
 	TodoListAutoincrement uint32
 	TodoAutoincrement     uint32
 	TodoListTable         map[uint32]TodoList
 	TodoTable             map[uint32]Todo
 	// This relationship maps each TodoList ID to the respective list of Todo ID's
 	TodoListRelationship map[uint32][]uint32
+	// Deleted todo lists and todos are kept here until restored or purged
+	TodoListTrash map[uint32]TrashedTodoList
+	TodoTrash     map[uint32]TrashedTodo
+	// Every mutation of each todo list and todo, oldest first
+	TodoListHistory map[uint32][]HistoryEntry
+	TodoHistory     map[uint32][]HistoryEntry
+	// This maps each Todo ID to the ID's of the todos blocking it, sorted
+	TodoDependencies map[uint32][]uint32
+	// Registered labels by name
+	Labels map[string]Label
+	// Comments by ID, and the ID's of the comments of each todo, oldest first
+	CommentAutoincrement uint32
+	Comments             map[uint32]Comment
+	TodoComments         map[uint32][]uint32
+	// Attachments by ID, and the ID's of the attachments of each todo, oldest
+	// first. Their content is kept apart, on a BlobStore.
+	AttachmentAutoincrement uint32
+	Attachments             map[uint32]Attachment
+	TodoAttachments         map[uint32][]uint32
+	// Users by name
+	Users map[string]User
+	// API tokens of the users by ID
+	TokenAutoincrement uint32
+	Tokens             map[uint32]Token
+	// StrictLabels refuses todos with labels missing from Labels. It is a
+	// setting, so it is not kept together with the data.
+	StrictLabels bool `json:"-"`
+
+	// index is the full-text search index over the tables above
+	index *searchIndex
 }
 
 func NewLocalStorage() *LocalStorage {
@@ -16,65 +59,182 @@ func NewLocalStorage() *LocalStorage {
 		TodoListTable:         map[uint32]TodoList{},
 		TodoTable:             map[uint32]Todo{},
 		TodoListRelationship:  map[uint32][]uint32{},
+		TodoListTrash:         map[uint32]TrashedTodoList{},
+		TodoTrash:             map[uint32]TrashedTodo{},
+		TodoListHistory:       map[uint32][]HistoryEntry{},
+		TodoHistory:           map[uint32][]HistoryEntry{},
+		TodoDependencies:      map[uint32][]uint32{},
+		Labels:                map[string]Label{},
+		Comments:              map[uint32]Comment{},
+		TodoComments:          map[uint32][]uint32{},
+		Attachments:           map[uint32]Attachment{},
+		TodoAttachments:       map[uint32][]uint32{},
+		Users:                 map[string]User{},
+		Tokens:                map[uint32]Token{},
+		index:                 newSearchIndex(),
 	}
 }
 
 // TodoList
 
-func (ls *LocalStorage) InsertTodoList(todoList TodoList) (*TodoList, error) {
+func (ls *LocalStorage) InsertTodoList(ctx context.Context, todoList TodoList) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	if todoList.Title == "" {
 		return nil, ErrEmptyTitle
 	}
 	todoList.ID = ls.TodoListAutoincrement
+	todoList.Owner = ActorFromContext(ctx)
+	todoList.Members = nil
+	todoList.FeedTokenHash = ""
+	todoList.Version = 1
+	todoList.CreatedAt = now(ctx)
+	todoList.UpdatedAt = todoList.CreatedAt
 	ls.TodoListTable[ls.TodoListAutoincrement] = todoList
+	ls.recordTodoList(ctx, todoList.ID, ActionCreate, diffFields(nil, todoListFieldValues(todoList)))
 	ls.TodoListAutoincrement++
+	todoList = cloneTodoList(todoList)
 	return &todoList, nil
 }
 
-func (ls *LocalStorage) GetAllTodoLists() ([]TodoList, error) {
+func (ls *LocalStorage) GetAllTodoLists(ctx context.Context) ([]TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
 	result := []TodoList{}
 	for _, todoList := range ls.TodoListTable {
-		result = append(result, todoList)
+		result = append(result, cloneTodoList(todoList))
 	}
 
 	return result, nil
 }
 
-func (ls *LocalStorage) GetTodoListByID(id uint32) (*TodoList, error) {
+func (ls *LocalStorage) GetTodoListByID(ctx context.Context, id uint32) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
 	todoList, ok := ls.TodoListTable[id]
 	if !ok {
 		return nil, ErrTodoListNotFound
 	}
 
+	todoList = cloneTodoList(todoList)
 	return &todoList, nil
 }
 
-func (ls *LocalStorage) UpdateTodoList(todoList TodoList) error {
-	if _, ok := ls.TodoListTable[todoList.ID]; !ok {
+func (ls *LocalStorage) UpdateTodoList(ctx context.Context, todoList TodoList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoListTable[todoList.ID]
+	if !ok {
 		return ErrTodoListNotFound
 	}
 
+	if todoList.Version != 0 && todoList.Version != stored.Version {
+		return ErrConflict
+	}
+
 	if todoList.Title == "" {
 		return ErrEmptyTitle
 	}
 
+	todoList.Version = stored.Version + 1
+	todoList.CreatedAt = stored.CreatedAt
+	todoList.Owner = stored.Owner
+	todoList.Members = stored.Members
+	todoList.FeedTokenHash = stored.FeedTokenHash
+	todoList.UpdatedAt = now(ctx)
 	ls.TodoListTable[todoList.ID] = todoList
+	ls.recordTodoList(ctx, todoList.ID, ActionUpdate, diffFields(todoListFieldValues(stored), todoListFieldValues(todoList)))
 	return nil
 }
 
-func (ls *LocalStorage) DeleteTodoListByID(id uint32) error {
-	if _, ok := ls.TodoListTable[id]; !ok {
+func (ls *LocalStorage) DeleteTodoListByID(ctx context.Context, id uint32, opts DeleteTodoListOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	todoList, ok := ls.TodoListTable[id]
+	if !ok {
 		return ErrTodoListNotFound
 	}
 
+	if opts.Version != 0 && opts.Version != todoList.Version {
+		return ErrConflict
+	}
+
+	todoIDs := ls.TodoListRelationship[id]
+	deletedAt := now(ctx)
+	trashed := TrashedTodoList{TodoList: todoList, DeletedAt: deletedAt}
+
+	switch opts.Policy {
+	case DeleteCascade:
+		for _, todoID := range todoIDs {
+			ls.TodoTrash[todoID] = TrashedTodo{Todo: ls.TodoTable[todoID], DeletedAt: deletedAt}
+			delete(ls.TodoTable, todoID)
+			ls.recordTodo(ctx, todoID, ActionDelete, nil)
+		}
+		trashed.TodoIDs = append([]uint32{}, todoIDs...)
+	case DeleteRestrict:
+		if len(todoIDs) > 0 {
+			return ErrTodoListNotEmpty
+		}
+	case DeleteMove:
+		if _, ok := ls.TodoListTable[opts.TargetListID]; !ok || opts.TargetListID == id {
+			return ErrInvalidTarget
+		}
+		for _, todoID := range todoIDs {
+			stored := ls.TodoTable[todoID]
+			todo := stored
+			todo.ListID = opts.TargetListID
+			todo.Version++
+			todo.UpdatedAt = deletedAt
+			ls.TodoTable[todoID] = todo
+			ls.recordTodo(ctx, todoID, ActionUpdate, diffFields(todoFieldValues(stored), todoFieldValues(todo)))
+		}
+		ls.setTodoIDs(opts.TargetListID, append(ls.TodoListRelationship[opts.TargetListID], todoIDs...))
+	default:
+		return ErrInvalidPolicy
+	}
+
+	ls.TodoListTrash[id] = trashed
 	delete(ls.TodoListTable, id)
+	ls.recordTodoList(ctx, id, ActionDelete, nil)
 	delete(ls.TodoListRelationship, id)
 	return nil
 }
 
 // Todo
 
-func (ls *LocalStorage) InsertTodo(todo Todo) (*Todo, error) {
+func (ls *LocalStorage) InsertTodo(ctx context.Context, todo Todo) (*Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
 	if _, ok := ls.TodoListTable[todo.ListID]; !ok {
 		return nil, ErrTodoListNotFound
 	}
@@ -84,22 +244,49 @@ func (ls *LocalStorage) InsertTodo(todo Todo) (*Todo, error) {
 	}
 
 	todo.ID = ls.TodoAutoincrement
-	ls.TodoListRelationship[todo.ListID] = append(ls.TodoListRelationship[todo.ListID], todo.ID)
-	ls.TodoTable[ls.TodoAutoincrement] = todo
-	ls.TodoAutoincrement++
+	if err := ls.checkParent(todo); err != nil {
+		return nil, err
+	}
+
+	if todo.Recurrence != nil {
+		if err := todo.Recurrence.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ls.checkLabels(todo); err != nil {
+		return nil, err
+	}
+
+	todo = ls.insertTodo(ctx, todo)
 	return &todo, nil
 }
 
-func (ls *LocalStorage) GetTodoByID(id uint32) (*Todo, error) {
+func (ls *LocalStorage) GetTodoByID(ctx context.Context, id uint32) (*Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
 	todo, ok := ls.TodoTable[id]
 	if !ok {
 		return nil, ErrTodoNotFound
 	}
 
+	todo = cloneTodo(todo)
 	return &todo, nil
 }
 
-func (ls *LocalStorage) GetTodosByListID(listID uint32) ([]Todo, error) {
+func (ls *LocalStorage) GetTodosByListID(ctx context.Context, listID uint32) ([]Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
 	if _, ok := ls.TodoListTable[listID]; !ok {
 		return nil, ErrTodoListNotFound
 	}
@@ -112,48 +299,694 @@ func (ls *LocalStorage) GetTodosByListID(listID uint32) ([]Todo, error) {
 
 	for _, id := range todoIDs {
 		todo := ls.TodoTable[id]
-		todos = append(todos, todo)
+		todos = append(todos, cloneTodo(todo))
 	}
 
 	return todos, nil
 }
 
-func (ls *LocalStorage) UpdateTodo(todo Todo) error {
-	if _, ok := ls.TodoTable[todo.ID]; !ok {
+func (ls *LocalStorage) QueryTodos(ctx context.Context, query TodoQuery) (*TodoPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	var after *Todo
+	if query.Cursor != "" {
+		cursor, err := query.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		after = &cursor
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	todos := []Todo{}
+	add := func(todo Todo) {
+		if !query.matches(todo, ls.commentBodies(todo.ID)) {
+			return
+		}
+		if query.Unblocked && ls.blocked(todo.ID) {
+			return
+		}
+		if after != nil && query.compare(todo, *after) <= 0 {
+			return
+		}
+		todos = append(todos, cloneTodo(todo))
+	}
+
+	if len(query.ListIDs) == 0 {
+		for _, todo := range ls.TodoTable {
+			add(todo)
+		}
+	} else {
+		for _, listID := range query.ListIDs {
+			if _, ok := ls.TodoListTable[listID]; !ok {
+				return nil, ErrTodoListNotFound
+			}
+		}
+		seen := map[uint32]bool{}
+		for _, listID := range query.ListIDs {
+			if seen[listID] {
+				continue
+			}
+			seen[listID] = true
+			for _, id := range ls.TodoListRelationship[listID] {
+				add(ls.TodoTable[id])
+			}
+		}
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		return query.compare(todos[i], todos[j]) < 0
+	})
+
+	page := &TodoPage{Todos: todos}
+	if query.Limit > 0 && len(todos) > query.Limit {
+		page.Todos = todos[:query.Limit]
+		page.NextCursor = query.encodeCursor(page.Todos[query.Limit-1])
+	}
+
+	return page, nil
+}
+
+func (ls *LocalStorage) UpdateTodo(ctx context.Context, todo Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoTable[todo.ID]
+	if !ok {
 		return ErrTodoNotFound
 	}
 
+	if todo.Version != 0 && todo.Version != stored.Version {
+		return ErrConflict
+	}
+
 	if todo.Description == "" {
 		return ErrEmptyDescription
 	}
 
-	ls.TodoTable[todo.ID] = todo
+	if _, ok := ls.TodoListTable[todo.ListID]; !ok {
+		return ErrTodoListNotFound
+	}
+
+	if err := ls.checkParent(todo); err != nil {
+		return err
+	}
+
+	if todo.Done && !stored.Done && !forced(ctx) && ls.blocked(todo.ID) {
+		return ErrBlocked
+	}
+
+	if todo.Recurrence != nil {
+		if err := todo.Recurrence.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := ls.checkLabels(todo); err != nil {
+		return err
+	}
+
+	todo.Version = stored.Version + 1
+	todo.CreatedAt = stored.CreatedAt
+	todo.UpdatedAt = now(ctx)
+	switch {
+	case !todo.Done:
+		todo.CompletedAt = time.Time{}
+	case !stored.Done:
+		todo.CompletedAt = todo.UpdatedAt
+	default:
+		todo.CompletedAt = stored.CompletedAt
+	}
+	todo.Position = stored.Position
+	// The rule of a recurring todo moves over to its next occurrence, so
+	// undoing and redoing it doesn't repeat it twice
+	next, recurs := Todo{}, false
+	if todo.Done && !stored.Done {
+		next, recurs = nextOccurrence(todo, todo.CompletedAt)
+		todo.Recurrence = nil
+	}
+	ls.TodoTable[todo.ID] = cloneTodo(todo)
+	// A todo changing lists goes to the end of its new todo list, followed by
+	// its subtasks
+	if todo.ListID != stored.ListID {
+		subtaskIDs := ls.subtaskIDs(stored)
+		moved := append([]uint32{todo.ID}, subtaskIDs...)
+		ls.carrySubtasks(ctx, subtaskIDs, todo.ListID, todo.UpdatedAt)
+		ls.setTodoIDs(stored.ListID, removeIDs(ls.TodoListRelationship[stored.ListID], moved...))
+		ls.setTodoIDs(todo.ListID, append(ls.TodoListRelationship[todo.ListID], moved...))
+	}
+	ls.recordTodo(ctx, todo.ID, ActionUpdate, diffFields(todoFieldValues(stored), todoFieldValues(todo)))
+	if recurs {
+		ls.insertTodo(ctx, next)
+	}
 	return nil
 }
 
-func (ls *LocalStorage) DeleteTodo(todo Todo) error {
-	if _, ok := ls.TodoTable[todo.ID]; !ok {
+// MoveTodo takes a todo out of its todo list and puts it on opts.ListID,
+// right before opts.BeforeID or at the end. The todos after the old and the
+// new position shift to keep positions contiguous.
+func (ls *LocalStorage) MoveTodo(ctx context.Context, id uint32, opts MoveTodoOptions) (*Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoTable[id]
+	if !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	if opts.Version != 0 && opts.Version != stored.Version {
+		return nil, ErrConflict
+	}
+
+	if _, ok := ls.TodoListTable[opts.ListID]; !ok {
+		return nil, ErrTodoListNotFound
+	}
+
+	targetIDs := removeIDs(ls.TodoListRelationship[opts.ListID], id)
+	index := len(targetIDs)
+	if opts.BeforeID != nil {
+		index = indexOfID(targetIDs, *opts.BeforeID)
+		if index < 0 {
+			return nil, ErrInvalidPosition
+		}
+	}
+
+	// Only a todo changing lists takes its subtasks along, and it leaves its
+	// parent behind
+	moved := []uint32{id}
+	var subtaskIDs []uint32
+	todo := stored
+	if opts.ListID != stored.ListID {
+		subtaskIDs = ls.subtaskIDs(stored)
+		moved = append(moved, subtaskIDs...)
+		todo.ParentID = nil
+	}
+	todo.ListID = opts.ListID
+	todo.Version++
+	todo.UpdatedAt = now(ctx)
+	ls.TodoTable[id] = todo
+
+	if opts.ListID != stored.ListID {
+		ls.carrySubtasks(ctx, subtaskIDs, opts.ListID, todo.UpdatedAt)
+		ls.setTodoIDs(stored.ListID, removeIDs(ls.TodoListRelationship[stored.ListID], moved...))
+	}
+	todoIDs := make([]uint32, 0, len(targetIDs)+len(moved))
+	todoIDs = append(todoIDs, targetIDs[:index]...)
+	todoIDs = append(todoIDs, moved...)
+	todoIDs = append(todoIDs, targetIDs[index:]...)
+	ls.setTodoIDs(opts.ListID, todoIDs)
+
+	todo = cloneTodo(ls.TodoTable[id])
+	changes := diffFields(todoFieldValues(stored), todoFieldValues(todo))
+	if todo.Position != stored.Position {
+		changes = append(changes, FieldChange{
+			Field: "position",
+			Old:   strconv.Itoa(stored.Position),
+			New:   strconv.Itoa(todo.Position),
+		})
+	}
+	ls.recordTodo(ctx, id, ActionUpdate, changes)
+	return &todo, nil
+}
+
+func (ls *LocalStorage) DeleteTodo(ctx context.Context, todo Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoTable[todo.ID]
+	if !ok {
 		return ErrTodoNotFound
 	}
+	if todo.Version != 0 && todo.Version != stored.Version {
+		return ErrConflict
+	}
+	deletedAt := now(ctx)
+	subtaskIDs := ls.subtaskIDs(stored)
+	ls.TodoTrash[todo.ID] = TrashedTodo{Todo: stored, DeletedAt: deletedAt, SubtaskIDs: subtaskIDs}
 	delete(ls.TodoTable, todo.ID)
-	// If there is a relationship between the list, delete from there
-	todoListRelationship, ok := ls.TodoListRelationship[todo.ListID]
-	if ok {
-		newRelationship := removeID(todoListRelationship, todo.ID)
-		if len(newRelationship) > 0 {
-			ls.TodoListRelationship[todo.ListID] = newRelationship
-		} else {
-			delete(ls.TodoListRelationship, todo.ListID)
+	ls.recordTodo(ctx, todo.ID, ActionDelete, nil)
+	for _, subtaskID := range subtaskIDs {
+		ls.TodoTrash[subtaskID] = TrashedTodo{Todo: ls.TodoTable[subtaskID], DeletedAt: deletedAt}
+		delete(ls.TodoTable, subtaskID)
+		ls.recordTodo(ctx, subtaskID, ActionDelete, nil)
+	}
+	deleted := append([]uint32{todo.ID}, subtaskIDs...)
+	ls.setTodoIDs(stored.ListID, removeIDs(ls.TodoListRelationship[stored.ListID], deleted...))
+	return nil
+}
+
+// Trash
+
+func (ls *LocalStorage) GetTrash(ctx context.Context) (*Trash, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	trash := &Trash{
+		TodoLists: []TrashedTodoList{},
+		Todos:     []TrashedTodo{},
+	}
+	for _, trashed := range ls.TodoListTrash {
+		trashed.TodoList = cloneTodoList(trashed.TodoList)
+		trashed.TodoIDs = append([]uint32{}, trashed.TodoIDs...)
+		trash.TodoLists = append(trash.TodoLists, trashed)
+	}
+	for _, trashed := range ls.TodoTrash {
+		trashed.Todo = cloneTodo(trashed.Todo)
+		if trashed.SubtaskIDs != nil {
+			trashed.SubtaskIDs = append([]uint32{}, trashed.SubtaskIDs...)
 		}
+		trash.Todos = append(trash.Todos, trashed)
 	}
 
+	sort.Slice(trash.TodoLists, func(i, j int) bool {
+		x, y := trash.TodoLists[i], trash.TodoLists[j]
+		if !x.DeletedAt.Equal(y.DeletedAt) {
+			return x.DeletedAt.Before(y.DeletedAt)
+		}
+		return x.TodoList.ID < y.TodoList.ID
+	})
+	sort.Slice(trash.Todos, func(i, j int) bool {
+		x, y := trash.Todos[i], trash.Todos[j]
+		if !x.DeletedAt.Equal(y.DeletedAt) {
+			return x.DeletedAt.Before(y.DeletedAt)
+		}
+		return x.Todo.ID < y.Todo.ID
+	})
+
+	return trash, nil
+}
+
+// RestoreTodoList brings back a deleted todo list, together with the todos
+// deleted with it that were not purged since.
+func (ls *LocalStorage) RestoreTodoList(ctx context.Context, id uint32) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	trashed, ok := ls.TodoListTrash[id]
+	if !ok {
+		return nil, ErrNotInTrash
+	}
+
+	restoredAt := now(ctx)
+	todoList := trashed.TodoList
+	todoList.Version++
+	todoList.UpdatedAt = restoredAt
+	ls.TodoListTable[id] = todoList
+
+	ls.restoreTodos(ctx, id, trashed.TodoIDs, restoredAt)
+
+	delete(ls.TodoListTrash, id)
+	ls.recordTodoList(ctx, id, ActionRestore, nil)
+	todoList = cloneTodoList(todoList)
+	return &todoList, nil
+}
+
+// RestoreTodo brings back a deleted todo to the end of its todo list, which
+// must not be deleted, followed by the subtasks deleted with it. A todo whose
+// parent is on the trash can't be restored before it.
+func (ls *LocalStorage) RestoreTodo(ctx context.Context, id uint32) (*Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	trashed, ok := ls.TodoTrash[id]
+	if !ok {
+		return nil, ErrNotInTrash
+	}
+
+	todo := trashed.Todo
+	if _, ok := ls.TodoListTable[todo.ListID]; !ok {
+		return nil, ErrTodoListNotFound
+	}
+
+	if todo.ParentID != nil {
+		if _, ok := ls.TodoTrash[*todo.ParentID]; ok {
+			return nil, ErrInvalidParent
+		}
+	}
+
+	ls.restoreTodos(ctx, todo.ListID, append([]uint32{id}, trashed.SubtaskIDs...), now(ctx))
+
+	todo = cloneTodo(ls.TodoTable[id])
+	return &todo, nil
+}
+
+// PurgeTodoList permanently deletes a todo list from the trash, together
+// with the todos deleted with it.
+func (ls *LocalStorage) PurgeTodoList(ctx context.Context, id uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoListTrash[id]; !ok {
+		return ErrNotInTrash
+	}
+
+	ls.purgeTodoList(id)
 	return nil
 }
 
-func removeID(oldTodoIDs []uint32, todoID uint32) []uint32 {
+func (ls *LocalStorage) PurgeTodo(ctx context.Context, id uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.TodoTrash[id]; !ok {
+		return ErrNotInTrash
+	}
+
+	ls.purgeTodo(id)
+	return nil
+}
+
+func (ls *LocalStorage) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	purged := 0
+	for id, trashed := range ls.TodoListTrash {
+		if trashed.DeletedAt.Before(deletedBefore) {
+			purged += ls.purgeTodoList(id)
+		}
+	}
+	for id, trashed := range ls.TodoTrash {
+		if trashed.DeletedAt.Before(deletedBefore) {
+			purged += ls.purgeTodo(id)
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeTodoList removes a todo list and its todos from the trash and returns
+// how many items were removed. Must be called with ls.mu held.
+func (ls *LocalStorage) purgeTodoList(id uint32) int {
+	purged := 1
+	for _, todoID := range ls.TodoListTrash[id].TodoIDs {
+		if _, ok := ls.TodoTrash[todoID]; ok {
+			purged += ls.purgeTodo(todoID)
+		}
+	}
+	delete(ls.TodoListTrash, id)
+	delete(ls.TodoListHistory, id)
+	return purged
+}
+
+// purgeTodo removes a todo and its subtasks from the trash together with
+// their history, comments and attachments, and returns how many todos were
+// removed. Must be called with ls.mu held.
+func (ls *LocalStorage) purgeTodo(id uint32) int {
+	purged := 1
+	for _, subtaskID := range ls.TodoTrash[id].SubtaskIDs {
+		if _, ok := ls.TodoTrash[subtaskID]; ok {
+			delete(ls.TodoTrash, subtaskID)
+			delete(ls.TodoHistory, subtaskID)
+			ls.forgetDependencies(subtaskID)
+			ls.forgetComments(subtaskID)
+			ls.forgetAttachments(subtaskID)
+			purged++
+		}
+	}
+	delete(ls.TodoTrash, id)
+	delete(ls.TodoHistory, id)
+	ls.forgetDependencies(id)
+	ls.forgetComments(id)
+	ls.forgetAttachments(id)
+	return purged
+}
+
+// History
+
+func (ls *LocalStorage) GetTodoListHistory(ctx context.Context, id uint32) ([]HistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	history, ok := ls.TodoListHistory[id]
+	if !ok {
+		return nil, ErrTodoListNotFound
+	}
+
+	return cloneHistory(history), nil
+}
+
+func (ls *LocalStorage) GetTodoHistory(ctx context.Context, id uint32) ([]HistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	history, ok := ls.TodoHistory[id]
+	if !ok {
+		return nil, ErrTodoNotFound
+	}
+
+	return cloneHistory(history), nil
+}
+
+// recordTodoList appends a mutation to the history of a todo list and
+// reindexes it for search. Updates that change no field are not recorded.
+// Must be called with ls.mu held, once the mutation is applied.
+func (ls *LocalStorage) recordTodoList(ctx context.Context, id uint32, action HistoryAction, changes []FieldChange) {
+	ls.reindexTodoList(id)
+	if action == ActionUpdate && len(changes) == 0 {
+		return
+	}
+	ls.TodoListHistory[id] = append(ls.TodoListHistory[id], newHistoryEntry(ctx, action, changes))
+}
+
+// recordTodo appends a mutation to the history of a todo and reindexes it
+// for search. Updates that change no field are not recorded. Must be called
+// with ls.mu held, once the mutation is applied.
+func (ls *LocalStorage) recordTodo(ctx context.Context, id uint32, action HistoryAction, changes []FieldChange) {
+	ls.reindexTodo(id)
+	if action == ActionUpdate && len(changes) == 0 {
+		return
+	}
+	ls.TodoHistory[id] = append(ls.TodoHistory[id], newHistoryEntry(ctx, action, changes))
+}
+
+// insertTodo stores a validated todo at the end of its todo list under the
+// next ID, and returns it as stored. Must be called with ls.mu held.
+func (ls *LocalStorage) insertTodo(ctx context.Context, todo Todo) Todo {
+	todo.ID = ls.TodoAutoincrement
+	todo.Version = 1
+	todo.CreatedAt = now(ctx)
+	todo.UpdatedAt = todo.CreatedAt
+	todo.CompletedAt = time.Time{}
+	if todo.Done {
+		todo.CompletedAt = todo.CreatedAt
+	}
+	todo.Position = len(ls.TodoListRelationship[todo.ListID])
+	ls.TodoTable[todo.ID] = cloneTodo(todo)
+	ls.TodoListRelationship[todo.ListID] = append(ls.TodoListRelationship[todo.ListID], todo.ID)
+	ls.TodoAutoincrement++
+	ls.recordTodo(ctx, todo.ID, ActionCreate, diffFields(nil, todoFieldValues(todo)))
+	return todo
+}
+
+// cloneTodo copies the labels, parent and recurrence of a todo so callers
+// never share memory with the stored record.
+func cloneTodo(todo Todo) Todo {
+	if todo.Labels != nil {
+		todo.Labels = append([]string{}, todo.Labels...)
+	}
+	if todo.ParentID != nil {
+		parentID := *todo.ParentID
+		todo.ParentID = &parentID
+	}
+	if todo.Recurrence != nil {
+		recurrence := cloneRecurrence(*todo.Recurrence)
+		todo.Recurrence = &recurrence
+	}
+	return todo
+}
+
+// restoreTodos brings back todos from the trash to the end of a todo list, in
+// the given order, skipping the ones purged meanwhile. A restored todo whose
+// parent is not back on the same todo list becomes a top-level todo. Must be
+// called with ls.mu held.
+func (ls *LocalStorage) restoreTodos(ctx context.Context, listID uint32, ids []uint32, restoredAt time.Time) {
+	todoIDs := ls.TodoListRelationship[listID]
+	restored := []Todo{}
+	for _, id := range ids {
+		trashed, ok := ls.TodoTrash[id]
+		if !ok {
+			continue
+		}
+		todo := trashed.Todo
+		todo.Version++
+		todo.UpdatedAt = restoredAt
+		ls.TodoTable[id] = todo
+		delete(ls.TodoTrash, id)
+		todoIDs = append(todoIDs, id)
+		restored = append(restored, todo)
+	}
+
+	// Parents are checked once every todo is back, as they may come after
+	// their subtasks
+	for _, todo := range restored {
+		var changes []FieldChange
+		if todo.ParentID != nil {
+			if parent, ok := ls.TodoTable[*todo.ParentID]; !ok || parent.ListID != listID {
+				orphan := todo
+				orphan.ParentID = nil
+				ls.TodoTable[todo.ID] = orphan
+				changes = diffFields(todoFieldValues(todo), todoFieldValues(orphan))
+			}
+		}
+		ls.recordTodo(ctx, todo.ID, ActionRestore, changes)
+	}
+
+	ls.setTodoIDs(listID, todoIDs)
+}
+
+// checkParent returns ErrInvalidParent unless the parent of todo is an
+// active todo on the same todo list that is neither the todo nor one of its
+// subtasks. Must be called with ls.mu held.
+func (ls *LocalStorage) checkParent(todo Todo) error {
+	if todo.ParentID == nil {
+		return nil
+	}
+
+	parent, ok := ls.TodoTable[*todo.ParentID]
+	if !ok || parent.ListID != todo.ListID {
+		return ErrInvalidParent
+	}
+
+	// Walking up from the parent must never reach the todo itself
+	ancestor := parent
+	for {
+		if ancestor.ID == todo.ID {
+			return ErrInvalidParent
+		}
+		if ancestor.ParentID == nil {
+			return nil
+		}
+		ancestor, ok = ls.TodoTable[*ancestor.ParentID]
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// subtaskIDs returns every subtask of a todo at any depth, parents before
+// their children and siblings in their order on the todo list. Must be
+// called with ls.mu held.
+func (ls *LocalStorage) subtaskIDs(todo Todo) []uint32 {
+	children := map[uint32][]uint32{}
+	for _, id := range ls.TodoListRelationship[todo.ListID] {
+		if parentID := ls.TodoTable[id].ParentID; parentID != nil {
+			children[*parentID] = append(children[*parentID], id)
+		}
+	}
+
+	var ids []uint32
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		for _, childID := range children[id] {
+			ids = append(ids, childID)
+			walk(childID)
+		}
+	}
+	walk(todo.ID)
+	return ids
+}
+
+// carrySubtasks moves subtasks to the todo list their parent moved to. The
+// todo list relationships are left to the caller. Must be called with ls.mu
+// held.
+func (ls *LocalStorage) carrySubtasks(ctx context.Context, subtaskIDs []uint32, listID uint32, movedAt time.Time) {
+	for _, id := range subtaskIDs {
+		stored := ls.TodoTable[id]
+		todo := stored
+		todo.ListID = listID
+		todo.Version++
+		todo.UpdatedAt = movedAt
+		ls.TodoTable[id] = todo
+		ls.recordTodo(ctx, id, ActionUpdate, diffFields(todoFieldValues(stored), todoFieldValues(todo)))
+	}
+}
+
+// setTodoIDs replaces the todos of a todo list, in order, and renumbers
+// their positions. Must be called with ls.mu held.
+func (ls *LocalStorage) setTodoIDs(listID uint32, todoIDs []uint32) {
+	if len(todoIDs) == 0 {
+		delete(ls.TodoListRelationship, listID)
+		return
+	}
+	ls.TodoListRelationship[listID] = todoIDs
+	for i, id := range todoIDs {
+		todo := ls.TodoTable[id]
+		todo.Position = i
+		ls.TodoTable[id] = todo
+	}
+}
+
+func indexOfID(todoIDs []uint32, todoID uint32) int {
+	for i, id := range todoIDs {
+		if id == todoID {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeIDs(oldTodoIDs []uint32, todoIDs ...uint32) []uint32 {
+	removed := map[uint32]bool{}
+	for _, id := range todoIDs {
+		removed[id] = true
+	}
+
 	newTodoIDs := []uint32{}
 	for _, id := range oldTodoIDs {
-		if id != todoID {
+		if !removed[id] {
 			newTodoIDs = append(newTodoIDs, id)
 		}
 	}
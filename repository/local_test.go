@@ -1,13 +1,25 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+var ctx = context.Background()
+
+// ignoreTimestamps leaves out the fields set from the clock, which are covered
+// by the conformance tests.
+var ignoreTimestamps = cmp.Options{
+	cmpopts.IgnoreFields(TodoList{}, "CreatedAt", "UpdatedAt"),
+	cmpopts.IgnoreFields(Todo{}, "CreatedAt", "UpdatedAt", "CompletedAt"),
+}
+
 // Tests for TodoList
 
 func TestInsertTodoList(t *testing.T) {
@@ -33,8 +45,9 @@ func TestInsertTodoList(t *testing.T) {
 			todoListAutoincrement:     0,
 			wantTodoListAutoincrement: 1,
 			want: &TodoList{
-				ID:    0,
-				Title: "Routine",
+				ID:      0,
+				Title:   "Routine",
+				Version: 1,
 			},
 			wantErr: nil,
 		},
@@ -54,7 +67,7 @@ func TestInsertTodoList(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 			localStorage.TodoListAutoincrement = test.todoListAutoincrement
 
-			got, err := localStorage.InsertTodoList(test.todoListToInsert)
+			got, err := localStorage.InsertTodoList(ctx, test.todoListToInsert)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -64,7 +77,7 @@ func TestInsertTodoList(t *testing.T) {
 				t.Errorf("InsertTodoList() mismatch (-wantTodoListAutoincrement +got):\n%s", diff)
 			}
 
-			if diff := cmp.Diff(test.want, got); diff != "" {
+			if diff := cmp.Diff(test.want, got, ignoreTimestamps); diff != "" {
 				t.Errorf("InsertTodoList() mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -111,7 +124,7 @@ func TestGetTodoList(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 
-			got, err := localStorage.GetTodoListByID(test.id)
+			got, err := localStorage.GetTodoListByID(ctx, test.id)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -181,7 +194,7 @@ func TestGetAllTodoList(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 
-			got, err := localStorage.GetAllTodoLists()
+			got, err := localStorage.GetAllTodoLists(ctx)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -214,18 +227,66 @@ func TestUpdateTodoList(t *testing.T) {
 			},
 			todoListTable: map[uint32]TodoList{
 				0: TodoList{
-					ID:    0,
-					Title: "Rot",
+					ID:      0,
+					Title:   "Rot",
+					Version: 1,
 				},
 			},
 			wantTodoListTable: map[uint32]TodoList{
 				0: TodoList{
-					ID:    0,
-					Title: "Routine",
+					ID:      0,
+					Title:   "Routine",
+					Version: 2,
 				},
 			},
 			wantErr: nil,
 		},
+		{
+			name: "SuccessUpdateRoutineWithVersion",
+			todoListToUpdate: TodoList{
+				ID:      0,
+				Title:   "Routine",
+				Version: 3,
+			},
+			todoListTable: map[uint32]TodoList{
+				0: TodoList{
+					ID:      0,
+					Title:   "Rot",
+					Version: 3,
+				},
+			},
+			wantTodoListTable: map[uint32]TodoList{
+				0: TodoList{
+					ID:      0,
+					Title:   "Routine",
+					Version: 4,
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ErrUpdateTodoListConflict",
+			todoListToUpdate: TodoList{
+				ID:      0,
+				Title:   "Routine",
+				Version: 2,
+			},
+			todoListTable: map[uint32]TodoList{
+				0: TodoList{
+					ID:      0,
+					Title:   "Rot",
+					Version: 3,
+				},
+			},
+			wantTodoListTable: map[uint32]TodoList{
+				0: TodoList{
+					ID:      0,
+					Title:   "Rot",
+					Version: 3,
+				},
+			},
+			wantErr: ErrConflict,
+		},
 		{
 			name: "ErrUpdateTodoListNotFound",
 			todoListToUpdate: TodoList{
@@ -261,13 +322,13 @@ func TestUpdateTodoList(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 
-			err := localStorage.UpdateTodoList(test.todoListToUpdate)
+			err := localStorage.UpdateTodoList(ctx, test.todoListToUpdate)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
 			}
 
-			if diff := cmp.Diff(test.wantTodoListTable, localStorage.TodoListTable); diff != "" {
+			if diff := cmp.Diff(test.wantTodoListTable, localStorage.TodoListTable, ignoreTimestamps); diff != "" {
 				t.Errorf("UpdateTodoList() mismatch (-wantTodoListTable +got):\n%s", diff)
 			}
 		})
@@ -311,7 +372,7 @@ func TestDeleteTodoList(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 
-			err := localStorage.DeleteTodoListByID(test.idToDelete)
+			err := localStorage.DeleteTodoListByID(ctx, test.idToDelete, DeleteTodoListOptions{})
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -324,6 +385,142 @@ func TestDeleteTodoList(t *testing.T) {
 	}
 }
 
+func TestDeleteTodoListPolicies(t *testing.T) {
+	type Test struct {
+		name                     string
+		idToDelete               uint32
+		opts                     DeleteTodoListOptions
+		wantTodoListTable        map[uint32]TodoList
+		wantTodoTable            map[uint32]Todo
+		wantTodoListRelationship map[uint32][]uint32
+		wantErr                  error
+	}
+
+	localStorage := NewLocalStorage()
+
+	todoListTable := func() map[uint32]TodoList {
+		return map[uint32]TodoList{
+			0: TodoList{ID: 0, Title: "Routine", Version: 2},
+			1: TodoList{ID: 1, Title: "Work", Version: 1},
+		}
+	}
+	todoTable := func() map[uint32]Todo {
+		return map[uint32]Todo{
+			0: Todo{ID: 0, ListID: 0, Description: "Make the bed.", Version: 1},
+			1: Todo{ID: 1, ListID: 1, Description: "Write report.", Version: 1},
+		}
+	}
+	todoListRelationship := func() map[uint32][]uint32 {
+		return map[uint32][]uint32{
+			0: []uint32{0},
+			1: []uint32{1},
+		}
+	}
+
+	tests := []Test{
+		{
+			name:       "SuccessCascadeDeletesTodos",
+			idToDelete: 0,
+			opts:       DeleteTodoListOptions{Policy: DeleteCascade},
+			wantTodoListTable: map[uint32]TodoList{
+				1: TodoList{ID: 1, Title: "Work", Version: 1},
+			},
+			wantTodoTable: map[uint32]Todo{
+				1: Todo{ID: 1, ListID: 1, Description: "Write report.", Version: 1},
+			},
+			wantTodoListRelationship: map[uint32][]uint32{
+				1: []uint32{1},
+			},
+		},
+		{
+			name:                     "ErrRestrictTodoListNotEmpty",
+			idToDelete:               0,
+			opts:                     DeleteTodoListOptions{Policy: DeleteRestrict},
+			wantTodoListTable:        todoListTable(),
+			wantTodoTable:            todoTable(),
+			wantTodoListRelationship: todoListRelationship(),
+			wantErr:                  ErrTodoListNotEmpty,
+		},
+		{
+			name:       "SuccessMoveTodosToTarget",
+			idToDelete: 0,
+			opts:       DeleteTodoListOptions{Policy: DeleteMove, TargetListID: 1},
+			wantTodoListTable: map[uint32]TodoList{
+				1: TodoList{ID: 1, Title: "Work", Version: 1},
+			},
+			wantTodoTable: map[uint32]Todo{
+				0: Todo{ID: 0, ListID: 1, Description: "Make the bed.", Version: 2, Position: 1},
+				1: Todo{ID: 1, ListID: 1, Description: "Write report.", Version: 1},
+			},
+			wantTodoListRelationship: map[uint32][]uint32{
+				1: []uint32{1, 0},
+			},
+		},
+		{
+			name:                     "ErrVersionConflict",
+			idToDelete:               0,
+			opts:                     DeleteTodoListOptions{Policy: DeleteCascade, Version: 1},
+			wantTodoListTable:        todoListTable(),
+			wantTodoTable:            todoTable(),
+			wantTodoListRelationship: todoListRelationship(),
+			wantErr:                  ErrConflict,
+		},
+		{
+			name:                     "ErrMoveTargetNotFound",
+			idToDelete:               0,
+			opts:                     DeleteTodoListOptions{Policy: DeleteMove, TargetListID: 5},
+			wantTodoListTable:        todoListTable(),
+			wantTodoTable:            todoTable(),
+			wantTodoListRelationship: todoListRelationship(),
+			wantErr:                  ErrInvalidTarget,
+		},
+		{
+			name:                     "ErrMoveTargetIsDeletedList",
+			idToDelete:               0,
+			opts:                     DeleteTodoListOptions{Policy: DeleteMove, TargetListID: 0},
+			wantTodoListTable:        todoListTable(),
+			wantTodoTable:            todoTable(),
+			wantTodoListRelationship: todoListRelationship(),
+			wantErr:                  ErrInvalidTarget,
+		},
+		{
+			name:                     "ErrInvalidPolicy",
+			idToDelete:               0,
+			opts:                     DeleteTodoListOptions{Policy: DeletePolicy(42)},
+			wantTodoListTable:        todoListTable(),
+			wantTodoTable:            todoTable(),
+			wantTodoListRelationship: todoListRelationship(),
+			wantErr:                  ErrInvalidPolicy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			localStorage.TodoListTable = todoListTable()
+			localStorage.TodoTable = todoTable()
+			localStorage.TodoListRelationship = todoListRelationship()
+
+			err := localStorage.DeleteTodoListByID(ctx, test.idToDelete, test.opts)
+
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("got error %v; want %v", err, test.wantErr)
+			}
+
+			if diff := cmp.Diff(test.wantTodoListTable, localStorage.TodoListTable, ignoreTimestamps); diff != "" {
+				t.Errorf("DeleteTodoList() todo list table mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(test.wantTodoTable, localStorage.TodoTable, ignoreTimestamps); diff != "" {
+				t.Errorf("DeleteTodoList() todo table mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(test.wantTodoListRelationship, localStorage.TodoListRelationship); diff != "" {
+				t.Errorf("DeleteTodoList() todo list relation mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 // Tests for Todo
 
 func TestInsertTodo(t *testing.T) {
@@ -346,7 +543,6 @@ func TestInsertTodo(t *testing.T) {
 			todoToInsert: Todo{
 				ListID:      0,
 				Description: "Make the bed.",
-				Comments:    "",
 				Labels:      []string{"", ""},
 			},
 			todoListTable: map[uint32]TodoList{
@@ -358,8 +554,8 @@ func TestInsertTodo(t *testing.T) {
 				ID:          0,
 				ListID:      0,
 				Description: "Make the bed.",
-				Comments:    "",
 				Labels:      []string{"", ""},
+				Version:     1,
 			},
 			wantErr: nil,
 		},
@@ -368,7 +564,6 @@ func TestInsertTodo(t *testing.T) {
 			todoToInsert: Todo{
 				ListID:      0,
 				Description: "Make the bed.",
-				Comments:    "",
 				Labels:      []string{"", ""},
 			},
 			todoListTable:         map[uint32]TodoList{},
@@ -380,9 +575,8 @@ func TestInsertTodo(t *testing.T) {
 		{
 			name: "ErrInsertTodoEmptyDescription",
 			todoToInsert: Todo{
-				ListID:   0,
-				Comments: "",
-				Labels:   []string{"", ""},
+				ListID: 0,
+				Labels: []string{"", ""},
 			},
 			todoListTable: map[uint32]TodoList{
 				0: TodoList{},
@@ -399,7 +593,7 @@ func TestInsertTodo(t *testing.T) {
 			localStorage.TodoListTable = test.todoListTable
 			localStorage.TodoAutoincrement = test.todoAutoincrement
 
-			got, err := localStorage.InsertTodo(test.todoToInsert)
+			got, err := localStorage.InsertTodo(ctx, test.todoToInsert)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -409,7 +603,7 @@ func TestInsertTodo(t *testing.T) {
 				t.Errorf("InsertTodo() mismatch (-wantTodoAutoincrement +got):\n%s", diff)
 			}
 
-			if diff := cmp.Diff(test.want, got); diff != "" {
+			if diff := cmp.Diff(test.want, got, ignoreTimestamps); diff != "" {
 				t.Errorf("InsertTodo() mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -456,7 +650,7 @@ func TestGetTodo(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoTable = test.todoTable
 
-			got, err := localStorage.GetTodoByID(test.id)
+			got, err := localStorage.GetTodoByID(ctx, test.id)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -545,7 +739,7 @@ func TestGetTodosByListID(t *testing.T) {
 			localStorage.TodoTable = test.todoTable
 			localStorage.TodoListRelationship = test.todoListRelationship
 
-			got, err := localStorage.GetTodosByListID(test.listID)
+			got, err := localStorage.GetTodosByListID(ctx, test.listID)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -560,14 +754,20 @@ func TestGetTodosByListID(t *testing.T) {
 
 func TestUpdateTodo(t *testing.T) {
 	type Test struct {
-		name          string
-		todoToUpdate  Todo
-		todoTable     map[uint32]Todo
-		wantTodoTable map[uint32]Todo
-		wantErr       error
+		name                     string
+		todoToUpdate             Todo
+		todoTable                map[uint32]Todo
+		todoListRelationship     map[uint32][]uint32
+		wantTodoTable            map[uint32]Todo
+		wantTodoListRelationship map[uint32][]uint32
+		wantErr                  error
 	}
 
 	localStorage := NewLocalStorage()
+	localStorage.TodoListTable = map[uint32]TodoList{
+		0: TodoList{ID: 0, Title: "Routine", Version: 1},
+		1: TodoList{ID: 1, Title: "Work", Version: 1},
+	}
 
 	tests := []Test{
 		{
@@ -576,7 +776,6 @@ func TestUpdateTodo(t *testing.T) {
 				ID:          0,
 				ListID:      0,
 				Description: "Make the bed.",
-				Comments:    "It was hard",
 				Labels:      []string{"bed", "bedroom"},
 				Done:        true,
 			},
@@ -585,8 +784,8 @@ func TestUpdateTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the",
-					Comments:    "",
 					Labels:      []string{"", ""},
+					Version:     1,
 				},
 			},
 			wantTodoTable: map[uint32]Todo{
@@ -594,28 +793,99 @@ func TestUpdateTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the bed.",
-					Comments:    "It was hard",
 					Labels:      []string{"bed", "bedroom"},
 					Done:        true,
+					Version:     2,
 				},
 			},
 			wantErr: nil,
 		},
+		{
+			name: "ErrUpdateTodoConflict",
+			todoToUpdate: Todo{
+				ID:          0,
+				ListID:      0,
+				Description: "Make the bed.",
+				Version:     1,
+			},
+			todoTable: map[uint32]Todo{
+				0: Todo{
+					ID:          0,
+					ListID:      0,
+					Description: "Make the",
+					Version:     2,
+				},
+			},
+			wantTodoTable: map[uint32]Todo{
+				0: Todo{
+					ID:          0,
+					ListID:      0,
+					Description: "Make the",
+					Version:     2,
+				},
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "SuccessUpdateMovesTodoToEndOfNewList",
+			todoToUpdate: Todo{
+				ID:          0,
+				ListID:      1,
+				Description: "Make the bed.",
+			},
+			todoTable: map[uint32]Todo{
+				0: Todo{ID: 0, ListID: 0, Description: "Make the bed.", Version: 1},
+				1: Todo{ID: 1, ListID: 0, Description: "Sweep the floor.", Version: 1, Position: 1},
+				2: Todo{ID: 2, ListID: 1, Description: "Write report.", Version: 1},
+			},
+			todoListRelationship: map[uint32][]uint32{
+				0: []uint32{0, 1},
+				1: []uint32{2},
+			},
+			wantTodoTable: map[uint32]Todo{
+				0: Todo{ID: 0, ListID: 1, Description: "Make the bed.", Version: 2, Position: 1},
+				1: Todo{ID: 1, ListID: 0, Description: "Sweep the floor.", Version: 1},
+				2: Todo{ID: 2, ListID: 1, Description: "Write report.", Version: 1},
+			},
+			wantTodoListRelationship: map[uint32][]uint32{
+				0: []uint32{1},
+				1: []uint32{2, 0},
+			},
+		},
+		{
+			name: "ErrUpdateTodoListNotFound",
+			todoToUpdate: Todo{
+				ID:          0,
+				ListID:      5,
+				Description: "Make the bed.",
+			},
+			todoTable: map[uint32]Todo{
+				0: Todo{ID: 0, ListID: 0, Description: "Make the bed.", Version: 1},
+			},
+			todoListRelationship: map[uint32][]uint32{
+				0: []uint32{0},
+			},
+			wantTodoTable: map[uint32]Todo{
+				0: Todo{ID: 0, ListID: 0, Description: "Make the bed.", Version: 1},
+			},
+			wantTodoListRelationship: map[uint32][]uint32{
+				0: []uint32{0},
+			},
+			wantErr: ErrTodoListNotFound,
+		},
 		{
 			name: "ErrUpdateTodoEmptyDescription",
 			todoToUpdate: Todo{
-				ID:       0,
-				ListID:   0,
-				Comments: "It was hard",
-				Labels:   []string{"bed", "bedroom"},
-				Done:     true,
+				ID:     0,
+				ListID: 0,
+				Labels: []string{"bed", "bedroom"},
+				Done:   true,
 			},
 			todoTable: map[uint32]Todo{
 				0: Todo{
 					ID:          0,
 					ListID:      0,
 					Description: "Make the",
-					Comments:    "",
 					Labels:      []string{"", ""},
 				},
 			},
@@ -624,7 +894,6 @@ func TestUpdateTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the",
-					Comments:    "",
 					Labels:      []string{"", ""},
 				},
 			},
@@ -636,7 +905,6 @@ func TestUpdateTodo(t *testing.T) {
 				ID:          0,
 				ListID:      0,
 				Description: "Make the bed.",
-				Comments:    "It was hard",
 				Labels:      []string{"bed", "bedroom"},
 				Done:        true,
 			},
@@ -649,16 +917,21 @@ func TestUpdateTodo(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			localStorage.TodoTable = test.todoTable
+			localStorage.TodoListRelationship = test.todoListRelationship
 
-			err := localStorage.UpdateTodo(test.todoToUpdate)
+			err := localStorage.UpdateTodo(ctx, test.todoToUpdate)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
 			}
 
-			if diff := cmp.Diff(test.wantTodoTable, localStorage.TodoTable); diff != "" {
+			if diff := cmp.Diff(test.wantTodoTable, localStorage.TodoTable, ignoreTimestamps); diff != "" {
 				t.Errorf("UpdateTodo() mismatch (-wantTodoTable +got):\n%s", diff)
 			}
+
+			if diff := cmp.Diff(test.wantTodoListRelationship, localStorage.TodoListRelationship); diff != "" {
+				t.Errorf("UpdateTodo() mismatch (-wantTodoListRelationship +got):\n%s", diff)
+			}
 		})
 	}
 }
@@ -679,7 +952,6 @@ func TestDeleteTodo(t *testing.T) {
 		ID:          0,
 		ListID:      0,
 		Description: "Make the bed.",
-		Comments:    "It was hard",
 		Labels:      []string{"bed", "bedroom"},
 		Done:        true,
 	}
@@ -692,7 +964,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the bed.",
-					Comments:    "It was hard",
 					Labels:      []string{"bed", "bedroom"},
 					Done:        true,
 				},
@@ -719,7 +990,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the bed.",
-					Comments:    "It was hard",
 					Labels:      []string{"bed", "bedroom"},
 					Done:        true,
 				},
@@ -736,7 +1006,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the bed.",
-					Comments:    "It was hard",
 					Labels:      []string{"bed", "bedroom"},
 					Done:        true,
 				},
@@ -753,7 +1022,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          0,
 					ListID:      0,
 					Description: "Make the bed.",
-					Comments:    "It was hard",
 					Labels:      []string{"bed", "bedroom"},
 					Done:        true,
 				},
@@ -761,7 +1029,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          1,
 					ListID:      0,
 					Description: "Sweep the floor.",
-					Comments:    "It was ok",
 					Labels:      []string{"bedroom"},
 					Done:        true,
 				},
@@ -774,7 +1041,6 @@ func TestDeleteTodo(t *testing.T) {
 					ID:          1,
 					ListID:      0,
 					Description: "Sweep the floor.",
-					Comments:    "It was ok",
 					Labels:      []string{"bedroom"},
 					Done:        true,
 				},
@@ -784,6 +1050,25 @@ func TestDeleteTodo(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "SuccessDeleteFromStoredTodoList",
+			todoTable: map[uint32]Todo{
+				0: Todo{
+					ID:          0,
+					ListID:      1,
+					Description: "Make the bed.",
+				},
+			},
+			todoListRelationship: map[uint32][]uint32{
+				0: []uint32{2},
+				1: []uint32{0},
+			},
+			wantTodoTable: map[uint32]Todo{},
+			wantTodoListRelationship: map[uint32][]uint32{
+				0: []uint32{2},
+			},
+			wantErr: nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -791,7 +1076,7 @@ func TestDeleteTodo(t *testing.T) {
 			localStorage.TodoTable = test.todoTable
 			localStorage.TodoListRelationship = test.todoListRelationship
 
-			err := localStorage.DeleteTodo(todo)
+			err := localStorage.DeleteTodo(ctx, todo)
 
 			if !errors.Is(err, test.wantErr) {
 				t.Errorf("got error %v; want %v", err, test.wantErr)
@@ -808,6 +1093,259 @@ func TestDeleteTodo(t *testing.T) {
 	}
 }
 
+// Tests for Label
+
+func TestStrictLabels(t *testing.T) {
+	type Test struct {
+		name    string
+		strict  bool
+		labels  []string
+		wantErr error
+	}
+
+	tests := []Test{
+		{
+			name:   "RegisteredLabels",
+			strict: true,
+			labels: []string{"home"},
+		},
+		{
+			name:    "UnknownLabel",
+			strict:  true,
+			labels:  []string{"home", "hom"},
+			wantErr: ErrUnknownLabel,
+		},
+		{
+			name:   "UnknownLabelWhenNotStrict",
+			labels: []string{"home", "hom"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			localStorage := NewLocalStorage()
+			localStorage.StrictLabels = test.strict
+			if _, err := localStorage.InsertLabel(ctx, Label{Name: "home"}); err != nil {
+				t.Fatal(err)
+			}
+			todoList, err := localStorage.InsertTodoList(ctx, TodoList{Title: "Routine"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = localStorage.InsertTodo(ctx, Todo{ListID: todoList.ID, Description: "Make the bed", Labels: test.labels})
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("InsertTodo() got error %v; want %v", err, test.wantErr)
+			}
+
+			bank, err := localStorage.InsertTodo(ctx, Todo{ListID: todoList.ID, Description: "Call the bank"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bank.Labels = test.labels
+			err = localStorage.UpdateTodo(ctx, *bank)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("UpdateTodo() got error %v; want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
 func todoListLess(x, y TodoList) bool {
 	return x.ID < y.ID
 }
+
+// Tests for concurrency
+
+func TestLocalStorageConcurrentAccess(t *testing.T) {
+	const (
+		workers    = 16
+		iterations = 50
+	)
+
+	localStorage := NewLocalStorage()
+
+	todoList, err := localStorage.InsertTodoList(ctx, TodoList{Title: "Shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	todoListIDs := make(chan uint32, workers*iterations)
+	todoIDs := make(chan uint32, workers*iterations)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				newTodoList, err := localStorage.InsertTodoList(ctx, TodoList{Title: fmt.Sprintf("List %d-%d", w, i)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				todoListIDs <- newTodoList.ID
+
+				newTodo, err := localStorage.InsertTodo(ctx, Todo{
+					ListID:      todoList.ID,
+					Description: fmt.Sprintf("Todo %d-%d", w, i),
+					Labels:      []string{"stress"},
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				todoIDs <- newTodo.ID
+
+				newTodo.Done = true
+				if err := localStorage.UpdateTodo(ctx, *newTodo); err != nil {
+					t.Error(err)
+				}
+				newTodo.Version++
+				newTodo.Labels[0] = "mutated by caller"
+
+				newTodoList.Title = "Renamed"
+				if err := localStorage.UpdateTodoList(ctx, *newTodoList); err != nil {
+					t.Error(err)
+				}
+
+				if _, err := localStorage.GetAllTodoLists(ctx); err != nil {
+					t.Error(err)
+				}
+				if _, err := localStorage.GetTodoListByID(ctx, newTodoList.ID); err != nil {
+					t.Error(err)
+				}
+				if _, err := localStorage.GetTodoByID(ctx, newTodo.ID); err != nil {
+					t.Error(err)
+				}
+				if _, err := localStorage.GetTodosByListID(ctx, todoList.ID); err != nil {
+					t.Error(err)
+				}
+
+				if i%2 == 0 {
+					if err := localStorage.DeleteTodo(ctx, *newTodo); err != nil {
+						t.Error(err)
+					}
+					if err := localStorage.DeleteTodoListByID(ctx, newTodoList.ID, DeleteTodoListOptions{}); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(todoListIDs)
+	close(todoIDs)
+
+	assertUniqueIDs(t, "todo list", todoListIDs)
+	assertUniqueIDs(t, "todo", todoIDs)
+
+	wantTodoListAutoincrement := uint32(workers*iterations + 1)
+	if localStorage.TodoListAutoincrement != wantTodoListAutoincrement {
+		t.Errorf("got todo list autoincrement %d; want %d", localStorage.TodoListAutoincrement, wantTodoListAutoincrement)
+	}
+
+	wantTodoAutoincrement := uint32(workers * iterations)
+	if localStorage.TodoAutoincrement != wantTodoAutoincrement {
+		t.Errorf("got todo autoincrement %d; want %d", localStorage.TodoAutoincrement, wantTodoAutoincrement)
+	}
+
+	todos, err := localStorage.GetTodosByListID(ctx, todoList.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(todos) != len(localStorage.TodoTable) {
+		t.Errorf("got %d todos on relationship; want %d", len(todos), len(localStorage.TodoTable))
+	}
+
+	for _, todo := range todos {
+		if diff := cmp.Diff([]string{"stress"}, todo.Labels); diff != "" {
+			t.Errorf("stored labels changed by caller (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func assertUniqueIDs(t *testing.T, kind string, ids <-chan uint32) {
+	t.Helper()
+
+	seen := map[uint32]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("duplicated %s ID %d", kind, id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestLocalStorageCanceledContext(t *testing.T) {
+	localStorage := NewLocalStorage()
+
+	todoList, err := localStorage.InsertTodoList(ctx, TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := localStorage.InsertTodo(ctx, Todo{ListID: todoList.ID, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	calls := map[string]func() error{
+		"InsertTodoList": func() error {
+			_, err := localStorage.InsertTodoList(canceledCtx, TodoList{Title: "Work"})
+			return err
+		},
+		"GetAllTodoLists": func() error {
+			_, err := localStorage.GetAllTodoLists(canceledCtx)
+			return err
+		},
+		"GetTodoListByID": func() error {
+			_, err := localStorage.GetTodoListByID(canceledCtx, todoList.ID)
+			return err
+		},
+		"UpdateTodoList": func() error {
+			return localStorage.UpdateTodoList(canceledCtx, TodoList{ID: todoList.ID, Title: "Work"})
+		},
+		"DeleteTodoListByID": func() error {
+			return localStorage.DeleteTodoListByID(canceledCtx, todoList.ID, DeleteTodoListOptions{})
+		},
+		"InsertTodo": func() error {
+			_, err := localStorage.InsertTodo(canceledCtx, Todo{ListID: todoList.ID, Description: "Sweep the floor"})
+			return err
+		},
+		"GetTodoByID": func() error {
+			_, err := localStorage.GetTodoByID(canceledCtx, todo.ID)
+			return err
+		},
+		"GetTodosByListID": func() error {
+			_, err := localStorage.GetTodosByListID(canceledCtx, todoList.ID)
+			return err
+		},
+		"UpdateTodo": func() error {
+			return localStorage.UpdateTodo(canceledCtx, Todo{ID: todo.ID, ListID: todoList.ID, Description: "Changed"})
+		},
+		"DeleteTodo": func() error {
+			return localStorage.DeleteTodo(canceledCtx, *todo)
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v; want %v", err, context.Canceled)
+			}
+		})
+	}
+
+	// Nothing may have changed
+	if diff := cmp.Diff(map[uint32]TodoList{todoList.ID: *todoList}, localStorage.TodoListTable); diff != "" {
+		t.Errorf("todo list table changed with canceled context (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[uint32]Todo{todo.ID: *todo}, localStorage.TodoTable); diff != "" {
+		t.Errorf("todo table changed with canceled context (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidQuery  = errors.New("todo query is invalid")
+	ErrInvalidCursor = errors.New("todo query cursor is invalid")
+)
+
+// TodoSort is the field a todo query is ordered by. Ties are always broken
+// by the todo ID, so every order is total and stable between pages.
+type TodoSort int
+
+const (
+	// SortByID orders todos by ID, which is also their creation order.
+	SortByID TodoSort = iota
+	// SortByDueDate orders todos by due date. Todos with no due date come
+	// after every todo that has one.
+	SortByDueDate
+	// SortByDescription orders todos by description, byte-wise.
+	SortByDescription
+	// SortByCreatedAt orders todos by creation time.
+	SortByCreatedAt
+	// SortByUpdatedAt orders todos by the time of their last change.
+	SortByUpdatedAt
+	// SortByPosition orders todos by todo list ID and then by their
+	// position on it, the order set with MoveTodo.
+	SortByPosition
+)
+
+// TodoQuery selects, orders and paginates todos. The zero value returns every
+// todo of every todo list ordered by ID.
+type TodoQuery struct {
+	// ListIDs keeps only todos from these todo lists. Every todo list must
+	// exist. An empty slice means all todo lists.
+	ListIDs []uint32
+	// Done keeps only todos on the given state. Nil means both states.
+	Done *bool
+	// Labels keeps only todos having all of these labels.
+	Labels []string
+	// DueAfter and DueBefore keep only todos due on the closed interval
+	// between them. A zero bound is open. Setting any bound leaves out the
+	// todos with no due date.
+	DueAfter  time.Time
+	DueBefore time.Time
+	// Text keeps only todos whose description or comments contain it,
+	// ignoring case.
+	Text string
+	// Unblocked keeps only todos with no open blockers.
+	Unblocked  bool
+	SortBy     TodoSort
+	Descending bool
+	// Limit is the maximum number of todos on a page. Zero means no limit.
+	Limit int
+	// Cursor continues from the page that returned it as NextCursor. It is
+	// only valid with the same SortBy and Descending.
+	Cursor string
+}
+
+// TodoPage is a page of todos matching a TodoQuery.
+type TodoPage struct {
+	Todos []Todo
+	// NextCursor fetches the next page. It is empty on the last one.
+	NextCursor string
+}
+
+// todoCursor is the position of the last todo on a page, encoded on an
+// opaque string. Keeping the sort key instead of an offset means todos
+// inserted or deleted between pages don't shift the results.
+type todoCursor struct {
+	SortBy      TodoSort  `json:"s"`
+	Descending  bool      `json:"r,omitempty"`
+	ID          uint32    `json:"i"`
+	DueDate     time.Time `json:"d,omitempty"`
+	Description string    `json:"t,omitempty"`
+	// At is the creation or update time, depending on SortBy.
+	At       time.Time `json:"a,omitempty"`
+	ListID   uint32    `json:"l,omitempty"`
+	Position int       `json:"p,omitempty"`
+}
+
+// Validate returns ErrInvalidQuery unless the query can run. It doesn't look
+// at the cursor nor at the todo lists.
+func (q TodoQuery) Validate() error {
+	switch q.SortBy {
+	case SortByID, SortByDueDate, SortByDescription, SortByCreatedAt, SortByUpdatedAt, SortByPosition:
+	default:
+		return ErrInvalidQuery
+	}
+	if q.Limit < 0 {
+		return ErrInvalidQuery
+	}
+	if !q.DueAfter.IsZero() && !q.DueBefore.IsZero() && q.DueAfter.After(q.DueBefore) {
+		return ErrInvalidQuery
+	}
+	return nil
+}
+
+// matches tells whether a todo, having the given comment bodies, passes
+// every filter of the query.
+func (q TodoQuery) matches(todo Todo, comments []string) bool {
+	if q.Done != nil && todo.Done != *q.Done {
+		return false
+	}
+
+	for _, label := range q.Labels {
+		if !hasLabel(todo, label) {
+			return false
+		}
+	}
+
+	if !q.DueAfter.IsZero() || !q.DueBefore.IsZero() {
+		if todo.DueDate.IsZero() {
+			return false
+		}
+		if !q.DueAfter.IsZero() && todo.DueDate.Before(q.DueAfter) {
+			return false
+		}
+		if !q.DueBefore.IsZero() && todo.DueDate.After(q.DueBefore) {
+			return false
+		}
+	}
+
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		found := strings.Contains(strings.ToLower(todo.Description), text)
+		for _, body := range comments {
+			found = found || strings.Contains(strings.ToLower(body), text)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compare returns a negative number when x comes before y on the query
+// order, a positive one when it comes after and zero when they are the
+// same todo.
+func (q TodoQuery) compare(x, y Todo) int {
+	c := 0
+	switch q.SortBy {
+	case SortByDueDate:
+		c = compareTimes(x.DueDate, y.DueDate)
+	case SortByDescription:
+		c = strings.Compare(x.Description, y.Description)
+	case SortByCreatedAt:
+		c = compareTimes(x.CreatedAt, y.CreatedAt)
+	case SortByUpdatedAt:
+		c = compareTimes(x.UpdatedAt, y.UpdatedAt)
+	case SortByPosition:
+		c = compareIDs(x.ListID, y.ListID)
+		if c == 0 {
+			c = comparePositions(x.Position, y.Position)
+		}
+	}
+	if c == 0 {
+		c = compareIDs(x.ID, y.ID)
+	}
+	if q.Descending {
+		return -c
+	}
+	return c
+}
+
+func (q TodoQuery) encodeCursor(last Todo) string {
+	cursor := todoCursor{
+		SortBy:     q.SortBy,
+		Descending: q.Descending,
+		ID:         last.ID,
+	}
+	switch q.SortBy {
+	case SortByDueDate:
+		cursor.DueDate = last.DueDate
+	case SortByDescription:
+		cursor.Description = last.Description
+	case SortByCreatedAt:
+		cursor.At = last.CreatedAt
+	case SortByUpdatedAt:
+		cursor.At = last.UpdatedAt
+	case SortByPosition:
+		cursor.ListID = last.ListID
+		cursor.Position = last.Position
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the todo position the cursor points to.
+func (q TodoQuery) decodeCursor() (Todo, error) {
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return Todo{}, ErrInvalidCursor
+	}
+
+	cursor := todoCursor{}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return Todo{}, ErrInvalidCursor
+	}
+	if cursor.SortBy != q.SortBy || cursor.Descending != q.Descending {
+		return Todo{}, ErrInvalidCursor
+	}
+
+	return Todo{
+		ID:          cursor.ID,
+		DueDate:     cursor.DueDate,
+		Description: cursor.Description,
+		CreatedAt:   cursor.At,
+		UpdatedAt:   cursor.At,
+		ListID:      cursor.ListID,
+		Position:    cursor.Position,
+	}, nil
+}
+
+func hasLabel(todo Todo, label string) bool {
+	for _, l := range todo.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// compareTimes orders the zero time after every other one.
+func compareTimes(x, y time.Time) int {
+	switch {
+	case x.Equal(y):
+		return 0
+	case x.IsZero():
+		return 1
+	case y.IsZero():
+		return -1
+	case x.Before(y):
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareIDs(x, y uint32) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func comparePositions(x, y int) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = errors.New("recurrence rule is invalid")
+
+// Frequency is how often a todo recurs, before applying the interval.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+const untilLayout = "20060102T150405Z"
+
+// Recurrence is the subset of an RFC 5545 RRULE supported on todos: DAILY,
+// WEEKLY with BYDAY and MONTHLY with BYMONTHDAY, together with INTERVAL,
+// COUNT and UNTIL.
+//
+// When a recurring todo becomes done its next occurrence is inserted at the
+// end of the same todo list, with the due date moved forward and the rule
+// moved over to it. Occurrences count from the due date, or from the moment
+// the todo was completed when it has none.
+type Recurrence struct {
+	Frequency Frequency
+	// Interval is how many days, weeks or months go between occurrences.
+	Interval int
+	// ByDay are the weekdays a weekly todo is due on. Empty means the
+	// weekday of the due date.
+	ByDay []time.Weekday
+	// ByMonthDay are the days of the month a monthly todo is due on, where
+	// negative days count from the end of the month. Empty means the day of
+	// the due date. Months without the day are skipped.
+	ByMonthDay []int
+	// Count is how many occurrences are left, this one included. Zero means
+	// no limit.
+	Count int
+	// Until is the last moment an occurrence can be due. Zero means no
+	// limit.
+	Until time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ParseRecurrence parses a rule like "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+// with or without the "RRULE:" prefix. Any error wraps ErrInvalidRecurrence
+// and says which part of the rule is not supported.
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	if rule == "" {
+		return nil, fmt.Errorf("%w: rule is empty", ErrInvalidRecurrence)
+	}
+
+	r := Recurrence{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(rule, ";") {
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], part[i+1:]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%w: %q has no value", ErrInvalidRecurrence, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is given more than once", ErrInvalidRecurrence, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Frequency = Frequency(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			r.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseByMonthDay(value)
+		default:
+			err = fmt.Errorf("%w: %s is not supported", ErrInvalidRecurrence, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !seen["FREQ"] {
+		return nil, fmt.Errorf("%w: FREQ is missing", ErrInvalidRecurrence)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func parsePositive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive number, got %q", ErrInvalidRecurrence, name, value)
+	}
+	return n, nil
+}
+
+// parseUntil accepts an UTC date-time, or a date meaning the end of that day.
+func parseUntil(value string) (time.Time, error) {
+	if until, err := time.Parse(untilLayout, value); err == nil {
+		return until, nil
+	}
+	if date, err := time.Parse("20060102", value); err == nil {
+		return date.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must be an UTC date-time like 20210201T000000Z or a date like 20210201, got %q", ErrInvalidRecurrence, value)
+}
+
+func parseByDay(value string) ([]time.Weekday, error) {
+	days := []time.Weekday{}
+	for _, name := range strings.Split(value, ",") {
+		day, ok := weekdays[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: BYDAY only supports plain weekdays like MO or FR, got %q", ErrInvalidRecurrence, name)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func parseByMonthDay(value string) ([]int, error) {
+	days := []int{}
+	for _, text := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(text)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, fmt.Errorf("%w: BYMONTHDAY must be between 1 and 31 or -31 and -1, got %q", ErrInvalidRecurrence, text)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// Validate checks a rule built without ParseRecurrence, with the same errors.
+func (r Recurrence) Validate() error {
+	switch r.Frequency {
+	case Daily, Weekly, Monthly:
+	default:
+		return fmt.Errorf("%w: FREQ must be DAILY, WEEKLY or MONTHLY, got %q", ErrInvalidRecurrence, r.Frequency)
+	}
+	if r.Interval < 1 {
+		return fmt.Errorf("%w: INTERVAL must be a positive number, got %d", ErrInvalidRecurrence, r.Interval)
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("%w: COUNT must be a positive number, got %d", ErrInvalidRecurrence, r.Count)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return fmt.Errorf("%w: COUNT and UNTIL can't be given together", ErrInvalidRecurrence)
+	}
+	if len(r.ByDay) > 0 && r.Frequency != Weekly {
+		return fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidRecurrence)
+	}
+	for _, day := range r.ByDay {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("%w: BYDAY has an invalid weekday %d", ErrInvalidRecurrence, day)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Frequency != Monthly {
+		return fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrInvalidRecurrence)
+	}
+	for _, day := range r.ByMonthDay {
+		if day == 0 || day < -31 || day > 31 {
+			return fmt.Errorf("%w: BYMONTHDAY must be between 1 and 31 or -31 and -1, got %d", ErrInvalidRecurrence, day)
+		}
+	}
+	return nil
+}
+
+// String formats the rule the way ParseRecurrence reads it, without the
+// "RRULE:" prefix and leaving out the parts with default values.
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + string(r.Frequency)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		names := []string{}
+		for _, day := range r.ByDay {
+			names = append(names, weekdayNames[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(names, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := []string{}
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// maxMonthlyIntervals bounds the search for a month having one of the days
+// of a monthly rule, since some rules never match, like the 30th every 12
+// months starting on February.
+const maxMonthlyIntervals = 1000
+
+// Next returns the first occurrence after the given one, keeping its time of
+// day and location. It returns false when there are no more occurrences,
+// either because of Until or because no month has the days asked for. Count
+// is left to the caller.
+func (r Recurrence) Next(after time.Time) (time.Time, bool) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	var next time.Time
+	switch r.Frequency {
+	case Daily:
+		next = after.AddDate(0, 0, interval)
+	case Weekly:
+		next = r.nextWeekly(after, interval)
+	case Monthly:
+		var ok bool
+		next, ok = r.nextMonthly(after, interval)
+		if !ok {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// nextWeekly looks for the next weekday of the rule on the rest of the week
+// of after, and then on the first day of it interval weeks later. Weeks
+// start on Monday.
+func (r Recurrence) nextWeekly(after time.Time, interval int) time.Time {
+	if len(r.ByDay) == 0 {
+		return after.AddDate(0, 0, 7*interval)
+	}
+
+	on := map[int]bool{}
+	for _, day := range r.ByDay {
+		on[(int(day)+6)%7] = true
+	}
+
+	today := (int(after.Weekday()) + 6) % 7
+	for offset := today + 1; offset < 7; offset++ {
+		if on[offset] {
+			return after.AddDate(0, 0, offset-today)
+		}
+	}
+
+	weekStart := after.AddDate(0, 0, 7*interval-today)
+	for offset := 0; offset < 7; offset++ {
+		if on[offset] {
+			return weekStart.AddDate(0, 0, offset)
+		}
+	}
+	return weekStart
+}
+
+// nextMonthly looks for the next day of the rule on the rest of the month of
+// after, and then on the months every interval months later.
+func (r Recurrence) nextMonthly(after time.Time, interval int) (time.Time, bool) {
+	days := r.ByMonthDay
+	if len(days) == 0 {
+		days = []int{after.Day()}
+	}
+
+	hour, min, sec := after.Clock()
+	for i := 0; i < maxMonthlyIntervals; i++ {
+		first := time.Date(after.Year(), after.Month()+time.Month(i*interval), 1, 0, 0, 0, 0, after.Location())
+		daysInMonth := first.AddDate(0, 1, -1).Day()
+
+		monthDays := []int{}
+		for _, day := range days {
+			if day < 0 {
+				day = daysInMonth + 1 + day
+			}
+			if day < 1 || day > daysInMonth {
+				continue
+			}
+			if i == 0 && day <= after.Day() {
+				continue
+			}
+			monthDays = append(monthDays, day)
+		}
+		if len(monthDays) == 0 {
+			continue
+		}
+
+		sort.Ints(monthDays)
+		return time.Date(first.Year(), first.Month(), monthDays[0], hour, min, sec, after.Nanosecond(), after.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// nextOccurrence returns the todo following a recurring todo completed at
+// the given time, or false when the rule has no more occurrences.
+func nextOccurrence(todo Todo, completedAt time.Time) (Todo, bool) {
+	if todo.Recurrence == nil || todo.Recurrence.Count == 1 {
+		return Todo{}, false
+	}
+
+	after := todo.DueDate
+	if after.IsZero() {
+		after = completedAt
+	}
+	dueDate, ok := todo.Recurrence.Next(after)
+	if !ok {
+		return Todo{}, false
+	}
+
+	recurrence := cloneRecurrence(*todo.Recurrence)
+	if recurrence.Count > 0 {
+		recurrence.Count--
+	}
+
+	next := cloneTodo(todo)
+	next.Done = false
+	next.DueDate = dueDate
+	next.Recurrence = &recurrence
+	return next, true
+}
+
+func cloneRecurrence(r Recurrence) Recurrence {
+	if r.ByDay != nil {
+		r.ByDay = append([]time.Weekday{}, r.ByDay...)
+	}
+	if r.ByMonthDay != nil {
+		r.ByMonthDay = append([]int{}, r.ByMonthDay...)
+	}
+	return r
+}
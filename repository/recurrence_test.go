@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	type Test struct {
+		name    string
+		rule    string
+		want    *Recurrence
+		wantErr bool
+	}
+
+	tests := []Test{
+		{
+			name: "Daily",
+			rule: "FREQ=DAILY",
+			want: &Recurrence{Frequency: Daily, Interval: 1},
+		},
+		{
+			name: "WeeklyWithPrefix",
+			rule: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			want: &Recurrence{Frequency: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Friday}},
+		},
+		{
+			name: "MonthlyLowerCase",
+			rule: "freq=monthly;bymonthday=1,-1;count=12",
+			want: &Recurrence{Frequency: Monthly, Interval: 1, ByMonthDay: []int{1, -1}, Count: 12},
+		},
+		{
+			name: "UntilDateTime",
+			rule: "FREQ=DAILY;UNTIL=20210228T120000Z",
+			want: &Recurrence{Frequency: Daily, Interval: 1, Until: time.Date(2021, 2, 28, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "UntilDate",
+			rule: "FREQ=DAILY;UNTIL=20210228",
+			want: &Recurrence{Frequency: Daily, Interval: 1, Until: time.Date(2021, 2, 28, 23, 59, 59, 0, time.UTC)},
+		},
+		{
+			name:    "Empty",
+			rule:    "",
+			wantErr: true,
+		},
+		{
+			name:    "MissingFreq",
+			rule:    "INTERVAL=2",
+			wantErr: true,
+		},
+		{
+			name:    "UnsupportedFreq",
+			rule:    "FREQ=YEARLY",
+			wantErr: true,
+		},
+		{
+			name:    "UnsupportedPart",
+			rule:    "FREQ=MONTHLY;BYSETPOS=-1",
+			wantErr: true,
+		},
+		{
+			name:    "RepeatedPart",
+			rule:    "FREQ=DAILY;FREQ=WEEKLY",
+			wantErr: true,
+		},
+		{
+			name:    "NoValue",
+			rule:    "FREQ=DAILY;COUNT",
+			wantErr: true,
+		},
+		{
+			name:    "ZeroInterval",
+			rule:    "FREQ=DAILY;INTERVAL=0",
+			wantErr: true,
+		},
+		{
+			name:    "CountAndUntil",
+			rule:    "FREQ=DAILY;COUNT=2;UNTIL=20210228",
+			wantErr: true,
+		},
+		{
+			name:    "ByDayWithOrdinal",
+			rule:    "FREQ=WEEKLY;BYDAY=1MO",
+			wantErr: true,
+		},
+		{
+			name:    "ByDayOnMonthly",
+			rule:    "FREQ=MONTHLY;BYDAY=MO",
+			wantErr: true,
+		},
+		{
+			name:    "ByMonthDayOutOfRange",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=32",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidUntil",
+			rule:    "FREQ=DAILY;UNTIL=2021-02-28",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRecurrence(test.rule)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidRecurrence) {
+					t.Fatalf("got error %v; want %v", err, ErrInvalidRecurrence)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ParseRecurrence() mismatch (-want +got):\n%s", diff)
+			}
+
+			// Formatting and parsing again gives the same rule
+			again, err := ParseRecurrence(got.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, again); diff != "" {
+				t.Errorf("ParseRecurrence(String()) mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	type Test struct {
+		name   string
+		rule   string
+		after  time.Time
+		want   time.Time
+		wantOK bool
+	}
+
+	// 2021-02-01 is a Monday
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2021, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []Test{
+		{
+			name:   "Daily",
+			rule:   "FREQ=DAILY;INTERVAL=3",
+			after:  at(2, 27),
+			want:   at(3, 2),
+			wantOK: true,
+		},
+		{
+			name:   "Weekly",
+			rule:   "FREQ=WEEKLY",
+			after:  at(2, 3),
+			want:   at(2, 10),
+			wantOK: true,
+		},
+		{
+			name:   "WeeklyByDaySameWeek",
+			rule:   "FREQ=WEEKLY;BYDAY=MO,TH",
+			after:  at(2, 1),
+			want:   at(2, 4),
+			wantOK: true,
+		},
+		{
+			name:   "WeeklyByDayNextInterval",
+			rule:   "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			after:  at(2, 4),
+			want:   at(2, 15),
+			wantOK: true,
+		},
+		{
+			name:   "WeeklyByDayFromOtherDay",
+			rule:   "FREQ=WEEKLY;BYDAY=MO",
+			after:  at(2, 7),
+			want:   at(2, 8),
+			wantOK: true,
+		},
+		{
+			name:   "Monthly",
+			rule:   "FREQ=MONTHLY",
+			after:  at(1, 15),
+			want:   at(2, 15),
+			wantOK: true,
+		},
+		{
+			name:   "MonthlySkipsShortMonths",
+			rule:   "FREQ=MONTHLY",
+			after:  at(1, 31),
+			want:   at(3, 31),
+			wantOK: true,
+		},
+		{
+			name:   "MonthlyByMonthDaySameMonth",
+			rule:   "FREQ=MONTHLY;BYMONTHDAY=1,15",
+			after:  at(2, 1),
+			want:   at(2, 15),
+			wantOK: true,
+		},
+		{
+			name:   "MonthlyLastDay",
+			rule:   "FREQ=MONTHLY;BYMONTHDAY=-1",
+			after:  at(1, 31),
+			want:   at(2, 28),
+			wantOK: true,
+		},
+		{
+			name:   "MonthlyNeverMatching",
+			rule:   "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30",
+			after:  at(2, 1),
+			wantOK: false,
+		},
+		{
+			name:   "PastUntil",
+			rule:   "FREQ=DAILY;UNTIL=20210201",
+			after:  at(2, 1),
+			wantOK: false,
+		},
+		{
+			name:   "OnUntil",
+			rule:   "FREQ=DAILY;UNTIL=20210202",
+			after:  at(2, 1),
+			want:   at(2, 2),
+			wantOK: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := r.Next(test.after)
+			if ok != test.wantOK {
+				t.Fatalf("Next(%v) = %v, %v; want ok %v", test.after, got, ok, test.wantOK)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("Next(%v) = %v; want %v", test.after, got, test.want)
+			}
+		})
+	}
+}
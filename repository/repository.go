@@ -1,42 +1,344 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
 var (
-	ErrTodoListNotFound = errors.New("todo list not found")
-	ErrTodoNotFound     = errors.New("todo not found")
-	ErrEmptyTodoList    = errors.New("todo list is empty")
-	ErrEmptyTitle       = errors.New("todo list title is empty")
-	ErrEmptyDescription = errors.New("todo item description is empty")
+	ErrTodoListNotFound   = errors.New("todo list not found")
+	ErrTodoNotFound       = errors.New("todo not found")
+	ErrEmptyTodoList      = errors.New("todo list is empty")
+	ErrEmptyTitle         = errors.New("todo list title is empty")
+	ErrEmptyDescription   = errors.New("todo item description is empty")
+	ErrTodoListNotEmpty   = errors.New("todo list still has todos")
+	ErrInvalidPolicy      = errors.New("delete policy is invalid")
+	ErrInvalidTarget      = errors.New("target todo list is invalid")
+	ErrConflict           = errors.New("version does not match the stored one")
+	ErrNotInTrash         = errors.New("item is not on the trash")
+	ErrInvalidPosition    = errors.New("todo to move before is not on the target todo list")
+	ErrInvalidParent      = errors.New("parent todo is invalid")
+	ErrDependencyCycle    = errors.New("dependency would create a cycle")
+	ErrNoDependency       = errors.New("todo is not blocked by the given todo")
+	ErrBlocked            = errors.New("todo is blocked by open todos")
+	ErrLabelNotFound      = errors.New("label not found")
+	ErrLabelExists        = errors.New("label already exists")
+	ErrInvalidLabel       = errors.New("label name or color is invalid")
+	ErrUnknownLabel       = errors.New("label is not registered")
+	ErrCommentNotFound    = errors.New("comment not found")
+	ErrEmptyComment       = errors.New("comment body is empty")
+	ErrInvalidReply       = errors.New("comment to reply to is not on the same todo")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrInvalidAttachment  = errors.New("attachment name or hash is invalid")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidUser        = errors.New("user name is invalid")
+	ErrInvalidRole        = errors.New("role is invalid")
+	ErrNotMember          = errors.New("user is not a member of the todo list")
+	ErrOwnerMember        = errors.New("user owns the todo list")
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrInvalidToken       = errors.New("token scopes or hash are invalid")
+	ErrInvalidBackup      = errors.New("backup is invalid")
 )
 
+// DeletePolicy decides what happens to the todos of a deleted todo list.
+type DeletePolicy int
+
+const (
+	// DeleteCascade deletes the todos together with the todo list.
+	DeleteCascade DeletePolicy = iota
+	// DeleteRestrict refuses to delete a todo list that still has todos.
+	DeleteRestrict
+	// DeleteMove moves the todos to another todo list before deleting.
+	DeleteMove
+)
+
+type DeleteTodoListOptions struct {
+	Policy DeletePolicy
+	// TargetListID is the todo list receiving the todos on DeleteMove.
+	TargetListID uint32
+	// Version, when not zero, must match the version of the todo list.
+	Version uint64
+}
+
+// MoveTodoOptions says where MoveTodo puts a todo.
+type MoveTodoOptions struct {
+	// ListID is the todo list receiving the todo, which may be its own. A
+	// todo moved to another todo list loses its parent.
+	ListID uint32
+	// BeforeID is the todo it goes right before, which must be on ListID.
+	// Nil puts it at the end of the todo list.
+	BeforeID *uint32
+	// Version, when not zero, must match the version of the todo.
+	Version uint64
+}
+
+// Subtasks form a tree on each todo list. A parent must be an active todo on
+// the same todo list and never the todo itself or one of its subtasks,
+// otherwise the write fails with ErrInvalidParent. A todo changing todo lists
+// takes all its subtasks with it, and deleting a todo deletes them too.
+
+// A todo can be blocked by any number of other todos, on any todo list. A
+// blocker that is not done is open, and a todo with open blockers can't
+// become done unless the write carries WithForce, otherwise it fails with
+// ErrBlocked. Dependencies can't form a cycle, and adding or removing one is
+// a change of the blocked todo. Deleted blockers don't block.
+
+// Labels can be registered with a color and a description. A registered
+// label can be renamed or deleted, which changes every todo having it. Label
+// names can't be empty or have commas or slashes, and colors are either empty
+// or like "#ff8800". With strict labels on, a todo can only have registered
+// labels, otherwise the write fails with ErrUnknownLabel.
+
+// Comments belong to an active todo and may reply to another comment on
+// the same todo, otherwise the write fails with ErrInvalidReply. Only the
+// body of a comment can change, and deleting a comment deletes its replies
+// too. Writing comments doesn't change the todo, and comments of deleted
+// todos are hidden until the todo is restored and dropped when it is purged.
+
+// Attachments are files on an active todo. Only their metadata is on the
+// repository, their content is on a BlobStore under its hash. Attachments
+// can't change, only be deleted, and like comments the attachments of
+// deleted todos are hidden until the todo is restored and dropped when it is
+// purged. Content no attachment has anymore is left to BlobStore.Sweep.
+
+// Users are known by a name that never changes. A todo list is owned by the
+// actor on the context that inserted it, and can be shared with other users
+// as members having a Role. A todo list with no owner, like the ones inserted
+// with no actor, is open to anyone. The repository keeps who may do what but
+// doesn't enforce it, that is up to whoever serves it.
+
+// Versions start at 1 on insert and increase on every change. A write
+// carrying a non-zero Version fails with ErrConflict unless it matches the
+// stored one, while a zero Version always overwrites.
+//
+// CreatedAt, UpdatedAt, CompletedAt, Position, Owner and Members are managed
+// by the repository, any value given on a write is ignored. UpdatedAt changes
+// together with the Version, and CompletedAt is set when a todo becomes done
+// and cleared when it is undone.
+
 type TodoList struct {
-	ID    uint32
-	Title string
+	ID        uint32
+	Title     string
+	Version   uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Owner is the user who inserted the todo list, taken from the actor on
+	// the context. Empty means anyone can access it.
+	Owner string
+	// Members are the users the todo list is shared with, ordered by name.
+	// Only ShareTodoList and UnshareTodoList change them.
+	Members []Member
+	// FeedTokenHash is the hash of the secret reading the calendar feed of
+	// the todo list, empty when it has none. Only SetFeedToken changes it.
+	FeedTokenHash string
+}
+
+// Member is a user a todo list is shared with.
+type Member struct {
+	User string
+	Role Role
 }
 
 type Todo struct {
 	ID          uint32
 	ListID      uint32
 	Description string
-	Comments    string
 	DueDate     time.Time
 	Labels      []string
 	Done        bool
+	Version     uint64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time
+	// Position is the index of the todo on its todo list, starting at 0.
+	// Todos are always returned in this order and only MoveTodo changes it.
+	Position int
+	// ParentID makes the todo a subtask of another todo on the same todo
+	// list. Nil means it is a top-level todo.
+	ParentID *uint32
+	// Recurrence makes the todo repeat once done. Nil means it happens once.
+	Recurrence *Recurrence
+}
+
+type Comment struct {
+	ID     uint32
+	TodoID uint32
+	// ParentID makes the comment a reply to another comment on the same
+	// todo. Nil means it starts a thread.
+	ParentID *uint32
+	// Author is who wrote the comment. It is taken from the actor on the
+	// context when there is one.
+	Author    string
+	Body      string
+	Version   uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Attachment struct {
+	ID     uint32
+	TodoID uint32
+	// Name is the file name given on upload. It can't be empty or have
+	// slashes.
+	Name        string
+	ContentType string
+	Size        int64
+	// Hash is the hex encoded SHA-256 of the content, naming it on the
+	// BlobStore.
+	Hash      string
+	CreatedAt time.Time
+}
+
+type User struct {
+	// Name identifies the user. It is made of letters, digits, dots,
+	// dashes, underscores and at signs.
+	Name        string
+	DisplayName string
+	CreatedAt   time.Time
+}
+
+// Token is a personal API token of a user. Only the hash of its secret is
+// kept, so a lost secret can't be recovered, only replaced.
+type Token struct {
+	ID   uint32
+	User string
+	// Name tells the tokens of a user apart. It is not unique.
+	Name string
+	// Hash is the hex encoded SHA-256 of the secret, as given by HashToken.
+	Hash string
+	// Scopes are what the token allows, never empty.
+	Scopes    []Scope
+	CreatedAt time.Time
+}
+
+type Label struct {
+	Name        string
+	Color       string
+	Description string
+	Version     uint64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// TodoCount is how many active todos have the label. It is set on reads
+	// and ignored on writes.
+	TodoCount int
+}
+
+// TrashedTodoList is a deleted todo list waiting on the trash to be
+// restored or purged.
+type TrashedTodoList struct {
+	TodoList  TodoList
+	DeletedAt time.Time
+	// TodoIDs are the todos deleted together with the todo list, in their
+	// order on it. They are restored and purged together with it.
+	TodoIDs []uint32
+}
+
+// TrashedTodo is a deleted todo waiting on the trash to be restored or
+// purged.
+type TrashedTodo struct {
+	Todo      Todo
+	DeletedAt time.Time
+	// SubtaskIDs are the subtasks deleted together with the todo, parents
+	// before their children. They are restored and purged together with it.
+	SubtaskIDs []uint32
+}
+
+// Trash holds every deleted todo list and todo, oldest deletion first.
+type Trash struct {
+	TodoLists []TrashedTodoList
+	Todos     []TrashedTodo
 }
 
 type Repository interface {
-	InsertTodoList(todoList TodoList) (*TodoList, error)
-	GetAllTodoLists() ([]TodoList, error)
-	GetTodoListByID(id uint32) (*TodoList, error)
-	UpdateTodoList(todoList TodoList) error
-	DeleteTodoListByID(id uint32) error
-	InsertTodo(todo Todo) (*Todo, error)
-	GetTodoByID(id uint32) (*Todo, error)
-	GetTodosByListID(listID uint32) ([]Todo, error)
-	UpdateTodo(todo Todo) error
-	DeleteTodo(todo Todo) error
+	InsertTodoList(ctx context.Context, todoList TodoList) (*TodoList, error)
+	GetAllTodoLists(ctx context.Context) ([]TodoList, error)
+	GetTodoListByID(ctx context.Context, id uint32) (*TodoList, error)
+	UpdateTodoList(ctx context.Context, todoList TodoList) error
+	DeleteTodoListByID(ctx context.Context, id uint32, opts DeleteTodoListOptions) error
+	InsertTodo(ctx context.Context, todo Todo) (*Todo, error)
+	GetTodoByID(ctx context.Context, id uint32) (*Todo, error)
+	GetTodosByListID(ctx context.Context, listID uint32) ([]Todo, error)
+	QueryTodos(ctx context.Context, query TodoQuery) (*TodoPage, error)
+	UpdateTodo(ctx context.Context, todo Todo) error
+	// MoveTodo changes the position of a todo, on its own todo list or on
+	// another one, and returns it as stored.
+	MoveTodo(ctx context.Context, id uint32, opts MoveTodoOptions) (*Todo, error)
+	DeleteTodo(ctx context.Context, todo Todo) error
+	// AddDependency makes a todo blocked by another one, and
+	// RemoveDependency undoes it. Adding an existing dependency does
+	// nothing.
+	AddDependency(ctx context.Context, id, blockerID uint32) error
+	RemoveDependency(ctx context.Context, id, blockerID uint32) error
+	// GetBlockers returns the active todos blocking a todo, ordered by ID.
+	GetBlockers(ctx context.Context, id uint32) ([]Todo, error)
+	GetTrash(ctx context.Context) (*Trash, error)
+	RestoreTodoList(ctx context.Context, id uint32) (*TodoList, error)
+	RestoreTodo(ctx context.Context, id uint32) (*Todo, error)
+	PurgeTodoList(ctx context.Context, id uint32) error
+	PurgeTodo(ctx context.Context, id uint32) error
+	// PurgeTrash purges everything deleted before the given time and
+	// returns how many todo lists and todos were purged.
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error)
+	// GetTodoListHistory and GetTodoHistory return every mutation of a todo
+	// list or todo, oldest first. Deleted items keep their history until
+	// purged.
+	GetTodoListHistory(ctx context.Context, id uint32) ([]HistoryEntry, error)
+	GetTodoHistory(ctx context.Context, id uint32) ([]HistoryEntry, error)
+	InsertLabel(ctx context.Context, label Label) (*Label, error)
+	// GetAllLabels returns every registered label, ordered by name.
+	GetAllLabels(ctx context.Context) ([]Label, error)
+	GetLabel(ctx context.Context, name string) (*Label, error)
+	// UpdateLabel changes the color and description of a label. Use
+	// RenameLabel to change its name.
+	UpdateLabel(ctx context.Context, label Label) error
+	RenameLabel(ctx context.Context, name, newName string) (*Label, error)
+	DeleteLabel(ctx context.Context, name string) error
+	InsertComment(ctx context.Context, comment Comment) (*Comment, error)
+	// GetComments returns the comments of a todo, oldest first, so replies
+	// always come after what they reply to.
+	GetComments(ctx context.Context, todoID uint32) ([]Comment, error)
+	GetComment(ctx context.Context, id uint32) (*Comment, error)
+	// UpdateComment changes the body of a comment.
+	UpdateComment(ctx context.Context, comment Comment) error
+	DeleteComment(ctx context.Context, comment Comment) error
+	InsertAttachment(ctx context.Context, attachment Attachment) (*Attachment, error)
+	// GetAttachments returns the attachments of a todo, oldest first.
+	GetAttachments(ctx context.Context, todoID uint32) ([]Attachment, error)
+	GetAttachment(ctx context.Context, id uint32) (*Attachment, error)
+	DeleteAttachment(ctx context.Context, id uint32) error
+	// GetAttachmentHashes returns the hashes of every attachment, including
+	// the ones of deleted todos, sorted and without repeats.
+	GetAttachmentHashes(ctx context.Context) ([]string, error)
+	InsertUser(ctx context.Context, user User) (*User, error)
+	// GetAllUsers returns every user, ordered by name.
+	GetAllUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, name string) (*User, error)
+	// ShareTodoList gives a user a role on a todo list, replacing the one
+	// they had, and UnshareTodoList takes it away. Both return the todo
+	// list as stored.
+	ShareTodoList(ctx context.Context, id uint32, member Member) (*TodoList, error)
+	UnshareTodoList(ctx context.Context, id uint32, user string) (*TodoList, error)
+	// SetFeedToken replaces the hash of the secret of the calendar feed of a
+	// todo list, and GetTodoListByFeedToken finds the active todo list
+	// whose feed has a secret with the given hash.
+	SetFeedToken(ctx context.Context, id uint32, hash string) (*TodoList, error)
+	GetTodoListByFeedToken(ctx context.Context, hash string) (*TodoList, error)
+	// InsertToken keeps a token of an existing user.
+	InsertToken(ctx context.Context, token Token) (*Token, error)
+	// GetTokens returns the tokens of a user, oldest first.
+	GetTokens(ctx context.Context, user string) ([]Token, error)
+	GetToken(ctx context.Context, id uint32) (*Token, error)
+	// GetTokenByHash finds the token whose secret has the given hash.
+	GetTokenByHash(ctx context.Context, hash string) (*Token, error)
+	DeleteToken(ctx context.Context, id uint32) error
+	// Search finds active todo lists and todos by their text, best match
+	// first. The index behind it is kept up to date on every write.
+	Search(ctx context.Context, query SearchQuery) ([]SearchHit, error)
+	// Backup copies everything the repository keeps, and Restore puts a
+	// backup back at once, or fails with ErrInvalidBackup changing
+	// nothing.
+	Backup(ctx context.Context) (*Backup, error)
+	Restore(ctx context.Context, backup Backup, mode RestoreMode) error
 }
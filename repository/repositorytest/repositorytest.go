@@ -0,0 +1,4285 @@
+// Package repositorytest provides the behavioral contract of a
+// repository.Repository, so any implementation can prove it behaves the
+// same way as repository.LocalStorage.
+//
+// An implementation runs the whole contract from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		repositorytest.Run(t, func(t *testing.T) repository.Repository {
+//			return NewMyStorage()
+//		})
+//	}
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/vitorarins/todoer/repository"
+)
+
+// Factory returns a new and empty Repository for a single test. Anything
+// that must be released afterwards should be registered with t.Cleanup.
+type Factory func(t *testing.T) repository.Repository
+
+// Run runs every test of the contract against repositories from newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("TodoList", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertTodoList(t, newRepo) })
+		t.Run("GetByID", func(t *testing.T) { testGetTodoListByID(t, newRepo) })
+		t.Run("GetAll", func(t *testing.T) { testGetAllTodoLists(t, newRepo) })
+		t.Run("Update", func(t *testing.T) { testUpdateTodoList(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteTodoList(t, newRepo) })
+	})
+	t.Run("Todo", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertTodo(t, newRepo) })
+		t.Run("GetByID", func(t *testing.T) { testGetTodoByID(t, newRepo) })
+		t.Run("GetByListID", func(t *testing.T) { testGetTodosByListID(t, newRepo) })
+		t.Run("Query", func(t *testing.T) { testQueryTodos(t, newRepo) })
+		t.Run("QueryPagination", func(t *testing.T) { testQueryTodosPagination(t, newRepo) })
+		t.Run("Update", func(t *testing.T) { testUpdateTodo(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteTodo(t, newRepo) })
+	})
+	t.Run("Order", func(t *testing.T) {
+		t.Run("MoveWithinList", func(t *testing.T) { testMoveTodoWithinList(t, newRepo) })
+		t.Run("MoveBetweenLists", func(t *testing.T) { testMoveTodoBetweenLists(t, newRepo) })
+		t.Run("UpdateListID", func(t *testing.T) { testUpdateTodoListID(t, newRepo) })
+		t.Run("QueryByPosition", func(t *testing.T) { testQueryByPosition(t, newRepo) })
+	})
+	t.Run("Subtasks", func(t *testing.T) {
+		t.Run("Parents", func(t *testing.T) { testSubtaskParents(t, newRepo) })
+		t.Run("Tree", func(t *testing.T) { testSubtaskTree(t, newRepo) })
+		t.Run("Moves", func(t *testing.T) { testSubtaskMoves(t, newRepo) })
+		t.Run("Trash", func(t *testing.T) { testSubtaskTrash(t, newRepo) })
+	})
+	t.Run("Dependencies", func(t *testing.T) {
+		t.Run("Add", func(t *testing.T) { testAddDependency(t, newRepo) })
+		t.Run("BlockedDone", func(t *testing.T) { testBlockedDone(t, newRepo) })
+		t.Run("Trash", func(t *testing.T) { testBlockersOnTrash(t, newRepo) })
+		t.Run("QueryUnblocked", func(t *testing.T) { testQueryUnblocked(t, newRepo) })
+	})
+	t.Run("Recurrence", func(t *testing.T) {
+		t.Run("Done", func(t *testing.T) { testRecurringDone(t, newRepo) })
+		t.Run("WithoutDueDate", func(t *testing.T) { testRecurringWithoutDueDate(t, newRepo) })
+		t.Run("Invalid", func(t *testing.T) { testRecurrenceInvalid(t, newRepo) })
+	})
+	t.Run("Labels", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertLabel(t, newRepo) })
+		t.Run("Update", func(t *testing.T) { testUpdateLabel(t, newRepo) })
+		t.Run("Counts", func(t *testing.T) { testLabelCounts(t, newRepo) })
+		t.Run("Rename", func(t *testing.T) { testRenameLabel(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteLabel(t, newRepo) })
+	})
+	t.Run("Comments", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertComment(t, newRepo) })
+		t.Run("Update", func(t *testing.T) { testUpdateComment(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteComment(t, newRepo) })
+		t.Run("Trash", func(t *testing.T) { testCommentsOnTrash(t, newRepo) })
+		t.Run("Search", func(t *testing.T) { testSearchComments(t, newRepo) })
+	})
+	t.Run("Attachments", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertAttachment(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteAttachment(t, newRepo) })
+		t.Run("Trash", func(t *testing.T) { testAttachmentsOnTrash(t, newRepo) })
+	})
+	t.Run("Users", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertUser(t, newRepo) })
+		t.Run("Owner", func(t *testing.T) { testTodoListOwner(t, newRepo) })
+		t.Run("Share", func(t *testing.T) { testShareTodoList(t, newRepo) })
+		t.Run("Unshare", func(t *testing.T) { testUnshareTodoList(t, newRepo) })
+	})
+	t.Run("Feeds", func(t *testing.T) {
+		t.Run("Token", func(t *testing.T) { testFeedToken(t, newRepo) })
+		t.Run("Trash", func(t *testing.T) { testFeedTokenOnTrash(t, newRepo) })
+	})
+	t.Run("Tokens", func(t *testing.T) {
+		t.Run("Insert", func(t *testing.T) { testInsertToken(t, newRepo) })
+		t.Run("Get", func(t *testing.T) { testGetTokens(t, newRepo) })
+		t.Run("Delete", func(t *testing.T) { testDeleteToken(t, newRepo) })
+	})
+	t.Run("Search", func(t *testing.T) {
+		t.Run("Match", func(t *testing.T) { testSearchMatch(t, newRepo) })
+		t.Run("Ranking", func(t *testing.T) { testSearchRanking(t, newRepo) })
+		t.Run("FollowsWrites", func(t *testing.T) { testSearchFollowsWrites(t, newRepo) })
+		t.Run("Invalid", func(t *testing.T) { testSearchInvalid(t, newRepo) })
+	})
+	t.Run("Backups", func(t *testing.T) {
+		t.Run("RoundTrip", func(t *testing.T) { testBackupRoundTrip(t, newRepo) })
+		t.Run("Merge", func(t *testing.T) { testRestoreMerge(t, newRepo) })
+		t.Run("MergeTrashedTodoList", func(t *testing.T) { testRestoreMergeTrashedTodoList(t, newRepo) })
+		t.Run("Invalid", func(t *testing.T) { testRestoreInvalid(t, newRepo) })
+	})
+	t.Run("Trash", func(t *testing.T) {
+		t.Run("DeleteTodo", func(t *testing.T) { testTrashDeleteTodo(t, newRepo) })
+		t.Run("DeleteTodoList", func(t *testing.T) { testTrashDeleteTodoList(t, newRepo) })
+		t.Run("RestoreTodoList", func(t *testing.T) { testRestoreTodoList(t, newRepo) })
+		t.Run("RestoreTodo", func(t *testing.T) { testRestoreTodo(t, newRepo) })
+		t.Run("Purge", func(t *testing.T) { testPurge(t, newRepo) })
+		t.Run("PurgeTrash", func(t *testing.T) { testPurgeTrash(t, newRepo) })
+	})
+	t.Run("History", func(t *testing.T) {
+		t.Run("Todo", func(t *testing.T) { testTodoHistory(t, newRepo) })
+		t.Run("TodoList", func(t *testing.T) { testTodoListHistory(t, newRepo) })
+		t.Run("NotFound", func(t *testing.T) { testHistoryNotFound(t, newRepo) })
+	})
+	t.Run("Timestamps", func(t *testing.T) {
+		t.Run("TodoList", func(t *testing.T) { testTodoListTimestamps(t, newRepo) })
+		t.Run("Todo", func(t *testing.T) { testTodoTimestamps(t, newRepo) })
+		t.Run("MovedAndRestored", func(t *testing.T) { testMovedAndRestoredTimestamps(t, newRepo) })
+		t.Run("QueryByRecency", func(t *testing.T) { testQueryByRecency(t, newRepo) })
+	})
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo) })
+	t.Run("Context", func(t *testing.T) { testCanceledContext(t, newRepo) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newRepo) })
+}
+
+var ctx = context.Background()
+
+// ignoreTimestamps leaves out the fields set from the clock, so only the
+// Timestamps tests need to control it.
+var ignoreTimestamps = cmp.Options{
+	cmpopts.IgnoreFields(repository.Attachment{}, "CreatedAt"),
+	cmpopts.IgnoreFields(repository.Comment{}, "CreatedAt", "UpdatedAt"),
+	cmpopts.IgnoreFields(repository.Label{}, "CreatedAt", "UpdatedAt"),
+	cmpopts.IgnoreFields(repository.TodoList{}, "CreatedAt", "UpdatedAt"),
+	cmpopts.IgnoreFields(repository.Todo{}, "CreatedAt", "UpdatedAt", "CompletedAt"),
+	cmpopts.IgnoreFields(repository.User{}, "CreatedAt"),
+}
+
+// TodoList
+
+func testInsertTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	for i, title := range []string{"Routine", "Work"} {
+		got, err := repo.InsertTodoList(ctx, repository.TodoList{ID: 42, Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := &repository.TodoList{ID: uint32(i), Title: title, Version: 1}
+		if diff := cmp.Diff(want, got, ignoreTimestamps); diff != "" {
+			t.Errorf("InsertTodoList() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	_, err := repo.InsertTodoList(ctx, repository.TodoList{})
+	assertErr(t, err, repository.ErrEmptyTitle)
+
+	// A failed insert must not use up an ID
+	got := mustInsertTodoList(t, repo, "Groceries")
+	if got.ID != 2 {
+		t.Errorf("got todo list ID %d after failed insert; want 2", got.ID)
+	}
+}
+
+func testGetTodoListByID(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+
+	got, err := repo.GetTodoListByID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(routine, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GetTodoListByID() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = repo.GetTodoListByID(ctx, routine.ID+1)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testGetAllTodoLists(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	got, err := repo.GetAllTodoLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %d todo lists on an empty repository; want none", len(got))
+	}
+
+	want := []repository.TodoList{
+		*mustInsertTodoList(t, repo, "Routine"),
+		*mustInsertTodoList(t, repo, "Work"),
+	}
+
+	got, err = repo.GetAllTodoLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(todoListLess), ignoreTimestamps); diff != "" {
+		t.Errorf("GetAllTodoLists() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testUpdateTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Rot")
+
+	routine.Title = "Routine"
+	if err := repo.UpdateTodoList(ctx, *routine); err != nil {
+		t.Fatal(err)
+	}
+	routine.Version++
+	assertTodoList(t, repo, *routine)
+
+	err := repo.UpdateTodoList(ctx, repository.TodoList{ID: routine.ID})
+	assertErr(t, err, repository.ErrEmptyTitle)
+	assertTodoList(t, repo, *routine)
+
+	err = repo.UpdateTodoList(ctx, repository.TodoList{ID: routine.ID + 1, Title: "Work"})
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testDeleteTodoList(t *testing.T, newRepo Factory) {
+	type Test struct {
+		name            string
+		opts            func(routine, work *repository.TodoList) repository.DeleteTodoListOptions
+		wantErr         error
+		wantRoutineTodo bool
+		wantWorkTodos   []string
+	}
+
+	tests := []Test{
+		{
+			name: "CascadeDeletesTodos",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeleteCascade}
+			},
+			wantWorkTodos: []string{"Write report"},
+		},
+		{
+			name: "RestrictKeepsNonEmptyList",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeleteRestrict}
+			},
+			wantErr:         repository.ErrTodoListNotEmpty,
+			wantRoutineTodo: true,
+			wantWorkTodos:   []string{"Write report"},
+		},
+		{
+			name: "MoveAppendsTodosToTarget",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: work.ID}
+			},
+			wantRoutineTodo: true,
+			wantWorkTodos:   []string{"Write report", "Make the bed"},
+		},
+		{
+			name: "MoveToMissingTarget",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: work.ID + 1}
+			},
+			wantErr:         repository.ErrInvalidTarget,
+			wantRoutineTodo: true,
+			wantWorkTodos:   []string{"Write report"},
+		},
+		{
+			name: "MoveToItself",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: routine.ID}
+			},
+			wantErr:         repository.ErrInvalidTarget,
+			wantRoutineTodo: true,
+			wantWorkTodos:   []string{"Write report"},
+		},
+		{
+			name: "UnknownPolicy",
+			opts: func(routine, work *repository.TodoList) repository.DeleteTodoListOptions {
+				return repository.DeleteTodoListOptions{Policy: repository.DeletePolicy(42)}
+			},
+			wantErr:         repository.ErrInvalidPolicy,
+			wantRoutineTodo: true,
+			wantWorkTodos:   []string{"Write report"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newRepo(t)
+			routine := mustInsertTodoList(t, repo, "Routine")
+			work := mustInsertTodoList(t, repo, "Work")
+			bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+			mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+			err := repo.DeleteTodoListByID(ctx, routine.ID, test.opts(routine, work))
+			assertErr(t, err, test.wantErr)
+
+			_, err = repo.GetTodoListByID(ctx, routine.ID)
+			if test.wantErr == nil {
+				assertErr(t, err, repository.ErrTodoListNotFound)
+			} else {
+				assertErr(t, err, nil)
+			}
+
+			_, err = repo.GetTodoByID(ctx, bed.ID)
+			if test.wantRoutineTodo {
+				assertErr(t, err, nil)
+			} else {
+				assertErr(t, err, repository.ErrTodoNotFound)
+			}
+
+			assertDescriptions(t, repo, work.ID, test.wantWorkTodos)
+			assertListIDsConsistent(t, repo)
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		err := repo.DeleteTodoListByID(ctx, 0, repository.DeleteTodoListOptions{})
+		assertErr(t, err, repository.ErrTodoListNotFound)
+	})
+
+	t.Run("RestrictDeletesEmptyList", func(t *testing.T) {
+		repo := newRepo(t)
+		routine := mustInsertTodoList(t, repo, "Routine")
+		todo := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+		if err := repo.DeleteTodo(ctx, *todo); err != nil {
+			t.Fatal(err)
+		}
+
+		err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{Policy: repository.DeleteRestrict})
+		assertErr(t, err, nil)
+	})
+}
+
+// Todo
+
+func testInsertTodo(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+
+	dueDate := time.Date(2021, 2, 4, 0, 0, 0, 0, time.UTC)
+	labels := []string{"bed", "bedroom"}
+	got, err := repo.InsertTodo(ctx, repository.Todo{
+		ID:          42,
+		ListID:      routine.ID,
+		Description: "Make the bed",
+		DueDate:     dueDate,
+		Labels:      labels,
+		Done:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &repository.Todo{
+		ID:          0,
+		ListID:      routine.ID,
+		Description: "Make the bed",
+		DueDate:     dueDate,
+		Labels:      []string{"bed", "bedroom"},
+		Done:        true,
+		Version:     1,
+	}
+	if diff := cmp.Diff(want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("InsertTodo() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The caller keeps ownership of the slices it passed in
+	labels[0] = "changed"
+	assertTodo(t, repo, *want)
+
+	// IDs are shared by all todo lists
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+	if report.ID != 1 {
+		t.Errorf("got todo ID %d; want 1", report.ID)
+	}
+
+	_, err = repo.InsertTodo(ctx, repository.Todo{ListID: work.ID + 1, Description: "Lost"})
+	assertErr(t, err, repository.ErrTodoListNotFound)
+
+	_, err = repo.InsertTodo(ctx, repository.Todo{ListID: routine.ID})
+	assertErr(t, err, repository.ErrEmptyDescription)
+
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	if floor.ID != 2 {
+		t.Errorf("got todo ID %d after failed inserts; want 2", floor.ID)
+	}
+}
+
+func testGetTodoByID(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"bed"}})
+
+	got, err := repo.GetTodoByID(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(bed, got, ignoreTimestamps); diff != "" {
+		t.Errorf("GetTodoByID() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Changing a returned todo must not change the stored one
+	got.Labels[0] = "changed"
+	assertTodo(t, repo, *bed)
+
+	_, err = repo.GetTodoByID(ctx, bed.ID+1)
+	assertErr(t, err, repository.ErrTodoNotFound)
+}
+
+func testGetTodosByListID(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+
+	assertDescriptions(t, repo, routine.ID, []string{})
+
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+
+	// Todos come in insertion order and only from the requested list
+	assertDescriptions(t, repo, routine.ID, []string{"Make the bed", "Sweep the floor"})
+	assertDescriptions(t, repo, work.ID, []string{"Write report"})
+
+	_, err := repo.GetTodosByListID(ctx, work.ID+1)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testQueryTodos(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, work := fillQueryFixture(t, repo)
+
+	done := true
+	notDone := false
+
+	type Test struct {
+		name    string
+		query   repository.TodoQuery
+		want    []string
+		wantErr error
+	}
+
+	tests := []Test{
+		{
+			name:  "EverythingByID",
+			query: repository.TodoQuery{},
+			want:  []string{"Make the bed", "Write report", "Sweep the floor", "Call the bank", "Review code"},
+		},
+		{
+			name:  "SingleList",
+			query: repository.TodoQuery{ListIDs: []uint32{routine.ID}},
+			want:  []string{"Make the bed", "Sweep the floor", "Call the bank"},
+		},
+		{
+			name:  "RepeatedListsOnlyOnce",
+			query: repository.TodoQuery{ListIDs: []uint32{work.ID, routine.ID, work.ID}},
+			want:  []string{"Make the bed", "Write report", "Sweep the floor", "Call the bank", "Review code"},
+		},
+		{
+			name:  "Done",
+			query: repository.TodoQuery{Done: &done},
+			want:  []string{"Make the bed", "Review code"},
+		},
+		{
+			name:  "NotDone",
+			query: repository.TodoQuery{Done: &notDone},
+			want:  []string{"Write report", "Sweep the floor", "Call the bank"},
+		},
+		{
+			name:  "AllLabels",
+			query: repository.TodoQuery{Labels: []string{"home", "urgent"}},
+			want:  []string{"Sweep the floor"},
+		},
+		{
+			name:  "DueRangeIsInclusive",
+			query: repository.TodoQuery{DueAfter: day(2), DueBefore: day(3)},
+			want:  []string{"Make the bed", "Write report"},
+		},
+		{
+			name:  "DueAfterLeavesOutUndated",
+			query: repository.TodoQuery{DueAfter: day(1)},
+			want:  []string{"Make the bed", "Write report", "Sweep the floor"},
+		},
+		{
+			name:  "TextIgnoresCase",
+			query: repository.TodoQuery{Text: "THE B"},
+			want:  []string{"Make the bed", "Call the bank"},
+		},
+		{
+			name:  "TextOnComments",
+			query: repository.TodoQuery{Text: "manager"},
+			want:  []string{"Write report"},
+		},
+		{
+			name:  "ByDueDateUndatedLast",
+			query: repository.TodoQuery{SortBy: repository.SortByDueDate},
+			want:  []string{"Sweep the floor", "Write report", "Make the bed", "Call the bank", "Review code"},
+		},
+		{
+			name:  "ByDueDateDescending",
+			query: repository.TodoQuery{SortBy: repository.SortByDueDate, Descending: true},
+			want:  []string{"Review code", "Call the bank", "Make the bed", "Write report", "Sweep the floor"},
+		},
+		{
+			name:  "ByDescription",
+			query: repository.TodoQuery{SortBy: repository.SortByDescription},
+			want:  []string{"Call the bank", "Make the bed", "Review code", "Sweep the floor", "Write report"},
+		},
+		{
+			name:  "Combined",
+			query: repository.TodoQuery{ListIDs: []uint32{routine.ID}, Done: &notDone, Labels: []string{"home"}, SortBy: repository.SortByDescription, Descending: true},
+			want:  []string{"Sweep the floor", "Call the bank"},
+		},
+		{
+			name:  "NothingMatches",
+			query: repository.TodoQuery{Text: "nothing like this"},
+			want:  []string{},
+		},
+		{
+			name:    "MissingList",
+			query:   repository.TodoQuery{ListIDs: []uint32{routine.ID, work.ID + 1}},
+			wantErr: repository.ErrTodoListNotFound,
+		},
+		{
+			name:    "UnknownSort",
+			query:   repository.TodoQuery{SortBy: repository.TodoSort(42)},
+			wantErr: repository.ErrInvalidQuery,
+		},
+		{
+			name:    "NegativeLimit",
+			query:   repository.TodoQuery{Limit: -1},
+			wantErr: repository.ErrInvalidQuery,
+		},
+		{
+			name:    "EmptyDueRange",
+			query:   repository.TodoQuery{DueAfter: day(3), DueBefore: day(2)},
+			wantErr: repository.ErrInvalidQuery,
+		},
+		{
+			name:    "MalformedCursor",
+			query:   repository.TodoQuery{Cursor: "not a cursor"},
+			wantErr: repository.ErrInvalidCursor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := repo.QueryTodos(ctx, test.query)
+			assertErr(t, err, test.wantErr)
+			if test.wantErr != nil {
+				return
+			}
+
+			if diff := cmp.Diff(test.want, descriptions(page.Todos)); diff != "" {
+				t.Errorf("QueryTodos() mismatch (-want +got):\n%s", diff)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("got next cursor %q on a query with no limit", page.NextCursor)
+			}
+		})
+	}
+}
+
+func testQueryTodosPagination(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, _ := fillQueryFixture(t, repo)
+
+	sorts := []repository.TodoSort{repository.SortByID, repository.SortByDueDate, repository.SortByDescription}
+	for _, sortBy := range sorts {
+		for _, descending := range []bool{false, true} {
+			name := fmt.Sprintf("Sort%d", sortBy)
+			if descending {
+				name += "Descending"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				query := repository.TodoQuery{SortBy: sortBy, Descending: descending}
+				want, err := repo.QueryTodos(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				query.Limit = 2
+				got := []repository.Todo{}
+				for pages := 1; ; pages++ {
+					page, err := repo.QueryTodos(ctx, query)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(page.Todos) > query.Limit {
+						t.Fatalf("got %d todos on a page; want at most %d", len(page.Todos), query.Limit)
+					}
+					got = append(got, page.Todos...)
+					if page.NextCursor == "" {
+						break
+					}
+					if pages > len(want.Todos) {
+						t.Fatal("pagination does not end")
+					}
+					query.Cursor = page.NextCursor
+				}
+
+				if diff := cmp.Diff(want.Todos, got, ignoreTimestamps); diff != "" {
+					t.Errorf("paginated QueryTodos() mismatch (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+
+	t.Run("CursorSurvivesChanges", func(t *testing.T) {
+		query := repository.TodoQuery{SortBy: repository.SortByDescription, Limit: 2}
+		first, err := repo.QueryTodos(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A todo sorting before the cursor must not shift the next page
+		mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Buy milk"})
+
+		query.Cursor = first.NextCursor
+		next, err := repo.QueryTodos(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"Review code", "Sweep the floor"}, descriptions(next.Todos)); diff != "" {
+			t.Errorf("next page mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("CursorBoundToOrder", func(t *testing.T) {
+		query := repository.TodoQuery{SortBy: repository.SortByDescription, Limit: 2}
+		first, err := repo.QueryTodos(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		query.Cursor = first.NextCursor
+		query.Descending = true
+		_, err = repo.QueryTodos(ctx, query)
+		assertErr(t, err, repository.ErrInvalidCursor)
+	})
+}
+
+func testUpdateTodo(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+
+	bed.Done = true
+	bed.Labels = []string{"bedroom"}
+	if err := repo.UpdateTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+	bed.Version++
+	assertTodo(t, repo, *bed)
+
+	err := repo.UpdateTodo(ctx, repository.Todo{ID: bed.ID, ListID: routine.ID})
+	assertErr(t, err, repository.ErrEmptyDescription)
+	assertTodo(t, repo, *bed)
+
+	err = repo.UpdateTodo(ctx, repository.Todo{ID: bed.ID + 1, ListID: routine.ID, Description: "Lost"})
+	assertErr(t, err, repository.ErrTodoNotFound)
+}
+
+func testDeleteTodo(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+
+	if err := repo.DeleteTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := repo.GetTodoByID(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+	assertDescriptions(t, repo, routine.ID, []string{"Sweep the floor"})
+
+	err = repo.DeleteTodo(ctx, *bed)
+	assertErr(t, err, repository.ErrTodoNotFound)
+
+	if err := repo.DeleteTodo(ctx, *floor); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{})
+	assertListIDsConsistent(t, repo)
+}
+
+// Order
+
+func testMoveTodoWithinList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	bank := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Call the bank"})
+
+	if bank.Position != 2 {
+		t.Errorf("got position %d on insert; want 2", bank.Position)
+	}
+
+	moved, err := repo.MoveTodo(clockAt(day(2)), bank.ID, repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &bed.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bank.Version++
+	bank.Position = 0
+	if diff := cmp.Diff(bank, moved, ignoreTimestamps); diff != "" {
+		t.Errorf("MoveTodo() mismatch (-want +got):\n%s", diff)
+	}
+	assertTodo(t, repo, *bank)
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank", "Make the bed", "Sweep the floor"})
+
+	// Without a todo to go before, it goes to the end
+	if _, err := repo.MoveTodo(ctx, bed.ID, repository.MoveTodoOptions{ListID: routine.ID}); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank", "Sweep the floor", "Make the bed"})
+	assertListIDsConsistent(t, repo)
+
+	history, err := repo.GetTodoHistory(ctx, bank.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repository.HistoryEntry{
+		At:      day(2),
+		Action:  repository.ActionUpdate,
+		Changes: []repository.FieldChange{{Field: "position", Old: "2", New: "0"}},
+	}
+	if diff := cmp.Diff(want, history[len(history)-1]); diff != "" {
+		t.Errorf("GetTodoHistory() last entry mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testMoveTodoBetweenLists(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+	moved, err := repo.MoveTodo(ctx, bed.ID, repository.MoveTodoOptions{ListID: work.ID, BeforeID: &report.ID, Version: bed.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bed.ListID = work.ID
+	bed.Version++
+	if diff := cmp.Diff(bed, moved, ignoreTimestamps); diff != "" {
+		t.Errorf("MoveTodo() mismatch (-want +got):\n%s", diff)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Sweep the floor"})
+	assertDescriptions(t, repo, work.ID, []string{"Make the bed", "Write report"})
+	// Todos left behind and pushed down have their positions updated
+	floor.Position = 0
+	assertTodo(t, repo, *floor)
+	report.Position = 1
+	assertTodo(t, repo, *report)
+	assertListIDsConsistent(t, repo)
+
+	type Test struct {
+		name string
+		id   uint32
+		opts repository.MoveTodoOptions
+		want error
+	}
+
+	lost := report.ID + 1
+	tests := []Test{
+		{
+			name: "TodoNotFound",
+			id:   lost,
+			opts: repository.MoveTodoOptions{ListID: work.ID},
+			want: repository.ErrTodoNotFound,
+		},
+		{
+			name: "TodoListNotFound",
+			id:   floor.ID,
+			opts: repository.MoveTodoOptions{ListID: work.ID + 1},
+			want: repository.ErrTodoListNotFound,
+		},
+		{
+			name: "BeforeTodoOnOtherList",
+			id:   floor.ID,
+			opts: repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &report.ID},
+			want: repository.ErrInvalidPosition,
+		},
+		{
+			name: "BeforeItself",
+			id:   floor.ID,
+			opts: repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &floor.ID},
+			want: repository.ErrInvalidPosition,
+		},
+		{
+			name: "BeforeTodoNotFound",
+			id:   floor.ID,
+			opts: repository.MoveTodoOptions{ListID: work.ID, BeforeID: &lost},
+			want: repository.ErrInvalidPosition,
+		},
+		{
+			name: "StaleVersion",
+			id:   bed.ID,
+			opts: repository.MoveTodoOptions{ListID: routine.ID, Version: bed.Version - 1},
+			want: repository.ErrConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.MoveTodo(ctx, test.id, test.opts)
+			assertErr(t, err, test.want)
+
+			assertDescriptions(t, repo, routine.ID, []string{"Sweep the floor"})
+			assertDescriptions(t, repo, work.ID, []string{"Make the bed", "Write report"})
+		})
+	}
+
+	history, err := repo.GetTodoHistory(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repository.FieldChange{{Field: "list_id", Old: "0", New: "1"}}
+	if diff := cmp.Diff(want, history[len(history)-1].Changes); diff != "" {
+		t.Errorf("GetTodoHistory() last changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testUpdateTodoListID(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+	// Changing the todo list on an update moves the todo to its end
+	bed.ListID = work.ID
+	if err := repo.UpdateTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+	bed.Version++
+	bed.Position = 1
+	assertTodo(t, repo, *bed)
+	assertDescriptions(t, repo, routine.ID, []string{"Sweep the floor"})
+	assertDescriptions(t, repo, work.ID, []string{"Write report", "Make the bed"})
+	assertListIDsConsistent(t, repo)
+
+	lost := *bed
+	lost.ListID = work.ID + 1
+	err := repo.UpdateTodo(ctx, lost)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	assertTodo(t, repo, *bed)
+
+	// The todo is deleted from the list it is on, whatever list is given
+	stale := *bed
+	stale.ListID = routine.ID
+	stale.Version = 0
+	if err := repo.DeleteTodo(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, work.ID, []string{"Write report"})
+	assertListIDsConsistent(t, repo)
+}
+
+func testQueryByPosition(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, work := fillQueryFixture(t, repo)
+
+	todos, err := repo.GetTodosByListID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Call the bank, Make the bed, Sweep the floor
+	if _, err := repo.MoveTodo(ctx, todos[2].ID, repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &todos[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		name  string
+		query repository.TodoQuery
+		want  []string
+	}
+
+	tests := []Test{
+		{
+			name:  "Position",
+			query: repository.TodoQuery{SortBy: repository.SortByPosition},
+			want:  []string{"Call the bank", "Make the bed", "Sweep the floor", "Write report", "Review code"},
+		},
+		{
+			name:  "PositionDescending",
+			query: repository.TodoQuery{ListIDs: []uint32{work.ID, routine.ID}, SortBy: repository.SortByPosition, Descending: true},
+			want:  []string{"Review code", "Write report", "Sweep the floor", "Make the bed", "Call the bank"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Two todos per page, so the cursor is used within and across lists
+			query := test.query
+			query.Limit = 2
+			got := []string{}
+			for {
+				page, err := repo.QueryTodos(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, descriptions(page.Todos)...)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("QueryTodos() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Subtasks
+
+// fillSubtasks creates a todo list with the subtasks:
+//
+//	Clean the house
+//		Sweep the floor
+//			Mop the floor
+//		Make the bed
+//	Call the bank
+func fillSubtasks(t *testing.T, repo repository.Repository) (*repository.TodoList, []*repository.Todo) {
+	t.Helper()
+
+	routine := mustInsertTodoList(t, repo, "Routine")
+	house := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Clean the house"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor", ParentID: &house.ID})
+	mop := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Mop the floor", ParentID: &floor.ID})
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", ParentID: &house.ID})
+	bank := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Call the bank"})
+
+	return routine, []*repository.Todo{house, floor, mop, bed, bank}
+}
+
+func testSubtaskParents(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, todos := fillSubtasks(t, repo)
+	house, floor, mop, bed, bank := todos[0], todos[1], todos[2], todos[3], todos[4]
+	work := mustInsertTodoList(t, repo, "Work")
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+	old := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Old todo"})
+	if err := repo.DeleteTodo(ctx, *old); err != nil {
+		t.Fatal(err)
+	}
+
+	if mop.ParentID == nil || *mop.ParentID != floor.ID {
+		t.Errorf("got parent %v on insert; want %d", mop.ParentID, floor.ID)
+	}
+
+	type Test struct {
+		name   string
+		todo   repository.Todo
+		insert bool
+	}
+
+	lost := old.ID + 1
+	withParent := func(todo repository.Todo, parentID uint32) repository.Todo {
+		todo.ParentID = &parentID
+		return todo
+	}
+	movedFloor := *floor
+	movedFloor.ListID = work.ID
+	tests := []Test{
+		{
+			name:   "InsertParentNotFound",
+			todo:   repository.Todo{ListID: routine.ID, Description: "Dust the shelves", ParentID: &lost},
+			insert: true,
+		},
+		{
+			name:   "InsertParentOnOtherList",
+			todo:   repository.Todo{ListID: routine.ID, Description: "Dust the shelves", ParentID: &report.ID},
+			insert: true,
+		},
+		{
+			name:   "InsertParentDeleted",
+			todo:   repository.Todo{ListID: routine.ID, Description: "Dust the shelves", ParentID: &old.ID},
+			insert: true,
+		},
+		{
+			name: "UpdateOwnParent",
+			todo: withParent(*house, house.ID),
+		},
+		{
+			name: "UpdateParentIsSubtask",
+			todo: withParent(*house, mop.ID),
+		},
+		{
+			name: "UpdateParentIsChild",
+			todo: withParent(*floor, mop.ID),
+		},
+		{
+			name: "UpdateParentLeftOnOtherList",
+			todo: movedFloor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			if test.insert {
+				_, err = repo.InsertTodo(ctx, test.todo)
+			} else {
+				err = repo.UpdateTodo(ctx, test.todo)
+			}
+			assertErr(t, err, repository.ErrInvalidParent)
+
+			assertTodo(t, repo, *house)
+			assertTodo(t, repo, *floor)
+			assertDescriptions(t, repo, routine.ID, []string{"Clean the house", "Sweep the floor", "Mop the floor", "Make the bed", "Call the bank"})
+		})
+	}
+
+	// Subtasks can change parents and become top-level
+	updated := withParent(*bed, bank.ID)
+	if err := repo.UpdateTodo(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	updated.Version++
+	assertTodo(t, repo, updated)
+
+	updated.ParentID = nil
+	if err := repo.UpdateTodo(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	updated.Version++
+	assertTodo(t, repo, updated)
+
+	history, err := repo.GetTodoHistory(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repository.FieldChange{{Field: "parent_id", Old: fmt.Sprint(bank.ID), New: ""}}
+	if diff := cmp.Diff(want, history[len(history)-1].Changes); diff != "" {
+		t.Errorf("GetTodoHistory() last changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testSubtaskTree(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, todos := fillSubtasks(t, repo)
+	house, floor, mop, bed, bank := todos[0], todos[1], todos[2], todos[3], todos[4]
+
+	// Siblings keep their order on the todo list
+	if _, err := repo.MoveTodo(ctx, bed.ID, repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &floor.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := repo.GetTodosByListID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := repository.NewTodoTree(stored)
+
+	bed.Version++
+	house.Position, bed.Position, floor.Position, mop.Position = 0, 1, 2, 3
+	want := []repository.TodoNode{
+		{Todo: *house, Subtasks: []repository.TodoNode{
+			{Todo: *bed},
+			{Todo: *floor, Subtasks: []repository.TodoNode{
+				{Todo: *mop},
+			}},
+		}},
+		{Todo: *bank},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), ignoreTimestamps); diff != "" {
+		t.Errorf("NewTodoTree() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testSubtaskMoves(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, todos := fillSubtasks(t, repo)
+	house, floor, mop, bed := todos[0], todos[1], todos[2], todos[3]
+	work := mustInsertTodoList(t, repo, "Work")
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+	// Moving to another todo list takes the subtasks and leaves the parent
+	if _, err := repo.MoveTodo(ctx, floor.ID, repository.MoveTodoOptions{ListID: work.ID, BeforeID: &report.ID}); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Clean the house", "Make the bed", "Call the bank"})
+	assertDescriptions(t, repo, work.ID, []string{"Sweep the floor", "Mop the floor", "Write report"})
+
+	floor.ListID, floor.ParentID, floor.Position = work.ID, nil, 0
+	floor.Version++
+	assertTodo(t, repo, *floor)
+	mop.ListID, mop.Position = work.ID, 1
+	mop.Version++
+	assertTodo(t, repo, *mop)
+
+	history, err := repo.GetTodoHistory(ctx, mop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repository.FieldChange{{Field: "list_id", Old: fmt.Sprint(routine.ID), New: fmt.Sprint(work.ID)}}
+	if diff := cmp.Diff(want, history[len(history)-1].Changes); diff != "" {
+		t.Errorf("GetTodoHistory() last changes mismatch (-want +got):\n%s", diff)
+	}
+
+	// Moving within the todo list leaves subtasks and parent in place
+	if _, err := repo.MoveTodo(ctx, bed.ID, repository.MoveTodoOptions{ListID: routine.ID}); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Clean the house", "Call the bank", "Make the bed"})
+	bed.Version++
+	bed.Position = 2
+	assertTodo(t, repo, *bed)
+
+	// Changing the todo list on an update takes the subtasks to the end
+	house.ListID = work.ID
+	if err := repo.UpdateTodo(ctx, *house); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank"})
+	assertDescriptions(t, repo, work.ID, []string{"Sweep the floor", "Mop the floor", "Write report", "Clean the house", "Make the bed"})
+	bed.ListID, bed.Position = work.ID, 4
+	bed.Version++
+	assertTodo(t, repo, *bed)
+	assertListIDsConsistent(t, repo)
+}
+
+func testSubtaskTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, todos := fillSubtasks(t, repo)
+	house, floor, mop, bed := todos[0], todos[1], todos[2], todos[3]
+
+	// Deleting a todo deletes its subtasks
+	if err := repo.DeleteTodo(clockAt(day(5)), *house); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank"})
+	assertTrash(t, repo, &repository.Trash{
+		Todos: []repository.TrashedTodo{
+			{Todo: *house, DeletedAt: day(5), SubtaskIDs: []uint32{floor.ID, mop.ID, bed.ID}},
+			{Todo: *floor, DeletedAt: day(5)},
+			{Todo: *mop, DeletedAt: day(5)},
+			{Todo: *bed, DeletedAt: day(5)},
+		},
+	})
+
+	// Subtasks can't be restored before their parent
+	_, err := repo.RestoreTodo(ctx, mop.ID)
+	assertErr(t, err, repository.ErrInvalidParent)
+
+	restored, err := repo.RestoreTodo(ctx, house.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	house.Version++
+	house.Position = 1
+	if diff := cmp.Diff(house, restored, ignoreTimestamps); diff != "" {
+		t.Errorf("RestoreTodo() mismatch (-want +got):\n%s", diff)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank", "Clean the house", "Sweep the floor", "Mop the floor", "Make the bed"})
+	mop.Version++
+	mop.Position = 3
+	assertTodo(t, repo, *mop)
+	assertTrash(t, repo, &repository.Trash{})
+
+	// A subtask whose parent is purged comes back as a top-level todo
+	floor.Version++
+	floor.Position = 2
+	if err := repo.DeleteTodo(clockAt(day(6)), *floor); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteTodo(clockAt(day(7)), *house); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeTodo(ctx, house.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetTodoHistory(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+
+	if _, err := repo.RestoreTodo(ctx, floor.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Call the bank", "Sweep the floor", "Mop the floor"})
+	floor.Version++
+	floor.ParentID = nil
+	floor.Position = 1
+	assertTodo(t, repo, *floor)
+	mop.Version++
+	mop.Position = 2
+	assertTodo(t, repo, *mop)
+	assertListIDsConsistent(t, repo)
+
+	// Purging the trash counts the subtasks
+	if err := repo.DeleteTodo(clockAt(day(8)), *floor); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := repo.PurgeTrash(ctx, day(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("got %d purged; want 2", purged)
+	}
+}
+
+// Dependencies
+
+func testAddDependency(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	paint := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Paint the wall"})
+	buy := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Buy paint"})
+	budget := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Get the budget"})
+
+	// Dependencies can cross todo lists
+	if err := repo.AddDependency(clockAt(day(2)), paint.ID, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddDependency(clockAt(day(3)), buy.ID, budget.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Adding it again changes nothing
+	if err := repo.AddDependency(ctx, paint.ID, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	paint.Version++
+	assertTodo(t, repo, *paint)
+	history, err := repo.GetTodoHistory(ctx, paint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repository.HistoryEntry{
+		At:      day(2),
+		Action:  repository.ActionUpdate,
+		Changes: []repository.FieldChange{{Field: "blocked_by", Old: "", New: fmt.Sprint(buy.ID)}},
+	}
+	if diff := cmp.Diff(want, history[len(history)-1]); diff != "" {
+		t.Errorf("GetTodoHistory() last entry mismatch (-want +got):\n%s", diff)
+	}
+
+	type Test struct {
+		name      string
+		id        uint32
+		blockerID uint32
+		want      error
+	}
+
+	lost := budget.ID + 1
+	tests := []Test{
+		{
+			name:      "BlockedByItself",
+			id:        paint.ID,
+			blockerID: paint.ID,
+			want:      repository.ErrDependencyCycle,
+		},
+		{
+			name:      "DirectCycle",
+			id:        buy.ID,
+			blockerID: paint.ID,
+			want:      repository.ErrDependencyCycle,
+		},
+		{
+			name:      "IndirectCycle",
+			id:        budget.ID,
+			blockerID: paint.ID,
+			want:      repository.ErrDependencyCycle,
+		},
+		{
+			name:      "TodoNotFound",
+			id:        lost,
+			blockerID: paint.ID,
+			want:      repository.ErrTodoNotFound,
+		},
+		{
+			name:      "BlockerNotFound",
+			id:        paint.ID,
+			blockerID: lost,
+			want:      repository.ErrTodoNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := repo.AddDependency(ctx, test.id, test.blockerID)
+			assertErr(t, err, test.want)
+			assertTodo(t, repo, *paint)
+		})
+	}
+
+	// Once removed, the other direction is no longer a cycle
+	if err := repo.RemoveDependency(ctx, paint.ID, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = repo.RemoveDependency(ctx, paint.ID, buy.ID)
+	assertErr(t, err, repository.ErrNoDependency)
+	if err := repo.AddDependency(ctx, buy.ID, paint.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	blockers, err := repo.GetBlockers(ctx, buy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Paint the wall", "Get the budget"}, descriptions(blockers)); diff != "" {
+		t.Errorf("GetBlockers() mismatch (-want +got):\n%s", diff)
+	}
+	_, err = repo.GetBlockers(ctx, lost)
+	assertErr(t, err, repository.ErrTodoNotFound)
+}
+
+func testBlockedDone(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	paint := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Paint the wall"})
+	buy := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Buy paint"})
+	if err := repo.AddDependency(ctx, paint.ID, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+	paint.Version++
+
+	done := *paint
+	done.Done = true
+	err := repo.UpdateTodo(ctx, done)
+	assertErr(t, err, repository.ErrBlocked)
+	assertTodo(t, repo, *paint)
+
+	// Other changes to a blocked todo are fine
+	paint.Labels = []string{"diy"}
+	if err := repo.UpdateTodo(ctx, *paint); err != nil {
+		t.Fatal(err)
+	}
+	paint.Version++
+
+	// Forcing it ignores the blockers
+	done = *paint
+	done.Done = true
+	if err := repo.UpdateTodo(repository.WithForce(ctx), done); err != nil {
+		t.Fatal(err)
+	}
+	done.Version++
+	assertTodo(t, repo, done)
+
+	// A done blocker no longer blocks
+	clean := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Clean the brushes"})
+	if err := repo.AddDependency(ctx, clean.ID, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+	buy.Done = true
+	if err := repo.UpdateTodo(ctx, *buy); err != nil {
+		t.Fatal(err)
+	}
+	clean.Done = true
+	clean.Version = 0
+	if err := repo.UpdateTodo(ctx, *clean); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBlockersOnTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	paint := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Paint the wall"})
+	buy := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Buy paint"})
+	brush := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Buy a brush"})
+	for _, blocker := range []*repository.Todo{buy, brush} {
+		if err := repo.AddDependency(ctx, paint.ID, blocker.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleted blockers don't block, but come back when restored
+	if err := repo.DeleteTodo(ctx, *buy); err != nil {
+		t.Fatal(err)
+	}
+	assertBlockers(t, repo, paint.ID, []string{"Buy a brush"})
+	if _, err := repo.RestoreTodo(ctx, buy.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertBlockers(t, repo, paint.ID, []string{"Buy paint", "Buy a brush"})
+
+	// Purged blockers are forgotten
+	if err := repo.DeleteTodo(ctx, *brush); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeTodo(ctx, brush.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertBlockers(t, repo, paint.ID, []string{"Buy paint"})
+
+	err := repo.RemoveDependency(ctx, paint.ID, brush.ID)
+	assertErr(t, err, repository.ErrNoDependency)
+}
+
+func testQueryUnblocked(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine, work := fillQueryFixture(t, repo)
+
+	todos, err := repo.QueryTodos(ctx, repository.TodoQuery{SortBy: repository.SortByID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make the bed (done), Write report, Sweep the floor, Call the bank, Review code (done)
+	bed, report, floor, bank, review := todos.Todos[0], todos.Todos[1], todos.Todos[2], todos.Todos[3], todos.Todos[4]
+	dependencies := [][2]uint32{
+		{floor.ID, bed.ID},
+		{bank.ID, report.ID},
+		{report.ID, review.ID},
+	}
+	for _, dependency := range dependencies {
+		if err := repo.AddDependency(ctx, dependency[0], dependency[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := repo.QueryTodos(ctx, repository.TodoQuery{
+		ListIDs:   []uint32{routine.ID, work.ID},
+		Unblocked: true,
+		SortBy:    repository.SortByID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Make the bed", "Write report", "Sweep the floor", "Review code"}
+	if diff := cmp.Diff(want, descriptions(page.Todos)); diff != "" {
+		t.Errorf("QueryTodos() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Recurrence
+
+func testRecurringDone(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work := mustInsertTodoList(t, repo, "Work")
+	// Monday and Thursday, three times
+	recurrence := repository.Recurrence{
+		Frequency: repository.Weekly,
+		Interval:  1,
+		ByDay:     []time.Weekday{time.Monday, time.Thursday},
+		Count:     3,
+	}
+	report := mustInsertTodo(t, repo, repository.Todo{
+		ListID:      work.ID,
+		Description: "Send weekly report",
+		DueDate:     day(1),
+		Labels:      []string{"office"},
+		Recurrence:  &recurrence,
+	})
+
+	complete := func(todo repository.Todo) {
+		t.Helper()
+
+		todo.Done = true
+		if err := repo.UpdateTodo(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The rule moves over to the next occurrence
+	complete(*report)
+	done := *report
+	done.Done = true
+	done.Recurrence = nil
+	done.Version++
+	assertTodo(t, repo, done)
+
+	next := recurrence
+	next.Count = 2
+	thursday := repository.Todo{
+		ID:          report.ID + 1,
+		ListID:      work.ID,
+		Description: "Send weekly report",
+		DueDate:     day(4),
+		Labels:      []string{"office"},
+		Version:     1,
+		Position:    1,
+		Recurrence:  &next,
+	}
+	assertTodo(t, repo, thursday)
+
+	// Undoing and redoing a completed occurrence doesn't repeat it again
+	undone := done
+	undone.Done = false
+	if err := repo.UpdateTodo(ctx, undone); err != nil {
+		t.Fatal(err)
+	}
+	undone.Version++
+	complete(undone)
+
+	complete(thursday)
+	last := recurrence
+	last.Count = 1
+	monday := thursday
+	monday.ID++
+	monday.DueDate = day(8)
+	monday.Position++
+	monday.Recurrence = &last
+	assertTodo(t, repo, monday)
+
+	// The last occurrence has no next one
+	complete(monday)
+	assertDescriptions(t, repo, work.ID, []string{"Send weekly report", "Send weekly report", "Send weekly report"})
+}
+
+func testRecurringWithoutDueDate(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	recurrence := repository.Recurrence{Frequency: repository.Daily, Interval: 2, Until: day(8)}
+	water := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Water the plants", Recurrence: &recurrence})
+
+	// Without a due date the next one is due counting from the completion
+	water.Done = true
+	if err := repo.UpdateTodo(clockAt(day(5)), *water); err != nil {
+		t.Fatal(err)
+	}
+	todos, err := repo.GetTodosByListID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("got %d todos; want the completed one and its next occurrence", len(todos))
+	}
+	next := todos[1]
+	if !next.DueDate.Equal(day(7)) || next.Done {
+		t.Errorf("got next occurrence due %v and done %v; want due %v and not done", next.DueDate, next.Done, day(7))
+	}
+
+	// Past UNTIL there are no more occurrences
+	next.Done = true
+	if err := repo.UpdateTodo(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+	assertDescriptions(t, repo, routine.ID, []string{"Water the plants", "Water the plants"})
+}
+
+func testRecurrenceInvalid(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+
+	yearly := repository.Recurrence{Frequency: "YEARLY", Interval: 1}
+	_, err := repo.InsertTodo(ctx, repository.Todo{ListID: routine.ID, Description: "Renew the passport", Recurrence: &yearly})
+	assertErr(t, err, repository.ErrInvalidRecurrence)
+	assertDescriptions(t, repo, routine.ID, []string{})
+
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	update := *bed
+	update.Recurrence = &repository.Recurrence{Frequency: repository.Daily, Interval: 1, ByDay: []time.Weekday{time.Monday}}
+	err = repo.UpdateTodo(ctx, update)
+	assertErr(t, err, repository.ErrInvalidRecurrence)
+	assertTodo(t, repo, *bed)
+}
+
+// Labels
+
+func testInsertLabel(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	home := mustInsertLabel(t, repo, repository.Label{Name: "home", Color: "#00ff00", Description: "Around the house"})
+	want := repository.Label{Name: "home", Color: "#00ff00", Description: "Around the house", Version: 1}
+	if diff := cmp.Diff(want, *home, ignoreTimestamps); diff != "" {
+		t.Errorf("InsertLabel() mismatch (-want +got):\n%s", diff)
+	}
+	assertLabel(t, repo, want)
+
+	_, err := repo.InsertLabel(ctx, repository.Label{Name: "home"})
+	assertErr(t, err, repository.ErrLabelExists)
+
+	for _, label := range []repository.Label{
+		{Name: ""},
+		{Name: "home,office"},
+		{Name: "home/office"},
+		{Name: "office", Color: "green"},
+		{Name: "office", Color: "#00ff0"},
+	} {
+		_, err := repo.InsertLabel(ctx, label)
+		assertErr(t, err, repository.ErrInvalidLabel)
+	}
+
+	_, err = repo.GetLabel(ctx, "office")
+	assertErr(t, err, repository.ErrLabelNotFound)
+}
+
+func testUpdateLabel(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	home := mustInsertLabel(t, repo, repository.Label{Name: "home"})
+
+	home.Color = "#ff8800"
+	home.Description = "Around the house"
+	if err := repo.UpdateLabel(ctx, *home); err != nil {
+		t.Fatal(err)
+	}
+	home.Version++
+	assertLabel(t, repo, *home)
+
+	stale := *home
+	stale.Version = 1
+	err := repo.UpdateLabel(ctx, stale)
+	assertErr(t, err, repository.ErrConflict)
+
+	invalid := *home
+	invalid.Color = "orange"
+	err = repo.UpdateLabel(ctx, invalid)
+	assertErr(t, err, repository.ErrInvalidLabel)
+	assertLabel(t, repo, *home)
+
+	err = repo.UpdateLabel(ctx, repository.Label{Name: "office"})
+	assertErr(t, err, repository.ErrLabelNotFound)
+}
+
+func testLabelCounts(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	for _, name := range []string{"urgent", "home", "office"} {
+		mustInsertLabel(t, repo, repository.Label{Name: name})
+	}
+	// Make the bed (home), Write report (office), Sweep the floor (home, urgent),
+	// Call the bank (home), Review code (urgent)
+	routine, _ := fillQueryFixture(t, repo)
+
+	todos, err := repo.GetTodosByListID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Deleted todos are not counted
+	if err := repo.DeleteTodo(ctx, todos[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := repo.GetAllLabels(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repository.Label{
+		{Name: "home", Version: 1, TodoCount: 2},
+		{Name: "office", Version: 1, TodoCount: 1},
+		{Name: "urgent", Version: 1, TodoCount: 2},
+	}
+	if diff := cmp.Diff(want, labels, ignoreTimestamps); diff != "" {
+		t.Errorf("GetAllLabels() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testRenameLabel(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertLabel(t, repo, repository.Label{Name: "hom", Color: "#00ff00"})
+	mustInsertLabel(t, repo, repository.Label{Name: "office"})
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"hom", "bedroom"}})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor", Labels: []string{"home", "hom"}})
+	bank := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Call the bank", Labels: []string{"hom"}})
+	if err := repo.DeleteTodo(ctx, *bank); err != nil {
+		t.Fatal(err)
+	}
+
+	home, err := repo.RenameLabel(clockAt(day(6)), "hom", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repository.Label{Name: "home", Color: "#00ff00", Version: 2, TodoCount: 2}
+	if diff := cmp.Diff(want, *home, ignoreTimestamps); diff != "" {
+		t.Errorf("RenameLabel() mismatch (-want +got):\n%s", diff)
+	}
+	assertLabel(t, repo, want)
+	_, err = repo.GetLabel(ctx, "hom")
+	assertErr(t, err, repository.ErrLabelNotFound)
+
+	// Every todo having it changes, keeping each label once
+	bed.Labels = []string{"home", "bedroom"}
+	bed.Version++
+	assertTodo(t, repo, *bed)
+	floor.Labels = []string{"home"}
+	floor.Version++
+	assertTodo(t, repo, *floor)
+
+	history, err := repo.GetTodoHistory(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntry := repository.HistoryEntry{
+		At:      day(6),
+		Action:  repository.ActionUpdate,
+		Changes: []repository.FieldChange{{Field: "labels", Old: "hom,bedroom", New: "home,bedroom"}},
+	}
+	if diff := cmp.Diff(wantEntry, history[len(history)-1]); diff != "" {
+		t.Errorf("GetTodoHistory() last entry mismatch (-want +got):\n%s", diff)
+	}
+
+	// Todos on the trash change too
+	restored, err := repo.RestoreTodo(ctx, bank.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"home"}, restored.Labels); diff != "" {
+		t.Errorf("restored todo labels mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = repo.RenameLabel(ctx, "home", "office")
+	assertErr(t, err, repository.ErrLabelExists)
+	_, err = repo.RenameLabel(ctx, "home", "home,office")
+	assertErr(t, err, repository.ErrInvalidLabel)
+	_, err = repo.RenameLabel(ctx, "hom", "house")
+	assertErr(t, err, repository.ErrLabelNotFound)
+}
+
+func testDeleteLabel(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertLabel(t, repo, repository.Label{Name: "home"})
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"home", "bedroom"}})
+	bank := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Call the bank"})
+
+	if err := repo.DeleteLabel(ctx, "home"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.GetLabel(ctx, "home")
+	assertErr(t, err, repository.ErrLabelNotFound)
+
+	// The label is taken off the todos having it, leaving the rest alone
+	bed.Labels = []string{"bedroom"}
+	bed.Version++
+	assertTodo(t, repo, *bed)
+	assertTodo(t, repo, *bank)
+
+	err = repo.DeleteLabel(ctx, "home")
+	assertErr(t, err, repository.ErrLabelNotFound)
+}
+
+// Comments
+
+func testInsertComment(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+
+	got, err := repo.InsertComment(clockAt(day(2)), repository.Comment{
+		ID:        42,
+		TodoID:    bed.ID,
+		Author:    "bob",
+		Body:      "It was hard",
+		Version:   7,
+		CreatedAt: day(9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hard := repository.Comment{
+		ID:        0,
+		TodoID:    bed.ID,
+		Author:    "bob",
+		Body:      "It was hard",
+		Version:   1,
+		CreatedAt: day(2),
+		UpdatedAt: day(2),
+	}
+	if diff := cmp.Diff(&hard, got); diff != "" {
+		t.Errorf("InsertComment() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The actor on the context wins over the given author
+	reply, err := repo.InsertComment(repository.WithActor(ctx, "alice"), repository.Comment{TodoID: bed.ID, ParentID: &hard.ID, Author: "bob", Body: "Try harder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Author != "alice" {
+		t.Errorf("got author %q; want %q", reply.Author, "alice")
+	}
+	other := mustInsertComment(t, repo, repository.Comment{TodoID: floor.ID, Body: "Use the broom"})
+	lost := other.ID + 1
+
+	type Test struct {
+		name    string
+		comment repository.Comment
+		want    error
+	}
+
+	tests := []Test{
+		{
+			name:    "EmptyBody",
+			comment: repository.Comment{TodoID: bed.ID, Body: " \n"},
+			want:    repository.ErrEmptyComment,
+		},
+		{
+			name:    "TodoNotFound",
+			comment: repository.Comment{TodoID: floor.ID + 1, Body: "Lost"},
+			want:    repository.ErrTodoNotFound,
+		},
+		{
+			name:    "ReplyToOtherTodo",
+			comment: repository.Comment{TodoID: bed.ID, ParentID: &other.ID, Body: "Lost"},
+			want:    repository.ErrInvalidReply,
+		},
+		{
+			name:    "ReplyToMissingComment",
+			comment: repository.Comment{TodoID: bed.ID, ParentID: &lost, Body: "Lost"},
+			want:    repository.ErrInvalidReply,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.InsertComment(ctx, test.comment)
+			assertErr(t, err, test.want)
+		})
+	}
+
+	// Comments don't change their todo
+	assertTodo(t, repo, *bed)
+	assertComments(t, repo, bed.ID, []repository.Comment{hard, *reply})
+}
+
+func testUpdateComment(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	hard, err := repo.InsertComment(clockAt(day(1)), repository.Comment{TodoID: bed.ID, Author: "bob", Body: "It was hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the body changes
+	changed := *hard
+	changed.Body = "It was easy"
+	changed.Author = "alice"
+	changed.ParentID = &hard.ID
+	if err := repo.UpdateComment(clockAt(day(2)), changed); err != nil {
+		t.Fatal(err)
+	}
+	hard.Body = "It was easy"
+	hard.Version++
+	hard.UpdatedAt = day(2)
+	assertComment(t, repo, *hard)
+
+	stale := *hard
+	stale.Version = 1
+	err = repo.UpdateComment(ctx, stale)
+	assertErr(t, err, repository.ErrConflict)
+
+	empty := *hard
+	empty.Body = ""
+	err = repo.UpdateComment(ctx, empty)
+	assertErr(t, err, repository.ErrEmptyComment)
+	assertComment(t, repo, *hard)
+
+	err = repo.UpdateComment(ctx, repository.Comment{ID: hard.ID + 1, Body: "Lost"})
+	assertErr(t, err, repository.ErrCommentNotFound)
+	_, err = repo.GetComment(ctx, hard.ID+1)
+	assertErr(t, err, repository.ErrCommentNotFound)
+	assertTodo(t, repo, *bed)
+}
+
+func testDeleteComment(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	hard := mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, Body: "It was hard"})
+	harder := mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, ParentID: &hard.ID, Body: "Try harder"})
+	sheets := mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, Body: "Change the sheets"})
+	mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, ParentID: &harder.ID, Body: "I did"})
+
+	stale := *hard
+	stale.Version = 2
+	err := repo.DeleteComment(ctx, stale)
+	assertErr(t, err, repository.ErrConflict)
+
+	// Replies go away too, at any depth
+	if err := repo.DeleteComment(ctx, *hard); err != nil {
+		t.Fatal(err)
+	}
+	assertComments(t, repo, bed.ID, []repository.Comment{*sheets})
+
+	err = repo.DeleteComment(ctx, *harder)
+	assertErr(t, err, repository.ErrCommentNotFound)
+	_, err = repo.InsertComment(ctx, repository.Comment{TodoID: bed.ID, ParentID: &hard.ID, Body: "Too late"})
+	assertErr(t, err, repository.ErrInvalidReply)
+
+	// IDs are never reused
+	late := mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, Body: "Too late"})
+	if late.ID != 4 {
+		t.Errorf("got comment ID %d; want 4", late.ID)
+	}
+}
+
+func testCommentsOnTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	hard := mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, Body: "It was hard"})
+
+	// Comments of deleted todos are hidden
+	if err := repo.DeleteTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.GetComments(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+	_, err = repo.GetComment(ctx, hard.ID)
+	assertErr(t, err, repository.ErrCommentNotFound)
+	err = repo.UpdateComment(ctx, repository.Comment{ID: hard.ID, Body: "Hidden"})
+	assertErr(t, err, repository.ErrCommentNotFound)
+	_, err = repo.InsertComment(ctx, repository.Comment{TodoID: bed.ID, Body: "Hidden"})
+	assertErr(t, err, repository.ErrTodoNotFound)
+
+	// and come back with them
+	restored, err := repo.RestoreTodo(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertComments(t, repo, bed.ID, []repository.Comment{*hard})
+
+	// Purging the todo drops them for good
+	if err := repo.DeleteTodo(ctx, *restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeTodo(ctx, bed.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetComment(ctx, hard.ID)
+	assertErr(t, err, repository.ErrCommentNotFound)
+}
+
+func testSearchComments(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	home := mustInsertTodoList(t, repo, "Home")
+	rent := mustInsertTodo(t, repo, repository.Todo{ListID: home.ID, Description: "Pay the rent"})
+	query := repository.SearchQuery{Text: "invoice"}
+
+	// Every comment of a todo is searched, and queried by text
+	mustInsertComment(t, repo, repository.Comment{TodoID: rent.ID, Body: "Before the 5th"})
+	ask := mustInsertComment(t, repo, repository.Comment{TodoID: rent.ID, Body: "Ask for an invoice"})
+	assertSearch(t, repo, query, []string{"Home/Pay the rent"})
+	page, err := repo.QueryTodos(ctx, repository.TodoQuery{Text: "INVOICE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Pay the rent"}, descriptions(page.Todos)); diff != "" {
+		t.Errorf("QueryTodos() mismatch (-want +got):\n%s", diff)
+	}
+
+	ask.Body = "Ask for a receipt"
+	if err := repo.UpdateComment(ctx, *ask); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{})
+	assertSearch(t, repo, repository.SearchQuery{Text: "receipt"}, []string{"Home/Pay the rent"})
+
+	ask.Version++
+	if err := repo.DeleteComment(ctx, *ask); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, repository.SearchQuery{Text: "receipt"}, []string{})
+}
+
+// Attachments
+
+// Hashes of made up content, any 64 hex digits will do
+var (
+	screenshotHash = strings.Repeat("a", 64)
+	invoiceHash    = strings.Repeat("b", 64)
+)
+
+func testInsertAttachment(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+
+	got, err := repo.InsertAttachment(clockAt(day(2)), repository.Attachment{
+		ID:          42,
+		TodoID:      bed.ID,
+		Name:        "bed.png",
+		ContentType: "image/png",
+		Size:        2048,
+		Hash:        screenshotHash,
+		CreatedAt:   day(9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	screenshot := repository.Attachment{
+		ID:          0,
+		TodoID:      bed.ID,
+		Name:        "bed.png",
+		ContentType: "image/png",
+		Size:        2048,
+		Hash:        screenshotHash,
+		CreatedAt:   day(2),
+	}
+	if diff := cmp.Diff(&screenshot, got); diff != "" {
+		t.Errorf("InsertAttachment() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The same content can be attached many times
+	again := mustInsertAttachment(t, repo, repository.Attachment{TodoID: bed.ID, Name: "again.png", Hash: screenshotHash})
+
+	type Test struct {
+		name       string
+		attachment repository.Attachment
+		want       error
+	}
+
+	tests := []Test{
+		{
+			name:       "TodoNotFound",
+			attachment: repository.Attachment{TodoID: bed.ID + 1, Name: "bed.png", Hash: screenshotHash},
+			want:       repository.ErrTodoNotFound,
+		},
+		{
+			name:       "EmptyName",
+			attachment: repository.Attachment{TodoID: bed.ID, Name: " ", Hash: screenshotHash},
+			want:       repository.ErrInvalidAttachment,
+		},
+		{
+			name:       "NameWithDirectory",
+			attachment: repository.Attachment{TodoID: bed.ID, Name: "../bed.png", Hash: screenshotHash},
+			want:       repository.ErrInvalidAttachment,
+		},
+		{
+			name:       "InvalidHash",
+			attachment: repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: "bed"},
+			want:       repository.ErrInvalidAttachment,
+		},
+		{
+			name:       "NegativeSize",
+			attachment: repository.Attachment{TodoID: bed.ID, Name: "bed.png", Size: -1, Hash: screenshotHash},
+			want:       repository.ErrInvalidAttachment,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.InsertAttachment(ctx, test.attachment)
+			assertErr(t, err, test.want)
+		})
+	}
+
+	// Attachments don't change their todo
+	assertTodo(t, repo, *bed)
+	assertAttachments(t, repo, bed.ID, []repository.Attachment{screenshot, *again})
+	assertAttachmentHashes(t, repo, []string{screenshotHash})
+}
+
+func testDeleteAttachment(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	screenshot := mustInsertAttachment(t, repo, repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: screenshotHash})
+	invoice := mustInsertAttachment(t, repo, repository.Attachment{TodoID: bed.ID, Name: "invoice.pdf", Hash: invoiceHash})
+
+	if err := repo.DeleteAttachment(ctx, screenshot.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertAttachments(t, repo, bed.ID, []repository.Attachment{*invoice})
+	assertAttachmentHashes(t, repo, []string{invoiceHash})
+
+	err := repo.DeleteAttachment(ctx, screenshot.ID)
+	assertErr(t, err, repository.ErrAttachmentNotFound)
+	_, err = repo.GetAttachment(ctx, screenshot.ID)
+	assertErr(t, err, repository.ErrAttachmentNotFound)
+
+	// IDs are never reused
+	late := mustInsertAttachment(t, repo, repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: screenshotHash})
+	if late.ID != 2 {
+		t.Errorf("got attachment ID %d; want 2", late.ID)
+	}
+}
+
+func testAttachmentsOnTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	screenshot := mustInsertAttachment(t, repo, repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: screenshotHash})
+
+	// Attachments of deleted todos are hidden, but their content is still
+	// needed to restore them
+	if err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := repo.GetAttachments(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+	_, err = repo.GetAttachment(ctx, screenshot.ID)
+	assertErr(t, err, repository.ErrAttachmentNotFound)
+	err = repo.DeleteAttachment(ctx, screenshot.ID)
+	assertErr(t, err, repository.ErrAttachmentNotFound)
+	_, err = repo.InsertAttachment(ctx, repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: screenshotHash})
+	assertErr(t, err, repository.ErrTodoNotFound)
+	assertAttachmentHashes(t, repo, []string{screenshotHash})
+
+	// and come back with them
+	if _, err := repo.RestoreTodoList(ctx, routine.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertAttachments(t, repo, bed.ID, []repository.Attachment{*screenshot})
+
+	// Purging the todo list drops them for good
+	if err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeTodoList(ctx, routine.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetAttachment(ctx, screenshot.ID)
+	assertErr(t, err, repository.ErrAttachmentNotFound)
+	assertAttachmentHashes(t, repo, []string{})
+}
+
+// Users
+
+func testInsertUser(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	got, err := repo.InsertUser(clockAt(day(2)), repository.User{Name: "alice", DisplayName: "Alice", CreatedAt: day(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := repository.User{Name: "alice", DisplayName: "Alice", CreatedAt: day(2)}
+	if diff := cmp.Diff(&alice, got); diff != "" {
+		t.Errorf("InsertUser() mismatch (-want +got):\n%s", diff)
+	}
+	bob := mustInsertUser(t, repo, "bob.smith@example.com")
+
+	type Test struct {
+		name string
+		user repository.User
+		want error
+	}
+
+	tests := []Test{
+		{
+			name: "Exists",
+			user: repository.User{Name: "alice"},
+			want: repository.ErrUserExists,
+		},
+		{
+			name: "EmptyName",
+			user: repository.User{DisplayName: "Nobody"},
+			want: repository.ErrInvalidUser,
+		},
+		{
+			name: "NameWithSpace",
+			user: repository.User{Name: "carol smith"},
+			want: repository.ErrInvalidUser,
+		},
+		{
+			name: "NameWithColon",
+			user: repository.User{Name: "carol:owner"},
+			want: repository.ErrInvalidUser,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.InsertUser(ctx, test.user)
+			assertErr(t, err, test.want)
+		})
+	}
+
+	got, err = repo.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&alice, got); diff != "" {
+		t.Errorf("GetUser() mismatch (-want +got):\n%s", diff)
+	}
+	_, err = repo.GetUser(ctx, "carol")
+	assertErr(t, err, repository.ErrUserNotFound)
+
+	users, err := repo.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]repository.User{alice, *bob}, users, ignoreTimestamps); diff != "" {
+		t.Errorf("GetAllUsers() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testTodoListOwner(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertUser(t, repo, "bob")
+
+	// The owner comes from the actor, never from the todo list given
+	work, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{
+		Title:   "Work",
+		Owner:   "bob",
+		Members: []repository.Member{{User: "bob", Role: repository.RoleOwner}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repository.TodoList{ID: work.ID, Title: "Work", Version: 1, Owner: "alice"}
+	if diff := cmp.Diff(&want, work, ignoreTimestamps); diff != "" {
+		t.Errorf("InsertTodoList() mismatch (-want +got):\n%s", diff)
+	}
+
+	routine := mustInsertTodoList(t, repo, "Routine")
+	if routine.Owner != "" {
+		t.Errorf("got owner %q for a todo list inserted with no actor; want none", routine.Owner)
+	}
+
+	// and updates keep both the owner and the members
+	work, err = repo.ShareTodoList(ctx, work.ID, repository.Member{User: "bob", Role: repository.RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.UpdateTodoList(repository.WithActor(ctx, "bob"), repository.TodoList{ID: work.ID, Title: "Office", Owner: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = repository.TodoList{
+		ID:      work.ID,
+		Title:   "Office",
+		Version: 3,
+		Owner:   "alice",
+		Members: []repository.Member{{User: "bob", Role: repository.RoleViewer}},
+	}
+	assertTodoList(t, repo, want)
+}
+
+func testShareTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	for _, name := range []string{"bob", "carol"} {
+		mustInsertUser(t, repo, name)
+	}
+	work, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares := []repository.Member{
+		{User: "carol", Role: repository.RoleViewer},
+		{User: "bob", Role: repository.RoleViewer},
+		// Sharing again replaces the role
+		{User: "bob", Role: repository.RoleEditor},
+	}
+	for _, member := range shares {
+		if _, err := repo.ShareTodoList(repository.WithActor(ctx, "alice"), work.ID, member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := repository.TodoList{
+		ID:      work.ID,
+		Title:   "Work",
+		Version: 4,
+		Owner:   "alice",
+		Members: []repository.Member{
+			{User: "bob", Role: repository.RoleEditor},
+			{User: "carol", Role: repository.RoleViewer},
+		},
+	}
+	assertTodoList(t, repo, want)
+
+	type Test struct {
+		name   string
+		id     uint32
+		member repository.Member
+		want   error
+	}
+
+	tests := []Test{
+		{
+			name:   "TodoListNotFound",
+			id:     work.ID + 1,
+			member: repository.Member{User: "bob", Role: repository.RoleViewer},
+			want:   repository.ErrTodoListNotFound,
+		},
+		{
+			name:   "UserNotFound",
+			id:     work.ID,
+			member: repository.Member{User: "dave", Role: repository.RoleViewer},
+			want:   repository.ErrUserNotFound,
+		},
+		{
+			name:   "InvalidRole",
+			id:     work.ID,
+			member: repository.Member{User: "bob", Role: "admin"},
+			want:   repository.ErrInvalidRole,
+		},
+		{
+			name:   "EmptyRole",
+			id:     work.ID,
+			member: repository.Member{User: "bob"},
+			want:   repository.ErrInvalidRole,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.ShareTodoList(ctx, test.id, test.member)
+			assertErr(t, err, test.want)
+		})
+	}
+
+	// The owner is never a member
+	mustInsertUser(t, repo, "alice")
+	_, err = repo.ShareTodoList(ctx, work.ID, repository.Member{User: "alice", Role: repository.RoleViewer})
+	assertErr(t, err, repository.ErrOwnerMember)
+	assertTodoList(t, repo, want)
+
+	history, err := repo.GetTodoListHistory(ctx, work.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChange := repository.FieldChange{Field: "members", Old: "bob:viewer,carol:viewer", New: "bob:editor,carol:viewer"}
+	if diff := cmp.Diff([]repository.FieldChange{wantChange}, history[len(history)-1].Changes); diff != "" {
+		t.Errorf("history of the last share mismatch (-want +got):\n%s", diff)
+	}
+
+	// Todo lists on the trash can't be shared
+	if err := repo.DeleteTodoListByID(ctx, work.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.ShareTodoList(ctx, work.ID, repository.Member{User: "bob", Role: repository.RoleOwner})
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testUnshareTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	for _, name := range []string{"bob", "carol"} {
+		mustInsertUser(t, repo, name)
+	}
+	work, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bob", "carol"} {
+		if _, err := repo.ShareTodoList(ctx, work.ID, repository.Member{User: name, Role: repository.RoleEditor}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.UnshareTodoList(ctx, work.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repository.TodoList{
+		ID:      work.ID,
+		Title:   "Work",
+		Version: 4,
+		Owner:   "alice",
+		Members: []repository.Member{{User: "carol", Role: repository.RoleEditor}},
+	}
+	if diff := cmp.Diff(&want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("UnshareTodoList() mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = repo.UnshareTodoList(ctx, work.ID, "bob")
+	assertErr(t, err, repository.ErrNotMember)
+	_, err = repo.UnshareTodoList(ctx, work.ID, "alice")
+	assertErr(t, err, repository.ErrNotMember)
+	_, err = repo.UnshareTodoList(ctx, work.ID+1, "carol")
+	assertErr(t, err, repository.ErrTodoListNotFound)
+
+	// Changing the returned todo list changes nothing stored
+	got, err = repo.UnshareTodoList(ctx, work.ID, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Version++
+	want.Members = nil
+	if diff := cmp.Diff(&want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("UnshareTodoList() mismatch (-want +got):\n%s", diff)
+	}
+	shared, err := repo.ShareTodoList(ctx, work.ID, repository.Member{User: "bob", Role: repository.RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared.Members[0].Role = repository.RoleOwner
+	want.Version++
+	want.Members = []repository.Member{{User: "bob", Role: repository.RoleViewer}}
+	assertTodoList(t, repo, want)
+}
+
+// Feeds
+
+func testFeedToken(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work, err := repo.InsertTodoList(repository.WithActor(ctx, "alice"), repository.TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := repo.InsertTodoList(ctx, repository.TodoList{Title: "Home", FeedTokenHash: repository.HashToken("ignored")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if home.FeedTokenHash != "" {
+		t.Errorf("InsertTodoList() kept feed token hash %q; want none", home.FeedTokenHash)
+	}
+	_, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken("ignored"))
+	assertErr(t, err, repository.ErrTodoListNotFound)
+
+	got, err := repo.SetFeedToken(ctx, work.ID, repository.HashToken("work feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The feed token is no change of the todo list itself
+	want := *work
+	want.FeedTokenHash = repository.HashToken("work feed")
+	if diff := cmp.Diff(&want, got); diff != "" {
+		t.Errorf("SetFeedToken() mismatch (-want +got):\n%s", diff)
+	}
+	assertTodoList(t, repo, want)
+	if _, err := repo.SetFeedToken(ctx, home.ID, repository.HashToken("home feed")); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.GetTodoListByFeedToken(ctx, repository.HashToken("work feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, found); diff != "" {
+		t.Errorf("GetTodoListByFeedToken() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Updating the todo list keeps its feed
+	update := *work
+	update.Title = "Office"
+	if err := repo.UpdateTodoList(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+	found, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken("work feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Title != "Office" {
+		t.Errorf("GetTodoListByFeedToken() after update got title %q; want %q", found.Title, "Office")
+	}
+
+	// A new token replaces the old one, and an empty one turns it off
+	if _, err := repo.SetFeedToken(ctx, work.ID, repository.HashToken("new work feed")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken("work feed"))
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	got, err = repo.SetFeedToken(ctx, work.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FeedTokenHash != "" {
+		t.Errorf("SetFeedToken() with no hash kept %q", got.FeedTokenHash)
+	}
+	_, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken("new work feed"))
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	_, err = repo.GetTodoListByFeedToken(ctx, "")
+	assertErr(t, err, repository.ErrTodoListNotFound)
+
+	_, err = repo.SetFeedToken(ctx, home.ID+1, repository.HashToken("feed"))
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testFeedTokenOnTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work, err := repo.InsertTodoList(ctx, repository.TodoList{Title: "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetFeedToken(ctx, work.ID, repository.HashToken("feed")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The feed of a deleted todo list is gone until it is restored
+	if err := repo.DeleteTodoListByID(ctx, work.ID, repository.DeleteTodoListOptions{Policy: repository.DeleteCascade}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetTodoListByFeedToken(ctx, repository.HashToken("feed"))
+	assertErr(t, err, repository.ErrTodoListNotFound)
+
+	if _, err := repo.RestoreTodoList(ctx, work.ID); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.GetTodoListByFeedToken(ctx, repository.HashToken("feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != work.ID {
+		t.Errorf("GetTodoListByFeedToken() got todo list %d; want %d", found.ID, work.ID)
+	}
+}
+
+// Tokens
+
+func testInsertToken(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertUser(t, repo, "alice")
+
+	token := repository.Token{
+		ID:        42,
+		User:      "alice",
+		Name:      "laptop",
+		Hash:      repository.HashToken("secret"),
+		Scopes:    []repository.Scope{repository.ScopeRead, repository.ScopeWrite},
+		CreatedAt: day(9),
+	}
+	got, err := repo.InsertToken(clockAt(day(2)), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := token
+	want.ID = 0
+	want.CreatedAt = day(2)
+	if diff := cmp.Diff(&want, got); diff != "" {
+		t.Errorf("InsertToken() mismatch (-want +got):\n%s", diff)
+	}
+
+	type Test struct {
+		name  string
+		token repository.Token
+		want  error
+	}
+
+	valid := repository.Token{User: "alice", Hash: repository.HashToken("other"), Scopes: []repository.Scope{repository.ScopeRead}}
+	withUser := func(user string) repository.Token { token := valid; token.User = user; return token }
+	withHash := func(hash string) repository.Token { token := valid; token.Hash = hash; return token }
+	withScopes := func(scopes ...repository.Scope) repository.Token { token := valid; token.Scopes = scopes; return token }
+
+	tests := []Test{
+		{
+			name:  "UnknownUser",
+			token: withUser("bob"),
+			want:  repository.ErrUserNotFound,
+		},
+		{
+			name:  "EmptyHash",
+			token: withHash(""),
+			want:  repository.ErrInvalidToken,
+		},
+		{
+			name:  "SecretAsHash",
+			token: withHash("secret"),
+			want:  repository.ErrInvalidToken,
+		},
+		{
+			name:  "NoScopes",
+			token: withScopes(),
+			want:  repository.ErrInvalidToken,
+		},
+		{
+			name:  "UnknownScope",
+			token: withScopes(repository.ScopeRead, "delete"),
+			want:  repository.ErrInvalidToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := repo.InsertToken(ctx, test.token)
+			assertErr(t, err, test.want)
+		})
+	}
+
+	// Changing the returned token changes nothing stored
+	got.Scopes[0] = repository.ScopeAdmin
+	stored, err := repo.GetToken(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, stored); diff != "" {
+		t.Errorf("GetToken() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testGetTokens(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		mustInsertUser(t, repo, name)
+	}
+
+	wantNames := map[string][]string{"alice": {}, "bob": {}, "carol": {}}
+	for i, user := range []string{"alice", "bob", "alice", "alice"} {
+		name := fmt.Sprintf("token %d", i)
+		token := repository.Token{User: user, Name: name, Hash: repository.HashToken(name), Scopes: []repository.Scope{repository.ScopeRead}}
+		if _, err := repo.InsertToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		wantNames[user] = append(wantNames[user], name)
+	}
+
+	for user, want := range wantNames {
+		tokens, err := repo.GetTokens(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, token := range tokens {
+			got = append(got, token.Name)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("GetTokens(%q) mismatch (-want +got):\n%s", user, diff)
+		}
+	}
+	_, err := repo.GetTokens(ctx, "dave")
+	assertErr(t, err, repository.ErrUserNotFound)
+
+	got, err := repo.GetTokenByHash(ctx, repository.HashToken("token 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 2 || got.User != "alice" {
+		t.Errorf("GetTokenByHash() = %+v; want token 2 of alice", got)
+	}
+	_, err = repo.GetTokenByHash(ctx, repository.HashToken("token 4"))
+	assertErr(t, err, repository.ErrTokenNotFound)
+	_, err = repo.GetToken(ctx, 4)
+	assertErr(t, err, repository.ErrTokenNotFound)
+}
+
+func testDeleteToken(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertUser(t, repo, "alice")
+
+	token := repository.Token{User: "alice", Hash: repository.HashToken("secret"), Scopes: []repository.Scope{repository.ScopeAdmin}}
+	inserted, err := repo.InsertToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteToken(ctx, inserted.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = repo.DeleteToken(ctx, inserted.ID)
+	assertErr(t, err, repository.ErrTokenNotFound)
+	_, err = repo.GetTokenByHash(ctx, token.Hash)
+	assertErr(t, err, repository.ErrTokenNotFound)
+
+	// IDs are not reused
+	again, err := repo.InsertToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID == inserted.ID {
+		t.Errorf("got ID %d again after deleting it", again.ID)
+	}
+}
+
+// Backups
+
+// fillBackup puts a bit of everything on repo.
+func fillBackup(t *testing.T, repo repository.Repository) {
+	t.Helper()
+
+	mustInsertUser(t, repo, "alice")
+	if _, err := repo.InsertToken(ctx, repository.Token{User: "alice", Name: "laptop", Hash: repository.HashToken("secret"), Scopes: []repository.Scope{repository.ScopeRead}}); err != nil {
+		t.Fatal(err)
+	}
+	mustInsertLabel(t, repo, repository.Label{Name: "home", Color: "#00ff00"})
+
+	aliceCtx := repository.WithActor(ctx, "alice")
+	routine, err := repo.InsertTodoList(aliceCtx, repository.TodoList{Title: "Routine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := mustInsertTodoList(t, repo, "Work")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"home"}})
+	sheets := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Change the sheets", ParentID: &bed.ID})
+	laundry := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Do the laundry"})
+	invoice := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Send the invoice"})
+	if _, err := repo.MoveTodo(ctx, laundry.ID, repository.MoveTodoOptions{ListID: routine.ID, BeforeID: &bed.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddDependency(ctx, bed.ID, sheets.ID); err != nil {
+		t.Fatal(err)
+	}
+	mustInsertComment(t, repo, repository.Comment{TodoID: bed.ID, Body: "Every morning"})
+	mustInsertAttachment(t, repo, repository.Attachment{TodoID: invoice.ID, Name: "invoice.pdf", Hash: strings.Repeat("ab", 32)})
+	if err := repo.DeleteTodo(ctx, *invoice); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteTodoListByID(ctx, work.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBackupRoundTrip(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	fillBackup(t, repo)
+
+	backup, err := repo.Backup(clockAt(day(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Version != repository.BackupVersion || !backup.CreatedAt.Equal(day(3)) {
+		t.Errorf("got backup version %d created at %v; want %d at %v", backup.Version, backup.CreatedAt, repository.BackupVersion, day(3))
+	}
+	wantAutoincrements := repository.Autoincrements{TodoList: 2, Todo: 4, Comment: 1, Attachment: 1, Token: 1}
+	if diff := cmp.Diff(wantAutoincrements, backup.Autoincrements); diff != "" {
+		t.Errorf("Autoincrements mismatch (-want +got):\n%s", diff)
+	}
+	gotOrder := []string{}
+	for _, todo := range backup.Todos {
+		gotOrder = append(gotOrder, todo.Description)
+	}
+	wantOrder := []string{"Do the laundry", "Make the bed", "Change the sheets"}
+	if diff := cmp.Diff(wantOrder, gotOrder); diff != "" {
+		t.Errorf("Todos order mismatch (-want +got):\n%s", diff)
+	}
+
+	restored := newRepo(t)
+	mustInsertTodoList(t, restored, "Replaced")
+	if err := restored.Restore(ctx, *backup, repository.RestoreReplace); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.Backup(clockAt(day(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(backup, got); diff != "" {
+		t.Errorf("Backup() after Restore() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Restored repositories keep going from the autoincrement counters
+	newTodoList := mustInsertTodoList(t, restored, "Groceries")
+	if newTodoList.ID != wantAutoincrements.TodoList {
+		t.Errorf("got new todo list ID %d; want %d", newTodoList.ID, wantAutoincrements.TodoList)
+	}
+	hits, err := restored.Search(ctx, repository.SearchQuery{Text: "laundry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Errorf("got %d search hits on the restored todos; want 1", len(hits))
+	}
+	blockers, err := restored.GetBlockers(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockers) != 1 || blockers[0].ID != 1 {
+		t.Errorf("got blockers %v of the restored todo; want todo 1", blockers)
+	}
+}
+
+func testRestoreMerge(t *testing.T, newRepo Factory) {
+	source := newRepo(t)
+	fillBackup(t, source)
+	backup, err := source.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newRepo(t)
+	mustInsertTodoList(t, repo, "Old routine")
+	mustInsertTodoList(t, repo, "Old work")
+	groceries := mustInsertTodoList(t, repo, "Groceries")
+	milk := mustInsertTodo(t, repo, repository.Todo{ListID: groceries.ID, Description: "Buy milk"})
+	mustInsertUser(t, repo, "bob")
+
+	if err := repo.Restore(ctx, *backup, repository.RestoreMerge); err != nil {
+		t.Fatal(err)
+	}
+
+	todoLists, err := repo.GetAllTodoLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(todoLists, func(i, j int) bool { return todoLists[i].ID < todoLists[j].ID })
+	gotTitles := []string{}
+	for _, todoList := range todoLists {
+		gotTitles = append(gotTitles, todoList.Title)
+	}
+	// Work, with ID 1, is on the trash of the backup
+	wantTitles := []string{"Routine", "Groceries"}
+	if diff := cmp.Diff(wantTitles, gotTitles); diff != "" {
+		t.Errorf("todo list titles mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := repo.GetTodoByID(ctx, milk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Description != "Make the bed" {
+		t.Errorf("got todo %d %q; want it replaced by the one on the backup", milk.ID, got.Description)
+	}
+	users, err := repo.GetAllUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("got %d users; want the one kept and the one restored", len(users))
+	}
+
+	// Counters never go back
+	newTodoList := mustInsertTodoList(t, repo, "Chores")
+	if newTodoList.ID != 3 {
+		t.Errorf("got new todo list ID %d; want 3", newTodoList.ID)
+	}
+}
+
+func testRestoreMergeTrashedTodoList(t *testing.T, newRepo Factory) {
+	source := newRepo(t)
+	fillBackup(t, source)
+	backup, err := source.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Old routine")
+	work := mustInsertTodoList(t, repo, "Old work")
+	groceries := mustInsertTodoList(t, repo, "Groceries")
+	// Todos 0 to 3 are replaced by the ones on the backup
+	var replaced *repository.Todo
+	for i := 0; i < 4; i++ {
+		replaced = mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Replaced"})
+	}
+	mustInsertComment(t, repo, repository.Comment{TodoID: replaced.ID, Body: "Replaced"})
+	mustInsertAttachment(t, repo, repository.Attachment{TodoID: replaced.ID, Name: "replaced.txt", Hash: strings.Repeat("cd", 32)})
+	// Work, with ID 1, is on the trash of the backup, so its todos go
+	client := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Call the client"})
+	comment := mustInsertComment(t, repo, repository.Comment{TodoID: client.ID, Body: "Before noon"})
+	attachment := mustInsertAttachment(t, repo, repository.Attachment{TodoID: client.ID, Name: "contract.pdf", Hash: strings.Repeat("ef", 32)})
+	milk := mustInsertTodo(t, repo, repository.Todo{ListID: groceries.ID, Description: "Buy milk"})
+	if err := repo.AddDependency(ctx, milk.ID, client.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Restore(ctx, *backup, repository.RestoreMerge); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetTodoByID(ctx, client.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+	comments, err := repo.GetComments(ctx, client.ID)
+	if err != nil && !errors.Is(err, repository.ErrTodoNotFound) {
+		t.Fatal(err)
+	}
+	if len(comments) != 0 {
+		t.Errorf("got comments %v of the dropped todo; want none", comments)
+	}
+	backup, err = repo.Backup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range backup.Comments {
+		if got.ID == comment.ID {
+			t.Errorf("got comment %d of the dropped todo after merging", got.ID)
+		}
+	}
+	for _, got := range backup.Attachments {
+		if got.ID == attachment.ID {
+			t.Errorf("got attachment %d of the dropped todo after merging", got.ID)
+		}
+	}
+
+	kept, err := repo.GetTodoByID(ctx, milk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.Description != "Buy milk" {
+		t.Errorf("got todo %d %q; want it kept", milk.ID, kept.Description)
+	}
+	blockers, err := repo.GetBlockers(ctx, milk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockers) != 0 {
+		t.Errorf("got blockers %v of the kept todo; want the dropped one gone", blockers)
+	}
+}
+
+func testRestoreInvalid(t *testing.T, newRepo Factory) {
+	type Test struct {
+		name   string
+		backup repository.Backup
+	}
+
+	valid := func() repository.Backup {
+		return repository.Backup{
+			Version:   repository.BackupVersion,
+			TodoLists: []repository.TodoList{{ID: 0, Title: "Routine"}},
+			Todos:     []repository.Todo{{ID: 0, ListID: 0, Description: "Make the bed"}},
+		}
+	}
+
+	tests := []Test{
+		{
+			name:   "Version",
+			backup: func() repository.Backup { b := valid(); b.Version = 99; return b }(),
+		},
+		{
+			name:   "TodoOnUnknownList",
+			backup: func() repository.Backup { b := valid(); b.Todos[0].ListID = 7; return b }(),
+		},
+		{
+			name: "RepeatedTodo",
+			backup: func() repository.Backup {
+				b := valid()
+				b.Todos = append(b.Todos, b.Todos[0])
+				return b
+			}(),
+		},
+		{
+			name: "UnknownBlocker",
+			backup: func() repository.Backup {
+				b := valid()
+				b.Dependencies = []repository.Dependency{{TodoID: 0, BlockerID: 5}}
+				return b
+			}(),
+		},
+		{
+			name: "TokenOfUnknownUser",
+			backup: func() repository.Backup {
+				b := valid()
+				b.Tokens = []repository.Token{{ID: 0, User: "alice", Hash: repository.HashToken("secret"), Scopes: []repository.Scope{repository.ScopeRead}}}
+				return b
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newRepo(t)
+			mustInsertTodoList(t, repo, "Kept")
+
+			err := repo.Restore(ctx, test.backup, repository.RestoreReplace)
+			assertErr(t, err, repository.ErrInvalidBackup)
+
+			todoLists, err := repo.GetAllTodoLists(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(todoLists) != 1 || todoLists[0].Title != "Kept" {
+				t.Errorf("got todo lists %v after a failed restore; want them unchanged", todoLists)
+			}
+		})
+	}
+}
+
+// Search
+
+func testSearchMatch(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work := mustInsertTodoList(t, repo, "Work invoices")
+	home := mustInsertTodoList(t, repo, "Home")
+	invoice := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Send the invoice"})
+	mustInsertComment(t, repo, repository.Comment{TodoID: invoice.ID, Body: "To ACME, Inc."})
+	rent := mustInsertTodo(t, repo, repository.Todo{ListID: home.ID, Description: "Pay the rent"})
+	mustInsertComment(t, repo, repository.Comment{TodoID: rent.ID, Body: "Ask for an invoice"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: home.ID, Description: "Call the bank", Labels: []string{"invoicing"}})
+	mustInsertTodo(t, repo, repository.Todo{ListID: home.ID, Description: "Sweep the floor"})
+
+	type Test struct {
+		name string
+		text string
+		want []string
+	}
+
+	tests := []Test{
+		{
+			name: "IgnoresCase",
+			text: "INVOICE",
+			want: []string{"Work invoices/Send the invoice", "Work invoices", "Home/Pay the rent"},
+		},
+		{
+			name: "Prefix",
+			text: "invo",
+			want: []string{"Work invoices", "Work invoices/Send the invoice", "Home/Call the bank", "Home/Pay the rent"},
+		},
+		{
+			name: "EveryWord",
+			text: "invoice rent",
+			want: []string{"Home/Pay the rent"},
+		},
+		{
+			name: "IgnoresPunctuation",
+			text: "acme, inc",
+			want: []string{"Work invoices/Send the invoice"},
+		},
+		{
+			name: "NoMatch",
+			text: "receipt",
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertSearch(t, repo, repository.SearchQuery{Text: test.text}, test.want)
+		})
+	}
+
+	// Hits say where the words matched and carry their todo list
+	hits, err := repo.Search(ctx, repository.SearchQuery{Text: "invoic", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits; want 1", len(hits))
+	}
+	if diff := cmp.Diff([]string{"title"}, hits[0].Fields); diff != "" {
+		t.Errorf("hit fields mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(*work, hits[0].TodoList, ignoreTimestamps); diff != "" {
+		t.Errorf("hit todo list mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func testSearchRanking(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	plants := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Water the plants"})
+	mustInsertComment(t, repo, repository.Comment{TodoID: plants.ID, Body: "Report on the garden"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Write the report"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Read reports", Labels: []string{"report"}})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Review reporting"})
+
+	// Rare words weigh more than common ones, descriptions more than
+	// comments, and each field having the word adds up
+	assertSearch(t, repo, repository.SearchQuery{Text: "report"}, []string{
+		"Routine/Read reports",
+		"Routine/Write the report",
+		"Routine/Review reporting",
+		"Routine/Water the plants",
+	})
+	assertSearch(t, repo, repository.SearchQuery{Text: "report", Limit: 2}, []string{
+		"Routine/Read reports",
+		"Routine/Write the report",
+	})
+}
+
+func testSearchFollowsWrites(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertLabel(t, repo, repository.Label{Name: "paperwork"})
+	work := mustInsertTodoList(t, repo, "Work")
+	home := mustInsertTodoList(t, repo, "Home")
+	invoice := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Send the invoice", Labels: []string{"paperwork"}})
+	rent := mustInsertTodo(t, repo, repository.Todo{ListID: home.ID, Description: "Pay the rent"})
+	query := repository.SearchQuery{Text: "invoice"}
+
+	// Updating a todo reindexes it
+	rent.Labels = []string{"invoice"}
+	if err := repo.UpdateTodo(ctx, *rent); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{"Work/Send the invoice", "Home/Pay the rent"})
+
+	invoice.Description = "Send the bill"
+	if err := repo.UpdateTodo(ctx, *invoice); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{"Home/Pay the rent"})
+
+	// Hits follow todos to other todo lists and todo lists to new titles
+	if _, err := repo.MoveTodo(ctx, rent.ID, repository.MoveTodoOptions{ListID: work.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateTodoList(ctx, repository.TodoList{ID: work.ID, Title: "Office"}); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{"Office/Pay the rent"})
+	assertSearch(t, repo, repository.SearchQuery{Text: "work"}, []string{})
+	assertSearch(t, repo, repository.SearchQuery{Text: "office"}, []string{"Office"})
+
+	// Labels are searched by their current name
+	if _, err := repo.RenameLabel(ctx, "paperwork", "billing"); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, repository.SearchQuery{Text: "paperwork"}, []string{})
+	assertSearch(t, repo, repository.SearchQuery{Text: "billing"}, []string{"Office/Send the bill"})
+
+	// Deleted todo lists and todos are left out until restored
+	if err := repo.DeleteTodo(ctx, repository.Todo{ID: rent.ID}); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{})
+	if err := repo.DeleteTodoListByID(ctx, work.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, repository.SearchQuery{Text: "office bill"}, []string{})
+	if _, err := repo.RestoreTodoList(ctx, work.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, repository.SearchQuery{Text: "bill"}, []string{"Office/Send the bill"})
+	if _, err := repo.RestoreTodo(ctx, rent.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertSearch(t, repo, query, []string{"Office/Pay the rent"})
+}
+
+func testSearchInvalid(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	mustInsertTodoList(t, repo, "Routine")
+
+	_, err := repo.Search(ctx, repository.SearchQuery{Text: ""})
+	assertErr(t, err, repository.ErrInvalidSearch)
+	_, err = repo.Search(ctx, repository.SearchQuery{Text: " ?! "})
+	assertErr(t, err, repository.ErrInvalidSearch)
+	_, err = repo.Search(ctx, repository.SearchQuery{Text: "routine", Limit: -1})
+	assertErr(t, err, repository.ErrInvalidSearch)
+}
+
+// Trash
+
+func testTrashDeleteTodo(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"home"}})
+
+	if err := repo.DeleteTodo(clockAt(day(5)), *bed); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := repo.GetTodoByID(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+	assertDescriptions(t, repo, routine.ID, []string{})
+
+	want := &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{},
+		Todos:     []repository.TrashedTodo{{Todo: *bed, DeletedAt: day(5)}},
+	}
+	assertTrash(t, repo, want)
+}
+
+func testTrashDeleteTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	empty := mustInsertTodoList(t, repo, "Empty")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+	if err := repo.DeleteTodoListByID(clockAt(day(5)), routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	moveOpts := repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: empty.ID}
+	if err := repo.DeleteTodoListByID(clockAt(day(6)), work.ID, moveOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := repo.GetTodoListByID(ctx, routine.ID)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	_, err = repo.GetTodoByID(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+
+	report.ListID = empty.ID
+	report.Version++
+	assertTodo(t, repo, *report)
+
+	want := &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{
+			{TodoList: *routine, DeletedAt: day(5), TodoIDs: []uint32{bed.ID, floor.ID}},
+			{TodoList: *work, DeletedAt: day(6), TodoIDs: []uint32{}},
+		},
+		Todos: []repository.TrashedTodo{
+			{Todo: *bed, DeletedAt: day(5)},
+			{Todo: *floor, DeletedAt: day(5)},
+		},
+	}
+	assertTrash(t, repo, want)
+}
+
+func testRestoreTodoList(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	floor := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	bank := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Call the bank"})
+
+	// Deleted before the list, so it is not restored with it
+	if err := repo.DeleteTodo(clockAt(day(4)), *floor); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteTodoListByID(clockAt(day(5)), routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Purged while on the trash, so it can't come back
+	if err := repo.PurgeTodo(ctx, bank.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := repo.RestoreTodoList(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routine.Version++
+	if diff := cmp.Diff(routine, restored, ignoreTimestamps); diff != "" {
+		t.Errorf("RestoreTodoList() mismatch (-want +got):\n%s", diff)
+	}
+	assertTodoList(t, repo, *routine)
+
+	bed.Version++
+	assertTodo(t, repo, *bed)
+	assertDescriptions(t, repo, routine.ID, []string{"Make the bed"})
+	assertListIDsConsistent(t, repo)
+
+	want := &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{},
+		Todos:     []repository.TrashedTodo{{Todo: *floor, DeletedAt: day(4)}},
+	}
+	assertTrash(t, repo, want)
+
+	_, err = repo.RestoreTodoList(ctx, routine.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+}
+
+func testRestoreTodo(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+
+	if err := repo.DeleteTodo(ctx, *bed); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := repo.RestoreTodo(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restored todos go to the end of their todo list
+	bed.Version++
+	bed.Position = 1
+	if diff := cmp.Diff(bed, restored, ignoreTimestamps); diff != "" {
+		t.Errorf("RestoreTodo() mismatch (-want +got):\n%s", diff)
+	}
+	assertTodo(t, repo, *bed)
+	assertDescriptions(t, repo, routine.ID, []string{"Sweep the floor", "Make the bed"})
+
+	_, err = repo.RestoreTodo(ctx, bed.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+
+	// A todo can't be restored while its todo list is on the trash
+	if err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.RestoreTodo(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+}
+
+func testPurge(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+
+	if err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteTodo(ctx, *report); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.PurgeTodoList(ctx, routine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeTodo(ctx, report.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	assertTrash(t, repo, &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{},
+		Todos:     []repository.TrashedTodo{},
+	})
+
+	err := repo.PurgeTodoList(ctx, routine.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+	err = repo.PurgeTodo(ctx, report.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+	_, err = repo.RestoreTodoList(ctx, routine.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+
+	// Items that are not deleted are not on the trash
+	err = repo.PurgeTodoList(ctx, work.ID)
+	assertErr(t, err, repository.ErrNotInTrash)
+}
+
+func testPurgeTrash(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	report := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Write report"})
+	review := mustInsertTodo(t, repo, repository.Todo{ListID: work.ID, Description: "Review code"})
+
+	if err := repo.DeleteTodoListByID(clockAt(day(1)), routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteTodo(clockAt(day(2)), *report); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting the report moved the review up on its todo list
+	review.Position = 0
+	if err := repo.DeleteTodo(clockAt(day(3)), *review); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := repo.PurgeTrash(ctx, day(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The todo list with its two todos, and the report
+	if purged != 4 {
+		t.Errorf("got %d purged; want 4", purged)
+	}
+
+	assertTrash(t, repo, &repository.Trash{
+		TodoLists: []repository.TrashedTodoList{},
+		Todos:     []repository.TrashedTodo{{Todo: *review, DeletedAt: day(3)}},
+	})
+
+	purged, err = repo.PurgeTrash(ctx, day(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 0 {
+		t.Errorf("got %d purged twice; want 0", purged)
+	}
+}
+
+// History
+
+func testTodoHistory(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+
+	bed, err := repo.InsertTodo(
+		repository.WithActor(clockAt(day(1)), "alice"),
+		repository.Todo{ListID: routine.ID, Description: "Make the bed", Labels: []string{"home"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bed.Description = "Make the beds"
+	bed.Done = true
+	if err := repo.UpdateTodo(repository.WithActor(clockAt(day(2)), "bob"), *bed); err != nil {
+		t.Fatal(err)
+	}
+	// Changes nothing, so it is not recorded
+	bed.Version++
+	if err := repo.UpdateTodo(clockAt(day(3)), *bed); err != nil {
+		t.Fatal(err)
+	}
+	bed.Version++
+	if err := repo.DeleteTodo(clockAt(day(4)), *bed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RestoreTodo(clockAt(day(5)), bed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []repository.HistoryEntry{
+		{
+			At:     day(1),
+			Actor:  "alice",
+			Action: repository.ActionCreate,
+			Changes: []repository.FieldChange{
+				{Field: "list_id", New: fmt.Sprint(routine.ID)},
+				{Field: "description", New: "Make the bed"},
+				{Field: "labels", New: "home"},
+				{Field: "done", New: "false"},
+			},
+		},
+		{
+			At:     day(2),
+			Actor:  "bob",
+			Action: repository.ActionUpdate,
+			Changes: []repository.FieldChange{
+				{Field: "description", Old: "Make the bed", New: "Make the beds"},
+				{Field: "done", Old: "false", New: "true"},
+			},
+		},
+		{At: day(4), Action: repository.ActionDelete},
+		{At: day(5), Action: repository.ActionRestore},
+	}
+	assertTodoHistory(t, repo, bed.ID, want)
+}
+
+func testTodoListHistory(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work := mustInsertTodoList(t, repo, "Work")
+
+	routine, err := repo.InsertTodoList(repository.WithActor(clockAt(day(1)), "alice"), repository.TodoList{Title: "Rot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bed, err := repo.InsertTodo(clockAt(day(1)), repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routine.Title = "Routine"
+	if err := repo.UpdateTodoList(clockAt(day(2)), *routine); err != nil {
+		t.Fatal(err)
+	}
+	opts := repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: work.ID}
+	if err := repo.DeleteTodoListByID(repository.WithActor(clockAt(day(3)), "bob"), routine.ID, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetTodoListHistory(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repository.HistoryEntry{
+		{
+			At:     day(1),
+			Actor:  "alice",
+			Action: repository.ActionCreate,
+			Changes: []repository.FieldChange{
+				{Field: "title", New: "Rot"},
+				{Field: "owner", New: "alice"},
+			},
+		},
+		{
+			At:      day(2),
+			Action:  repository.ActionUpdate,
+			Changes: []repository.FieldChange{{Field: "title", Old: "Rot", New: "Routine"}},
+		},
+		{At: day(3), Actor: "bob", Action: repository.ActionDelete},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("GetTodoListHistory() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Moving the todos away is a change of each of them
+	wantTodo := []repository.HistoryEntry{
+		{
+			At:     day(1),
+			Action: repository.ActionCreate,
+			Changes: []repository.FieldChange{
+				{Field: "list_id", New: fmt.Sprint(routine.ID)},
+				{Field: "description", New: "Make the bed"},
+				{Field: "done", New: "false"},
+			},
+		},
+		{
+			At:     day(3),
+			Actor:  "bob",
+			Action: repository.ActionUpdate,
+			Changes: []repository.FieldChange{
+				{Field: "list_id", Old: fmt.Sprint(routine.ID), New: fmt.Sprint(work.ID)},
+			},
+		},
+	}
+	assertTodoHistory(t, repo, bed.ID, wantTodo)
+}
+
+func testHistoryNotFound(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	_, err := repo.GetTodoListHistory(ctx, 999)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	_, err = repo.GetTodoHistory(ctx, 999)
+	assertErr(t, err, repository.ErrTodoNotFound)
+
+	// Purging forgets the history too
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+	if err := repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTodoHistory(ctx, bed.ID); err != nil {
+		t.Errorf("GetTodoHistory() of a deleted todo: %v", err)
+	}
+	if err := repo.PurgeTodoList(ctx, routine.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetTodoListHistory(ctx, routine.ID)
+	assertErr(t, err, repository.ErrTodoListNotFound)
+	_, err = repo.GetTodoHistory(ctx, bed.ID)
+	assertErr(t, err, repository.ErrTodoNotFound)
+}
+
+// Timestamps
+
+func testTodoListTimestamps(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	routine, err := repo.InsertTodoList(clockAt(day(1)), repository.TodoList{Title: "Rot", CreatedAt: day(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !routine.CreatedAt.Equal(day(1)) || !routine.UpdatedAt.Equal(day(1)) {
+		t.Errorf("inserted todo list timestamps = %v, %v; want both %v", routine.CreatedAt, routine.UpdatedAt, day(1))
+	}
+
+	routine.Title = "Routine"
+	routine.CreatedAt = day(9)
+	if err := repo.UpdateTodoList(clockAt(day(2)), *routine); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetTodoListByID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(day(1)) {
+		t.Errorf("updated todo list CreatedAt = %v; want %v", got.CreatedAt, day(1))
+	}
+	if !got.UpdatedAt.Equal(day(2)) {
+		t.Errorf("updated todo list UpdatedAt = %v; want %v", got.UpdatedAt, day(2))
+	}
+}
+
+func testTodoTimestamps(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+
+	type Step struct {
+		name            string
+		at              time.Time
+		change          func(todo *repository.Todo)
+		wantUpdatedAt   time.Time
+		wantCompletedAt time.Time
+	}
+
+	steps := []Step{
+		{
+			name:            "MarkedDone",
+			at:              day(2),
+			change:          func(todo *repository.Todo) { todo.Done = true },
+			wantUpdatedAt:   day(2),
+			wantCompletedAt: day(2),
+		},
+		{
+			name:            "ChangedWhileDone",
+			at:              day(3),
+			change:          func(todo *repository.Todo) { todo.Labels = []string{"easy"} },
+			wantUpdatedAt:   day(3),
+			wantCompletedAt: day(2),
+		},
+		{
+			name: "CompletedAtIsIgnored",
+			at:   day(4),
+			change: func(todo *repository.Todo) {
+				todo.CompletedAt = day(9)
+				todo.UpdatedAt = day(9)
+			},
+			wantUpdatedAt:   day(4),
+			wantCompletedAt: day(2),
+		},
+		{
+			name:          "Undone",
+			at:            day(5),
+			change:        func(todo *repository.Todo) { todo.Done = false },
+			wantUpdatedAt: day(5),
+		},
+	}
+
+	todo, err := repo.InsertTodo(clockAt(day(1)), repository.Todo{
+		ListID:      routine.ID,
+		Description: "Make the bed",
+		CompletedAt: day(9),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !todo.CreatedAt.Equal(day(1)) || !todo.UpdatedAt.Equal(day(1)) || !todo.CompletedAt.IsZero() {
+		t.Fatalf("inserted todo timestamps = %v, %v, %v; want %v, %v and zero",
+			todo.CreatedAt, todo.UpdatedAt, todo.CompletedAt, day(1), day(1))
+	}
+
+	for _, step := range steps {
+		step.change(todo)
+		if err := repo.UpdateTodo(clockAt(step.at), *todo); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		got, err := repo.GetTodoByID(ctx, todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.CreatedAt.Equal(day(1)) {
+			t.Errorf("%s: CreatedAt = %v; want %v", step.name, got.CreatedAt, day(1))
+		}
+		if !got.UpdatedAt.Equal(step.wantUpdatedAt) {
+			t.Errorf("%s: UpdatedAt = %v; want %v", step.name, got.UpdatedAt, step.wantUpdatedAt)
+		}
+		if !got.CompletedAt.Equal(step.wantCompletedAt) {
+			t.Errorf("%s: CompletedAt = %v; want %v", step.name, got.CompletedAt, step.wantCompletedAt)
+		}
+		todo = got
+	}
+
+	done, err := repo.InsertTodo(clockAt(day(6)), repository.Todo{ListID: routine.ID, Description: "Done already", Done: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done.CompletedAt.Equal(day(6)) {
+		t.Errorf("todo inserted done CompletedAt = %v; want %v", done.CompletedAt, day(6))
+	}
+}
+
+func testMovedAndRestoredTimestamps(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	work := mustInsertTodoList(t, repo, "Work")
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+
+	opts := repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: work.ID}
+	if err := repo.DeleteTodoListByID(clockAt(day(2)), routine.ID, opts); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := repo.GetTodoByID(ctx, bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !moved.UpdatedAt.Equal(day(2)) {
+		t.Errorf("moved todo UpdatedAt = %v; want %v", moved.UpdatedAt, day(2))
+	}
+
+	restored, err := repo.RestoreTodoList(clockAt(day(3)), routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.UpdatedAt.Equal(day(3)) {
+		t.Errorf("restored todo list UpdatedAt = %v; want %v", restored.UpdatedAt, day(3))
+	}
+
+	if err := repo.DeleteTodo(ctx, *moved); err != nil {
+		t.Fatal(err)
+	}
+	restoredTodo, err := repo.RestoreTodo(clockAt(day(4)), bed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restoredTodo.UpdatedAt.Equal(day(4)) {
+		t.Errorf("restored todo UpdatedAt = %v; want %v", restoredTodo.UpdatedAt, day(4))
+	}
+	if !restoredTodo.CreatedAt.Equal(bed.CreatedAt) {
+		t.Errorf("restored todo CreatedAt = %v; want %v", restoredTodo.CreatedAt, bed.CreatedAt)
+	}
+}
+
+func testQueryByRecency(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+
+	for i, description := range []string{"Make the bed", "Sweep the floor", "Call the bank"} {
+		if _, err := repo.InsertTodo(clockAt(day(3-i)), repository.Todo{ListID: routine.ID, Description: description}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	todos, err := repo.GetTodosByListID(ctx, routine.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	floor := todos[1]
+	floor.Done = true
+	if err := repo.UpdateTodo(clockAt(day(4)), floor); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		name  string
+		query repository.TodoQuery
+		want  []string
+	}
+
+	tests := []Test{
+		{
+			name:  "CreatedAt",
+			query: repository.TodoQuery{SortBy: repository.SortByCreatedAt},
+			want:  []string{"Call the bank", "Sweep the floor", "Make the bed"},
+		},
+		{
+			name:  "UpdatedAtDescending",
+			query: repository.TodoQuery{SortBy: repository.SortByUpdatedAt, Descending: true},
+			want:  []string{"Sweep the floor", "Make the bed", "Call the bank"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// One todo per page, so every step goes through the cursor
+			query := test.query
+			query.Limit = 1
+			got := []string{}
+			for {
+				page, err := repo.QueryTodos(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, descriptions(page.Todos)...)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("QueryTodos() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Versions
+
+func testVersions(t *testing.T, newRepo Factory) {
+	t.Run("TodoList", func(t *testing.T) {
+		repo := newRepo(t)
+		routine := mustInsertTodoList(t, repo, "Rot")
+		stale := *routine
+
+		routine.Title = "Routine"
+		if err := repo.UpdateTodoList(ctx, *routine); err != nil {
+			t.Fatal(err)
+		}
+		routine.Version = 2
+		assertTodoList(t, repo, *routine)
+
+		stale.Title = "Stale"
+		err := repo.UpdateTodoList(ctx, stale)
+		assertErr(t, err, repository.ErrConflict)
+		err = repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{Version: stale.Version})
+		assertErr(t, err, repository.ErrConflict)
+		assertTodoList(t, repo, *routine)
+
+		// A zero version always overwrites
+		err = repo.UpdateTodoList(ctx, repository.TodoList{ID: routine.ID, Title: "Daily"})
+		assertErr(t, err, nil)
+		assertTodoList(t, repo, repository.TodoList{ID: routine.ID, Title: "Daily", Version: 3})
+
+		err = repo.DeleteTodoListByID(ctx, routine.ID, repository.DeleteTodoListOptions{Version: 3})
+		assertErr(t, err, nil)
+	})
+
+	t.Run("Todo", func(t *testing.T) {
+		repo := newRepo(t)
+		routine := mustInsertTodoList(t, repo, "Routine")
+		bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+		stale := *bed
+
+		bed.Done = true
+		if err := repo.UpdateTodo(ctx, *bed); err != nil {
+			t.Fatal(err)
+		}
+		bed.Version = 2
+		assertTodo(t, repo, *bed)
+
+		stale.Description = "Stale"
+		err := repo.UpdateTodo(ctx, stale)
+		assertErr(t, err, repository.ErrConflict)
+		err = repo.DeleteTodo(ctx, stale)
+		assertErr(t, err, repository.ErrConflict)
+		assertTodo(t, repo, *bed)
+
+		err = repo.DeleteTodo(ctx, *bed)
+		assertErr(t, err, nil)
+	})
+
+	t.Run("MovedTodosChange", func(t *testing.T) {
+		repo := newRepo(t)
+		routine := mustInsertTodoList(t, repo, "Routine")
+		work := mustInsertTodoList(t, repo, "Work")
+		bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+
+		opts := repository.DeleteTodoListOptions{Policy: repository.DeleteMove, TargetListID: work.ID}
+		if err := repo.DeleteTodoListByID(ctx, routine.ID, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		err := repo.UpdateTodo(ctx, *bed)
+		assertErr(t, err, repository.ErrConflict)
+	})
+}
+
+// Context and concurrency
+
+func testCanceledContext(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+	routine := mustInsertTodoList(t, repo, "Routine")
+	bed := mustInsertTodo(t, repo, repository.Todo{ListID: routine.ID, Description: "Make the bed"})
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := repo.InsertTodoList(canceledCtx, repository.TodoList{Title: "Work"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAllTodoLists(canceledCtx)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTodoListByID(canceledCtx, routine.ID)
+	assertErr(t, err, context.Canceled)
+	err = repo.UpdateTodoList(canceledCtx, repository.TodoList{ID: routine.ID, Title: "Work"})
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteTodoListByID(canceledCtx, routine.ID, repository.DeleteTodoListOptions{})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertTodo(canceledCtx, repository.Todo{ListID: routine.ID, Description: "Sweep the floor"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTodoByID(canceledCtx, bed.ID)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTodosByListID(canceledCtx, routine.ID)
+	assertErr(t, err, context.Canceled)
+	err = repo.UpdateTodo(canceledCtx, repository.Todo{ID: bed.ID, ListID: routine.ID, Description: "Changed"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.MoveTodo(canceledCtx, bed.ID, repository.MoveTodoOptions{ListID: routine.ID})
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteTodo(canceledCtx, *bed)
+	assertErr(t, err, context.Canceled)
+	err = repo.AddDependency(canceledCtx, bed.ID, bed.ID)
+	assertErr(t, err, context.Canceled)
+	err = repo.RemoveDependency(canceledCtx, bed.ID, bed.ID)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetBlockers(canceledCtx, bed.ID)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertLabel(canceledCtx, repository.Label{Name: "home"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAllLabels(canceledCtx)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetLabel(canceledCtx, "home")
+	assertErr(t, err, context.Canceled)
+	err = repo.UpdateLabel(canceledCtx, repository.Label{Name: "home"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.RenameLabel(canceledCtx, "home", "house")
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteLabel(canceledCtx, "home")
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertComment(canceledCtx, repository.Comment{TodoID: bed.ID, Body: "Done"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetComments(canceledCtx, bed.ID)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetComment(canceledCtx, 0)
+	assertErr(t, err, context.Canceled)
+	err = repo.UpdateComment(canceledCtx, repository.Comment{ID: 0, Body: "Done"})
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteComment(canceledCtx, repository.Comment{ID: 0})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertAttachment(canceledCtx, repository.Attachment{TodoID: bed.ID, Name: "bed.png", Hash: screenshotHash})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAttachments(canceledCtx, bed.ID)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAttachment(canceledCtx, 0)
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteAttachment(canceledCtx, 0)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAttachmentHashes(canceledCtx)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertUser(canceledCtx, repository.User{Name: "alice"})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetAllUsers(canceledCtx)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetUser(canceledCtx, "alice")
+	assertErr(t, err, context.Canceled)
+	_, err = repo.ShareTodoList(canceledCtx, routine.ID, repository.Member{User: "alice", Role: repository.RoleViewer})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.UnshareTodoList(canceledCtx, routine.ID, "alice")
+	assertErr(t, err, context.Canceled)
+	_, err = repo.SetFeedToken(canceledCtx, routine.ID, repository.HashToken("feed"))
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTodoListByFeedToken(canceledCtx, repository.HashToken("feed"))
+	assertErr(t, err, context.Canceled)
+	_, err = repo.InsertToken(canceledCtx, repository.Token{User: "alice", Hash: repository.HashToken("secret"), Scopes: []repository.Scope{repository.ScopeRead}})
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTokens(canceledCtx, "alice")
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetToken(canceledCtx, 0)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.GetTokenByHash(canceledCtx, repository.HashToken("secret"))
+	assertErr(t, err, context.Canceled)
+	err = repo.DeleteToken(canceledCtx, 0)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.Backup(canceledCtx)
+	assertErr(t, err, context.Canceled)
+	err = repo.Restore(canceledCtx, repository.Backup{Version: repository.BackupVersion}, repository.RestoreReplace)
+	assertErr(t, err, context.Canceled)
+	_, err = repo.Search(canceledCtx, repository.SearchQuery{Text: "bed"})
+	assertErr(t, err, context.Canceled)
+
+	// Nothing may have changed
+	assertTodoList(t, repo, *routine)
+	assertDescriptions(t, repo, routine.ID, []string{"Make the bed"})
+}
+
+func testConcurrency(t *testing.T, newRepo Factory) {
+	const (
+		workers    = 8
+		iterations = 20
+	)
+
+	repo := newRepo(t)
+	shared := mustInsertTodoList(t, repo, "Shared")
+
+	var mu sync.Mutex
+	todoListIDs := map[uint32]bool{}
+	todoIDs := map[uint32]bool{}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				todoList, err := repo.InsertTodoList(ctx, repository.TodoList{Title: fmt.Sprintf("List %d-%d", w, i)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				todo, err := repo.InsertTodo(ctx, repository.Todo{ListID: shared.ID, Description: fmt.Sprintf("Todo %d-%d", w, i)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				mu.Lock()
+				if todoListIDs[todoList.ID] {
+					t.Errorf("duplicated todo list ID %d", todoList.ID)
+				}
+				todoListIDs[todoList.ID] = true
+				if todoIDs[todo.ID] {
+					t.Errorf("duplicated todo ID %d", todo.ID)
+				}
+				todoIDs[todo.ID] = true
+				mu.Unlock()
+
+				todo.Done = true
+				if err := repo.UpdateTodo(ctx, *todo); err != nil {
+					t.Error(err)
+				}
+				todo.Version++
+				if _, err := repo.GetTodosByListID(ctx, shared.ID); err != nil {
+					t.Error(err)
+				}
+				if _, err := repo.GetAllTodoLists(ctx); err != nil {
+					t.Error(err)
+				}
+				if i%2 == 0 {
+					if err := repo.DeleteTodo(ctx, *todo); err != nil {
+						t.Error(err)
+					}
+					if err := repo.DeleteTodoListByID(ctx, todoList.ID, repository.DeleteTodoListOptions{}); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	todos, err := repo.GetTodosByListID(ctx, shared.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := workers * iterations / 2; len(todos) != want {
+		t.Errorf("got %d todos; want %d", len(todos), want)
+	}
+	for _, todo := range todos {
+		if !todo.Done {
+			t.Errorf("todo %d lost its update", todo.ID)
+		}
+	}
+	assertListIDsConsistent(t, repo)
+}
+
+// Helpers
+
+func mustInsertTodoList(t *testing.T, repo repository.Repository, title string) *repository.TodoList {
+	t.Helper()
+
+	todoList, err := repo.InsertTodoList(ctx, repository.TodoList{Title: title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todoList
+}
+
+func mustInsertTodo(t *testing.T, repo repository.Repository, todo repository.Todo) *repository.Todo {
+	t.Helper()
+
+	newTodo, err := repo.InsertTodo(ctx, todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTodo
+}
+
+func mustInsertLabel(t *testing.T, repo repository.Repository, label repository.Label) *repository.Label {
+	t.Helper()
+
+	newLabel, err := repo.InsertLabel(ctx, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newLabel
+}
+
+func mustInsertComment(t *testing.T, repo repository.Repository, comment repository.Comment) *repository.Comment {
+	t.Helper()
+
+	newComment, err := repo.InsertComment(ctx, comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newComment
+}
+
+func mustInsertAttachment(t *testing.T, repo repository.Repository, attachment repository.Attachment) *repository.Attachment {
+	t.Helper()
+
+	newAttachment, err := repo.InsertAttachment(ctx, attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAttachment
+}
+
+func mustInsertUser(t *testing.T, repo repository.Repository, name string) *repository.User {
+	t.Helper()
+
+	user, err := repo.InsertUser(ctx, repository.User{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// fillQueryFixture creates two todo lists with todos differing on every
+// field a query looks at.
+func fillQueryFixture(t *testing.T, repo repository.Repository) (*repository.TodoList, *repository.TodoList) {
+	t.Helper()
+
+	routine := mustInsertTodoList(t, repo, "Routine")
+	work := mustInsertTodoList(t, repo, "Work")
+
+	todos := []repository.Todo{
+		{ListID: routine.ID, Description: "Make the bed", DueDate: day(3), Labels: []string{"home"}, Done: true},
+		{ListID: work.ID, Description: "Write report", DueDate: day(2), Labels: []string{"office"}},
+		{ListID: routine.ID, Description: "Sweep the floor", DueDate: day(1), Labels: []string{"home", "urgent"}},
+		{ListID: routine.ID, Description: "Call the bank", Labels: []string{"home"}},
+		{ListID: work.ID, Description: "Review code", Labels: []string{"urgent"}, Done: true},
+	}
+	for _, todo := range todos {
+		newTodo := mustInsertTodo(t, repo, todo)
+		if newTodo.Description == "Write report" {
+			mustInsertComment(t, repo, repository.Comment{TodoID: newTodo.ID, Body: "Send to the manager"})
+		}
+	}
+
+	return routine, work
+}
+
+// clockAt returns a context where the repository clock is always t.
+func clockAt(t time.Time) context.Context {
+	return repository.WithClock(ctx, func() time.Time { return t })
+}
+
+func assertTrash(t *testing.T, repo repository.Repository, want *repository.Trash) {
+	t.Helper()
+
+	got, err := repo.GetTrash(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), ignoreTimestamps); diff != "" {
+		t.Errorf("GetTrash() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func assertTodoHistory(t *testing.T, repo repository.Repository, id uint32, want []repository.HistoryEntry) {
+	t.Helper()
+
+	got, err := repo.GetTodoHistory(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("GetTodoHistory(%d) mismatch (-want +got):\n%s", id, diff)
+	}
+}
+
+func day(n int) time.Time {
+	return time.Date(2021, 2, n, 0, 0, 0, 0, time.UTC)
+}
+
+func descriptions(todos []repository.Todo) []string {
+	result := []string{}
+	for _, todo := range todos {
+		result = append(result, todo.Description)
+	}
+	return result
+}
+
+func assertErr(t *testing.T, err, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Errorf("got error %v; want %v", err, want)
+	}
+}
+
+func assertTodoList(t *testing.T, repo repository.Repository, want repository.TodoList) {
+	t.Helper()
+
+	got, err := repo.GetTodoListByID(ctx, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("stored todo list mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func assertLabel(t *testing.T, repo repository.Repository, want repository.Label) {
+	t.Helper()
+
+	got, err := repo.GetLabel(ctx, want.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("stored label mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func assertComment(t *testing.T, repo repository.Repository, want repository.Comment) {
+	t.Helper()
+
+	got, err := repo.GetComment(ctx, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, got); diff != "" {
+		t.Errorf("stored comment mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func assertComments(t *testing.T, repo repository.Repository, todoID uint32, want []repository.Comment) {
+	t.Helper()
+
+	got, err := repo.GetComments(ctx, todoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("GetComments(%d) mismatch (-want +got):\n%s", todoID, diff)
+	}
+}
+
+func assertAttachments(t *testing.T, repo repository.Repository, todoID uint32, want []repository.Attachment) {
+	t.Helper()
+
+	got, err := repo.GetAttachments(ctx, todoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), ignoreTimestamps); diff != "" {
+		t.Errorf("GetAttachments(%d) mismatch (-want +got):\n%s", todoID, diff)
+	}
+}
+
+func assertAttachmentHashes(t *testing.T, repo repository.Repository, want []string) {
+	t.Helper()
+
+	got, err := repo.GetAttachmentHashes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("GetAttachmentHashes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func assertTodo(t *testing.T, repo repository.Repository, want repository.Todo) {
+	t.Helper()
+
+	got, err := repo.GetTodoByID(ctx, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&want, got, ignoreTimestamps); diff != "" {
+		t.Errorf("stored todo mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// assertDescriptions checks the todos of a list, in order.
+func assertDescriptions(t *testing.T, repo repository.Repository, listID uint32, want []string) {
+	t.Helper()
+
+	todos, err := repo.GetTodosByListID(ctx, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, todo := range todos {
+		got = append(got, todo.Description)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("todos of list %d mismatch (-want +got):\n%s", listID, diff)
+	}
+}
+
+// assertListIDsConsistent checks every todo returned for a list points back
+// to it, has its index as position and can be found by its own ID.
+func assertListIDsConsistent(t *testing.T, repo repository.Repository) {
+	t.Helper()
+
+	todoLists, err := repo.GetAllTodoLists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(todoLists, func(i, j int) bool { return todoListLess(todoLists[i], todoLists[j]) })
+	for _, todoList := range todoLists {
+		todos, err := repo.GetTodosByListID(ctx, todoList.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, todo := range todos {
+			if todo.ListID != todoList.ID {
+				t.Errorf("todo %d returned for list %d points to list %d", todo.ID, todoList.ID, todo.ListID)
+			}
+			if todo.Position != i {
+				t.Errorf("todo %d returned at index %d of list %d has position %d", todo.ID, i, todoList.ID, todo.Position)
+			}
+			stored, err := repo.GetTodoByID(ctx, todo.ID)
+			if err != nil {
+				t.Errorf("todo %d returned for list %d: %v", todo.ID, todoList.ID, err)
+				continue
+			}
+			if diff := cmp.Diff(todo, *stored); diff != "" {
+				t.Errorf("todo %d differs between list and ID lookups (-list +id):\n%s", todo.ID, diff)
+			}
+		}
+	}
+}
+
+// assertSearch checks the hits of a search, in order. Todo list hits are
+// described by their title and todo hits by the title of their todo list and
+// their description.
+func assertSearch(t *testing.T, repo repository.Repository, query repository.SearchQuery, want []string) {
+	t.Helper()
+
+	hits, err := repo.Search(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, hit := range hits {
+		if hit.Todo == nil {
+			got = append(got, hit.TodoList.Title)
+			continue
+		}
+		got = append(got, hit.TodoList.Title+"/"+hit.Todo.Description)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Search(%q) mismatch (-want +got):\n%s", query.Text, diff)
+	}
+}
+
+// assertBlockers checks the blockers of a todo, in order.
+func assertBlockers(t *testing.T, repo repository.Repository, id uint32, want []string) {
+	t.Helper()
+
+	blockers, err := repo.GetBlockers(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, descriptions(blockers)); diff != "" {
+		t.Errorf("blockers of todo %d mismatch (-want +got):\n%s", id, diff)
+	}
+}
+
+func todoListLess(x, y repository.TodoList) bool {
+	return x.ID < y.ID
+}
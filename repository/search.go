@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidSearch = errors.New("search query is invalid")
+
+// Each field adds this much to the score of a hit for every token matching
+// on it. Prefix matches count half.
+var searchFieldWeights = map[string]float64{
+	"title":       3,
+	"description": 3,
+	"labels":      2,
+	"comments":    1,
+}
+
+// SearchQuery finds active todo lists by title and active todos by
+// description, comments and labels.
+type SearchQuery struct {
+	// Text is split on words, ignoring case and punctuation. A hit must
+	// match every word, either fully or as the start of a longer word, so
+	// "inv" matches "invoice".
+	Text string
+	// Limit is the maximum number of hits. Zero means no limit.
+	Limit int
+}
+
+// SearchHit is a todo list or todo matching a SearchQuery.
+type SearchHit struct {
+	// TodoList is the todo list matching, or the one holding the todo.
+	TodoList TodoList
+	// Todo is the todo matching. Nil when the todo list itself matched.
+	Todo *Todo
+	// Fields are the fields where any word matched, ordered by name.
+	Fields []string
+	// Score ranks hits against each other, the higher the better. Exact
+	// matches on rare words and on titles and descriptions rank higher.
+	Score float64
+}
+
+func (ls *LocalStorage) Search(ctx context.Context, query SearchQuery) ([]SearchHit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	terms := tokenize(query.Text)
+	if len(terms) == 0 || query.Limit < 0 {
+		return nil, ErrInvalidSearch
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	hits := []SearchHit{}
+	for key, match := range ls.index.search(terms) {
+		hit := SearchHit{Fields: match.fieldNames(), Score: match.score}
+		if key.todoList {
+			hit.TodoList = cloneTodoList(ls.TodoListTable[key.id])
+		} else {
+			todo := cloneTodo(ls.TodoTable[key.id])
+			hit.Todo = &todo
+			hit.TodoList = cloneTodoList(ls.TodoListTable[todo.ListID])
+		}
+		hits = append(hits, hit)
+	}
+
+	// Todo lists come before their todos on ties, and then lower IDs first
+	sort.Slice(hits, func(i, j int) bool {
+		x, y := hits[i], hits[j]
+		if x.Score != y.Score {
+			return x.Score > y.Score
+		}
+		if (x.Todo == nil) != (y.Todo == nil) {
+			return x.Todo == nil
+		}
+		if x.Todo != nil {
+			return x.Todo.ID < y.Todo.ID
+		}
+		return x.TodoList.ID < y.TodoList.ID
+	})
+
+	if query.Limit > 0 && len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	return hits, nil
+}
+
+// reindexTodoList and reindexTodo bring the search index up to date with
+// the stored todo list or todo, dropping it when it is no longer active.
+// Must be called with ls.mu held.
+func (ls *LocalStorage) reindexTodoList(id uint32) {
+	key := searchKey{todoList: true, id: id}
+	todoList, ok := ls.TodoListTable[id]
+	if !ok {
+		ls.index.remove(key)
+		return
+	}
+	ls.index.put(key, []fieldValue{
+		{"title", todoList.Title},
+	})
+}
+
+func (ls *LocalStorage) reindexTodo(id uint32) {
+	key := searchKey{id: id}
+	todo, ok := ls.TodoTable[id]
+	if !ok {
+		ls.index.remove(key)
+		return
+	}
+	ls.index.put(key, []fieldValue{
+		{"description", todo.Description},
+		{"comments", strings.Join(ls.commentBodies(id), " ")},
+		{"labels", strings.Join(todo.Labels, " ")},
+	})
+}
+
+// rebuildIndex indexes every active todo list and todo from scratch, as
+// needed after loading the tables from elsewhere. Must be called with ls.mu
+// held.
+func (ls *LocalStorage) rebuildIndex() {
+	ls.index = newSearchIndex()
+	for id := range ls.TodoListTable {
+		ls.reindexTodoList(id)
+	}
+	for id := range ls.TodoTable {
+		ls.reindexTodo(id)
+	}
+}
+
+// tokenize splits text on lower case words made of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchKey identifies a todo list or a todo on the search index.
+type searchKey struct {
+	todoList bool
+	id       uint32
+}
+
+// searchIndex is an inverted index from words to the todo lists and todos
+// having them.
+type searchIndex struct {
+	// postings maps each token to the documents having it, and to how many
+	// times it shows on each of their fields
+	postings map[string]map[searchKey]map[string]int
+	// tokens are the keys of postings, sorted so prefixes are found by
+	// binary search
+	tokens []string
+	// docs are the tokens of each document, to drop it before reindexing
+	docs map[searchKey][]string
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: map[string]map[searchKey]map[string]int{},
+		tokens:   []string{},
+		docs:     map[searchKey][]string{},
+	}
+}
+
+// put replaces whatever was indexed for key with the tokens on fields.
+func (idx *searchIndex) put(key searchKey, fields []fieldValue) {
+	idx.remove(key)
+
+	tokens := []string{}
+	for _, f := range fields {
+		for _, token := range tokenize(f.value) {
+			docs, ok := idx.postings[token]
+			if !ok {
+				docs = map[searchKey]map[string]int{}
+				idx.postings[token] = docs
+				i := sort.SearchStrings(idx.tokens, token)
+				idx.tokens = append(idx.tokens, "")
+				copy(idx.tokens[i+1:], idx.tokens[i:])
+				idx.tokens[i] = token
+			}
+			counts, ok := docs[key]
+			if !ok {
+				counts = map[string]int{}
+				docs[key] = counts
+				tokens = append(tokens, token)
+			}
+			counts[f.field]++
+		}
+	}
+
+	if len(tokens) > 0 {
+		idx.docs[key] = tokens
+	}
+}
+
+func (idx *searchIndex) remove(key searchKey) {
+	for _, token := range idx.docs[key] {
+		docs := idx.postings[token]
+		delete(docs, key)
+		if len(docs) == 0 {
+			delete(idx.postings, token)
+			i := sort.SearchStrings(idx.tokens, token)
+			idx.tokens = append(idx.tokens[:i], idx.tokens[i+1:]...)
+		}
+	}
+	delete(idx.docs, key)
+}
+
+// searchMatch is how a document matched the terms of a search.
+type searchMatch struct {
+	score  float64
+	fields map[string]bool
+	terms  map[string]bool
+}
+
+func (m *searchMatch) fieldNames() []string {
+	names := []string{}
+	for field := range m.fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// search returns the documents matching every term, either fully or by
+// prefix. Each matching token scores its field weight, times how many times
+// it shows on the field, times its inverse document frequency.
+func (idx *searchIndex) search(terms []string) map[searchKey]*searchMatch {
+	matches := map[searchKey]*searchMatch{}
+	total := float64(len(idx.docs))
+
+	distinct := map[string]bool{}
+	for _, term := range terms {
+		if distinct[term] {
+			continue
+		}
+		distinct[term] = true
+
+		i := sort.SearchStrings(idx.tokens, term)
+		for ; i < len(idx.tokens) && strings.HasPrefix(idx.tokens[i], term); i++ {
+			token := idx.tokens[i]
+			docs := idx.postings[token]
+			weight := math.Log(1 + total/float64(len(docs)))
+			if token != term {
+				weight /= 2
+			}
+
+			for key, counts := range docs {
+				match, ok := matches[key]
+				if !ok {
+					match = &searchMatch{fields: map[string]bool{}, terms: map[string]bool{}}
+					matches[key] = match
+				}
+				match.terms[term] = true
+				for field, count := range counts {
+					match.fields[field] = true
+					match.score += searchFieldWeights[field] * float64(count) * weight
+				}
+			}
+		}
+	}
+
+	for key, match := range matches {
+		if len(match.terms) < len(distinct) {
+			delete(matches, key)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenize(t *testing.T) {
+	type Test struct {
+		name string
+		text string
+		want []string
+	}
+
+	tests := []Test{
+		{
+			name: "Words",
+			text: "Send the invoice",
+			want: []string{"send", "the", "invoice"},
+		},
+		{
+			name: "Punctuation",
+			text: "ACME, Inc. (2021-02-01)",
+			want: []string{"acme", "inc", "2021", "02", "01"},
+		},
+		{
+			name: "Unicode",
+			text: "Café über_alles",
+			want: []string{"café", "über", "alles"},
+		},
+		{
+			name: "Empty",
+			text: " ?! ",
+			want: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tokenize(test.text)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("tokenize(%q) mismatch (-want +got):\n%s", test.text, diff)
+			}
+		})
+	}
+}
+
+func TestSearchIndexPutAndRemove(t *testing.T) {
+	idx := newSearchIndex()
+	bed := searchKey{id: 0}
+	floor := searchKey{id: 1}
+
+	idx.put(bed, []fieldValue{{"description", "Make the bed"}})
+	idx.put(floor, []fieldValue{{"description", "Sweep the floor"}, {"comments", "The whole floor"}})
+	if diff := cmp.Diff([]string{"bed", "floor", "make", "sweep", "the", "whole"}, idx.tokens); diff != "" {
+		t.Errorf("tokens mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int{"description": 1, "comments": 1}, idx.postings["the"][floor]); diff != "" {
+		t.Errorf("postings of \"the\" mismatch (-want +got):\n%s", diff)
+	}
+
+	// Putting again replaces what was there
+	idx.put(floor, []fieldValue{{"description", "Mop the floor"}})
+	if diff := cmp.Diff([]string{"bed", "floor", "make", "mop", "the"}, idx.tokens); diff != "" {
+		t.Errorf("tokens after put mismatch (-want +got):\n%s", diff)
+	}
+
+	idx.remove(bed)
+	idx.remove(floor)
+	if len(idx.tokens) != 0 || len(idx.postings) != 0 || len(idx.docs) != 0 {
+		t.Errorf("got index %+v after removing everything; want it empty", idx)
+	}
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+)
+
+// Scope is what an API token allows. Each scope includes the ones before it.
+type Scope string
+
+const (
+	// ScopeRead reads anything the user has a role on.
+	ScopeRead Scope = "read"
+	// ScopeWrite also changes anything the user has a role on, and manages
+	// the tokens of the user.
+	ScopeWrite Scope = "write"
+	// ScopeAdmin also creates users and manages the tokens of any user.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeRanks = map[Scope]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// tokenSecretPrefix starts every secret, so leaked ones are easy to spot.
+const tokenSecretPrefix = "todoer_"
+
+// Valid tells if s is one of the known scopes.
+func (s Scope) Valid() bool {
+	return scopeRanks[s] > 0
+}
+
+// Includes tells if s allows everything other does.
+func (s Scope) Includes(other Scope) bool {
+	return s.Valid() && scopeRanks[s] >= scopeRanks[other]
+}
+
+// Allows tells if any of the scopes of the token includes scope.
+func (t Token) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s.Includes(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTokenSecret returns a new random secret for a token.
+func NewTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenSecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash a token with the given secret is kept by.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ls *LocalStorage) InsertToken(ctx context.Context, token Token) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.Users[token.User]; !ok {
+		return nil, ErrUserNotFound
+	}
+	if !hashPattern.MatchString(token.Hash) || len(token.Scopes) == 0 {
+		return nil, ErrInvalidToken
+	}
+	for _, scope := range token.Scopes {
+		if !scope.Valid() {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	token.ID = ls.TokenAutoincrement
+	token.Scopes = append([]Scope{}, token.Scopes...)
+	token.CreatedAt = now(ctx)
+	ls.Tokens[token.ID] = token
+	ls.TokenAutoincrement++
+	return cloneToken(token), nil
+}
+
+func (ls *LocalStorage) GetTokens(ctx context.Context, user string) ([]Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	if _, ok := ls.Users[user]; !ok {
+		return nil, ErrUserNotFound
+	}
+
+	tokens := []Token{}
+	for _, token := range ls.Tokens {
+		if token.User == user {
+			tokens = append(tokens, *cloneToken(token))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+
+	return tokens, nil
+}
+
+func (ls *LocalStorage) GetToken(ctx context.Context, id uint32) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	token, ok := ls.Tokens[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	return cloneToken(token), nil
+}
+
+func (ls *LocalStorage) GetTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	for _, token := range ls.Tokens {
+		if token.Hash == hash {
+			return cloneToken(token), nil
+		}
+	}
+
+	return nil, ErrTokenNotFound
+}
+
+func (ls *LocalStorage) DeleteToken(ctx context.Context, id uint32) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.Tokens[id]; !ok {
+		return ErrTokenNotFound
+	}
+
+	delete(ls.Tokens, id)
+	return nil
+}
+
+// cloneToken copies the scopes of a token so callers never share memory
+// with the stored record.
+func cloneToken(token Token) *Token {
+	token.Scopes = append([]Scope{}, token.Scopes...)
+	return &token
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenAllows(t *testing.T) {
+	type Test struct {
+		scopes []Scope
+		scope  Scope
+		want   bool
+	}
+
+	tests := []Test{
+		{scopes: []Scope{ScopeRead}, scope: ScopeRead, want: true},
+		{scopes: []Scope{ScopeRead}, scope: ScopeWrite, want: false},
+		{scopes: []Scope{ScopeWrite}, scope: ScopeRead, want: true},
+		{scopes: []Scope{ScopeRead, ScopeWrite}, scope: ScopeAdmin, want: false},
+		{scopes: []Scope{ScopeAdmin}, scope: ScopeWrite, want: true},
+		{scopes: []Scope{"root"}, scope: ScopeRead, want: false},
+		{scopes: nil, scope: ScopeRead, want: false},
+	}
+
+	for _, test := range tests {
+		token := Token{Scopes: test.scopes}
+		if got := token.Allows(test.scope); got != test.want {
+			t.Errorf("Token with scopes %v Allows(%q) = %v; want %v", test.scopes, test.scope, got, test.want)
+		}
+	}
+}
+
+func TestNewTokenSecret(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		secret, err := NewTokenSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(secret, tokenSecretPrefix) {
+			t.Errorf("got secret %q; want it starting with %q", secret, tokenSecretPrefix)
+		}
+		if seen[secret] {
+			t.Errorf("got secret %q twice", secret)
+		}
+		seen[secret] = true
+
+		if hash := HashToken(secret); !hashPattern.MatchString(hash) {
+			t.Errorf("got hash %q for %q; want a hex encoded SHA-256", hash, secret)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+// TodoNode is a todo together with its subtasks, on a tree built by
+// NewTodoTree.
+type TodoNode struct {
+	Todo     Todo
+	Subtasks []TodoNode
+}
+
+// NewTodoTree nests todos under their parents, keeping the order they are
+// given in among siblings. A todo whose parent is not on todos is a root, so
+// a filtered set of todos still returns every one of them.
+func NewTodoTree(todos []Todo) []TodoNode {
+	given := map[uint32]bool{}
+	for _, todo := range todos {
+		given[todo.ID] = true
+	}
+
+	roots := []uint32{}
+	children := map[uint32][]uint32{}
+	byID := map[uint32]Todo{}
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+		if todo.ParentID != nil && given[*todo.ParentID] {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo.ID)
+		} else {
+			roots = append(roots, todo.ID)
+		}
+	}
+
+	var build func(ids []uint32) []TodoNode
+	build = func(ids []uint32) []TodoNode {
+		nodes := []TodoNode{}
+		for _, id := range ids {
+			nodes = append(nodes, TodoNode{Todo: byID[id], Subtasks: build(children[id])})
+		}
+		return nodes
+	}
+
+	return build(roots)
+}
+
+// CommentNode is a comment together with its replies, on a tree built by
+// NewCommentTree.
+type CommentNode struct {
+	Comment Comment
+	Replies []CommentNode
+}
+
+// NewCommentTree nests comments under what they reply to, keeping the order
+// they are given in among siblings. A reply to a comment that is not on
+// comments is a root.
+func NewCommentTree(comments []Comment) []CommentNode {
+	given := map[uint32]bool{}
+	for _, comment := range comments {
+		given[comment.ID] = true
+	}
+
+	roots := []uint32{}
+	children := map[uint32][]uint32{}
+	byID := map[uint32]Comment{}
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+		if comment.ParentID != nil && given[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment.ID)
+		} else {
+			roots = append(roots, comment.ID)
+		}
+	}
+
+	var build func(ids []uint32) []CommentNode
+	build = func(ids []uint32) []CommentNode {
+		nodes := []CommentNode{}
+		for _, id := range ids {
+			nodes = append(nodes, CommentNode{Comment: byID[id], Replies: build(children[id])})
+		}
+		return nodes
+	}
+
+	return build(roots)
+}
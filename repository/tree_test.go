@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewTodoTree(t *testing.T) {
+	type Test struct {
+		name  string
+		todos []Todo
+		want  []TodoNode
+	}
+
+	house := uint32(1)
+	floor := uint32(2)
+
+	tests := []Test{
+		{
+			name:  "Empty",
+			todos: []Todo{},
+			want:  []TodoNode{},
+		},
+		{
+			name: "Nested",
+			todos: []Todo{
+				{ID: 1, Description: "Clean the house"},
+				{ID: 2, Description: "Sweep the floor", ParentID: &house},
+				{ID: 3, Description: "Mop the floor", ParentID: &floor},
+				{ID: 4, Description: "Call the bank"},
+			},
+			want: []TodoNode{
+				{
+					Todo: Todo{ID: 1, Description: "Clean the house"},
+					Subtasks: []TodoNode{
+						{
+							Todo: Todo{ID: 2, Description: "Sweep the floor", ParentID: &house},
+							Subtasks: []TodoNode{
+								{Todo: Todo{ID: 3, Description: "Mop the floor", ParentID: &floor}, Subtasks: []TodoNode{}},
+							},
+						},
+					},
+				},
+				{Todo: Todo{ID: 4, Description: "Call the bank"}, Subtasks: []TodoNode{}},
+			},
+		},
+		{
+			name: "SubtasksBeforeParent",
+			todos: []Todo{
+				{ID: 2, Description: "Sweep the floor", ParentID: &house},
+				{ID: 1, Description: "Clean the house"},
+			},
+			want: []TodoNode{
+				{
+					Todo: Todo{ID: 1, Description: "Clean the house"},
+					Subtasks: []TodoNode{
+						{Todo: Todo{ID: 2, Description: "Sweep the floor", ParentID: &house}, Subtasks: []TodoNode{}},
+					},
+				},
+			},
+		},
+		{
+			name: "ParentFilteredOut",
+			todos: []Todo{
+				{ID: 3, Description: "Mop the floor", ParentID: &floor},
+				{ID: 4, Description: "Call the bank"},
+			},
+			want: []TodoNode{
+				{Todo: Todo{ID: 3, Description: "Mop the floor", ParentID: &floor}, Subtasks: []TodoNode{}},
+				{Todo: Todo{ID: 4, Description: "Call the bank"}, Subtasks: []TodoNode{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewTodoTree(test.todos)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewTodoTree() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewCommentTree(t *testing.T) {
+	hard := uint32(0)
+	harder := uint32(1)
+
+	comments := []Comment{
+		{ID: 0, Body: "It was hard"},
+		{ID: 1, ParentID: &hard, Body: "Try harder"},
+		{ID: 2, Body: "Change the sheets"},
+		{ID: 3, ParentID: &harder, Body: "I did"},
+		{ID: 4, ParentID: &hard, Body: "Me too"},
+	}
+	want := []CommentNode{
+		{
+			Comment: comments[0],
+			Replies: []CommentNode{
+				{
+					Comment: comments[1],
+					Replies: []CommentNode{{Comment: comments[3], Replies: []CommentNode{}}},
+				},
+				{Comment: comments[4], Replies: []CommentNode{}},
+			},
+		},
+		{Comment: comments[2], Replies: []CommentNode{}},
+	}
+
+	got := NewCommentTree(comments)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NewCommentTree() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Role is what a member may do on a todo list. Each role includes the ones
+// before it.
+type Role string
+
+const (
+	// RoleViewer reads the todo list and everything on it.
+	RoleViewer Role = "viewer"
+	// RoleEditor also changes the todo list and its todos, comments and
+	// attachments.
+	RoleEditor Role = "editor"
+	// RoleOwner also deletes, restores and purges the todo list and its
+	// todos, and shares it with others.
+	RoleOwner Role = "owner"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+var userPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// Valid tells if r is one of the known roles.
+func (r Role) Valid() bool {
+	return roleRanks[r] > 0
+}
+
+// Includes tells if r allows everything other does. No role includes
+// nothing.
+func (r Role) Includes(other Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[other]
+}
+
+// RoleOf returns the role of a user on the todo list, or an empty role when
+// they have none. Anyone, even an unknown user, owns a todo list with no
+// owner.
+func (tl TodoList) RoleOf(user string) Role {
+	if tl.Owner == "" || (user != "" && user == tl.Owner) {
+		return RoleOwner
+	}
+	for _, member := range tl.Members {
+		if member.User == user {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+func (ls *LocalStorage) InsertUser(ctx context.Context, user User) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if !userPattern.MatchString(user.Name) {
+		return nil, ErrInvalidUser
+	}
+	if _, ok := ls.Users[user.Name]; ok {
+		return nil, ErrUserExists
+	}
+
+	user.CreatedAt = now(ctx)
+	ls.Users[user.Name] = user
+	return &user, nil
+}
+
+func (ls *LocalStorage) GetAllUsers(ctx context.Context) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	result := []User{}
+	for _, user := range ls.Users {
+		result = append(result, user)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func (ls *LocalStorage) GetUser(ctx context.Context, name string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	user, ok := ls.Users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (ls *LocalStorage) ShareTodoList(ctx context.Context, id uint32, member Member) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoListTable[id]
+	if !ok {
+		return nil, ErrTodoListNotFound
+	}
+	if _, ok := ls.Users[member.User]; !ok {
+		return nil, ErrUserNotFound
+	}
+	if !member.Role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if member.User == stored.Owner {
+		return nil, ErrOwnerMember
+	}
+
+	members := []Member{}
+	for _, m := range stored.Members {
+		if m.User != member.User {
+			members = append(members, m)
+		}
+	}
+	members = append(members, member)
+	sort.Slice(members, func(i, j int) bool { return members[i].User < members[j].User })
+
+	todoList := ls.setMembers(ctx, stored, members)
+	return &todoList, nil
+}
+
+func (ls *LocalStorage) UnshareTodoList(ctx context.Context, id uint32, user string) (*TodoList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	stored, ok := ls.TodoListTable[id]
+	if !ok {
+		return nil, ErrTodoListNotFound
+	}
+
+	members := []Member{}
+	for _, m := range stored.Members {
+		if m.User != user {
+			members = append(members, m)
+		}
+	}
+	if len(members) == len(stored.Members) {
+		return nil, ErrNotMember
+	}
+
+	todoList := ls.setMembers(ctx, stored, members)
+	return &todoList, nil
+}
+
+// setMembers replaces the members of a stored todo list, which counts as a
+// change of it, and returns it as stored. Must be called with ls.mu held.
+func (ls *LocalStorage) setMembers(ctx context.Context, stored TodoList, members []Member) TodoList {
+	if len(members) == 0 {
+		members = nil
+	}
+
+	todoList := stored
+	todoList.Members = members
+	todoList.Version++
+	todoList.UpdatedAt = now(ctx)
+	ls.TodoListTable[todoList.ID] = todoList
+	ls.recordTodoList(ctx, todoList.ID, ActionUpdate, diffFields(todoListFieldValues(stored), todoListFieldValues(todoList)))
+	return cloneTodoList(todoList)
+}
+
+// cloneTodoList copies the members of a todo list so callers never share
+// memory with the stored record.
+func cloneTodoList(todoList TodoList) TodoList {
+	if todoList.Members != nil {
+		todoList.Members = append([]Member{}, todoList.Members...)
+	}
+	return todoList
+}
+
+// formatMembers writes members as "user:role" pairs separated by commas.
+func formatMembers(members []Member) string {
+	pairs := make([]string, 0, len(members))
+	for _, member := range members {
+		pairs = append(pairs, member.User+":"+string(member.Role))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,96 @@
+package repository
+
+import "testing"
+
+func TestRoleOf(t *testing.T) {
+	type Test struct {
+		name     string
+		todoList TodoList
+		user     string
+		want     Role
+	}
+
+	shared := TodoList{
+		Owner: "alice",
+		Members: []Member{
+			{User: "bob", Role: RoleEditor},
+			{User: "carol", Role: RoleViewer},
+		},
+	}
+
+	tests := []Test{
+		{
+			name:     "Owner",
+			todoList: shared,
+			user:     "alice",
+			want:     RoleOwner,
+		},
+		{
+			name:     "Editor",
+			todoList: shared,
+			user:     "bob",
+			want:     RoleEditor,
+		},
+		{
+			name:     "Viewer",
+			todoList: shared,
+			user:     "carol",
+			want:     RoleViewer,
+		},
+		{
+			name:     "Stranger",
+			todoList: shared,
+			user:     "dave",
+			want:     "",
+		},
+		{
+			name:     "Anonymous",
+			todoList: shared,
+			user:     "",
+			want:     "",
+		},
+		{
+			name:     "NoOwner",
+			todoList: TodoList{},
+			user:     "dave",
+			want:     RoleOwner,
+		},
+		{
+			name:     "NoOwnerAnonymous",
+			todoList: TodoList{},
+			user:     "",
+			want:     RoleOwner,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.todoList.RoleOf(test.user); got != test.want {
+				t.Errorf("RoleOf(%q) = %q; want %q", test.user, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRoleIncludes(t *testing.T) {
+	type Test struct {
+		role  Role
+		other Role
+		want  bool
+	}
+
+	tests := []Test{
+		{role: RoleOwner, other: RoleEditor, want: true},
+		{role: RoleEditor, other: RoleEditor, want: true},
+		{role: RoleEditor, other: RoleOwner, want: false},
+		{role: RoleViewer, other: RoleEditor, want: false},
+		{role: "", other: RoleViewer, want: false},
+		{role: "admin", other: RoleViewer, want: false},
+	}
+
+	for _, test := range tests {
+		if got := test.role.Includes(test.other); got != test.want {
+			t.Errorf("%q.Includes(%q) = %v; want %v", test.role, test.other, got, test.want)
+		}
+	}
+}